@@ -1,8 +1,12 @@
 package main
 
 import (
+	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/solo-io/skv2/codegen"
 	"github.com/solo-io/skv2/codegen/model"
@@ -10,6 +14,7 @@ import (
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cache"
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/version"
 
+	apiextv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 
@@ -49,6 +54,19 @@ func main() {
 								Name: "FilterDeploymentStatus",
 							},
 						},
+						AdditionalPrinterColumns: []apiextv1beta1.CustomResourceColumnDefinition{
+							{
+								Name:        "Ready",
+								Type:        "string",
+								Description: "the number of workloads the filter was created for",
+								JSONPath:    ".status.ready",
+							},
+							{
+								Name:     "Age",
+								Type:     "date",
+								JSONPath: ".metadata.creationTimestamp",
+							},
+						},
 					},
 				},
 				RenderManifests:  true,
@@ -95,6 +113,18 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if err := scopeOperatorRbac(filepath.Join(cmd.ManifestRoot, "templates", "rbac.yaml")); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := validateDeploymentType(filepath.Join(cmd.ManifestRoot, "crds", "wasme.io_v1_crds.yaml")); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := addOperatorReadinessProbe(filepath.Join(cmd.ManifestRoot, "templates", "deployment.yaml")); err != nil {
+		log.Fatal(err)
+	}
+
 	log.Printf("operator generation successful")
 }
 
@@ -131,7 +161,8 @@ func makeOperator() model.Operator {
 		Rbac: []rbacv1.PolicyRule{
 			// api resource
 			{
-				Verbs:     []string{"get", "list", "watch"},
+				// update adds and removes the cleanup finalizer
+				Verbs:     []string{"get", "list", "watch", "update"},
 				APIGroups: []string{"wasme.io"},
 				Resources: []string{"filterdeployments"},
 			},
@@ -140,6 +171,11 @@ func makeOperator() model.Operator {
 				APIGroups: []string{"wasme.io"},
 				Resources: []string{"filterdeployments/status"},
 			},
+			{
+				Verbs:     []string{"update"},
+				APIGroups: []string{"wasme.io"},
+				Resources: []string{"filterdeployments/finalizers"},
+			},
 
 			// dependency
 			{
@@ -152,6 +188,16 @@ func makeOperator() model.Operator {
 				APIGroups: []string{""},
 				Resources: []string{"events"},
 			},
+			{
+				Verbs:     []string{"get"},
+				APIGroups: []string{""},
+				Resources: []string{"namespaces"},
+			},
+			{
+				Verbs:     []string{"list"},
+				APIGroups: []string{""},
+				Resources: []string{"pods"},
+			},
 
 			// managed resources
 			{
@@ -159,6 +205,11 @@ func makeOperator() model.Operator {
 				APIGroups: []string{"apps"},
 				Resources: []string{"deployments", "daemonsets"},
 			},
+			{
+				Verbs:     []string{"get", "list", "watch", "update"},
+				APIGroups: []string{"apps.openshift.io"},
+				Resources: []string{"deploymentconfigs"},
+			},
 			{
 				Verbs:     []string{"*"},
 				APIGroups: []string{"networking.istio.io"},
@@ -169,17 +220,154 @@ func makeOperator() model.Operator {
 				APIGroups: []string{""},
 				Resources: []string{"configmaps"},
 			},
+			{
+				Verbs:     []string{"get", "list", "watch", "update"},
+				APIGroups: []string{"gateway.solo.io"},
+				Resources: []string{"gateways"},
+			},
+
+			// leader election
+			{
+				Verbs:     []string{"get", "create", "update"},
+				APIGroups: []string{"coordination.k8s.io"},
+				Resources: []string{"leases"},
+			},
 		},
 		Args: []string{
 			"operator",
 			"--log-level=debug",
+			// set wasmeOperator.watchNamespaces and wasmeOperator.filterSelector to run one operator per tenant
+			`--watch-namespaces={{ join "," $.Values.wasmeOperator.watchNamespaces }}`,
+			`--filter-selector={{ $.Values.wasmeOperator.filterSelector }}`,
 		},
 	}
 }
 
+// the ClusterRoleBinding skv2 renders for the operator
+const operatorClusterRoleBinding = `---
+
+kind: ClusterRoleBinding
+apiVersion: rbac.authorization.k8s.io/v1
+metadata:
+  name: wasme-operator
+  labels:
+    app: wasme-operator
+subjects:
+- kind: ServiceAccount
+  name: wasme-operator
+  namespace: {{ .Release.Namespace }}
+roleRef:
+  kind: ClusterRole
+  name: wasme-operator
+  apiGroup: rbac.authorization.k8s.io`
+
+// an operator watching some namespaces is only granted its ClusterRole in these namespaces,
+// in its own namespace (the cache and the leader election Lease) and in the istio namespace (istiod and mesh-wide filters).
+// namespaces can only be read by name, which RoleBindings allow in their own namespace
+const operatorNamespacedRoleBindings = `{{- if $.Values.wasmeOperator.watchNamespaces }}
+{{- $istioNamespace := $.Values.wasmeOperator.istioNamespace | default "istio-system" }}
+{{- range $namespace := append (append $.Values.wasmeOperator.watchNamespaces $.Release.Namespace) $istioNamespace | uniq }}
+
+---
+
+kind: RoleBinding
+apiVersion: rbac.authorization.k8s.io/v1
+metadata:
+  name: wasme-operator
+  namespace: {{ $namespace }}
+  labels:
+    app: wasme-operator
+subjects:
+- kind: ServiceAccount
+  name: wasme-operator
+  namespace: {{ $.Release.Namespace }}
+roleRef:
+  kind: ClusterRole
+  name: wasme-operator
+  apiGroup: rbac.authorization.k8s.io
+{{- end }}
+{{- else }}
+
+` + operatorClusterRoleBinding + `
+{{- end }}`
+
+// skv2 binds the rules of the operator cluster-wide, so the binding is replaced
+// with RoleBindings if the chart is installed with wasmeOperator.watchNamespaces
+func scopeOperatorRbac(rbacFile string) error {
+	rbac, err := ioutil.ReadFile(rbacFile)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(rbac), operatorClusterRoleBinding) {
+		return fmt.Errorf("did not find the ClusterRoleBinding of the operator in %v", rbacFile)
+	}
+	scoped := strings.Replace(string(rbac), operatorClusterRoleBinding, operatorNamespacedRoleBindings, 1)
+	return ioutil.WriteFile(rbacFile, []byte(scoped), 0644)
+}
+
+// the schema of the FilterDeployment CRD, rejecting deployments which set more than one deployment type.
+// the operator cannot tell which of the types was set, as the last one parsed overwrites the others
+const deploymentTypeValidation = `  validation:
+    openAPIV3Schema:
+      properties:
+        spec:
+          properties:
+            deployment:
+              description: only one of istio and gloo may be set
+              maxProperties: 1
+              type: object
+          type: object
+      type: object
+`
+
+// skv2 renders the CRD without a schema, so the schema validating the deployment type is added to it
+func validateDeploymentType(crdFile string) error {
+	crd, err := ioutil.ReadFile(crdFile)
+	if err != nil {
+		return err
+	}
+	const versions = "  versions:\n"
+	if !strings.Contains(string(crd), versions) {
+		return fmt.Errorf("did not find the versions of the CRD in %v", crdFile)
+	}
+	validated := strings.Replace(string(crd), versions, deploymentTypeValidation+versions, 1)
+	return ioutil.WriteFile(crdFile, []byte(validated), 0644)
+}
+
+// the container of the operator in the deployment skv2 renders
+const operatorContainerName = "        name: wasme-operator\n"
+
+// the health probe port of the operator, which must match operator.HealthProbePort,
+// and the probe of its /readyz endpoint, which reports ready once the informer caches
+// have synced and the abi registry is loaded
+const operatorReadinessProbe = `        ports:
+        - name: health
+          containerPort: 9092
+        readinessProbe:
+          httpGet:
+            path: /readyz
+            port: health
+          periodSeconds: 5
+`
+
+// skv2 renders neither the ports nor the probes of the operator container, so the readiness probe is added to it
+func addOperatorReadinessProbe(deploymentFile string) error {
+	deployment, err := ioutil.ReadFile(deploymentFile)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(deployment), operatorContainerName) {
+		return fmt.Errorf("did not find the container of the operator in %v", deploymentFile)
+	}
+	probed := strings.Replace(string(deployment), operatorContainerName, operatorContainerName+operatorReadinessProbe, 1)
+	return ioutil.WriteFile(deploymentFile, []byte(probed), 0644)
+}
+
 func makeCache() model.Operator {
 	name := "wasme-cache"
-	defaultDaemonSet := cache.MakeDaemonSet(name, "", "", nil, nil, "")
+	defaultDaemonSet := cache.MakeDaemonSet(name, "", "", nil, cache.DefaultCacheArgs("{{ .Release.Namespace }}"), "")
+	// set wasmeCache.registrySecret to the kubernetes.io/dockerconfigjson secret used to pull from private registries
+	cache.AddRegistrySecret(defaultDaemonSet, `{{ $.Values.wasmeCache.registrySecret | default "wasme-cache-registry" }}`)
 	defaultRole, _ := cache.MakeRbac(name, "")
 	cacheVolumes := defaultDaemonSet.Spec.Template.Spec.Volumes
 	cacheContainer := defaultDaemonSet.Spec.Template.Spec.Containers[0]
@@ -191,7 +379,16 @@ func makeCache() model.Operator {
 			Resources:    &cacheContainer.Resources,
 			UseDaemonSet: true,
 		},
-		Args:         cache.DefaultCacheArgs("{{ .Release.Namespace }}"),
+		// proxies fetch the cached modules from the service in the remote data source mode
+		Service: model.Service{
+			Type: v1.ServiceTypeClusterIP,
+			Ports: []model.ServicePort{{
+				Name:        "http",
+				DefaultPort: cache.ServerPort,
+			}},
+		},
+		Args:         cacheContainer.Args,
+		Env:          cacheContainer.Env,
 		Volumes:      cacheVolumes,
 		VolumeMounts: cacheContainer.VolumeMounts,
 		Rbac:         defaultRole.Rules,
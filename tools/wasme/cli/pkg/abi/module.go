@@ -0,0 +1,378 @@
+package abi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// the prefix of the export declaring the version of the proxy-wasm ABI implemented by a module
+	proxyAbiVersionExportPrefix = "proxy_abi_version_"
+
+	// the sections of a wasm module read to find the exports and the signatures of the exported functions
+	wasmTypeSectionId     = 1
+	wasmImportSectionId   = 2
+	wasmFunctionSectionId = 3
+	wasmExportSectionId   = 7
+
+	// the kinds of imports and exports
+	wasmKindFunction = 0
+	wasmKindTable    = 1
+	wasmKindMemory   = 2
+	wasmKindGlobal   = 3
+
+	// the byte starting each function type of the type section
+	wasmFunctionType = 0x60
+)
+
+var wasmMagic = []byte{0x00, 0x61, 0x73, 0x6d}
+
+// the AbiVersions of the hosts able to run a module, by the proxy-wasm ABI version exported by the module
+var proxyAbiVersions = map[string][]Version{
+	"proxy_abi_version_0_1_0": {
+		Version_097b7f2e4cc1fb490cc1943d0d633655ac3c522f,
+		Version_edc016b1fa5adca3ebd3d7020eaed0ad7b8814ca,
+	},
+	"proxy_abi_version_0_2_0": {
+		Version_4689a30309abf31aee9ae36e73d34b1bb182685f,
+		Version_0_2_1,
+	},
+	"proxy_abi_version_0_2_1": {
+		Version_0_2_1,
+	},
+}
+
+// the exports a module must define to be run by the proxy
+var requiredProxyExports = []string{
+	"proxy_on_context_create",
+}
+
+// the proxy-wasm ABI version of the modules which export no proxy_abi_version_* symbol, by the number of parameters of
+// proxy_on_request_headers (or proxy_on_response_headers): the end_of_stream parameter was added by ABI version 0.2.0
+var proxyAbiVersionsByHeadersParams = map[int]string{
+	2: "proxy_abi_version_0_1_0",
+	3: "proxy_abi_version_0_2_0",
+}
+
+var headersCallbacks = []string{
+	"proxy_on_request_headers",
+	"proxy_on_response_headers",
+}
+
+// ModuleAbiVersions returns the names of the AbiVersions compatible with the module,
+// after validating the module exports the proxy-wasm ABI symbols
+func ModuleAbiVersions(module []byte) ([]string, error) {
+	parsed, err := parseWasmModule(module)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading the exports of the module")
+	}
+	if err := parsed.validateProxyExports(); err != nil {
+		return nil, err
+	}
+
+	exported := parsed.abiVersionExports()
+	if len(exported) != 1 {
+		return nil, errors.Errorf("the module must export exactly one %v* symbol, found %v", proxyAbiVersionExportPrefix, exported)
+	}
+	return abiVersionNames(exported[0])
+}
+
+// InferAbiVersions returns the names of the AbiVersions compatible with the module, for images whose config
+// declares none. the versions are read from the proxy_abi_version_* symbol exported by the module, or inferred from
+// the signatures of the proxy_on_*_headers callbacks of modules which export none, e.g. modules built for ABI 0.1.0.
+// returns an error if the ABI version of the module cannot be determined
+func InferAbiVersions(module []byte) ([]string, error) {
+	parsed, err := parseWasmModule(module)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading the exports of the module")
+	}
+	if err := parsed.validateProxyExports(); err != nil {
+		return nil, err
+	}
+
+	switch exported := parsed.abiVersionExports(); len(exported) {
+	case 0:
+	case 1:
+		return abiVersionNames(exported[0])
+	default:
+		return nil, errors.Errorf("the module exports several %v* symbols: %v", proxyAbiVersionExportPrefix, exported)
+	}
+
+	for _, callback := range headersCallbacks {
+		params, ok := parsed.exportedFunctionParams(callback)
+		if !ok {
+			continue
+		}
+		abiVersion, ok := proxyAbiVersionsByHeadersParams[params]
+		if !ok {
+			return nil, errors.Errorf("the exported %v function takes %v parameters, which matches no proxy-wasm ABI version", callback, params)
+		}
+		return abiVersionNames(abiVersion)
+	}
+	return nil, errors.Errorf("the module exports no %v* symbol and none of %v", proxyAbiVersionExportPrefix, headersCallbacks)
+}
+
+func abiVersionNames(abiVersionExport string) ([]string, error) {
+	versions, ok := proxyAbiVersions[abiVersionExport]
+	if !ok {
+		return nil, errors.Errorf("the proxy-wasm ABI version %v exported by the module is not supported", strings.TrimPrefix(abiVersionExport, proxyAbiVersionExportPrefix))
+	}
+	var names []string
+	for _, version := range versions {
+		names = append(names, version.Name)
+	}
+	return names, nil
+}
+
+// the exports of a wasm module, and the number of parameters of each of its function types
+type wasmModule struct {
+	// the index of each export, in the index space of its kind
+	exports map[string]wasmExport
+	// the number of parameters of each function type
+	typeParams []int
+	// the type of each function of the function index space, imported functions first
+	functionTypes []uint64
+}
+
+type wasmExport struct {
+	kind  byte
+	index uint64
+}
+
+func (m *wasmModule) validateProxyExports() error {
+	for _, export := range requiredProxyExports {
+		if _, ok := m.exports[export]; !ok {
+			return errors.Errorf("the module does not export %v, is it built with the proxy-wasm SDK?", export)
+		}
+	}
+	return nil
+}
+
+// returns the proxy_abi_version_* exports of the module, sorted
+func (m *wasmModule) abiVersionExports() []string {
+	var exported []string
+	for export := range m.exports {
+		if strings.HasPrefix(export, proxyAbiVersionExportPrefix) {
+			exported = append(exported, export)
+		}
+	}
+	sort.Strings(exported)
+	return exported
+}
+
+// returns the number of parameters of the exported function, false if it is not exported or its type is unknown
+func (m *wasmModule) exportedFunctionParams(name string) (int, bool) {
+	export, ok := m.exports[name]
+	if !ok || export.kind != wasmKindFunction || export.index >= uint64(len(m.functionTypes)) {
+		return 0, false
+	}
+	typeIndex := m.functionTypes[export.index]
+	if typeIndex >= uint64(len(m.typeParams)) {
+		return 0, false
+	}
+	return m.typeParams[typeIndex], true
+}
+
+// reads the type, import, function and export sections of the wasm module
+func parseWasmModule(module []byte) (*wasmModule, error) {
+	if len(module) < 8 || !bytes.Equal(module[:4], wasmMagic) {
+		return nil, errors.Errorf("not a wasm module")
+	}
+	reader := bytes.NewReader(module[8:])
+
+	parsed := &wasmModule{exports: map[string]wasmExport{}}
+	for {
+		sectionId, err := reader.ReadByte()
+		if err == io.EOF {
+			return parsed, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		size, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading section size")
+		}
+		if size > uint64(reader.Len()) {
+			return nil, errors.Errorf("section %v is truncated", sectionId)
+		}
+		section := make([]byte, size)
+		if _, err := io.ReadFull(reader, section); err != nil {
+			return nil, err
+		}
+		switch sectionId {
+		case wasmTypeSectionId:
+			err = errors.Wrap(parsed.readTypeSection(section), "reading type section")
+		case wasmImportSectionId:
+			err = errors.Wrap(parsed.readImportSection(section), "reading import section")
+		case wasmFunctionSectionId:
+			err = errors.Wrap(parsed.readFunctionSection(section), "reading function section")
+		case wasmExportSectionId:
+			err = errors.Wrap(parsed.readExportSection(section), "reading export section")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (m *wasmModule) readTypeSection(section []byte) error {
+	reader := bytes.NewReader(section)
+	count, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < count; i++ {
+		form, err := reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		if form != wasmFunctionType {
+			return errors.Errorf("unknown type form 0x%x", form)
+		}
+		params, err := skipValueTypes(reader)
+		if err != nil {
+			return err
+		}
+		if _, err := skipValueTypes(reader); err != nil {
+			return err
+		}
+		m.typeParams = append(m.typeParams, params)
+	}
+	return nil
+}
+
+func (m *wasmModule) readImportSection(section []byte) error {
+	reader := bytes.NewReader(section)
+	count, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < count; i++ {
+		// the module and field names of the import
+		for j := 0; j < 2; j++ {
+			if _, err := readName(reader); err != nil {
+				return err
+			}
+		}
+		kind, err := reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case wasmKindFunction:
+			typeIndex, err := binary.ReadUvarint(reader)
+			if err != nil {
+				return err
+			}
+			m.functionTypes = append(m.functionTypes, typeIndex)
+		case wasmKindTable:
+			// the element type of the table, then its limits
+			if _, err := reader.ReadByte(); err != nil {
+				return err
+			}
+			err = skipLimits(reader)
+		case wasmKindMemory:
+			err = skipLimits(reader)
+		case wasmKindGlobal:
+			// the value type and mutability of the global
+			_, err = reader.Seek(2, io.SeekCurrent)
+		default:
+			err = errors.Errorf("unknown import kind %v", kind)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *wasmModule) readFunctionSection(section []byte) error {
+	reader := bytes.NewReader(section)
+	count, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < count; i++ {
+		typeIndex, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return err
+		}
+		m.functionTypes = append(m.functionTypes, typeIndex)
+	}
+	return nil
+}
+
+func (m *wasmModule) readExportSection(section []byte) error {
+	reader := bytes.NewReader(section)
+	count, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < count; i++ {
+		name, err := readName(reader)
+		if err != nil {
+			return errors.Wrap(err, "export name")
+		}
+		// the kind of the export
+		kind, err := reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		// the index of the exported function, table, memory or global
+		index, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return err
+		}
+		m.exports[name] = wasmExport{kind: kind, index: index}
+	}
+	return nil
+}
+
+func readName(reader *bytes.Reader) (string, error) {
+	nameLen, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return "", err
+	}
+	if nameLen > uint64(reader.Len()) {
+		return "", errors.Errorf("name is truncated")
+	}
+	name := make([]byte, nameLen)
+	if _, err := io.ReadFull(reader, name); err != nil {
+		return "", err
+	}
+	return string(name), nil
+}
+
+// skips a vector of value types, returning its length
+func skipValueTypes(reader *bytes.Reader) (int, error) {
+	count, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return 0, err
+	}
+	if count > uint64(reader.Len()) {
+		return 0, errors.Errorf("value types are truncated")
+	}
+	_, err = reader.Seek(int64(count), io.SeekCurrent)
+	return int(count), err
+}
+
+// skips the limits of a table or memory: a flag, the minimum, and the maximum if the flag is set
+func skipLimits(reader *bytes.Reader) error {
+	flag, err := reader.ReadByte()
+	if err != nil {
+		return err
+	}
+	if _, err := binary.ReadUvarint(reader); err != nil {
+		return err
+	}
+	if flag&1 == 1 {
+		_, err = binary.ReadUvarint(reader)
+	}
+	return err
+}
@@ -0,0 +1,156 @@
+package abi_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/solo-io/wasm/tools/wasme/cli/pkg/abi"
+)
+
+const i32 = 0x7f
+
+// a function of a fixture module, imported from the host or exported by the module
+type wasmFunction struct {
+	name    string
+	params  int
+	results int
+}
+
+// assembles a wasm module importing and exporting the functions, laid out like the modules built by the proxy-wasm SDKs:
+// a type section, an import section with the host functions and the memory, a function section and an export section
+func makeModule(imports []wasmFunction, exports ...wasmFunction) []byte {
+	vector := func(items ...[]byte) []byte {
+		v := []byte{byte(len(items))}
+		for _, item := range items {
+			v = append(v, item...)
+		}
+		return v
+	}
+	name := func(name string) []byte {
+		return append([]byte{byte(len(name))}, name...)
+	}
+	section := func(id byte, content []byte) []byte {
+		return append([]byte{id, byte(len(content))}, content...)
+	}
+
+	var types, importEntries, functions, exportEntries [][]byte
+	addType := func(f wasmFunction) byte {
+		signature := []byte{0x60, byte(f.params)}
+		for i := 0; i < f.params; i++ {
+			signature = append(signature, i32)
+		}
+		signature = append(signature, byte(f.results))
+		for i := 0; i < f.results; i++ {
+			signature = append(signature, i32)
+		}
+		types = append(types, signature)
+		return byte(len(types) - 1)
+	}
+	for _, f := range imports {
+		importEntries = append(importEntries, append(append(name("env"), name(f.name)...), 0x00, addType(f)))
+	}
+	// the memory imported by emscripten modules, with a minimum and a maximum
+	importEntries = append(importEntries, append(append(name("env"), name("memory")...), 0x02, 0x01, 0x02, 0x10))
+	for _, f := range exports {
+		functions = append(functions, []byte{addType(f)})
+		// exported functions are indexed after the imported functions
+		exportEntries = append(exportEntries, append(name(f.name), 0x00, byte(len(imports)+len(functions)-1)))
+	}
+
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	module = append(module, section(1, vector(types...))...)
+	module = append(module, section(2, vector(importEntries...))...)
+	module = append(module, section(3, vector(functions...))...)
+	return append(module, section(7, vector(exportEntries...))...)
+}
+
+var (
+	hostFunctions = []wasmFunction{
+		{name: "proxy_log", params: 3, results: 1},
+		{name: "proxy_get_header_map_value", params: 5, results: 1},
+	}
+	contextCreate = wasmFunction{name: "proxy_on_context_create", params: 2}
+
+	// a module built for proxy-wasm ABI 0.1.0, which exports no abi version
+	abi010Module = makeModule(hostFunctions,
+		contextCreate,
+		wasmFunction{name: "proxy_on_request_headers", params: 2, results: 1},
+		wasmFunction{name: "proxy_on_response_headers", params: 2, results: 1},
+	)
+	// a module built for proxy-wasm ABI 0.2.0, whose headers callbacks take end_of_stream
+	abi020Module = makeModule(hostFunctions,
+		contextCreate,
+		wasmFunction{name: "proxy_on_request_headers", params: 3, results: 1},
+	)
+	// a module exporting the proxy-wasm ABI version it implements
+	abi020ExportModule = makeModule(hostFunctions,
+		contextCreate,
+		wasmFunction{name: "proxy_abi_version_0_2_0"},
+		wasmFunction{name: "proxy_on_request_headers", params: 3, results: 1},
+	)
+)
+
+var _ = Describe("Module ABI versions", func() {
+	abi010Versions := []string{Version_097b7f2e4cc1fb490cc1943d0d633655ac3c522f.Name, Version_edc016b1fa5adca3ebd3d7020eaed0ad7b8814ca.Name}
+	abi020Versions := []string{Version_4689a30309abf31aee9ae36e73d34b1bb182685f.Name, Version_0_2_1.Name}
+
+	Context("ModuleAbiVersions", func() {
+		It("returns the AbiVersions compatible with the exported proxy-wasm ABI version", func() {
+			versions, err := ModuleAbiVersions(abi020ExportModule)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(versions).To(Equal(abi020Versions))
+		})
+
+		It("rejects modules not exporting the proxy-wasm ABI symbols", func() {
+			_, err := ModuleAbiVersions(makeModule(nil, wasmFunction{name: "_start"}))
+			Expect(err).To(MatchError("the module does not export proxy_on_context_create, is it built with the proxy-wasm SDK?"))
+
+			_, err = ModuleAbiVersions(abi020Module)
+			Expect(err).To(MatchError("the module must export exactly one proxy_abi_version_* symbol, found []"))
+
+			_, err = ModuleAbiVersions(makeModule(nil, contextCreate, wasmFunction{name: "proxy_abi_version_9_9_9"}))
+			Expect(err).To(MatchError("the proxy-wasm ABI version 9_9_9 exported by the module is not supported"))
+		})
+
+		It("rejects files which are not wasm modules", func() {
+			_, err := ModuleAbiVersions([]byte("#!/bin/sh\n"))
+			Expect(err).To(MatchError("reading the exports of the module: not a wasm module"))
+
+			_, err = ModuleAbiVersions(abi020ExportModule[:len(abi020ExportModule)-4])
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("InferAbiVersions", func() {
+		It("reads the exported proxy-wasm ABI version", func() {
+			versions, err := InferAbiVersions(abi020ExportModule)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(versions).To(Equal(abi020Versions))
+		})
+
+		It("infers the proxy-wasm ABI version from the signatures of the headers callbacks", func() {
+			versions, err := InferAbiVersions(abi010Module)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(versions).To(Equal(abi010Versions))
+
+			versions, err = InferAbiVersions(abi020Module)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(versions).To(Equal(abi020Versions))
+
+			// modules which only handle responses
+			versions, err = InferAbiVersions(makeModule(hostFunctions, contextCreate, wasmFunction{name: "proxy_on_response_headers", params: 2, results: 1}))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(versions).To(Equal(abi010Versions))
+		})
+
+		It("fails when the ABI version cannot be inferred", func() {
+			_, err := InferAbiVersions(makeModule(hostFunctions, contextCreate))
+			Expect(err).To(MatchError("the module exports no proxy_abi_version_* symbol and none of [proxy_on_request_headers proxy_on_response_headers]"))
+
+			_, err = InferAbiVersions(makeModule(hostFunctions, contextCreate, wasmFunction{name: "proxy_on_request_headers", params: 4, results: 1}))
+			Expect(err).To(MatchError("the exported proxy_on_request_headers function takes 4 parameters, which matches no proxy-wasm ABI version"))
+
+			_, err = InferAbiVersions([]byte("not wasm"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
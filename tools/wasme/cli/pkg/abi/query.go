@@ -0,0 +1,66 @@
+package abi
+
+import (
+	"sort"
+)
+
+// ListAbiVersions returns the abi versions of the registry, sorted by name
+func (registry Registry) ListAbiVersions() Versions {
+	var versions Versions
+	for version := range registry {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Name < versions[j].Name
+	})
+	return versions
+}
+
+// IstioVersionsFor returns the istio versions supporting the abi version, e.g. 1.7.x.
+// returns nil if the abi version is not in the registry
+func (registry Registry) IstioVersionsFor(abiVersion string) []string {
+	return registry.platformVersionsFor(PlatformNameIstio, abiVersion)
+}
+
+// GlooVersionsFor returns the gloo versions supporting the abi version, e.g. 1.6.x.
+// returns nil if the abi version is not in the registry
+func (registry Registry) GlooVersionsFor(abiVersion string) []string {
+	return registry.platformVersionsFor(PlatformNameGloo, abiVersion)
+}
+
+// AbiVersionsFor returns the abi versions supported by the istio version, sorted by name.
+// the istio version may be a release, e.g. 1.8.2, or an X version, e.g. 1.8.x
+func (registry Registry) AbiVersionsFor(istioVersion string) (Versions, error) {
+	var versions Versions
+	for _, version := range registry.ListAbiVersions() {
+		for _, platform := range registry[version] {
+			if platform.Name != PlatformNameIstio {
+				continue
+			}
+			match, err := matchVersion(istioVersion, platform.Version)
+			if err != nil {
+				return nil, err
+			}
+			if match {
+				versions = append(versions, version)
+				break
+			}
+		}
+	}
+	return versions, nil
+}
+
+func (registry Registry) platformVersionsFor(platformName, abiVersion string) []string {
+	version, ok := registry.findVersion(abiVersion)
+	if !ok {
+		return nil
+	}
+	var platformVersions []string
+	for _, platform := range registry[version] {
+		if platform.Name == platformName {
+			platformVersions = append(platformVersions, platform.Version)
+		}
+	}
+	sort.Strings(platformVersions)
+	return platformVersions
+}
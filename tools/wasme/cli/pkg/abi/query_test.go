@@ -0,0 +1,52 @@
+package abi_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/solo-io/wasm/tools/wasme/cli/pkg/abi"
+)
+
+var _ = Describe("ABI Version Registry queries", func() {
+	It("lists the abi versions by name", func() {
+		Expect(DefaultRegistry.ListAbiVersions()).To(Equal(Versions{
+			Version_097b7f2e4cc1fb490cc1943d0d633655ac3c522f,
+			Version_4689a30309abf31aee9ae36e73d34b1bb182685f,
+			Version_edc016b1fa5adca3ebd3d7020eaed0ad7b8814ca,
+			Version_0_2_1,
+		}))
+	})
+
+	It("returns the platform versions supporting an abi version", func() {
+		Expect(DefaultRegistry.IstioVersionsFor(Version_097b7f2e4cc1fb490cc1943d0d633655ac3c522f.Name)).To(Equal([]string{"1.5.x", "1.6.x"}))
+		Expect(DefaultRegistry.IstioVersionsFor(Version_0_2_1.Name)).To(BeEmpty())
+		Expect(DefaultRegistry.GlooVersionsFor(Version_0_2_1.Name)).To(Equal([]string{"1.6.x", "1.7.x"}))
+		Expect(DefaultRegistry.IstioVersionsFor("v0-unknown")).To(BeNil())
+	})
+
+	It("returns the abi versions supported by an istio version", func() {
+		versions, err := DefaultRegistry.AbiVersionsFor("1.8.2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(versions).To(Equal(Versions{Version_4689a30309abf31aee9ae36e73d34b1bb182685f}))
+
+		versions, err = DefaultRegistry.AbiVersionsFor("1.6.x")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(versions).To(Equal(Versions{Version_097b7f2e4cc1fb490cc1943d0d633655ac3c522f}))
+
+		versions, err = DefaultRegistry.AbiVersionsFor("1.4.0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(versions).To(BeEmpty())
+	})
+
+	It("answers the queries with the merged registry", func() {
+		custom, err := ParseRegistry([]byte(`
+v0-4689a30309abf31aee9ae36e73d34b1bb182685f:
+  istio: [1.9.x]
+`))
+		Expect(err).NotTo(HaveOccurred())
+		registry := DefaultRegistry.Merge(custom)
+		Expect(registry.IstioVersionsFor(Version_4689a30309abf31aee9ae36e73d34b1bb182685f.Name)).To(Equal([]string{"1.7.x", "1.8.x", "1.9.x"}))
+		versions, err := registry.AbiVersionsFor("1.9.0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(versions).To(Equal(Versions{Version_4689a30309abf31aee9ae36e73d34b1bb182685f}))
+	})
+})
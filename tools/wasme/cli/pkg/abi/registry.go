@@ -0,0 +1,110 @@
+package abi
+
+import (
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// a user-supplied mapping of ABI version names to the platform versions supporting them, e.g.
+//
+//	v0-4689a30309abf31aee9ae36e73d34b1bb182685f:
+//	  istio:
+//	  - 1.9.x
+type registryFile map[string]map[string][]string
+
+// load a Registry from a YAML file
+func LoadRegistryFile(path string) (Registry, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	registry, err := ParseRegistry(raw)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing abi registry file %v", path)
+	}
+	return registry, nil
+}
+
+// parse a Registry from YAML.
+// ABI versions already known to the DefaultRegistry keep their repository and commit.
+func ParseRegistry(raw []byte) (Registry, error) {
+	var file registryFile
+	if err := yaml.UnmarshalStrict(raw, &file); err != nil {
+		return nil, err
+	}
+
+	registry := Registry{}
+	for name, platforms := range file {
+		if name == "" {
+			return nil, errors.Errorf("abi version name cannot be empty")
+		}
+		version := Version{Name: name}
+		if known, ok := DefaultRegistry.findVersion(name); ok {
+			version = known
+		}
+		for platformName, platformVersions := range platforms {
+			if platformName != PlatformNameIstio && platformName != PlatformNameGloo {
+				return nil, errors.Errorf("abi version %v: unknown platform %v, must be %v or %v", name, platformName, PlatformNameIstio, PlatformNameGloo)
+			}
+			for _, platformVersion := range platformVersions {
+				if _, err := regexp.Compile(strings.ReplaceAll(platformVersion, "x", `.*`)); err != nil || platformVersion == "" {
+					return nil, errors.Errorf("abi version %v: invalid %v version %q", name, platformName, platformVersion)
+				}
+				registry[version] = append(registry[version], Platform{
+					Name:    platformName,
+					Version: platformVersion,
+				})
+			}
+		}
+	}
+	return registry, nil
+}
+
+// Merge returns a new Registry combining the registry with the overrides.
+// ABI versions are matched by name. If both registries map the same platform
+// to different ABI versions, the mapping in overrides is used.
+func (registry Registry) Merge(overrides Registry) Registry {
+	merged := Registry{}
+	for version, platforms := range registry {
+		for _, platform := range platforms {
+			if overrideVersion, ok := overrides.SelectVersion(platform); ok && overrideVersion.Name != version.Name {
+				// the overrides map this platform to a different version
+				continue
+			}
+			merged[version] = append(merged[version], platform)
+		}
+	}
+	for version, platforms := range overrides {
+		if known, ok := merged.findVersion(version.Name); ok {
+			version = known
+		}
+		for _, platform := range platforms {
+			if !containsPlatform(merged[version], platform) {
+				merged[version] = append(merged[version], platform)
+			}
+		}
+	}
+	return merged
+}
+
+func (registry Registry) findVersion(name string) (Version, bool) {
+	for version := range registry {
+		if version.Name == name {
+			return version, true
+		}
+	}
+	return Version{}, false
+}
+
+func containsPlatform(platforms []Platform, platform Platform) bool {
+	for _, p := range platforms {
+		if p == platform {
+			return true
+		}
+	}
+	return false
+}
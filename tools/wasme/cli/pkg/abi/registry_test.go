@@ -0,0 +1,83 @@
+package abi_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/solo-io/wasm/tools/wasme/cli/pkg/abi"
+)
+
+var _ = Describe("ABI Version Registry overrides", func() {
+	It("extends the default registry with a new istio version", func() {
+		custom, err := ParseRegistry([]byte(`
+v0-4689a30309abf31aee9ae36e73d34b1bb182685f:
+  istio:
+  - 1.9.x
+`))
+		Expect(err).NotTo(HaveOccurred())
+
+		err = DefaultRegistry.ValidateIstioVersion([]string{Version_4689a30309abf31aee9ae36e73d34b1bb182685f.Name}, "1.9.0")
+		Expect(err).To(HaveOccurred())
+
+		registry := DefaultRegistry.Merge(custom)
+		err = registry.ValidateIstioVersion([]string{Version_4689a30309abf31aee9ae36e73d34b1bb182685f.Name}, "1.9.0")
+		Expect(err).NotTo(HaveOccurred())
+		// existing mappings are kept
+		err = registry.ValidateIstioVersion([]string{Version_4689a30309abf31aee9ae36e73d34b1bb182685f.Name}, "1.7.0")
+		Expect(err).NotTo(HaveOccurred())
+
+		// known versions keep their repository and commit
+		version, ok := registry.SelectVersion(Platform{Name: PlatformNameIstio, Version: "1.9.x"})
+		Expect(ok).To(BeTrue())
+		Expect(version).To(Equal(Version_4689a30309abf31aee9ae36e73d34b1bb182685f))
+	})
+
+	It("prefers the user-supplied mapping for conflicting entries", func() {
+		custom, err := ParseRegistry([]byte(`
+v0-new-abi:
+  istio: [1.8.x]
+`))
+		Expect(err).NotTo(HaveOccurred())
+
+		registry := DefaultRegistry.Merge(custom)
+		version, ok := registry.SelectVersion(Istio18)
+		Expect(ok).To(BeTrue())
+		Expect(version).To(Equal(Version{Name: "v0-new-abi"}))
+
+		err = registry.ValidateIstioVersion([]string{Version_4689a30309abf31aee9ae36e73d34b1bb182685f.Name}, "1.8.0")
+		Expect(err).To(HaveOccurred())
+		err = registry.ValidateIstioVersion([]string{Version_4689a30309abf31aee9ae36e73d34b1bb182685f.Name}, "1.7.0")
+		Expect(err).NotTo(HaveOccurred())
+
+		// the default registry is not modified
+		err = DefaultRegistry.ValidateIstioVersion([]string{Version_4689a30309abf31aee9ae36e73d34b1bb182685f.Name}, "1.8.0")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("returns a line-numbered error for malformed yaml", func() {
+		_, err := ParseRegistry([]byte(`
+v0-new-abi:
+  istio: 1.8.x
+`))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("line 3"))
+
+		_, err = ParseRegistry([]byte(`
+v0-new-abi:
+  istio:
+  - 1.8.x
+ gloo: [1.6.x]
+`))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("line 4"))
+	})
+
+	It("rejects unknown platforms", func() {
+		_, err := ParseRegistry([]byte(`
+v0-new-abi:
+  envoy: [1.17.x]
+`))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("unknown platform envoy"))
+	})
+})
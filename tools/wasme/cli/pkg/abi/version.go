@@ -2,6 +2,7 @@ package abi
 
 import (
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -64,16 +65,26 @@ func (registry Registry) SelectVersion(platform Platform) (Version, bool) {
 
 // helper check the abi version compatibility
 func (registry Registry) ValidateIstioVersion(abiVersions []string, istioVersion string) error {
+	return registry.validatePlatformVersion(PlatformNameIstio, abiVersions, istioVersion)
+}
+
+// ValidateGlooVersion returns an error unless one of the abi versions is supported by the gloo version,
+// i.e. by the Envoy of the gateway-proxy of that release of Gloo
+func (registry Registry) ValidateGlooVersion(abiVersions []string, glooVersion string) error {
+	return registry.validatePlatformVersion(PlatformNameGloo, abiVersions, strings.TrimPrefix(glooVersion, "v"))
+}
+
+func (registry Registry) validatePlatformVersion(platformName string, abiVersions []string, platformVersion string) error {
 	var versionFound bool
 	for version, platforms := range registry {
 		for _, abiVersion := range abiVersions {
 			if version.Name == abiVersion {
 				versionFound = true
 				for _, platform := range platforms {
-					if platform.Name != PlatformNameIstio {
+					if platform.Name != platformName {
 						continue
 					}
-					match, err := matchVersion(istioVersion, platform.Version)
+					match, err := matchVersion(platformVersion, platform.Version)
 					if err != nil {
 						return err
 					}
@@ -87,7 +98,34 @@ func (registry Registry) ValidateIstioVersion(abiVersions []string, istioVersion
 	if !versionFound {
 		return errors.Errorf("abi versions %v not found", abiVersions)
 	}
-	return errors.Errorf("no versions of istio found which support abi versions %v. registered versions: %v", abiVersions, registry)
+	return errors.Errorf("no versions of %v found which support abi versions %v. registered versions: %v", platformName, abiVersions, registry)
+}
+
+// IstioProxyVersionRegex returns an RE2 expression matching the istio proxy versions
+// which support any of the abi versions, e.g. `^(1\.7\..*|1\.8\..*)$`.
+// returns an empty string if no istio versions support the abi versions
+func (registry Registry) IstioProxyVersionRegex(abiVersions []string) string {
+	var patterns []string
+	seen := map[string]bool{}
+	for version, platforms := range registry {
+		for _, abiVersion := range abiVersions {
+			if version.Name != abiVersion {
+				continue
+			}
+			for _, platform := range platforms {
+				if platform.Name != PlatformNameIstio || seen[platform.Version] {
+					continue
+				}
+				seen[platform.Version] = true
+				patterns = append(patterns, xVersionPattern(platform.Version))
+			}
+		}
+	}
+	if len(patterns) == 0 {
+		return ""
+	}
+	sort.Strings(patterns)
+	return "^(" + strings.Join(patterns, "|") + ")$"
 }
 
 // the default registry of AbiVersions used by Wasme
@@ -120,6 +158,10 @@ var (
 		Name:    PlatformNameGloo,
 		Version: Version16x,
 	}
+	Gloo17 = Platform{
+		Name:    PlatformNameGloo,
+		Version: Version17x,
+	}
 
 	Version_097b7f2e4cc1fb490cc1943d0d633655ac3c522f = Version{
 		// December 12 2019
@@ -163,6 +205,7 @@ var (
 		},
 		Version_0_2_1: {
 			Gloo16,
+			Gloo17,
 		},
 	}
 )
@@ -176,3 +219,13 @@ func matchVersion(realVersion, xVersion string) (bool, error) {
 	}
 	return rxp.MatchString(realVersion), nil
 }
+
+// convert an X version to a regex with literal dots, e.g.
+// 1.4.x => 1\.4\..*
+func xVersionPattern(xVersion string) string {
+	parts := strings.Split(xVersion, "x")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	return strings.Join(parts, ".*")
+}
@@ -1,6 +1,8 @@
 package abi_test
 
 import (
+	"regexp"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
@@ -31,4 +33,42 @@ var _ = Describe("ABI Version Registry", func() {
 		Expect(err).To(HaveOccurred())
 		Expect(err.Error()).To(ContainSubstring("no versions of istio found which support abi versions"))
 	})
+
+	It("matches a gloo version with the abi versions of its gateway-proxy", func() {
+		err := DefaultRegistry.ValidateGlooVersion([]string{Version_edc016b1fa5adca3ebd3d7020eaed0ad7b8814ca.Name}, "1.5.3")
+		Expect(err).NotTo(HaveOccurred())
+		err = DefaultRegistry.ValidateGlooVersion([]string{Version_0_2_1.Name}, "v1.6.0")
+		Expect(err).NotTo(HaveOccurred())
+		err = DefaultRegistry.ValidateGlooVersion([]string{Version_0_2_1.Name}, "1.7.1")
+		Expect(err).NotTo(HaveOccurred())
+
+		err = DefaultRegistry.ValidateGlooVersion([]string{Version_0_2_1.Name}, "1.5.3")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("no versions of gloo found which support abi versions [v0.2.1]"))
+		// the istio abi versions are not supported by gloo
+		err = DefaultRegistry.ValidateGlooVersion([]string{Version_4689a30309abf31aee9ae36e73d34b1bb182685f.Name}, "1.7.1")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("builds a proxy version regex matching the istio versions supporting the abi versions", func() {
+		abiVersions := []string{
+			Version_097b7f2e4cc1fb490cc1943d0d633655ac3c522f.Name,
+			Version_4689a30309abf31aee9ae36e73d34b1bb182685f.Name,
+		}
+		regex := DefaultRegistry.IstioProxyVersionRegex(abiVersions)
+		Expect(regex).To(Equal(`^(1\.5\..*|1\.6\..*|1\.7\..*|1\.8\..*)$`))
+
+		rxp, err := regexp.Compile(regex)
+		Expect(err).NotTo(HaveOccurred())
+		for _, version := range []string{"1.5.0", "1.6.8", "1.7.3", "1.8.0-distroless"} {
+			Expect(rxp.MatchString(version)).To(BeTrue(), version)
+		}
+		for _, version := range []string{"1.4.6", "1.9.0", "11.7.0", "1.17.0", "1x7x0"} {
+			Expect(rxp.MatchString(version)).To(BeFalse(), version)
+		}
+
+		// gloo-only and unknown abi versions match no istio proxies
+		Expect(DefaultRegistry.IstioProxyVersionRegex([]string{Version_edc016b1fa5adca3ebd3d7020eaed0ad7b8814ca.Name})).To(BeEmpty())
+		Expect(DefaultRegistry.IstioProxyVersionRegex([]string{"invalid_abiversion"})).To(BeEmpty())
+	})
 })
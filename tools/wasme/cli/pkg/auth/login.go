@@ -1,44 +1,219 @@
 package auth
 
 import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
+	"strings"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 
 	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/cli/cli/config/credentials"
 	"github.com/docker/cli/cli/config/types"
+	"github.com/docker/distribution/registry/client/auth/challenge"
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/defaults"
 	"github.com/solo-io/wasm/tools/wasme/pkg/consts"
 )
 
-func SaveCredentials(username, password, serverAddress, path string) error {
-	if serverAddress == "" {
-		serverAddress = consts.HubDomain
+const (
+	// the key of the credentials of docker hub in docker configs
+	dockerHubServerAddress = "https://index.docker.io/v1/"
+	dockerHubRegistryHost  = "registry-1.docker.io"
+
+	// identifies wasme to the token servers of registries
+	tokenClientId = "wasme"
+)
+
+// ServerAddress returns the key of the credentials of the registry in docker configs:
+// the host of the registry, without a scheme or path
+func ServerAddress(registry string) string {
+	if registry == "" {
+		registry = consts.HubDomain
 	}
-	if path == "" {
-		path = defaults.WasmeCredentialsFile
+	host := registry
+	if u, err := url.Parse(registry); err == nil && u.Host != "" {
+		host = u.Host
 	}
-	cfg := configfile.New(path)
+	host = strings.SplitN(host, "/", 2)[0]
+	switch host {
+	case "docker.io", "index.docker.io", dockerHubRegistryHost:
+		return dockerHubServerAddress
+	}
+	return host
+}
 
-	cfg.AuthConfigs[serverAddress] = types.AuthConfig{
-		Username: username,
-		Password: password,
+// returns the host serving the /v2/ endpoint of the registry with the server address
+func registryHost(serverAddress string) string {
+	if serverAddress == dockerHubServerAddress {
+		return dockerHubRegistryHost
 	}
+	return serverAddress
+}
 
-	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-		return err
+// Login validates the credentials against the /v2/ endpoint of the registry, and returns the credentials to store.
+// registries which use token auth may issue an identity token for the credentials, which is stored instead of the password
+func Login(ctx context.Context, client *http.Client, serverAddress, username, password string, plainHTTP bool) (types.AuthConfig, error) {
+	authConfig := types.AuthConfig{
+		Username:      username,
+		Password:      password,
+		ServerAddress: serverAddress,
 	}
+	scheme := "https"
+	if plainHTTP {
+		scheme = "http"
+	}
+	endpoint := scheme + "://" + registryHost(serverAddress) + "/v2/"
 
-	credsFile, err := os.Create(path)
+	res, err := get(ctx, client, endpoint, "", "")
 	if err != nil {
-		return errors.Wrap(err, "creating file")
+		return authConfig, errors.Wrapf(err, "pinging registry %v", serverAddress)
+	}
+	res.Body.Close()
+	if res.StatusCode == http.StatusOK {
+		logrus.Warnf("registry %v does not require authentication", serverAddress)
+		return authConfig, nil
 	}
-	defer credsFile.Close()
 
-	if err := cfg.SaveToWriter(credsFile); err != nil {
-		return err
+	for _, c := range challenge.ResponseChallenges(res) {
+		switch strings.ToLower(c.Scheme) {
+		case "basic":
+			res, err := get(ctx, client, endpoint, username, password)
+			if err != nil {
+				return authConfig, errors.Wrapf(err, "logging in to %v", serverAddress)
+			}
+			res.Body.Close()
+			if res.StatusCode != http.StatusOK {
+				return authConfig, errors.Errorf("logging in to %v: %v", serverAddress, res.Status)
+			}
+			return authConfig, nil
+		case "bearer":
+			identityToken, err := fetchIdentityToken(ctx, client, c.Parameters, username, password)
+			if err != nil {
+				return authConfig, errors.Wrapf(err, "logging in to %v", serverAddress)
+			}
+			if identityToken != "" {
+				authConfig.Password = ""
+				authConfig.IdentityToken = identityToken
+			}
+			return authConfig, nil
+		}
+	}
+	return authConfig, errors.Errorf("pinging registry %v: %v", serverAddress, res.Status)
+}
+
+// requests a token from the token server in the bearer challenge of the registry with the credentials,
+// and returns the refresh token of the response, or "" if the token server issues none
+func fetchIdentityToken(ctx context.Context, client *http.Client, params map[string]string, username, password string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Host == "" {
+		return "", errors.Errorf("invalid token realm %q", params["realm"])
+	}
+	query := realm.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	query.Set("client_id", tokenClientId)
+	query.Set("offline_token", "true")
+	realm.RawQuery = query.Encode()
+
+	res, err := get(ctx, client, realm.String(), username, password)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", errors.Errorf("token server returned %v", res.Status)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	var token struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", errors.Wrap(err, "parsing token response")
+	}
+	return token.RefreshToken, nil
+}
+
+func get(ctx context.Context, client *http.Client, endpoint, username, password string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if username != "" || password != "" {
+		req.SetBasicAuth(username, password)
 	}
+	return client.Do(req.WithContext(ctx))
+}
 
+// SaveCredentials stores the credentials of the server in the docker config at path, or the credential helper
+// of the server if the config has one. the config is created with 0600 permissions if it does not exist
+func SaveCredentials(authConfig types.AuthConfig, path string) error {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+	if err := cfg.GetCredentialsStore(authConfig.ServerAddress).Store(authConfig); err != nil {
+		return errors.Wrapf(err, "storing credentials in %v", path)
+	}
 	return nil
 }
+
+// RemoveCredentials removes the credentials of the server from the docker config at path, or the credential helper
+// of the server if the config has one, and returns false if the config has no credentials for the server
+func RemoveCredentials(serverAddress, path string) (bool, error) {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return false, err
+	}
+	// the credentials may be stored with a scheme, e.g. by docker login https://registry.example.com
+	keys := []string{serverAddress}
+	for key := range cfg.AuthConfigs {
+		if key != serverAddress && credentials.ConvertToHostname(key) == serverAddress {
+			keys = append(keys, key)
+		}
+	}
+
+	store := cfg.GetCredentialsStore(serverAddress)
+	var removed bool
+	for _, key := range keys {
+		authConfig, err := store.Get(key)
+		if err != nil {
+			return removed, errors.Wrapf(err, "reading credentials from %v", path)
+		}
+		if authConfig.Username == "" && authConfig.Password == "" && authConfig.IdentityToken == "" {
+			continue
+		}
+		if err := store.Erase(key); err != nil {
+			return removed, errors.Wrapf(err, "removing credentials from %v", path)
+		}
+		removed = true
+	}
+	return removed, nil
+}
+
+func loadConfig(path string) (*configfile.ConfigFile, error) {
+	if path == "" {
+		path = defaults.WasmeCredentialsFile
+	}
+	cfg := configfile.New(path)
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if err := cfg.LoadFromReader(file); err != nil {
+		return nil, errors.Wrapf(err, "reading %v", path)
+	}
+	return cfg, nil
+}
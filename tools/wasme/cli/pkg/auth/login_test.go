@@ -0,0 +1,148 @@
+package auth_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/cli/cli/config/types"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/auth"
+)
+
+var _ = Describe("Login", func() {
+	const (
+		username = "user"
+		password = "secret"
+	)
+
+	var (
+		registry *httptest.Server
+		// the WWW-Authenticate header returned by the registry for requests without a valid token
+		challenge     string
+		serverAddress string
+	)
+
+	validCredentials := func(r *http.Request) bool {
+		user, pass, ok := r.BasicAuth()
+		return ok && user == username && pass == password
+	}
+
+	BeforeEach(func() {
+		registry = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/token":
+				Expect(r.URL.Query().Get("service")).To(Equal("test-registry"))
+				Expect(r.URL.Query().Get("offline_token")).To(Equal("true"))
+				if !validCredentials(r) {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				fmt.Fprint(w, `{"token":"access","refresh_token":"identity"}`)
+			case "/v2/":
+				if strings.HasPrefix(challenge, "Basic") && validCredentials(r) {
+					return
+				}
+				w.Header().Set("WWW-Authenticate", challenge)
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}))
+		registryUrl, err := url.Parse(registry.URL)
+		Expect(err).NotTo(HaveOccurred())
+		serverAddress = registryUrl.Host
+	})
+
+	AfterEach(func() {
+		registry.Close()
+	})
+
+	login := func(password string) (types.AuthConfig, error) {
+		return auth.Login(context.TODO(), http.DefaultClient, serverAddress, username, password, true)
+	}
+
+	It("validates the credentials with basic auth", func() {
+		challenge = `Basic realm="test"`
+		authConfig, err := login(password)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(authConfig).To(Equal(types.AuthConfig{Username: username, Password: password, ServerAddress: serverAddress}))
+
+		_, err = login("wrong")
+		Expect(err).To(MatchError(ContainSubstring("401")))
+	})
+
+	It("stores the identity token issued by the token server instead of the password", func() {
+		challenge = fmt.Sprintf(`Bearer realm="%v/token",service="test-registry"`, registry.URL)
+		authConfig, err := login(password)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(authConfig).To(Equal(types.AuthConfig{Username: username, IdentityToken: "identity", ServerAddress: serverAddress}))
+
+		_, err = login("wrong")
+		Expect(err).To(MatchError(ContainSubstring("401")))
+	})
+
+	It("returns the server address of the registry", func() {
+		Expect(auth.ServerAddress("https://registry.example.com/v2/")).To(Equal("registry.example.com"))
+		Expect(auth.ServerAddress("registry.example.com:5000")).To(Equal("registry.example.com:5000"))
+		Expect(auth.ServerAddress("docker.io")).To(Equal("https://index.docker.io/v1/"))
+	})
+})
+
+var _ = Describe("Credentials", func() {
+	var (
+		directory  string
+		configPath string
+	)
+
+	BeforeEach(func() {
+		var err error
+		directory, err = ioutil.TempDir("", "credentials")
+		Expect(err).NotTo(HaveOccurred())
+		configPath = filepath.Join(directory, "config.json")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(directory)
+	})
+
+	It("saves and removes the credentials of a server", func() {
+		authConfig := types.AuthConfig{Username: "user", Password: "secret", ServerAddress: "registry.example.com"}
+		Expect(auth.SaveCredentials(authConfig, configPath)).To(Succeed())
+		other := types.AuthConfig{Username: "other", IdentityToken: "token", ServerAddress: "other.example.com"}
+		Expect(auth.SaveCredentials(other, configPath)).To(Succeed())
+
+		info, err := os.Stat(configPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+		removed, err := auth.RemoveCredentials("registry.example.com", configPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removed).To(BeTrue())
+		removed, err = auth.RemoveCredentials("registry.example.com", configPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removed).To(BeFalse())
+
+		contents, err := ioutil.ReadFile(configPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).NotTo(ContainSubstring("registry.example.com"))
+		Expect(string(contents)).To(ContainSubstring("other.example.com"))
+	})
+
+	It("removes the credentials stored with a scheme", func() {
+		config := `{"auths":{"https://registry.example.com":{"auth":"dXNlcjpzZWNyZXQ="}}}`
+		Expect(ioutil.WriteFile(configPath, []byte(config), 0600)).To(Succeed())
+
+		removed, err := auth.RemoveCredentials("registry.example.com", configPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removed).To(BeTrue())
+		contents, err := ioutil.ReadFile(configPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).NotTo(ContainSubstring("registry.example.com"))
+	})
+})
@@ -1,6 +1,8 @@
 package cache
 
 import (
+	"strconv"
+
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/solo-io/go-utils/kubeerrutils"
@@ -10,7 +12,6 @@ import (
 	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -41,6 +42,15 @@ var (
 	}
 )
 
+// the registry credentials secret is mounted into the cache pods at this path
+const RegistrySecretMountPath = "/etc/wasme-registry"
+
+// the port the cache serves images on, including the cached modules by digest
+const ServerPort = 9979
+
+// set to the name of the node the cache pod runs on, which is published with the events of the cache
+const NodeHostnameEnv = "NODE_HOSTNAME"
+
 type deployer struct {
 	kube       kubernetes.Interface
 	namespace  string
@@ -48,10 +58,16 @@ type deployer struct {
 	image      string
 	pullPolicy v1.PullPolicy
 	args       []string
-	logger     *logrus.Entry
+	// the name of a kubernetes.io/dockerconfigjson secret with the registry credentials
+	registrySecret string
+	// the name of the PersistentVolumeClaim storing the cache directory, instead of the host
+	persistentVolumeClaim string
+	logger                *logrus.Entry
 }
 
-func NewDeployer(kube kubernetes.Interface, namespace, name string, imageRepo, imageTag string, args []string, pullPolicy v1.PullPolicy) *deployer {
+// if registrySecret is set, the cache pulls images with the credentials in the kubernetes.io/dockerconfigjson secret.
+// if persistentVolumeClaim is set, the cache directory is stored on the claim rather than on each host
+func NewDeployer(kube kubernetes.Interface, namespace, name string, imageRepo, imageTag string, args []string, pullPolicy v1.PullPolicy, registrySecret, persistentVolumeClaim string) *deployer {
 	if namespace == "" {
 		namespace = CacheNamespace
 	}
@@ -69,12 +85,14 @@ func NewDeployer(kube kubernetes.Interface, namespace, name string, imageRepo, i
 	}
 	image := imageRepo + ":" + imageTag
 	return &deployer{
-		kube:       kube,
-		namespace:  namespace,
-		name:       name,
-		image:      image,
-		args:       args,
-		pullPolicy: pullPolicy,
+		kube:                  kube,
+		namespace:             namespace,
+		name:                  name,
+		image:                 image,
+		args:                  args,
+		pullPolicy:            pullPolicy,
+		registrySecret:        registrySecret,
+		persistentVolumeClaim: persistentVolumeClaim,
 		logger: logrus.WithFields(logrus.Fields{
 			"cache": name + "." + namespace,
 			"image": image,
@@ -107,6 +125,10 @@ func (d *deployer) EnsureCache() error {
 	if err := d.createOrUpdateDaemonSet(); err != nil {
 		return errors.Wrap(err, "ensuring daemonset")
 	}
+
+	if err := d.createOrUpdateService(); err != nil {
+		return errors.Wrap(err, "ensuring service")
+	}
 	return nil
 }
 
@@ -231,6 +253,12 @@ func (d *deployer) createOrUpdateDaemonSet() error {
 	}
 
 	desiredDaemonSet := MakeDaemonSet(d.name, d.namespace, d.image, labels, d.args, d.pullPolicy)
+	if d.registrySecret != "" {
+		AddRegistrySecret(desiredDaemonSet, d.registrySecret)
+	}
+	if d.persistentVolumeClaim != "" {
+		UsePersistentVolumeClaim(desiredDaemonSet, d.persistentVolumeClaim)
+	}
 
 	_, err := d.kube.AppsV1().DaemonSets(d.namespace).Create(desiredDaemonSet)
 	// update on already exists err
@@ -261,6 +289,60 @@ func (d *deployer) createOrUpdateDaemonSet() error {
 	return nil
 }
 
+func (d *deployer) createOrUpdateService() error {
+	desiredService := MakeService(d.name, d.namespace, map[string]string{
+		"app": d.name,
+	})
+
+	_, err := d.kube.CoreV1().Services(d.namespace).Create(desiredService)
+	// update on already exists err
+	if err != nil {
+		if !kubeerrutils.IsAlreadyExists(err) {
+			return err
+		}
+		existing, err := d.kube.CoreV1().Services(d.namespace).Get(desiredService.Name, metav1.GetOptions{})
+		if err != nil {
+			return errors.Wrap(err, "failed to get existing cache service")
+		}
+
+		// keep the cluster ip assigned to the service
+		existing.Spec.Selector = desiredService.Spec.Selector
+		existing.Spec.Ports = desiredService.Spec.Ports
+
+		_, err = d.kube.CoreV1().Services(d.namespace).Update(existing)
+		if err != nil {
+			return err
+		}
+
+		d.logger.Info("cache service updated")
+
+		return nil
+	}
+
+	d.logger.Info("cache service created")
+
+	return nil
+}
+
+// MakeService returns the service in front of the cache pods, used by proxies to fetch the cached modules
+func MakeService(name, namespace string, labels map[string]string) *v1.Service {
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: v1.ServiceSpec{
+			Selector: labels,
+			Ports: []v1.ServicePort{{
+				// the name marks the port as http for Istio
+				Name: "http",
+				Port: ServerPort,
+			}},
+		},
+	}
+}
+
 func MakeServiceAccount(name, namespace string) *v1.ServiceAccount {
 	return &v1.ServiceAccount{
 		ObjectMeta: metav1.ObjectMeta{
@@ -316,6 +398,12 @@ func MakeDaemonSet(name, namespace, image string, labels map[string]string, args
 			Template: v1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: labels,
+					// matches the annotations of the cache pods installed by the operator chart
+					Annotations: map[string]string{
+						"prometheus.io/path":   "/metrics",
+						"prometheus.io/port":   strconv.Itoa(MetricsPort),
+						"prometheus.io/scrape": "true",
+					},
 				},
 				Spec: v1.PodSpec{
 					ServiceAccountName: name,
@@ -351,6 +439,22 @@ func MakeDaemonSet(name, namespace, image string, labels map[string]string, args
 						Image:           image,
 						ImagePullPolicy: pullPolicy,
 						Args:            args,
+						Env: []v1.EnvVar{{
+							Name: NodeHostnameEnv,
+							ValueFrom: &v1.EnvVarSource{
+								FieldRef: &v1.ObjectFieldSelector{FieldPath: "spec.nodeName"},
+							},
+						}},
+						Ports: []v1.ContainerPort{
+							{
+								Name:          "http",
+								ContainerPort: ServerPort,
+							},
+							{
+								Name:          "metrics",
+								ContainerPort: MetricsPort,
+							},
+						},
 						VolumeMounts: []v1.VolumeMount{
 							{
 								MountPath: "/var/local/lib/wasme-cache",
@@ -378,14 +482,48 @@ func MakeDaemonSet(name, namespace, image string, labels map[string]string, args
 	}
 }
 
-// get the cache events for an image.
-// used by tests and the istio deployer, not by this package
-func GetImageEvents(kube kubernetes.Interface, eventNamespace, image string) ([]v1.Event, error) {
-	imageEvents, err := kube.CoreV1().Events(eventNamespace).List(metav1.ListOptions{
-		LabelSelector: labels.SelectorFromSet(EventLabels(image)).String(),
+// AddRegistrySecret mounts the kubernetes.io/dockerconfigjson secret into the cache pods,
+// and points the cache at it to pull images from private registries.
+// the secret is optional, so the cache pulls anonymously until it is created
+func AddRegistrySecret(daemonSet *appsv1.DaemonSet, secretName string) {
+	optional := true
+	podSpec := &daemonSet.Spec.Template.Spec
+	podSpec.Volumes = append(podSpec.Volumes, v1.Volume{
+		Name: "registry-credentials",
+		VolumeSource: v1.VolumeSource{
+			Secret: &v1.SecretVolumeSource{
+				SecretName: secretName,
+				Items: []v1.KeyToPath{
+					{
+						Key:  v1.DockerConfigJsonKey,
+						Path: v1.DockerConfigJsonKey,
+					},
+				},
+				Optional: &optional,
+			},
+		},
 	})
-	if err != nil {
-		return nil, err
+	container := &podSpec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts, v1.VolumeMount{
+		MountPath: RegistrySecretMountPath,
+		Name:      "registry-credentials",
+		ReadOnly:  true,
+	})
+	container.Args = append(container.Args, "--docker-config-path", RegistrySecretMountPath+"/"+v1.DockerConfigJsonKey)
+}
+
+// UsePersistentVolumeClaim stores the cache directory of the cache pods on the PersistentVolumeClaim
+// in the cache namespace, instead of a hostPath volume.
+// the claim must be ReadWriteMany, as it is mounted by the cache pod on every node
+func UsePersistentVolumeClaim(daemonSet *appsv1.DaemonSet, claimName string) {
+	volumes := daemonSet.Spec.Template.Spec.Volumes
+	for i := range volumes {
+		if volumes[i].Name == "cache-dir" {
+			volumes[i].VolumeSource = v1.VolumeSource{
+				PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{
+					ClaimName: claimName,
+				},
+			}
+		}
 	}
-	return imageEvents.Items, nil
 }
@@ -71,7 +71,7 @@ var _ = Describe("Deploy", func() {
 	})
 	It("creates the cache namespace, configmap, and daemonset", func() {
 
-		deployer := NewDeployer(kube, cacheNamespace, "", operatorImage, cacheNamespace, nil, corev1.PullAlways)
+		deployer := NewDeployer(kube, cacheNamespace, "", operatorImage, cacheNamespace, nil, corev1.PullAlways, "", "")
 
 		err := deployer.EnsureCache()
 		Expect(err).NotTo(HaveOccurred())
@@ -82,8 +82,15 @@ var _ = Describe("Deploy", func() {
 		cm, err := kube.CoreV1().ConfigMaps(cacheNamespace).Get(CacheName, v1.GetOptions{})
 		Expect(err).NotTo(HaveOccurred())
 
-		_, err = kube.AppsV1().DaemonSets(cacheNamespace).Get(CacheName, v1.GetOptions{})
+		ds, err := kube.AppsV1().DaemonSets(cacheNamespace).Get(CacheName, v1.GetOptions{})
 		Expect(err).NotTo(HaveOccurred())
+		Expect(ds.Spec.Template.Spec.Containers[0].Ports).To(ContainElement(corev1.ContainerPort{Name: "metrics", ContainerPort: MetricsPort}))
+		Expect(ds.Spec.Template.Annotations).To(HaveKeyWithValue("prometheus.io/port", "9091"))
+
+		svc, err := kube.CoreV1().Services(cacheNamespace).Get(CacheName, v1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(svc.Spec.Selector).To(Equal(ds.Spec.Template.Labels))
+		Expect(svc.Spec.Ports).To(ConsistOf(corev1.ServicePort{Name: "http", Port: ServerPort}))
 
 		if !useRealKube {
 			return
@@ -116,4 +123,53 @@ var _ = Describe("Deploy", func() {
 
 		Expect(events[0].Reason).To(Equal(Reason_ImageAdded))
 	})
+
+	It("mounts the registry secret into the cache pods", func() {
+		deployer := NewDeployer(kube, cacheNamespace, "", operatorImage, cacheNamespace, nil, corev1.PullAlways, "registry-creds", "")
+
+		err := deployer.EnsureCache()
+		Expect(err).NotTo(HaveOccurred())
+
+		cacheDaemonSet, err := kube.AppsV1().DaemonSets(cacheNamespace).Get(CacheName, v1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		podSpec := cacheDaemonSet.Spec.Template.Spec
+		optional := true
+		Expect(podSpec.Volumes).To(ContainElement(corev1.Volume{
+			Name: "registry-credentials",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: "registry-creds",
+					Items:      []corev1.KeyToPath{{Key: ".dockerconfigjson", Path: ".dockerconfigjson"}},
+					Optional:   &optional,
+				},
+			},
+		}))
+		container := podSpec.Containers[0]
+		Expect(container.VolumeMounts).To(ContainElement(corev1.VolumeMount{
+			Name:      "registry-credentials",
+			MountPath: "/etc/wasme-registry",
+			ReadOnly:  true,
+		}))
+		Expect(container.Args).To(ContainElements("--docker-config-path", "/etc/wasme-registry/.dockerconfigjson"))
+	})
+
+	It("stores the cache directory on the PersistentVolumeClaim", func() {
+		deployer := NewDeployer(kube, cacheNamespace, "", operatorImage, cacheNamespace, nil, corev1.PullAlways, "", "wasme-cache")
+
+		err := deployer.EnsureCache()
+		Expect(err).NotTo(HaveOccurred())
+
+		cacheDaemonSet, err := kube.AppsV1().DaemonSets(cacheNamespace).Get(CacheName, v1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cacheDaemonSet.Spec.Template.Spec.Volumes).To(ContainElement(corev1.Volume{
+			Name: "cache-dir",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "wasme-cache"},
+			},
+		}))
+		Expect(cacheDaemonSet.Spec.Template.Spec.Containers[0].VolumeMounts).To(ContainElement(corev1.VolumeMount{
+			Name:      "cache-dir",
+			MountPath: "/var/local/lib/wasme-cache",
+		}))
+	})
 })
@@ -0,0 +1,221 @@
+package cache
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	pkgcache "github.com/solo-io/wasm/tools/wasme/pkg/cache"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ImageEventQuery selects the events published by the cache for an image
+type ImageEventQuery struct {
+	// the ref the image was pulled by
+	Image string
+	// the digest the image resolved to, matching the events of the pulls of any ref of the image.
+	// the events of failed pulls only match if the image was resolved. ignored if Image is set.
+	// if neither Image nor Digest is set, the events of every image match, including removal events
+	Digest string
+	// only return events involving the cache configmap with this name. optional
+	CacheName string
+	// only return events with this reason, e.g. Reason_ImageAdded. optional
+	Reason string
+	// only return events published at or after this time, e.g. to ignore events left by earlier deployments. optional
+	Since time.Time
+	// the number of events requested per page. 0 requests every event at once
+	PageSize int64
+}
+
+// the labels and fields of the events matched by the query, which are selected by the server
+func (q ImageEventQuery) listOptions() metav1.ListOptions {
+	selector := map[string]string{CacheGlobalLabel: "true"}
+	switch {
+	case q.Image != "":
+		selector = EventLabels(q.Image)
+	case q.Digest != "":
+		selector[CacheImageDigestLabel] = digestLabelValue(q.Digest)
+	}
+	fieldSet := fields.Set{"involvedObject.kind": "ConfigMap"}
+	if q.CacheName != "" {
+		fieldSet["involvedObject.name"] = q.CacheName
+	}
+	if q.Reason != "" {
+		fieldSet["reason"] = q.Reason
+	}
+	return metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(selector).String(),
+		FieldSelector: fields.SelectorFromSet(fieldSet).String(),
+		Limit:         q.PageSize,
+	}
+}
+
+// ListImageEvents returns the cache events matched by the query, reading every page.
+// events are selected by the server, except for Since, as events cannot be selected by time
+func ListImageEvents(kube kubernetes.Interface, eventNamespace string, query ImageEventQuery) ([]v1.Event, error) {
+	opts := query.listOptions()
+	var events []v1.Event
+	for {
+		page, err := kube.CoreV1().Events(eventNamespace).List(opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, evt := range page.Items {
+			if !query.Since.IsZero() && EventTime(evt).Before(query.Since) {
+				continue
+			}
+			events = append(events, evt)
+		}
+		if page.Continue == "" {
+			return events, nil
+		}
+		opts.Continue = page.Continue
+	}
+}
+
+// get the cache events for an image.
+// used by tests and the istio deployer, not by this package
+func GetImageEvents(kube kubernetes.Interface, eventNamespace, image string) ([]v1.Event, error) {
+	return ListImageEvents(kube, eventNamespace, ImageEventQuery{Image: image})
+}
+
+// EventTime returns the time the event was last published.
+// the timestamps set by the cache are preferred to the creation timestamp set by the API server
+func EventTime(evt v1.Event) time.Time {
+	switch {
+	case !evt.LastTimestamp.IsZero():
+		return evt.LastTimestamp.Time
+	case !evt.FirstTimestamp.IsZero():
+		return evt.FirstTimestamp.Time
+	}
+	return evt.CreationTimestamp.Time
+}
+
+// PullReport is published by the cache with each ImageAdded and ImageError event,
+// describing the attempt of a cache instance to pull an image
+type PullReport struct {
+	// the node of the cache instance
+	Node  string `json:"node,omitempty"`
+	Image string `json:"image"`
+	// empty if the image could not be resolved
+	Digest       string          `json:"digest,omitempty"`
+	Duration     metav1.Duration `json:"duration"`
+	BytesWritten int64           `json:"bytesWritten"`
+	// empty if the image was pulled
+	Error string `json:"error,omitempty"`
+}
+
+func newPullReport(node string, result pkgcache.PullResult) PullReport {
+	report := PullReport{
+		Node:         node,
+		Image:        result.Image,
+		Digest:       result.Digest.String(),
+		Duration:     metav1.Duration{Duration: result.Duration},
+		BytesWritten: result.BytesWritten,
+	}
+	if result.Err != nil {
+		report.Error = result.Err.Error()
+	}
+	return report
+}
+
+// ImageEvent is an event published by the cache, with its PullReport
+type ImageEvent struct {
+	v1.Event
+	// nil for removal events, and the events published by older versions of the cache
+	Report *PullReport
+}
+
+// ParseImageEvent reads the PullReport of a cache event
+func ParseImageEvent(evt v1.Event) (ImageEvent, error) {
+	parsed := ImageEvent{Event: evt}
+	data, ok := evt.Annotations[CachePullReportAnnotation]
+	if !ok {
+		return parsed, nil
+	}
+	parsed.Report = &PullReport{}
+	if err := json.Unmarshal([]byte(data), parsed.Report); err != nil {
+		return ImageEvent{}, errors.Wrapf(err, "parsing the pull report of event %v", evt.Name)
+	}
+	return parsed, nil
+}
+
+// Node returns the node of the cache instance which published the event
+func (e ImageEvent) Node() string {
+	if e.Report != nil && e.Report.Node != "" {
+		return e.Report.Node
+	}
+	return e.Source.Host
+}
+
+// Image returns the ref of the image of the event, empty for removal events
+func (e ImageEvent) Image() string {
+	if e.Report != nil {
+		return e.Report.Image
+	}
+	return e.Annotations[CacheImageRefLabel]
+}
+
+// ErrorMessage returns the error of a failed pull, empty if the image was pulled
+func (e ImageEvent) ErrorMessage() string {
+	if e.Reason != Reason_ImageError {
+		return ""
+	}
+	if e.Report != nil && e.Report.Error != "" {
+		return e.Report.Error
+	}
+	return e.Message
+}
+
+// ListParsedImageEvents returns the cache events matched by the query, with their pull reports.
+// events with a malformed report are returned without a report
+func ListParsedImageEvents(kube kubernetes.Interface, eventNamespace string, query ImageEventQuery) ([]ImageEvent, error) {
+	events, err := ListImageEvents(kube, eventNamespace, query)
+	if err != nil {
+		return nil, err
+	}
+	parsed := make([]ImageEvent, 0, len(events))
+	for _, evt := range events {
+		imageEvent, err := ParseImageEvent(evt)
+		if err != nil {
+			logrus.Warnf("ignoring pull report: %v", err)
+			imageEvent = ImageEvent{Event: evt}
+		}
+		parsed = append(parsed, imageEvent)
+	}
+	return parsed, nil
+}
+
+// LatestPullEvents returns the latest event published by each node for each image, sorted by node and image.
+// the events of files removed by garbage collection are ignored, as their image is unknown
+func LatestPullEvents(events []ImageEvent) []ImageEvent {
+	type nodeImage struct{ node, image string }
+	latest := map[nodeImage]ImageEvent{}
+	for _, evt := range events {
+		if evt.Image() == "" {
+			continue
+		}
+		key := nodeImage{node: evt.Node(), image: evt.Image()}
+		if seen, ok := latest[key]; ok && EventTime(evt.Event).Before(EventTime(seen.Event)) {
+			continue
+		}
+		latest[key] = evt
+	}
+	result := make([]ImageEvent, 0, len(latest))
+	for _, evt := range latest {
+		result = append(result, evt)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Node() != result[j].Node() {
+			return result[i].Node() < result[j].Node()
+		}
+		return result[i].Image() < result[j].Image()
+	})
+	return result
+}
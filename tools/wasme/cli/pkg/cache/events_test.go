@@ -0,0 +1,203 @@
+package cache_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	. "github.com/solo-io/wasm/tools/wasme/cli/pkg/cache"
+	pkgcache "github.com/solo-io/wasm/tools/wasme/pkg/cache"
+	"github.com/solo-io/wasm/tools/wasme/pkg/consts/test"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+var _ = Describe("Image events", func() {
+	var (
+		image       = test.IstioAssemblyScriptImage
+		imageDigest = digest.FromString("filter")
+	)
+
+	It("labels the events of resolved images with the digest", func() {
+		kube := fake.NewSimpleClientset()
+		notifier := NewNotifier(kube, "wasme", CacheName)
+		Expect(notifier.Notify(pkgcache.PullResult{Image: image, Digest: imageDigest})).To(Succeed())
+
+		events, err := ListImageEvents(kube, "wasme", ImageEventQuery{Digest: imageDigest.String()})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Reason).To(Equal(Reason_ImageAdded))
+
+		events, err = ListImageEvents(kube, "wasme", ImageEventQuery{Digest: digest.FromString("other").String()})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(BeEmpty())
+	})
+
+	It("publishes a pull report with each image event", func() {
+		os.Setenv("NODE_HOSTNAME", "node-a")
+		defer os.Unsetenv("NODE_HOSTNAME")
+		// the fake clientset does not generate names, so each event is published to its own clientset
+		publish := func(result pkgcache.PullResult) (ImageEvent, error) {
+			kube := fake.NewSimpleClientset()
+			notifyErr := NewNotifier(kube, "wasme", CacheName).Notify(result)
+			events, err := ListParsedImageEvents(kube, "wasme", ImageEventQuery{Image: image})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(events).To(HaveLen(1))
+			Expect(events[0].Node()).To(Equal("node-a"))
+			Expect(events[0].Image()).To(Equal(image))
+			return events[0], notifyErr
+		}
+
+		added, err := publish(pkgcache.PullResult{
+			Image:        image,
+			Digest:       imageDigest,
+			Duration:     3 * time.Second,
+			BytesWritten: 1024,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(added.ErrorMessage()).To(BeEmpty())
+		Expect(added.Report).To(Equal(&PullReport{
+			Node:         "node-a",
+			Image:        image,
+			Digest:       imageDigest.String(),
+			Duration:     metav1.Duration{Duration: 3 * time.Second},
+			BytesWritten: 1024,
+		}))
+
+		pullErr := &pkgcache.RetryError{Err: errors.New("registry unavailable"), RetryIn: time.Second}
+		failed, err := publish(pkgcache.PullResult{Image: image, Duration: time.Second, Err: pullErr})
+		Expect(err).To(Equal(pullErr))
+		Expect(failed.ErrorMessage()).To(Equal("registry unavailable"))
+		Expect(failed.Report).To(Equal(&PullReport{
+			Node:     "node-a",
+			Image:    image,
+			Duration: metav1.Duration{Duration: time.Second},
+			Error:    "registry unavailable",
+		}))
+	})
+
+	It("parses the events published by older caches, without a pull report", func() {
+		evt, err := ParseImageEvent(corev1.Event{
+			ObjectMeta: metav1.ObjectMeta{Annotations: EventAnnotations(image)},
+			Reason:     Reason_ImageError,
+			Message:    "registry unavailable",
+			Source:     corev1.EventSource{Host: "node-a"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(evt.Report).To(BeNil())
+		Expect(evt.Node()).To(Equal("node-a"))
+		Expect(evt.Image()).To(Equal(image))
+		Expect(evt.ErrorMessage()).To(Equal("registry unavailable"))
+
+		_, err = ParseImageEvent(corev1.Event{
+			ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{CachePullReportAnnotation: "{"}},
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("returns the latest pull event of each node for each image", func() {
+		event := func(name, node, reason string, published time.Time) ImageEvent {
+			return ImageEvent{Event: corev1.Event{
+				ObjectMeta:    metav1.ObjectMeta{Name: name, Annotations: EventAnnotations(image)},
+				Reason:        reason,
+				Source:        corev1.EventSource{Host: node},
+				LastTimestamp: metav1.NewTime(published),
+			}}
+		}
+		now := time.Now()
+		removed := event("removed", "node-a", Reason_ImageRemoved, now)
+		removed.Annotations = nil
+
+		latest := LatestPullEvents([]ImageEvent{
+			event("b-added", "node-b", Reason_ImageAdded, now),
+			event("a-added", "node-a", Reason_ImageAdded, now.Add(-time.Minute)),
+			event("a-failed", "node-a", Reason_ImageError, now),
+			event("b-failed", "node-b", Reason_ImageError, now.Add(-time.Minute)),
+			removed,
+		})
+		var names []string
+		for _, evt := range latest {
+			names = append(names, evt.Name)
+		}
+		Expect(names).To(Equal([]string{"a-failed", "b-added"}))
+	})
+
+	It("only returns the events published since the given time", func() {
+		kube := fake.NewSimpleClientset()
+		for name, published := range map[string]time.Time{
+			"stale": time.Now().Add(-time.Hour),
+			"fresh": time.Now(),
+		} {
+			_, err := kube.CoreV1().Events("wasme").Create(&corev1.Event{
+				ObjectMeta:    metav1.ObjectMeta{Name: name, Namespace: "wasme", Labels: EventLabels(image)},
+				LastTimestamp: metav1.NewTime(published),
+			})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		events, err := ListImageEvents(kube, "wasme", ImageEventQuery{Image: image, Since: time.Now().Add(-time.Minute)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Name).To(Equal("fresh"))
+	})
+
+	It("selects the events on the server and reads every page", func() {
+		var (
+			lock     sync.Mutex
+			requests []url.Values
+		)
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.URL.Path).To(Equal("/api/v1/namespaces/wasme/events"))
+			lock.Lock()
+			requests = append(requests, r.URL.Query())
+			lock.Unlock()
+
+			list := corev1.EventList{}
+			if r.URL.Query().Get("continue") == "" {
+				list.Items = []corev1.Event{{ObjectMeta: metav1.ObjectMeta{Name: "first"}}}
+				list.Continue = "page-2"
+			} else {
+				list.Items = []corev1.Event{{ObjectMeta: metav1.ObjectMeta{Name: "second"}}}
+			}
+			rw.Header().Set("Content-Type", "application/json")
+			Expect(json.NewEncoder(rw).Encode(list)).To(Succeed())
+		}))
+		defer server.Close()
+		kube, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+		Expect(err).NotTo(HaveOccurred())
+
+		events, err := ListImageEvents(kube, "wasme", ImageEventQuery{
+			Image:     image,
+			CacheName: CacheName,
+			Reason:    Reason_ImageAdded,
+			PageSize:  1,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(2))
+		Expect(events[0].Name).To(Equal("first"))
+		Expect(events[1].Name).To(Equal("second"))
+
+		Expect(requests).To(HaveLen(2))
+		Expect(requests[0].Get("limit")).To(Equal("1"))
+		Expect(requests[0].Get("labelSelector")).To(ContainSubstring(CacheImageRefLabel + "="))
+		Expect(strings.Split(requests[0].Get("fieldSelector"), ",")).To(ConsistOf(
+			"involvedObject.kind=ConfigMap",
+			"involvedObject.name="+CacheName,
+			"reason="+Reason_ImageAdded,
+		))
+		Expect(requests[1].Get("continue")).To(Equal("page-2"))
+	})
+})
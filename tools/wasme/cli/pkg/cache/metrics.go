@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/reference"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
+)
+
+const (
+	metricsNamespace = "wasme"
+	metricsSubsystem = "cache"
+
+	// the port the cache server serves its metrics on, matching the scrape annotations of the cache pods
+	MetricsPort = 9091
+
+	pullOutcomeSuccess = "success"
+	pullOutcomeError   = "error"
+)
+
+// Metrics instruments the cache server with prometheus metrics
+type Metrics struct {
+	images       prometheus.Gauge
+	pulls        *prometheus.CounterVec
+	pullDuration prometheus.Histogram
+
+	// the digests of the images pulled by the cache
+	digests     map[string]bool
+	digestsLock sync.Mutex
+}
+
+// NewMetrics registers the metrics of the cache server with the registerer.
+// the size of the cache directory is measured on each scrape, if set
+func NewMetrics(registerer prometheus.Registerer, directory string) (*Metrics, error) {
+	m := &Metrics{
+		images: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "images",
+			Help:      "The number of images held by the cache.",
+		}),
+		pulls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "image_pulls_total",
+			Help:      "The number of images pulled by the cache, by registry host and outcome.",
+		}, []string{"registry", "outcome"}),
+		pullDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "image_pull_duration_seconds",
+			Help:      "The time taken to pull an image, including failed pulls.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		digests: map[string]bool{},
+	}
+	collectors := []prometheus.Collector{
+		m.images,
+		m.pulls,
+		m.pullDuration,
+	}
+	if directory != "" {
+		collectors = append(collectors, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "directory_bytes",
+			Help:      "The size of the files in the cache directory.",
+		}, func() float64 {
+			return float64(directorySize(directory))
+		}))
+	}
+
+	for _, collector := range collectors {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (m *Metrics) observePull(ref string, image pull.Image, err error, start time.Time) {
+	m.pullDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.pulls.WithLabelValues(registryHost(ref), pullOutcomeError).Inc()
+		return
+	}
+	m.pulls.WithLabelValues(registryHost(ref), pullOutcomeSuccess).Inc()
+
+	desc, err := image.Descriptor()
+	if err != nil {
+		return
+	}
+	m.digestsLock.Lock()
+	defer m.digestsLock.Unlock()
+	m.digests[desc.Digest.String()] = true
+	m.images.Set(float64(len(m.digests)))
+}
+
+// returns the host of the registry the image is pulled from
+func registryHost(ref string) string {
+	spec, err := reference.Parse(ref)
+	if err != nil {
+		return "unknown"
+	}
+	return spec.Hostname()
+}
+
+// returns the total size of the regular files in the directory
+func directorySize(directory string) int64 {
+	var size int64
+	err := filepath.Walk(directory, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		logrus.Warnf("measuring the size of cache directory %v failed: %v", directory, err)
+	}
+	return size
+}
+
+// NewInstrumentedPuller records the images pulled by the puller in the metrics.
+// the cache only calls the puller for images it does not hold yet
+func NewInstrumentedPuller(puller pull.ImagePuller, metrics *Metrics) pull.ImagePuller {
+	return &instrumentedPuller{puller: puller, metrics: metrics}
+}
+
+type instrumentedPuller struct {
+	puller  pull.ImagePuller
+	metrics *Metrics
+}
+
+func (p *instrumentedPuller) Pull(ctx context.Context, ref string) (pull.Image, error) {
+	start := time.Now()
+	image, err := p.puller.Pull(ctx, ref)
+	p.metrics.observePull(ref, image, err, start)
+	return image, err
+}
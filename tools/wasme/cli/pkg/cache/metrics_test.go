@@ -0,0 +1,108 @@
+package cache_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	. "github.com/solo-io/wasm/tools/wasme/cli/pkg/cache"
+	"github.com/solo-io/wasm/tools/wasme/cli/test/metricsutils"
+	pkgcache "github.com/solo-io/wasm/tools/wasme/pkg/cache"
+	"github.com/solo-io/wasm/tools/wasme/pkg/config"
+	"github.com/solo-io/wasm/tools/wasme/pkg/model"
+	mock_pull "github.com/solo-io/wasm/tools/wasme/pkg/pull/mocks"
+)
+
+type fakeImage struct {
+	ref     string
+	content []byte
+}
+
+func (i *fakeImage) Ref() string {
+	return i.ref
+}
+
+func (i *fakeImage) Descriptor() (ocispec.Descriptor, error) {
+	return ocispec.Descriptor{MediaType: model.ContentMediaType, Digest: digest.FromBytes(i.content)}, nil
+}
+
+func (i *fakeImage) FetchFilter(context.Context) (model.Filter, error) {
+	return bytes.NewReader(i.content), nil
+}
+
+func (i *fakeImage) FetchConfig(context.Context) (*config.Runtime, error) {
+	return nil, nil
+}
+
+var _ = Describe("Metrics", func() {
+	var (
+		registry  *prometheus.Registry
+		directory string
+		cache     pkgcache.Cache
+	)
+
+	BeforeEach(func() {
+		var err error
+		directory, err = ioutil.TempDir("", "wasme-cache")
+		Expect(err).NotTo(HaveOccurred())
+
+		registry = prometheus.NewRegistry()
+		metrics, err := NewMetrics(registry, directory)
+		Expect(err).NotTo(HaveOccurred())
+
+		puller := mock_pull.NewMockImagePuller(gomock.NewController(GinkgoT()))
+		puller.EXPECT().Pull(gomock.Any(), "registry.example.com/filter:v1").Return(&fakeImage{ref: "registry.example.com/filter:v1", content: []byte("filter")}, nil).Times(1)
+		puller.EXPECT().Pull(gomock.Any(), "private.example.com/filter:v1").Return(nil, errors.New("401 Unauthorized")).AnyTimes()
+		cache = pkgcache.NewCache(NewInstrumentedPuller(puller, metrics))
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(directory)
+	})
+
+	// returns the value of the pull counter with the labels
+	pulls := func(registryHost, outcome string) float64 {
+		for _, metric := range metricsutils.Gather(registry, "wasme_cache_image_pulls_total") {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["registry"] == registryHost && labels["outcome"] == outcome {
+				return metric.GetCounter().GetValue()
+			}
+		}
+		return 0
+	}
+
+	It("records the images pulled by the cache", func() {
+		// the second add is served from memory
+		for i := 0; i < 2; i++ {
+			_, err := cache.Add(context.TODO(), "registry.example.com/filter:v1")
+			Expect(err).NotTo(HaveOccurred())
+		}
+		_, err := cache.Add(context.TODO(), "private.example.com/filter:v1")
+		Expect(err).To(HaveOccurred())
+
+		Expect(pulls("registry.example.com", "success")).To(Equal(1.0))
+		Expect(pulls("registry.example.com", "error")).To(Equal(0.0))
+		Expect(pulls("private.example.com", "error")).To(Equal(1.0))
+		Expect(metricsutils.Gather(registry, "wasme_cache_images")[0].GetGauge().GetValue()).To(Equal(1.0))
+		Expect(metricsutils.Gather(registry, "wasme_cache_image_pull_duration_seconds")[0].GetHistogram().GetSampleCount()).To(Equal(uint64(2)))
+	})
+
+	It("measures the size of the cache directory", func() {
+		Expect(metricsutils.Gather(registry, "wasme_cache_directory_bytes")[0].GetGauge().GetValue()).To(Equal(0.0))
+
+		Expect(ioutil.WriteFile(filepath.Join(directory, digest.FromString("filter").Encoded()), []byte("0123456789"), 0644)).To(Succeed())
+		Expect(metricsutils.Gather(registry, "wasme_cache_directory_bytes")[0].GetGauge().GetValue()).To(Equal(10.0))
+	})
+})
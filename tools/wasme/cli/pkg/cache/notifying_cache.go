@@ -2,10 +2,12 @@ package cache
 
 import (
 	"crypto/md5"
+	"encoding/json"
 	"fmt"
 	"os"
 
 	"github.com/hashicorp/go-multierror"
+	pkgcache "github.com/solo-io/wasm/tools/wasme/pkg/cache"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -27,25 +29,48 @@ const (
 	CacheGlobalLabel = "cache.wasme.io/cache_event"
 	// ref to the image
 	CacheImageRefLabel = "cache.wasme.io/image_ref"
-	Reason_ImageAdded  = "ImageAdded"
-	Reason_ImageError  = "ImageError"
+	// the digest the image resolved to, if it was resolved
+	CacheImageDigestLabel = "wasme.io/image-digest"
+	Reason_ImageAdded     = "ImageAdded"
+	Reason_ImageError     = "ImageError"
+	// sent when an unused file is removed from the cache directory, or an image is no longer listed
+	Reason_ImageRemoved = "ImageRemoved"
+	// set to "true" on ImageError events if the cache will retry pulling the image
+	CacheRetryingAnnotation = "cache.wasme.io/retrying"
+	// the PullReport of ImageAdded and ImageError events, as JSON
+	CachePullReportAnnotation = "cache.wasme.io/pull-report"
 )
 
-func (n *Notifier) Notify(err error, image string) error {
+func (n *Notifier) Notify(result pkgcache.PullResult) error {
+	err := result.Err
 	var reason, message string
+	labels := EventLabels(result.Image)
+	if result.Digest != "" {
+		labels[CacheImageDigestLabel] = digestLabelValue(result.Digest.String())
+	}
+	annotations := EventAnnotations(result.Image)
 	if err != nil {
 		reason = Reason_ImageError
 		message = err.Error()
+		if pkgcache.IsRetrying(err) {
+			annotations[CacheRetryingAnnotation] = "true"
+		}
 	} else {
 		reason = Reason_ImageAdded
-		message = fmt.Sprintf("Image %v added successfully", image)
+		message = fmt.Sprintf("Image %v added successfully", result.Image)
+	}
+	report, reportErr := json.Marshal(newPullReport(os.Getenv(NodeHostnameEnv), result))
+	if reportErr != nil {
+		return multierror.Append(err, reportErr)
 	}
+	annotations[CachePullReportAnnotation] = string(report)
+	now := metav1.Now()
 	_, eventCreateErr := n.kube.CoreV1().Events(n.wasmeNamespace).Create(&v1.Event{
 		ObjectMeta: metav1.ObjectMeta{
 			GenerateName: "wasme-cache-event-",
 			Namespace:    n.wasmeNamespace,
-			Labels:       EventLabels(image),
-			Annotations:  EventAnnotations(image),
+			Labels:       labels,
+			Annotations:  annotations,
 		},
 		InvolvedObject: v1.ObjectReference{
 			Kind:       "ConfigMap",
@@ -53,11 +78,14 @@ func (n *Notifier) Notify(err error, image string) error {
 			Name:       n.cacheName,
 			APIVersion: "v1",
 		},
-		Reason:  reason,
-		Message: message,
+		Reason:         reason,
+		Message:        message,
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
 		Source: v1.EventSource{
 			Component: "wasme-cache",
-			Host:      os.Getenv("NODE_HOSTNAME"),
+			Host:      os.Getenv(NodeHostnameEnv),
 		},
 	})
 
@@ -68,6 +96,53 @@ func (n *Notifier) Notify(err error, image string) error {
 	return err
 }
 
+// the events of unlisted refs carry the labels of the image, so they can be waited for.
+// the events of files removed by garbage collection only carry the global label, as their image is unknown
+func (n *Notifier) NotifyRemoved(removal pkgcache.Removal) error {
+	labels := map[string]string{
+		CacheGlobalLabel: "true",
+	}
+	var annotations map[string]string
+	message := fmt.Sprintf("Removed unused file %v from the cache directory", removal.Filename)
+	if removal.Image != "" {
+		labels = EventLabels(removal.Image)
+		if removal.Digest != "" {
+			labels[CacheImageDigestLabel] = digestLabelValue(removal.Digest.String())
+		}
+		annotations = EventAnnotations(removal.Image)
+		if removal.Filename != "" {
+			message = fmt.Sprintf("Image %v is no longer listed, removed file %v from the cache directory", removal.Image, removal.Filename)
+		} else {
+			message = fmt.Sprintf("Image %v is no longer listed", removal.Image)
+		}
+	}
+	now := metav1.Now()
+	_, err := n.kube.CoreV1().Events(n.wasmeNamespace).Create(&v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "wasme-cache-event-",
+			Namespace:    n.wasmeNamespace,
+			Labels:       labels,
+			Annotations:  annotations,
+		},
+		InvolvedObject: v1.ObjectReference{
+			Kind:       "ConfigMap",
+			Namespace:  n.wasmeNamespace,
+			Name:       n.cacheName,
+			APIVersion: "v1",
+		},
+		Reason:         Reason_ImageRemoved,
+		Message:        message,
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+		Source: v1.EventSource{
+			Component: "wasme-cache",
+			Host:      os.Getenv(NodeHostnameEnv),
+		},
+	})
+	return err
+}
+
 func EventLabels(image string) map[string]string {
 	// take hash for valid label name
 	refLabel := fmt.Sprintf("%x", md5.Sum([]byte(image)))
@@ -77,6 +152,11 @@ func EventLabels(image string) map[string]string {
 	}
 }
 
+// digests are too long for label values
+func digestLabelValue(imageDigest string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(imageDigest)))
+}
+
 func EventAnnotations(image string) map[string]string {
 	return map[string]string{
 		CacheImageRefLabel: image,
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	pkgcache "github.com/solo-io/wasm/tools/wasme/pkg/cache"
+	"github.com/solo-io/wasm/tools/wasme/pkg/util"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PurgeImages removes the images from the list of the cache configmap, or every listed image if images is empty,
+// and returns the removed refs, sorted. an image is matched by its ref as listed, or its normalized ref.
+// the cache instances remove the files of the removed refs, and publish an ImageRemoved event for each ref
+func PurgeImages(kube kubernetes.Interface, namespace, name string, images []string) ([]string, error) {
+	cm, err := kube.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting cache configmap %v.%v", name, namespace)
+	}
+	listed, err := pkgcache.ParseImageList(cm.Data[ImagesKey])
+	if err != nil {
+		return nil, err
+	}
+
+	purged := pkgcache.ImageList{}
+	if len(images) == 0 {
+		purged, listed = listed, pkgcache.ImageList{}
+	}
+	for _, image := range images {
+		refs := []string{image}
+		if normalized, err := util.NormalizeImageRef(image); err == nil {
+			refs = append(refs, normalized)
+		}
+		var found bool
+		for _, ref := range refs {
+			if listedImage, ok := listed[ref]; ok {
+				purged[ref] = listedImage
+				delete(listed, ref)
+				found = true
+			}
+		}
+		if !found {
+			return nil, errors.Errorf("image %v is not listed in cache %v.%v", image, name, namespace)
+		}
+	}
+	if len(purged) == 0 {
+		return nil, nil
+	}
+
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[ImagesKey], err = listed.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := kube.CoreV1().ConfigMaps(namespace).Update(cm); err != nil {
+		return nil, errors.Wrapf(err, "updating cache configmap %v.%v", name, namespace)
+	}
+	return purged.Refs(), nil
+}
+
+// GetRemovedImages returns the purged images each cache instance reported removing since the given time, by node
+func GetRemovedImages(kube kubernetes.Interface, namespace, name string, images []string, since time.Time) (map[string]map[string]bool, error) {
+	purged := map[string]bool{}
+	for _, image := range images {
+		purged[image] = true
+	}
+	events, err := ListParsedImageEvents(kube, namespace, ImageEventQuery{
+		CacheName: name,
+		Reason:    Reason_ImageRemoved,
+		Since:     since,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting the events of cache %v.%v", name, namespace)
+	}
+	removed := map[string]map[string]bool{}
+	for _, evt := range events {
+		if evt.Reason != Reason_ImageRemoved || !purged[evt.Image()] {
+			continue
+		}
+		node := evt.Node()
+		if removed[node] == nil {
+			removed[node] = map[string]bool{}
+		}
+		removed[node][evt.Image()] = true
+	}
+	return removed, nil
+}
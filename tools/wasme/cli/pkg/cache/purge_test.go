@@ -0,0 +1,103 @@
+package cache_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	. "github.com/solo-io/wasm/tools/wasme/cli/pkg/cache"
+	pkgcache "github.com/solo-io/wasm/tools/wasme/pkg/cache"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Purge", func() {
+	const (
+		purgedImage = "webassemblyhub.io/filter/purged:v1"
+		keptImage   = "webassemblyhub.io/filter/kept:v1"
+	)
+	var kube *fake.Clientset
+
+	BeforeEach(func() {
+		images, err := pkgcache.ImageList{purgedImage: {}, keptImage: {}}.Marshal()
+		Expect(err).NotTo(HaveOccurred())
+		kube = fake.NewSimpleClientset(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: CacheName, Namespace: CacheNamespace},
+			Data:       map[string]string{ImagesKey: images},
+		})
+	})
+
+	getListedImages := func() []string {
+		cm, err := kube.CoreV1().ConfigMaps(CacheNamespace).Get(CacheName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		images, err := pkgcache.ParseImageList(cm.Data[ImagesKey])
+		Expect(err).NotTo(HaveOccurred())
+		return images.Refs()
+	}
+
+	It("removes the given images from the cache configmap", func() {
+		purged, err := PurgeImages(kube, CacheNamespace, CacheName, []string{purgedImage})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(purged).To(Equal([]string{purgedImage}))
+		Expect(getListedImages()).To(Equal([]string{keptImage}))
+
+		_, err = PurgeImages(kube, CacheNamespace, CacheName, []string{purgedImage})
+		Expect(err).To(MatchError(ContainSubstring("is not listed")))
+	})
+
+	It("removes every image from the cache configmap", func() {
+		purged, err := PurgeImages(kube, CacheNamespace, CacheName, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(purged).To(Equal([]string{keptImage, purgedImage}))
+		Expect(getListedImages()).To(BeEmpty())
+
+		purged, err = PurgeImages(kube, CacheNamespace, CacheName, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(purged).To(BeEmpty())
+	})
+
+	It("returns the purged images each node reported removing", func() {
+		publish := func(name, node, image string, published time.Time) {
+			evt := &corev1.Event{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        name,
+					Namespace:   CacheNamespace,
+					Labels:      EventLabels(image),
+					Annotations: EventAnnotations(image),
+				},
+				Reason:        Reason_ImageRemoved,
+				Source:        corev1.EventSource{Host: node},
+				LastTimestamp: metav1.NewTime(published),
+			}
+			_, err := kube.CoreV1().Events(CacheNamespace).Create(evt)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		since := time.Now().Add(-time.Minute)
+		publish("a-purged", "node-a", purgedImage, time.Now())
+		publish("a-kept", "node-a", keptImage, time.Now())
+		publish("b-stale", "node-b", purgedImage, since.Add(-time.Hour))
+
+		removed, err := GetRemovedImages(kube, CacheNamespace, CacheName, []string{purgedImage}, since)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removed).To(Equal(map[string]map[string]bool{"node-a": {purgedImage: true}}))
+	})
+
+	It("publishes the removal of an unlisted image with the labels of the image", func() {
+		imageDigest := digest.FromString("purged")
+		notifier := NewNotifier(kube, CacheNamespace, CacheName)
+		Expect(notifier.NotifyRemoved(pkgcache.Removal{
+			Image:    purgedImage,
+			Digest:   imageDigest,
+			Filename: imageDigest.Encoded(),
+		})).To(Succeed())
+
+		events, err := ListParsedImageEvents(kube, CacheNamespace, ImageEventQuery{Digest: imageDigest.String()})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Reason).To(Equal(Reason_ImageRemoved))
+		Expect(events[0].Image()).To(Equal(purgedImage))
+		Expect(events[0].Message).To(ContainSubstring(imageDigest.Encoded()))
+	})
+})
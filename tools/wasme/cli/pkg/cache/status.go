@@ -0,0 +1,175 @@
+package cache
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+	pkgcache "github.com/solo-io/wasm/tools/wasme/pkg/cache"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ImageState is the state of an image listed in the cache configmap on a node running the cache
+type ImageState string
+
+const (
+	// the image was written to the cache directory of the node
+	ImageState_Ready ImageState = "ready"
+	// the cache has not pulled the image yet, or retries a failed pull
+	ImageState_Pulling ImageState = "pulling"
+	// the cache failed to pull the image and stopped retrying until the next resync
+	ImageState_Error ImageState = "error"
+)
+
+// NodeImageStatus is the status of an image listed in the cache configmap on a node running the cache
+type NodeImageStatus struct {
+	Node  string `json:"node"`
+	Image string `json:"image"`
+	// the digest reported by the latest pull, or recorded when the image was added
+	Digest string     `json:"digest,omitempty"`
+	State  ImageState `json:"state"`
+	// the error of the latest pull, if it failed
+	LastError string `json:"lastError,omitempty"`
+	// the time of the latest event published by the cache for the image on the node
+	LastUpdated *metav1.Time `json:"lastUpdated,omitempty"`
+}
+
+// CacheStatus is the status of each image listed in the cache configmap on each node running the cache
+type CacheStatus struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	// the number of cache pods desired and ready, according to the status of the cache daemonset or deployment
+	DesiredInstances int32 `json:"desiredInstances"`
+	ReadyInstances   int32 `json:"readyInstances"`
+	// sorted by node and image
+	Images []NodeImageStatus `json:"images"`
+}
+
+// GetCacheStatus reads the cache configmap, the cache pods and the events published by the cache,
+// and returns the state of each listed image on each node running a cache pod.
+// if image is set, only the status of that image is returned.
+// the cache may be installed as a daemonset, or as a deployment managed by the user
+func GetCacheStatus(kube kubernetes.Interface, namespace, name, image string) (*CacheStatus, error) {
+	cm, err := kube.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting cache configmap %v.%v", name, namespace)
+	}
+	images, err := pkgcache.ParseImageList(cm.Data[ImagesKey])
+	if err != nil {
+		return nil, err
+	}
+
+	status := &CacheStatus{Name: name, Namespace: namespace}
+	nodes, err := getCacheNodes(kube, status)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := ListParsedImageEvents(kube, namespace, ImageEventQuery{Image: image, CacheName: name})
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting the events of cache %v.%v", name, namespace)
+	}
+	type nodeImage struct{ node, image string }
+	latest := map[nodeImage]ImageEvent{}
+	for _, evt := range LatestPullEvents(events) {
+		latest[nodeImage{node: evt.Node(), image: evt.Image()}] = evt
+	}
+
+	for _, node := range nodes {
+		for _, ref := range images.Refs() {
+			if image != "" && ref != image {
+				continue
+			}
+			imageStatus := NodeImageStatus{
+				Node:   node,
+				Image:  ref,
+				Digest: images[ref].Digest,
+				State:  ImageState_Pulling,
+			}
+			if evt, ok := latest[nodeImage{node: node, image: ref}]; ok {
+				imageStatus.apply(evt)
+			}
+			status.Images = append(status.Images, imageStatus)
+		}
+	}
+	return status, nil
+}
+
+// GetCacheNodes returns the sorted names of the nodes running a cache pod
+func GetCacheNodes(kube kubernetes.Interface, namespace, name string) ([]string, error) {
+	return getCacheNodes(kube, &CacheStatus{Name: name, Namespace: namespace})
+}
+
+// also sets the instance counts of the status
+func getCacheNodes(kube kubernetes.Interface, status *CacheStatus) ([]string, error) {
+	labelSelector, err := getCacheInstances(kube, status)
+	if err != nil {
+		return nil, err
+	}
+	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := kube.CoreV1().Pods(status.Namespace).List(metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "listing the pods of cache %v.%v", status.Name, status.Namespace)
+	}
+	seen := map[string]bool{}
+	var nodes []string
+	for _, pod := range pods.Items {
+		if node := pod.Spec.NodeName; node != "" && !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Strings(nodes)
+	return nodes, nil
+}
+
+// sets the state of the image from the latest event published for it on the node
+func (s *NodeImageStatus) apply(evt ImageEvent) {
+	published := metav1.NewTime(EventTime(evt.Event))
+	s.LastUpdated = &published
+	if evt.Report != nil && evt.Report.Digest != "" {
+		s.Digest = evt.Report.Digest
+	}
+	switch {
+	case evt.Reason == Reason_ImageAdded:
+		s.State = ImageState_Ready
+	case evt.Reason == Reason_ImageRemoved:
+		// listed again since the cache removed it
+		s.State = ImageState_Pulling
+	case evt.Annotations[CacheRetryingAnnotation] == "true":
+		s.State = ImageState_Pulling
+		s.LastError = evt.ErrorMessage()
+	default:
+		s.State = ImageState_Error
+		s.LastError = evt.ErrorMessage()
+	}
+}
+
+// sets the instance counts of the status from the cache daemonset, or the cache deployment if there is no daemonset,
+// and returns the selector of the cache pods
+func getCacheInstances(kube kubernetes.Interface, status *CacheStatus) (*metav1.LabelSelector, error) {
+	daemonSet, err := kube.AppsV1().DaemonSets(status.Namespace).Get(status.Name, metav1.GetOptions{})
+	if err == nil {
+		status.DesiredInstances = daemonSet.Status.DesiredNumberScheduled
+		status.ReadyInstances = daemonSet.Status.NumberReady
+		return daemonSet.Spec.Selector, nil
+	}
+	if !kubeerrors.IsNotFound(err) {
+		return nil, errors.Wrapf(err, "getting daemonset for cache %v.%v", status.Name, status.Namespace)
+	}
+	deployment, err := kube.AppsV1().Deployments(status.Namespace).Get(status.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting daemonset or deployment for cache %v.%v", status.Name, status.Namespace)
+	}
+	if deployment.Spec.Replicas != nil {
+		status.DesiredInstances = *deployment.Spec.Replicas
+	}
+	status.ReadyInstances = deployment.Status.ReadyReplicas
+	return deployment.Spec.Selector, nil
+}
@@ -0,0 +1,119 @@
+package cache_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/solo-io/wasm/tools/wasme/cli/pkg/cache"
+	pkgcache "github.com/solo-io/wasm/tools/wasme/pkg/cache"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Cache status", func() {
+	const (
+		pulledImage  = "webassemblyhub.io/filter/pulled:v1"
+		pulledDigest = "sha256:e454cab754cf9234e8b41d7c5e30f53a4c125d7d9443cb3ef2b2eb1c4bd1ec14"
+		brokenImage  = "webassemblyhub.io/filter/broken:v1"
+	)
+	var kube *fake.Clientset
+
+	BeforeEach(func() {
+		images, err := pkgcache.ImageList{
+			pulledImage: {Digest: pulledDigest},
+			brokenImage: {},
+		}.Marshal()
+		Expect(err).NotTo(HaveOccurred())
+		labels := map[string]string{"app": "wasme-cache"}
+
+		objects := []runtime.Object{
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: CacheName, Namespace: CacheNamespace},
+				Data:       map[string]string{ImagesKey: images},
+			},
+			&appsv1.DaemonSet{
+				ObjectMeta: metav1.ObjectMeta{Name: CacheName, Namespace: CacheNamespace},
+				Spec:       appsv1.DaemonSetSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}},
+				Status:     appsv1.DaemonSetStatus{DesiredNumberScheduled: 3, NumberReady: 2},
+			},
+			// not a cache pod
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: CacheNamespace},
+				Spec:       corev1.PodSpec{NodeName: "node-d"},
+			},
+		}
+		for _, node := range []string{"node-a", "node-b", "node-c"} {
+			objects = append(objects, &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "cache-" + node, Namespace: CacheNamespace, Labels: labels},
+				Spec:       corev1.PodSpec{NodeName: node},
+			})
+		}
+
+		event := func(name, node, image, reason string, published time.Time, annotations map[string]string) *corev1.Event {
+			evt := &corev1.Event{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        name,
+					Namespace:   CacheNamespace,
+					Labels:      EventLabels(image),
+					Annotations: EventAnnotations(image),
+				},
+				Reason:        reason,
+				Message:       "connection refused",
+				Source:        corev1.EventSource{Host: node},
+				LastTimestamp: metav1.NewTime(published),
+			}
+			for k, v := range annotations {
+				evt.Annotations[k] = v
+			}
+			return evt
+		}
+		now := time.Now()
+		objects = append(objects,
+			event("a-failed", "node-a", pulledImage, Reason_ImageError, now.Add(-time.Minute), nil),
+			event("a-pulled", "node-a", pulledImage, Reason_ImageAdded, now, nil),
+			event("a-broken", "node-a", brokenImage, Reason_ImageError, now, nil),
+			event("b-broken", "node-b", brokenImage, Reason_ImageError, now, map[string]string{CacheRetryingAnnotation: "true"}),
+		)
+		kube = fake.NewSimpleClientset(objects...)
+	})
+
+	It("returns the state of each listed image on each node running the cache", func() {
+		status, err := GetCacheStatus(kube, CacheNamespace, CacheName, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.DesiredInstances).To(Equal(int32(3)))
+		Expect(status.ReadyInstances).To(Equal(int32(2)))
+
+		type summary struct {
+			node, image, digest string
+			state               ImageState
+			lastError           string
+		}
+		var summaries []summary
+		for _, image := range status.Images {
+			summaries = append(summaries, summary{image.Node, image.Image, image.Digest, image.State, image.LastError})
+		}
+		Expect(summaries).To(Equal([]summary{
+			{"node-a", brokenImage, "", ImageState_Error, "connection refused"},
+			{"node-a", pulledImage, pulledDigest, ImageState_Ready, ""},
+			{"node-b", brokenImage, "", ImageState_Pulling, "connection refused"},
+			{"node-b", pulledImage, pulledDigest, ImageState_Pulling, ""},
+			{"node-c", brokenImage, "", ImageState_Pulling, ""},
+			{"node-c", pulledImage, pulledDigest, ImageState_Pulling, ""},
+		}))
+	})
+
+	It("only returns the status of the given image", func() {
+		status, err := GetCacheStatus(kube, CacheNamespace, CacheName, pulledImage)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Images).To(HaveLen(3))
+		for _, image := range status.Images {
+			Expect(image.Image).To(Equal(pulledImage))
+		}
+		Expect(status.Images[0].State).To(Equal(ImageState_Ready))
+		Expect(status.Images[0].LastUpdated).NotTo(BeNil())
+	})
+})
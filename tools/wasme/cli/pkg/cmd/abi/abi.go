@@ -0,0 +1,178 @@
+package abi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/abi"
+	"github.com/spf13/cobra"
+)
+
+const (
+	outputTable = "table"
+	outputJson  = "json"
+)
+
+type abiOptions struct {
+	abiRegistryFile string
+	output          string
+
+	// set by wasme abi compatible
+	istioVersion string
+	abiVersion   string
+}
+
+func AbiCmd() *cobra.Command {
+	var opts abiOptions
+	cmd := &cobra.Command{
+		Use:   "abi",
+		Short: "Query the registry of the ABI versions supported by Istio and Gloo",
+		Long: `Print which Istio and Gloo versions support each ABI version, as checked by wasme deploy and wasme check.
+
+Use --abi-registry-file to merge a custom registry into the built-in registry, e.g. to confirm the overrides
+passed to wasme deploy take effect.
+`,
+	}
+	cmd.PersistentFlags().StringVar(&opts.abiRegistryFile, "abi-registry-file", "", "path to a YAML file mapping abi versions to the istio versions which support them, e.g. '<abi version>: {istio: [1.9.x]}'. entries are merged into the built-in registry, taking precedence over conflicting entries.")
+	cmd.PersistentFlags().StringVarP(&opts.output, "output", "o", outputTable, "output format, one of "+outputTable+", "+outputJson)
+
+	cmd.AddCommand(
+		listCmd(&opts),
+		compatibleCmd(&opts),
+	)
+	return cmd
+}
+
+func listCmd(opts *abiOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the ABI versions of the registry, with the Istio and Gloo versions supporting them",
+		Args:  cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			registry, err := opts.registry()
+			if err != nil {
+				return err
+			}
+			return opts.print(os.Stdout, makeRows(registry, registry.ListAbiVersions()))
+		},
+	}
+}
+
+func compatibleCmd(opts *abiOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "compatible --istio-version=<istio version>|--abi=<abi version>",
+		Short: "Print the ABI versions supported by an Istio version, or the Istio versions supporting an ABI version",
+		Args:  cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			registry, err := opts.registry()
+			if err != nil {
+				return err
+			}
+			rows, err := opts.compatible(registry)
+			if err != nil {
+				return err
+			}
+			return opts.print(os.Stdout, rows)
+		},
+	}
+	cmd.Flags().StringVar(&opts.istioVersion, "istio-version", "", "print the abi versions supported by this Istio version, e.g. 1.8.2 or 1.8.x")
+	cmd.Flags().StringVar(&opts.abiVersion, "abi", "", "print the Istio versions supporting this abi version, e.g. "+abi.Version_4689a30309abf31aee9ae36e73d34b1bb182685f.Name)
+	return cmd
+}
+
+// an abi version of the registry, as printed with --output=json
+type row struct {
+	Name          string   `json:"name"`
+	Repository    string   `json:"repository,omitempty"`
+	Commit        string   `json:"commit,omitempty"`
+	IstioVersions []string `json:"istioVersions"`
+	GlooVersions  []string `json:"glooVersions"`
+}
+
+func makeRows(registry abi.Registry, versions abi.Versions) []row {
+	rows := []row{}
+	for _, version := range versions {
+		// printed as empty lists rather than null
+		istioVersions, glooVersions := []string{}, []string{}
+		rows = append(rows, row{
+			Name:          version.Name,
+			Repository:    version.Repository,
+			Commit:        version.Commit,
+			IstioVersions: append(istioVersions, registry.IstioVersionsFor(version.Name)...),
+			GlooVersions:  append(glooVersions, registry.GlooVersionsFor(version.Name)...),
+		})
+	}
+	return rows
+}
+
+// returns the built-in registry, merged with the --abi-registry-file
+func (opts *abiOptions) registry() (abi.Registry, error) {
+	if opts.output != outputTable && opts.output != outputJson {
+		return nil, errors.Errorf("invalid --output %v, must be %v or %v", opts.output, outputTable, outputJson)
+	}
+	registry := abi.DefaultRegistry
+	if opts.abiRegistryFile != "" {
+		customRegistry, err := abi.LoadRegistryFile(opts.abiRegistryFile)
+		if err != nil {
+			return nil, err
+		}
+		registry = registry.Merge(customRegistry)
+	}
+	return registry, nil
+}
+
+// returns the abi versions supported by the --istio-version, or the --abi version
+func (opts *abiOptions) compatible(registry abi.Registry) ([]row, error) {
+	if (opts.istioVersion == "") == (opts.abiVersion == "") {
+		return nil, errors.Errorf("exactly one of --istio-version or --abi must be set")
+	}
+	if opts.istioVersion != "" {
+		versions, err := registry.AbiVersionsFor(opts.istioVersion)
+		if err != nil {
+			return nil, err
+		}
+		if len(versions) == 0 {
+			return nil, errors.Errorf("no abi versions are supported by istio %v", opts.istioVersion)
+		}
+		return makeRows(registry, versions), nil
+	}
+	for _, version := range registry.ListAbiVersions() {
+		if version.Name == opts.abiVersion {
+			return makeRows(registry, abi.Versions{version}), nil
+		}
+	}
+	return nil, errors.Errorf("abi version %v not found in the registry", opts.abiVersion)
+}
+
+func (opts *abiOptions) print(out io.Writer, rows []row) error {
+	if opts.output == outputJson {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 0, 0, ' ', 0)
+
+	fmt.Fprintf(w, "ABI VERSION \tISTIO VERSIONS \tGLOO VERSIONS \tCOMMIT\n")
+	for _, row := range rows {
+		commit := row.Commit
+		if commit == "" {
+			commit = "-"
+		}
+		fmt.Fprintf(w, "%v \t%v \t%v \t%v\n", row.Name, joinVersions(row.IstioVersions), joinVersions(row.GlooVersions), commit)
+	}
+	return w.Flush()
+}
+
+func joinVersions(versions []string) string {
+	if len(versions) == 0 {
+		return "-"
+	}
+	return strings.Join(versions, ", ")
+}
@@ -0,0 +1,13 @@
+package abi
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestAbi(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Abi Suite")
+}
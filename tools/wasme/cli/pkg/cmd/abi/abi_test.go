@@ -0,0 +1,72 @@
+package abi
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/abi"
+)
+
+var _ = Describe("Abi", func() {
+	istio17Abi := abi.Version_4689a30309abf31aee9ae36e73d34b1bb182685f
+
+	It("prints the abi versions supported by an istio version", func() {
+		opts := &abiOptions{output: outputTable, istioVersion: "1.8.2"}
+		registry, err := opts.registry()
+		Expect(err).NotTo(HaveOccurred())
+		rows, err := opts.compatible(registry)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rows).To(Equal([]row{{
+			Name:          istio17Abi.Name,
+			Repository:    istio17Abi.Repository,
+			Commit:        istio17Abi.Commit,
+			IstioVersions: []string{"1.7.x", "1.8.x"},
+			GlooVersions:  []string{},
+		}}))
+
+		var out bytes.Buffer
+		Expect(opts.print(&out, rows)).NotTo(HaveOccurred())
+		Expect(out.String()).To(Equal(
+			"ABI VERSION                                 ISTIO VERSIONS GLOO VERSIONS COMMIT\n" +
+				istio17Abi.Name + " 1.7.x, 1.8.x   -             " + istio17Abi.Commit + "\n"))
+
+		opts.istioVersion = "1.4.0"
+		_, err = opts.compatible(registry)
+		Expect(err).To(MatchError("no abi versions are supported by istio 1.4.0"))
+	})
+
+	It("prints the istio versions supporting an abi version of the merged registry", func() {
+		dir, err := ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		registryFile := filepath.Join(dir, "registry.yaml")
+		Expect(ioutil.WriteFile(registryFile, []byte(istio17Abi.Name+":\n  istio: [1.9.x]\n"), 0644)).NotTo(HaveOccurred())
+
+		opts := &abiOptions{output: outputJson, abiRegistryFile: registryFile, abiVersion: istio17Abi.Name}
+		registry, err := opts.registry()
+		Expect(err).NotTo(HaveOccurred())
+		rows, err := opts.compatible(registry)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rows).To(HaveLen(1))
+		Expect(rows[0].IstioVersions).To(Equal([]string{"1.7.x", "1.8.x", "1.9.x"}))
+
+		var out bytes.Buffer
+		Expect(opts.print(&out, rows)).NotTo(HaveOccurred())
+		Expect(out.String()).To(ContainSubstring(`"glooVersions": []`))
+
+		opts.abiVersion = "v0-unknown"
+		_, err = opts.compatible(registry)
+		Expect(err).To(MatchError("abi version v0-unknown not found in the registry"))
+	})
+
+	It("requires exactly one of --istio-version or --abi", func() {
+		_, err := (&abiOptions{}).compatible(abi.DefaultRegistry)
+		Expect(err).To(MatchError("exactly one of --istio-version or --abi must be set"))
+		_, err = (&abiOptions{istioVersion: "1.8.2", abiVersion: istio17Abi.Name}).compatible(abi.DefaultRegistry)
+		Expect(err).To(HaveOccurred())
+	})
+})
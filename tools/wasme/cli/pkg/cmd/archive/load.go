@@ -0,0 +1,146 @@
+package archive
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cmd/opts"
+	"github.com/solo-io/wasm/tools/wasme/pkg/archive"
+	"github.com/solo-io/wasm/tools/wasme/pkg/model"
+	"github.com/solo-io/wasm/tools/wasme/pkg/push"
+	"github.com/solo-io/wasm/tools/wasme/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+type loadOptions struct {
+	file       string
+	tag        string
+	push       bool
+	storageDir string
+
+	*opts.AuthOptions
+}
+
+func LoadCmd(ctx *context.Context, loginOptions *opts.AuthOptions) *cobra.Command {
+	var opts loadOptions
+	opts.AuthOptions = loginOptions
+	cmd := &cobra.Command{
+		Use:   "load FILE",
+		Short: "Load wasm filter images from a tar archive",
+		Long: `Load wasm filter images from a tar archive written by wasme save into the local store. E.g.:
+
+wasme load filter.tar
+
+Pass - as FILE to read the archive from stdin. Pass --tag to load the image of the archive under a different name,
+and --push to push the loaded images to their registry:
+
+wasme load filter.tar --tag registry.corp/my/filter:v1 --push
+`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.file = args[0]
+			return runLoad(*ctx, opts)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.tag, "tag", "t", "", "Load the image under this name[:tag] instead of the name it was saved with. The archive must contain a single image")
+	cmd.Flags().BoolVar(&opts.push, "push", false, "Push the loaded images to their registry")
+	cmd.Flags().StringVar(&opts.storageDir, "store", "", "Set the path to the local storage directory for wasm images. Defaults to $HOME/.wasme/store")
+
+	return cmd
+}
+
+func runLoad(ctx context.Context, opts loadOptions) error {
+	if opts.push {
+		if err := opts.ReadPasswordStdin(os.Stdin); err != nil {
+			return err
+		}
+	}
+
+	var in io.Reader = os.Stdin
+	if opts.file != "-" {
+		f, err := os.Open(opts.file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	archived, err := archive.Load(in)
+	if err != nil {
+		return err
+	}
+	if opts.tag != "" && len(archived) != 1 {
+		return errors.Errorf("--tag requires an archive with a single image, %v contains %v images", opts.file, len(archived))
+	}
+
+	imageStore := store.NewStore(opts.storageDir)
+	var images []model.Image
+	for _, image := range archived {
+		ref := image.Ref()
+		if opts.tag != "" {
+			ref = opts.tag
+		}
+		if ref == "" {
+			return errors.Errorf("an image of %v has no name, pass --tag to name it", opts.file)
+		}
+		storable, err := storableImage(ctx, ref, image)
+		if err != nil {
+			return err
+		}
+		if err := imageStore.Add(ctx, storable); err != nil {
+			return err
+		}
+		descriptor, err := storable.Descriptor()
+		if err != nil {
+			return err
+		}
+		logrus.WithFields(logrus.Fields{
+			"digest": descriptor.Digest.String(),
+			"image":  storable.Ref(),
+		}).Info("loaded image")
+		images = append(images, storable)
+	}
+
+	if !opts.push {
+		return nil
+	}
+	resolver, authorizer, err := opts.NewResolver()
+	if err != nil {
+		return err
+	}
+	pusher := push.NewPusherWithOptions(resolver, authorizer, push.Options{Progress: opts.ProgressFunc()})
+	for _, image := range images {
+		logrus.Infof("Pushing image %v", image.Ref())
+		if err := pusher.Push(ctx, image); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// returns the image under the ref, keeping its descriptor
+func storableImage(ctx context.Context, ref string, image model.Image) (model.Image, error) {
+	descriptor, err := image.Descriptor()
+	if err != nil {
+		return nil, err
+	}
+	filter, err := image.FetchFilter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	filterBytes, err := ioutil.ReadAll(filter)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := image.FetchConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return store.NewStorableImage(ref, descriptor, filterBytes, cfg)
+}
@@ -0,0 +1,76 @@
+package archive
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/solo-io/wasm/tools/wasme/pkg/archive"
+	"github.com/solo-io/wasm/tools/wasme/pkg/model"
+	"github.com/solo-io/wasm/tools/wasme/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+type saveOptions struct {
+	refs       []string
+	output     string
+	storageDir string
+}
+
+func SaveCmd(ctx *context.Context) *cobra.Command {
+	var opts saveOptions
+	cmd := &cobra.Command{
+		Use:   "save name[:tag|@digest] [name[:tag|@digest]...]",
+		Short: "Save wasm filter images to a tar archive",
+		Long: `Save wasm filter images from the local store to a tarball of an OCI image layout,
+which can be imported with wasme load, e.g. to move images into an environment without access to the registry:
+
+wasme save webassemblyhub.io/my/filter:v1 -o filter.tar
+
+The archive is written to stdout unless -o is set.
+`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.refs = args
+			return runSave(*ctx, opts)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "", "Write the archive to this file instead of stdout")
+	cmd.Flags().StringVar(&opts.storageDir, "store", "", "Set the path to the local storage directory for wasm images. Defaults to $HOME/.wasme/store")
+
+	return cmd
+}
+
+func runSave(ctx context.Context, opts saveOptions) error {
+	imageStore := store.NewStore(opts.storageDir)
+	var images []model.Image
+	for _, ref := range opts.refs {
+		image, err := imageStore.Get(ref)
+		if err != nil {
+			return errors.Wrap(err, "image not found. run `wasme list` to see locally cached images")
+		}
+		images = append(images, image)
+	}
+
+	var out io.Writer = os.Stdout
+	if opts.output != "" {
+		f, err := os.Create(opts.output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if err := archive.Save(ctx, out, images...); err != nil {
+		return err
+	}
+
+	if opts.output != "" {
+		logrus.Infof("saved %v images to %v", len(images), opts.output)
+	}
+	return nil
+}
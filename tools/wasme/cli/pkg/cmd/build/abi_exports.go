@@ -0,0 +1,25 @@
+package build
+
+import (
+	"github.com/pkg/errors"
+	"github.com/solo-io/wasm/tools/wasme/pkg/config"
+)
+
+// sets the AbiVersions of the runtime config to the versions compatible with the module.
+// if the runtime config already declares AbiVersions, they must all be compatible with the module
+func stampAbiVersions(cfg *config.Runtime, compatible []string) error {
+	if len(cfg.GetAbiVersions()) == 0 {
+		cfg.AbiVersions = compatible
+		return nil
+	}
+	compatibleVersions := map[string]bool{}
+	for _, version := range compatible {
+		compatibleVersions[version] = true
+	}
+	for _, version := range cfg.GetAbiVersions() {
+		if !compatibleVersions[version] {
+			return errors.Errorf("the runtime config declares abi version %v, but the module is only compatible with %v", version, compatible)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package build
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/abi"
+	"github.com/solo-io/wasm/tools/wasme/pkg/config"
+)
+
+var _ = Describe("AbiExports", func() {
+	It("stamps the AbiVersions into the runtime config", func() {
+		cfg := &config.Runtime{}
+		Expect(stampAbiVersions(cfg, []string{"v0.2.1"})).NotTo(HaveOccurred())
+		Expect(cfg.AbiVersions).To(Equal([]string{"v0.2.1"}))
+	})
+
+	It("rejects runtime configs declaring incompatible AbiVersions", func() {
+		cfg := &config.Runtime{AbiVersions: []string{"v0.2.1"}}
+		Expect(stampAbiVersions(cfg, []string{"v0.2.1", "v0.2.2"})).NotTo(HaveOccurred())
+
+		cfg = &config.Runtime{AbiVersions: []string{abi.Version_097b7f2e4cc1fb490cc1943d0d633655ac3c522f.Name}}
+		err := stampAbiVersions(cfg, []string{"v0.2.1"})
+		Expect(err).To(MatchError("the runtime config declares abi version v0-097b7f2e4cc1fb490cc1943d0d633655ac3c522f, but the module is only compatible with [v0.2.1]"))
+	})
+})
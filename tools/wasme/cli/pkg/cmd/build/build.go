@@ -31,6 +31,10 @@ type buildOptions struct {
 	storageDir   string
 	builderImage string
 	tmpDir       string
+	format       string
+
+	// set by the build of the language if it detects the AbiVersions compatible with the module
+	moduleAbiVersions []string
 }
 
 func BuildCmd(ctx *context.Context) *cobra.Command {
@@ -43,8 +47,10 @@ func BuildCmd(ctx *context.Context) *cobra.Command {
 
 	cmd.PersistentFlags().StringVarP(&opts.tag, "tag", "t", "", "The image ref with which to tag this image. Specified in the format <name:tag>. Required")
 	cmd.PersistentFlags().StringVarP(&opts.configFile, "config", "c", "", "The path to the filter configuration file for the image. If not specified, defaults to <SOURCE_DIRECTOR>/runtime-config.json. This file must be present in order to build the image.")
+	cmd.PersistentFlags().StringVar(&opts.configFile, "config-file", "", "Same as --config. The file declares the abiVersions and rootIds of the filter, its defaultConfig passed to the filter when the deployment does not set one, and its description and docsUrl. It is validated against the schema of the runtime config")
 	cmd.PersistentFlags().StringVar(&opts.storageDir, "store", "", "Set the path to the local storage directory for wasm images. Defaults to $HOME/.wasme/store")
 	cmd.PersistentFlags().StringVarP(&opts.builderImage, "image", "i", "quay.io/solo-io/ee-builder:"+version.Version, "Name of the docker image containing the Bazel run instructions. Modify to run a custom builder image")
+	cmd.PersistentFlags().StringVar(&opts.format, "format", string(model.FormatWasme), "The format the image is pushed in by wasme push. "+formatsUsage)
 	cmd.PersistentFlags().StringVarP(&opts.tmpDir, "tmp-dir", "", "", "Directory for storing temporary files during build. Defaults to /tmp on OSx and Linux. If unset, temporary files will be removed after build")
 
 	cmd.AddCommand(
@@ -58,7 +64,17 @@ func BuildCmd(ctx *context.Context) *cobra.Command {
 	return cmd
 }
 
+// describes the image formats in flag usages
+var formatsUsage = "wasme images carry the wasme config as a layer next to the module. " +
+	"compat images carry the module as their single layer, so they can be pulled by the OCI image fetcher of istiod. " +
+	"possible values are " + string(model.FormatWasme) + ", " + string(model.FormatCompat)
+
 func runBuild(ctx context.Context, opts *buildOptions, getFilter func(opts *buildOptions) (string, error)) error {
+	format, err := model.ParseFormat(opts.format)
+	if err != nil {
+		return err
+	}
+
 	configFile := opts.configFile
 	if configFile == "" {
 		configFile = filepath.Join(opts.sourceDir, "runtime-config.json")
@@ -69,6 +85,10 @@ func runBuild(ctx context.Context, opts *buildOptions, getFilter func(opts *buil
 		return err
 	}
 
+	if err := config.Validate(configBytes); err != nil {
+		return errors.Wrapf(err, "validating %v", configFile)
+	}
+
 	cfg, err := config.FromBytes(configBytes)
 	if err != nil {
 		return err
@@ -105,6 +125,12 @@ func runBuild(ctx context.Context, opts *buildOptions, getFilter func(opts *buil
 		return errors.Wrap(err, "failed producing filter file")
 	}
 
+	if len(opts.moduleAbiVersions) > 0 {
+		if err := stampAbiVersions(cfg, opts.moduleAbiVersions); err != nil {
+			return err
+		}
+	}
+
 	log.WithFields(logrus.Fields{
 		"filter file": filterFile,
 		"tag":         opts.tag,
@@ -121,7 +147,7 @@ func runBuild(ctx context.Context, opts *buildOptions, getFilter func(opts *buil
 		return err
 	}
 
-	image, err := store.NewStorableImage(opts.tag, descriptor, filterBytes, cfg)
+	image, err := store.NewStorableImageWithFormat(opts.tag, descriptor, filterBytes, cfg, format)
 	if err != nil {
 		return err
 	}
@@ -2,10 +2,13 @@ package build
 
 import (
 	"context"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/abi"
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/defaults"
 	"github.com/solo-io/wasm/tools/wasme/pkg/util"
 	"github.com/spf13/cobra"
@@ -15,11 +18,24 @@ func tinygoCmd(ctx *context.Context, opts *buildOptions) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "tinygo SOURCE_DIRECTORY -t <name:tag>",
 		Short: "Build a wasm image from a TinyGo filter using TinyGo-in-Docker",
-		Args:  cobra.ExactArgs(1),
+		Long: `Build a wasm image from a filter written with the proxy-wasm Go SDK, using the TinyGo compiler of the builder image.
+
+The built module must export the proxy-wasm ABI symbols. The abiVersions of the runtime config are set to the
+versions compatible with the proxy-wasm ABI version exported by the module, or must all be compatible with it if they are set.`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			opts.sourceDir = args[0]
 			return runBuild(*ctx, opts, func(build *buildOptions) (s string, err error) {
-				return runTinyGoBuild(*build)
+				filterFile, err := runTinyGoBuild(*build)
+				if err != nil {
+					return "", err
+				}
+				// the module is validated and its AbiVersions stamped into the image config
+				build.moduleAbiVersions, err = readModuleAbiVersions(filterFile)
+				if err != nil {
+					return "", err
+				}
+				return filterFile, nil
 			})
 		},
 	}
@@ -54,3 +70,16 @@ func runTinyGoBuild(build buildOptions) (string, error) {
 	// filter.wasm currently hard-coded in package.json file
 	return filepath.Join(build.tmpDir, "filter.wasm"), nil
 }
+
+// returns the AbiVersions compatible with the module built by runTinyGoBuild
+func readModuleAbiVersions(filterFile string) ([]string, error) {
+	module, err := ioutil.ReadFile(filterFile)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := abi.ModuleAbiVersions(module)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid TinyGo module")
+	}
+	return versions, nil
+}
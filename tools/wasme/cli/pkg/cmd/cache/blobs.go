@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"github.com/solo-io/wasm/tools/wasme/pkg/store"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+type blobsOptions struct {
+	storageDir string
+	all        bool
+}
+
+func (opts *blobsOptions) addStoreToFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&opts.storageDir, "store", "", "Set the path to the local storage directory for wasm images. Defaults to $HOME/.wasme/store")
+}
+
+func LsCmd() *cobra.Command {
+	var opts blobsOptions
+	cmd := &cobra.Command{
+		Use:   "ls",
+		Short: "List the blobs of pulled images in the local content store",
+		Long: `List the blobs (manifests, configs and filters) of the images pulled by wasme, which are stored by digest in the local storage directory.
+wasme pull and wasme deploy only fetch the blobs of an image which are missing from the store.
+`,
+		Args: cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			blobs, err := store.NewBlobStore(opts.storageDir).List()
+			if err != nil {
+				return err
+			}
+			return writeBlobsTable(os.Stdout, blobs)
+		},
+	}
+	opts.addStoreToFlags(cmd)
+	return cmd
+}
+
+func RmCmd() *cobra.Command {
+	var opts blobsOptions
+	cmd := &cobra.Command{
+		Use:   "rm [digest...] [--all]",
+		Short: "Remove blobs from the local content store",
+		Long: `Remove blobs from the local content store by digest, or every blob with --all.
+A removed blob is fetched from the registry again the next time an image containing it is pulled.
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.all == (len(args) > 0) {
+				return errors.Errorf("exactly one of a digest or --all must be set")
+			}
+			return runRm(opts, args)
+		},
+	}
+	opts.addStoreToFlags(cmd)
+	cmd.Flags().BoolVarP(&opts.all, "all", "", false, "remove every blob from the store")
+	return cmd
+}
+
+func runRm(opts blobsOptions, digests []string) error {
+	blobs := store.NewBlobStore(opts.storageDir)
+	var removed []digest.Digest
+	if opts.all {
+		stored, err := blobs.List()
+		if err != nil {
+			return err
+		}
+		for _, blob := range stored {
+			removed = append(removed, blob.Digest)
+		}
+	}
+	for _, d := range digests {
+		blobDigest, err := digest.Parse(d)
+		if err != nil {
+			return errors.Wrapf(err, "invalid digest %q", d)
+		}
+		removed = append(removed, blobDigest)
+	}
+
+	for _, blobDigest := range removed {
+		if err := blobs.Delete(blobDigest); err != nil {
+			return err
+		}
+		fmt.Printf("removed %v\n", blobDigest)
+	}
+	return nil
+}
+
+func writeBlobsTable(out io.Writer, blobs []store.Blob) error {
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 0, 0, ' ', 0)
+	fmt.Fprintf(w, "DIGEST \tSIZE \tSTORED\n")
+	for _, blob := range blobs {
+		fmt.Fprintf(w, "%v \t%v \t%v\n",
+			blob.Digest, blob.Size, duration.HumanDuration(time.Since(blob.Stored))+" ago")
+	}
+	return w.Flush()
+}
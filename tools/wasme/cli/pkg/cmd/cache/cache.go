@@ -6,8 +6,11 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 
 	"k8s.io/client-go/kubernetes"
@@ -15,9 +18,12 @@ import (
 
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cache"
 	pkgcache "github.com/solo-io/wasm/tools/wasme/pkg/cache"
+	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
+	"github.com/solo-io/wasm/tools/wasme/pkg/signature"
 
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cmd/opts"
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/defaults"
+	cliprogress "github.com/solo-io/wasm/tools/wasme/cli/pkg/progress"
 	"github.com/spf13/cobra"
 	"golang.org/x/sync/errgroup"
 )
@@ -29,6 +35,18 @@ type cacheOptions struct {
 	directory  string
 	refFile    string
 	clearCache bool
+	gcInterval time.Duration
+	gcGrace    time.Duration
+	// how the images listed in the ref file are pulled
+	watchOpts pkgcache.WatchOptions
+	// credentials for pulling from private registries
+	dockerConfigPath string
+	// serves the prometheus metrics of the cache, if non-zero
+	metricsPort int
+	// verify the signatures of the pulled images, if either is set
+	verifyKey         string
+	verifyRoots       string
+	verifyAnnotations map[string]string
 
 	kubeOpts kubeOpts
 
@@ -59,19 +77,68 @@ func CacheCmd(ctx *context.Context, loginOptions *opts.AuthOptions) *cobra.Comma
 		Hidden: true,
 	}
 
-	cmd.Flags().IntVarP(&opts.port, "port", "", 9979, "port")
+	cmd.Flags().IntVarP(&opts.port, "port", "", cache.ServerPort, "port to serve images on. the files written to --directory are served by digest at "+pkgcache.ModulesPath+"<digest>")
+	cmd.Flags().IntVarP(&opts.metricsPort, "metrics-port", "", cache.MetricsPort, "port to serve prometheus metrics on at /metrics. set to 0 to disable")
 	cmd.Flags().StringVarP(&opts.directory, "directory", "", "", "directory to write the refs we need to cache")
 	cmd.Flags().StringVarP(&opts.refFile, "ref-file", "", "", "file to watch for images we need to cache.")
 	cmd.Flags().BoolVarP(&opts.clearCache, "clear-cache", "", false, "clear any files from the cache dir on boot")
+	cmd.Flags().DurationVarP(&opts.gcInterval, "cache-gc-interval", "", time.Hour, "interval at which files of images no longer listed in the ref file are removed from the cache dir. set to 0 to disable")
+	cmd.Flags().DurationVarP(&opts.gcGrace, "cache-gc-grace", "", 24*time.Hour, "length of time a file must be unreferenced by the ref file before it is removed from the cache dir")
+	cmd.Flags().DurationVarP(&opts.watchOpts.ResyncInterval, "resync-interval", "", 10*time.Minute, "interval at which every image listed in the ref file is pulled again, writing files missing from the cache dir and retrying images whose retries stopped. set to 0 to disable")
+	cmd.Flags().DurationVarP(&opts.watchOpts.Backoff.Initial, "pull-retry-initial-delay", "", pkgcache.DefaultBackoff.Initial, "delay before retrying a failed image pull, doubled after each failed attempt")
+	cmd.Flags().DurationVarP(&opts.watchOpts.Backoff.Max, "pull-retry-max-delay", "", pkgcache.DefaultBackoff.Max, "maximum delay between retries of a failed image pull")
+	cmd.Flags().DurationVarP(&opts.watchOpts.Backoff.MaxElapsed, "pull-retry-max-elapsed", "", pkgcache.DefaultBackoff.MaxElapsed, "length of time a failed image pull is retried for, until the next resync. set to 0 to retry forever")
+	cmd.Flags().IntVarP(&opts.watchOpts.Concurrency, "pull-concurrency", "", 4, "maximum number of images listed in the ref file pulled at once")
+	cmd.Flags().BoolVarP(&opts.watchOpts.RemoveUnlisted, "remove-unlisted", "", true, "remove the file of an image from the cache dir as soon as it is no longer listed in the ref file, unless a listed image has the same digest. the files of images unlisted while the cache was not running are removed by the garbage collection")
+	cmd.Flags().StringVarP(&opts.dockerConfigPath, "docker-config-path", "", "", "path to a docker config file with the credentials for each registry host, e.g. the .dockerconfigjson key of a mounted kubernetes.io/dockerconfigjson secret. the file is read again when it changes")
+	cmd.Flags().StringVarP(&opts.verifyKey, "verify-key", "", "", "path to the PEM encoded public key of a cosign key pair. if set, images are only cached if a cosign signature made with the key is valid for the digest they resolve to when they are pulled")
+	cmd.Flags().StringVarP(&opts.verifyRoots, "verify-roots", "", "", "path to the PEM encoded root certificates of a Fulcio instance. if set, images are only cached if a keyless cosign signature whose certificate chains to the roots is valid for the digest they resolve to when they are pulled")
+	cmd.Flags().StringToStringVarP(&opts.verifyAnnotations, "verify-annotation", "", nil, "annotations which must be set to these values on the signed payload of the signatures verified with --verify-key or --verify-roots")
 	cmd.Flags().BoolVarP(&opts.kubeOpts.disableKube, "disable-kube", "", false, "disable sending events to kubernetes when images are pulled successfully")
 	cmd.Flags().StringVarP(&opts.kubeOpts.cacheNamespace, "cache-ns", "", cache.CacheNamespace, "namespace where the cache is running, if kube integration is enabled")
 	cmd.Flags().StringVarP(&opts.kubeOpts.cacheName, "cache-name", "", cache.CacheName, "name of the cache configmap")
+
+	cmd.AddCommand(StatusCmd(), PurgeCmd(), LsCmd(), RmCmd())
 	return cmd
 }
 
 func runCache(ctx context.Context, opts cacheOptions) error {
+	if err := opts.ReadPasswordStdin(os.Stdin); err != nil {
+		return err
+	}
+
+	// the cache logs the progress of pulls rather than rendering it
+	opts.AuthOptions.Progress = cliprogress.NewLogger(cliprogress.DefaultLogInterval)
+	// the cache stores the module of every image it pulls, so their blobs are fetched concurrently by the pull
+	opts.AuthOptions.Prefetch = true
+	puller, err := defaults.NewDefaultPullerWithAuth(opts.AuthOptions)
+	if err != nil {
+		return err
+	}
+	if opts.dockerConfigPath != "" {
+		puller, err = defaults.NewPullerWithDockerConfig(opts.dockerConfigPath, opts.AuthOptions)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(opts.dockerConfigPath); os.IsNotExist(err) {
+			logrus.Warnf("docker config %v does not exist, pulling images anonymously until it is created", opts.dockerConfigPath)
+		}
+	}
+	if opts.verifyKey != "" || opts.verifyRoots != "" {
+		puller, err = makeVerifyingPuller(puller, opts)
+		if err != nil {
+			return err
+		}
+	}
+	if opts.metricsPort != 0 {
+		metrics, err := cache.NewMetrics(prometheus.DefaultRegisterer, opts.directory)
+		if err != nil {
+			return err
+		}
+		puller = cache.NewInstrumentedPuller(puller, metrics)
+	}
+	imageCache := pkgcache.NewCache(puller)
 
-	imageCache := defaults.NewDefaultCacheWithAuth(opts.AuthOptions)
 	for _, image := range opts.targetRefs {
 		digest, err := imageCache.Add(context.TODO(), image)
 		if err != nil {
@@ -80,32 +147,80 @@ func runCache(ctx context.Context, opts cacheOptions) error {
 		fmt.Println("added digest", digest)
 	}
 
+	var fw pkgcache.LocalImagePuller
+	if opts.refFile != "" {
+		var err error
+		fw, err = makeLocalImagePuller(imageCache, opts)
+		if err != nil {
+			return err
+		}
+	}
+
 	errg, ctx := errgroup.WithContext(ctx)
 
 	if 0 != opts.port {
+		mux := http.NewServeMux()
+		mux.Handle("/", imageCache)
+		if fw != nil {
+			mux.Handle(pkgcache.ModulesPath, fw)
+		}
 		errg.Go(func() error {
-			return http.ListenAndServe(fmt.Sprintf(":%d", opts.port), imageCache)
+			return http.ListenAndServe(fmt.Sprintf(":%d", opts.port), mux)
 		})
 	}
-	if opts.refFile != "" {
+	if opts.metricsPort != 0 {
 		errg.Go(func() error {
-			return watchFile(ctx, imageCache, opts.refFile, opts.directory, opts.clearCache, opts.kubeOpts)
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", promhttp.Handler())
+			return http.ListenAndServe(fmt.Sprintf(":%d", opts.metricsPort), mux)
+		})
+	}
+	if fw != nil {
+		errg.Go(func() error {
+			return watchFile(ctx, fw, opts)
 		})
 	}
 	return errg.Wait()
 }
 
-func watchFile(ctx context.Context, imageCache pkgcache.Cache, refFile, directory string, clearCache bool, kubeOpts kubeOpts) error {
+// re-verifies the signatures of the images when they are pulled, so images whose tag was moved to
+// an unsigned image after they were deployed are not cached
+func makeVerifyingPuller(puller pull.ImagePuller, opts cacheOptions) (pull.ImagePuller, error) {
+	verifyOptions := signature.VerifyOptions{Annotations: opts.verifyAnnotations}
+	if opts.verifyKey != "" {
+		publicKey, err := ioutil.ReadFile(opts.verifyKey)
+		if err != nil {
+			return nil, err
+		}
+		verifyOptions.PublicKey = publicKey
+	}
+	if opts.verifyRoots != "" {
+		roots, err := ioutil.ReadFile(opts.verifyRoots)
+		if err != nil {
+			return nil, err
+		}
+		verifyOptions.Roots = roots
+	}
+	verifier, err := signature.NewVerifier(puller, verifyOptions)
+	if err != nil {
+		return nil, err
+	}
+	return signature.NewVerifyingPuller(puller, verifier), nil
+}
+
+func makeLocalImagePuller(imageCache pkgcache.Cache, opts cacheOptions) (pkgcache.LocalImagePuller, error) {
+	directory := opts.directory
+	kubeOpts := opts.kubeOpts
 
-	if clearCache {
+	if opts.clearCache {
 		cacheContents, err := ioutil.ReadDir(directory)
 		if err != nil {
-			return errors.Wrap(err, "reading cache dir")
+			return nil, errors.Wrap(err, "reading cache dir")
 		}
 		for _, file := range cacheContents {
 			logrus.Infof("removing cached file %v", file.Name())
 			if err := os.RemoveAll(file.Name()); err != nil {
-				return err
+				return nil, err
 			}
 		}
 	}
@@ -123,12 +238,21 @@ func watchFile(ctx context.Context, imageCache pkgcache.Cache, refFile, director
 
 	// for each ref in the file, add it to the cache,
 	// and if directory is not empty write it t here
-	fw := pkgcache.NewLocalImagePuller(
+	return pkgcache.NewLocalImagePuller(
 		imageCache,
-		refFile,
+		opts.refFile,
 		directory,
 		cacheNotifier,
-	)
+	), nil
+}
 
-	return fw.WatchFile(ctx)
+func watchFile(ctx context.Context, fw pkgcache.LocalImagePuller, opts cacheOptions) error {
+	errg, ctx := errgroup.WithContext(ctx)
+	errg.Go(func() error {
+		return fw.WatchFile(ctx, opts.watchOpts)
+	})
+	errg.Go(func() error {
+		return fw.CollectGarbage(ctx, opts.gcInterval, opts.gcGrace)
+	})
+	return errg.Wait()
 }
@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/solo-io/go-utils/kubeutils"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cache"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+)
+
+// the events of the cache instances may be published before the purge on clocks which are behind
+const purgeClockSkew = 5 * time.Second
+
+type purgeOptions struct {
+	cacheNamespace string
+	cacheName      string
+	images         []string
+	all            bool
+	timeout        time.Duration
+	pollInterval   time.Duration
+}
+
+func PurgeCmd() *cobra.Command {
+	var opts purgeOptions
+	cmd := &cobra.Command{
+		Use:   "purge [--image ref | --all]",
+		Short: "Remove images from the cache, waiting for each node running the cache to remove their files",
+		Long: `Remove images from the list of the cache configmap, and wait for the cache instance on each node to remove the files of the images from its cache directory.
+A file is kept while another listed image has the same digest.
+`,
+		Args: cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.all == (len(opts.images) > 0) {
+				return errors.Errorf("exactly one of --image or --all must be set")
+			}
+			return runPurge(opts)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.cacheNamespace, "cache-ns", "", cache.CacheNamespace, "namespace where the cache is running")
+	cmd.Flags().StringVarP(&opts.cacheName, "cache-name", "", cache.CacheName, "name of the cache configmap")
+	cmd.Flags().StringSliceVarP(&opts.images, "image", "", nil, "image to remove from the cache. may be repeated")
+	cmd.Flags().BoolVarP(&opts.all, "all", "", false, "remove every image from the cache")
+	cmd.Flags().DurationVarP(&opts.timeout, "timeout", "", time.Minute, "length of time to wait for the cache instances to remove the images. set to 0 to skip waiting")
+	cmd.Flags().DurationVarP(&opts.pollInterval, "poll-interval", "", time.Second, "interval between checks of the cache events while waiting")
+	return cmd
+}
+
+func runPurge(opts purgeOptions) error {
+	cfg, err := kubeutils.GetConfig("", "")
+	if err != nil {
+		return err
+	}
+	kube, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	nodes, err := cache.GetCacheNodes(kube, opts.cacheNamespace, opts.cacheName)
+	if err != nil {
+		return err
+	}
+	since := time.Now().Add(-purgeClockSkew)
+	purged, err := cache.PurgeImages(kube, opts.cacheNamespace, opts.cacheName, opts.images)
+	if err != nil {
+		return err
+	}
+	if len(purged) == 0 {
+		fmt.Println("no images are listed in the cache")
+		return nil
+	}
+	fmt.Printf("removed %v from the cache\n", strings.Join(purged, ", "))
+	if opts.timeout == 0 || len(nodes) == 0 {
+		return nil
+	}
+
+	timeout := time.After(opts.timeout)
+	reported := map[string]int{}
+	for {
+		removed, err := cache.GetRemovedImages(kube, opts.cacheNamespace, opts.cacheName, purged, since)
+		if err != nil {
+			return err
+		}
+		var pending []string
+		for _, node := range nodes {
+			count := len(removed[node])
+			if count != reported[node] {
+				fmt.Printf("%v: removed %v of %v images\n", node, count, len(purged))
+				reported[node] = count
+			}
+			if count < len(purged) {
+				pending = append(pending, node)
+			}
+		}
+		if len(pending) == 0 {
+			fmt.Printf("the images were removed on %v nodes\n", len(nodes))
+			return nil
+		}
+
+		select {
+		case <-timeout:
+			return errors.Errorf("timed out after %v waiting for the cache to remove the images on nodes %v",
+				opts.timeout, strings.Join(pending, ", "))
+		case <-time.After(opts.pollInterval):
+		}
+	}
+}
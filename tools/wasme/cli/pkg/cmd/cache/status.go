@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/solo-io/go-utils/kubeutils"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cache"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	outputTable = "table"
+	outputJson  = "json"
+)
+
+type statusOptions struct {
+	cacheNamespace string
+	cacheName      string
+	image          string
+	output         string
+}
+
+func StatusCmd() *cobra.Command {
+	var opts statusOptions
+	cmd := &cobra.Command{
+		Use:   "status [image]",
+		Short: "Print the state of each image listed in the cache on each node running the cache",
+		Long: `Print the state of each image listed in the cache configmap on each node running a cache pod, as reported by the events published by the cache:
+ready if the image was written to the cache directory of the node, pulling if the cache has not pulled it yet or retries a failed pull,
+and error if the cache stopped retrying until the next resync.
+`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 1 {
+				if opts.image != "" && opts.image != args[0] {
+					return errors.Errorf("cannot set both the image argument and --image")
+				}
+				opts.image = args[0]
+			}
+			return runStatus(opts)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.cacheNamespace, "cache-ns", "", cache.CacheNamespace, "namespace where the cache is running")
+	cmd.Flags().StringVarP(&opts.cacheName, "cache-name", "", cache.CacheName, "name of the cache configmap")
+	cmd.Flags().StringVarP(&opts.image, "image", "", "", "only print the status of this image")
+	cmd.Flags().StringVarP(&opts.output, "output", "o", outputTable, "output format, one of "+outputTable+", "+outputJson)
+	return cmd
+}
+
+func runStatus(opts statusOptions) error {
+	if opts.output != outputTable && opts.output != outputJson {
+		return errors.Errorf("invalid --output %v, must be %v or %v", opts.output, outputTable, outputJson)
+	}
+	cfg, err := kubeutils.GetConfig("", "")
+	if err != nil {
+		return err
+	}
+	kube, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+	status, err := cache.GetCacheStatus(kube, opts.cacheNamespace, opts.cacheName, opts.image)
+	if err != nil {
+		return err
+	}
+
+	if opts.output == outputJson {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(status)
+	}
+	return writeStatusTable(os.Stdout, status)
+}
+
+func writeStatusTable(out io.Writer, status *cache.CacheStatus) error {
+	fmt.Fprintf(out, "cache %v.%v: %v of %v instances ready\n", status.Name, status.Namespace, status.ReadyInstances, status.DesiredInstances)
+
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 0, 0, ' ', 0)
+	fmt.Fprintf(w, "NODE \tIMAGE \tDIGEST \tSTATE \tUPDATED \tLAST ERROR\n")
+	for _, image := range status.Images {
+		digest := strings.TrimPrefix(image.Digest, "sha256:")
+		if len(digest) > 8 {
+			digest = digest[:8]
+		}
+		updated := "-"
+		if image.LastUpdated != nil {
+			updated = duration.HumanDuration(time.Since(image.LastUpdated.Time)) + " ago"
+		}
+		fmt.Fprintf(w, "%v \t%v \t%v \t%v \t%v \t%v\n",
+			image.Node, image.Image, orNone(digest), image.State, updated, orNone(image.LastError))
+	}
+	return w.Flush()
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
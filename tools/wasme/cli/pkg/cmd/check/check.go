@@ -0,0 +1,219 @@
+package check
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/solo-io/gloo/projects/gloo/cli/pkg/helpers"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/abi"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cmd/opts"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
+	"github.com/solo-io/wasm/tools/wasme/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+const (
+	outputTable = "table"
+	outputJson  = "json"
+)
+
+type checkOptions struct {
+	refs            []string
+	istioVersions   []string
+	againstCluster  bool
+	istioNamespace  string
+	istioRevision   string
+	abiRegistryFile string
+	output          string
+	storageDir      string
+
+	*opts.AuthOptions
+}
+
+func CheckCmd(ctx *context.Context, loginOptions *opts.AuthOptions) *cobra.Command {
+	var opts checkOptions
+	opts.AuthOptions = loginOptions
+	cmd := &cobra.Command{
+		Use:   "check <name:tag|name@digest>... [--istio-version=ISTIO_VERSION]... [--against-cluster]",
+		Short: "Check the wasm images are compatible with Istio versions, without deploying them",
+		Long: `Check the ABI versions of each image are supported by each Istio version, as checked by wasme deploy istio.
+The Istio versions are set with --istio-version, or detected from the cluster with --against-cluster.
+Only the manifest and config of the images are fetched. Multi-variant images are compatible if one of their variants is.
+
+Exits with an error listing the incompatible images and Istio versions, if any. Images which declare no ABI versions
+are reported as unchecked, as their deployment skips the ABI check, and are not reported as incompatible.
+`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.refs = args
+			return runCheck(*ctx, opts)
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&opts.istioVersions, "istio-version", nil, "an Istio version to check the images against, e.g. 1.8.2. repeat to check several versions")
+	cmd.Flags().BoolVar(&opts.againstCluster, "against-cluster", false, "check the images against the Istio version installed in the cluster of the current kubeconfig context")
+	cmd.Flags().StringVar(&opts.istioNamespace, "istio-namespace", "istio-system", "the namespace where the Istio control plane is installed, used with --against-cluster")
+	cmd.Flags().StringVar(&opts.istioRevision, "istio-revision", "", "the revision of the Istio control plane to check against, used with --against-cluster")
+	cmd.Flags().StringVar(&opts.abiRegistryFile, "abi-registry-file", "", "path to a YAML file mapping abi versions to the istio versions which support them, e.g. '<abi version>: {istio: [1.9.x]}'. entries are merged into the built-in registry, taking precedence over conflicting entries.")
+	cmd.Flags().StringVarP(&opts.output, "output", "o", outputTable, "output format, one of "+outputTable+", "+outputJson)
+	cmd.Flags().StringVar(&opts.storageDir, "store", "", "Set the path to the local storage directory for wasm images. Defaults to $HOME/.wasme/store")
+
+	return cmd
+}
+
+// the compatibility of an image with an Istio version
+type result struct {
+	Image        string `json:"image"`
+	IstioVersion string `json:"istioVersion"`
+	// the ABI versions of the image, or of its compatible variant
+	AbiVersions []string `json:"abiVersions"`
+	// the digest of the variant of a multi-variant image compatible with the Istio version
+	Variant    string `json:"variant,omitempty"`
+	Compatible bool   `json:"compatible"`
+	// true if the image declares no ABI versions, so its deployment skips the ABI check
+	Unchecked bool `json:"unchecked,omitempty"`
+}
+
+func runCheck(ctx context.Context, opts checkOptions) error {
+	if opts.output != outputTable && opts.output != outputJson {
+		return errors.Errorf("invalid --output %v, must be %v or %v", opts.output, outputTable, outputJson)
+	}
+
+	registry := abi.DefaultRegistry
+	if opts.abiRegistryFile != "" {
+		customRegistry, err := abi.LoadRegistryFile(opts.abiRegistryFile)
+		if err != nil {
+			return err
+		}
+		registry = registry.Merge(customRegistry)
+	}
+
+	istioVersions, err := opts.getIstioVersions()
+	if err != nil {
+		return err
+	}
+
+	if err := opts.ReadPasswordStdin(os.Stdin); err != nil {
+		return err
+	}
+	inspector, err := opts.NewInspector(store.NewBlobStore(opts.storageDir))
+	if err != nil {
+		return err
+	}
+
+	var results []result
+	for _, ref := range opts.refs {
+		info, err := inspector.Inspect(ctx, ref)
+		if err != nil {
+			return errors.Wrapf(err, "fetching the config of image %v", ref)
+		}
+		for _, istioVersion := range istioVersions {
+			results = append(results, checkImage(registry, info, istioVersion))
+		}
+	}
+
+	if opts.output == outputJson {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			return err
+		}
+	} else if err := writeResultsTable(os.Stdout, results); err != nil {
+		return err
+	}
+
+	var incompatible []string
+	for _, result := range results {
+		if !result.Compatible {
+			incompatible = append(incompatible, result.Image+" with istio "+result.IstioVersion)
+		}
+	}
+	if len(incompatible) > 0 {
+		return errors.Errorf("%v incompatible: %v", len(incompatible), strings.Join(incompatible, ", "))
+	}
+	return nil
+}
+
+// returns the Istio versions set by the flags, or detected from the cluster
+func (opts checkOptions) getIstioVersions() ([]string, error) {
+	if opts.againstCluster == (len(opts.istioVersions) > 0) {
+		return nil, errors.Errorf("exactly one of --istio-version or --against-cluster must be set")
+	}
+	if !opts.againstCluster {
+		return opts.istioVersions, nil
+	}
+
+	kubeClient, err := helpers.KubeClient()
+	if err != nil {
+		return nil, err
+	}
+	istioVersion, err := istio.NewVersionInspector(kubeClient, opts.istioNamespace, opts.istioRevision, "").GetIstioVersion()
+	if err != nil {
+		return nil, errors.Wrap(err, "detecting the istio version of the cluster")
+	}
+	if istioVersion == "" {
+		return nil, errors.Errorf("istiod was not found in namespace %v", opts.istioNamespace)
+	}
+	return []string{istioVersion}, nil
+}
+
+// checks the image, or one of its variants, is compatible with the Istio version
+func checkImage(registry abi.Registry, info *pull.ImageInfo, istioVersion string) result {
+	checked := result{
+		Image:        info.Ref,
+		IstioVersion: istioVersion,
+	}
+
+	if len(info.Variants) == 0 {
+		checked.AbiVersions = info.Config.GetAbiVersions()
+		if len(checked.AbiVersions) == 0 {
+			checked.Compatible, checked.Unchecked = true, true
+			return checked
+		}
+		checked.Compatible = registry.ValidateIstioVersion(checked.AbiVersions, istioVersion) == nil
+		return checked
+	}
+
+	for _, variant := range info.Variants {
+		if len(variant.AbiVersions) == 0 || registry.ValidateIstioVersion(variant.AbiVersions, istioVersion) != nil {
+			checked.AbiVersions = append(checked.AbiVersions, variant.AbiVersions...)
+			continue
+		}
+		checked.AbiVersions = variant.AbiVersions
+		checked.Variant = variant.Manifest.Digest.String()
+		checked.Compatible = true
+		return checked
+	}
+	return checked
+}
+
+func writeResultsTable(out io.Writer, results []result) error {
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 0, 0, ' ', 0)
+
+	fmt.Fprintf(w, "IMAGE \tISTIO VERSION \tABI VERSIONS \tCOMPATIBLE\n")
+	for _, result := range results {
+		compatible := "no"
+		switch {
+		case result.Unchecked:
+			compatible = "unchecked, the image declares no abi versions"
+		case result.Variant != "":
+			compatible = "yes, variant " + result.Variant
+		case result.Compatible:
+			compatible = "yes"
+		}
+		abiVersions := strings.Join(result.AbiVersions, ", ")
+		if abiVersions == "" {
+			abiVersions = "-"
+		}
+		fmt.Fprintf(w, "%v \t%v \t%v \t%v\n", result.Image, result.IstioVersion, abiVersions, compatible)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,64 @@
+package check
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/abi"
+	"github.com/solo-io/wasm/tools/wasme/pkg/config"
+	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
+)
+
+var _ = Describe("Check", func() {
+	istio17Abi := abi.Version_4689a30309abf31aee9ae36e73d34b1bb182685f.Name
+	istio15Abi := abi.Version_097b7f2e4cc1fb490cc1943d0d633655ac3c522f.Name
+
+	makeInfo := func(abiVersions ...string) *pull.ImageInfo {
+		return &pull.ImageInfo{
+			Ref:    "filter/image:v1",
+			Config: &config.Runtime{AbiVersions: abiVersions},
+		}
+	}
+
+	It("checks the abi versions of the image are supported by the istio version", func() {
+		Expect(checkImage(abi.DefaultRegistry, makeInfo(istio17Abi), "1.8.2")).To(Equal(result{
+			Image:        "filter/image:v1",
+			IstioVersion: "1.8.2",
+			AbiVersions:  []string{istio17Abi},
+			Compatible:   true,
+		}))
+		Expect(checkImage(abi.DefaultRegistry, makeInfo(istio17Abi), "1.5.1").Compatible).To(BeFalse())
+	})
+
+	It("does not fail images which declare no abi versions", func() {
+		checked := checkImage(abi.DefaultRegistry, makeInfo(), "1.8.2")
+		Expect(checked.Compatible).To(BeTrue())
+		Expect(checked.Unchecked).To(BeTrue())
+	})
+
+	It("uses the mappings of the custom registry", func() {
+		custom, err := abi.ParseRegistry([]byte(istio17Abi + ":\n  istio:\n  - 1.9.x\n"))
+		Expect(err).NotTo(HaveOccurred())
+		registry := abi.DefaultRegistry.Merge(custom)
+
+		Expect(checkImage(abi.DefaultRegistry, makeInfo(istio17Abi), "1.9.0").Compatible).To(BeFalse())
+		Expect(checkImage(registry, makeInfo(istio17Abi), "1.9.0").Compatible).To(BeTrue())
+	})
+
+	It("selects the compatible variant of multi-variant images", func() {
+		info := makeInfo(istio15Abi)
+		info.Variants = []pull.Variant{
+			{Manifest: ocispec.Descriptor{Digest: "sha256:aaaa"}, AbiVersions: []string{istio15Abi}},
+			{Manifest: ocispec.Descriptor{Digest: "sha256:bbbb"}, AbiVersions: []string{istio17Abi}},
+		}
+
+		checked := checkImage(abi.DefaultRegistry, info, "1.7.3")
+		Expect(checked.Compatible).To(BeTrue())
+		Expect(checked.Variant).To(Equal("sha256:bbbb"))
+		Expect(checked.AbiVersions).To(Equal([]string{istio17Abi}))
+
+		checked = checkImage(abi.DefaultRegistry, info, "1.4.0")
+		Expect(checked.Compatible).To(BeFalse())
+		Expect(checked.AbiVersions).To(Equal([]string{istio15Abi, istio17Abi}))
+	})
+})
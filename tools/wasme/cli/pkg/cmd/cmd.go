@@ -7,13 +7,18 @@ import (
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/defaults"
 
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cmd/tag"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cmd/tags"
 
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cmd/operator"
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cmd/abi"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cmd/archive"
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cmd/build"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cmd/check"
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cmd/deploy"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cmd/describe"
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cmd/initialize"
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cmd/list"
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/version"
@@ -46,7 +51,7 @@ func Cmd() *cobra.Command {
 			}
 			// set default auth configs
 			if len(auth.CredentialsFiles) == 0 {
-				auth.CredentialsFiles = []string{defaults.WasmeCredentialsFile}
+				auth.CredentialsFiles = []string{defaults.WasmeCredentialsFile, defaults.DockerConfigFile}
 			}
 		},
 	}
@@ -55,21 +60,34 @@ func Cmd() *cobra.Command {
 		push.PushCmd(ctx, &auth),
 		pull.PullCmd(ctx, &auth),
 		cache.CacheCmd(ctx, &auth),
+		archive.LoadCmd(ctx, &auth),
+		describe.DescribeCmd(ctx, &auth),
+		check.CheckCmd(ctx, &auth),
+		tags.TagsCmd(ctx, &auth),
+		tag.TagCmd(ctx, &auth),
+		tag.CopyCmd(ctx, &auth),
 	}
 
 	for _, cmd := range commandsWithAuth {
 		auth.AddToFlags(cmd.PersistentFlags())
 	}
 
+	listCmd := list.ListCmd()
+	listCmd.AddCommand(deploy.ListDeployedCmd(ctx))
+
 	commands := append(commandsWithAuth,
 		initialize.InitCmd(),
 		build.BuildCmd(ctx),
 		login.LoginCmd(),
-		list.ListCmd(),
+		login.LogoutCmd(),
+		listCmd,
 		deploy.DeployCmd(ctx, cmd.PersistentPreRun),
 		deploy.UndeployCmd(ctx),
+		deploy.RevertCmd(ctx),
+		deploy.DoctorCmd(ctx),
 		operator.OperatorCmd(ctx),
-		tag.TagCmd(ctx))
+		archive.SaveCmd(ctx),
+		abi.AbiCmd())
 
 	cmd.AddCommand(
 		commands...,
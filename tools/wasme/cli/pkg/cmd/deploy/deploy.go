@@ -9,17 +9,17 @@ import (
 	"os"
 	"strings"
 
-	"github.com/gogo/protobuf/types"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/local"
 	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
 	"github.com/solo-io/wasm/tools/wasme/pkg/store"
 
-	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
-	"github.com/solo-io/gloo/projects/gloo/cli/pkg/helpers"
-	cachedeployment "github.com/solo-io/wasm/tools/wasme/cli/pkg/cache"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 )
@@ -29,7 +29,7 @@ var log = logrus.StandardLogger()
 func DeployCmd(ctx *context.Context, parentPreRun func(cmd *cobra.Command, args []string)) *cobra.Command {
 	opts := &options{}
 	cmd := &cobra.Command{
-		Use:   "deploy gloo|istio|envoy <image> --id=<unique id> [--config=<inline string>] [--root-id=<root id>]",
+		Use:   "deploy gloo|istio|envoy|envoy-k8s <image> --id=<unique id> [--config=<inline string>] [--root-id=<root id>]",
 		Short: "Deploy an Envoy WASM Filter to the data plane (Envoy proxies).",
 		Long: `Deploys an Envoy WASM Filter to Envoy instances.
 
@@ -50,10 +50,14 @@ You must specify --root-id unless a default root id is provided in the image con
 	}
 	opts.addToFlags(cmd.PersistentFlags())
 
+	istioCmd := deployIstioCmd(ctx, opts)
+	istioCmd.AddCommand(setConfigCmd(ctx, opts, parentPreRun))
+
 	cmd.AddCommand(
 		deployGlooCmd(ctx, opts),
-		deployIstioCmd(ctx, opts),
+		istioCmd,
 		deployLocalCmd(ctx, opts),
+		deployEnvoyK8sCmd(ctx, opts),
 	)
 
 	return cmd
@@ -69,26 +73,23 @@ func makeDeployCommand(ctx *context.Context, opts *options, provider, use, short
 			if opts.filter.Id == "" {
 				return errors.Errorf("--id cannot be empty")
 			}
+			if err := opts.ReadPasswordStdin(os.Stdin); err != nil {
+				return err
+			}
 			opts.providerType = provider
-			// If we were passed a config via CLI flag, default config type to StringValue
-			if opts.filterConfig != "" {
-				sv := &types.StringValue{
-					Value: opts.filterConfig,
-				}
-				val, err := sv.Marshal()
-				if err != nil {
-					return errors.Errorf("--config value could not be parsed")
-				}
-				opts.filter.Config = &types.Any{
-					TypeUrl: "type.googleapis.com/google.protobuf.StringValue",
-					Value:   val,
-				}
+			if err := opts.setFilterConfig(); err != nil {
+				return err
 			}
 			return runDeploy(*ctx, opts)
 		},
 	}
 
 	opts.addToFlags(cmd.PersistentFlags())
+	opts.eventOpts.addToFlags(cmd.PersistentFlags())
+	opts.addNoCacheToFlags(cmd.PersistentFlags())
+	opts.AddCredentialsToFlags(cmd.PersistentFlags())
+	opts.AddRegistryToFlags(cmd.PersistentFlags())
+	opts.AddProgressToFlags(cmd.PersistentFlags())
 
 	for _, f := range addFlags {
 		f(cmd.PersistentFlags())
@@ -98,7 +99,7 @@ func makeDeployCommand(ctx *context.Context, opts *options, provider, use, short
 }
 
 func deployGlooCmd(ctx *context.Context, opts *options) *cobra.Command {
-	use := "gloo <image> --id=<unique name> [--config=<inline string>] [--root-id=<root id>] [--namespaces <comma separated namespaces>] [--labels <key1=val1,key2=val2>]"
+	use := "gloo <image> --id=<unique name> [--config=<inline string>] [--root-id=<root id>] [--namespaces <comma separated namespaces>] [--gateway-name <comma separated names>] [--gateway-labels <key1=val1,key2=val2>]"
 	short := "Deploy an Envoy WASM Filter to the Gloo Gateway Proxies (Envoy)."
 	long := `Deploys an Envoy WASM Filter to Gloo Gateway Proxies.
 
@@ -106,7 +107,11 @@ wasme uses the Gloo Gateway CR to pull and run wasm filters.
 
 Use --namespaces to constrain the namespaces of Gateway CRs to update.
 
-Use --labels to use a match Gateway CRs by label.
+Use --gateway-name and --gateway-labels to match Gateway CRs by name and by label.
+The command fails if no Gateway CR matches.
+
+The abi versions of the filter image are checked against the version of Gloo installed in --gloo-namespace.
+Use --ignore-version-check to deploy the filter without the check.
 `
 	return makeDeployCommand(ctx, opts,
 		Provider_Gloo,
@@ -115,11 +120,12 @@ Use --labels to use a match Gateway CRs by label.
 		long,
 		1,
 		opts.glooOpts.addToFlags,
+		opts.glooOpts.addVersionCheckToFlags,
 	)
 }
 
 func deployIstioCmd(ctx *context.Context, opts *options) *cobra.Command {
-	use := "istio <image> --id=<unique name> [--config=<inline string>] [--root-id=<root id>] [--namespaces <comma separated namespaces>] [--name deployment-name] [--patch-context={any|inbound|outbound|gateway}]"
+	use := "istio <image> --id=<unique name> [--config=<inline string>] [--root-id=<root id>] [--namespaces <comma separated namespaces>] [--name deployment-name] [--patch-context={any|inbound|outbound|gateway}] [--dry-run]"
 	short := "Deploy an Envoy WASM Filter to Istio Sidecar Proxies (Envoy)."
 	long := `Deploy an Envoy WASM Filter to Istio Sidecar Proxies (Envoy).
 
@@ -128,6 +134,10 @@ wasme deploys a server-side cache component which runs in cluster and pulls filt
 
 If --name is not provided, all deployments in the targeted namespace will attach the filter.
 
+Use --dry-run with --name to print the EnvoyFilter, the patch of the workload annotations and the cache
+config as YAML instead of deploying the filter, e.g. to commit them to a GitOps repository. The cluster is
+only read to detect the Istio version, unless --istio-version is set.
+
 Note: currently only Istio 1.5.x - 1.8.x are supported.
 `
 	cmd := makeDeployCommand(ctx, opts,
@@ -139,25 +149,65 @@ Note: currently only Istio 1.5.x - 1.8.x are supported.
 		opts.istioOpts.addToFlags,
 		opts.cacheOpts.addToFlags,
 	)
+	// not inherited by set-config, which patches the deployed filter
+	opts.addDryRunToFlags(cmd.Flags())
 
 	cmd.PreRunE = func(cmd *cobra.Command, args []string) error {
 		opts.filter.PatchContext = opts.istioOpts.patchContext
-		cacheDeployer := cachedeployment.NewDeployer(
-			helpers.MustKubeClient(),
-			opts.cacheOpts.namespace,
-			opts.cacheOpts.name,
-			opts.cacheOpts.imageRepo,
-			opts.cacheOpts.imageTag,
-			opts.cacheOpts.customArgs,
-			corev1.PullPolicy(opts.cacheOpts.pullPolicy),
-		)
-
-		return cacheDeployer.EnsureCache()
+		opts.filter.FilterType = opts.istioOpts.filterType
+		opts.filter.OrderBefore = opts.istioOpts.orderBefore
+		opts.filter.OrderAfter = opts.istioOpts.orderAfter
+		configFrom, err := opts.istioOpts.configFrom()
+		if err != nil {
+			return err
+		}
+		opts.filter.ConfigFrom = configFrom
+		if opts.dryRun {
+			return nil
+		}
+		if strings.ToLower(opts.cacheOpts.kind) == istio.WorkloadTypeDeployment {
+			log.Infof("cache kind is %v, skipping cache installation", opts.cacheOpts.kind)
+			return nil
+		}
+		return opts.ensureCaches(func(cfg *rest.Config) (kubernetes.Interface, error) {
+			return kubernetes.NewForConfig(cfg)
+		})
 	}
 
 	return cmd
 }
 
+func deployEnvoyK8sCmd(ctx *context.Context, opts *options) *cobra.Command {
+	use := "envoy-k8s <image> --id=<unique name> --deployment=<deployment name> --configmap=<bootstrap configmap> [--namespace=<namespace>] [--listener=<listener name>] [--module-source={init-container|host-path}]"
+	short := "Deploy an Envoy WASM Filter to a Deployment of Envoy configured by a static bootstrap config."
+	long := `Deploys an Envoy WASM Filter to a Deployment of Envoy which runs without a control plane,
+configured by a bootstrap config held in a ConfigMap.
+
+The filter is added before the router of the http_connection_manager of each static listener of the bootstrap
+config, or of the listeners selected with --listener. A filter with the same --id is replaced.
+
+The module of the filter is mounted into the Envoy container. By default, an init container pulls the image,
+pinned to its digest, into an emptyDir volume. With --module-source=host-path, the directory the wasme cache
+writes the modules to is mounted from the hosts instead, so the wasme cache must run on the nodes of the pods and
+have cached the image.
+
+The pod template of the Deployment is annotated with a hash of the bootstrap config, so the pods are restarted
+with the updated config.
+`
+	cmd := makeDeployCommand(ctx, opts,
+		Provider_EnvoyK8s,
+		use,
+		short,
+		long,
+		1,
+		opts.envoyK8sOpts.addToFlags,
+	)
+	cmd.PreRunE = func(cmd *cobra.Command, args []string) error {
+		return opts.envoyK8sOpts.validate()
+	}
+	return cmd
+}
+
 func deployLocalCmd(ctx *context.Context, opts *options) *cobra.Command {
 	use := "envoy <image> [--config=<filter config>] [--bootstrap=<custom envoy bootstrap file>] [--envoy-image=<custom envoy image>]"
 	short := "Run Envoy locally in Docker and attach a WASM Filter."
@@ -168,6 +218,12 @@ the specified WASM filter image.
 The bootstrap can be generated from an internal default or a modified config provided by the user with --bootstrap.
 
 The generated bootstrap config can be output to a file with --out. If using this option, Envoy will not be started locally.
+
+Alternatively, --compose-out writes the generated bootstrap config, the filter module and a docker-compose.yaml running 
+Envoy to a directory, which can be started with docker-compose up. --bootstrap-only writes them to the current directory.
+
+With --watch, the filter is reloaded in the running Envoy whenever its module or config changes. 
+The listeners are served to Envoy from a watched file, which is rewritten with the new filter on each change.
 `
 
 	cmd := &cobra.Command{
@@ -177,29 +233,85 @@ The generated bootstrap config can be output to a file with --out. If using this
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			opts.filter.Image = args[0]
-			return runLocalEnvoy(*ctx, opts.filter, opts.localOpts)
+			if opts.localOpts.infile != "" {
+				for _, flag := range []string{"port", "admin-port", "upstream"} {
+					if cmd.Flags().Changed(flag) {
+						return errors.Errorf("--%v cannot be used with --bootstrap, it only configures the default bootstrap config", flag)
+					}
+				}
+			}
+			if opts.localOpts.istioProxyVersion != "" {
+				if cmd.Flags().Changed("envoy-image") {
+					return errors.Errorf("only one of --envoy-image or --istio-proxy-version may be set")
+				}
+				if opts.localOpts.watch {
+					return errors.Errorf("--watch cannot be used with --istio-proxy-version")
+				}
+				opts.localOpts.envoyDockerImage = local.IstioProxyImage + ":" + opts.localOpts.istioProxyVersion
+			}
+			if opts.localOpts.watch && (opts.localOpts.outfile != "" || opts.localOpts.composeDir() != "") {
+				return errors.Errorf("--watch cannot be used with --out or --compose-out")
+			}
+			var puller pull.ImagePuller
+			if opts.localOpts.composeDir() != "" {
+				if opts.localOpts.outfile != "" {
+					return errors.Errorf("only one of --out or --compose-out may be set")
+				}
+				if err := opts.ReadPasswordStdin(os.Stdin); err != nil {
+					return err
+				}
+				// the bundle is self-contained, so the image is pulled for it if needed
+				var err error
+				puller, err = opts.makePuller()
+				if err != nil {
+					return err
+				}
+			}
+			return runLocalEnvoy(*ctx, opts.filter, opts.localOpts, puller)
 		},
 	}
 
 	opts.localOpts.addToFlags(cmd.Flags())
+	// used to pull the image for --compose-out
+	opts.addNoCacheToFlags(cmd.Flags())
+	opts.AddCredentialsToFlags(cmd.Flags())
+	opts.AddRegistryToFlags(cmd.Flags())
 
 	return cmd
 }
 
 func runDeploy(ctx context.Context, opts *options) error {
+	if opts.providerType == Provider_Istio && !opts.remove {
+		if err := istio.Validate(&opts.filter); err != nil {
+			return err
+		}
+	}
+
 	deployer, err := makeDeployer(ctx, opts)
 	if err != nil {
 		return err
 	}
 
 	if opts.remove {
-		return deployer.RemoveFilter(&opts.filter)
+		err = deployer.RemoveFilter(&opts.filter)
+	} else {
+		err = deployer.ApplyFilter(&opts.filter)
+		if err == nil && opts.providerType == Provider_Istio && !opts.dryRun {
+			fmt.Println(opts.istioOpts.summary.String())
+		}
 	}
 
-	return deployer.ApplyFilter(&opts.filter)
+	if deployer.Events != nil {
+		// the event is sent in the background, wait for it before exiting
+		if flushErr := deployer.Events.Flush(opts.eventOpts.timeout); flushErr != nil {
+			log.WithError(flushErr).Warnf("failed to send event to %v", opts.eventOpts.sink)
+		}
+	}
+
+	return err
 }
 
-func runLocalEnvoy(ctx context.Context, filter v1.FilterSpec, opts localOpts) error {
+func runLocalEnvoy(ctx context.Context, filter v1.FilterSpec, opts localOpts, puller pull.ImagePuller) error {
 	in, err := func() (io.ReadCloser, error) {
 		switch opts.infile {
 		case "-":
@@ -207,7 +319,11 @@ func runLocalEnvoy(ctx context.Context, filter v1.FilterSpec, opts localOpts) er
 			return os.Stdin, nil
 		case "":
 			// use default config
-			return ioutil.NopCloser(bytes.NewBuffer([]byte(local.BasicEnvoyConfig))), nil
+			bootstrap, err := opts.renderBootstrap()
+			if err != nil {
+				return nil, err
+			}
+			return ioutil.NopCloser(bytes.NewBuffer([]byte(bootstrap))), nil
 		default:
 			// read file
 			return os.Open(opts.infile)
@@ -252,7 +368,17 @@ func runLocalEnvoy(ctx context.Context, filter v1.FilterSpec, opts localOpts) er
 		DockerRunArgs:    parseArgs(opts.dockerRunArgs),
 		EnvoyArgs:        parseArgs(opts.envoyArgs),
 		EnvoyDockerImage: opts.envoyDockerImage,
+		ComposeDir:       opts.composeDir(),
+		InlineFilter:     opts.inlineFilter,
+		Puller:           puller,
+		IstioVersion:     opts.istioProxyVersion,
+	}
+	if opts.watch {
+		runner.Watch = &opts.watchOpts
+	}
+	if opts.printConfig {
+		runner.PrintConfig = os.Stdout
 	}
 
-	return runner.RunFilter(&filter)
+	return runner.ApplyFilter(&filter)
 }
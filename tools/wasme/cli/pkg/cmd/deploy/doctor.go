@@ -0,0 +1,63 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	"github.com/spf13/cobra"
+)
+
+func DoctorCmd(ctx *context.Context) *cobra.Command {
+	opts := &options{}
+	var fixBackups bool
+	cmd := &cobra.Command{
+		Use:   "doctor [--namespace=<workload namespace>] [--fix-backups]",
+		Short: "Check the Istio workloads for wasme annotations which would be restored incorrectly.",
+		Long: `Scans the selected workloads for problems with the annotations written by wasme when deploying a filter to Istio.
+
+Backups of the sidecar annotations (wasme-backup.*) are restored when the filter is undeployed. doctor reports:
+- stale backups, left behind while the sidecar annotations written by wasme are no longer applied
+- self-referential backups, which contain the values written by wasme, e.g. after a filter was deployed twice by an older version of wasme
+- workloads missing the wasme-applied marker which prevents wasme from backing up its own values
+
+Set --fix-backups to repair the problems.
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			provider, err := opts.makeIstioProvider(*ctx)
+			if err != nil {
+				return err
+			}
+			problems, err := provider.CheckBackups(fixBackups)
+			if err != nil {
+				return err
+			}
+			printProblems(cmd, problems, fixBackups)
+			return nil
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringToStringVarP(&opts.istioOpts.workload.Labels, "labels", "l", nil, "labels of the workloads to check. if not set, will check all workloads in the target namespace")
+	flags.StringVarP(&opts.istioOpts.workload.Namespace, "namespace", "n", "default", "namespace of the workload(s) to check.")
+	flags.StringVarP(&opts.istioOpts.workload.Kind, "workload-type", "t", istio.WorkloadTypeDeployment, "type of workload to check. possible values are "+strings.Join(SupportedWorkloadTypes, ", "))
+	flags.BoolVar(&fixBackups, "fix-backups", false, "repair the problems found with the backup annotations on the workloads.")
+
+	return cmd
+}
+
+func printProblems(cmd *cobra.Command, problems []istio.BackupProblem, fixed bool) {
+	out := cmd.OutOrStdout()
+	if len(problems) == 0 {
+		fmt.Fprintln(out, "no problems found")
+		return
+	}
+	for _, problem := range problems {
+		fmt.Fprintf(out, "%v: %v: %v\n", problem.Workload, problem.Annotation, problem.Problem)
+	}
+	if fixed {
+		fmt.Fprintf(out, "repaired %v problem(s)\n", len(problems))
+	} else {
+		fmt.Fprintln(out, "run with --fix-backups to repair")
+	}
+}
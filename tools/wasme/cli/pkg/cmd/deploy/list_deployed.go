@@ -0,0 +1,145 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	"github.com/spf13/cobra"
+)
+
+// ListDeployedCmd returns the command listing the filters deployed by wasme, added to wasme list
+func ListDeployedCmd(ctx *context.Context) *cobra.Command {
+	opts := &options{
+		listFilters: true,
+	}
+	cmd := &cobra.Command{
+		Use:   "deployed gloo|istio|envoy-k8s [--id-prefix=<prefix>] [--verify]",
+		Short: "List the Envoy WASM Filters deployed by wasme to the data plane (Envoy proxies).",
+		Long: `Lists the filters deployed by wasme, with the workloads they are deployed to and their images.
+
+Use --id-prefix to list the filters whose id starts with the prefix.
+
+Set --verify to check that the proxies run each filter. Verifying the filters is only supported by the gloo provider.
+`,
+	}
+	cmd.PersistentFlags().StringVar(&opts.removeIdPrefix, "id-prefix", "", "list the filters whose id starts with this prefix. if not set, every filter deployed by wasme is listed.")
+	cmd.PersistentFlags().BoolVar(&opts.verify, "verify", false, "check that the proxies run each filter with the module of its image.")
+
+	cmd.AddCommand(
+		listDeployedGlooCmd(ctx, opts),
+		listDeployedIstioCmd(ctx, opts),
+		listDeployedEnvoyK8sCmd(ctx, opts),
+	)
+	return cmd
+}
+
+func listDeployedGlooCmd(ctx *context.Context, opts *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "gloo [--verify]",
+		Short: "List the Envoy WASM Filters deployed by wasme to the Gloo Gateway Proxies (Envoy).",
+		Long: `Lists the filters recorded on the Gateway CRs by wasme deploy gloo.
+
+Use --namespaces, --gateway-name and --gateway-labels to select the Gateway CRs.
+
+Set --verify to check that the gateway proxies of each Gateway run the filter: the config_dump of the
+proxies is read through a port-forward to their admin port (run with kubectl), and the module of the
+filter is compared to the digest of its image.
+`,
+		Args: cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.verify {
+				if err := opts.ReadPasswordStdin(os.Stdin); err != nil {
+					return err
+				}
+				// the image of each filter is pulled for its digest
+				puller, err := opts.makePuller()
+				if err != nil {
+					return err
+				}
+				opts.glooOpts.puller = puller
+			}
+			return runListDeployed(*ctx, opts, Provider_Gloo)
+		},
+	}
+	opts.glooOpts.addToFlags(cmd.Flags())
+	opts.AddCredentialsToFlags(cmd.Flags())
+	opts.addNoCacheToFlags(cmd.Flags())
+	return cmd
+}
+
+func listDeployedIstioCmd(ctx *context.Context, opts *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "istio [--namespace=<workload namespace>] [--name=<workload name>]",
+		Short: "List the Envoy WASM Filters deployed by wasme to the Istio Sidecar Proxies (Envoy).",
+		Long: `Lists the filters deployed by wasme deploy istio to the selected workloads, with their EnvoyFilter CRs.
+`,
+		Args: cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runListDeployed(*ctx, opts, Provider_Istio)
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringVar(&opts.istioOpts.workload.Name, "name", "", "name of the workload to list the filters of. if not set, will list the filters of all workloads selected by --labels in the target namespace.")
+	flags.StringToStringVarP(&opts.istioOpts.workload.Labels, "labels", "l", nil, "labels of the workloads to list the filters of. if not set, will list the filters of all workloads in the target namespace")
+	flags.StringVarP(&opts.istioOpts.workload.Namespace, "namespace", "n", "default", "namespace of the workload(s) to list the filters of.")
+	flags.StringVarP(&opts.istioOpts.workload.Kind, "workload-type", "t", istio.WorkloadTypeDeployment, "type of workload to list the filters of. possible values are "+strings.Join(SupportedWorkloadTypes, ", "))
+	flags.StringVar(&opts.istioOpts.istioNamespace, "istio-namespace", "istio-system", "the namespace where the Istio control plane is installed")
+	flags.StringArrayVar(&opts.istioOpts.contexts, "context", nil, "kubeconfig context of a cluster to list the filters of, in the format <context>[=<istio namespace>]. repeat to list the filters of several clusters, with the cluster of each filter. if not set, the current context is used.")
+	return cmd
+}
+
+func listDeployedEnvoyK8sCmd(ctx *context.Context, opts *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "envoy-k8s --deployment=<deployment name> [--namespace=<namespace>]",
+		Short: "List the Envoy WASM Filters deployed by wasme to a Deployment of Envoy configured by a static bootstrap config.",
+		Long: `Lists the filters recorded on the Deployment by wasme deploy envoy-k8s.
+`,
+		Args: cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// the filters are read from the Deployment, so the bootstrap ConfigMap need not be set
+			if opts.envoyK8sOpts.deployment.Name == "" {
+				return errors.Errorf("--deployment cannot be empty")
+			}
+			return runListDeployed(*ctx, opts, Provider_EnvoyK8s)
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringVar(&opts.envoyK8sOpts.deployment.Name, "deployment", "", "name of the Deployment running Envoy to list the filters of. required.")
+	flags.StringVarP(&opts.envoyK8sOpts.deployment.Namespace, "namespace", "n", "default", "namespace of the Deployment.")
+	return cmd
+}
+
+func runListDeployed(ctx context.Context, opts *options, providerType string) error {
+	opts.providerType = providerType
+	provider, err := opts.makeProvider(ctx)
+	if err != nil {
+		return err
+	}
+	if err := opts.checkCapabilities(provider); err != nil {
+		return err
+	}
+
+	var filters []deploy.DeployedFilter
+	if opts.verify {
+		filters, err = provider.Verify(opts.removeIdPrefix)
+	} else {
+		filters, err = provider.ListFilters(opts.removeIdPrefix)
+	}
+	if err != nil {
+		return err
+	}
+	if len(filters) == 0 {
+		if opts.removeIdPrefix != "" {
+			fmt.Printf("no filters with an id starting with %v were found\n", opts.removeIdPrefix)
+		} else {
+			fmt.Printf("no filters deployed by wasme were found\n")
+		}
+		return nil
+	}
+	return deploy.PrintDeployedFilters(os.Stdout, filters)
+}
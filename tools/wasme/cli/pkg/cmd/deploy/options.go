@@ -2,29 +2,39 @@ package deploy
 
 import (
 	"context"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"strings"
 	"time"
 
+	envoyfilter "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/filter"
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/local"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
-	"github.com/solo-io/skv2/pkg/ezkube"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
-	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"k8s.io/client-go/rest"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	gatewayv1 "github.com/solo-io/gloo/projects/gateway/pkg/api/v1"
 	"github.com/solo-io/gloo/projects/gloo/cli/pkg/helpers"
 	"github.com/solo-io/go-utils/kubeutils"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/abi"
 	cachedeployment "github.com/solo-io/wasm/tools/wasme/cli/pkg/cache"
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cmd/opts"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/defaults"
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy"
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/gloo"
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/standalone"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/events"
 	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
 	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
-	"github.com/solo-io/wasm/tools/wasme/pkg/resolver"
+	"github.com/solo-io/wasm/tools/wasme/pkg/signature"
+	"github.com/solo-io/wasm/tools/wasme/pkg/store"
 	"github.com/spf13/pflag"
 )
 
@@ -34,6 +44,8 @@ type options struct {
 
 	// configuration string for filter
 	filterConfig string
+	// path to a JSON or YAML file containing the configuration object of the filter
+	filterConfigFile string
 
 	// deployment implementation
 	providerOptions
@@ -46,14 +58,65 @@ type options struct {
 
 	// remove a deployed filter instead of deploying
 	remove bool
+
+	// remove the filters deployed from this image instead of by id
+	removeImage string
+
+	// remove every filter whose id starts with this prefix instead of by id, every filter if removeAll is set.
+	// when listing the filters, only the filters whose id starts with the prefix are listed
+	removeIdPrefix string
+	removeAll      bool
+
+	// list the deployed filters instead of deploying, verifying they are active if verify is set
+	listFilters bool
+	verify      bool
+
+	// emit lifecycle events
+	eventOpts eventOpts
+
+	// fetch every blob of the image from the registry instead of the local blob store
+	noCache bool
 }
 
 func (opts *options) addToFlags(flags *pflag.FlagSet) {
 	flags.StringVarP(&opts.filterConfig, "config", "", "", "optional config that will be passed to the filter. accepts an inline string.")
-	flags.StringVarP(&opts.filter.RootID, "root-id", "", "", "optional root ID used to bind the filter at the Envoy level. this value is normally read from the filter image directly.")
+	flags.StringVar(&opts.filterConfigFile, "config-file", "", "path to a JSON or YAML file containing the config of the filter, which must be an object. the config is passed to the proxy as a google.protobuf.Struct, which the proxy serializes as JSON for the filter, rather than as a string. cannot be used with --config.")
+	flags.BoolVar(&opts.filter.ConfigChecksum, "config-checksum", false, "inject a sha256 checksum of the filter config into the config under the "+envoyfilter.ConfigChecksumKey+" key. the config must be empty or a JSON object.")
+	flags.StringVarP(&opts.filter.RootID, "root-id", "", "", "optional root ID used to bind the filter at the Envoy level. this value is normally read from the filter image directly, and defaults to the --id if the image does not declare one. unlike the --id, it may be any string accepted by the proxy.")
+	flags.BoolVar(&opts.filter.AllowPrecompiled, "allow-precompiled", false, "set allow_precompiled on the VM config of the filter, so the proxy may use a precompiled version of the module embedded in the image. not supported when deploying to gloo.")
+	flags.StringToStringVar(&opts.filter.Env, "env", nil, "environment variables exposed to the VM of the filter, in the format KEY=VALUE. names may only contain letters, digits and '_', and the "+envoyfilter.ReservedEnvPrefix+" prefix is reserved. requires Istio 1.9+, or Envoy 1.17+ with a v3 bootstrap config; not supported when deploying to gloo.")
 	opts.addIdToFlags(flags)
 }
 
+// sets the config of the filter from --config, as a string, or --config-file, as an object
+func (opts *options) setFilterConfig() error {
+	if opts.filterConfig != "" && opts.filterConfigFile != "" {
+		return errors.Errorf("--config and --config-file cannot be used together")
+	}
+	var err error
+	switch {
+	case opts.filterConfig != "":
+		opts.filter.Config, err = envoyfilter.MakeStringConfig(opts.filterConfig)
+		if err != nil {
+			return errors.Errorf("--config value could not be parsed")
+		}
+	case opts.filterConfigFile != "":
+		content, err := ioutil.ReadFile(opts.filterConfigFile)
+		if err != nil {
+			return errors.Wrap(err, "reading --config-file")
+		}
+		opts.filter.Config, err = envoyfilter.MakeStructConfig(content)
+		if err != nil {
+			return errors.Wrapf(err, "invalid --config-file %v", opts.filterConfigFile)
+		}
+	}
+	return nil
+}
+
+func (opts *options) addNoCacheToFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&opts.noCache, "no-cache", false, "fetch every blob of the filter image from the registry, rather than reading the blobs which did not change from $HOME/.wasme/store")
+}
+
 func (opts *options) addDryRunToFlags(flags *pflag.FlagSet) {
 	flags.BoolVarP(&opts.dryRun, "dry-run", "", false, "print output any configuration changes to stdout rather than applying them to the target file / kubernetes cluster")
 }
@@ -69,96 +132,303 @@ type providerOptions struct {
 	localOpts localOpts
 	istioOpts istioOpts
 
+	envoyK8sOpts envoyK8sOpts
+
 	cacheOpts cacheOpts
 }
 
 type glooOpts struct {
 	selector gloo.Selector
+	// set by the deprecated --labels flag
+	labels map[string]string
+
+	glooNamespace      string
+	glooVersion        string
+	ignoreVersionCheck bool
+	abiRegistryFile    string
+
+	puller pull.ImagePuller // set by load
 }
 
 func (opts *glooOpts) addToFlags(flags *pflag.FlagSet) {
 	flags.StringSliceVarP(&opts.selector.Namespaces, "namespaces", "n", nil, "deploy the filter to selected Gateway resource in the given namespaces. if none provided, Gateways in all namespaces will be selected.")
-	flags.StringToStringVarP(&opts.selector.GatewayLabels, "labels", "l", nil, "select deploy the filter to selected Gateway resource in the given namespaces. if none provided, Gateways in all namespaces will be selected.")
+	flags.StringSliceVar(&opts.selector.GatewayNames, "gateway-name", nil, "deploy the filter to the Gateway resources with the given names. if none provided, Gateways with any name will be selected.")
+	flags.StringToStringVarP(&opts.selector.GatewayLabels, "gateway-labels", "l", nil, "deploy the filter to the Gateway resources with the given labels. if none provided, Gateways with any labels will be selected.")
+	flags.StringToStringVar(&opts.labels, "labels", nil, "deprecated alias of --gateway-labels.")
+	flags.MarkDeprecated("labels", "use --gateway-labels instead")
+}
+
+func (opts *glooOpts) addVersionCheckToFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&opts.glooNamespace, "gloo-namespace", gloo.DefaultGlooNamespace, "the namespace where Gloo is installed. the version of Gloo the abi compatibility of the filter is checked against is read from its gloo (or gateway-proxy) deployment.")
+	flags.StringVar(&opts.glooVersion, "gloo-version", "", "the version of Gloo to check the abi compatibility of the filter against, rather than the version of Gloo installed in the cluster, e.g. to render the Gateways with --dry-run without access to the cluster.")
+	flags.BoolVar(&opts.ignoreVersionCheck, "ignore-version-check", false, "set to disable abi version compatability check.")
+	flags.StringVar(&opts.abiRegistryFile, "abi-registry-file", "", "path to a YAML file mapping abi versions to the gloo versions which support them, e.g. '<abi version>: {gloo: [1.8.x]}'. entries are merged into the built-in registry, taking precedence over conflicting entries.")
+}
+
+// returns the selector of the gateways, with the labels of the deprecated --labels flag
+func (opts *glooOpts) gatewaySelector() gloo.Selector {
+	selector := opts.selector
+	if len(opts.labels) > 0 {
+		labels := map[string]string{}
+		for k, v := range opts.labels {
+			labels[k] = v
+		}
+		for k, v := range opts.selector.GatewayLabels {
+			labels[k] = v
+		}
+		selector.GatewayLabels = labels
+	}
+	return selector
 }
 
 type istioOpts struct {
 	workload           istio.Workload
 	patchContext       string
+	filterType         string
+	orderBefore        string
+	orderAfter         string
 	istioNamespace     string
+	istioRevision      string
 	cacheTimeout       time.Duration
+	cachePollInterval  time.Duration
+	keepCacheEvents    bool
+	pinDigest          bool
+	verifyKey          string
+	verifyRoots        string
+	verifyAnnotations  map[string]string
+	rolloutTimeout     time.Duration
 	ignoreVersionCheck bool
+	abiRegistryFile    string
+	istioVersion       string
+
+	disableProxyVersionMatch bool
+	meshWide                 bool
+	remoteDatasource         bool
+	workloadOrder            string
+	atomic                   bool
+	includeUninjected        bool
+	selectorLabels           map[string]string
+
+	configFromConfigMap string
+	configFromSecret    string
+
+	// kubeconfig contexts of the clusters to deploy to, as <context>[=<istio namespace>]
+	contexts []string
 
 	puller pull.ImagePuller // set by load
+
+	// counts the workloads the filter was applied to, printed once the filter is deployed
+	summary workloadSummary
 }
 
 func (opts *istioOpts) addToFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&opts.workload.Name, "name", "", "name of the workload into which to inject the filter. if not set, will apply to all workloads selected by --labels in the target namespace. required with --dry-run")
 	flags.StringToStringVarP(&opts.workload.Labels, "labels", "l", nil, "labels of the deployment or daemonset into which to inject the filter. if not set, will apply to all workloads in the target namespace")
 	flags.StringVarP(&opts.workload.Namespace, "namespace", "n", "default", "namespace of the workload(s) to inject the filter.")
 	flags.StringVarP(&opts.workload.Kind, "workload-type", "t", istio.WorkloadTypeDeployment, "type of workload into which the filter should be injected. possible values are "+strings.Join(SupportedWorkloadTypes, ", "))
 	flags.StringVar(&opts.patchContext, "patch-context", istio.PatchContextInbound, "patch context of the filter. possible values are "+strings.Join(istio.SupportedPatchContexts, ", "))
+	flags.StringVar(&opts.filterType, "filter-type", istio.FilterTypeHttp, "the type of filter chain the filter is inserted into. http filters are inserted into the HTTP filter chain, network filters into TCP filter chains before the tcp_proxy filter. possible values are "+strings.Join(istio.SupportedFilterTypes, ", "))
+	flags.StringVar(&opts.orderBefore, "order-before", "", "the id of another filter deployed by wasme to the same workloads. if set, the filter is inserted before it in the HTTP filter chain, rather than before the router. requires Istio 1.7+.")
+	flags.StringVar(&opts.orderAfter, "order-after", "", "the id of another filter deployed by wasme to the same workloads. if set, the filter is inserted after it in the HTTP filter chain, rather than before the router. requires Istio 1.7+.")
 	flags.StringVar(&opts.istioNamespace, "istio-namespace", "istio-system", "the namespace where the Istio control plane is installed")
+	flags.StringVar(&opts.istioRevision, "istio-revision", "", "the revision of the Istio control plane to check for abi compatibility. if not set and multiple revisions are installed, the revision is read from the istio.io/rev label on the target namespace")
 	flags.DurationVar(&opts.cacheTimeout, "cache-timeout", time.Minute, "the length of time to wait for the server-side filter cache to pull the filter image before giving up with an error. set to 0 to skip the check entirely (note, this may produce a known race condition).")
+	flags.DurationVar(&opts.cachePollInterval, "cache-poll-interval", time.Second, "the initial interval between checks of the cache events while waiting for the filter cache. the interval is doubled after each check, up to 10s, and jittered.")
+	flags.BoolVar(&opts.keepCacheEvents, "keep-cache-events", false, "leave the events published by the filter cache for the image in place once the cache has pulled it, rather than deleting them. only events published after the image is added to the cache are waited for, so events left by earlier deployments are not counted.")
+	flags.BoolVar(&opts.pinDigest, "pin-digest", false, "set to have the filter cache pull the image by the digest its tag resolves to when the filter is deployed, so that every proxy loads the same module even if the tag is moved to another image. the pinned ref is recorded on the workloads. images referenced by digest are always pulled by their digest.")
+	flags.StringVar(&opts.verifyKey, "verify-key", "", "path to the PEM encoded public key of a cosign key pair. if set, the filter is only deployed if a cosign signature made with the key and attached to the image is valid for the digest the image resolves to.")
+	flags.StringVar(&opts.verifyRoots, "verify-roots", "", "path to the PEM encoded root certificates of a Fulcio instance. if set, the filter is only deployed if a keyless cosign signature attached to the image, whose certificate chains to the roots, is valid for the digest the image resolves to. the transparency log is not checked.")
+	flags.StringToStringVar(&opts.verifyAnnotations, "verify-annotation", nil, "annotations which must be set to these values on the signed payload of the signature verified with --verify-key or --verify-roots, e.g. with cosign sign -a.")
+	flags.DurationVar(&opts.rolloutTimeout, "rollout-timeout", 0, "if non-zero, the length of time to wait for each updated workload to finish restarting its pods before updating the next workload, giving up with an error. by default, wasme returns once the workloads are updated.")
 	flags.BoolVar(&opts.ignoreVersionCheck, "ignore-version-check", false, "set to disable abi version compatability check.")
+	flags.StringVar(&opts.istioVersion, "istio-version", "", "the version of Istio to check the abi compatibility of the filter against, rather than the version of istiod installed in the cluster, e.g. to render the filter with --dry-run without access to the cluster.")
+	flags.StringVar(&opts.abiRegistryFile, "abi-registry-file", "", "path to a YAML file mapping abi versions to the istio versions which support them, e.g. '<abi version>: {istio: [1.9.x]}'. entries are merged into the built-in registry, taking precedence over conflicting entries.")
+	flags.BoolVar(&opts.disableProxyVersionMatch, "disable-proxy-version-match", false, "set to apply the filter to proxies of any version. by default, the created EnvoyFilters only match proxies running a version of Istio which supports the abi versions of the filter image.")
+	flags.BoolVar(&opts.meshWide, "mesh-wide", false, "set to create a single EnvoyFilter in the istio namespace which applies the filter to every proxy in the mesh, instead of one EnvoyFilter per workload. the selected workloads are still annotated to mount the filter cache; proxies which do not mount the cache will reject the filter.")
+	flags.BoolVar(&opts.remoteDatasource, "remote-datasource", false, "set to have the proxies fetch the filter from the cache service over HTTP, verifying it against the sha256 digest of the image, instead of loading it from the cache directory. the workloads are not annotated to mount the cache directory, so no hostPath volumes are required.")
+	flags.BoolVar(&opts.atomic, "atomic", false, "set to roll back the changes made to the cluster if the filter cannot be deployed to (or removed from) every selected workload, rather than leaving the filter on some of the workloads. failures to roll back a change are reported in the returned error.")
+	flags.BoolVar(&opts.includeUninjected, "include-uninjected", false, "set to apply the filter to workloads which do not run the istio sidecar, e.g. if sidecar injection is enabled afterwards. by default, workloads are skipped unless their namespace is labeled with istio-injection=enabled or istio.io/rev, or their pod template sets the sidecar.istio.io/inject: \"true\" annotation.")
+	flags.StringToStringVar(&opts.selectorLabels, "selector-labels", nil, "labels used verbatim as the workload selector of the created EnvoyFilters, which should only match the pods of a single workload. by default, the pod template labels of each workload are used, without labels which change between rollouts such as pod-template-hash.")
+	flags.StringVar(&opts.configFromConfigMap, "config-from-configmap", "", "read the filter config from a key of a ConfigMap in the namespace of the workload, in the format <name>/<key>. the config is read when the filter is deployed. cannot be used with --config.")
+	flags.StringVar(&opts.configFromSecret, "config-from-secret", "", "read the filter config from a key of a Secret in the namespace of the workload, in the format <name>/<key>. the config is read when the filter is deployed. cannot be used with --config.")
+	flags.StringArrayVar(&opts.contexts, "context", nil, "kubeconfig context of a cluster to deploy the filter to, in the format <context>[=<istio namespace>]. repeat to deploy to several clusters; the abi compatibility of the filter is checked in each cluster, and the istio namespace defaults to --istio-namespace. if not set, the current context is used.")
+	flags.StringVar(&opts.workloadOrder, "workload-order", istio.WorkloadOrderName, "the order in which the filter is applied to the selected workloads. the filter is removed in the reverse order. possible values are "+strings.Join(istio.SupportedWorkloadOrders, ", "))
+}
+
+type envoyK8sOpts struct {
+	deployment   standalone.Deployment
+	listeners    []string
+	moduleSource string
+	hostPath     string
+	initImage    string
+
+	puller pull.ImagePuller // set by load
+}
+
+// the flags selecting the Deployment and its bootstrap ConfigMap, shared by deploy, undeploy and list deployed
+func (opts *envoyK8sOpts) addDeploymentToFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&opts.deployment.Name, "deployment", "", "name of the Deployment running Envoy. required.")
+	flags.StringVarP(&opts.deployment.Namespace, "namespace", "n", "default", "namespace of the Deployment and of the ConfigMap holding its bootstrap config.")
+	flags.StringVar(&opts.deployment.ConfigMap, "configmap", "", "name of the ConfigMap holding the bootstrap config of Envoy, mounted by the Deployment. required.")
+	flags.StringVar(&opts.deployment.ConfigMapKey, "configmap-key", "envoy.yaml", "the key of the ConfigMap holding the bootstrap config, in YAML or JSON.")
+	flags.StringVar(&opts.deployment.Container, "container", "", "name of the container running Envoy. defaults to the only container of the Deployment, or the container named "+standalone.DefaultContainerName+".")
+}
+
+func (opts *envoyK8sOpts) addToFlags(flags *pflag.FlagSet) {
+	opts.addDeploymentToFlags(flags)
+	flags.StringArrayVar(&opts.listeners, "listener", nil, "name of a static listener of the bootstrap config to add the filter to. repeat to select several listeners. if not set, the filter is added to every static listener with an http_connection_manager.")
+	flags.StringVar(&opts.moduleSource, "module-source", standalone.ModuleSourceInitContainer, "how the module of the filter is made available to the pods. "+standalone.ModuleSourceInitContainer+" adds an init container pulling the image, pinned to its digest, into an emptyDir volume. "+standalone.ModuleSourceHostPath+" mounts the directory the wasme cache writes the modules to on each host, which must have cached the image. possible values are "+strings.Join(standalone.SupportedModuleSources, ", "))
+	flags.StringVar(&opts.hostPath, "host-path", standalone.DefaultHostPath, "the host directory the module is read from with --module-source="+standalone.ModuleSourceHostPath+".")
+	flags.StringVar(&opts.initImage, "init-image", cachedeployment.CacheImageRepository+":"+cachedeployment.CacheImageTag, "the image of the init container pulling the module with --module-source="+standalone.ModuleSourceInitContainer+", whose entrypoint is wasme.")
+}
+
+func (opts *envoyK8sOpts) validate() error {
+	if opts.deployment.Name == "" {
+		return errors.Errorf("--deployment cannot be empty")
+	}
+	if opts.deployment.ConfigMap == "" {
+		return errors.Errorf("--configmap cannot be empty")
+	}
+	return nil
+}
+
+type eventOpts struct {
+	sink    string
+	timeout time.Duration
+}
+
+func (opts *eventOpts) addToFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&opts.sink, "event-sink", "", "optional URL of an HTTP sink to which a CloudEvent is sent once the filter is deployed or removed, or the operation fails.")
+	flags.DurationVar(&opts.timeout, "event-timeout", 30*time.Second, "the length of time to retry sending the event to the --event-sink before giving up.")
 }
 
 type cacheOpts struct {
 	name       string
 	namespace  string
+	kind       string
 	imageRepo  string
 	imageTag   string
 	customArgs []string
 	pullPolicy string
+	// the kubernetes.io/dockerconfigjson secret used by the cache to pull images
+	registrySecret string
+	// the PersistentVolumeClaim storing the cache directory
+	persistentVolumeClaim string
 }
 
 func (opts *cacheOpts) addToFlags(flags *pflag.FlagSet) {
 	flags.StringVarP(&opts.name, "cache-name", "", cachedeployment.CacheName, "name of resources for the wasm image cache server")
 	flags.StringVarP(&opts.namespace, "cache-namespace", "", cachedeployment.CacheNamespace, "namespace of resources for the wasm image cache server")
+	flags.StringVarP(&opts.kind, "cache-kind", "", "", "kind of workload running the wasm image cache server. possible values are "+istio.WorkloadTypeDaemonSet+", "+istio.WorkloadTypeDeployment+". if not set, wasme will look for either. when set to "+istio.WorkloadTypeDeployment+", wasme assumes the cache is managed by the user and will not install it")
 	flags.StringVarP(&opts.imageRepo, "cache-repo", "", cachedeployment.CacheImageRepository, "name of the image repository to use for the cache server daemonset")
 	flags.StringVarP(&opts.imageTag, "cache-tag", "", cachedeployment.CacheImageTag, "image tag to use for the cache server daemonset")
 	flags.StringSliceVarP(&opts.customArgs, "cache-custom-command", "", nil, "custom command to provide to the cache server image")
+	flags.StringVarP(&opts.registrySecret, "cache-registry-secret", "", "", "name of a kubernetes.io/dockerconfigjson secret in the cache namespace with the credentials the cache server uses to pull filter images from private registries")
+	flags.StringVarP(&opts.persistentVolumeClaim, "cache-pvc", "", "", "name of a ReadWriteMany PersistentVolumeClaim storing the filters pulled by the wasm image cache server, for clusters which forbid hostPath volumes. the claim must exist in the cache namespace and in the namespace of each workload, bound to the same shared storage. if not set, the filters are stored on each host")
 	flags.StringVarP(&opts.pullPolicy, "cache-image-pull-policy", "", string(corev1.PullIfNotPresent), "image pull policy for the cache server daemonset. see https://kubernetes.io/docs/concepts/containers/images/")
 }
 
 type localOpts struct {
-	infile           string
-	outfile          string
-	storageDir       string
-	dockerRunArgs    string
-	envoyArgs        string
-	envoyDockerImage string
+	infile            string
+	outfile           string
+	storageDir        string
+	dockerRunArgs     string
+	envoyArgs         string
+	envoyDockerImage  string
+	composeOut        string
+	bootstrapOnly     bool
+	inlineFilter      bool
+	watch             bool
+	watchOpts         local.Watch
+	listenerPort      uint32
+	adminPort         uint32
+	upstreams         []string
+	printConfig       bool
+	istioProxyVersion string
+}
+
+// returns the default bootstrap config, with the ports and upstreams of the flags
+func (opts *localOpts) renderBootstrap() (string, error) {
+	bootstrapOpts := local.DefaultBootstrapOptions()
+	bootstrapOpts.ListenerPort = opts.listenerPort
+	bootstrapOpts.AdminPort = opts.adminPort
+	if opts.istioProxyVersion != "" {
+		v3, err := local.IstioUsesV3(opts.istioProxyVersion)
+		if err != nil {
+			return "", err
+		}
+		bootstrapOpts.V3 = v3
+	}
+	if len(opts.upstreams) > 0 {
+		bootstrapOpts.Upstreams = nil
+	}
+	for i, s := range opts.upstreams {
+		upstream, err := local.ParseUpstream(fmt.Sprintf("upstream-%v", i), s)
+		if err != nil {
+			return "", err
+		}
+		bootstrapOpts.Upstreams = append(bootstrapOpts.Upstreams, upstream)
+	}
+	return local.RenderBootstrap(bootstrapOpts)
+}
+
+// the bundle is written to the current directory if --bootstrap-only is set without --compose-out
+func (opts *localOpts) composeDir() string {
+	if opts.composeOut == "" && opts.bootstrapOnly {
+		return "."
+	}
+	return opts.composeOut
 }
 
 func (opts *localOpts) addToFlags(flags *pflag.FlagSet) {
 	flags.StringVarP(&opts.envoyDockerImage, "envoy-image", "e", local.DefaultEnvoyImage, "Name of the Docker image containing the Envoy binary")
 	flags.StringVarP(&opts.infile, "bootstrap", "b", "", "Path to an Envoy bootstrap config. If set, `wasme deploy envoy` will run Envoy locally using the provided configuration file. Set -in=- to use stdin. If empty, will use a default configuration template with a single route to `jsonplaceholder.typicode.com`.")
+	flags.Uint32Var(&opts.listenerPort, "port", local.DefaultListenerPort, "The port of the listener of the default bootstrap config, which the filter is added to. Cannot be used with --bootstrap.")
+	flags.Uint32Var(&opts.adminPort, "admin-port", local.DefaultAdminPort, "The port of the Envoy admin API of the default bootstrap config. Cannot be used with --bootstrap.")
+	flags.StringArrayVar(&opts.upstreams, "upstream", nil, "An upstream the default bootstrap config routes the requests to, in the format [<path prefix>=][http://|https://]<host>:<port>, e.g. /api=host.docker.internal:9000. https upstreams are connected to with TLS. Repeat to route several path prefixes to their own clusters; the longest matching prefix is used, and the prefix defaults to /. Replaces the route to jsonplaceholder.typicode.com. Cannot be used with --bootstrap.")
+	flags.StringVar(&opts.istioProxyVersion, "istio-proxy-version", "", "Run the filter in the proxy of this version of Istio, e.g. 1.8.2, rather than in --envoy-image. The "+local.IstioProxyImage+" image of the version is run, the abi versions of the filter image must be supported by the version, and the filter is configured like wasme deploy istio configures it: for Istio 1.7+, the bootstrap config is in the v3 API and the filter is a typed wasm filter. A custom --bootstrap must then be in the v3 API. Cannot be used with --envoy-image or --watch.")
+	flags.BoolVar(&opts.printConfig, "print-config", false, "Print the generated Envoy configuration to stdout before launching Envoy.")
 	flags.StringVarP(&opts.outfile, "out", "", "", "If set, write the modified Envoy configuration to this file instead of launching Envoy. Set -out=- to use stdout.")
 	flags.StringVar(&opts.storageDir, "store", "", "Set the path to the local storage directory for wasm images. Defaults to $HOME/.wasme/store")
 	flags.StringVar(&opts.dockerRunArgs, "docker-run-args", "", "Set to provide additional args to the `docker run` command used to launch Envoy. Ignored if --out is set.")
 	flags.StringVar(&opts.envoyArgs, "envoy-run-args", "", "Set to provide additional args to the `envoy` command used to launch Envoy. Ignored if --out is set.")
+	flags.StringVar(&opts.composeOut, "compose-out", "", "If set, write the modified Envoy configuration, the filter module and a docker-compose.yaml running Envoy to this directory instead of launching Envoy. Start Envoy by running docker-compose up in the directory. The image is pulled if it is not in the local storage.")
+	flags.BoolVar(&opts.bootstrapOnly, "bootstrap-only", false, "Write the docker-compose bundle instead of launching Envoy, to the --compose-out directory or to the current directory if --compose-out is not set.")
+	flags.BoolVar(&opts.watch, "watch", false, "Reload the filter in the running Envoy whenever its module or its --watch-config file changes, rather than restarting Envoy. The listeners replaced by a reload drain their connections for --drain-time. Cannot be used with --out or --compose-out.")
+	flags.StringVar(&opts.watchOpts.ModuleFile, "watch-module", "", "Path to a .wasm module to run and watch with --watch instead of the module of the image, e.g. the output of the build of the filter. If not set, the module of the image in the local storage is watched, so the filter is reloaded when wasme build replaces the image.")
+	flags.StringVar(&opts.watchOpts.ConfigFile, "watch-config", "", "Path to a file containing the filter config, passed to the filter as a string, which is watched with --watch. Overrides --config.")
+	flags.DurationVar(&opts.watchOpts.Interval, "watch-interval", local.DefaultWatchInterval, "How often the watched files are checked for changes with --watch.")
+	flags.DurationVar(&opts.watchOpts.DrainTime, "drain-time", local.DefaultDrainTime, "How long Envoy drains the connections of the listeners replaced by a reload with --watch.")
+	flags.BoolVar(&opts.inlineFilter, "inline-filter", false, "Inline the filter module into the Envoy configuration instead of mounting it. Used with --out, --compose-out or --bootstrap-only.")
 }
 
 const (
 	Provider_Gloo  = "gloo"
 	Provider_Istio = "istio"
 	Provider_Envoy = "envoy"
+
+	Provider_EnvoyK8s = "envoy-k8s"
 )
 
 var SupportedProviders = []string{
 	Provider_Gloo,
 	Provider_Istio,
 	Provider_Envoy,
+	Provider_EnvoyK8s,
 }
 
 const (
-	WorkloadType_DaemonSet   = "daemonset"
-	WorkloadType_Deployment  = "deployment"
-	WorkloadType_STatefulset = "statefulset"
+	WorkloadType_DaemonSet        = "daemonset"
+	WorkloadType_Deployment       = "deployment"
+	WorkloadType_STatefulset      = "statefulset"
+	WorkloadType_DeploymentConfig = "deploymentconfig"
 )
 
 var SupportedWorkloadTypes = []string{
 	WorkloadType_DaemonSet,
 	WorkloadType_Deployment,
 	WorkloadType_STatefulset,
+	WorkloadType_DeploymentConfig,
 }
 
 func (opts *options) makeProvider(ctx context.Context) (deploy.Provider, error) {
@@ -171,73 +441,432 @@ func (opts *options) makeProvider(ctx context.Context) (deploy.Provider, error)
 			gwClient = helpers.MustGatewayClient()
 		}
 
-		return &gloo.Provider{
-			Ctx:           ctx,
-			GatewayClient: gwClient,
-			Selector:      opts.glooOpts.selector,
-		}, nil
+		provider := &gloo.Provider{
+			Ctx:                ctx,
+			GatewayClient:      gwClient,
+			Selector:           opts.glooOpts.gatewaySelector(),
+			Puller:             opts.glooOpts.puller,
+			IgnoreVersionCheck: opts.glooOpts.ignoreVersionCheck,
+		}
+		if !opts.remove && !opts.listFilters {
+			if err := opts.configureGlooVersionCheck(provider); err != nil {
+				return nil, err
+			}
+		}
+		return provider, nil
 	case Provider_Istio:
-		if opts.dryRun {
-			return nil, errors.Errorf("dry-run not currenty supported for istio")
+		if len(opts.istioOpts.contexts) > 0 {
+			return opts.makeMultiClusterProvider(ctx)
 		}
+		// removing filters in dry-run mode is rejected by the capabilities of the provider
+		if opts.dryRun && !opts.remove {
+			return opts.makeDryRunIstioProvider(ctx)
+		}
+		return opts.makeIstioProvider(ctx)
+	case Provider_EnvoyK8s:
+		return &standalone.Provider{
+			Ctx:          ctx,
+			KubeClient:   helpers.MustKubeClient(),
+			Puller:       opts.envoyK8sOpts.puller,
+			Deployment:   opts.envoyK8sOpts.deployment,
+			Listeners:    opts.envoyK8sOpts.listeners,
+			ModuleSource: opts.envoyK8sOpts.moduleSource,
+			InitImage:    opts.envoyK8sOpts.initImage,
+			HostPath:     opts.envoyK8sOpts.hostPath,
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// returns the features of the deployment requested by the flags
+func (opts *options) requestedOptions() deploy.Options {
+	return deploy.Options{
+		PatchContext: opts.filter.PatchContext,
+		DryRun:       opts.dryRun,
+		Remove:       opts.remove,
+		ListFilters:  opts.listFilters,
+		Verify:       opts.verify,
+	}
+}
+
+// rejects the flags requesting features the provider does not support, rather than ignoring them
+func (opts *options) checkCapabilities(provider deploy.Provider) error {
+	return provider.Capabilities().Check(opts.requestedOptions())
+}
 
-		cfg, err := kubeutils.GetConfig("", "")
+// sets the registry and the version inspector the gloo provider checks the abi versions of the image with
+func (opts *options) configureGlooVersionCheck(provider *gloo.Provider) error {
+	provider.AbiRegistry = abi.DefaultRegistry
+	if opts.glooOpts.abiRegistryFile != "" {
+		customRegistry, err := abi.LoadRegistryFile(opts.glooOpts.abiRegistryFile)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		provider.AbiRegistry = provider.AbiRegistry.Merge(customRegistry)
+	}
+	if opts.glooOpts.glooVersion != "" {
+		provider.VersionInspector = gloo.StaticVersionInspector(opts.glooOpts.glooVersion)
+		return nil
+	}
+	if opts.glooOpts.ignoreVersionCheck {
+		return nil
+	}
+	kubeClient, err := helpers.KubeClient()
+	if err != nil {
+		return errors.Wrap(err, "detecting the gloo version, set --gloo-version or --ignore-version-check to skip")
+	}
+	provider.VersionInspector = gloo.NewVersionInspector(kubeClient, opts.glooOpts.glooNamespace)
+	return nil
+}
+
+func (opts *options) makeIstioProvider(ctx context.Context) (*istio.Provider, error) {
+	cfg, err := kubeutils.GetConfig("", "")
+	if err != nil {
+		return nil, err
+	}
+	return opts.makeIstioProviderForConfig(ctx, cfg, opts.istioOpts.istioNamespace)
+}
+
+// the cluster of a --context
+type kubeContext struct {
+	name           string
+	istioNamespace string
+	cfg            *rest.Config
+}
+
+// parses the --context flags, loading the rest config of each context
+func (opts *options) kubeContexts() ([]kubeContext, error) {
+	var kubeContexts []kubeContext
+	for _, flag := range opts.istioOpts.contexts {
+		name, istioNamespace := flag, opts.istioOpts.istioNamespace
+		if parts := strings.SplitN(flag, "=", 2); len(parts) == 2 {
+			name, istioNamespace = parts[0], parts[1]
+		}
+		if name == "" || istioNamespace == "" {
+			return nil, errors.Errorf("invalid --context %q: must be in the format <context>[=<istio namespace>]", flag)
 		}
 
-		kubeClient, err := kubernetes.NewForConfig(cfg)
+		cfg, err := kubeutils.GetConfigWithContext("", "", name)
 		if err != nil {
-			return nil, err
+			return nil, errors.Wrapf(err, "loading kubeconfig context %v", name)
 		}
+		kubeContexts = append(kubeContexts, kubeContext{name: name, istioNamespace: istioNamespace, cfg: cfg})
+	}
+	return kubeContexts, nil
+}
 
-		mgr, err := manager.New(cfg, manager.Options{})
+// returns a provider which deploys to the cluster of each --context
+func (opts *options) makeMultiClusterProvider(ctx context.Context) (*istio.MultiClusterProvider, error) {
+	kubeContexts, err := opts.kubeContexts()
+	if err != nil {
+		return nil, err
+	}
+	var clusters []istio.Cluster
+	for _, kubeContext := range kubeContexts {
+		provider, err := opts.makeIstioProviderForConfig(ctx, kubeContext.cfg, kubeContext.istioNamespace)
 		if err != nil {
-			return nil, err
+			return nil, errors.Wrapf(err, "cluster %v", kubeContext.name)
 		}
+		clusters = append(clusters, istio.Cluster{Name: kubeContext.name, Provider: provider})
+	}
 
-		go func() {
-			err := mgr.Start(ctx.Done())
-			if err != nil {
-				log.Fatalf("failed to start kubernetes dynamic client")
-			}
-		}()
-
-		return istio.NewProvider(
-			ctx,
-			kubeClient,
-			ezkube.NewEnsurer(ezkube.NewRestClient(mgr)),
-			opts.istioOpts.puller,
-			opts.istioOpts.workload,
-			istio.Cache{
-				Name:      opts.cacheOpts.name,
-				Namespace: opts.cacheOpts.namespace,
-			},
-			nil, // no parent object when using CLI
-			nil, // no callback when using CLI
-			opts.istioOpts.istioNamespace,
-			opts.istioOpts.cacheTimeout,
-			opts.istioOpts.ignoreVersionCheck,
-		)
+	return istio.NewMultiClusterProvider(clusters, func(cluster string, workloadMeta metav1.ObjectMeta, err error) {
+		logger := log.WithFields(logrus.Fields{"cluster": cluster, "workload": workloadMeta.Name})
+		if istio.IsUninjectedWorkload(err) {
+			logger.Warn("skipped workload without the istio sidecar")
+			return
+		}
+		if err != nil {
+			logger.WithError(err).Error("failed to update workload")
+			return
+		}
+		logger.Info("updated workload")
+	}), nil
+}
+
+// returns a provider which prints the resources of the filter instead of deploying it.
+// the cluster is only read to detect the istio version, unless --istio-version is set
+func (opts *options) makeDryRunIstioProvider(ctx context.Context) (*istio.Provider, error) {
+	if opts.istioOpts.workload.Name == "" {
+		return nil, errors.Errorf("--name is required with --dry-run")
+	}
+	if opts.filter.ConfigFrom != nil {
+		return nil, errors.Errorf("--config-from-configmap and --config-from-secret cannot be used with --dry-run")
+	}
+	if opts.filter.OrderBefore != "" || opts.filter.OrderAfter != "" {
+		return nil, errors.Errorf("--order-before and --order-after cannot be used with --dry-run")
 	}
 
-	return nil, nil
+	// no clients are set, so the provider cannot modify the cluster
+	provider := &istio.Provider{
+		Ctx:                ctx,
+		Puller:             opts.istioOpts.puller,
+		Workload:           opts.istioOpts.workload,
+		Cache:              opts.istioCache(),
+		IstioNamespace:     opts.istioOpts.istioNamespace,
+		IstioRevision:      opts.istioOpts.istioRevision,
+		IgnoreVersionCheck: opts.istioOpts.ignoreVersionCheck,
+		DryRunOutput:       os.Stdout,
+	}
+	if err := opts.configureIstioProvider(provider); err != nil {
+		return nil, err
+	}
+	if provider.VersionInspector == nil {
+		kubeClient, err := helpers.KubeClient()
+		if err != nil {
+			return nil, errors.Wrap(err, "detecting the istio version, set --istio-version to skip")
+		}
+		provider.VersionInspector = istio.NewVersionInspector(kubeClient, provider.IstioNamespace, provider.IstioRevision, provider.Workload.Namespace)
+	}
+	return provider, nil
+}
+
+func (opts *options) makeIstioProviderForConfig(ctx context.Context, cfg *rest.Config, istioNamespace string) (*istio.Provider, error) {
+	kubeClient, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := istio.NewEnsurer(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := istio.NewProvider(
+		ctx,
+		kubeClient,
+		client,
+		opts.istioOpts.puller,
+		opts.istioOpts.workload,
+		opts.istioCache(),
+		nil, // no parent object when using CLI
+		opts.istioOpts.summary.onWorkload,
+		istioNamespace,
+		opts.istioOpts.istioRevision,
+		opts.istioOpts.cacheTimeout,
+		opts.istioOpts.ignoreVersionCheck,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.configureIstioProvider(provider); err != nil {
+		return nil, err
+	}
+	provider.Recorder = istio.NewEventRecorder(kubeClient, "wasme")
+	provider.DynamicClient = dynamicClient
+
+	return provider, nil
+}
+
+// installs the filter cache in the cluster of each --context, or in the cluster of the current context if none is set.
+// newKubeClient returns the client of the cluster of a context
+func (opts *options) ensureCaches(newKubeClient func(cfg *rest.Config) (kubernetes.Interface, error)) error {
+	if len(opts.istioOpts.contexts) == 0 {
+		return opts.makeCacheDeployer(helpers.MustKubeClient()).EnsureCache()
+	}
+	kubeContexts, err := opts.kubeContexts()
+	if err != nil {
+		return err
+	}
+	for _, kubeContext := range kubeContexts {
+		kubeClient, err := newKubeClient(kubeContext.cfg)
+		if err != nil {
+			return errors.Wrapf(err, "cluster %v", kubeContext.name)
+		}
+		if err := opts.makeCacheDeployer(kubeClient).EnsureCache(); err != nil {
+			return errors.Wrapf(err, "installing the cache in cluster %v", kubeContext.name)
+		}
+	}
+	return nil
+}
+
+func (opts *options) makeCacheDeployer(kubeClient kubernetes.Interface) cachedeployment.Deployer {
+	return cachedeployment.NewDeployer(
+		kubeClient,
+		opts.cacheOpts.namespace,
+		opts.cacheOpts.name,
+		opts.cacheOpts.imageRepo,
+		opts.cacheOpts.imageTag,
+		opts.cacheOpts.customArgs,
+		corev1.PullPolicy(opts.cacheOpts.pullPolicy),
+		opts.cacheOpts.registrySecret,
+		opts.cacheOpts.persistentVolumeClaim,
+	)
+}
+
+func (opts *options) istioCache() istio.Cache {
+	return istio.Cache{
+		Name:                  opts.cacheOpts.name,
+		Namespace:             opts.cacheOpts.namespace,
+		Kind:                  opts.cacheOpts.kind,
+		PersistentVolumeClaim: opts.cacheOpts.persistentVolumeClaim,
+	}
+}
+
+// sets the options of the provider from the istio flags
+func (opts *options) configureIstioProvider(provider *istio.Provider) error {
+	provider.AbiRegistry = abi.DefaultRegistry
+	if opts.istioOpts.abiRegistryFile != "" {
+		customRegistry, err := abi.LoadRegistryFile(opts.istioOpts.abiRegistryFile)
+		if err != nil {
+			return err
+		}
+		provider.AbiRegistry = provider.AbiRegistry.Merge(customRegistry)
+	}
+	if opts.istioOpts.istioVersion != "" {
+		provider.VersionInspector = istio.StaticVersionInspector(opts.istioOpts.istioVersion)
+	}
+
+	var err error
+	provider.CachePollInterval = opts.istioOpts.cachePollInterval
+	provider.KeepCacheEvents = opts.istioOpts.keepCacheEvents
+	provider.PinDigest = opts.istioOpts.pinDigest
+	provider.VerifyOptions, err = opts.istioOpts.verifyOptions()
+	if err != nil {
+		return err
+	}
+	provider.DisableProxyVersionMatch = opts.istioOpts.disableProxyVersionMatch
+	provider.MeshWide = opts.istioOpts.meshWide
+	provider.RemoteDatasource = opts.istioOpts.remoteDatasource
+	provider.WaitForRolloutTimeout = opts.istioOpts.rolloutTimeout
+	provider.AtomicApply = opts.istioOpts.atomic
+	provider.IncludeUninjected = opts.istioOpts.includeUninjected
+	provider.SelectorLabels = opts.istioOpts.selectorLabels
+	provider.WorkloadOrdering, err = istio.ParseWorkloadOrdering(opts.istioOpts.workloadOrder)
+	return err
+}
+
+// the options to verify the signatures of the image, nil if neither --verify-key nor --verify-roots are set
+func (opts *istioOpts) verifyOptions() (*signature.VerifyOptions, error) {
+	if opts.verifyKey == "" && opts.verifyRoots == "" {
+		if len(opts.verifyAnnotations) > 0 {
+			return nil, errors.Errorf("--verify-annotation requires --verify-key or --verify-roots")
+		}
+		return nil, nil
+	}
+	verifyOptions := &signature.VerifyOptions{Annotations: opts.verifyAnnotations}
+	if opts.verifyKey != "" {
+		publicKey, err := ioutil.ReadFile(opts.verifyKey)
+		if err != nil {
+			return nil, err
+		}
+		verifyOptions.PublicKey = publicKey
+	}
+	if opts.verifyRoots != "" {
+		roots, err := ioutil.ReadFile(opts.verifyRoots)
+		if err != nil {
+			return nil, err
+		}
+		verifyOptions.Roots = roots
+	}
+	// reject invalid keys before the cluster is modified
+	if _, err := signature.NewVerifier(nil, *verifyOptions); err != nil {
+		return nil, err
+	}
+	return verifyOptions, nil
+}
+
+// the puller reads the blobs which did not change from the local blob store, unless --no-cache is set
+func (opts *options) makePuller() (pull.ImagePuller, error) {
+	if len(opts.CredentialsFiles) == 0 {
+		opts.CredentialsFiles = []string{defaults.WasmeCredentialsFile, defaults.DockerConfigFile}
+	}
+	if opts.noCache {
+		return opts.NewPuller(nil)
+	}
+	return opts.NewPuller(store.NewBlobStore(""))
 }
 
 func makeDeployer(ctx context.Context, opts *options) (*deploy.Deployer, error) {
-	resolver, _ := resolver.NewResolver(opts.Username, opts.Password, opts.Insecure, opts.PlainHTTP, opts.CredentialsFiles...)
-	puller := pull.NewPuller(resolver)
+	puller, err := opts.makePuller()
+	if err != nil {
+		return nil, err
+	}
 
-	// set istio puller
+	// set istio, gloo and envoy-k8s puller
 	opts.istioOpts.puller = puller
+	opts.glooOpts.puller = puller
+	opts.envoyK8sOpts.puller = puller
 
 	provider, err := opts.makeProvider(ctx)
 	if err != nil {
 		return nil, err
 	}
+	if err := opts.checkCapabilities(provider); err != nil {
+		return nil, err
+	}
+	var emitter *events.Emitter
+	if opts.eventOpts.sink != "" {
+		emitter = events.NewEmitter(events.NewHTTPTransport(opts.eventOpts.sink), "wasme", events.EmitterOptions{})
+		emitter.Start(ctx)
+	}
 	return &deploy.Deployer{
 		Ctx:      ctx,
 		Puller:   puller,
 		Provider: provider,
+		Events:   emitter,
 	}, nil
 }
+
+// returns the ConfigFrom set by the --config-from-* flags, or nil if none are set
+func (opts *istioOpts) configFrom() (*v1.ConfigSource, error) {
+	if opts.configFromConfigMap == "" && opts.configFromSecret == "" {
+		return nil, nil
+	}
+	if opts.configFromConfigMap != "" && opts.configFromSecret != "" {
+		return nil, errors.Errorf("only one of --config-from-configmap or --config-from-secret may be set")
+	}
+	if opts.configFromConfigMap != "" {
+		ref, err := parseKeyReference("--config-from-configmap", opts.configFromConfigMap)
+		if err != nil {
+			return nil, err
+		}
+		return &v1.ConfigSource{ConfigMapKeyRef: ref}, nil
+	}
+	ref, err := parseKeyReference("--config-from-secret", opts.configFromSecret)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.ConfigSource{SecretKeyRef: ref}, nil
+}
+
+func parseKeyReference(flag, value string) (*v1.KeyReference, error) {
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, errors.Errorf("invalid %v %q: must be in the format <name>/<key>", flag, value)
+	}
+	return &v1.KeyReference{Name: parts[0], Key: parts[1]}, nil
+}
+
+// counts the workloads the filter was applied to in every cluster
+type workloadSummary struct {
+	applied, skipped, failed int
+}
+
+func (s *workloadSummary) onWorkload(_ metav1.ObjectMeta, err error) {
+	switch {
+	case istio.IsUninjectedWorkload(err):
+		s.skipped++
+	case err != nil:
+		s.failed++
+	default:
+		s.applied++
+	}
+}
+
+func (s *workloadSummary) String() string {
+	summary := fmt.Sprintf("applied filter to %v workloads", s.applied)
+	if s.skipped > 0 {
+		summary += fmt.Sprintf(", skipped %v workloads without the istio sidecar (use --include-uninjected to apply the filter to them)", s.skipped)
+	}
+	if s.failed > 0 {
+		summary += fmt.Sprintf(", failed on %v workloads", s.failed)
+	}
+	return summary
+}
@@ -0,0 +1,88 @@
+package deploy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	cachedeployment "github.com/solo-io/wasm/tools/wasme/cli/pkg/cache"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+const twoClusterKubeConfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: east
+  cluster:
+    server: https://east.example
+- name: west
+  cluster:
+    server: https://west.example
+users:
+- name: admin
+  user:
+    token: token
+contexts:
+- name: east
+  context:
+    cluster: east
+    user: admin
+- name: west
+  context:
+    cluster: west
+    user: admin
+current-context: east
+`
+
+var _ = Describe("ensureCaches", func() {
+	var (
+		kubeConfigDir string
+		kubeConfigEnv string
+		kubeClients   map[string]*fake.Clientset
+	)
+
+	BeforeEach(func() {
+		var err error
+		kubeConfigDir, err = ioutil.TempDir("", "kubeconfig")
+		Expect(err).NotTo(HaveOccurred())
+		kubeConfig := filepath.Join(kubeConfigDir, "config")
+		Expect(ioutil.WriteFile(kubeConfig, []byte(twoClusterKubeConfig), 0644)).To(Succeed())
+		kubeConfigEnv = os.Getenv("KUBECONFIG")
+		os.Setenv("KUBECONFIG", kubeConfig)
+
+		kubeClients = map[string]*fake.Clientset{
+			"https://east.example": fake.NewSimpleClientset(),
+			"https://west.example": fake.NewSimpleClientset(),
+		}
+	})
+
+	AfterEach(func() {
+		os.Setenv("KUBECONFIG", kubeConfigEnv)
+		os.RemoveAll(kubeConfigDir)
+	})
+
+	It("installs the cache in the cluster of every --context", func() {
+		opts := &options{}
+		opts.istioOpts.contexts = []string{"east", "west=istio-west"}
+		opts.istioOpts.istioNamespace = "istio-system"
+		opts.cacheOpts.name = cachedeployment.CacheName
+		opts.cacheOpts.namespace = cachedeployment.CacheNamespace
+
+		err := opts.ensureCaches(func(cfg *rest.Config) (kubernetes.Interface, error) {
+			return kubeClients[cfg.Host], nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		for host, kubeClient := range kubeClients {
+			_, err := kubeClient.CoreV1().ConfigMaps(cachedeployment.CacheNamespace).Get(cachedeployment.CacheName, metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred(), host)
+			_, err = kubeClient.AppsV1().DaemonSets(cachedeployment.CacheNamespace).Get(cachedeployment.CacheName, metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred(), host)
+		}
+	})
+})
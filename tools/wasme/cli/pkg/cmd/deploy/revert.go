@@ -0,0 +1,37 @@
+package deploy
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func RevertCmd(ctx *context.Context) *cobra.Command {
+	opts := &options{}
+	cmd := &cobra.Command{
+		Use:   "revert --id=<unique id> [--namespace=<deployment namespace>]",
+		Short: "Revert the Istio workloads modified by a deployed Envoy WASM Filter to their pre-deploy state.",
+		Long: `Restores the workload annotations recorded by wasme before the filter was deployed, and deletes the filter's Istio EnvoyFilters.
+
+When deploying to Istio, wasme stores a snapshot of the annotations it modifies on each workload in the wasme-snapshots ConfigMap in the workload namespace.
+Unlike 'wasme undeploy istio', revert restores exactly those snapshots, even if the workload annotations were edited after the filter was deployed.
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.filter.Id == "" {
+				return errors.Errorf("--id cannot be empty")
+			}
+			provider, err := opts.makeIstioProvider(*ctx)
+			if err != nil {
+				return err
+			}
+			return provider.RevertFilter(opts.filter.Id)
+		},
+	}
+	opts.addIdToFlags(cmd.Flags())
+	cmd.Flags().StringVarP(&opts.istioOpts.workload.Namespace, "namespace", "n", "default", "namespace of the workload(s) to revert.")
+	cmd.Flags().BoolVar(&opts.istioOpts.meshWide, "mesh-wide", false, "set if the filter was deployed with --mesh-wide, to delete the mesh-wide EnvoyFilter.")
+	cmd.Flags().StringVar(&opts.istioOpts.istioNamespace, "istio-namespace", "istio-system", "the namespace where the Istio control plane is installed")
+
+	return cmd
+}
@@ -0,0 +1,49 @@
+package deploy
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func setConfigCmd(ctx *context.Context, opts *options, parentPreRun func(cmd *cobra.Command, args []string)) *cobra.Command {
+	var patch string
+	cmd := &cobra.Command{
+		Use:   "set-config --id=<unique name> --patch=<json merge patch> [--namespace=<deployment namespace>]",
+		Short: "Patch the config of a deployed Istio filter in place.",
+		Long: `Applies a JSON merge patch (RFC 7386) to the config of the live Istio EnvoyFilters for the filter, without regenerating the rest of the EnvoyFilters.
+
+This is intended for imperative or emergency changes. Filters deployed with a FilterDeployment will have the patch reverted by the operator
+the next time the FilterDeployment is reconciled; update spec.filter.config on the FilterDeployment instead.
+
+If the filter was deployed with --config-checksum, the checksum is recomputed for the patched config.
+
+Example:
+
+	wasme deploy istio set-config --id=myfilter --patch='{"rateLimit": 50}'
+`,
+		Args: cobra.NoArgs,
+		// override the deploy command's check for an image argument
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			parentPreRun(cmd, args)
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.filter.Id == "" {
+				return errors.Errorf("--id cannot be empty")
+			}
+			if patch == "" {
+				return errors.Errorf("--patch cannot be empty")
+			}
+			provider, err := opts.makeIstioProvider(*ctx)
+			if err != nil {
+				return err
+			}
+			return provider.SetFilterConfig(opts.filter.Id, []byte(patch))
+		},
+	}
+	cmd.Flags().StringVar(&patch, "patch", "", "JSON merge patch to apply to the filter config. keys set to null are removed from the config.")
+
+	return cmd
+}
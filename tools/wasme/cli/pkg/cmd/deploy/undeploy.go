@@ -2,8 +2,13 @@ package deploy
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"strings"
 
 	"github.com/pkg/errors"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
 	"github.com/spf13/cobra"
 )
 
@@ -12,12 +17,18 @@ func UndeployCmd(ctx *context.Context) *cobra.Command {
 		remove: true,
 	}
 	cmd := &cobra.Command{
-		Use:   "undeploy gloo|istio --id=<unique id>",
+		Use:   "undeploy gloo|istio|envoy-k8s --id=<unique id>",
 		Short: "Remove a deployed Envoy WASM Filter from the data plane (Envoy proxies).",
 		Long: `Removes a deployed Envoy WASM Filter from Envoy instances.
 
 `,
 		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if opts.removeImage != "" {
+				if opts.filter.Id != "" {
+					return errors.Errorf("only one of --id or --image may be set")
+				}
+				return nil
+			}
 			if opts.filter.Id == "" {
 				return errors.Errorf("--id cannot be empty")
 			}
@@ -30,6 +41,7 @@ func UndeployCmd(ctx *context.Context) *cobra.Command {
 	cmd.AddCommand(
 		undeployGlooCmd(ctx, opts),
 		undeployIstioCmd(ctx, opts),
+		undeployEnvoyK8sCmd(ctx, opts),
 	)
 
 	return cmd
@@ -42,7 +54,8 @@ func undeployGlooCmd(ctx *context.Context, opts *options) *cobra.Command {
 
 Use --namespaces to constrain the namespaces of Gateway CRs to update.
 
-Use --labels to use a match Gateway CRs by label.
+Use --gateway-name and --gateway-labels to match Gateway CRs by name and by label.
+The filter is only removed from the Gateway CRs it was deployed to by wasme.
 `
 	return makeDeployCommand(ctx, opts,
 		Provider_Gloo,
@@ -55,15 +68,21 @@ Use --labels to use a match Gateway CRs by label.
 }
 
 func undeployIstioCmd(ctx *context.Context, opts *options) *cobra.Command {
-	use := "istio --id=<unique name> --namespace=<deployment namespace> [--name=<deployment name>]"
+	use := "istio --id=<unique name>|--image=<image>|--id-prefix=<prefix>|--all --namespace=<deployment namespace> [--name=<deployment name>]"
 	short := "Remove an Envoy WASM Filter from the Istio Sidecar Proxies (Envoy)."
 	long := `wasme uses the Istio EnvoyFilter CR to pull and run wasm filters.
 
 Use --namespace to target workload(s) in a the namespaces of Gateway CRs to update.
 Use --name to target a specific workload (deployment or daemonset) in the target namespace. If unspecified, all deployments 
 in the namespace will be targeted.
+Use --image instead of --id to remove every filter deployed from the image, whatever its id. The image may be
+referenced by tag or digest.
+Use --all instead of --id to remove every filter deployed by wasme from the targeted workloads, or --id-prefix
+to remove the filters whose id starts with the prefix. The removed filters are printed once they are removed,
+or listed without removing them with --dry-run. The sidecar annotations are removed once from each workload
+with no filters left, restoring the annotations wasme replaced.
 `
-	return makeDeployCommand(ctx, opts,
+	cmd := makeDeployCommand(ctx, opts,
 		Provider_Istio,
 		use,
 		short,
@@ -71,4 +90,110 @@ in the namespace will be targeted.
 		0,
 		opts.providerOptions.istioOpts.addToFlags,
 	)
+	cmd.Flags().StringVar(&opts.removeImage, "image", "", "remove the filters deployed from this image from the selected workloads, instead of the filter with the given --id.")
+	cmd.Flags().BoolVar(&opts.removeAll, "all", false, "remove every filter deployed by wasme from the selected workloads, instead of the filter with the given --id.")
+	cmd.Flags().StringVar(&opts.removeIdPrefix, "id-prefix", "", "remove the filters whose id starts with this prefix from the selected workloads, instead of the filter with the given --id.")
+
+	removeById := cmd.RunE
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		var selectors int
+		for _, set := range []bool{opts.filter.Id != "", opts.removeImage != "", opts.removeIdPrefix != "", opts.removeAll} {
+			if set {
+				selectors++
+			}
+		}
+		if selectors > 1 {
+			return errors.Errorf("only one of --id, --image, --id-prefix or --all may be set")
+		}
+		switch {
+		case opts.removeImage != "":
+			return runRemoveByImage(*ctx, opts)
+		case opts.removeIdPrefix != "" || opts.removeAll:
+			return runRemoveFilters(*ctx, opts)
+		}
+		return removeById(cmd, args)
+	}
+	return cmd
+}
+
+func undeployEnvoyK8sCmd(ctx *context.Context, opts *options) *cobra.Command {
+	use := "envoy-k8s --id=<unique name> --deployment=<deployment name> --configmap=<bootstrap configmap> [--namespace=<namespace>]"
+	short := "Remove an Envoy WASM Filter from a Deployment of Envoy configured by a static bootstrap config."
+	long := `Removes the filter deployed by wasme deploy envoy-k8s from the static listeners of the bootstrap config
+in the ConfigMap, and the volume of its module from the Deployment, restarting the pods with the updated config.
+The filter is only removed from the Deployments it was deployed to by wasme.
+`
+	cmd := makeDeployCommand(ctx, opts,
+		Provider_EnvoyK8s,
+		use,
+		short,
+		long,
+		0,
+		opts.envoyK8sOpts.addDeploymentToFlags,
+	)
+	cmd.PreRunE = func(cmd *cobra.Command, args []string) error {
+		return opts.envoyK8sOpts.validate()
+	}
+	return cmd
+}
+
+func runRemoveFilters(ctx context.Context, opts *options) error {
+	provider, err := opts.makeIstioProvider(ctx)
+	if err != nil {
+		return err
+	}
+
+	var filters []istio.DeployedFilter
+	if opts.dryRun {
+		filters, err = provider.ListFilters(opts.removeIdPrefix)
+	} else {
+		filters, err = provider.RemoveFilters(opts.removeIdPrefix)
+	}
+	if err != nil {
+		return err
+	}
+	if len(filters) == 0 {
+		if opts.removeIdPrefix != "" {
+			fmt.Printf("no filters with an id starting with %v were found\n", opts.removeIdPrefix)
+		} else {
+			fmt.Printf("no filters deployed by wasme were found\n")
+		}
+		return nil
+	}
+
+	if opts.dryRun {
+		fmt.Printf("would remove %v filters:\n", len(filters))
+	} else {
+		fmt.Printf("removed %v filters:\n", len(filters))
+	}
+	return deploy.PrintDeployedFilters(os.Stdout, filters)
+}
+
+func runRemoveByImage(ctx context.Context, opts *options) error {
+	if opts.dryRun {
+		return errors.Errorf("--dry-run cannot be used with --image")
+	}
+	if err := opts.ReadPasswordStdin(os.Stdin); err != nil {
+		return err
+	}
+	var err error
+	opts.istioOpts.puller, err = opts.makePuller()
+	if err != nil {
+		return err
+	}
+
+	provider, err := opts.makeIstioProvider(ctx)
+	if err != nil {
+		return err
+	}
+	removed, err := provider.RemoveFilterByImage(opts.removeImage)
+	if err != nil {
+		return err
+	}
+	if len(removed) == 0 {
+		fmt.Printf("no filters deployed from %v were found\n", opts.removeImage)
+		return nil
+	}
+	fmt.Printf("removed filters %v\n", strings.Join(removed, ", "))
+	return nil
 }
@@ -0,0 +1,190 @@
+package describe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cmd/opts"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy"
+	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
+	"github.com/solo-io/wasm/tools/wasme/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+const (
+	outputTable = "table"
+	outputJson  = "json"
+)
+
+type describeOptions struct {
+	ref        string
+	output     string
+	storageDir string
+	noCache    bool
+
+	*opts.AuthOptions
+}
+
+func DescribeCmd(ctx *context.Context, loginOptions *opts.AuthOptions) *cobra.Command {
+	var opts describeOptions
+	opts.AuthOptions = loginOptions
+	cmd := &cobra.Command{
+		Use:   "describe <name:tag|name@digest>",
+		Short: "Print the digest, layers, annotations and config of a wasm image without pulling its module",
+		Long: `Print the digest, layers, annotations and config of a wasm image, including the ABI versions, root ids, description, docs URL and default config of the filter.
+The variants of multi-variant images are listed, and the digest, layers and config are those of the default variant.
+Only the manifest and config of the image are fetched, and they are read from the local storage directory once they are stored in it.
+If the config of the image declares no ABI versions, e.g. images built by other tools, the module is fetched to infer its ABI versions.
+`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.ref = args[0]
+			return runDescribe(*ctx, opts)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.output, "output", "o", outputTable, "output format, one of "+outputTable+", "+outputJson)
+	cmd.Flags().StringVar(&opts.storageDir, "store", "", "Set the path to the local storage directory for wasm images. Defaults to $HOME/.wasme/store")
+	cmd.Flags().BoolVar(&opts.noCache, "no-cache", false, "Fetch the manifest and config of the image from the registry, rather than reading them from the local storage directory")
+
+	return cmd
+}
+
+func runDescribe(ctx context.Context, opts describeOptions) error {
+	if opts.output != outputTable && opts.output != outputJson {
+		return errors.Errorf("invalid --output %v, must be %v or %v", opts.output, outputTable, outputJson)
+	}
+	if err := opts.ReadPasswordStdin(os.Stdin); err != nil {
+		return err
+	}
+
+	var blobs pull.BlobStore
+	if !opts.noCache {
+		blobs = store.NewBlobStore(opts.storageDir)
+	}
+	inspector, err := opts.NewInspector(blobs)
+	if err != nil {
+		return err
+	}
+	info, err := inspector.Inspect(ctx, opts.ref)
+	if err != nil {
+		return err
+	}
+	var inferredAbiVersions []string
+	if len(info.Config.GetAbiVersions()) == 0 {
+		inferredAbiVersions = inferAbiVersions(ctx, opts, blobs)
+	}
+
+	if opts.output == outputJson {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			*pull.ImageInfo
+			InferredAbiVersions []string `json:"inferredAbiVersions,omitempty"`
+		}{ImageInfo: info, InferredAbiVersions: inferredAbiVersions})
+	}
+	return writeInfoTable(os.Stdout, info, inferredAbiVersions)
+}
+
+// fetches the module of the image to infer its ABI versions, nil if they cannot be inferred
+func inferAbiVersions(ctx context.Context, opts describeOptions, blobs pull.BlobStore) []string {
+	puller, err := opts.NewPuller(blobs)
+	if err != nil {
+		logrus.WithError(err).Debugf("failed to create the puller to infer the ABI versions of the module")
+		return nil
+	}
+	image, err := puller.Pull(ctx, opts.ref)
+	if err != nil {
+		logrus.WithError(err).Debugf("failed to pull the image to infer the ABI versions of the module")
+		return nil
+	}
+	return deploy.InferAbiVersions(ctx, image)
+}
+
+func writeInfoTable(out io.Writer, info *pull.ImageInfo, inferredAbiVersions []string) error {
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 0, 0, ' ', 0)
+
+	var defaultConfig string
+	if info.Config.GetDefaultConfig() != nil {
+		var err error
+		defaultConfig, err = (&jsonpb.Marshaler{}).MarshalToString(info.Config.GetDefaultConfig())
+		if err != nil {
+			return err
+		}
+	}
+
+	configType := info.Config.GetType()
+	if !info.HasConfig {
+		configType = "none, the image has no wasme config"
+	}
+	fmt.Fprintf(w, "IMAGE: \t%v\n", info.Ref)
+	if info.Index != nil {
+		fmt.Fprintf(w, "INDEX: \t%v\n", info.Index.Digest)
+	}
+	fmt.Fprintf(w, "DIGEST: \t%v\n", info.Manifest.Digest)
+	fmt.Fprintf(w, "MODULE: \t%v (%v bytes)\n", info.Module.Digest, info.Module.Size)
+	fmt.Fprintf(w, "CONFIG: \t%v\n", configType)
+	abiVersions := orNone(strings.Join(info.Config.GetAbiVersions(), ", "))
+	if len(inferredAbiVersions) > 0 {
+		abiVersions = strings.Join(inferredAbiVersions, ", ") + " (inferred from the module)"
+	}
+	fmt.Fprintf(w, "ABI VERSIONS: \t%v\n", abiVersions)
+	fmt.Fprintf(w, "ROOT IDS: \t%v\n", orNone(strings.Join(info.Config.GetConfig().GetRootIds(), ", ")))
+	fmt.Fprintf(w, "DESCRIPTION: \t%v\n", orNone(info.Config.GetDescription()))
+	fmt.Fprintf(w, "DOCS: \t%v\n", orNone(info.Config.GetDocsUrl()))
+	fmt.Fprintf(w, "DEFAULT CONFIG: \t%v\n", orNone(defaultConfig))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "\nLAYERS:\n")
+	fmt.Fprintf(w, "MEDIA TYPE \tDIGEST \tSIZE\n")
+	for _, blob := range info.Blobs {
+		fmt.Fprintf(w, "%v \t%v \t%v\n", blob.MediaType, blob.Digest, blob.Size)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(info.Variants) > 0 {
+		fmt.Fprintf(out, "\nVARIANTS:\n")
+		fmt.Fprintf(w, "DIGEST \tABI VERSIONS\n")
+		for _, variant := range info.Variants {
+			fmt.Fprintf(w, "%v \t%v\n", variant.Manifest.Digest, orNone(strings.Join(variant.AbiVersions, ", ")))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(info.Annotations) == 0 {
+		return nil
+	}
+	fmt.Fprintf(out, "\nANNOTATIONS:\n")
+	var keys []string
+	for key := range info.Annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%v \t%v\n", key, info.Annotations[key])
+	}
+	return w.Flush()
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
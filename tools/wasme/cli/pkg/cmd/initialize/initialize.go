@@ -13,8 +13,12 @@ The current steps required to add a new language:
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/manifoldco/promptui"
@@ -152,6 +156,7 @@ type initOptions struct {
 	language      string
 	platform      abi.Platform
 	disablePrompt bool
+	listTemplates bool
 
 	// set by PreRun
 	compatiblePlatforms compatiblePlatforms
@@ -169,33 +174,48 @@ C++.
 The provided --platform flag will determine the target platform used for the new filter. This is important to 
 ensure compatibility between the filter and the 
 
-If --language, --platform, or --platform-version are not provided, the CLI will present an interactive prompt. Disable the prompt with --disable-prompt
+If --language or --platform are not provided, the CLI will present an interactive prompt. Disable the prompt with --disable-prompt.
+If --platform is provided without --platform-version, the newest version of the platform supported by the language is used.
+
+The templates are embedded in the CLI, so init does not require network access. List them with --list-templates.
 
 `,
-		Args: cobra.MinimumNArgs(1),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if opts.listTemplates {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.ExactArgs(1)(cmd, args)
+		},
 		PreRunE: func(cmd *cobra.Command, args []string) error {
-			if !opts.disablePrompt {
-				var err error
-				if opts.language == "" {
-					opts.language, err = selectLanguageInteractive()
-					if err != nil {
-						return err
-					}
+			if opts.listTemplates {
+				return nil
+			}
+			var err error
+			if opts.language == "" {
+				if opts.disablePrompt {
+					return errors.Errorf("--language is required when the prompt is disabled")
 				}
-				if opts.platform.Name == "" || opts.platform.Version == "" {
-					opts.compatiblePlatforms, err = selectCompatiblePlatformsInteractive(opts.language)
-					if err != nil {
-						return err
-					}
-				} else {
-					opts.compatiblePlatforms = compatiblePlatforms{opts.platform}
+				opts.language, err = selectLanguageInteractive()
+				if err != nil {
+					return err
 				}
 			}
-			return nil
+			switch {
+			case opts.platform.Name != "":
+				// the platform is selected by the flags, so the prompts are skipped
+				opts.compatiblePlatforms, err = selectPlatform(opts.language, opts.platform)
+			case opts.platform.Version != "":
+				return errors.Errorf("--platform-version requires --platform")
+			case opts.disablePrompt:
+				return errors.Errorf("--platform is required when the prompt is disabled")
+			default:
+				opts.compatiblePlatforms, err = selectCompatiblePlatformsInteractive(opts.language)
+			}
+			return err
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if len(args) == 0 {
-				return fmt.Errorf("invalid number of arguments")
+			if opts.listTemplates {
+				return listTemplates(cmd.OutOrStdout())
 			}
 			opts.destDir = args[0]
 			return runInit(opts)
@@ -209,11 +229,14 @@ If --language, --platform, or --platform-version are not provided, the CLI will
 		fmt.Sprintf("The name of the target platform against which to build. Supported platforms are: %v", []string{"gloo", "istio"}))
 
 	cmd.PersistentFlags().StringVar(&opts.platform.Version, "platform-version", "",
-		fmt.Sprintf("The version of the target platform against which to build. Supported Istio versions are: %v. Supported Gloo versions are: %v", []string{abi.Version15x, abi.Version16x, abi.Version17x, abi.Version18x}, []string{abi.Version13x, abi.Version15x, abi.Version16x}))
+		fmt.Sprintf("The version of the target platform against which to build. Supported Istio versions are: %v. Supported Gloo versions are: %v. Defaults to the newest version of the platform supported by the language", []string{abi.Version15x, abi.Version16x, abi.Version17x, abi.Version18x}, []string{abi.Version13x, abi.Version15x, abi.Version16x}))
 
 	cmd.PersistentFlags().BoolVar(&opts.disablePrompt, "disable-prompt", false,
 		"Disable the interactive prompt if a required parameter is not passed. If set to true and one of the required flags is not provided, wasme CLI will return an error.")
 
+	cmd.PersistentFlags().BoolVar(&opts.listTemplates, "list-templates", false,
+		"Print the available templates as JSON, listing the platforms supported by each template of each language, rather than initializing a project directory")
+
 	return cmd
 }
 
@@ -235,6 +258,88 @@ func runInit(opts initOptions) error {
 	return util.Untar(destDir, reader)
 }
 
+// the platform of a template, as listed by --list-templates
+type templatePlatform struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// a template, as listed by --list-templates
+type template struct {
+	Language  string             `json:"language"`
+	Platforms []templatePlatform `json:"platforms"`
+}
+
+// prints the templates of each language as JSON
+func listTemplates(out io.Writer) error {
+	templates := []template{}
+	for _, language := range supportedLanguages {
+		for _, base := range availableBases[language] {
+			listed := template{Language: language}
+			for _, platform := range base.compatiblePlatforms {
+				listed.Platforms = append(listed.Platforms, templatePlatform{Name: platform.Name, Version: platform.Version})
+			}
+			templates = append(templates, listed)
+		}
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(templates)
+}
+
+// returns the platform selected by the flags, defaulting its version to the newest version supported by the language
+func selectPlatform(language string, platform abi.Platform) (compatiblePlatforms, error) {
+	bases, ok := availableBases[language]
+	if !ok {
+		return nil, errors.Errorf("%v is not a supported language. available: %v", language, supportedLanguages)
+	}
+
+	var versions []string
+	for _, base := range bases {
+		for _, supported := range base.compatiblePlatforms {
+			if supported.Name == platform.Name {
+				versions = append(versions, supported.Version)
+			}
+		}
+	}
+	if len(versions) == 0 {
+		return nil, errors.Errorf("language %v does not support platform %v", language, platform.Name)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versionLess(versions[i], versions[j])
+	})
+
+	if platform.Version == "" {
+		platform.Version = versions[len(versions)-1]
+		log.Infof("using %v version %v", platform.Name, platform.Version)
+	}
+	for _, version := range versions {
+		if version == platform.Version {
+			return compatiblePlatforms{platform}, nil
+		}
+	}
+	return nil, errors.Errorf("language %v does not support %v version %v. supported versions: %v", language, platform.Name, platform.Version, versions)
+}
+
+// compares x versions such as 1.5.x by their numeric components
+func versionLess(a, b string) bool {
+	aParts, bParts := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		aNum, aErr := strconv.Atoi(aParts[i])
+		bNum, bErr := strconv.Atoi(bParts[i])
+		if aErr != nil || bErr != nil {
+			if aParts[i] != bParts[i] {
+				return aParts[i] < bParts[i]
+			}
+			continue
+		}
+		if aNum != bNum {
+			return aNum < bNum
+		}
+	}
+	return len(aParts) < len(bParts)
+}
+
 func selectLanguageInteractive() (string, error) {
 	return selectValueInteractive(
 		"What language do you wish to use for the filter",
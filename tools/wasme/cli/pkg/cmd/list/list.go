@@ -18,14 +18,24 @@ import (
 
 	"github.com/solo-io/wasm/tools/wasme/pkg/util"
 
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/solo-io/wasm/tools/wasme/pkg/store"
 	"github.com/spf13/cobra"
 )
 
+const (
+	outputTable = "table"
+	outputWide  = "wide"
+	outputJson  = "json"
+	outputYaml  = "yaml"
+)
+
 type listOpts struct {
 	published  bool
 	wide       bool
+	output     string
 	showDir    bool
 	server     string
 	search     string
@@ -44,7 +54,8 @@ func ListCmd() *cobra.Command {
 	}
 
 	cmd.Flags().BoolVarP(&opts.published, "published", "", false, "Set to true to list images that have been published to a remote registry. If unset, lists images stored in local image cache.")
-	cmd.Flags().BoolVarP(&opts.wide, "wide", "w", false, "Set to true to list images with their full tag length.")
+	cmd.Flags().BoolVarP(&opts.wide, "wide", "w", false, "Set to true to list images with their full tag length. Same as --output=wide.")
+	cmd.Flags().StringVarP(&opts.output, "output", "o", outputTable, "Output format, one of "+strings.Join([]string{outputTable, outputWide, outputJson, outputYaml}, ", ")+". wide prints the full tags and digests, json and yaml print every field of the images.")
 	cmd.Flags().BoolVarP(&opts.showDir, "show-dir", "d", false, "Set to true to show the local directories for images. Does not apply to published images.")
 	cmd.Flags().StringVarP(&opts.server, "server", "s", consts.HubDomain, "If using --published, read images from this remote registry.")
 	cmd.Flags().StringVarP(&opts.search, "search", "", "", "Search images from the remote registry. If unset, `wasme list --published` will return all public repositories.")
@@ -54,6 +65,12 @@ func ListCmd() *cobra.Command {
 }
 
 func runList(opts listOpts) error {
+	switch opts.output {
+	case outputTable, outputWide, outputJson, outputYaml:
+	default:
+		return errors.Errorf("invalid --output %v, must be one of %v, %v, %v or %v", opts.output, outputTable, outputWide, outputJson, outputYaml)
+	}
+
 	var images []image
 	if opts.published || opts.search != "" {
 		i, err := getPublishedImages(opts.server, opts.search)
@@ -70,19 +87,38 @@ func runList(opts listOpts) error {
 	}
 
 	sort.Slice(images, func(i, j int) bool {
-		if images[i].name < images[j].name {
+		if images[i].Name < images[j].Name {
 			return true
 		}
-		if images[i].name > images[j].name {
+		if images[i].Name > images[j].Name {
 			return false
 		}
-		return images[i].updated.Before(images[j].updated)
+		return images[i].Updated.Before(images[j].Updated)
 	})
 
-	showDir := !opts.published && opts.showDir
-
 	buf := os.Stdout
 
+	if images == nil {
+		// printed as an empty list rather than null
+		images = []image{}
+	}
+	switch opts.output {
+	case outputJson:
+		enc := json.NewEncoder(buf)
+		enc.SetIndent("", "  ")
+		return enc.Encode(images)
+	case outputYaml:
+		out, err := yaml.Marshal(images)
+		if err != nil {
+			return err
+		}
+		_, err = buf.Write(out)
+		return err
+	}
+
+	wide := opts.wide || opts.output == outputWide
+	showDir := !opts.published && opts.showDir
+
 	// create a new tabwriter
 	w := new(tabwriter.Writer)
 
@@ -94,40 +130,41 @@ func runList(opts listOpts) error {
 	}
 	fmt.Fprintf(w, line)
 	for _, image := range images {
-		image.Write(w, opts.wide, showDir)
+		image.Write(w, wide, showDir)
 	}
 	w.Flush()
 	return nil
 }
 
+// an image stored locally or published to the registry, as printed with --output=json or yaml
 type image struct {
-	name      string
-	sum       string
-	updated   time.Time
-	tag       string
-	sizeBytes int64
+	Name      string    `json:"name"`
+	Tag       string    `json:"tag"`
+	Digest    string    `json:"digest"`
+	SizeBytes int64     `json:"sizeBytes"`
+	Updated   time.Time `json:"updated"`
 
 	// only applicable for local images
-	dir string
+	Dir string `json:"directory,omitempty"`
 }
 
 func (i image) Write(w io.Writer, wide, showDir bool) {
-	sum := i.sum
-	if len(sum) > 8 {
+	sum := i.Digest
+	if !wide && len(sum) > 8 {
 		sum = strings.TrimPrefix(sum, "sha256:")[:8]
 	}
-	tag := i.tag
+	tag := i.Tag
 	if !wide && len(tag) > 32 {
 		tag = strings.TrimPrefix(tag, "sha256:")[:32] + "..."
 	}
 
 	args := []interface{}{
-		i.name, tag, byteCountSI(i.sizeBytes), sum, i.updated.Format(time.RFC822),
+		i.Name, tag, byteCountSI(i.SizeBytes), sum, i.Updated.Format(time.RFC822),
 	}
 	line := "%v \t%v \t%v \t%v \t%v\n"
 
 	if showDir {
-		args = append(args, i.dir)
+		args = append(args, i.Dir)
 		line = "%v \t%v \t%v \t%v \t%v \t%v\n"
 	}
 
@@ -164,11 +201,15 @@ func getLocalImages(storageDir string) ([]image, error) {
 
 	var images []image
 	for _, img := range storedImages {
-		name, tag, err := util.SplitImageRef(img.Ref())
+		name, tag, _, err := util.SplitImageRefDigest(img.Ref())
 		if err != nil {
 			logrus.Errorf("failed parsing image ref %v: %v", img.Ref(), err)
 			continue
 		}
+		// images pulled by digest have no tag
+		if tag == "" {
+			tag = "<none>"
+		}
 
 		descriptor, err := img.Descriptor()
 		if err != nil {
@@ -189,12 +230,12 @@ func getLocalImages(storageDir string) ([]image, error) {
 		}
 
 		images = append(images, image{
-			name:      name,
-			sum:       descriptor.Digest.String(),
-			updated:   imageInfo.ModTime(),
-			tag:       tag,
-			sizeBytes: descriptor.Size,
-			dir:       dir,
+			Name:      name,
+			Digest:    descriptor.Digest.String(),
+			Updated:   imageInfo.ModTime(),
+			Tag:       tag,
+			SizeBytes: descriptor.Size,
+			Dir:       dir,
 		})
 	}
 
@@ -224,11 +265,11 @@ func getPublishedImages(serverAddress, searchQuery string) ([]image, error) {
 		}
 		for _, tag := range tags {
 			images = append(images, image{
-				name:      serverAddress + "/" + repo.Name,
-				sum:       tag.Digest,
-				updated:   tag.PushTime,
-				tag:       tag.Name,
-				sizeBytes: tag.Size,
+				Name:      serverAddress + "/" + repo.Name,
+				Digest:    tag.Digest,
+				Updated:   tag.PushTime,
+				Tag:       tag.Name,
+				SizeBytes: tag.Size,
 			})
 		}
 	}
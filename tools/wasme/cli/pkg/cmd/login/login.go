@@ -1,10 +1,9 @@
 package login
 
 import (
-	"encoding/json"
-	"io/ioutil"
+	"context"
 	"net/http"
-	"time"
+	"os"
 
 	"github.com/manifoldco/promptui"
 
@@ -14,6 +13,7 @@ import (
 	"github.com/solo-io/wasm/tools/wasme/pkg/consts"
 
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/auth"
+	cmdopts "github.com/solo-io/wasm/tools/wasme/cli/pkg/cmd/opts"
 	"github.com/spf13/cobra"
 )
 
@@ -21,6 +21,7 @@ type loginOptions struct {
 	credentialsFile string
 	username        string
 	password        string
+	passwordStdin   bool
 	serverAddress   string
 	usePlaintext    bool
 }
@@ -28,33 +29,44 @@ type loginOptions struct {
 func LoginCmd() *cobra.Command {
 	var opts loginOptions
 	cmd := &cobra.Command{
-		Use:   "login [-s SERVER_ADDRESS] -u USERNAME -p PASSWORD ",
-		Short: "Log in so you can push images to the remote server.",
+		Use:   "login [SERVER_ADDRESS] [-u USERNAME] [-p PASSWORD | --password-stdin]",
+		Short: "Log in so you can push and pull images from a registry.",
 		Long: `
-Caches credentials for image pushes in the provided credentials-file (defaults to $HOME/.wasme/credentials.json).
+Validates the credentials against the /v2/ endpoint of the registry, and stores them in $HOME/.docker/config.json,
+or the credential helper of the registry if the docker config has one (credsStore or credHelpers).
+The credentials are stored in $HOME/.wasme/credentials.json (with 0600 permissions) if the docker config cannot be written.
+wasme push, pull and deploy read the stored credentials of the registry of the image.
 
-Provide -s=SERVER_ADDRESS to provide login credentials for a registry other than webassemblyhub.io.
+Registries which use token authentication may issue an identity token for the credentials, which is stored instead of the password.
+
+Pass SERVER_ADDRESS (or -s) to log in to a registry other than webassemblyhub.io. Prompts for the username and password if they are not set.
 
 `,
 		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runLogin(opts)
+			if len(args) == 1 {
+				opts.serverAddress = args[0]
+			}
+			return runLogin(context.TODO(), opts)
 		},
 	}
 
-	cmd.Flags().StringVar(&opts.credentialsFile, "credentials-file", "", "write to this credentials file. defaults to $HOME/.wasme/credentials.json")
+	cmd.Flags().StringVar(&opts.credentialsFile, "credentials-file", "", "write to this credentials file instead of $HOME/.docker/config.json")
 	cmd.Flags().StringVarP(&opts.username, "username", "u", "", "login username")
 	cmd.Flags().StringVarP(&opts.password, "password", "p", "", "login password")
+	cmd.Flags().BoolVar(&opts.passwordStdin, "password-stdin", false, "read the login password from stdin")
 	cmd.Flags().StringVarP(&opts.serverAddress, "server", "s", consts.HubDomain, "the address of the remote registry to which to authenticate")
 	cmd.Flags().BoolVar(&opts.usePlaintext, "plaintext", false, "use plaintext to connect to the remote registry (HTTP) rather than HTTPS")
 
 	return cmd
 }
 
-func runLogin(opts loginOptions) error {
-	if opts.credentialsFile == "" {
-		opts.credentialsFile = defaults.WasmeCredentialsFile
+func runLogin(ctx context.Context, opts loginOptions) error {
+	authOpts := &cmdopts.AuthOptions{Username: opts.username, Password: opts.password, PasswordStdin: opts.passwordStdin}
+	if err := authOpts.ReadPasswordStdin(os.Stdin); err != nil {
+		return err
 	}
+	opts.password = authOpts.Password
 	if opts.username == "" {
 		username, err := getStringInteractive("Enter username", false)
 		if err != nil {
@@ -75,65 +87,37 @@ func runLogin(opts loginOptions) error {
 		}
 		opts.password = password
 	}
-	usr, err := getCurrentUser(opts.username, opts.password, opts.serverAddress, opts.usePlaintext)
+
+	serverAddress := auth.ServerAddress(opts.serverAddress)
+	authConfig, err := auth.Login(ctx, http.DefaultClient, serverAddress, opts.username, opts.password, opts.usePlaintext)
 	if err != nil {
 		return err
 	}
-	logrus.Infof("Successfully logged in as %v (%v)", opts.username, usr.Realname)
-	if err := auth.SaveCredentials(opts.username, opts.password, opts.serverAddress, opts.credentialsFile); err != nil {
-		return err
-	}
-	logrus.Infof("stored credentials in %v", opts.credentialsFile)
-	return nil
-}
+	logrus.Infof("Successfully logged in to %v as %v", serverAddress, opts.username)
 
-func getCurrentUser(username, password, registryAddr string, usePlaintext bool) (*user, error) {
-	scheme := "https"
-	if usePlaintext {
-		scheme = "http"
-	}
-	req, err := http.NewRequest("GET", scheme+"://"+registryAddr+"/api/users/current", nil)
-	if err != nil {
-		return nil, err
-	}
-	req.SetBasicAuth(username, password)
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	if res.StatusCode != http.StatusOK {
-		return nil, errors.Errorf("non-200 status code: %vL: %v", res.StatusCode, res.Status)
-	}
-	b, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, err
+	if opts.credentialsFile != "" {
+		if err := auth.SaveCredentials(authConfig, opts.credentialsFile); err != nil {
+			return err
+		}
+		logrus.Infof("stored credentials in %v", opts.credentialsFile)
+		return nil
 	}
-	defer res.Body.Close()
 
-	var usr user
-	if err := json.Unmarshal(b, &usr); err != nil {
-		return nil, err
+	if err := auth.SaveCredentials(authConfig, defaults.DockerConfigFile); err != nil {
+		logrus.Warnf("%v, storing the credentials in %v instead", err, defaults.WasmeCredentialsFile)
+		if err := auth.SaveCredentials(authConfig, defaults.WasmeCredentialsFile); err != nil {
+			return err
+		}
+		logrus.Infof("stored credentials in %v", defaults.WasmeCredentialsFile)
+		return nil
 	}
+	logrus.Infof("stored credentials in %v", defaults.DockerConfigFile)
 
-	return &usr, nil
-}
-
-type user struct {
-	UserID          int       `json:"user_id"`
-	Username        string    `json:"username"`
-	Email           string    `json:"email"`
-	Password        string    `json:"password"`
-	PasswordVersion string    `json:"password_version"`
-	Realname        string    `json:"realname"`
-	Comment         string    `json:"comment"`
-	Deleted         bool      `json:"deleted"`
-	RoleName        string    `json:"role_name"`
-	RoleID          int       `json:"role_id"`
-	SysadminFlag    bool      `json:"sysadmin_flag"`
-	AdminRoleInAuth bool      `json:"admin_role_in_auth"`
-	ResetUUID       string    `json:"reset_uuid"`
-	CreationTime    time.Time `json:"creation_time"`
-	UpdateTime      time.Time `json:"update_time"`
+	// the credentials of the wasme credentials file are read before the docker config
+	if _, err := auth.RemoveCredentials(serverAddress, defaults.WasmeCredentialsFile); err != nil {
+		logrus.Warnf("removing the previous credentials of %v: %v", serverAddress, err)
+	}
+	return nil
 }
 
 func getStringInteractive(message string, hidden bool) (string, error) {
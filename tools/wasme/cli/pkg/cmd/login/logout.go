@@ -0,0 +1,65 @@
+package login
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/auth"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/defaults"
+	"github.com/solo-io/wasm/tools/wasme/pkg/consts"
+	"github.com/spf13/cobra"
+)
+
+type logoutOptions struct {
+	credentialsFile string
+	serverAddress   string
+}
+
+func LogoutCmd() *cobra.Command {
+	var opts logoutOptions
+	cmd := &cobra.Command{
+		Use:   "logout [SERVER_ADDRESS]",
+		Short: "Log out of a registry.",
+		Long: `
+Removes the credentials of the registry stored by wasme login from $HOME/.docker/config.json (or its credential helper)
+and $HOME/.wasme/credentials.json.
+
+Pass SERVER_ADDRESS (or -s) to log out of a registry other than webassemblyhub.io.
+
+`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 1 {
+				opts.serverAddress = args[0]
+			}
+			return runLogout(opts)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.credentialsFile, "credentials-file", "", "remove the credentials from this credentials file instead of $HOME/.docker/config.json and $HOME/.wasme/credentials.json")
+	cmd.Flags().StringVarP(&opts.serverAddress, "server", "s", consts.HubDomain, "the address of the remote registry to log out of")
+
+	return cmd
+}
+
+func runLogout(opts logoutOptions) error {
+	serverAddress := auth.ServerAddress(opts.serverAddress)
+	credentialsFiles := []string{defaults.DockerConfigFile, defaults.WasmeCredentialsFile}
+	if opts.credentialsFile != "" {
+		credentialsFiles = []string{opts.credentialsFile}
+	}
+
+	var loggedOut bool
+	for _, credentialsFile := range credentialsFiles {
+		removed, err := auth.RemoveCredentials(serverAddress, credentialsFile)
+		if err != nil {
+			return err
+		}
+		if removed {
+			logrus.Infof("removed the credentials of %v from %v", serverAddress, credentialsFile)
+			loggedOut = true
+		}
+	}
+	if !loggedOut {
+		logrus.Infof("not logged in to %v", serverAddress)
+	}
+	return nil
+}
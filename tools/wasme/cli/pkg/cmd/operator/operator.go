@@ -2,12 +2,15 @@ package operator
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/solo-io/go-utils/contextutils"
 	"github.com/solo-io/skv2/pkg/ezkube"
 	cachedeployment "github.com/solo-io/wasm/tools/wasme/cli/pkg/cache"
+	cmdopts "github.com/solo-io/wasm/tools/wasme/cli/pkg/cmd/opts"
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/events"
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/operator"
 	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1/controller"
@@ -15,12 +18,15 @@ import (
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"golang.org/x/sync/errgroup"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	zaputil "sigs.k8s.io/controller-runtime/pkg/log/zap"
 
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 
 	"github.com/spf13/cobra"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
@@ -36,9 +42,18 @@ func (f flagSetLogLevel) Type() string {
 }
 
 type operatorOpts struct {
-	cache        istio.Cache
-	logLevel     flagSetLogLevel
-	cacheTimeout time.Duration
+	cache             istio.Cache
+	logLevel          flagSetLogLevel
+	cacheTimeout      time.Duration
+	cachePollInterval time.Duration
+	abiRegistry       operator.AbiRegistryConfigMap
+	eventSink         string
+	resyncInterval    time.Duration
+	leaderElection    operator.LeaderElectionOptions
+	watchNamespaces   string
+	filterSelector    string
+	// the registry flags of the pulls of filter images
+	registry cmdopts.AuthOptions
 }
 
 func OperatorCmd(ctx *context.Context) *cobra.Command {
@@ -55,8 +70,24 @@ func OperatorCmd(ctx *context.Context) *cobra.Command {
 
 	cmd.Flags().StringVar(&opts.cache.Name, "cache-name", cachedeployment.CacheName, "name of resources for the wasm image cache server")
 	cmd.Flags().StringVar(&opts.cache.Namespace, "cache-namespace", cachedeployment.CacheNamespace, "namespace of resources for the wasm image cache server")
+	cmd.Flags().StringVar(&opts.cache.Kind, "cache-kind", "", "kind of workload running the wasm image cache server. possible values are "+istio.WorkloadTypeDaemonSet+", "+istio.WorkloadTypeDeployment+". if not set, the operator will look for either")
+	cmd.Flags().StringVar(&opts.cache.PersistentVolumeClaim, "cache-pvc", "", "name of the ReadWriteMany PersistentVolumeClaim storing the filters pulled by the wasm image cache server. the claim must exist in the namespace of each workload, bound to the same shared storage as the cache. if not set, the sidecars mount the filters from the host")
 	cmd.Flags().Var(&opts.logLevel, "log-level", "the logging level to use")
+	cmd.Flags().StringVar(&opts.abiRegistry.Name, "abi-registry-configmap", "", "name of an optional ConfigMap whose "+operator.AbiRegistryConfigMapKey+" key maps abi versions to the istio versions which support them. entries are merged into the built-in registry, taking precedence over conflicting entries.")
+	cmd.Flags().StringVar(&opts.abiRegistry.Namespace, "abi-registry-namespace", cachedeployment.CacheNamespace, "namespace of the abi registry ConfigMap")
 	cmd.Flags().DurationVar(&opts.cacheTimeout, "cache-timeout", time.Minute, "the length of time to wait for the server-side filter cache to pull the filter image before giving up with an error. set to 0 to skip the check entirely (note, this may produce a known race condition).")
+	cmd.Flags().DurationVar(&opts.cachePollInterval, "cache-poll-interval", time.Second, "the initial interval between checks of the cache events while waiting for the filter cache. the interval is doubled after each check, up to 10s, and jittered.")
+	opts.registry.AddRegistryToFlags(cmd.Flags())
+	cmd.Flags().DurationVar(&opts.resyncInterval, "resync-interval", operator.DefaultResyncInterval, "the interval at which every FilterDeployment is re-deployed, correcting filters modified or removed outside of the operator. EnvoyFilters and workloads are also watched for changes. set to 0 to disable the periodic re-deploys.")
+	cmd.Flags().BoolVar(&opts.leaderElection.Enabled, "leader-elect", true, "elect a leader among the replicas of the operator with a coordination.k8s.io Lease, so only the leader deploys filters. the other replicas serve the health endpoints, and take over once the leader stops renewing the Lease.")
+	cmd.Flags().StringVar(&opts.leaderElection.LeaseName, "leader-election-lease-name", operator.DefaultLeaseName, "name of the leader election Lease")
+	cmd.Flags().StringVar(&opts.leaderElection.LeaseNamespace, "leader-election-namespace", cachedeployment.CacheNamespace, "namespace of the leader election Lease")
+	cmd.Flags().DurationVar(&opts.leaderElection.LeaseDuration, "leader-election-lease-duration", operator.DefaultLeaseDuration, "how long the other replicas wait before taking over the Lease of a leader which stopped renewing it")
+	cmd.Flags().DurationVar(&opts.leaderElection.RenewDeadline, "leader-election-renew-deadline", operator.DefaultRenewDeadline, "how long the leader retries renewing the Lease before it stops leading and exits. must be less than the lease duration")
+	cmd.Flags().DurationVar(&opts.leaderElection.RetryPeriod, "leader-election-retry-period", operator.DefaultRetryPeriod, "the interval between the attempts to acquire or renew the Lease")
+	cmd.Flags().StringVar(&opts.watchNamespaces, "watch-namespaces", "", "comma-separated list of the namespaces in which FilterDeployments are watched. the workloads targeted by the FilterDeployments must be in these namespaces. if not set, every namespace is watched")
+	cmd.Flags().StringVar(&opts.filterSelector, "filter-selector", "", "label selector of the FilterDeployments managed by the operator, e.g. team=checkout. FilterDeployments not matching the selector are ignored, keeping their filters. if not set, every FilterDeployment is managed")
+	cmd.Flags().StringVar(&opts.eventSink, "event-sink", "", "optional URL of an HTTP sink to which CloudEvents are sent when filters are deployed, removed or fail. events are retried until delivered, without blocking reconciliation.")
 
 	return cmd
 }
@@ -75,14 +106,32 @@ func runOperator(ctx context.Context, opts operatorOpts) error {
 		return err
 	}
 
+	// the FilterDeployments managed by this operator
+	scope, err := operator.ParseWatchScope(opts.watchNamespaces, opts.filterSelector)
+	if err != nil {
+		return err
+	}
+
 	// create manager
 	mgr, err := manager.New(cfg, manager.Options{
-		Namespace:          "", // watch all namespaces
-		MetricsBindAddress: ":9091",
+		// watch all namespaces, unless the scope lists them
+		NewCache:               scope.NewCache(),
+		MetricsBindAddress:     ":9091",
+		HealthProbeBindAddress: fmt.Sprintf(":%v", operator.HealthProbePort),
 	})
 	if err != nil {
 		return err
 	}
+
+	// report ready on /readyz once the informer caches have synced and the abi registry is loaded
+	readiness := operator.NewReadinessGate()
+	if err := mgr.AddReadyzCheck("readiness-gate", readiness.Check); err != nil {
+		return err
+	}
+	// served by every replica, including those which are not the leader
+	if err := mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
+		return err
+	}
 	// add CRDs to scheme
 	if err := v1.AddToScheme(mgr.GetScheme()); err != nil {
 		return err
@@ -96,24 +145,96 @@ func runOperator(ctx context.Context, opts operatorOpts) error {
 		return err
 	}
 
+	// dynamic client, for workloads without typed clients such as OpenShift DeploymentConfigs
+	dynamicClient, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	// fail fast on a malformed abi registry
+	if err := readiness.LoadAbiRegistry(func() error {
+		_, err := operator.LoadAbiRegistry(kubeClient, opts.abiRegistry)
+		return err
+	}); err != nil {
+		return err
+	}
+
 	// ezkube client wrapper
 	client := ezkube.NewEnsurer(ezkube.NewRestClient(mgr))
 
+	var emitter *events.Emitter
+	if opts.eventSink != "" {
+		emitter = events.NewEmitter(events.NewHTTPTransport(opts.eventSink), "wasme-operator", events.EmitterOptions{})
+		emitter.Start(ctx)
+	}
+
+	// served on the metrics endpoint of the manager
+	providerMetrics, err := istio.NewMetrics(metrics.Registry)
+	if err != nil {
+		return err
+	}
+	reconcileMetrics, err := operator.NewReconcileMetrics(metrics.Registry)
+	if err != nil {
+		return err
+	}
+
 	// create handler
 	handler := operator.NewFilterDeploymentHandler(
 		ctx,
 		kubeClient,
+		dynamicClient,
 		client,
+		// only created once a FilterDeployment deploys to Gloo
+		operator.NewGatewayClientFunc(scope),
 		opts.cache,
 		opts.cacheTimeout,
+		opts.cachePollInterval,
+		opts.abiRegistry,
+		emitter,
+		mgr.GetEventRecorderFor("wasme-operator"),
+		providerMetrics,
+		reconcileMetrics,
+		operator.PullOptions{
+			Registry: opts.registry.RegistryOptions(),
+			Timeout:  opts.registry.PullTimeout,
+		},
+		scope,
 	)
 
-	eg := &errgroup.Group{}
+	// only the leader handles the events
+	gate := operator.NewLeaderGate(handler)
+
+	// re-deploy filters when the ConfigMaps their config is read from change
+	if err := operator.AddConfigMapWatch(ctx, mgr, gate); err != nil {
+		return err
+	}
+
+	// re-deploy filters when their EnvoyFilters or workloads are changed, and periodically
+	if err := operator.AddDriftWatch(ctx, mgr, gate, opts.resyncInterval); err != nil {
+		return err
+	}
+
+	// stop the manager if the replica loses the leader election
+	eg, egCtx := errgroup.WithContext(ctx)
+	eg.Go(func() error {
+		return ctl.AddEventHandler(ctx, gate, scope.Predicate())
+	})
 	eg.Go(func() error {
-		return ctl.AddEventHandler(ctx, handler)
+		return mgr.Start(egCtx.Done())
 	})
 	eg.Go(func() error {
-		return mgr.Start(ctx.Done())
+		readiness.WaitForSync(egCtx.Done(), mgr.GetCache().WaitForCacheSync)
+		return nil
 	})
+	if opts.leaderElection.Enabled {
+		eg.Go(func() error {
+			// the events received before the replica became the leader were dropped
+			return operator.RunLeaderElection(egCtx, kubeClient, opts.leaderElection, gate, func() {
+				operator.Resync(ctx, mgr.GetClient(), gate)
+			})
+		})
+	} else {
+		gate.Open()
+	}
 	return eg.Wait()
 }
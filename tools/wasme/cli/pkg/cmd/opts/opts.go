@@ -1,6 +1,22 @@
 package opts
 
-import "github.com/spf13/pflag"
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/pkg/errors"
+	cliprogress "github.com/solo-io/wasm/tools/wasme/cli/pkg/progress"
+	"github.com/solo-io/wasm/tools/wasme/pkg/progress"
+	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
+	"github.com/solo-io/wasm/tools/wasme/pkg/push"
+	"github.com/solo-io/wasm/tools/wasme/pkg/resolver"
+	"github.com/spf13/pflag"
+)
 
 type GeneralOptions struct {
 	Verbose bool
@@ -14,14 +30,189 @@ type AuthOptions struct {
 	CredentialsFiles []string
 	Username         string
 	Password         string
-	Insecure         bool
-	PlainHTTP        bool
+	PasswordStdin    bool
+	// the registry hosts whose certificates are not verified, or resolver.AllHosts
+	InsecureHosts []string
+	// the registry hosts which are connected to over plain HTTP, or resolver.AllHosts
+	PlainHTTPHosts []string
+	// CA bundles trusted when connecting to registries
+	RegistryCAFiles []string
+	// the proxy registries are connected through, instead of the proxy of the environment
+	RegistryProxy          string
+	RegistryRequestTimeout time.Duration
+	RegistryRetry          resolver.RetryOptions
+	// the maximum length of time of each pull, zero if pulls do not time out
+	PullTimeout time.Duration
+	// registry mirrors in the format <host>=<mirror>, and the file of mirrors
+	RegistryMirrors     []string
+	RegistryMirrorsFile string
+
+	// do not report the progress of transfers
+	Quiet bool
+	// reports the progress of transfers unless Quiet is set. if nil, the progress is printed to stderr
+	Progress progress.Func
+	// fetch every blob of the pulled images when they are pulled, rather than when they are read
+	Prefetch bool
+
+	// set by the deprecated --insecure flag
+	deprecatedInsecureHosts []string
 }
 
 func (opts *AuthOptions) AddToFlags(flags *pflag.FlagSet) {
 	flags.StringArrayVarP(&opts.CredentialsFiles, "config", "c", nil, "path to auth config")
-	flags.StringVarP(&opts.Username, "username", "u", "", "registry username")
-	flags.StringVarP(&opts.Password, "password", "p", "", "registry password")
-	flags.BoolVarP(&opts.Insecure, "insecure", "", false, "allow connections to SSL registry without certs")
-	flags.BoolVarP(&opts.PlainHTTP, "plain-http", "", false, "use plain http and not https")
+	flags.StringVarP(&opts.Username, "username", "u", "", "registry username. overrides the credentials of the auth configs")
+	flags.StringVarP(&opts.Password, "password", "p", "", "registry password. overrides the credentials of the auth configs")
+	flags.BoolVarP(&opts.PasswordStdin, "password-stdin", "", false, "read the registry password from stdin")
+	opts.AddRegistryToFlags(flags)
+	opts.AddProgressToFlags(flags)
+
+	flags.StringSliceVar(&opts.deprecatedInsecureHosts, "insecure", nil, "allow connections to SSL registry without certs")
+	flags.Lookup("insecure").NoOptDefVal = resolver.AllHosts
+	flags.MarkDeprecated("insecure", "use --insecure-skip-verify instead")
+}
+
+// AddRegistryToFlags adds the flags which configure the connections to registries.
+// the flags apply to every registry host if they are set without a value
+func (opts *AuthOptions) AddRegistryToFlags(flags *pflag.FlagSet) {
+	flags.StringSliceVar(&opts.PlainHTTPHosts, "plain-http", nil, "use plain http and not https to connect to the given registry hosts, e.g. --plain-http=registry.corp:5000, or to every registry if no hosts are given")
+	flags.Lookup("plain-http").NoOptDefVal = resolver.AllHosts
+	flags.StringSliceVar(&opts.InsecureHosts, "insecure-skip-verify", nil, "allow connections to the given registry hosts without verifying their certificates, e.g. --insecure-skip-verify=registry.corp, or to every registry if no hosts are given")
+	flags.Lookup("insecure-skip-verify").NoOptDefVal = resolver.AllHosts
+	flags.StringArrayVar(&opts.RegistryCAFiles, "registry-ca", nil, "path to a PEM bundle of CA certificates to trust in addition to the system roots when connecting to registries. may be repeated")
+	flags.StringVar(&opts.RegistryProxy, "registry-proxy", "", "URL of a proxy to connect to registries through. if not set, the proxy of the HTTPS_PROXY environment variable is used for the registries which are not excluded by NO_PROXY")
+	flags.DurationVar(&opts.RegistryRequestTimeout, "registry-request-timeout", 0, "if non-zero, the length of time after which a request to a registry is aborted, including reading the response. aborted requests are retried")
+	flags.IntVar(&opts.RegistryRetry.MaxAttempts, "registry-retry-attempts", resolver.DefaultMaxAttempts, "the number of attempts of each request to a registry which fails with a connection error or a retryable status. set to 1 to disable retries")
+	flags.DurationVar(&opts.RegistryRetry.InitialBackoff, "registry-retry-backoff", resolver.DefaultInitialBackoff, "the delay before retrying a failed request to a registry. the delay is doubled after each attempt, up to "+resolver.DefaultMaxBackoff.String())
+	flags.IntSliceVar(&opts.RegistryRetry.StatusCodes, "registry-retry-status-codes", resolver.DefaultRetryableStatusCodes, "the statuses of the responses of registries which are retried")
+	flags.StringArrayVar(&opts.RegistryMirrors, "registry-mirror", nil, "a mirror of a registry in the format <registry host>=<mirror host>[/<repository prefix>], e.g. webassemblyhub.io=registry.corp/wasm-mirror. images are pulled from the mirrors of their registry in order, falling back to the registry. may be repeated")
+	flags.StringVar(&opts.RegistryMirrorsFile, "registry-mirrors-file", "", "path to a YAML file mapping registry hosts to their mirrors, e.g. 'mirrors: {webassemblyhub.io: [registry.corp/wasm-mirror]}'. the mirrors of the file are tried after the mirrors of --registry-mirror")
+	flags.DurationVar(&opts.PullTimeout, "pull-timeout", 5*time.Minute, "the length of time after which pulling an image, or fetching its content, is aborted, including the retries of the requests to the registry. set to 0 to disable the timeout")
+}
+
+// AddProgressToFlags adds the flag which disables the progress of transfers
+func (opts *AuthOptions) AddProgressToFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&opts.Quiet, "quiet", false, "do not print the progress of the transfers of images. the progress is printed as bars if stderr is a terminal, or else as percentages")
+}
+
+// ProgressFunc returns the function reporting the progress of transfers, or nil if Quiet is set
+func (opts *AuthOptions) ProgressFunc() progress.Func {
+	if opts.Quiet {
+		return nil
+	}
+	if opts.Progress != nil {
+		return opts.Progress
+	}
+	return cliprogress.NewTerminal(os.Stderr)
+}
+
+// RegistryOptions returns the connection settings of the registry flags
+func (opts *AuthOptions) RegistryOptions() resolver.RegistryOptions {
+	return resolver.RegistryOptions{
+		PlainHTTPHosts: registryHosts(opts.PlainHTTPHosts),
+		InsecureHosts:  append(registryHosts(opts.InsecureHosts), registryHosts(opts.deprecatedInsecureHosts)...),
+		CAFiles:        opts.RegistryCAFiles,
+		Proxy:          opts.RegistryProxy,
+		RequestTimeout: opts.RegistryRequestTimeout,
+		Retry:          opts.RegistryRetry,
+		Mirrors:        opts.RegistryMirrors,
+		MirrorsFile:    opts.RegistryMirrorsFile,
+	}
+}
+
+// the registry flags were bools, so --plain-http=true applies to every host
+func registryHosts(hosts []string) []string {
+	var result []string
+	for _, host := range hosts {
+		switch host {
+		case "true":
+			result = append(result, resolver.AllHosts)
+		case "false", "":
+		default:
+			result = append(result, host)
+		}
+	}
+	return result
+}
+
+// NewResolver returns a resolver which authenticates with the username and password if either is set, or else the
+// credentials of the credentials files, and connects to registries as configured by the registry flags
+func (opts *AuthOptions) NewResolver() (remotes.Resolver, docker.Authorizer, error) {
+	credentials := resolver.ConfigCredentials(opts.Username, opts.Password, opts.CredentialsFiles...)
+	return resolver.NewResolverWithOptions(credentials, opts.RegistryOptions())
+}
+
+// NewPuller returns a puller which pulls images with the resolver of the options, and times out after the pull timeout.
+// the puller reads the content of images from the blob store if it is not nil
+func (opts *AuthOptions) NewPuller(blobs pull.BlobStore) (pull.ImagePuller, error) {
+	res, _, err := opts.NewResolver()
+	if err != nil {
+		return nil, err
+	}
+	return pull.NewPullerWithOptions(res, pull.Options{
+		BlobStore: blobs,
+		Timeout:   opts.PullTimeout,
+		Progress:  opts.ProgressFunc(),
+		Prefetch:  opts.Prefetch,
+	}), nil
+}
+
+// NewInspector returns an inspector which inspects images with the resolver of the options, and times out after the pull timeout.
+// the inspector reads the manifests and configs of images from the blob store if it is not nil
+func (opts *AuthOptions) NewInspector(blobs pull.BlobStore) (pull.ImageInspector, error) {
+	res, _, err := opts.NewResolver()
+	if err != nil {
+		return nil, err
+	}
+	return pull.NewPullerWithOptions(res, pull.Options{
+		BlobStore: blobs,
+		Timeout:   opts.PullTimeout,
+		Progress:  opts.ProgressFunc(),
+	}), nil
+}
+
+// NewCopier returns a copier which copies and tags images in registries with the resolver of the options
+func (opts *AuthOptions) NewCopier() (push.Copier, error) {
+	res, _, err := opts.NewResolver()
+	if err != nil {
+		return nil, err
+	}
+	return push.NewCopier(res, opts.ProgressFunc()), nil
+}
+
+// NewLister returns a lister which lists the tags of repositories with the credentials and registry settings of the options,
+// requesting pages of pageSize tags
+func (opts *AuthOptions) NewLister(pageSize int) (pull.Lister, error) {
+	credentials := resolver.ConfigCredentials(opts.Username, opts.Password, opts.CredentialsFiles...)
+	hosts, err := resolver.NewRegistryHostsWithOptions(credentials, opts.RegistryOptions())
+	if err != nil {
+		return nil, err
+	}
+	return pull.NewLister(hosts, pageSize), nil
+}
+
+// AddCredentialsToFlags adds only the flags which override the registry credentials, without shorthands,
+// for commands whose other flags conflict with the auth flags
+func (opts *AuthOptions) AddCredentialsToFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&opts.Username, "username", "", "registry username. overrides the credentials of $HOME/.docker/config.json")
+	flags.StringVar(&opts.Password, "password", "", "registry password. overrides the credentials of $HOME/.docker/config.json")
+	flags.BoolVar(&opts.PasswordStdin, "password-stdin", false, "read the registry password from stdin")
+}
+
+// ReadPasswordStdin sets the password to the contents of in if --password-stdin is set
+func (opts *AuthOptions) ReadPasswordStdin(in io.Reader) error {
+	if !opts.PasswordStdin {
+		return nil
+	}
+	if opts.Password != "" {
+		return errors.Errorf("--password and --password-stdin are mutually exclusive")
+	}
+	if opts.Username == "" {
+		return errors.Errorf("--username must be set with --password-stdin")
+	}
+	password, err := ioutil.ReadAll(in)
+	if err != nil {
+		return errors.Wrap(err, "reading the password from stdin")
+	}
+	opts.Password = strings.TrimRight(string(password), "\r\n")
+	return nil
 }
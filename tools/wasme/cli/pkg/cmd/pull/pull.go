@@ -2,19 +2,20 @@ package pull
 
 import (
 	"context"
+	"os"
 
 	"github.com/sirupsen/logrus"
 	"github.com/solo-io/wasm/tools/wasme/pkg/store"
 
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cmd/opts"
 	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
-	"github.com/solo-io/wasm/tools/wasme/pkg/resolver"
 	"github.com/spf13/cobra"
 )
 
 type pullOptions struct {
 	ref        string
 	storageDir string
+	noCache    bool
 
 	*opts.AuthOptions
 }
@@ -35,15 +36,25 @@ func PullCmd(ctx *context.Context, loginOptions *opts.AuthOptions) *cobra.Comman
 	}
 
 	cmd.Flags().StringVar(&opts.storageDir, "store", "", "Set the path to the local storage directory for wasm images. Defaults to $HOME/.wasme/store")
+	cmd.Flags().BoolVar(&opts.noCache, "no-cache", false, "Fetch every blob of the image from the registry, rather than reading the blobs which did not change from the local storage directory")
 
 	return cmd
 }
 
 func runPull(ctx context.Context, opts pullOptions) error {
+	if err := opts.ReadPasswordStdin(os.Stdin); err != nil {
+		return err
+	}
 	logrus.Infof("Pulling image %v", opts.ref)
 
-	resolver, _ := resolver.NewResolver(opts.Username, opts.Password, opts.Insecure, opts.PlainHTTP, opts.CredentialsFiles...)
-	var puller pull.ImagePuller = pull.NewPuller(resolver)
+	var blobs pull.BlobStore
+	if !opts.noCache {
+		blobs = store.NewBlobStore(opts.storageDir)
+	}
+	puller, err := opts.NewPuller(blobs)
+	if err != nil {
+		return err
+	}
 
 	image, err := puller.Pull(ctx, opts.ref)
 	if err != nil {
@@ -2,20 +2,24 @@ package push
 
 import (
 	"context"
+	"os"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"github.com/solo-io/wasm/tools/wasme/pkg/model"
 	"github.com/solo-io/wasm/tools/wasme/pkg/store"
 
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cmd/opts"
 	"github.com/solo-io/wasm/tools/wasme/pkg/push"
-	"github.com/solo-io/wasm/tools/wasme/pkg/resolver"
 	"github.com/spf13/cobra"
 )
 
 type pushOptions struct {
 	ref        string
 	storageDir string
+	format     string
+	// the other variants of the image, in the format <abi versions>=<module file>
+	variants []string
 
 	*opts.AuthOptions
 }
@@ -29,6 +33,12 @@ func PushCmd(ctx *context.Context, loginOptions *opts.AuthOptions) *cobra.Comman
 		Long: `Push wasm filter to remote registry. E.g.:
 
 wasme push webassemblyhub.io/my/filter:v1
+
+The module files of the same filter built for other ABI versions can be pushed with the image as a multi-variant image,
+whose tag references an index of the builds. The image is the default variant, and the other variants carry its config
+with their ABI versions. Deployments select the variant supported by the Istio version of the cluster. E.g.:
+
+wasme push webassemblyhub.io/my/filter:v1 --variant v0-4689a30309abf31aee9ae36e73d34b1bb182685f=filter-istio-1.8.wasm
 `,
 		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -38,11 +48,25 @@ wasme push webassemblyhub.io/my/filter:v1
 	}
 
 	cmd.Flags().StringVar(&opts.storageDir, "store", "", "Set the path to the local storage directory for wasm images. Defaults to $HOME/.wasme/store")
+	cmd.Flags().StringVar(&opts.format, "format", "", "The format to push the image in. wasme images carry the wasme config as a layer next to the module. compat images carry the module as their single layer, so they can be pulled by the OCI image fetcher of istiod. Defaults to the format the image was built with (see wasme build --format). possible values are "+string(model.FormatWasme)+", "+string(model.FormatCompat))
+
+	cmd.Flags().StringArrayVar(&opts.variants, "variant", nil, "A module file to push as another variant of the image, in the format <abi versions>=<path to module>, e.g. v0-4689a30309abf31aee9ae36e73d34b1bb182685f=filter.wasm. ABI versions are separated by commas. may be repeated")
 
 	return cmd
 }
 
 func runPush(ctx context.Context, opts pushOptions) error {
+	format, err := parseFormat(opts.format)
+	if err != nil {
+		return err
+	}
+	variants, err := parseVariants(opts.variants)
+	if err != nil {
+		return err
+	}
+	if err := opts.ReadPasswordStdin(os.Stdin); err != nil {
+		return err
+	}
 	logrus.Infof("Pushing image %v", opts.ref)
 
 	image, err := store.NewStore(opts.storageDir).Get(opts.ref)
@@ -50,11 +74,28 @@ func runPush(ctx context.Context, opts pushOptions) error {
 		return errors.Wrap(err, "image not found. run `wasme list` to see locally cached images")
 	}
 
-	resolver, authorizer := resolver.NewResolver(opts.Username, opts.Password, opts.Insecure, opts.PlainHTTP, opts.CredentialsFiles...)
-	pusher := push.NewPusher(resolver, authorizer)
-	if err := pusher.Push(ctx, image); err != nil {
+	resolver, authorizer, err := opts.NewResolver()
+	if err != nil {
 		return err
 	}
+	pusher := push.NewPusherWithOptions(resolver, authorizer, push.Options{Format: format, Progress: opts.ProgressFunc()})
+	if len(variants) == 0 {
+		return pusher.Push(ctx, image)
+	}
 
-	return nil
+	images := []model.Image{image}
+	for _, variant := range variants {
+		variant.Image = image
+		images = append(images, variant)
+	}
+	_, err = pusher.PushVariants(ctx, opts.ref, images)
+	return err
+}
+
+// an empty format pushes the image in the format it was built with
+func parseFormat(name string) (model.Format, error) {
+	if name == "" {
+		return "", nil
+	}
+	return model.ParseFormat(name)
 }
@@ -0,0 +1,72 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/solo-io/wasm/tools/wasme/pkg/config"
+	"github.com/solo-io/wasm/tools/wasme/pkg/model"
+)
+
+// a module file pushed as a variant of the image, with the config of the image and the ABI versions of the variant
+type variantImage struct {
+	model.Image
+	abiVersions []string
+	modulePath  string
+}
+
+// parses the variants in the format <abi versions>=<module file>
+func parseVariants(values []string) ([]*variantImage, error) {
+	var variants []*variantImage
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.Errorf("invalid --variant %v, must be in the format <abi versions>=<path to module>", value)
+		}
+		var abiVersions []string
+		for _, abiVersion := range strings.Split(parts[0], ",") {
+			if abiVersion = strings.TrimSpace(abiVersion); abiVersion != "" {
+				abiVersions = append(abiVersions, abiVersion)
+			}
+		}
+		variants = append(variants, &variantImage{abiVersions: abiVersions, modulePath: parts[1]})
+	}
+	return variants, nil
+}
+
+func (i *variantImage) Descriptor() (ocispec.Descriptor, error) {
+	filter, err := i.FetchFilter(context.TODO())
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	return model.GetDescriptor(filter)
+}
+
+func (i *variantImage) FetchFilter(ctx context.Context) (model.Filter, error) {
+	module, err := ioutil.ReadFile(i.modulePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading the module of variant %v", strings.Join(i.abiVersions, ","))
+	}
+	return bytes.NewReader(module), nil
+}
+
+func (i *variantImage) FetchConfig(ctx context.Context) (*config.Runtime, error) {
+	cfg, err := i.Image.FetchConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &config.Runtime{
+		Type:        cfg.Type,
+		AbiVersions: i.abiVersions,
+		Config:      cfg.Config,
+	}, nil
+}
+
+// variants are pushed in the format of the image
+func (i *variantImage) Format() model.Format {
+	return model.ImageFormat(i.Image)
+}
@@ -0,0 +1,68 @@
+package tag
+
+import (
+	"context"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cmd/opts"
+	"github.com/solo-io/wasm/tools/wasme/pkg/model"
+	"github.com/spf13/cobra"
+)
+
+type copyOptions struct {
+	sourceImage string
+	targetImage string
+
+	*opts.AuthOptions
+}
+
+func CopyCmd(ctx *context.Context, loginOptions *opts.AuthOptions) *cobra.Command {
+	var opts copyOptions
+	opts.AuthOptions = loginOptions
+	cmd := &cobra.Command{
+		Use:   "copy SOURCE_IMAGE[:TAG] TARGET_IMAGE[:TAG]",
+		Short: "Copy a wasm image between repositories and registries without pulling it",
+		Long: `Copy the manifest, config and module of SOURCE_IMAGE to TARGET_IMAGE, which may be in another registry.
+The blobs are streamed from the source registry to the target registry without writing the module to a local file.
+Blobs which exist in the target repository are not copied, and blobs are mounted from the source repository when both are in the same registry.
+The manifest is copied unchanged, so TARGET_IMAGE has the digest of SOURCE_IMAGE.
+`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.sourceImage = args[0]
+			opts.targetImage = args[1]
+			return runCopy(*ctx, opts)
+		},
+	}
+	return cmd
+}
+
+func runCopy(ctx context.Context, opts copyOptions) error {
+	if err := opts.ReadPasswordStdin(os.Stdin); err != nil {
+		return err
+	}
+	sourceRef, err := model.FullRef(opts.sourceImage)
+	if err != nil {
+		return err
+	}
+	targetRef, err := model.FullRef(opts.targetImage)
+	if err != nil {
+		return err
+	}
+	copier, err := opts.NewCopier()
+	if err != nil {
+		return err
+	}
+	descriptor, err := copier.Copy(ctx, sourceRef, targetRef)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(logrus.Fields{
+		"digest": descriptor.Digest.String(),
+		"image":  targetRef,
+	}).Info("copied image")
+
+	return nil
+}
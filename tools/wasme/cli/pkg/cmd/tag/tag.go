@@ -2,6 +2,9 @@ package tag
 
 import (
 	"context"
+	"os"
+
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cmd/opts"
 
 	"github.com/solo-io/wasm/tools/wasme/pkg/model"
 	"github.com/solo-io/wasm/tools/wasme/pkg/store"
@@ -17,14 +20,23 @@ type tagOptions struct {
 	targetImage string
 
 	storageDir string
+	remote     bool
+
+	*opts.AuthOptions
 }
 
-func TagCmd(ctx *context.Context) *cobra.Command {
+func TagCmd(ctx *context.Context, loginOptions *opts.AuthOptions) *cobra.Command {
 	var opts tagOptions
+	opts.AuthOptions = loginOptions
 	cmd := &cobra.Command{
 		Use:   "tag SOURCE_IMAGE[:TAG] TARGET_IMAGE[:TAG]",
 		Short: "Create a tag TARGET_IMAGE that refers to SOURCE_IMAGE",
-		Args:  cobra.ExactArgs(2),
+		Long: `Create a tag TARGET_IMAGE that refers to SOURCE_IMAGE in the local storage directory, which can then be pushed.
+
+With --remote, the tag is created in the registry by pushing the manifest of SOURCE_IMAGE to TARGET_IMAGE, without pulling the image.
+TARGET_IMAGE must be in the repository of SOURCE_IMAGE, use 'wasme copy' to copy images to other repositories.
+`,
+		Args: cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			opts.sourceImage = args[0]
 			opts.targetImage = args[1]
@@ -33,6 +45,7 @@ func TagCmd(ctx *context.Context) *cobra.Command {
 	}
 
 	cmd.Flags().StringVar(&opts.storageDir, "store", "", "Set the path to the local storage directory for wasm images. Defaults to $HOME/.wasme/store")
+	cmd.Flags().BoolVar(&opts.remote, "remote", false, "Create the tag in the registry of SOURCE_IMAGE, rather than in the local storage directory. the digest of the image is preserved")
 	return cmd
 }
 
@@ -46,7 +59,15 @@ func (i *taggedImage) Ref() string {
 	return i.ref
 }
 
+// the tagged image is pushed in the format of the source image
+func (i *taggedImage) Format() model.Format {
+	return model.ImageFormat(i.Image)
+}
+
 func runTag(ctx context.Context, opts tagOptions) error {
+	if opts.remote {
+		return runRemoteTag(ctx, opts)
+	}
 	imageStore := store.NewStore(opts.storageDir)
 
 	sourceRef, err := model.FullRef(opts.sourceImage)
@@ -86,3 +107,32 @@ func runTag(ctx context.Context, opts tagOptions) error {
 
 	return nil
 }
+
+func runRemoteTag(ctx context.Context, opts tagOptions) error {
+	if err := opts.ReadPasswordStdin(os.Stdin); err != nil {
+		return err
+	}
+	sourceRef, err := model.FullRef(opts.sourceImage)
+	if err != nil {
+		return err
+	}
+	targetRef, err := model.FullRef(opts.targetImage)
+	if err != nil {
+		return err
+	}
+	copier, err := opts.NewCopier()
+	if err != nil {
+		return err
+	}
+	descriptor, err := copier.Tag(ctx, sourceRef, targetRef)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(logrus.Fields{
+		"digest": descriptor.Digest.String(),
+		"image":  targetRef,
+	}).Info("tagged image")
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package tags
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cmd/opts"
+	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
+	"github.com/solo-io/wasm/tools/wasme/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+const (
+	outputTable = "table"
+	outputJson  = "json"
+)
+
+type listOptions struct {
+	repository string
+	resolve    bool
+	pageSize   int
+	output     string
+	storageDir string
+
+	*opts.AuthOptions
+}
+
+// a tag of the repository, with the digest and ABI versions of its image if the tags are resolved
+type tag struct {
+	Tag         string   `json:"tag"`
+	Digest      string   `json:"digest,omitempty"`
+	AbiVersions []string `json:"abiVersions,omitempty"`
+}
+
+func ListCmd(ctx *context.Context, loginOptions *opts.AuthOptions) *cobra.Command {
+	var opts listOptions
+	opts.AuthOptions = loginOptions
+	cmd := &cobra.Command{
+		Use:   "list <repository>",
+		Short: "List the tags of a repository, e.g. webassemblyhub.io/user/filter",
+		Long: `List the tags of a repository with the tag listing API of its registry, following the pages of the listing.
+With --resolve, the manifest and config of the image of each tag are fetched to print its digest and ABI versions.
+`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.repository = args[0]
+			return runList(*ctx, opts)
+		},
+	}
+
+	cmd.Flags().BoolVar(&opts.resolve, "resolve", false, "resolve each tag to the digest and ABI versions of its image")
+	cmd.Flags().IntVar(&opts.pageSize, "page-size", pull.DefaultTagsPageSize, "the number of tags requested in each page of the listing. registries may return fewer tags per page")
+	cmd.Flags().StringVarP(&opts.output, "output", "o", outputTable, "output format, one of "+outputTable+", "+outputJson)
+	cmd.Flags().StringVar(&opts.storageDir, "store", "", "Set the path to the local storage directory the manifests and configs of resolved images are read from and stored in. Defaults to $HOME/.wasme/store")
+
+	return cmd
+}
+
+func runList(ctx context.Context, opts listOptions) error {
+	if opts.output != outputTable && opts.output != outputJson {
+		return errors.Errorf("invalid --output %v, must be %v or %v", opts.output, outputTable, outputJson)
+	}
+	if err := opts.ReadPasswordStdin(os.Stdin); err != nil {
+		return err
+	}
+
+	lister, err := opts.NewLister(opts.pageSize)
+	if err != nil {
+		return err
+	}
+	names, err := lister.ListTags(ctx, opts.repository)
+	if err != nil {
+		return err
+	}
+
+	tags := make([]tag, len(names))
+	for i, name := range names {
+		tags[i].Tag = name
+	}
+	if opts.resolve {
+		if err := resolveTags(ctx, opts, tags); err != nil {
+			return err
+		}
+	}
+
+	if opts.output == outputJson {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(tags)
+	}
+	return writeTagsTable(os.Stdout, tags, opts.resolve)
+}
+
+func resolveTags(ctx context.Context, opts listOptions, tags []tag) error {
+	inspector, err := opts.NewInspector(store.NewBlobStore(opts.storageDir))
+	if err != nil {
+		return err
+	}
+	for i := range tags {
+		info, err := inspector.Inspect(ctx, opts.repository+":"+tags[i].Tag)
+		if err != nil {
+			return errors.Wrapf(err, "resolving tag %v", tags[i].Tag)
+		}
+		tags[i].Digest = info.Manifest.Digest.String()
+		tags[i].AbiVersions = info.Config.GetAbiVersions()
+	}
+	return nil
+}
+
+func writeTagsTable(out io.Writer, tags []tag, resolved bool) error {
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 0, 0, ' ', 0)
+	if !resolved {
+		fmt.Fprintf(w, "TAG\n")
+		for _, tag := range tags {
+			fmt.Fprintf(w, "%v\n", tag.Tag)
+		}
+		return w.Flush()
+	}
+	fmt.Fprintf(w, "TAG \tDIGEST \tABI VERSIONS\n")
+	for _, tag := range tags {
+		abiVersions := strings.Join(tag.AbiVersions, ", ")
+		if abiVersions == "" {
+			abiVersions = "-"
+		}
+		fmt.Fprintf(w, "%v \t%v \t%v\n", tag.Tag, tag.Digest, abiVersions)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,17 @@
+package tags
+
+import (
+	"context"
+
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cmd/opts"
+	"github.com/spf13/cobra"
+)
+
+func TagsCmd(ctx *context.Context, loginOptions *opts.AuthOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tags",
+		Short: "Inspect the tags of wasm image repositories",
+	}
+	cmd.AddCommand(ListCmd(ctx, loginOptions))
+	return cmd
+}
@@ -4,24 +4,46 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/docker/cli/cli/config"
+
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cmd/opts"
 	"github.com/solo-io/wasm/tools/wasme/pkg/cache"
 	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
 	"github.com/solo-io/wasm/tools/wasme/pkg/resolver"
 )
 
-func NewDefaultCacheWithAuth(opts *opts.AuthOptions) cache.Cache {
-	// Pull command from a private registry still needs authorizer
-	res, _ := resolver.NewResolver(opts.Username, opts.Password, opts.Insecure, opts.PlainHTTP, opts.CredentialsFiles...)
-	puller := pull.NewPuller(res)
+func NewDefaultCacheWithAuth(opts *opts.AuthOptions) (cache.Cache, error) {
+	puller, err := NewDefaultPullerWithAuth(opts)
+	if err != nil {
+		return nil, err
+	}
+	return cache.NewCache(puller), nil
+}
+
+func NewDefaultPullerWithAuth(opts *opts.AuthOptions) (pull.ImagePuller, error) {
+	return opts.NewPuller(nil)
+}
 
-	return cache.NewCache(puller)
+// NewPullerWithDockerConfig returns a puller which pulls images with the credentials for each registry host
+// from the docker config file, such as a mounted kubernetes.io/dockerconfigjson secret
+func NewPullerWithDockerConfig(dockerConfigPath string, opts *opts.AuthOptions) (pull.ImagePuller, error) {
+	credentials, err := resolver.DockerConfigCredentials(dockerConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	res, _, err := resolver.NewResolverWithOptions(credentials, opts.RegistryOptions())
+	if err != nil {
+		return nil, err
+	}
+	return pull.NewPullerWithOptions(res, pull.Options{Timeout: opts.PullTimeout, Progress: opts.ProgressFunc(), Prefetch: opts.Prefetch}), nil
 }
 
 var (
 	WasmeConfigDir       = home() + "/.wasme"
 	WasmeImageDir        = filepath.Join(WasmeConfigDir, "store")
 	WasmeCredentialsFile = filepath.Join(WasmeConfigDir, "credentials.json")
+	// the credentials of a registry host are read from the docker config if they are not in the wasme credentials file
+	DockerConfigFile = filepath.Join(config.Dir(), config.ConfigFileName)
 )
 
 func home() string {
@@ -0,0 +1,38 @@
+package deploy
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+
+	"github.com/sirupsen/logrus"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/abi"
+	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
+)
+
+// InferAbiVersions returns the ABI versions inferred from the module of an image whose config declares none,
+// e.g. an image built by third-party tooling. the inference is best-effort: nil is returned if the module
+// cannot be fetched or its ABI version cannot be determined, and the ABI version check is skipped
+func InferAbiVersions(ctx context.Context, image pull.Image) []string {
+	logger := logrus.WithField("image", image.Ref())
+	module, err := image.FetchFilter(ctx)
+	if err != nil {
+		logger.WithError(err).Debugf("failed to fetch the module to infer its ABI version")
+		return nil
+	}
+	if closer, ok := module.(io.Closer); ok {
+		defer closer.Close()
+	}
+	raw, err := ioutil.ReadAll(module)
+	if err != nil {
+		logger.WithError(err).Debugf("failed to read the module to infer its ABI version")
+		return nil
+	}
+	abiVersions, err := abi.InferAbiVersions(raw)
+	if err != nil {
+		logger.WithError(err).Debugf("failed to infer the ABI version of the module")
+		return nil
+	}
+	logger.WithField("abiVersions", abiVersions).Infof("the image declares no ABI version, using the ABI versions inferred from its module")
+	return abiVersions
+}
@@ -0,0 +1,88 @@
+package deploy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Capabilities are the features of the deployment a Provider supports
+type Capabilities struct {
+	// the name of the provider, used in the errors of the unsupported features
+	Provider string
+
+	// the patch contexts the filters may be applied in.
+	// empty if the provider does not select the patch context of the filters
+	PatchContexts []string
+
+	// whether the provider prints the changes of ApplyFilter instead of applying them when run in dry-run mode
+	DryRun bool
+	// whether the provider prints the changes of RemoveFilter instead of applying them when run in dry-run mode
+	DryRunRemove bool
+
+	// whether the filters may be configured for individual routes, rather than the whole listener.
+	// no provider supports per-route config yet
+	PerRouteConfig bool
+
+	// whether the provider lists the filters it deployed with ListFilters
+	ListFilters bool
+	// whether the provider checks the filters are active in the proxies with Verify
+	Verify bool
+}
+
+// Options are the features of the deployment requested from a Provider, checked against its Capabilities
+type Options struct {
+	// the patch context of the filter, empty for the default of the provider
+	PatchContext string
+	// true if the deployment is run in dry-run mode
+	DryRun bool
+	// true if the filter is removed rather than applied
+	Remove bool
+	// true if the filters are listed with ListFilters, or verified with Verify
+	ListFilters bool
+	Verify      bool
+}
+
+// UnsupportedError is returned for a feature which the provider does not support
+type UnsupportedError struct {
+	Provider string
+	Feature  string
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("the %v provider does not support %v", e.Provider, e.Feature)
+}
+
+// Check returns an UnsupportedError for the first requested option the provider does not support
+func (c Capabilities) Check(opts Options) error {
+	unsupported := func(format string, args ...interface{}) error {
+		return &UnsupportedError{Provider: c.Provider, Feature: fmt.Sprintf(format, args...)}
+	}
+	if opts.PatchContext != "" && !c.supportsPatchContext(opts.PatchContext) {
+		if len(c.PatchContexts) == 0 {
+			return unsupported("selecting the patch context of the filter")
+		}
+		return unsupported("patch context %v (supported: %v)", opts.PatchContext, strings.Join(c.PatchContexts, ", "))
+	}
+	if opts.DryRun && opts.Remove && !c.DryRunRemove {
+		return unsupported("dry-run when removing filters")
+	}
+	if opts.DryRun && !opts.Remove && !c.DryRun {
+		return unsupported("dry-run")
+	}
+	if opts.ListFilters && !c.ListFilters {
+		return unsupported("listing the deployed filters")
+	}
+	if opts.Verify && !c.Verify {
+		return unsupported("verifying the deployed filters")
+	}
+	return nil
+}
+
+func (c Capabilities) supportsPatchContext(patchContext string) bool {
+	for _, supported := range c.PatchContexts {
+		if supported == patchContext {
+			return true
+		}
+	}
+	return false
+}
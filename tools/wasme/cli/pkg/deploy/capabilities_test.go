@@ -0,0 +1,32 @@
+package deploy_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy"
+)
+
+var _ = Describe("Capabilities", func() {
+	capabilities := Capabilities{
+		Provider:      "test",
+		PatchContexts: []string{"inbound", "outbound"},
+		DryRun:        true,
+		ListFilters:   true,
+	}
+
+	It("accepts the supported options", func() {
+		Expect(capabilities.Check(Options{})).NotTo(HaveOccurred())
+		Expect(capabilities.Check(Options{PatchContext: "outbound", DryRun: true})).NotTo(HaveOccurred())
+		Expect(capabilities.Check(Options{ListFilters: true})).NotTo(HaveOccurred())
+	})
+
+	It("rejects the unsupported options", func() {
+		Expect(capabilities.Check(Options{PatchContext: "gateway"})).To(MatchError("the test provider does not support patch context gateway (supported: inbound, outbound)"))
+		Expect(capabilities.Check(Options{DryRun: true, Remove: true})).To(MatchError("the test provider does not support dry-run when removing filters"))
+		Expect(capabilities.Check(Options{ListFilters: true, Verify: true})).To(MatchError("the test provider does not support verifying the deployed filters"))
+
+		err := Capabilities{Provider: "gloo"}.Check(Options{PatchContext: "inbound"})
+		Expect(err).To(MatchError("the gloo provider does not support selecting the patch context of the filter"))
+		Expect(err).To(BeAssignableToTypeOf(&UnsupportedError{}))
+	})
+})
@@ -0,0 +1,81 @@
+package deploy
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// DeployedFilter is a filter deployed by wasme, as read back from the resources the provider deployed it with
+type DeployedFilter struct {
+	// the id of the filter, truncated to the maximum length of a label value
+	Id string
+	// the ref of the image the filter was deployed from
+	Image string
+	// the workload the filter is applied to, empty if the filter is deployed mesh-wide.
+	// for filters deployed to Gloo, the <name>.<namespace> of the Gateway
+	Workload string
+	// the name of the EnvoyFilter of a filter deployed to Istio.
+	// empty if the filter is only recorded on the workload, e.g. as its EnvoyFilter was deleted
+	EnvoyFilter string
+	// whether the proxies of the workload run the filter, empty unless the filter was verified
+	Status string
+	// the cluster of the workload, empty unless the filter was listed from several clusters
+	Cluster string
+}
+
+// SortDeployedFilters sorts the filters by id, then by cluster and workload
+func SortDeployedFilters(filters []DeployedFilter) {
+	sort.Slice(filters, func(i, j int) bool {
+		if filters[i].Id != filters[j].Id {
+			return filters[i].Id < filters[j].Id
+		}
+		if filters[i].Cluster != filters[j].Cluster {
+			return filters[i].Cluster < filters[j].Cluster
+		}
+		return filters[i].Workload < filters[j].Workload
+	})
+}
+
+// PrintDeployedFilters prints a table of the filters. the cluster column is only printed if a filter was listed
+// from several clusters, and the status column if a filter was verified
+func PrintDeployedFilters(out io.Writer, filters []DeployedFilter) error {
+	var verified, multiCluster bool
+	for _, filter := range filters {
+		if filter.Status != "" {
+			verified = true
+		}
+		if filter.Cluster != "" {
+			multiCluster = true
+		}
+	}
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 0, 0, ' ', 0)
+	header := "FILTER \tWORKLOAD \tIMAGE \tENVOYFILTER"
+	if multiCluster {
+		header = "FILTER \tCLUSTER \tWORKLOAD \tIMAGE \tENVOYFILTER"
+	}
+	if verified {
+		header += " \tSTATUS"
+	}
+	fmt.Fprintln(w, header)
+	for _, filter := range filters {
+		workload, envoyFilter := filter.Workload, filter.EnvoyFilter
+		if workload == "" {
+			workload = "(mesh-wide)"
+		}
+		if envoyFilter == "" {
+			envoyFilter = "-"
+		}
+		if multiCluster {
+			workload = filter.Cluster + " \t" + workload
+		}
+		line := fmt.Sprintf("%v \t%v \t%v \t%v", filter.Id, workload, filter.Image, envoyFilter)
+		if verified {
+			line += " \t" + filter.Status
+		}
+		fmt.Fprintln(w, line)
+	}
+	return w.Flush()
+}
@@ -3,9 +3,11 @@ package deploy
 import (
 	"context"
 
+	envoyfilter "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/filter"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/events"
 	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
 
-	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
 )
 
@@ -15,29 +17,113 @@ import (
 type Provider interface {
 	ApplyFilter(filter *v1.FilterSpec) error
 	RemoveFilter(filter *v1.FilterSpec) error
+
+	// lists the filters deployed by wasme whose id starts with the prefix, every filter if the prefix is empty
+	ListFilters(idPrefix string) ([]DeployedFilter, error)
+	// lists the filters like ListFilters, setting the Status of each filter to whether the proxies run it
+	Verify(idPrefix string) ([]DeployedFilter, error)
+
+	// the features the provider supports. the methods of the unsupported features return an UnsupportedError
+	Capabilities() Capabilities
+}
+
+// ConfigResolver is implemented by providers which resolve the config of the filter when it is applied,
+// e.g. from its ConfigFrom or the default config of its image, so the checksum injected into it is not on the filter spec
+type ConfigResolver interface {
+	// ApplyResolvedFilter applies the filter like ApplyFilter,
+	// returning the checksum injected into the resolved config of the filter, or an empty string if none was injected
+	ApplyResolvedFilter(filter *v1.FilterSpec) (string, error)
 }
 
 type Deployer struct {
 	Ctx      context.Context
 	Puller   pull.ImagePuller
 	Provider Provider
+
+	// optional, emits an event after each filter is deployed or removed
+	Events *events.Emitter
+	// the subject of the emitted events. defaults to the filter id
+	EventSubject string
 }
 
 func (d *Deployer) ApplyFilter(filter *v1.FilterSpec) error {
+	_, err := d.ApplyResolvedFilter(filter)
+	return err
+}
+
+// ApplyResolvedFilter implements ConfigResolver, the checksum is reported in the event of the deployed filter
+func (d *Deployer) ApplyResolvedFilter(filter *v1.FilterSpec) (string, error) {
+	configChecksum, err := d.applyFilter(filter)
+	d.emit(events.TypeFilterDeployed, filter, false, configChecksum, err)
+	return configChecksum, err
+}
+
+func (d *Deployer) applyFilter(filter *v1.FilterSpec) (string, error) {
 	if err := d.setRootID(filter); err != nil {
-		return err
+		return "", err
+	}
+	if err := d.setConfigChecksum(filter); err != nil {
+		return "", err
+	}
+	if resolver, ok := d.Provider.(ConfigResolver); ok {
+		return resolver.ApplyResolvedFilter(filter)
+	}
+	if err := d.Provider.ApplyFilter(filter); err != nil {
+		return "", err
+	}
+	if !filter.ConfigChecksum {
+		return "", nil
 	}
-	return d.Provider.ApplyFilter(filter)
+	return envoyfilter.GetConfigChecksum(filter.Config), nil
 }
 
 func (d *Deployer) RemoveFilter(filter *v1.FilterSpec) error {
-	return d.Provider.RemoveFilter(filter)
+	err := d.Provider.RemoveFilter(filter)
+	d.emit(events.TypeFilterRemoved, filter, true, "", err)
+	return err
+}
+
+// the Deployer lists and verifies the filters with its Provider, and supports the same features
+func (d *Deployer) ListFilters(idPrefix string) ([]DeployedFilter, error) {
+	return d.Provider.ListFilters(idPrefix)
+}
+
+func (d *Deployer) Verify(idPrefix string) ([]DeployedFilter, error) {
+	return d.Provider.Verify(idPrefix)
+}
+
+func (d *Deployer) Capabilities() Capabilities {
+	return d.Provider.Capabilities()
+}
+
+// emits the event of the given type, or a failed event if err is non-nil
+func (d *Deployer) emit(eventType string, filter *v1.FilterSpec, remove bool, configChecksum string, err error) {
+	if d.Events == nil {
+		return
+	}
+	report := events.DeployReport{
+		FilterId:       filter.Id,
+		Image:          filter.Image,
+		RootId:         filter.RootID,
+		ConfigChecksum: configChecksum,
+		Remove:         remove,
+	}
+	if err != nil {
+		eventType = events.TypeFilterFailed
+		report.Error = err.Error()
+	}
+	subject := d.EventSubject
+	if subject == "" {
+		subject = filter.Id
+	}
+	d.Events.Emit(eventType, subject, report)
 }
 
 // gets the root ID of the filter.
 // the first time it must pull the image and inspect it
 // second time it will cache it locally
 // if the user provides
+// if the image does not declare any root ids, the filter id is used
 func (d *Deployer) setRootID(f *v1.FilterSpec) error {
 	if f.RootID != "" {
 		return nil
@@ -46,11 +132,38 @@ func (d *Deployer) setRootID(f *v1.FilterSpec) error {
 	if err != nil {
 		return err
 	}
+	if rootId == "" {
+		logrus.WithFields(logrus.Fields{
+			"filter": f.Id,
+			"image":  f.Image,
+		}).Info("no root id found in image, defaulting to the filter id")
+		rootId = f.Id
+	}
 	f.RootID = rootId
 	return nil
 }
 
-// get the root id by pulling the image
+// injects the checksum of the filter config
+// if the user has opted in.
+// configs read from ConfigFrom are injected by the provider once they are read,
+// as are filters without a config, which the provider may configure with the default config of the image
+func (d *Deployer) setConfigChecksum(f *v1.FilterSpec) error {
+	if !f.ConfigChecksum || f.ConfigFrom != nil || f.Config == nil {
+		return nil
+	}
+	checksum, err := envoyfilter.InjectConfigChecksum(f)
+	if err != nil {
+		return err
+	}
+	logrus.WithFields(logrus.Fields{
+		"filter":   f.Id,
+		"checksum": checksum,
+	}).Info("injected config checksum into filter config")
+	return nil
+}
+
+// get the root id by pulling the image.
+// returns an empty root id if the image does not declare any
 func (d *Deployer) getRootId(ref string) (string, error) {
 	image, err := d.Puller.Pull(d.Ctx, ref)
 	if err != nil {
@@ -64,7 +177,7 @@ func (d *Deployer) getRootId(ref string) (string, error) {
 
 	rootIds := cfg.GetConfig().GetRootIds()
 	if len(rootIds) < 1 {
-		return "", errors.Errorf("no roots found in config")
+		return "", nil
 	}
 	return rootIds[0], nil
 }
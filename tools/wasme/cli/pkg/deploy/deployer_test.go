@@ -0,0 +1,202 @@
+package deploy_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gogo/protobuf/types"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy"
+	envoyfilter "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/filter"
+	mock_deploy "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/mocks"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/events"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+)
+
+var _ = Describe("Deployer", func() {
+	var (
+		provider *mock_deploy.MockProvider
+		deployer *Deployer
+		config   *types.Any
+	)
+	BeforeEach(func() {
+		provider = mock_deploy.NewMockProvider(gomock.NewController(GinkgoT()))
+		deployer = &Deployer{
+			Ctx:      context.TODO(),
+			Provider: provider,
+		}
+		var err error
+		config, err = types.MarshalAny(&types.StringValue{Value: `{"name":"hello"}`})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("injects the config checksum when enabled", func() {
+		filter := &v1.FilterSpec{
+			Id:             "filter",
+			RootID:         "root",
+			Config:         config,
+			ConfigChecksum: true,
+		}
+		provider.EXPECT().ApplyFilter(filter).Return(nil)
+
+		err := deployer.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(envoyfilter.GetConfigChecksum(filter.Config)).To(HavePrefix("sha256:"))
+	})
+
+	It("leaves the checksum of filters without a config to the provider, which may apply the default config of the image", func() {
+		filter := &v1.FilterSpec{
+			Id:             "filter",
+			RootID:         "root",
+			ConfigChecksum: true,
+		}
+		provider.EXPECT().ApplyFilter(filter).Return(nil)
+
+		err := deployer.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filter.Config).To(BeNil())
+	})
+
+	It("leaves the config untouched when the checksum is not enabled", func() {
+		filter := &v1.FilterSpec{
+			Id:     "filter",
+			RootID: "root",
+			Config: config,
+		}
+		provider.EXPECT().ApplyFilter(filter).Return(nil)
+
+		err := deployer.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filter.Config).To(Equal(config))
+		Expect(envoyfilter.GetConfigChecksum(filter.Config)).To(BeEmpty())
+	})
+
+	Context("with events", func() {
+		var (
+			transport *recordingTransport
+			cancel    context.CancelFunc
+		)
+		BeforeEach(func() {
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			transport = &recordingTransport{}
+			deployer.Events = events.NewEmitter(transport, "wasme-test", events.EmitterOptions{})
+			deployer.Events.Start(ctx)
+		})
+		AfterEach(func() {
+			cancel()
+		})
+
+		getReports := func() []events.DeployReport {
+			Expect(deployer.Events.Flush(5 * time.Second)).NotTo(HaveOccurred())
+			var reports []events.DeployReport
+			for _, event := range transport.events {
+				Expect(event.Subject).To(Equal("filter"))
+				var report events.DeployReport
+				Expect(json.Unmarshal(event.Data, &report)).NotTo(HaveOccurred())
+				reports = append(reports, report)
+			}
+			return reports
+		}
+
+		It("emits an event when the filter is deployed and removed", func() {
+			filter := &v1.FilterSpec{
+				Id:     "filter",
+				Image:  "filter/image:v1",
+				RootID: "root",
+			}
+			provider.EXPECT().ApplyFilter(filter).Return(nil)
+			provider.EXPECT().RemoveFilter(filter).Return(nil)
+
+			Expect(deployer.ApplyFilter(filter)).NotTo(HaveOccurred())
+			Expect(deployer.RemoveFilter(filter)).NotTo(HaveOccurred())
+
+			Expect(getReports()).To(Equal([]events.DeployReport{
+				{FilterId: "filter", Image: "filter/image:v1", RootId: "root"},
+				{FilterId: "filter", Image: "filter/image:v1", RootId: "root", Remove: true},
+			}))
+			Expect(transport.events[0].Type).To(Equal(events.TypeFilterDeployed))
+			Expect(transport.events[1].Type).To(Equal(events.TypeFilterRemoved))
+		})
+
+		It("reports the checksum injected into the config of the filter", func() {
+			filter := &v1.FilterSpec{
+				Id:             "filter",
+				Image:          "filter/image:v1",
+				RootID:         "root",
+				Config:         config,
+				ConfigChecksum: true,
+			}
+			provider.EXPECT().ApplyFilter(filter).Return(nil)
+
+			Expect(deployer.ApplyFilter(filter)).NotTo(HaveOccurred())
+
+			reports := getReports()
+			Expect(reports).To(HaveLen(1))
+			Expect(reports[0].ConfigChecksum).To(HavePrefix("sha256:"))
+			Expect(reports[0].ConfigChecksum).To(Equal(envoyfilter.GetConfigChecksum(filter.Config)))
+		})
+
+		It("reports the checksum of the config resolved by the provider", func() {
+			filter := &v1.FilterSpec{
+				Id:             "filter",
+				Image:          "filter/image:v1",
+				RootID:         "root",
+				ConfigChecksum: true,
+			}
+			provider.EXPECT().ApplyFilter(filter).Return(nil)
+			deployer.Provider = &resolvingProvider{MockProvider: provider, configChecksum: "sha256:abc"}
+
+			configChecksum, err := deployer.ApplyResolvedFilter(filter)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(configChecksum).To(Equal("sha256:abc"))
+
+			Expect(getReports()).To(Equal([]events.DeployReport{
+				{FilterId: "filter", Image: "filter/image:v1", RootId: "root", ConfigChecksum: "sha256:abc"},
+			}))
+		})
+
+		It("emits a failed event when the provider fails", func() {
+			filter := &v1.FilterSpec{
+				Id:     "filter",
+				Image:  "filter/image:v1",
+				RootID: "root",
+			}
+			provider.EXPECT().ApplyFilter(filter).Return(errors.New("boom"))
+
+			Expect(deployer.ApplyFilter(filter)).To(HaveOccurred())
+
+			Expect(getReports()).To(Equal([]events.DeployReport{
+				{FilterId: "filter", Image: "filter/image:v1", RootId: "root", Error: "boom"},
+			}))
+			Expect(transport.events[0].Type).To(Equal(events.TypeFilterFailed))
+		})
+	})
+})
+
+// resolves the config of the filters it applies to a config with the checksum
+type resolvingProvider struct {
+	*mock_deploy.MockProvider
+	configChecksum string
+}
+
+func (p *resolvingProvider) ApplyResolvedFilter(filter *v1.FilterSpec) (string, error) {
+	if err := p.ApplyFilter(filter); err != nil {
+		return "", err
+	}
+	return p.configChecksum, nil
+}
+
+// records the sent events
+type recordingTransport struct {
+	events []*events.Event
+}
+
+func (t *recordingTransport) Send(_ context.Context, event *events.Event) error {
+	t.events = append(t.events, event)
+	return nil
+}
@@ -0,0 +1,139 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+)
+
+const (
+	// the key under which the config checksum is injected into the filter configuration
+	ConfigChecksumKey = "__wasme_config_checksum"
+
+	// the annotation on created EnvoyFilters containing the config checksum
+	ConfigChecksumAnnotation = "wasme.io/config-checksum"
+
+	stringValueTypeUrl = "type.googleapis.com/google.protobuf.StringValue"
+	structTypeUrl      = "type.googleapis.com/google.protobuf.Struct"
+)
+
+// ConfigChecksum returns the sha256 checksum of the filter configuration.
+// JSON configurations are canonicalized before hashing,
+// and an injected checksum key is ignored, so the checksum is
+// stable across formatting changes and repeated injections.
+func ConfigChecksum(config *types.Any) (string, error) {
+	raw, err := getConfigContent(config)
+	if err != nil {
+		return "", err
+	}
+	obj, isObj := parseJsonObject(raw)
+	if !isObj {
+		return digest.FromBytes(raw).String(), nil
+	}
+	delete(obj, ConfigChecksumKey)
+	canonical, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	return digest.FromBytes(canonical).String(), nil
+}
+
+// InjectConfigChecksum computes the checksum of the filter configuration and
+// sets it on the configuration under ConfigChecksumKey.
+// Returns the checksum.
+func InjectConfigChecksum(filter *wasmev1.FilterSpec) (string, error) {
+	checksum, err := ConfigChecksum(filter.Config)
+	if err != nil {
+		return "", err
+	}
+	raw, err := getConfigContent(filter.Config)
+	if err != nil {
+		return "", err
+	}
+	obj, isObj := parseJsonObject(raw)
+	if !isObj {
+		if len(bytes.TrimSpace(raw)) > 0 {
+			return "", errors.Errorf("cannot inject config checksum, filter config must be empty or a JSON object")
+		}
+		obj = map[string]interface{}{}
+	}
+	obj[ConfigChecksumKey] = checksum
+
+	injected, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+
+	if filter.Config != nil && filter.Config.TypeUrl == structTypeUrl {
+		var st types.Struct
+		if err := jsonpb.Unmarshal(bytes.NewReader(injected), &st); err != nil {
+			return "", err
+		}
+		filter.Config, err = types.MarshalAny(&st)
+		if err != nil {
+			return "", err
+		}
+		return checksum, nil
+	}
+
+	filter.Config, err = types.MarshalAny(&types.StringValue{Value: string(injected)})
+	if err != nil {
+		return "", err
+	}
+	return checksum, nil
+}
+
+// GetConfigChecksum returns the checksum injected into the filter configuration,
+// or an empty string if none was injected
+func GetConfigChecksum(config *types.Any) string {
+	raw, err := getConfigContent(config)
+	if err != nil {
+		return ""
+	}
+	obj, _ := parseJsonObject(raw)
+	checksum, _ := obj[ConfigChecksumKey].(string)
+	return checksum
+}
+
+// returns the raw bytes of the configuration as they will be passed to the filter
+func getConfigContent(config *types.Any) ([]byte, error) {
+	if config == nil {
+		return nil, nil
+	}
+	switch config.TypeUrl {
+	case stringValueTypeUrl:
+		var sv types.StringValue
+		if err := types.UnmarshalAny(config, &sv); err != nil {
+			return nil, err
+		}
+		return []byte(sv.Value), nil
+	case structTypeUrl:
+		var st types.Struct
+		if err := types.UnmarshalAny(config, &st); err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := (&jsonpb.Marshaler{}).Marshal(&buf, &st); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, errors.Errorf("unsupported filter config type %v, must be StringValue or Struct", config.TypeUrl)
+	}
+}
+
+func parseJsonObject(raw []byte) (map[string]interface{}, bool) {
+	var obj map[string]interface{}
+	// preserve the formatting of numbers in the config
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&obj); err != nil || obj == nil || decoder.More() {
+		return nil, false
+	}
+	return obj, true
+}
@@ -0,0 +1,85 @@
+package filter_test
+
+import (
+	"github.com/gogo/protobuf/types"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/filter"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+)
+
+var _ = Describe("ConfigChecksum", func() {
+	stringConfig := func(val string) *types.Any {
+		cfg, err := types.MarshalAny(&types.StringValue{Value: val})
+		Expect(err).NotTo(HaveOccurred())
+		return cfg
+	}
+	getStringConfig := func(cfg *types.Any) string {
+		var sv types.StringValue
+		err := types.UnmarshalAny(cfg, &sv)
+		Expect(err).NotTo(HaveOccurred())
+		return sv.Value
+	}
+
+	It("is stable across formatting and key order", func() {
+		sum1, err := ConfigChecksum(stringConfig(`{"name":"hello","value":"world"}`))
+		Expect(err).NotTo(HaveOccurred())
+		sum2, err := ConfigChecksum(stringConfig(`{ "value": "world",
+  "name": "hello" }`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sum1).To(Equal(sum2))
+		Expect(sum1).To(HavePrefix("sha256:"))
+
+		sum3, err := ConfigChecksum(stringConfig(`{"name":"hello","value":"mars"}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sum3).NotTo(Equal(sum1))
+	})
+
+	It("injects the checksum into the config", func() {
+		filter := &v1.FilterSpec{Config: stringConfig(`{"name":"hello","value":"world"}`)}
+		expected, err := ConfigChecksum(filter.Config)
+		Expect(err).NotTo(HaveOccurred())
+
+		checksum, err := InjectConfigChecksum(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checksum).To(Equal(expected))
+		Expect(getStringConfig(filter.Config)).To(MatchJSON(`{"name":"hello","value":"world","__wasme_config_checksum":"` + checksum + `"}`))
+		Expect(GetConfigChecksum(filter.Config)).To(Equal(checksum))
+
+		// injecting again does not change the checksum
+		again, err := InjectConfigChecksum(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(again).To(Equal(checksum))
+	})
+
+	It("injects the checksum into an empty config", func() {
+		filter := &v1.FilterSpec{}
+		checksum, err := InjectConfigChecksum(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getStringConfig(filter.Config)).To(MatchJSON(`{"__wasme_config_checksum":"` + checksum + `"}`))
+	})
+
+	It("injects the checksum into a struct config", func() {
+		cfg, err := types.MarshalAny(&types.Struct{Fields: map[string]*types.Value{
+			"name": {Kind: &types.Value_StringValue{StringValue: "hello"}},
+		}})
+		Expect(err).NotTo(HaveOccurred())
+		filter := &v1.FilterSpec{Config: cfg}
+
+		checksum, err := InjectConfigChecksum(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		var st types.Struct
+		err = types.UnmarshalAny(filter.Config, &st)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(st.Fields[ConfigChecksumKey].GetStringValue()).To(Equal(checksum))
+		Expect(st.Fields["name"].GetStringValue()).To(Equal("hello"))
+	})
+
+	It("errors on a non-JSON config", func() {
+		filter := &v1.FilterSpec{Config: stringConfig("plain text")}
+		_, err := InjectConfigChecksum(filter)
+		Expect(err).To(HaveOccurred())
+		Expect(getStringConfig(filter.Config)).To(Equal("plain text"))
+	})
+})
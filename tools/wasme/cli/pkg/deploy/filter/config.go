@@ -0,0 +1,33 @@
+package filter
+
+import (
+	"bytes"
+
+	"github.com/ghodss/yaml"
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/types"
+	"github.com/pkg/errors"
+)
+
+// MakeStringConfig returns the filter configuration passed to the filter as is
+func MakeStringConfig(content string) (*types.Any, error) {
+	return types.MarshalAny(&types.StringValue{Value: content})
+}
+
+// MakeStructConfig returns the filter configuration for a JSON or YAML object, as a google.protobuf.Struct.
+// the proxy serializes the Struct as JSON before passing it to the filter,
+// so the object is not encoded as a string in the EnvoyFilter and may contain newlines
+func MakeStructConfig(content []byte) (*types.Any, error) {
+	raw, err := yaml.YAMLToJSON(content)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing the filter config as JSON or YAML")
+	}
+	if _, isObj := parseJsonObject(raw); !isObj {
+		return nil, errors.Errorf("the filter config must be a JSON or YAML object")
+	}
+	var st types.Struct
+	if err := jsonpb.Unmarshal(bytes.NewReader(raw), &st); err != nil {
+		return nil, err
+	}
+	return types.MarshalAny(&st)
+}
@@ -0,0 +1,89 @@
+package filter_test
+
+import (
+	"github.com/gogo/protobuf/types"
+	"github.com/golang/protobuf/jsonpb"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/filter"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+)
+
+var _ = Describe("Struct configs", func() {
+	// a config with a nested object, and a string containing newlines
+	const jsonConfig = `{"headers":{"x-wasme":"on"},"limit":3,"message":"line 1\nline 2"}`
+
+	It("parses JSON and YAML objects", func() {
+		config, err := MakeStructConfig([]byte(jsonConfig))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.TypeUrl).To(Equal("type.googleapis.com/google.protobuf.Struct"))
+
+		yamlConfig, err := MakeStructConfig([]byte("headers:\n  x-wasme: \"on\"\nlimit: 3\nmessage: |-\n  line 1\n  line 2\n"))
+		Expect(err).NotTo(HaveOccurred())
+
+		// the checksums of JSON configs are computed on their canonical form
+		checksum, err := ConfigChecksum(config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ConfigChecksum(yamlConfig)).To(Equal(checksum))
+		stringConfig, err := MakeStringConfig(jsonConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ConfigChecksum(stringConfig)).To(Equal(checksum))
+	})
+
+	It("rejects configs which are not objects", func() {
+		_, err := MakeStructConfig([]byte(`["a", "b"]`))
+		Expect(err).To(MatchError("the filter config must be a JSON or YAML object"))
+		_, err = MakeStructConfig([]byte(`plain string`))
+		Expect(err).To(MatchError("the filter config must be a JSON or YAML object"))
+		_, err = MakeStructConfig([]byte("a: [b"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("wasm filters", func() {
+		var filter *v1.FilterSpec
+		BeforeEach(func() {
+			config, err := MakeStructConfig([]byte(jsonConfig))
+			Expect(err).NotTo(HaveOccurred())
+			filter = &v1.FilterSpec{Id: "my-filter", Config: config}
+		})
+
+		// returns the plugin config of a filter config, marshaled to JSON and parsed back
+		roundTrip := func(cfg *structpb.Struct) *structpb.Struct {
+			raw, err := (&jsonpb.Marshaler{}).MarshalToString(cfg)
+			Expect(err).NotTo(HaveOccurred())
+			var parsed structpb.Struct
+			Expect(jsonpb.UnmarshalString(raw, &parsed)).To(Succeed())
+			return parsed.GetFields()["config"].GetStructValue()
+		}
+
+		It("passes the config to typed wasm filters as a Struct", func() {
+			wasmFilter, err := MakeTypedIstioWasmFilter(filter, MakeV3LocalDatasource("/filter.wasm"))
+			Expect(err).NotTo(HaveOccurred())
+
+			// the typed config is a TypedStruct, whose value is the Struct of the wasm filter config
+			raw, err := (&jsonpb.Marshaler{}).MarshalToString(wasmFilter)
+			Expect(err).NotTo(HaveOccurred())
+			var marshaled structpb.Struct
+			Expect(jsonpb.UnmarshalString(raw, &marshaled)).To(Succeed())
+			value := marshaled.GetFields()["typedConfig"].GetStructValue().GetFields()["value"].GetStructValue()
+			configuration := roundTrip(value).GetFields()["configuration"].GetStructValue()
+			Expect(configuration.GetFields()["@type"].GetStringValue()).To(Equal("type.googleapis.com/google.protobuf.Struct"))
+
+			configJson, err := (&jsonpb.Marshaler{}).MarshalToString(configuration.GetFields()["value"])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(configJson).To(MatchJSON(jsonConfig))
+		})
+
+		It("passes the config to untyped wasm filters as its JSON", func() {
+			wasmFilter, err := MakeIstioWasmFilter(filter, MakeLocalDatasource("/filter.wasm"))
+			Expect(err).NotTo(HaveOccurred())
+			configuration := roundTrip(wasmFilter.GetConfig()).GetFields()["configuration"].GetStringValue()
+			Expect(configuration).To(MatchJSON(jsonConfig))
+
+			filter.Config = &types.Any{TypeUrl: "type.googleapis.com/google.protobuf.BytesValue"}
+			_, err = MakeIstioWasmFilter(filter, MakeLocalDatasource("/filter.wasm"))
+			Expect(err).To(MatchError(ContainSubstring("wasm filter configuration has an invalid type")))
+		})
+	})
+})
@@ -11,14 +11,17 @@ import (
 	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes/any"
 
+	envoylistener "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
 	envoyhttp "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	structpb "github.com/golang/protobuf/ptypes/struct"
 	corev3 "github.com/solo-io/gloo/projects/gloo/pkg/api/external/envoy/config/core/v3"
 	wasmfiltersv3 "github.com/solo-io/gloo/projects/gloo/pkg/api/external/envoy/extensions/filters/http/wasm/v3"
 	wasmv3 "github.com/solo-io/gloo/projects/gloo/pkg/api/external/envoy/extensions/wasm/v3"
 	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
 )
 
-func MakeRemoteDataSource(uri, cluster string) *core.AsyncDataSource {
+// the proxy fetches the module from the uri through the cluster, and rejects it unless it matches the sha256
+func MakeRemoteDataSource(uri, cluster, sha256 string) *core.AsyncDataSource {
 	return &core.AsyncDataSource{
 		Specifier: &core.AsyncDataSource_Remote{
 			Remote: &core.RemoteDataSource{
@@ -31,6 +34,30 @@ func MakeRemoteDataSource(uri, cluster string) *core.AsyncDataSource {
 						Seconds: 5, // TODO: customize
 					},
 				},
+				Sha256: sha256,
+			},
+		},
+	}
+}
+
+// like MakeRemoteDataSource, retrying failed fetches, e.g. while the module is still being pulled
+func MakeV3RemoteDataSource(uri, cluster, sha256 string) *corev3.AsyncDataSource {
+	return &corev3.AsyncDataSource{
+		Specifier: &corev3.AsyncDataSource_Remote{
+			Remote: &corev3.RemoteDataSource{
+				HttpUri: &corev3.HttpUri{
+					Uri: uri,
+					HttpUpstreamType: &corev3.HttpUri_Cluster{
+						Cluster: cluster,
+					},
+					Timeout: &types.Duration{
+						Seconds: 5, // TODO: customize
+					},
+				},
+				Sha256: sha256,
+				RetryPolicy: &corev3.RetryPolicy{
+					NumRetries: &types.UInt32Value{Value: 5},
+				},
 			},
 		},
 	}
@@ -48,6 +75,19 @@ func MakeLocalDatasource(path string) *core.AsyncDataSource {
 	}
 }
 
+// MakeInlineDatasource returns a datasource which inlines the code of the module, e.g. into a bootstrap config
+func MakeInlineDatasource(code []byte) *core.AsyncDataSource {
+	return &core.AsyncDataSource{
+		Specifier: &core.AsyncDataSource_Local{
+			Local: &core.DataSource{
+				Specifier: &core.DataSource_InlineBytes{
+					InlineBytes: code,
+				},
+			},
+		},
+	}
+}
+
 func MakeV3LocalDatasource(path string) *corev3.AsyncDataSource {
 	return &corev3.AsyncDataSource{
 		Specifier: &corev3.AsyncDataSource_Local{
@@ -60,18 +100,43 @@ func MakeV3LocalDatasource(path string) *corev3.AsyncDataSource {
 	}
 }
 
+// like MakeInlineDatasource, for the typed wasm filters of Istio 1.7+
+func MakeV3InlineDatasource(code []byte) *corev3.AsyncDataSource {
+	return &corev3.AsyncDataSource{
+		Specifier: &corev3.AsyncDataSource_Local{
+			Local: &corev3.DataSource{
+				Specifier: &corev3.DataSource_InlineBytes{
+					InlineBytes: code,
+				},
+			},
+		},
+	}
+}
+
+// RootID returns the root id the filter binds to in the wasm module.
+// The root id is independent of the filter id, which names the resources created for the filter,
+// and defaults to the filter id if empty.
+func RootID(filter *wasmev1.FilterSpec) string {
+	if filter.RootID == "" {
+		return filter.Id
+	}
+	return filter.RootID
+}
+
 // MakeWasmFilter creates wasm filters to be used with Envoy.
 // This will also work with Gloo (but not Istio).
+// The environment variables of the filter must be validated with ValidateEnv.
 func MakeWasmFilter(filter *wasmev1.FilterSpec, dataSrc *corev3.AsyncDataSource) *envoyhttp.HttpFilter {
 	filterCfg := &wasmv3.WasmService{
 		Config: &wasmv3.PluginConfig{
 			Name:          filter.Id,
-			RootId:        filter.RootID,
+			RootId:        RootID(filter),
 			Configuration: filter.Config,
 			Vm: &wasmv3.PluginConfig_VmConfig{
 				VmConfig: &wasmv3.VmConfig{
-					Runtime: "envoy.wasm.runtime.v8", // default to v8
-					Code:    dataSrc,
+					Runtime:          "envoy.wasm.runtime.v8", // default to v8
+					Code:             dataSrc,
+					AllowPrecompiled: filter.AllowPrecompiled,
 				},
 			},
 		},
@@ -83,6 +148,7 @@ func MakeWasmFilter(filter *wasmev1.FilterSpec, dataSrc *corev3.AsyncDataSource)
 		// this should NEVER HAPPEN!
 		panic(err)
 	}
+	setVmEnv(marshalledConf, filter.Env)
 
 	return &envoyhttp.HttpFilter{
 		Name: util.WasmFilterName,
@@ -92,19 +158,67 @@ func MakeWasmFilter(filter *wasmev1.FilterSpec, dataSrc *corev3.AsyncDataSource)
 	}
 }
 
+// HttpFilterName returns the name of the HTTP filter created by MakeTypedIstioWasmFilter.
+// The name is unique to the filter, so other filters can be inserted relative to it.
+// MakeTypedIstioWasmNetworkFilter gives network filters the same name.
+func HttpFilterName(filterId string) string {
+	return "wasme." + filterId
+}
+
+// WasmNetworkFilterName is the name of the network filters created by MakeIstioWasmNetworkFilter
+const WasmNetworkFilterName = "envoy.filters.network.wasm"
+
 // MakeTypedIstioWasmFilter returns a wasm filter for use with Istio.
 // This method works for versions of Istio 1.7+
 func MakeTypedIstioWasmFilter(filter *wasmev1.FilterSpec, dataSrc *corev3.AsyncDataSource) (*envoyhttp.HttpFilter, error) {
+	anyTypedConf, err := makeTypedWasmConfig(filter, dataSrc, "type.googleapis.com/envoy.extensions.filters.http.wasm.v3.Wasm")
+	if err != nil {
+		return nil, err
+	}
+
+	envoyFilter := &envoyhttp.HttpFilter{
+		// the typed config identifies the filter, so the name can be unique
+		Name: HttpFilterName(filter.Id),
+		ConfigType: &envoyhttp.HttpFilter_TypedConfig{
+			TypedConfig: anyTypedConf,
+		},
+	}
+	return envoyFilter, nil
+}
+
+// MakeTypedIstioWasmNetworkFilter returns a wasm network filter, to be inserted into TCP filter chains, for use with Istio.
+// This method works for versions of Istio 1.7+
+func MakeTypedIstioWasmNetworkFilter(filter *wasmev1.FilterSpec, dataSrc *corev3.AsyncDataSource) (*envoylistener.Filter, error) {
+	// the http and network wasm filters share the same configuration
+	anyTypedConf, err := makeTypedWasmConfig(filter, dataSrc, "type.googleapis.com/envoy.extensions.filters.network.wasm.v3.Wasm")
+	if err != nil {
+		return nil, err
+	}
+
+	return &envoylistener.Filter{
+		// the typed config identifies the filter, so the name can be unique
+		Name: HttpFilterName(filter.Id),
+		ConfigType: &envoylistener.Filter_TypedConfig{
+			TypedConfig: anyTypedConf,
+		},
+	}, nil
+}
+
+func makeTypedWasmConfig(filter *wasmev1.FilterSpec, dataSrc *corev3.AsyncDataSource, typeUrl string) (*any.Any, error) {
+	if err := ValidateEnv(filter.Env); err != nil {
+		return nil, err
+	}
 	filterCfg := &wasmfiltersv3.Wasm{
 		Config: &wasmv3.PluginConfig{
 			Name:          filter.Id,
-			RootId:        filter.RootID,
+			RootId:        RootID(filter),
 			Configuration: filter.Config,
 			Vm: &wasmv3.PluginConfig_VmConfig{
 				VmConfig: &wasmv3.VmConfig{
-					Runtime: "envoy.wasm.runtime.v8", // default to v8
-					Code:    dataSrc,
-					VmId:    filter.Id,
+					Runtime:          "envoy.wasm.runtime.v8", // default to v8
+					Code:             dataSrc,
+					VmId:             filter.Id,
+					AllowPrecompiled: filter.AllowPrecompiled,
 				},
 			},
 		},
@@ -116,8 +230,9 @@ func MakeTypedIstioWasmFilter(filter *wasmev1.FilterSpec, dataSrc *corev3.AsyncD
 	if err != nil {
 		return nil, err
 	}
+	setVmEnv(marshalledConf, filter.Env)
 	typedStructConf := &udpav1.TypedStruct{
-		TypeUrl: "type.googleapis.com/envoy.extensions.filters.http.wasm.v3.Wasm",
+		TypeUrl: typeUrl,
 		Value:   marshalledConf,
 	}
 
@@ -125,59 +240,68 @@ func MakeTypedIstioWasmFilter(filter *wasmev1.FilterSpec, dataSrc *corev3.AsyncD
 	if err != nil {
 		return nil, err
 	}
-	anyTypedConf := &any.Any{TypeUrl: "type.googleapis.com/udpa.type.v1.TypedStruct", Value: value}
+	return &any.Any{TypeUrl: "type.googleapis.com/udpa.type.v1.TypedStruct", Value: value}, nil
+}
 
-	envoyFilter := &envoyhttp.HttpFilter{
+// MakeIstioWasmFilter returns a wasm filter for use with Istio. This method only
+// works for versions of Istio up to and including 1.6. It will soon be deprecated
+func MakeIstioWasmFilter(filter *wasmev1.FilterSpec, dataSrc *core.AsyncDataSource) (*envoyhttp.HttpFilter, error) {
+	marshalledConf, err := makeIstioWasmConfig(filter, dataSrc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &envoyhttp.HttpFilter{
 		Name: util.WasmFilterName,
-		ConfigType: &envoyhttp.HttpFilter_TypedConfig{
-			TypedConfig: anyTypedConf,
+		ConfigType: &envoyhttp.HttpFilter_Config{
+			Config: marshalledConf,
 		},
+	}, nil
+}
+
+// MakeIstioWasmNetworkFilter returns a wasm network filter, to be inserted into TCP filter chains, for use with Istio.
+// This method only works for versions of Istio up to and including 1.6
+func MakeIstioWasmNetworkFilter(filter *wasmev1.FilterSpec, dataSrc *core.AsyncDataSource) (*envoylistener.Filter, error) {
+	marshalledConf, err := makeIstioWasmConfig(filter, dataSrc)
+	if err != nil {
+		return nil, err
 	}
-	return envoyFilter, nil
+
+	return &envoylistener.Filter{
+		Name: WasmNetworkFilterName,
+		ConfigType: &envoylistener.Filter_Config{
+			Config: marshalledConf,
+		},
+	}, nil
 }
 
-// MakeIstioWasmFilter returns a wasm filter for use with Istio. This method only
-// works for versions of Istio up to and including 1.6. It will soon be deprecated
-func MakeIstioWasmFilter(filter *wasmev1.FilterSpec, dataSrc *core.AsyncDataSource) (*envoyhttp.HttpFilter, error) {
-	var cfgVal string
-	if filter.Config != nil {
-		// As the config's value is a StringValue, we need to unmarshall it,
-		// typecheck it, then get the value out of the result.
-		var da types.DynamicAny
-		if err := types.UnmarshalAny(filter.Config, &da); err != nil {
-			return nil, err
-		}
-
-		cfg, ok := da.Message.(*types.StringValue)
-		if !ok {
-			return nil, errors.Errorf("wasm filter configuration has an invalid type, should be StringValue")
-		}
-		cfgVal = cfg.GetValue()
+func makeIstioWasmConfig(filter *wasmev1.FilterSpec, dataSrc *core.AsyncDataSource) (*structpb.Struct, error) {
+	// the proxies of older versions of Istio cannot expose environment variables to the VM
+	if len(filter.Env) > 0 {
+		return nil, errors.Errorf("environment variables of the filter VM require Istio 1.9+")
+	}
+
+	// the configuration of older versions of Istio is a string,
+	// so Struct configurations are passed as the JSON the proxy would serialize them to
+	cfgVal, err := getConfigContent(filter.Config)
+	if err != nil {
+		return nil, errors.Wrap(err, "wasm filter configuration has an invalid type")
 	}
 
 	filterCfg := &config.WasmService{
 		Config: &config.PluginConfig{
 			Name:          filter.Id,
-			RootId:        filter.RootID,
-			Configuration: cfgVal,
+			RootId:        RootID(filter),
+			Configuration: string(cfgVal),
 			VmConfig: &config.VmConfig{
-				Runtime: "envoy.wasm.runtime.v8", // default to v8
-				Code:    dataSrc,
-				VmId:    filter.Id,
+				Runtime:          "envoy.wasm.runtime.v8", // default to v8
+				Code:             dataSrc,
+				VmId:             filter.Id,
+				AllowPrecompiled: filter.AllowPrecompiled,
 			},
 		},
 	}
 
 	// here we need to use the golang proto marshal
-	marshalledConf, err := util.MarshalStruct(filterCfg)
-	if err != nil {
-		return nil, err
-	}
-
-	return &envoyhttp.HttpFilter{
-		Name: util.WasmFilterName,
-		ConfigType: &envoyhttp.HttpFilter_Config{
-			Config: marshalledConf,
-		},
-	}, nil
+	return util.MarshalStruct(filterCfg)
 }
@@ -0,0 +1,63 @@
+package filter_test
+
+import (
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/filter"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+)
+
+var _ = Describe("RootID", func() {
+	// returns the name and root id of the plugin config
+	getPluginConfig := func(cfg *structpb.Struct) (string, string) {
+		plugin := cfg.GetFields()["config"].GetStructValue().GetFields()
+		return plugin["name"].GetStringValue(), plugin["rootId"].GetStringValue()
+	}
+
+	It("binds the filter to the root id, independently of the filter id", func() {
+		filter := &v1.FilterSpec{
+			Id:     "my-filter",
+			RootID: "stats_root",
+		}
+		Expect(RootID(filter)).To(Equal("stats_root"))
+
+		wasmFilter := MakeWasmFilter(filter, MakeV3LocalDatasource("/filter.wasm"))
+		name, rootId := getPluginConfig(wasmFilter.GetConfig())
+		Expect(name).To(Equal("my-filter"))
+		Expect(rootId).To(Equal("stats_root"))
+	})
+
+	It("defaults to the filter id", func() {
+		filter := &v1.FilterSpec{
+			Id: "my-filter",
+		}
+		Expect(RootID(filter)).To(Equal("my-filter"))
+
+		wasmFilter := MakeWasmFilter(filter, MakeV3LocalDatasource("/filter.wasm"))
+		_, rootId := getPluginConfig(wasmFilter.GetConfig())
+		Expect(rootId).To(Equal("my-filter"))
+	})
+})
+
+var _ = Describe("MakeIstioWasmNetworkFilter", func() {
+	filter := &v1.FilterSpec{
+		Id:     "tcp-filter",
+		RootID: "tcp_root",
+	}
+
+	It("creates network filters for older versions of Istio", func() {
+		networkFilter, err := MakeIstioWasmNetworkFilter(filter, MakeLocalDatasource("/filter.wasm"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(networkFilter.GetName()).To(Equal(WasmNetworkFilterName))
+		plugin := networkFilter.GetConfig().GetFields()["config"].GetStructValue().GetFields()
+		Expect(plugin["rootId"].GetStringValue()).To(Equal("tcp_root"))
+	})
+
+	It("creates typed network filters with a unique name", func() {
+		networkFilter, err := MakeTypedIstioWasmNetworkFilter(filter, MakeV3LocalDatasource("/filter.wasm"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(networkFilter.GetName()).To(Equal("wasme.tcp-filter"))
+		Expect(networkFilter.GetTypedConfig().GetTypeUrl()).To(Equal("type.googleapis.com/udpa.type.v1.TypedStruct"))
+	})
+})
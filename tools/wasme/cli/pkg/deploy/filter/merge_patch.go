@@ -0,0 +1,55 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// MergePatchConfig applies a JSON merge patch (RFC 7386) to a JSON object filter configuration.
+// an empty configuration is treated as an empty object.
+// the patched configuration must also be a JSON object.
+func MergePatchConfig(config, patch []byte) ([]byte, error) {
+	target := map[string]interface{}{}
+	if len(bytes.TrimSpace(config)) > 0 {
+		obj, isObj := parseJsonObject(config)
+		if !isObj {
+			return nil, errors.Errorf("cannot patch filter config, existing config is not a JSON object")
+		}
+		target = obj
+	}
+
+	var patchVal interface{}
+	decoder := json.NewDecoder(bytes.NewReader(patch))
+	decoder.UseNumber()
+	if err := decoder.Decode(&patchVal); err != nil {
+		return nil, errors.Wrap(err, "parsing merge patch")
+	}
+
+	patched, isObj := mergePatch(target, patchVal).(map[string]interface{})
+	if !isObj {
+		return nil, errors.Errorf("cannot patch filter config, patched config must be a JSON object")
+	}
+
+	return json.Marshal(patched)
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	patchObj, isObj := patch.(map[string]interface{})
+	if !isObj {
+		return patch
+	}
+	targetObj, isObj := target.(map[string]interface{})
+	if !isObj {
+		targetObj = map[string]interface{}{}
+	}
+	for k, v := range patchObj {
+		if v == nil {
+			delete(targetObj, k)
+			continue
+		}
+		targetObj[k] = mergePatch(targetObj[k], v)
+	}
+	return targetObj
+}
@@ -0,0 +1,35 @@
+package filter_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/filter"
+)
+
+var _ = Describe("MergePatchConfig", func() {
+	It("merges the patch into the existing config", func() {
+		patched, err := MergePatchConfig(
+			[]byte(`{"rateLimit":10,"headers":{"add":"x","remove":"y"},"keep":true}`),
+			[]byte(`{"rateLimit":50,"headers":{"remove":null},"new":[1,2]}`),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(patched).To(MatchJSON(`{"rateLimit":50,"headers":{"add":"x"},"keep":true,"new":[1,2]}`))
+	})
+
+	It("treats an empty config as an empty object", func() {
+		patched, err := MergePatchConfig(nil, []byte(`{"rateLimit":50}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(patched).To(MatchJSON(`{"rateLimit":50}`))
+	})
+
+	It("errors if the config or the result is not a JSON object", func() {
+		_, err := MergePatchConfig([]byte(`plain text`), []byte(`{"rateLimit":50}`))
+		Expect(err).To(HaveOccurred())
+
+		_, err = MergePatchConfig([]byte(`{}`), []byte(`[1]`))
+		Expect(err).To(HaveOccurred())
+
+		_, err = MergePatchConfig([]byte(`{}`), []byte(`{"rateLimit":`))
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,57 @@
+package filter
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"github.com/pkg/errors"
+)
+
+// ReservedEnvPrefix is the prefix of the environment variables of the filter VM reserved for wasme
+const ReservedEnvPrefix = "WASME_"
+
+var envKeyRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidateEnv returns an error for the first key of the environment variables of the filter VM,
+// in sorted order, which is not a valid environment variable name or is reserved
+func ValidateEnv(env map[string]string) error {
+	var keys []string
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !envKeyRegex.MatchString(key) {
+			return errors.Errorf("environment variable %q is invalid: names must consist of letters, digits and '_', and must not start with a digit", key)
+		}
+		if strings.HasPrefix(strings.ToUpper(key), ReservedEnvPrefix) {
+			return errors.Errorf("environment variable %q is invalid: the %v prefix is reserved", key, ReservedEnvPrefix)
+		}
+	}
+	return nil
+}
+
+// sets the environment variables on the vmConfig of the marshalled plugin config,
+// which are exposed to the VM by Envoy 1.17+ (Istio 1.9+) and dropped by older proxies.
+// the VmConfig of the envoy API vendored by Gloo predates environment_variables,
+// so the field is added to the Struct, with the JSON name the proxy expects
+func setVmEnv(cfg *structpb.Struct, env map[string]string) {
+	if len(env) == 0 {
+		return
+	}
+	vmConfig := cfg.GetFields()["config"].GetStructValue().GetFields()["vmConfig"].GetStructValue()
+	if vmConfig == nil {
+		return
+	}
+	keyValues := &structpb.Struct{Fields: map[string]*structpb.Value{}}
+	for key, value := range env {
+		keyValues.Fields[key] = &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: value}}
+	}
+	vmConfig.Fields["environmentVariables"] = &structpb.Value{Kind: &structpb.Value_StructValue{StructValue: &structpb.Struct{
+		Fields: map[string]*structpb.Value{
+			"keyValues": {Kind: &structpb.Value_StructValue{StructValue: keyValues}},
+		},
+	}}}
+}
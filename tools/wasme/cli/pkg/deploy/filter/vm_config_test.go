@@ -0,0 +1,91 @@
+package filter_test
+
+import (
+	udpav1 "github.com/cncf/udpa/go/udpa/type/v1"
+	"github.com/golang/protobuf/proto"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/filter"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+)
+
+var _ = Describe("VM config", func() {
+	var filter *v1.FilterSpec
+
+	BeforeEach(func() {
+		filter = &v1.FilterSpec{
+			Id:               "my-filter",
+			AllowPrecompiled: true,
+			Env:              map[string]string{"LOG_LEVEL": "debug", "_REGION": "eu"},
+		}
+	})
+
+	// returns the vmConfig of the marshalled plugin config
+	getVmConfig := func(cfg *structpb.Struct) map[string]*structpb.Value {
+		return cfg.GetFields()["config"].GetStructValue().GetFields()["vmConfig"].GetStructValue().GetFields()
+	}
+	getEnv := func(vmConfig map[string]*structpb.Value) map[string]string {
+		env := map[string]string{}
+		keyValues := vmConfig["environmentVariables"].GetStructValue().GetFields()["keyValues"].GetStructValue()
+		for key, value := range keyValues.GetFields() {
+			env[key] = value.GetStringValue()
+		}
+		return env
+	}
+
+	It("sets allow_precompiled and the environment variables on the typed wasm config", func() {
+		wasmFilter, err := MakeTypedIstioWasmFilter(filter, MakeV3LocalDatasource("/filter.wasm"))
+		Expect(err).NotTo(HaveOccurred())
+		var typedStruct udpav1.TypedStruct
+		Expect(proto.Unmarshal(wasmFilter.GetTypedConfig().GetValue(), &typedStruct)).NotTo(HaveOccurred())
+
+		vmConfig := getVmConfig(typedStruct.GetValue())
+		Expect(vmConfig["allowPrecompiled"].GetBoolValue()).To(BeTrue())
+		Expect(vmConfig["vmId"].GetStringValue()).To(Equal("my-filter"))
+		Expect(getEnv(vmConfig)).To(Equal(filter.Env))
+
+		wasmFilter = MakeWasmFilter(filter, MakeV3LocalDatasource("/filter.wasm"))
+		vmConfig = getVmConfig(wasmFilter.GetConfig())
+		Expect(vmConfig["allowPrecompiled"].GetBoolValue()).To(BeTrue())
+		Expect(getEnv(vmConfig)).To(Equal(filter.Env))
+	})
+
+	It("omits the options when they are not set", func() {
+		filter.AllowPrecompiled = false
+		filter.Env = nil
+		wasmFilter, err := MakeTypedIstioWasmFilter(filter, MakeV3LocalDatasource("/filter.wasm"))
+		Expect(err).NotTo(HaveOccurred())
+		var typedStruct udpav1.TypedStruct
+		Expect(proto.Unmarshal(wasmFilter.GetTypedConfig().GetValue(), &typedStruct)).NotTo(HaveOccurred())
+
+		vmConfig := getVmConfig(typedStruct.GetValue())
+		Expect(vmConfig).NotTo(HaveKey("allowPrecompiled"))
+		Expect(vmConfig).NotTo(HaveKey("environmentVariables"))
+	})
+
+	It("sets allow_precompiled on the wasm config of older versions of Istio, which cannot set environment variables", func() {
+		_, err := MakeIstioWasmFilter(filter, MakeLocalDatasource("/filter.wasm"))
+		Expect(err).To(MatchError("environment variables of the filter VM require Istio 1.9+"))
+
+		filter.Env = nil
+		wasmFilter, err := MakeIstioWasmFilter(filter, MakeLocalDatasource("/filter.wasm"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getVmConfig(wasmFilter.GetConfig())["allowPrecompiled"].GetBoolValue()).To(BeTrue())
+	})
+
+	It("rejects invalid or reserved environment variables", func() {
+		Expect(ValidateEnv(filter.Env)).NotTo(HaveOccurred())
+		Expect(ValidateEnv(nil)).NotTo(HaveOccurred())
+
+		Expect(ValidateEnv(map[string]string{"LOG-LEVEL": "debug"})).To(MatchError(`environment variable "LOG-LEVEL" is invalid: names must consist of letters, digits and '_', and must not start with a digit`))
+		Expect(ValidateEnv(map[string]string{"9LIVES": "x"})).To(HaveOccurred())
+		Expect(ValidateEnv(map[string]string{"": "x"})).To(HaveOccurred())
+		Expect(ValidateEnv(map[string]string{"WASME_FILTER_ID": "x"})).To(MatchError(`environment variable "WASME_FILTER_ID" is invalid: the WASME_ prefix is reserved`))
+		Expect(ValidateEnv(map[string]string{"wasme_debug": "x"})).To(HaveOccurred())
+
+		filter.Env["WASME_FILTER_ID"] = "x"
+		_, err := MakeTypedIstioWasmFilter(filter, MakeV3LocalDatasource("/filter.wasm"))
+		Expect(err).To(HaveOccurred())
+	})
+})
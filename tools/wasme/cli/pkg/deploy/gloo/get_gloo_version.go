@@ -0,0 +1,81 @@
+package gloo
+
+import (
+	"github.com/pkg/errors"
+	"github.com/solo-io/wasm/tools/wasme/pkg/util"
+	appsv1 "k8s.io/api/apps/v1"
+	kubeerrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	DefaultGlooNamespace = "gloo-system"
+
+	// the control plane deployment of Gloo, and its container
+	glooDeploymentName = "gloo"
+	glooContainerName  = "gloo"
+
+	// the deployment of the default gateway proxy, whose envoy image is tagged with the version of Gloo
+	gatewayProxyDeploymentName = "gateway-proxy"
+	gatewayProxyContainerName  = "gateway-proxy"
+)
+
+type VersionInspector interface {
+	GetGlooVersion() (string, error)
+}
+
+// StaticVersionInspector returns the inspector of a gloo version known in advance
+func StaticVersionInspector(glooVersion string) VersionInspector {
+	return staticVersionInspector(glooVersion)
+}
+
+type staticVersionInspector string
+
+func (i staticVersionInspector) GetGlooVersion() (string, error) {
+	return string(i), nil
+}
+
+type versionInspector struct {
+	glooNamespace string
+	kube          kubernetes.Interface
+}
+
+// NewVersionInspector returns the inspector reading the version of Gloo from the image tag of the gloo deployment
+// in the gloo namespace, or of the gateway-proxy deployment if Gloo runs without the gloo deployment in that namespace
+func NewVersionInspector(kube kubernetes.Interface, glooNamespace string) VersionInspector {
+	if glooNamespace == "" {
+		glooNamespace = DefaultGlooNamespace
+	}
+	return &versionInspector{
+		glooNamespace: glooNamespace,
+		kube:          kube,
+	}
+}
+
+func (i *versionInspector) GetGlooVersion() (string, error) {
+	for _, deployment := range []struct{ name, container string }{
+		{name: glooDeploymentName, container: glooContainerName},
+		{name: gatewayProxyDeploymentName, container: gatewayProxyContainerName},
+	} {
+		dep, err := i.kube.AppsV1().Deployments(i.glooNamespace).Get(deployment.name, metav1.GetOptions{})
+		if err != nil {
+			if kubeerrs.IsNotFound(err) {
+				continue
+			}
+			return "", errors.Wrapf(err, "getting deployment %v.%v", deployment.name, i.glooNamespace)
+		}
+		return containerImageTag(dep, deployment.container)
+	}
+	return "", errors.Errorf("did not find the %v or %v deployments of Gloo in namespace %v", glooDeploymentName, gatewayProxyDeploymentName, i.glooNamespace)
+}
+
+func containerImageTag(dep *appsv1.Deployment, containerName string) (string, error) {
+	for _, container := range dep.Spec.Template.Spec.Containers {
+		if container.Name == containerName {
+			_, tag, err := util.SplitImageRef(container.Image)
+			return tag, err
+		}
+	}
+	return "", errors.Errorf("did not find container named %s on deployment %v.%v", containerName, dep.Name, dep.Namespace)
+}
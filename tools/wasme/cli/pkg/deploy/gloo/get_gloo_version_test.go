@@ -0,0 +1,60 @@
+package gloo_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/gloo"
+	appsv1 "k8s.io/api/apps/v1"
+	kubev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// a deployment of gloo, with a single container running the image
+func makeGlooDeployment(name, namespace, container, image string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: appsv1.DeploymentSpec{
+			Template: kubev1.PodTemplateSpec{
+				Spec: kubev1.PodSpec{
+					Containers: []kubev1.Container{{Name: container, Image: image}},
+				},
+			},
+		},
+	}
+}
+
+var _ = Describe("VersionInspector", func() {
+	It("reads the version from the image of the gloo deployment", func() {
+		kube := fake.NewSimpleClientset(
+			makeGlooDeployment("gloo", "gloo-system", "gloo", "quay.io/solo-io/gloo:1.6.2"),
+			makeGlooDeployment("gateway-proxy", "gloo-system", "gateway-proxy", "quay.io/solo-io/gloo-envoy-wrapper:1.5.0"),
+		)
+		version, err := NewVersionInspector(kube, "").GetGlooVersion()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(version).To(Equal("1.6.2"))
+	})
+
+	It("falls back to the image of the gateway-proxy deployment", func() {
+		kube := fake.NewSimpleClientset(
+			makeGlooDeployment("gateway-proxy", "gloo", "gateway-proxy", "quay.io/solo-io/gloo-envoy-wrapper:1.7.0"),
+		)
+		version, err := NewVersionInspector(kube, "gloo").GetGlooVersion()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(version).To(Equal("1.7.0"))
+	})
+
+	It("fails if gloo is not installed in the namespace", func() {
+		kube := fake.NewSimpleClientset(
+			makeGlooDeployment("gloo", "other", "gloo", "quay.io/solo-io/gloo:1.6.2"),
+		)
+		_, err := NewVersionInspector(kube, "").GetGlooVersion()
+		Expect(err).To(MatchError("did not find the gloo or gateway-proxy deployments of Gloo in namespace gloo-system"))
+
+		kube = fake.NewSimpleClientset(
+			makeGlooDeployment("gloo", "gloo-system", "sidecar", "quay.io/solo-io/gloo:1.6.2"),
+		)
+		_, err = NewVersionInspector(kube, "").GetGlooVersion()
+		Expect(err).To(MatchError("did not find container named gloo on deployment gloo.gloo-system"))
+	})
+})
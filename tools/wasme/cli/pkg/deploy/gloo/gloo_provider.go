@@ -2,9 +2,15 @@ package gloo
 
 import (
 	"context"
+	"fmt"
 	"sort"
+	"strings"
 
 	skerrors "github.com/solo-io/solo-kit/pkg/errors"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/abi"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy"
+	envoyfilter "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/filter"
+	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
 	"github.com/solo-io/wasm/tools/wasme/pkg/util"
 
 	"github.com/sirupsen/logrus"
@@ -17,14 +23,38 @@ import (
 	"github.com/solo-io/solo-kit/pkg/api/v1/clients"
 	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// set on the Gateways to the ids of the filters added to them by wasme, separated by commas.
+	// the filters are only removed from the Gateways recording them
+	AppliedFiltersAnnotation = "wasme.io/filters"
 )
 
 // selects the gateways to which to deploy the wasm filter(s)
 type Selector struct {
-	Namespaces    []string
+	Namespaces []string
+	// if set, only the Gateways with these names are selected
+	GatewayNames  []string
 	GatewayLabels map[string]string
 }
 
+// returns true if the Gateway is selected by its name. the namespaces and labels are selected when listing the Gateways
+func (s Selector) selectsName(gw *gatewayv1.Gateway) bool {
+	if len(s.GatewayNames) == 0 {
+		return true
+	}
+	for _, name := range s.GatewayNames {
+		if gw.GetMetadata().Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Provider adds the filters to the httpGateway options of the selected Gateways, which apply them to every route of the Gateways.
+// The filters are not attached to Virtual Services or routes, whose options in the supported versions of Gloo have no wasm config.
 type Provider struct {
 	Ctx context.Context
 
@@ -32,52 +62,206 @@ type Provider struct {
 
 	// used to determine the workloads and gateways to which we apply the filters
 	Selector Selector
+
+	// optional callbacks, called with the selected gateways of each namespace before they are updated,
+	// and with each gateway once it was updated (or failed to update)
+	OnWorkloadsSelected func(workloadMetas []metav1.ObjectMeta)
+	OnWorkload          func(workloadMeta metav1.ObjectMeta, err error)
+
+	// used to read the ABI versions of the filter image
+	Puller pull.ImagePuller
+
+	// used to check the ABI versions of the filter image against the installed version of Gloo.
+	// if nil, the ABI versions are not checked
+	VersionInspector VersionInspector
+
+	// the registry the ABI versions of the image are checked against. defaults to abi.DefaultRegistry
+	AbiRegistry abi.Registry
+
+	// set to true to skip the ABI version check
+	IgnoreVersionCheck bool
+
+	// used by Verify to read the config of the gateway proxies. defaults to KubectlConfigDump
+	ConfigDump ConfigDumpFunc
+}
+
+// Capabilities returns the features of the provider. the filters are applied to the whole Gateway,
+// so no patch context or per-route config may be selected
+func (p *Provider) Capabilities() deploy.Capabilities {
+	return deploy.Capabilities{
+		Provider:     "gloo",
+		DryRun:       true,
+		DryRunRemove: true,
+		ListFilters:  true,
+		Verify:       true,
+	}
+}
+
+// AbiIncompatibleError is returned by ApplyFilter if the ABI versions of the image are not supported by the installed version of Gloo
+type AbiIncompatibleError struct {
+	Image       string
+	GlooVersion string
+}
+
+func (e *AbiIncompatibleError) Error() string {
+	return fmt.Sprintf("image %v not supported by gloo version %v", e.Image, e.GlooVersion)
 }
 
 // applies the filter to all selected workloads in selected namespaces
 func (p *Provider) ApplyFilter(filter *v1.FilterSpec) error {
-	return p.retryUpdateGateways(func(gateway *gatewayv1.Gateway) error {
-		return apendWasmConfig(filter, gateway)
-	})
+	if filter.GetConfigFrom() != nil {
+		return errors.Errorf("configFrom is only supported when deploying to istio")
+	}
+	// the wasm filters of Gloo do not configure the VM of the filter
+	if filter.GetAllowPrecompiled() || len(filter.GetEnv()) > 0 {
+		return errors.Errorf("allowPrecompiled and env are not supported when deploying to gloo")
+	}
+	if err := p.checkAbiVersions(filter); err != nil {
+		return err
+	}
+	// the deployer leaves the checksum of filters without a config to the provider
+	if filter.ConfigChecksum && filter.GetConfig() == nil {
+		if _, err := envoyfilter.InjectConfigChecksum(filter); err != nil {
+			return err
+		}
+	}
+	var selected int
+	if err := p.retryUpdateGateways(p.Selector.selectsName, func(gateway *gatewayv1.Gateway) error {
+		if err := apendWasmConfig(filter, gateway); err != nil {
+			return err
+		}
+		recordAppliedFilter(gateway, filter.Id)
+		return nil
+	}, &selected); err != nil {
+		return err
+	}
+	if selected == 0 {
+		return errors.Errorf("no gateways matched the selector (namespaces: %v, names: %v, labels: %v)", p.Selector.Namespaces, p.Selector.GatewayNames, p.Selector.GatewayLabels)
+	}
+	return nil
 }
 
-// removes the filter from all selected workloads in selected namespaces
+// returns an AbiIncompatibleError if the ABI versions declared by the filter image are not supported by the installed version of Gloo
+func (p *Provider) checkAbiVersions(filter *v1.FilterSpec) error {
+	if p.IgnoreVersionCheck {
+		logrus.WithFields(logrus.Fields{
+			"image": filter.Image,
+		}).Warnf("ignoreVersionCheck is set on the provider, skipping ABI version check")
+		return nil
+	}
+	if p.VersionInspector == nil {
+		return nil
+	}
+	if filter.IgnoreAbiCheck {
+		logrus.WithFields(logrus.Fields{
+			"image":  filter.Image,
+			"filter": filter.Id,
+		}).Warnf("ignoreAbiCheck is set on the filter, skipping ABI version check")
+		return nil
+	}
+	if p.Puller == nil {
+		return errors.Errorf("internal error: the provider requires a puller to check the ABI versions of the image")
+	}
+
+	image, err := p.Puller.Pull(p.Ctx, filter.Image)
+	if err != nil {
+		return err
+	}
+	cfg, err := image.FetchConfig(p.Ctx)
+	if err != nil {
+		return err
+	}
+	abiVersions := cfg.AbiVersions
+	if len(abiVersions) == 0 {
+		abiVersions = deploy.InferAbiVersions(p.Ctx, image)
+	}
+	if len(abiVersions) == 0 {
+		logrus.WithFields(logrus.Fields{
+			"image": image.Ref(),
+		}).Warnf("no ABI Version found for image, skipping ABI version check")
+		return nil
+	}
+
+	glooVersion, err := p.VersionInspector.GetGlooVersion()
+	if err != nil {
+		return errors.Wrap(err, "getting the gloo version, use --ignore-version-check to skip the ABI version check")
+	}
+	abiRegistry := p.AbiRegistry
+	if abiRegistry == nil {
+		abiRegistry = abi.DefaultRegistry
+	}
+	if err := abiRegistry.ValidateGlooVersion(abiVersions, glooVersion); err != nil {
+		return &AbiIncompatibleError{Image: image.Ref(), GlooVersion: glooVersion}
+	}
+	return nil
+}
+
+// removes the filter from the selected workloads in selected namespaces
+// which recorded the filter as applied by wasme
 func (p *Provider) RemoveFilter(filter *v1.FilterSpec) error {
-	return p.retryUpdateGateways(func(gateway *gatewayv1.Gateway) error {
-		return removeWasmConfig(filter.Id, gateway)
-	})
+	var selected int
+	return p.retryUpdateGateways(func(gateway *gatewayv1.Gateway) bool {
+		return p.Selector.selectsName(gateway) && filterRecorded(gateway, filter.Id)
+	}, func(gateway *gatewayv1.Gateway) error {
+		if err := removeWasmConfig(filter.Id, gateway); err != nil {
+			return err
+		}
+		removeAppliedFilter(gateway, filter.Id)
+		return nil
+	}, &selected)
 }
 
-func (p *Provider) retryUpdateGateways(updateFunc func(gateway *gatewayv1.Gateway) error) error {
+// updates the selected gateways, setting the number of selected gateways
+func (p *Provider) retryUpdateGateways(selectFunc func(gateway *gatewayv1.Gateway) bool, updateFunc func(gateway *gatewayv1.Gateway) error, selected *int) error {
 	return util.RetryOnFunc(func() error {
-		return p.updateGateways(updateFunc)
+		*selected = 0
+		return p.updateGateways(selectFunc, updateFunc, selected)
 	}, skerrors.IsResourceVersion)
 }
 
-func (p *Provider) updateGateways(updateFunc func(gateway *gatewayv1.Gateway) error) error {
+func (p *Provider) updateGateways(selectFunc func(gateway *gatewayv1.Gateway) bool, updateFunc func(gateway *gatewayv1.Gateway) error, selected *int) error {
 	namespaces := p.Selector.Namespaces
 	if len(namespaces) == 0 {
 		namespaces = []string{corev1.NamespaceAll}
 	}
 	for _, ns := range namespaces {
-		gateways, err := p.GatewayClient.List(ns, clients.ListOpts{
+		listed, err := p.GatewayClient.List(ns, clients.ListOpts{
 			Ctx:      p.Ctx,
 			Selector: p.Selector.GatewayLabels,
 		})
 		if err != nil {
 			return err
 		}
+		var gateways gatewayv1.GatewayList
+		for _, gw := range listed {
+			if selectFunc(gw) {
+				gateways = append(gateways, gw)
+			}
+		}
+		*selected += len(gateways)
+
+		if p.OnWorkloadsSelected != nil {
+			var gatewayMetas []metav1.ObjectMeta
+			for _, gw := range gateways {
+				gatewayMetas = append(gatewayMetas, gatewayMeta(gw))
+			}
+			p.OnWorkloadsSelected(gatewayMetas)
+		}
 
 		for _, gw := range gateways {
 			if err := updateFunc(gw); err != nil {
 				contextutils.LoggerFrom(p.Ctx).Warnf("skipping gateway %v", gw.Metadata.Ref())
+				p.onWorkload(gw, err)
+				continue
 			}
 			if _, err := p.GatewayClient.Write(gw, clients.WriteOpts{
 				Ctx:               p.Ctx,
 				OverwriteExisting: true,
 			}); err != nil {
+				p.onWorkload(gw, err)
 				return err
 			}
+			p.onWorkload(gw, nil)
 			logrus.WithFields(logrus.Fields{
 				"gateway": gw.Metadata.Namespace + "." + gw.Metadata.Name,
 			}).Infof("updated gateway")
@@ -86,6 +270,63 @@ func (p *Provider) updateGateways(updateFunc func(gateway *gatewayv1.Gateway) er
 	return nil
 }
 
+func (p *Provider) onWorkload(gw *gatewayv1.Gateway, err error) {
+	if p.OnWorkload != nil {
+		p.OnWorkload(gatewayMeta(gw), err)
+	}
+}
+
+func gatewayMeta(gw *gatewayv1.Gateway) metav1.ObjectMeta {
+	return metav1.ObjectMeta{Name: gw.Metadata.Name, Namespace: gw.Metadata.Namespace}
+}
+
+// returns the ids of the filters recorded as applied to the gateway by wasme
+func appliedFilters(gateway *gatewayv1.Gateway) []string {
+	value := gateway.GetMetadata().Annotations[AppliedFiltersAnnotation]
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+func filterRecorded(gateway *gatewayv1.Gateway, filterID string) bool {
+	for _, id := range appliedFilters(gateway) {
+		if id == filterID {
+			return true
+		}
+	}
+	return false
+}
+
+func recordAppliedFilter(gateway *gatewayv1.Gateway, filterID string) {
+	if filterRecorded(gateway, filterID) {
+		return
+	}
+	writeAppliedFilters(gateway, append(appliedFilters(gateway), filterID))
+}
+
+func removeAppliedFilter(gateway *gatewayv1.Gateway, filterID string) {
+	var remaining []string
+	for _, id := range appliedFilters(gateway) {
+		if id != filterID {
+			remaining = append(remaining, id)
+		}
+	}
+	writeAppliedFilters(gateway, remaining)
+}
+
+func writeAppliedFilters(gateway *gatewayv1.Gateway, filterIDs []string) {
+	if len(filterIDs) == 0 {
+		delete(gateway.Metadata.Annotations, AppliedFiltersAnnotation)
+		return
+	}
+	sort.Strings(filterIDs)
+	if gateway.Metadata.Annotations == nil {
+		gateway.Metadata.Annotations = map[string]string{}
+	}
+	gateway.Metadata.Annotations[AppliedFiltersAnnotation] = strings.Join(filterIDs, ",")
+}
+
 func apendWasmConfig(filter *v1.FilterSpec, gateway *gatewayv1.Gateway) error {
 	httpGw := gateway.GetHttpGateway()
 	if httpGw == nil {
@@ -107,7 +348,7 @@ func apendWasmConfig(filter *v1.FilterSpec, gateway *gatewayv1.Gateway) error {
 		Image:  filter.Image,
 		Config: filter.Config,
 		Name:   filter.Id,
-		RootId: filter.RootID,
+		RootId: envoyfilter.RootID(filter),
 		VmType: wasm.WasmFilter_V8, // default to V8
 	}
 
@@ -0,0 +1,213 @@
+package gloo_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	gatewayv1 "github.com/solo-io/gloo/projects/gateway/pkg/api/v1"
+	"github.com/solo-io/solo-kit/pkg/api/v1/clients"
+	"github.com/solo-io/solo-kit/pkg/api/v1/clients/factory"
+	"github.com/solo-io/solo-kit/pkg/api/v1/clients/memory"
+	"github.com/solo-io/solo-kit/pkg/api/v1/resources/core"
+	envoyfilter "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/filter"
+	. "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/gloo"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	testutils "github.com/solo-io/wasm/tools/wasme/cli/test"
+	"github.com/solo-io/wasm/tools/wasme/pkg/config"
+	"github.com/solo-io/wasm/tools/wasme/pkg/model"
+	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Provider", func() {
+	var (
+		gatewayClient gatewayv1.GatewayClient
+		filter        *v1.FilterSpec
+	)
+	BeforeEach(func() {
+		var err error
+		gatewayClient, err = gatewayv1.NewGatewayClient(&factory.MemoryResourceClientFactory{Cache: memory.NewInMemoryResourceCache()})
+		Expect(err).NotTo(HaveOccurred())
+		for _, gw := range []*gatewayv1.Gateway{
+			{
+				Metadata:    core.Metadata{Name: "public", Namespace: "gloo-system", Labels: map[string]string{"exposure": "external"}},
+				GatewayType: &gatewayv1.Gateway_HttpGateway{HttpGateway: &gatewayv1.HttpGateway{}},
+			},
+			{
+				Metadata:    core.Metadata{Name: "internal", Namespace: "gloo-system", Labels: map[string]string{"exposure": "internal"}},
+				GatewayType: &gatewayv1.Gateway_HttpGateway{HttpGateway: &gatewayv1.HttpGateway{}},
+			},
+			{
+				Metadata:    core.Metadata{Name: "admin", Namespace: "gloo-system", Labels: map[string]string{"exposure": "internal"}},
+				GatewayType: &gatewayv1.Gateway_HttpGateway{HttpGateway: &gatewayv1.HttpGateway{}},
+			},
+		} {
+			_, err := gatewayClient.Write(gw, clients.WriteOpts{})
+			Expect(err).NotTo(HaveOccurred())
+		}
+		filter = &v1.FilterSpec{Id: "myfilter", Image: "webassemblyhub.io/test/filter:v1", RootID: "root"}
+	})
+	provider := func(selector Selector) *Provider {
+		return &Provider{Ctx: context.TODO(), GatewayClient: gatewayClient, Selector: selector}
+	}
+	filterNames := func(name string) []string {
+		gw, err := gatewayClient.Read("gloo-system", name, clients.ReadOpts{})
+		Expect(err).NotTo(HaveOccurred())
+		var names []string
+		for _, filter := range gw.GetHttpGateway().GetOptions().GetWasm().GetFilters() {
+			names = append(names, filter.GetName())
+		}
+		return names
+	}
+	annotation := func(name string) string {
+		gw, err := gatewayClient.Read("gloo-system", name, clients.ReadOpts{})
+		Expect(err).NotTo(HaveOccurred())
+		return gw.GetMetadata().Annotations[AppliedFiltersAnnotation]
+	}
+
+	It("adds the filter to the gateways selected by name and labels, recording it on them", func() {
+		Expect(provider(Selector{GatewayNames: []string{"public", "internal"}, GatewayLabels: map[string]string{"exposure": "external"}}).ApplyFilter(filter)).NotTo(HaveOccurred())
+
+		Expect(filterNames("public")).To(Equal([]string{"myfilter"}))
+		Expect(annotation("public")).To(Equal("myfilter"))
+		Expect(filterNames("internal")).To(BeEmpty())
+		Expect(filterNames("admin")).To(BeEmpty())
+	})
+
+	It("fails if no gateway matched", func() {
+		err := provider(Selector{Namespaces: []string{"gloo-system"}, GatewayNames: []string{"missing"}}).ApplyFilter(filter)
+		Expect(err).To(MatchError("no gateways matched the selector (namespaces: [gloo-system], names: [missing], labels: map[])"))
+	})
+
+	It("injects the config checksum into filters without a config", func() {
+		filter.ConfigChecksum = true
+		Expect(provider(Selector{GatewayNames: []string{"public"}}).ApplyFilter(filter)).NotTo(HaveOccurred())
+
+		gw, err := gatewayClient.Read("gloo-system", "public", clients.ReadOpts{})
+		Expect(err).NotTo(HaveOccurred())
+		config := gw.GetHttpGateway().GetOptions().GetWasm().GetFilters()[0].GetConfig()
+		Expect(envoyfilter.GetConfigChecksum(config)).To(HavePrefix("sha256:"))
+	})
+
+	It("rejects the options of the filter VM, which gloo cannot configure", func() {
+		filter.Env = map[string]string{"LOG_LEVEL": "debug"}
+		err := provider(Selector{GatewayNames: []string{"public"}}).ApplyFilter(filter)
+		Expect(err).To(MatchError("allowPrecompiled and env are not supported when deploying to gloo"))
+		Expect(filterNames("public")).To(BeEmpty())
+	})
+
+	It("only removes the filter from the gateways it was deployed to", func() {
+		Expect(provider(Selector{GatewayNames: []string{"public"}}).ApplyFilter(filter)).NotTo(HaveOccurred())
+		other := &v1.FilterSpec{Id: "other", Image: "webassemblyhub.io/test/filter:v1", RootID: "root"}
+		Expect(provider(Selector{GatewayNames: []string{"public"}}).ApplyFilter(other)).NotTo(HaveOccurred())
+		Expect(annotation("public")).To(Equal("myfilter,other"))
+
+		// a filter with the same name, added to the gateway without wasme
+		Expect(provider(Selector{GatewayNames: []string{"internal"}}).ApplyFilter(filter)).NotTo(HaveOccurred())
+		gw, err := gatewayClient.Read("gloo-system", "internal", clients.ReadOpts{})
+		Expect(err).NotTo(HaveOccurred())
+		delete(gw.Metadata.Annotations, AppliedFiltersAnnotation)
+		_, err = gatewayClient.Write(gw, clients.WriteOpts{OverwriteExisting: true})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(provider(Selector{}).RemoveFilter(filter)).NotTo(HaveOccurred())
+		Expect(filterNames("public")).To(Equal([]string{"other"}))
+		Expect(annotation("public")).To(Equal("other"))
+		Expect(filterNames("admin")).To(BeEmpty())
+		Expect(filterNames("internal")).To(Equal([]string{"myfilter"}))
+	})
+
+	Context("checking the abi versions of the image", func() {
+		var puller *abiVersionsPuller
+		BeforeEach(func() {
+			puller = &abiVersionsPuller{abiVersions: []string{"v0.2.1"}}
+		})
+		providerForGloo := func(glooImage string) *Provider {
+			p := provider(Selector{GatewayNames: []string{"public"}})
+			p.Puller = puller
+			p.VersionInspector = NewVersionInspector(fake.NewSimpleClientset(makeGlooDeployment("gloo", "gloo-system", "gloo", glooImage)), "")
+			return p
+		}
+
+		It("adds the filter if its abi versions are supported by the installed gloo", func() {
+			for _, glooImage := range []string{"quay.io/solo-io/gloo:1.6.0", "quay.io/solo-io/gloo:1.6.12", "quay.io/solo-io/gloo-ee:1.7.1"} {
+				Expect(providerForGloo(glooImage).ApplyFilter(filter)).NotTo(HaveOccurred(), glooImage)
+			}
+			Expect(filterNames("public")).To(Equal([]string{"myfilter"}))
+		})
+
+		It("rejects the filter if its abi versions are not supported by the installed gloo", func() {
+			for _, glooImage := range []string{"quay.io/solo-io/gloo:1.5.3", "quay.io/solo-io/gloo:1.3.0"} {
+				err := providerForGloo(glooImage).ApplyFilter(filter)
+				Expect(err).To(BeAssignableToTypeOf(&AbiIncompatibleError{}), glooImage)
+				version := strings.TrimPrefix(glooImage, "quay.io/solo-io/gloo:")
+				Expect(err).To(MatchError("image webassemblyhub.io/test/filter:v1 not supported by gloo version " + version))
+			}
+			Expect(filterNames("public")).To(BeEmpty())
+		})
+
+		It("skips the check if it is ignored, or the image declares no abi versions", func() {
+			p := providerForGloo("quay.io/solo-io/gloo:1.5.3")
+			p.IgnoreVersionCheck = true
+			Expect(p.ApplyFilter(filter)).NotTo(HaveOccurred())
+
+			ignoring := *filter
+			ignoring.Id, ignoring.IgnoreAbiCheck = "ignoring", true
+			Expect(providerForGloo("quay.io/solo-io/gloo:1.5.3").ApplyFilter(&ignoring)).NotTo(HaveOccurred())
+
+			puller.abiVersions = nil
+			undeclared := *filter
+			undeclared.Id = "undeclared"
+			Expect(providerForGloo("quay.io/solo-io/gloo:1.5.3").ApplyFilter(&undeclared)).NotTo(HaveOccurred())
+
+			Expect(filterNames("public")).To(Equal([]string{"ignoring", "myfilter", "undeclared"}))
+		})
+
+		It("checks the abi versions inferred from the module if the image declares none", func() {
+			puller.abiVersions = nil
+			puller.module = testutils.ProxyWasmModule("proxy_abi_version_0_1_0")
+			err := providerForGloo("quay.io/solo-io/gloo:1.6.0").ApplyFilter(filter)
+			Expect(err).To(MatchError("image webassemblyhub.io/test/filter:v1 not supported by gloo version 1.6.0"))
+			Expect(providerForGloo("quay.io/solo-io/gloo:1.5.3").ApplyFilter(filter)).NotTo(HaveOccurred())
+		})
+	})
+})
+
+// pulls images declaring the abi versions
+type abiVersionsPuller struct {
+	abiVersions []string
+	// the module of the images, empty by default
+	module []byte
+}
+
+func (p *abiVersionsPuller) Pull(ctx context.Context, ref string) (pull.Image, error) {
+	return &abiVersionsImage{ref: ref, abiVersions: p.abiVersions, module: p.module}, nil
+}
+
+type abiVersionsImage struct {
+	ref         string
+	abiVersions []string
+	module      []byte
+}
+
+func (i *abiVersionsImage) Ref() string {
+	return i.ref
+}
+
+func (i *abiVersionsImage) Descriptor() (ocispec.Descriptor, error) {
+	return ocispec.Descriptor{Digest: digest.FromString(i.ref)}, nil
+}
+
+func (i *abiVersionsImage) FetchFilter(ctx context.Context) (model.Filter, error) {
+	return ioutil.NopCloser(bytes.NewReader(i.module)), nil
+}
+
+func (i *abiVersionsImage) FetchConfig(ctx context.Context) (*config.Runtime, error) {
+	return &config.Runtime{AbiVersions: i.abiVersions}, nil
+}
@@ -0,0 +1,282 @@
+package gloo
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	gatewayv1 "github.com/solo-io/gloo/projects/gateway/pkg/api/v1"
+	"github.com/solo-io/gloo/projects/gateway/pkg/defaults"
+	"github.com/solo-io/solo-kit/pkg/api/v1/clients"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// the port of the Envoy admin API of the gateway proxies
+	gatewayProxyAdminPort = 19000
+
+	StatusActive = "active"
+)
+
+// ConfigDumpFunc returns the config_dump of the Envoy admin API of the gateway proxy deployment
+type ConfigDumpFunc func(namespace, proxyName string) ([]byte, error)
+
+// a filter recorded on a gateway, with the proxies of the gateway
+type gatewayFilter struct {
+	deploy.DeployedFilter
+	namespace  string
+	proxyNames []string
+}
+
+// ListFilters lists the filters deployed by wasme to the selected gateways whose id starts with the prefix,
+// every filter if the prefix is empty. the filters are listed from the AppliedFiltersAnnotation of the gateways,
+// so filters deployed by older versions of wasme are not listed
+func (p *Provider) ListFilters(idPrefix string) ([]deploy.DeployedFilter, error) {
+	filters, err := p.listGatewayFilters(idPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var deployed []deploy.DeployedFilter
+	for _, filter := range filters {
+		deployed = append(deployed, filter.DeployedFilter)
+	}
+	deploy.SortDeployedFilters(deployed)
+	return deployed, nil
+}
+
+// Verify lists the filters like ListFilters, setting the status of each filter to StatusActive
+// if the gateway proxies of its gateway run the module of its image, as read from their config_dump
+func (p *Provider) Verify(idPrefix string) ([]deploy.DeployedFilter, error) {
+	if p.Puller == nil {
+		return nil, errors.Errorf("internal error: the provider requires a puller to verify the filters")
+	}
+	configDump := p.ConfigDump
+	if configDump == nil {
+		configDump = KubectlConfigDump(p.Ctx)
+	}
+	filters, err := p.listGatewayFilters(idPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	// the digests of the images, and the config dumps of the proxies, by namespace.name
+	digests := map[string]string{}
+	configDumps := map[string][]byte{}
+	configDumpErrs := map[string]error{}
+
+	var verified []deploy.DeployedFilter
+	for _, filter := range filters {
+		digest, ok := digests[filter.Image]
+		if !ok {
+			image, err := p.Puller.Pull(p.Ctx, filter.Image)
+			if err != nil {
+				return nil, err
+			}
+			descriptor, err := image.Descriptor()
+			if err != nil {
+				return nil, err
+			}
+			digest = descriptor.Digest.Hex()
+			digests[filter.Image] = digest
+		}
+
+		var statuses []string
+		for _, proxyName := range filter.proxyNames {
+			proxy := proxyName + "." + filter.namespace
+			if _, ok := configDumps[proxy]; !ok && configDumpErrs[proxy] == nil {
+				configDumps[proxy], configDumpErrs[proxy] = configDump(filter.namespace, proxyName)
+			}
+			if err := configDumpErrs[proxy]; err != nil {
+				statuses = append(statuses, fmt.Sprintf("%v: unverified: %v", proxyName, err))
+				continue
+			}
+			status, err := filterStatus(configDumps[proxy], filter.Id, digest)
+			if err != nil {
+				return nil, errors.Wrapf(err, "reading the config_dump of %v", proxy)
+			}
+			if status != StatusActive {
+				statuses = append(statuses, proxyName+": "+status)
+			}
+		}
+		filter.Status = StatusActive
+		if len(statuses) > 0 {
+			filter.Status = strings.Join(statuses, "; ")
+		}
+		verified = append(verified, filter.DeployedFilter)
+	}
+	deploy.SortDeployedFilters(verified)
+	return verified, nil
+}
+
+func (p *Provider) listGatewayFilters(idPrefix string) ([]gatewayFilter, error) {
+	namespaces := p.Selector.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{corev1.NamespaceAll}
+	}
+	var filters []gatewayFilter
+	for _, ns := range namespaces {
+		gateways, err := p.GatewayClient.List(ns, clients.ListOpts{
+			Ctx:      p.Ctx,
+			Selector: p.Selector.GatewayLabels,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, gw := range gateways {
+			if !p.Selector.selectsName(gw) {
+				continue
+			}
+			filters = append(filters, recordedFilters(gw, idPrefix)...)
+		}
+	}
+	return filters, nil
+}
+
+// returns the filters recorded as applied to the gateway whose id starts with the prefix.
+// filters recorded on the gateway but removed from its options since are not returned
+func recordedFilters(gw *gatewayv1.Gateway, idPrefix string) []gatewayFilter {
+	proxyNames := gw.GetProxyNames()
+	if len(proxyNames) == 0 {
+		proxyNames = []string{defaults.GatewayProxyName}
+	}
+	var filters []gatewayFilter
+	for _, id := range appliedFilters(gw) {
+		if !strings.HasPrefix(id, idPrefix) {
+			continue
+		}
+		for _, wasmFilter := range gw.GetHttpGateway().GetOptions().GetWasm().GetFilters() {
+			if wasmFilter.GetName() != id {
+				continue
+			}
+			filters = append(filters, gatewayFilter{
+				DeployedFilter: deploy.DeployedFilter{
+					Id:       id,
+					Image:    wasmFilter.GetImage(),
+					Workload: gw.GetMetadata().Name + "." + gw.GetMetadata().Namespace,
+				},
+				namespace:  gw.GetMetadata().Namespace,
+				proxyNames: proxyNames,
+			})
+		}
+	}
+	return filters
+}
+
+// returns StatusActive if the config dump contains the wasm filter with the module of the digest,
+// or the reason the filter is not active
+func filterStatus(configDump []byte, filterID, digest string) (string, error) {
+	var dump interface{}
+	if err := json.Unmarshal(configDump, &dump); err != nil {
+		return "", err
+	}
+	var loadedDigests []string
+	findWasmFilters(dump, filterID, &loadedDigests)
+	if len(loadedDigests) == 0 {
+		return "not loaded by the proxy", nil
+	}
+	for _, loaded := range loadedDigests {
+		if loaded != digest {
+			return fmt.Sprintf("the proxy runs the module sha256:%v, expected sha256:%v", loaded, digest), nil
+		}
+	}
+	return StatusActive, nil
+}
+
+// appends the sha256 of the module of each wasm filter with the name found in the config, e.g.
+//
+//	{"config": {"name": "myfilter", "vm_config": {"code": {"remote": {"sha256": "..."}}}}}
+func findWasmFilters(config interface{}, filterID string, digests *[]string) {
+	switch value := config.(type) {
+	case []interface{}:
+		for _, item := range value {
+			findWasmFilters(item, filterID, digests)
+		}
+	case map[string]interface{}:
+		if value["name"] == filterID {
+			for _, vmConfigKey := range []string{"vm_config", "vmConfig"} {
+				if vmConfig, ok := value[vmConfigKey].(map[string]interface{}); ok {
+					*digests = append(*digests, moduleSha256(vmConfig))
+					return
+				}
+			}
+		}
+		for _, item := range value {
+			findWasmFilters(item, filterID, digests)
+		}
+	}
+}
+
+func moduleSha256(vmConfig map[string]interface{}) string {
+	code, _ := vmConfig["code"].(map[string]interface{})
+	remote, _ := code["remote"].(map[string]interface{})
+	sha256, _ := remote["sha256"].(string)
+	return sha256
+}
+
+// KubectlConfigDump returns the ConfigDumpFunc reading the config_dump of the gateway proxies
+// through a port-forward to their admin API, run with kubectl
+func KubectlConfigDump(ctx context.Context) ConfigDumpFunc {
+	return func(namespace, proxyName string) ([]byte, error) {
+		port, err := freePort()
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, "kubectl", "port-forward", "-n", namespace, "deployment/"+proxyName,
+			fmt.Sprintf("%v:%v", port, gatewayProxyAdminPort))
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, errors.Wrap(err, "running kubectl port-forward")
+		}
+		defer cmd.Wait()
+
+		// kubectl prints a line once it forwards the port
+		forwarding := make(chan bool, 1)
+		go func() {
+			scanner := bufio.NewScanner(stdout)
+			forwarding <- scanner.Scan()
+			for scanner.Scan() {
+			}
+		}()
+		select {
+		case ok := <-forwarding:
+			if !ok {
+				return nil, errors.Errorf("kubectl port-forward to deployment %v.%v exited", proxyName, namespace)
+			}
+		case <-time.After(30 * time.Second):
+			return nil, errors.Errorf("timed out port-forwarding to deployment %v.%v", proxyName, namespace)
+		}
+
+		resp, err := http.Get(fmt.Sprintf("http://localhost:%v/config_dump", port))
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, errors.Errorf("unexpected status %v reading the config_dump of %v.%v", resp.Status, proxyName, namespace)
+		}
+		return ioutil.ReadAll(resp.Body)
+	}
+}
+
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,139 @@
+package gloo_test
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	gatewayv1 "github.com/solo-io/gloo/projects/gateway/pkg/api/v1"
+	"github.com/solo-io/solo-kit/pkg/api/v1/clients"
+	"github.com/solo-io/solo-kit/pkg/api/v1/clients/factory"
+	"github.com/solo-io/solo-kit/pkg/api/v1/clients/memory"
+	"github.com/solo-io/solo-kit/pkg/api/v1/resources/core"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy"
+	. "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/gloo"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+)
+
+var _ = Describe("ListFilters", func() {
+	var (
+		gatewayClient gatewayv1.GatewayClient
+		provider      *Provider
+	)
+	BeforeEach(func() {
+		var err error
+		gatewayClient, err = gatewayv1.NewGatewayClient(&factory.MemoryResourceClientFactory{Cache: memory.NewInMemoryResourceCache()})
+		Expect(err).NotTo(HaveOccurred())
+		for _, gw := range []*gatewayv1.Gateway{
+			{
+				Metadata:    core.Metadata{Name: "public", Namespace: "gloo-system"},
+				GatewayType: &gatewayv1.Gateway_HttpGateway{HttpGateway: &gatewayv1.HttpGateway{}},
+			},
+			{
+				Metadata:    core.Metadata{Name: "internal", Namespace: "gloo-system"},
+				GatewayType: &gatewayv1.Gateway_HttpGateway{HttpGateway: &gatewayv1.HttpGateway{}},
+				ProxyNames:  []string{"internal-proxy"},
+			},
+		} {
+			_, err := gatewayClient.Write(gw, clients.WriteOpts{})
+			Expect(err).NotTo(HaveOccurred())
+		}
+		provider = &Provider{Ctx: context.TODO(), GatewayClient: gatewayClient, Puller: &abiVersionsPuller{}}
+		for _, filter := range []*v1.FilterSpec{
+			{Id: "auth", Image: "webassemblyhub.io/test/auth:v1"},
+			{Id: "headers", Image: "webassemblyhub.io/test/headers:v1"},
+		} {
+			Expect(provider.ApplyFilter(filter)).NotTo(HaveOccurred())
+		}
+	})
+
+	// the config_dump of the proxy running the filters with the modules of the images
+	configDump := func(filters map[string]string) []byte {
+		var httpFilters string
+		for id, image := range filters {
+			if httpFilters != "" {
+				httpFilters += ","
+			}
+			httpFilters += fmt.Sprintf(`{"name": "envoy.filters.http.wasm", "typed_config": {"config": {"name": %q, "vm_config": {"code": {"remote": {"sha256": %q}}}}}}`,
+				id, digest.FromString(image).Hex())
+		}
+		return []byte(`{"configs": [{"dynamic_listeners": [{"active_state": {"listener": {"filter_chains": [{"filters": [{"typed_config": {"http_filters": [` + httpFilters + `]}}]}]}}}]}]}`)
+	}
+
+	It("lists the filters recorded on the gateways", func() {
+		filters, err := provider.ListFilters("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filters).To(Equal([]deploy.DeployedFilter{
+			{Id: "auth", Image: "webassemblyhub.io/test/auth:v1", Workload: "internal.gloo-system"},
+			{Id: "auth", Image: "webassemblyhub.io/test/auth:v1", Workload: "public.gloo-system"},
+			{Id: "headers", Image: "webassemblyhub.io/test/headers:v1", Workload: "internal.gloo-system"},
+			{Id: "headers", Image: "webassemblyhub.io/test/headers:v1", Workload: "public.gloo-system"},
+		}))
+
+		provider.Selector = Selector{GatewayNames: []string{"public"}}
+		filters, err = provider.ListFilters("head")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filters).To(Equal([]deploy.DeployedFilter{
+			{Id: "headers", Image: "webassemblyhub.io/test/headers:v1", Workload: "public.gloo-system"},
+		}))
+	})
+
+	It("does not list the filters deployed without wasme", func() {
+		gw, err := gatewayClient.Read("gloo-system", "public", clients.ReadOpts{})
+		Expect(err).NotTo(HaveOccurred())
+		gw.Metadata.Annotations = nil
+		_, err = gatewayClient.Write(gw, clients.WriteOpts{OverwriteExisting: true})
+		Expect(err).NotTo(HaveOccurred())
+
+		filters, err := provider.ListFilters("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filters).To(HaveLen(2))
+		for _, filter := range filters {
+			Expect(filter.Workload).To(Equal("internal.gloo-system"))
+		}
+	})
+
+	It("verifies the filters against the config_dump of the gateway proxies", func() {
+		var dumped []string
+		provider.ConfigDump = func(namespace, proxyName string) ([]byte, error) {
+			dumped = append(dumped, proxyName+"."+namespace)
+			switch proxyName {
+			case "gateway-proxy":
+				return configDump(map[string]string{"auth": "webassemblyhub.io/test/auth:v1", "headers": "webassemblyhub.io/test/headers:v0"}), nil
+			case "internal-proxy":
+				return configDump(map[string]string{"auth": "webassemblyhub.io/test/auth:v1"}), nil
+			}
+			return nil, errors.Errorf("unexpected proxy %v", proxyName)
+		}
+		filters, err := provider.Verify("")
+		Expect(err).NotTo(HaveOccurred())
+		// the config_dump of each proxy is read once
+		Expect(dumped).To(ConsistOf("gateway-proxy.gloo-system", "internal-proxy.gloo-system"))
+
+		var statuses []string
+		for _, filter := range filters {
+			statuses = append(statuses, filter.Id+" "+filter.Workload+": "+filter.Status)
+		}
+		Expect(statuses).To(Equal([]string{
+			"auth internal.gloo-system: active",
+			"auth public.gloo-system: active",
+			"headers internal.gloo-system: internal-proxy: not loaded by the proxy",
+			fmt.Sprintf("headers public.gloo-system: gateway-proxy: the proxy runs the module sha256:%v, expected sha256:%v",
+				digest.FromString("webassemblyhub.io/test/headers:v0").Hex(), digest.FromString("webassemblyhub.io/test/headers:v1").Hex()),
+		}))
+	})
+
+	It("reports the proxies whose config_dump could not be read", func() {
+		provider.ConfigDump = func(namespace, proxyName string) ([]byte, error) {
+			return nil, errors.Errorf("port-forward failed")
+		}
+		filters, err := provider.Verify("auth")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filters).To(HaveLen(2))
+		Expect(filters[0].Status).To(Equal("internal-proxy: unverified: port-forward failed"))
+		Expect(filters[1].Status).To(Equal("gateway-proxy: unverified: port-forward failed"))
+	})
+})
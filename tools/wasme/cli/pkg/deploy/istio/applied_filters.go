@@ -0,0 +1,154 @@
+package istio
+
+import (
+	"encoding/json"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// set on the pod templates of workloads to the filters applied to them by wasme, by filter id
+	AppliedFiltersAnnotation = "wasme.io/filters"
+)
+
+// AppliedFilter is the state of a filter applied to a workload,
+// as recorded in the AppliedFiltersAnnotation of the workload
+type AppliedFilter struct {
+	Image  string `json:"image"`
+	Digest string `json:"digest"`
+	// the ref of the image pinned to its digest, if the provider pins the image
+	PinnedImage string `json:"pinnedImage,omitempty"`
+	// the sha256 of the filter spec, covering the filter configuration and options
+	ConfigHash string `json:"configHash"`
+}
+
+// returns the state recorded on the workloads the filter is applied to.
+// the filter must have its configuration resolved
+func makeAppliedFilter(filter *v1.FilterSpec, image pull.Image) (AppliedFilter, error) {
+	descriptor, err := image.Descriptor()
+	if err != nil {
+		return AppliedFilter{}, err
+	}
+	spec, err := proto.Marshal(filter)
+	if err != nil {
+		return AppliedFilter{}, err
+	}
+	return AppliedFilter{
+		Image:      filter.Image,
+		Digest:     descriptor.Digest.String(),
+		ConfigHash: digest.FromBytes(spec).String(),
+	}, nil
+}
+
+// GetAppliedFilters returns the filters recorded as applied to the workload with the pod template, by filter id
+func GetAppliedFilters(template *corev1.PodTemplateSpec) (map[string]AppliedFilter, error) {
+	applied := map[string]AppliedFilter{}
+	value, ok := template.Annotations[AppliedFiltersAnnotation]
+	if !ok {
+		return applied, nil
+	}
+	if err := json.Unmarshal([]byte(value), &applied); err != nil {
+		return nil, errors.Wrapf(err, "parsing annotation %v", AppliedFiltersAnnotation)
+	}
+	return applied, nil
+}
+
+// returns true if the filter is recorded as applied to the workload with the same state,
+// and the workload still mounts the cache, see Provider.cacheMounted
+func filterAlreadyApplied(template *corev1.PodTemplateSpec, cacheMounted bool, filterId string, state AppliedFilter) bool {
+	if !cacheMounted {
+		return false
+	}
+	return filterRecorded(template, filterId, state)
+}
+
+// returns true if the filter is recorded as applied to the workload with the same image ref, but another config
+// or image digest, and the workload still mounts the cache.
+// the sidecars already mount the filter cache, so the filter is updated by updating its EnvoyFilter,
+// which the proxies reload, without updating the workload and restarting its pods.
+// the workload keeps recording the state the filter was first applied with
+func filterUpdatableInPlace(template *corev1.PodTemplateSpec, cacheMounted bool, filterId string, state AppliedFilter) bool {
+	if !cacheMounted {
+		return false
+	}
+	applied, err := GetAppliedFilters(template)
+	if err != nil {
+		return false
+	}
+	current, ok := applied[filterId]
+	return ok && current != state && current.Image == state.Image
+}
+
+// returns true if the sidecar annotations written by wasme are present on the pod template
+func sidecarAnnotationsApplied(template *corev1.PodTemplateSpec, required map[string]string) bool {
+	if template.Annotations[appliedAnnotation] != "true" {
+		return false
+	}
+	for k, v := range required {
+		current, ok := template.Annotations[k]
+		if !ok {
+			return false
+		}
+		if contains, err := containsEntries(current, v); err != nil || !contains {
+			return false
+		}
+	}
+	return true
+}
+
+// records the filter as applied to the workload.
+// an unreadable annotation is replaced, as it only records state
+func (p *Provider) setAppliedFilter(workloadName string, template *corev1.PodTemplateSpec, filterId string, state AppliedFilter) error {
+	applied, err := GetAppliedFilters(template)
+	if err != nil {
+		p.logger().WithFields(Fields{
+			"workload": workloadName,
+		}).WithError(err).Warnf("replacing unreadable applied filters annotation")
+		applied = map[string]AppliedFilter{}
+	}
+	applied[filterId] = state
+	return writeAppliedFilters(template, applied)
+}
+
+// removes the filters matched by the predicate from the filters recorded as applied to the workload.
+// returns true if any filter was removed
+func removeAppliedFilters(template *corev1.PodTemplateSpec, remove func(filterId string, state AppliedFilter) bool) (bool, error) {
+	applied, err := GetAppliedFilters(template)
+	if err != nil {
+		// the annotation cannot be trusted, so drop it entirely
+		delete(template.Annotations, AppliedFiltersAnnotation)
+		return true, nil
+	}
+	var removed bool
+	for filterId, state := range applied {
+		if remove(filterId, state) {
+			delete(applied, filterId)
+			removed = true
+		}
+	}
+	if !removed {
+		return false, nil
+	}
+	return true, writeAppliedFilters(template, applied)
+}
+
+func writeAppliedFilters(template *corev1.PodTemplateSpec, applied map[string]AppliedFilter) error {
+	if len(applied) == 0 {
+		delete(template.Annotations, AppliedFiltersAnnotation)
+		return nil
+	}
+	value, err := json.Marshal(applied)
+	if err != nil {
+		return err
+	}
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+	template.Annotations[AppliedFiltersAnnotation] = string(value)
+	return nil
+}
@@ -0,0 +1,176 @@
+package istio_test
+
+import (
+	"strings"
+
+	"github.com/gogo/protobuf/types"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/skv2/pkg/ezkube"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	istiov1alpha3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Applied filters annotation", func() {
+	var (
+		kube         *fake.Clientset
+		provider     *testProvider
+		envoyFilters map[string]*istiov1alpha3.EnvoyFilter
+		// the number of times the workload was updated
+		workloadUpdates int
+	)
+
+	makeFilter := func(filterId, config string) *wasmev1.FilterSpec {
+		cfg, err := types.MarshalAny(&types.StringValue{Value: config})
+		Expect(err).NotTo(HaveOccurred())
+		return &wasmev1.FilterSpec{
+			Id:     filterId,
+			Image:  "filter/image:v1",
+			RootID: "root_id",
+			Config: cfg,
+		}
+	}
+
+	getAppliedFilters := func() map[string]istio.AppliedFilter {
+		workload, err := kube.AppsV1().Deployments("default").Get("work", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		applied, err := istio.GetAppliedFilters(&workload.Spec.Template)
+		Expect(err).NotTo(HaveOccurred())
+		return applied
+	}
+
+	BeforeEach(func() {
+		workloadUpdates = 0
+
+		provider = newTestProvider(makeDeployment("work", "default", nil))
+		kube = provider.kube
+		envoyFilters = provider.envoyFilters
+		provider.onEnsure = func(obj ezkube.Object) error {
+			if _, ok := obj.(*appsv1.Deployment); ok {
+				workloadUpdates++
+			}
+			return nil
+		}
+	})
+
+	It("records the image, digest and config of the applied filters", func() {
+		err := provider.ApplyFilter(makeFilter("filter-a", `{"greeting":"hello"}`))
+		Expect(err).NotTo(HaveOccurred())
+		err = provider.ApplyFilter(makeFilter("filter-b", `{"greeting":"hello"}`))
+		Expect(err).NotTo(HaveOccurred())
+
+		applied := getAppliedFilters()
+		Expect(applied).To(HaveLen(2))
+		Expect(applied["filter-a"].Image).To(Equal("filter/image:v1"))
+		Expect(applied["filter-a"].Digest).To(Equal(testImageDigest))
+		Expect(applied["filter-a"].ConfigHash).To(HavePrefix("sha256:"))
+	})
+
+	It("records the ref of the image pinned to its digest", func() {
+		const manifestDigest = "sha256:4c0a1c93e9b3d1ea6fa5b3e9a23e0d2b1d42c1b89917a4ffdbc450e3c81f3f5e"
+		provider.PinDigest = true
+		provider.Puller = &mockPuller{
+			image: mockImage{ref: "filter/image:v1", digest: testImageDigest, manifestDigest: manifestDigest},
+		}
+		err := provider.ApplyFilter(makeFilter("filter-a", `{"greeting":"hello"}`))
+		Expect(err).NotTo(HaveOccurred())
+
+		applied := getAppliedFilters()["filter-a"]
+		Expect(applied.Image).To(Equal("filter/image:v1"))
+		Expect(applied.PinnedImage).To(Equal("docker.io/filter/image@" + manifestDigest))
+		Expect(envoyFilters[istio.EnvoyFilterName("work", "filter-a")].Annotations).To(HaveKeyWithValue(istio.ImageLabel, "filter/image:v1"))
+	})
+
+	It("does not update the workload if the filter is already applied and unchanged", func() {
+		err := provider.ApplyFilter(makeFilter("filter-a", `{"greeting":"hello"}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(workloadUpdates).To(Equal(1))
+		before := getAppliedFilters()["filter-a"]
+
+		// the EnvoyFilter is still ensured
+		delete(envoyFilters, istio.EnvoyFilterName("work", "filter-a"))
+		err = provider.ApplyFilter(makeFilter("filter-a", `{"greeting":"hello"}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(workloadUpdates).To(Equal(1))
+		Expect(envoyFilters).To(HaveKey(istio.EnvoyFilterName("work", "filter-a")))
+
+		// the image is recorded on the workload, so a new image updates it
+		retagged := makeFilter("filter-a", `{"greeting":"hello"}`)
+		retagged.Image = "filter/image:v2"
+		err = provider.ApplyFilter(retagged)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(workloadUpdates).To(Equal(2))
+		after := getAppliedFilters()["filter-a"]
+		Expect(after.Image).To(Equal("filter/image:v2"))
+		Expect(after.ConfigHash).NotTo(Equal(before.ConfigHash))
+	})
+
+	It("updates the config of the filter without updating the workload", func() {
+		var updated []string
+		provider.OnConfigUpdated = func(workloadMeta metav1.ObjectMeta, configHash string) {
+			updated = append(updated, workloadMeta.Name+"="+configHash)
+		}
+		drifts := 0
+		provider.OnDrift = func(string) { drifts++ }
+
+		err := provider.ApplyFilter(makeFilter("filter-a", `{"greeting":"hello"}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(workloadUpdates).To(Equal(1))
+		before := getAppliedFilters()["filter-a"]
+		Expect(updated).To(BeEmpty())
+
+		// a new config, and a new digest pushed to the same tag
+		const newDigest = "sha256:0f5d5b6f8e1c1a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f708192a3"
+		provider.Puller = &mockPuller{
+			image: mockImage{ref: "filter/image:v1", digest: newDigest},
+		}
+		err = provider.ApplyFilter(makeFilter("filter-a", `{"greeting":"bonjour"}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(workloadUpdates).To(Equal(1))
+		Expect(drifts).To(BeZero())
+
+		// the EnvoyFilter reads the new config from the new digest
+		envoyFilter := envoyFilters[istio.EnvoyFilterName("work", "filter-a")]
+		Expect(envoyFilter).NotTo(BeNil())
+		Expect(envoyFilter.Spec.String()).To(ContainSubstring("bonjour"))
+		Expect(envoyFilter.Spec.String()).To(ContainSubstring(strings.TrimPrefix(newDigest, "sha256:")))
+
+		// the workload keeps the state the filter was first applied with
+		Expect(getAppliedFilters()["filter-a"]).To(Equal(before))
+		Expect(updated).To(HaveLen(1))
+		Expect(updated[0]).To(HavePrefix("work=sha256:"))
+		Expect(updated[0]).NotTo(Equal("work=" + before.ConfigHash))
+	})
+
+	It("removes the entry of the removed filter", func() {
+		err := provider.ApplyFilter(makeFilter("filter-a", `{"greeting":"hello"}`))
+		Expect(err).NotTo(HaveOccurred())
+		err = provider.ApplyFilter(makeFilter("filter-b", `{"greeting":"hello"}`))
+		Expect(err).NotTo(HaveOccurred())
+
+		err = provider.RemoveFilter(makeFilter("filter-a", `{"greeting":"hello"}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getAppliedFilters()).To(HaveKey("filter-b"))
+		Expect(getAppliedFilters()).NotTo(HaveKey("filter-a"))
+
+		err = provider.RemoveFilter(makeFilter("filter-b", `{"greeting":"hello"}`))
+		Expect(err).NotTo(HaveOccurred())
+		workload, err := kube.AppsV1().Deployments("default").Get("work", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(workload.Spec.Template.Annotations).NotTo(HaveKey(istio.AppliedFiltersAnnotation))
+	})
+
+	It("removes the entries of the filters removed by image", func() {
+		err := provider.ApplyFilter(makeFilter("filter-a", `{"greeting":"hello"}`))
+		Expect(err).NotTo(HaveOccurred())
+
+		removed, err := provider.RemoveFilterByImage("filter/image:v1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removed).To(ConsistOf("filter-a"))
+		Expect(getAppliedFilters()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,159 @@
+package istio
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// a problem with the wasme annotations found on a workload
+type BackupProblem struct {
+	Workload   string
+	Annotation string
+	Problem    string
+}
+
+const (
+	problemStaleBackup     = "stale backup: the sidecar annotations written by wasme are not applied"
+	problemSelfReferential = "self-referential backup: the backup contains the sidecar annotations written by wasme"
+	problemMissingMarker   = "missing " + appliedAnnotation + " marker: wasme may back up its own annotations when the filter is reapplied"
+)
+
+// CheckBackups scans the selected workloads for backup annotations which would be
+// restored incorrectly when the filter is removed:
+// backups left behind while wasme's annotations are no longer applied,
+// and backups containing the values written by wasme, e.g. after the filter was applied twice.
+// if repair is true, the problems are fixed on the workloads.
+func (p *Provider) CheckBackups(repair bool) ([]BackupProblem, error) {
+	var problems []BackupProblem
+	err := p.updateEachWorkload(nil, false, func(meta metav1.ObjectMeta, template *corev1.PodTemplateSpec) (bool, error) {
+		found, err := checkBackups(meta.Name, template, p.sidecarAnnotations(), repair)
+		if err != nil {
+			return false, errors.Wrapf(err, "checking annotations of workload %v", meta.Name)
+		}
+		problems = append(problems, found...)
+
+		if repair && len(found) > 0 {
+			p.logger().WithFields(Fields{
+				"workload": meta.Name,
+			}).Infof("repaired backup annotations")
+			return true, nil
+		}
+		return false, nil
+	}, nil, nil)
+	return problems, err
+}
+
+func checkBackups(workloadName string, template *corev1.PodTemplateSpec, required map[string]string, repair bool) ([]BackupProblem, error) {
+	annotations := template.Annotations
+	var problems []BackupProblem
+
+	var applied bool
+	for k, v := range required {
+		current, hasCurrent := annotations[k]
+		currentApplied := false
+		if hasCurrent {
+			var err error
+			currentApplied, err = containsEntries(current, v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "parsing annotation %v", k)
+			}
+		}
+		applied = applied || currentApplied
+
+		backupKey := backupAnnotationPrefix + k
+		backup, hasBackup := annotations[backupKey]
+		if !hasBackup {
+			continue
+		}
+
+		if !currentApplied {
+			problems = append(problems, BackupProblem{Workload: workloadName, Annotation: backupKey, Problem: problemStaleBackup})
+			if repair {
+				delete(annotations, backupKey)
+			}
+			continue
+		}
+
+		original, selfReferential, err := removeEntries(backup, v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing annotation %v", backupKey)
+		}
+		if !selfReferential {
+			continue
+		}
+		problems = append(problems, BackupProblem{Workload: workloadName, Annotation: backupKey, Problem: problemSelfReferential})
+		if repair {
+			if original == "" {
+				// nothing was backed up before wasme wrote the annotation
+				delete(annotations, backupKey)
+			} else {
+				annotations[backupKey] = original
+			}
+		}
+	}
+
+	if _, marked := annotations[appliedAnnotation]; applied && !marked {
+		problems = append(problems, BackupProblem{Workload: workloadName, Annotation: appliedAnnotation, Problem: problemMissingMarker})
+		if repair {
+			annotations[appliedAnnotation] = "true"
+		}
+	}
+
+	return problems, nil
+}
+
+// returns true if the annotation value contains every entry of the required value, matched by name
+func containsEntries(value, required string) (bool, error) {
+	entries, requiredEntries, err := parseEntries(value, required)
+	if err != nil {
+		return false, err
+	}
+	for _, requiredEntry := range requiredEntries {
+		if !containsEntry(entries, requiredEntry) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// removes the entries of the required value from the annotation value.
+// returns the remaining value, empty if no entries remain,
+// and true if any entries were removed
+func removeEntries(value, required string) (string, bool, error) {
+	entries, requiredEntries, err := parseEntries(value, required)
+	if err != nil {
+		return "", false, err
+	}
+	var remaining []json.RawMessage
+	for _, entry := range entries {
+		if !containsEntry(requiredEntries, entry) {
+			remaining = append(remaining, entry)
+		}
+	}
+	if len(remaining) == len(entries) {
+		return value, false, nil
+	}
+	if len(remaining) == 0 {
+		return "", true, nil
+	}
+	raw, err := json.Marshal(remaining)
+	if err != nil {
+		return "", false, err
+	}
+	return string(raw), true, nil
+}
+
+func parseEntries(value, required string) ([]json.RawMessage, []json.RawMessage, error) {
+	entries, err := parseAnnotationEntries(value)
+	if err != nil {
+		return nil, nil, err
+	}
+	requiredEntries, err := parseAnnotationEntries(required)
+	if err != nil {
+		return nil, nil, err
+	}
+	return entries, requiredEntries, nil
+}
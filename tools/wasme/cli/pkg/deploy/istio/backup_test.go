@@ -0,0 +1,180 @@
+package istio_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Backup annotations", func() {
+	var (
+		kube     *fake.Clientset
+		provider *testProvider
+		filter   = &wasmev1.FilterSpec{
+			Id:     "filter-id",
+			Image:  "filter/image:v1",
+			RootID: "root_id",
+		}
+	)
+
+	createWorkload := func(annotations map[string]string) {
+		_, err := kube.AppsV1().Deployments("default").Create(makeDeployment("work", "default", annotations))
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	getAnnotations := func() map[string]string {
+		workload, err := kube.AppsV1().Deployments("default").Get("work", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		return workload.Spec.Template.Annotations
+	}
+
+	BeforeEach(func() {
+		provider = newTestProvider()
+		kube = provider.kube
+	})
+
+	It("does not restore wasme's annotations after the filter is applied twice", func() {
+		createWorkload(nil)
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		err = provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		err = provider.RemoveFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(getAnnotations()).To(BeEmpty())
+	})
+
+	It("restores the custom annotations after the filter is applied twice", func() {
+		createWorkload(customSidecarAnnotations())
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		err = provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getAnnotations()).To(MatchAllKeys(mergedSidecarAnnotations()))
+
+		err = provider.RemoveFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getAnnotations()).To(Equal(customSidecarAnnotations()))
+	})
+
+	It("reports and repairs self-referential backups", func() {
+		// the state left by applying the filter twice with an older version of wasme
+		annotations := map[string]string{}
+		for k, v := range mergedAnnotationValues() {
+			annotations[k] = v
+			annotations["wasme-backup."+k] = v
+		}
+		createWorkload(annotations)
+
+		problems, err := provider.CheckBackups(false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(problems).To(ConsistOf(
+			MatchFields(IgnoreExtras, Fields{"Annotation": Equal("wasme-backup.sidecar.istio.io/userVolume")}),
+			MatchFields(IgnoreExtras, Fields{"Annotation": Equal("wasme-backup.sidecar.istio.io/userVolumeMount")}),
+			MatchFields(IgnoreExtras, Fields{"Annotation": Equal("wasme-applied")}),
+		))
+		Expect(getAnnotations()).To(Equal(annotations))
+
+		_, err = provider.CheckBackups(true)
+		Expect(err).NotTo(HaveOccurred())
+		repaired := mergedSidecarAnnotations()
+		// older versions of wasme did not record the applied filters
+		delete(repaired, istio.AppliedFiltersAnnotation)
+		Expect(getAnnotations()).To(MatchAllKeys(repaired))
+
+		problems, err = provider.CheckBackups(false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(problems).To(BeEmpty())
+
+		err = provider.RemoveFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		// the repaired backups are re-encoded
+		Expect(getAnnotations()).To(MatchAllKeys(Keys{
+			"sidecar.istio.io/userVolume":      MatchJSON(customSidecarAnnotations()["sidecar.istio.io/userVolume"]),
+			"sidecar.istio.io/userVolumeMount": MatchJSON(customSidecarAnnotations()["sidecar.istio.io/userVolumeMount"]),
+		}))
+	})
+
+	It("reports and repairs stale backups", func() {
+		annotations := customSidecarAnnotations()
+		annotations["wasme-backup.sidecar.istio.io/userVolume"] = `[{"name":"old-dir","emptyDir":{}}]`
+		createWorkload(annotations)
+
+		problems, err := provider.CheckBackups(true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(problems).To(ConsistOf(
+			MatchFields(IgnoreExtras, Fields{"Annotation": Equal("wasme-backup.sidecar.istio.io/userVolume")}),
+		))
+		Expect(getAnnotations()).To(Equal(customSidecarAnnotations()))
+	})
+
+	It("merges and restores custom annotations in object form", func() {
+		annotations := map[string]string{
+			"sidecar.istio.io/userVolume":      `{"name":"tmp-dir","emptyDir":{}}`,
+			"sidecar.istio.io/userVolumeMount": `{"mountPath":"/tmp","name":"tmp-dir"}`,
+		}
+		createWorkload(annotations)
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getAnnotations()).To(MatchKeys(IgnoreExtras, Keys{
+			"sidecar.istio.io/userVolume":      MatchJSON(mergedAnnotationValues()["sidecar.istio.io/userVolume"]),
+			"sidecar.istio.io/userVolumeMount": MatchJSON(mergedAnnotationValues()["sidecar.istio.io/userVolumeMount"]),
+		}))
+
+		err = provider.RemoveFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getAnnotations()).To(Equal(annotations))
+	})
+
+	It("preserves unknown fields and entries which are not objects", func() {
+		annotations := customSidecarAnnotations()
+		annotations["sidecar.istio.io/userVolume"] = `[{"name":"tmp-dir","emptyDir":{"medium":"Memory"},"x-custom":{"size":12345678901234567890}},"not-an-object",null]`
+		createWorkload(annotations)
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getAnnotations()["sidecar.istio.io/userVolume"]).To(Equal(`[{"name":"tmp-dir","emptyDir":{"medium":"Memory"},"x-custom":{"size":12345678901234567890}},"not-an-object",null,{"name":"cache-dir","hostPath":{"path":"/var/local/lib/wasme-cache"}}]`))
+
+		err = provider.RemoveFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getAnnotations()).To(Equal(annotations))
+	})
+
+	It("returns an error naming the annotation and workload for malformed annotations", func() {
+		annotations := customSidecarAnnotations()
+		annotations["sidecar.istio.io/userVolume"] = `[{"name":"tmp-dir",`
+		createWorkload(annotations)
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("sidecar.istio.io/userVolume"))
+		Expect(err.Error()).To(ContainSubstring("work"))
+		Expect(getAnnotations()).To(Equal(annotations))
+	})
+
+	It("returns an error for annotations which are neither an object nor an array", func() {
+		annotations := customSidecarAnnotations()
+		annotations["sidecar.istio.io/userVolumeMount"] = `"/tmp"`
+		createWorkload(annotations)
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("parsing annotation sidecar.istio.io/userVolumeMount of workload work"))
+	})
+})
+
+// the values of the custom sidecar annotations merged with the annotations required by wasme
+func mergedAnnotationValues() map[string]string {
+	return map[string]string{
+		"sidecar.istio.io/userVolume":      `[{"name":"tmp-dir","emptyDir":{}},{"name":"cache-dir","hostPath":{"path":"/var/local/lib/wasme-cache"}}]`,
+		"sidecar.istio.io/userVolumeMount": `[{"mountPath":"/tmp","name":"tmp-dir"},{"mountPath":"/var/local/lib/wasme-cache","name":"cache-dir"}]`,
+	}
+}
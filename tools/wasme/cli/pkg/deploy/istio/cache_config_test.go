@@ -0,0 +1,155 @@
+package istio_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/abi"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cache"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	pkgcache "github.com/solo-io/wasm/tools/wasme/pkg/cache"
+	kubev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Cache config", func() {
+	var (
+		kube     *fake.Clientset
+		provider *testProvider
+	)
+
+	BeforeEach(func() {
+		provider = newTestProvider(
+			&kubev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "wasme-cache",
+					Namespace: "wasme",
+				},
+				// written by an earlier version of wasme
+				Data: map[string]string{cache.ImagesKey: "\ndocker.io/other/image:v1\n\n"},
+			},
+			makeDeployment("work", "default", nil),
+		)
+		kube = provider.kube
+	})
+
+	getCachedImages := func() pkgcache.ImageList {
+		cm, err := kube.CoreV1().ConfigMaps("wasme").Get("wasme-cache", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		images, err := pkgcache.ParseImageList(cm.Data[cache.ImagesKey])
+		Expect(err).NotTo(HaveOccurred())
+		return images
+	}
+
+	It("migrates the legacy image list, recording the added image", func() {
+		err := provider.ApplyFilter(&wasmev1.FilterSpec{Id: "filter-a", Image: "filter/image:v1", RootID: "root_id"})
+		Expect(err).NotTo(HaveOccurred())
+
+		images := getCachedImages()
+		Expect(images.Refs()).To(Equal([]string{"docker.io/other/image:v1", "filter/image:v1"}))
+		Expect(images["docker.io/other/image:v1"]).To(Equal(pkgcache.ListedImage{}))
+		added := images["filter/image:v1"]
+		Expect(added.Digest).To(Equal(testImageDigest))
+		Expect(added.AddedBy).To(Equal("default/filter-a"))
+		Expect(added.AddedAt).NotTo(BeNil())
+	})
+
+	It("does not add another ref of a cached image", func() {
+		err := provider.ApplyFilter(&wasmev1.FilterSpec{Id: "filter-a", Image: "filter/image:v1", RootID: "root_id"})
+		Expect(err).NotTo(HaveOccurred())
+		err = provider.ApplyFilter(&wasmev1.FilterSpec{Id: "filter-b", Image: "filter/image@" + testImageDigest, RootID: "root_id"})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(getCachedImages().Refs()).To(Equal([]string{"docker.io/other/image:v1", "filter/image:v1"}))
+	})
+
+	Context("pinning images to their digest", func() {
+		const manifestDigest = "sha256:4c0a1c93e9b3d1ea6fa5b3e9a23e0d2b1d42c1b89917a4ffdbc450e3c81f3f5e"
+
+		BeforeEach(func() {
+			provider.PinDigest = true
+			provider.Puller = &mockPuller{
+				image: mockImage{ref: "filter/image:v1", digest: testImageDigest, manifestDigest: manifestDigest},
+			}
+		})
+
+		It("lists the image by the digest of its manifest", func() {
+			err := provider.ApplyFilter(&wasmev1.FilterSpec{Id: "filter-a", Image: "filter/image:v1", RootID: "root_id"})
+			Expect(err).NotTo(HaveOccurred())
+
+			pinned := "docker.io/filter/image@" + manifestDigest
+			images := getCachedImages()
+			Expect(images.Refs()).To(Equal([]string{pinned, "docker.io/other/image:v1"}))
+			Expect(images[pinned].Digest).To(Equal(testImageDigest))
+			Expect(images[pinned].PinnedFrom).To(Equal("filter/image:v1"))
+		})
+
+		It("lists the pinned ref even if the tag is cached", func() {
+			provider.PinDigest = false
+			err := provider.ApplyFilter(&wasmev1.FilterSpec{Id: "filter-a", Image: "filter/image:v1", RootID: "root_id"})
+			Expect(err).NotTo(HaveOccurred())
+			provider.PinDigest = true
+			err = provider.ApplyFilter(&wasmev1.FilterSpec{Id: "filter-b", Image: "filter/image:v1", RootID: "root_id"})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(getCachedImages().Refs()).To(ContainElement("docker.io/filter/image@" + manifestDigest))
+		})
+
+		It("does not pin images referenced by digest", func() {
+			err := provider.ApplyFilter(&wasmev1.FilterSpec{Id: "filter-a", Image: "filter/image@" + manifestDigest, RootID: "root_id"})
+			Expect(err).NotTo(HaveOccurred())
+
+			images := getCachedImages()
+			Expect(images.Refs()).To(Equal([]string{"docker.io/other/image:v1", "filter/image@" + manifestDigest}))
+			Expect(images["filter/image@"+manifestDigest].PinnedFrom).To(BeEmpty())
+		})
+	})
+
+	Context("selecting the variant of multi-variant images", func() {
+		const (
+			indexDigest      = "sha256:1f7d3e0c5b7a64d0c4a3a8b2b1f5e7d9c0a2b4c6d8e0f1a3b5c7d9e1f3a5b7c9"
+			istio15Manifest  = "sha256:2a4c6e8f0b1d3f5a7c9e1b3d5f7a9c1e3b5d7f9a1c3e5b7d9f1a3c5e7b9d1f3a"
+			istio17Manifest  = "sha256:3b5d7f9a1c3e5b7d9f1a3c5e7b9d1f3a5c7e9b1d3f5a7c9e1b3d5f7a9c1e3b5d"
+			istio17ModuleSha = "sha256:4c6e8a0b2d4f6a8c0e2b4d6f8a0c2e4b6d8f0a2c4e6b8d0f2a4c6e8b0d2f4a6c"
+		)
+		var image *mockVariantImage
+
+		BeforeEach(func() {
+			istio15 := mockImage{ref: "filter/image:v1", digest: testImageDigest, manifestDigest: istio15Manifest,
+				abiVersions: []string{abi.Version_097b7f2e4cc1fb490cc1943d0d633655ac3c522f.Name}}
+			istio17 := mockImage{ref: "filter/image:v1", digest: istio17ModuleSha, manifestDigest: istio17Manifest,
+				abiVersions: []string{abi.Version_4689a30309abf31aee9ae36e73d34b1bb182685f.Name}}
+			image = &mockVariantImage{
+				mockImage: mockImage{ref: "filter/image:v1", digest: testImageDigest, manifestDigest: indexDigest, abiVersions: istio15.abiVersions},
+				variants:  []mockImage{istio15, istio17},
+			}
+			provider.Puller = &mockVariantPuller{image: image}
+		})
+
+		It("lists the variant supported by the istio version by the digest of its manifest", func() {
+			err := provider.ApplyFilter(&wasmev1.FilterSpec{Id: "filter-a", Image: "filter/image:v1", RootID: "root_id"})
+			Expect(err).NotTo(HaveOccurred())
+
+			pinned := "docker.io/filter/image@" + istio17Manifest
+			images := getCachedImages()
+			Expect(images.Refs()).To(Equal([]string{pinned, "docker.io/other/image:v1"}))
+			Expect(images[pinned].Digest).To(Equal(istio17ModuleSha))
+			Expect(images[pinned].PinnedFrom).To(Equal("filter/image:v1"))
+		})
+
+		It("lists the default variant if the ABI version check is skipped", func() {
+			err := provider.ApplyFilter(&wasmev1.FilterSpec{Id: "filter-a", Image: "filter/image:v1", RootID: "root_id", IgnoreAbiCheck: true})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(getCachedImages().Refs()).To(ContainElement("docker.io/filter/image@" + istio15Manifest))
+		})
+
+		It("fails if no variant is supported by the istio version", func() {
+			image.variants = image.variants[:1]
+			err := provider.ApplyFilter(&wasmev1.FilterSpec{Id: "filter-a", Image: "filter/image:v1", RootID: "root_id"})
+			Expect(err).To(MatchError(ContainSubstring("no variant of image")))
+			Expect(istio.IsAbiIncompatible(err)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,70 @@
+package istio_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Cache storage", func() {
+	var (
+		kube     *fake.Clientset
+		provider *testProvider
+	)
+
+	filter := &wasmev1.FilterSpec{
+		Id:     "filter-a",
+		Image:  "filter/image:v1",
+		RootID: "root_id",
+	}
+
+	getAnnotations := func() map[string]string {
+		workload, err := kube.AppsV1().Deployments("default").Get("work", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		return workload.Spec.Template.Annotations
+	}
+
+	BeforeEach(func() {
+		provider = newTestProvider(makeDeployment("work", "default", map[string]string{
+			"sidecar.istio.io/userVolume": `[{"name":"certs","secret":{"secretName":"certs"}}]`,
+		}))
+		kube = provider.kube
+		provider.Cache.PersistentVolumeClaim = "wasme-cache"
+	})
+
+	It("mounts the cache directory from the PersistentVolumeClaim", func() {
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		annotations := getAnnotations()
+		Expect(annotations["sidecar.istio.io/userVolume"]).To(MatchJSON(`[
+			{"name":"certs","secret":{"secretName":"certs"}},
+			{"name":"cache-pvc","persistentVolumeClaim":{"claimName":"wasme-cache","readOnly":true}}
+		]`))
+		Expect(annotations["sidecar.istio.io/userVolumeMount"]).To(MatchJSON(`[{"mountPath":"/var/local/lib/wasme-cache","name":"cache-pvc","readOnly":true}]`))
+
+		err = provider.RemoveFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getAnnotations()["sidecar.istio.io/userVolume"]).To(Equal(`[{"name":"certs","secret":{"secretName":"certs"}}]`))
+	})
+
+	It("replaces the volume of the host path when the storage changes", func() {
+		provider.Cache.PersistentVolumeClaim = ""
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getAnnotations()["sidecar.istio.io/userVolume"]).To(ContainSubstring("hostPath"))
+
+		// the filter is unchanged, but the workload must be updated to mount the claim
+		provider.Cache.PersistentVolumeClaim = "wasme-cache"
+		err = provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		annotations := getAnnotations()
+		Expect(annotations["sidecar.istio.io/userVolume"]).To(MatchJSON(`[
+			{"name":"certs","secret":{"secretName":"certs"}},
+			{"name":"cache-pvc","persistentVolumeClaim":{"claimName":"wasme-cache","readOnly":true}}
+		]`))
+		Expect(annotations["sidecar.istio.io/userVolumeMount"]).To(MatchJSON(`[{"mountPath":"/var/local/lib/wasme-cache","name":"cache-pvc","readOnly":true}]`))
+	})
+})
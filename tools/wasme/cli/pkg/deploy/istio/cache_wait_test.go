@@ -0,0 +1,256 @@
+package istio_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cache"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	kubev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// a fake clock which reports the duration of each wait
+type waitRecordingClock struct {
+	*clock.FakeClock
+	waits chan time.Duration
+}
+
+func (c *waitRecordingClock) After(d time.Duration) <-chan time.Time {
+	ch := c.FakeClock.After(d)
+	c.waits <- d
+	return ch
+}
+
+var _ = Describe("Cache wait", func() {
+	const image = "filter/image:v1"
+	var (
+		kube     *fake.Clientset
+		provider *testProvider
+	)
+
+	BeforeEach(func() {
+		provider = newTestProvider(
+			// the cache pods cannot start, e.g. because their image cannot be pulled
+			&appsv1.DaemonSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "wasme-cache",
+					Namespace: "wasme",
+				},
+				Status: appsv1.DaemonSetStatus{DesiredNumberScheduled: 2, NumberReady: 0},
+			},
+			&kubev1.Event{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "ready",
+					Namespace: "wasme",
+					Labels:    cache.EventLabels(image),
+				},
+				Reason:        cache.Reason_ImageAdded,
+				Source:        kubev1.EventSource{Host: "node-a"},
+				LastTimestamp: metav1.Now(),
+			},
+			makeDeployment("work", "default", nil),
+		)
+		kube = provider.kube
+		provider.Cache.Kind = istio.WorkloadTypeDaemonSet
+		provider.WaitForCacheTimeout = 1500 * time.Millisecond
+	})
+
+	filter := &wasmev1.FilterSpec{
+		Id:     "filter-id",
+		Image:  image,
+		RootID: "root_id",
+	}
+
+	It("fails if no cache instance is ready", func() {
+		err := provider.ApplyFilter(filter)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("the cache wasme-cache.wasme has no ready pods"))
+		Expect(istio.IsCacheError(err)).To(BeTrue())
+
+		workload, err := kube.AppsV1().Deployments("default").Get("work", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(workload.Spec.Template.Annotations).To(BeEmpty())
+	})
+
+	It("waits for a cache instance to become ready", func() {
+		go func() {
+			defer GinkgoRecover()
+			time.Sleep(500 * time.Millisecond)
+			cacheDaemonSet, err := kube.AppsV1().DaemonSets("wasme").Get("wasme-cache", metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			cacheDaemonSet.Status.NumberReady = 1
+			_, err = kube.AppsV1().DaemonSets("wasme").UpdateStatus(cacheDaemonSet)
+			Expect(err).NotTo(HaveOccurred())
+		}()
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("backs off while the cache is not ready", func() {
+		fakeClock := &waitRecordingClock{FakeClock: clock.NewFakeClock(time.Now()), waits: make(chan time.Duration)}
+		provider.Clock = fakeClock
+		provider.WaitForCacheTimeout = time.Minute
+
+		result := make(chan error, 1)
+		go func() {
+			result <- provider.ApplyFilter(filter)
+		}()
+
+		// the timeout is waited for first
+		Expect(<-fakeClock.waits).To(Equal(time.Minute))
+
+		var polls []time.Duration
+		for len(polls) < 6 {
+			wait := <-fakeClock.waits
+			polls = append(polls, wait)
+			if len(polls) == 6 {
+				// the next check finds the ready cache instance
+				cacheDaemonSet, err := kube.AppsV1().DaemonSets("wasme").Get("wasme-cache", metav1.GetOptions{})
+				Expect(err).NotTo(HaveOccurred())
+				cacheDaemonSet.Status.NumberReady = 1
+				_, err = kube.AppsV1().DaemonSets("wasme").UpdateStatus(cacheDaemonSet)
+				Expect(err).NotTo(HaveOccurred())
+			}
+			fakeClock.Step(wait)
+		}
+		Eventually(result).Should(Receive(BeNil()))
+
+		// the intervals double up to the maximum, with up to 20% jitter
+		for i, base := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+			Expect(polls[i]).To(BeNumerically(">=", base), "poll %v", i)
+			Expect(polls[i]).To(BeNumerically("<=", base+base/5), "poll %v", i)
+		}
+	})
+
+	Context("when cache instances fail to pull the image", func() {
+		BeforeEach(func() {
+			for _, node := range []string{"node-b", "node-c"} {
+				_, err := kube.CoreV1().Events("wasme").Create(&kubev1.Event{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "failed-" + node,
+						Namespace: "wasme",
+						Labels:    cache.EventLabels(image),
+					},
+					Reason:        cache.Reason_ImageError,
+					Message:       "401 Unauthorized",
+					Source:        kubev1.EventSource{Host: node},
+					LastTimestamp: metav1.Now(),
+				})
+				Expect(err).NotTo(HaveOccurred())
+			}
+		})
+
+		setReady := func(ready int32) {
+			cacheDaemonSet, err := kube.AppsV1().DaemonSets("wasme").Get("wasme-cache", metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			cacheDaemonSet.Status.NumberReady = ready
+			_, err = kube.AppsV1().DaemonSets("wasme").UpdateStatus(cacheDaemonSet)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		It("fails before the timeout once every remaining instance failed", func() {
+			setReady(3)
+			provider.WaitForCacheTimeout = time.Minute
+
+			err := provider.ApplyFilter(filter)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).NotTo(ContainSubstring("timed out"))
+			Expect(istio.IsCacheTimeout(err)).To(BeFalse())
+			Expect(err.Error()).To(ContainSubstring("cache failed to pull image filter/image:v1 on 2 of 3 nodes: 401 Unauthorized (node-b, node-c)"))
+		})
+
+		It("waits for the instances which retry pulling the image", func() {
+			setReady(3)
+			provider.WaitForCacheTimeout = 5 * time.Second
+			for _, node := range []string{"node-b", "node-c"} {
+				evt, err := kube.CoreV1().Events("wasme").Get("failed-"+node, metav1.GetOptions{})
+				Expect(err).NotTo(HaveOccurred())
+				evt.Annotations = map[string]string{cache.CacheRetryingAnnotation: "true"}
+				_, err = kube.CoreV1().Events("wasme").Update(evt)
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			go func() {
+				defer GinkgoRecover()
+				time.Sleep(500 * time.Millisecond)
+				// the retries succeed
+				for _, node := range []string{"node-b", "node-c"} {
+					_, err := kube.CoreV1().Events("wasme").Create(&kubev1.Event{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "ready-" + node,
+							Namespace: "wasme",
+							Labels:    cache.EventLabels(image),
+						},
+						Reason:        cache.Reason_ImageAdded,
+						Source:        kubev1.EventSource{Host: node},
+						LastTimestamp: metav1.Now(),
+					})
+					Expect(err).NotTo(HaveOccurred())
+				}
+			}()
+
+			err := provider.ApplyFilter(filter)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("includes the image errors in the timeout error", func() {
+			// an instance has yet to report
+			setReady(4)
+
+			err := provider.ApplyFilter(filter)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("timed out"))
+			Expect(istio.IsCacheTimeout(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("failed to pull image on the other nodes: 401 Unauthorized (node-b, node-c)"))
+		})
+	})
+
+	Context("when the cache instances are ready", func() {
+		BeforeEach(func() {
+			cacheDaemonSet, err := kube.AppsV1().DaemonSets("wasme").Get("wasme-cache", metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			cacheDaemonSet.Status.NumberReady = 1
+			_, err = kube.AppsV1().DaemonSets("wasme").UpdateStatus(cacheDaemonSet)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		getEvents := func() []kubev1.Event {
+			events, err := cache.GetImageEvents(kube, "wasme", image)
+			Expect(err).NotTo(HaveOccurred())
+			return events
+		}
+
+		It("deletes the cache events once the image is pulled", func() {
+			err := provider.ApplyFilter(filter)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getEvents()).To(BeEmpty())
+		})
+
+		It("keeps the cache events if KeepCacheEvents is set", func() {
+			provider.KeepCacheEvents = true
+
+			err := provider.ApplyFilter(filter)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getEvents()).To(HaveLen(1))
+		})
+
+		It("ignores events published before the image was added", func() {
+			stale, err := kube.CoreV1().Events("wasme").Get("ready", metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			stale.LastTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+			_, err = kube.CoreV1().Events("wasme").Update(stale)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = provider.ApplyFilter(filter)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("expected 1 image-ready events for image filter/image:v1, only found map[]"))
+		})
+	})
+})
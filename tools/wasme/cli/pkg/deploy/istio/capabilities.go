@@ -0,0 +1,36 @@
+package istio
+
+import (
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy"
+)
+
+// Capabilities returns the features of the provider. a provider run in dry-run mode only renders the filters,
+// so it cannot list them
+func (p *Provider) Capabilities() deploy.Capabilities {
+	dryRun := p.DryRunOutput != nil
+	return deploy.Capabilities{
+		Provider:      "istio",
+		PatchContexts: SupportedPatchContexts,
+		DryRun:        true,
+		ListFilters:   !dryRun,
+	}
+}
+
+// Verify is not supported: the config of the sidecar proxies is not read back from the pods
+func (p *Provider) Verify(idPrefix string) ([]DeployedFilter, error) {
+	return nil, &deploy.UnsupportedError{Provider: "istio", Feature: "verifying the deployed filters"}
+}
+
+// Capabilities returns the features of the provider, which does not deploy the filters to several clusters in dry-run mode
+func (p *MultiClusterProvider) Capabilities() deploy.Capabilities {
+	return deploy.Capabilities{
+		Provider:      "istio multi-cluster",
+		PatchContexts: SupportedPatchContexts,
+		ListFilters:   true,
+	}
+}
+
+// Verify is not supported, as by the Provider of each cluster
+func (p *MultiClusterProvider) Verify(idPrefix string) ([]DeployedFilter, error) {
+	return nil, &deploy.UnsupportedError{Provider: "istio multi-cluster", Feature: "verifying the deployed filters"}
+}
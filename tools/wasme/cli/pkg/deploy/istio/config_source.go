@@ -0,0 +1,143 @@
+package istio
+
+import (
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
+	"github.com/pkg/errors"
+	envoyfilter "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/filter"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	"github.com/solo-io/wasm/tools/wasme/pkg/config"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// returns the filter with the configuration read from the ConfigMap or Secret referenced by ConfigFrom.
+// the returned filter is a copy if the configuration was read, and must not be logged
+// as the configuration may contain credentials
+func (p *Provider) resolveConfig(filter *v1.FilterSpec) (*v1.FilterSpec, error) {
+	source := filter.GetConfigFrom()
+	if source == nil {
+		return filter, nil
+	}
+	if filter.GetConfig() != nil {
+		return nil, errors.Errorf("filter %v cannot set both config and configFrom", filter.Id)
+	}
+
+	content, err := p.readConfigSource(source)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading config of filter %v", filter.Id)
+	}
+
+	config, err := types.MarshalAny(&types.StringValue{Value: content})
+	if err != nil {
+		return nil, err
+	}
+	resolved := proto.Clone(filter).(*v1.FilterSpec)
+	resolved.Config = config
+
+	// the checksum is computed here rather than by the deployer, as the config is only known now
+	if resolved.ConfigChecksum {
+		if _, err := envoyfilter.InjectConfigChecksum(resolved); err != nil {
+			return nil, err
+		}
+	}
+
+	return resolved, nil
+}
+
+// returns the filter with the default config of the image if the filter sets neither config nor configFrom,
+// injecting the config checksum if enabled.
+// the returned filter is a copy if the default config or the checksum is set
+func applyDefaultConfig(filter *v1.FilterSpec, cfg *config.Runtime) (*v1.FilterSpec, error) {
+	defaultConfig := cfg.GetDefaultConfig()
+	if filter.GetConfig() != nil || filter.GetConfigFrom() != nil || (defaultConfig == nil && !filter.ConfigChecksum) {
+		return filter, nil
+	}
+
+	defaulted := proto.Clone(filter).(*v1.FilterSpec)
+	if defaultConfig != nil {
+		// strings are passed as is, other values as their JSON encoding
+		content := defaultConfig.GetStringValue()
+		if _, isString := defaultConfig.GetKind().(*types.Value_StringValue); !isString {
+			var err error
+			content, err = (&jsonpb.Marshaler{}).MarshalToString(defaultConfig)
+			if err != nil {
+				return nil, errors.Wrapf(err, "encoding the default config of filter %v", filter.Id)
+			}
+		}
+
+		filterConfig, err := types.MarshalAny(&types.StringValue{Value: content})
+		if err != nil {
+			return nil, err
+		}
+		defaulted.Config = filterConfig
+	}
+
+	// the deployer leaves the checksum of filters without a config to the provider
+	if defaulted.ConfigChecksum {
+		if _, err := envoyfilter.InjectConfigChecksum(defaulted); err != nil {
+			return nil, err
+		}
+	}
+
+	return defaulted, nil
+}
+
+// reads the contents of the referenced key
+func (p *Provider) readConfigSource(source *v1.ConfigSource) (string, error) {
+	configMapRef, secretRef := source.GetConfigMapKeyRef(), source.GetSecretKeyRef()
+	switch {
+	case configMapRef != nil && secretRef != nil:
+		return "", errors.Errorf("configFrom must set only one of configMapKeyRef or secretKeyRef")
+	case configMapRef != nil:
+		namespace, err := p.validateKeyReference("configMapKeyRef", configMapRef)
+		if err != nil {
+			return "", err
+		}
+		cm, err := p.KubeClient.CoreV1().ConfigMaps(namespace).Get(configMapRef.Name, metav1.GetOptions{})
+		if err != nil {
+			if kubeerrors.IsNotFound(err) {
+				return "", errors.Errorf("ConfigMap %v.%v not found", configMapRef.Name, namespace)
+			}
+			return "", err
+		}
+		if content, ok := cm.Data[configMapRef.Key]; ok {
+			return content, nil
+		}
+		if content, ok := cm.BinaryData[configMapRef.Key]; ok {
+			return string(content), nil
+		}
+		return "", errors.Errorf("ConfigMap %v.%v has no key %v", configMapRef.Name, namespace, configMapRef.Key)
+	case secretRef != nil:
+		namespace, err := p.validateKeyReference("secretKeyRef", secretRef)
+		if err != nil {
+			return "", err
+		}
+		secret, err := p.KubeClient.CoreV1().Secrets(namespace).Get(secretRef.Name, metav1.GetOptions{})
+		if err != nil {
+			if kubeerrors.IsNotFound(err) {
+				return "", errors.Errorf("Secret %v.%v not found", secretRef.Name, namespace)
+			}
+			return "", err
+		}
+		content, ok := secret.Data[secretRef.Key]
+		if !ok {
+			return "", errors.Errorf("Secret %v.%v has no key %v", secretRef.Name, namespace, secretRef.Key)
+		}
+		return string(content), nil
+	default:
+		return "", errors.Errorf("configFrom must set one of configMapKeyRef or secretKeyRef")
+	}
+}
+
+// returns the namespace of the referenced resource, defaulting to the workload namespace
+func (p *Provider) validateKeyReference(field string, ref *v1.KeyReference) (string, error) {
+	if ref.Name == "" || ref.Key == "" {
+		return "", errors.Errorf("configFrom.%v must set both name and key", field)
+	}
+	if ref.Namespace == "" {
+		return p.Workload.Namespace, nil
+	}
+	return ref.Namespace, nil
+}
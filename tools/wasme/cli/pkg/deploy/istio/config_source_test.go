@@ -0,0 +1,230 @@
+package istio_test
+
+import (
+	"context"
+
+	"github.com/gogo/protobuf/types"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy"
+	envoyfilter "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/filter"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	kubev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("ConfigFrom", func() {
+	var (
+		provider *testProvider
+		filter   *wasmev1.FilterSpec
+	)
+
+	BeforeEach(func() {
+		filter = &wasmev1.FilterSpec{
+			Id:     "filter-id",
+			Image:  "filter/image:v1",
+			RootID: "root_id",
+		}
+
+		provider = newTestProvider(
+			&kubev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "filter-config",
+					Namespace: "default",
+				},
+				Data: map[string]string{"config": "from-configmap", "json": `{"greeting":"hello"}`},
+			},
+			&kubev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "filter-config",
+					Namespace: "shared",
+				},
+				Data: map[string]string{"config": "from-shared-configmap"},
+			},
+			&kubev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "filter-secret",
+					Namespace: "default",
+				},
+				Data: map[string][]byte{"config": []byte("from-secret")},
+			},
+			makeDeployment("work", "default", nil),
+		)
+	})
+
+	getEnvoyFilterSpec := func() string {
+		Expect(provider.envoyFilters).To(HaveLen(1))
+		return provider.envoyFilters[istio.EnvoyFilterName("work", filter.Id)].Spec.String()
+	}
+
+	It("reads the config from a ConfigMap in the workload namespace", func() {
+		filter.ConfigFrom = &wasmev1.ConfigSource{
+			ConfigMapKeyRef: &wasmev1.KeyReference{Name: "filter-config", Key: "config"},
+		}
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getEnvoyFilterSpec()).To(ContainSubstring("from-configmap"))
+		// the filter is not modified
+		Expect(filter.Config).To(BeNil())
+	})
+
+	It("reads the config from a ConfigMap in another namespace", func() {
+		filter.ConfigFrom = &wasmev1.ConfigSource{
+			ConfigMapKeyRef: &wasmev1.KeyReference{Name: "filter-config", Key: "config", Namespace: "shared"},
+		}
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getEnvoyFilterSpec()).To(ContainSubstring("from-shared-configmap"))
+	})
+
+	It("reads the config from a Secret", func() {
+		filter.ConfigFrom = &wasmev1.ConfigSource{
+			SecretKeyRef: &wasmev1.KeyReference{Name: "filter-secret", Key: "config"},
+		}
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getEnvoyFilterSpec()).To(ContainSubstring("from-secret"))
+	})
+
+	It("injects the checksum of the config which was read", func() {
+		filter.ConfigChecksum = true
+		filter.ConfigFrom = &wasmev1.ConfigSource{
+			ConfigMapKeyRef: &wasmev1.KeyReference{Name: "filter-config", Key: "json"},
+		}
+
+		configChecksum, err := provider.ApplyResolvedFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getEnvoyFilterSpec()).To(ContainSubstring(envoyfilter.ConfigChecksumKey))
+		// the checksum is not injected into the config of the spec, so it is returned
+		Expect(configChecksum).To(HavePrefix("sha256:"))
+		Expect(getEnvoyFilterSpec()).To(ContainSubstring(configChecksum))
+		Expect(filter.Config).To(BeNil())
+	})
+
+	expectApplyError := func(configFrom *wasmev1.ConfigSource, expected string) {
+		filter.ConfigFrom = configFrom
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(expected))
+		Expect(provider.envoyFilters).To(BeEmpty())
+	}
+
+	It("reports missing ConfigMaps and keys", func() {
+		expectApplyError(
+			&wasmev1.ConfigSource{ConfigMapKeyRef: &wasmev1.KeyReference{Name: "missing", Key: "config"}},
+			"ConfigMap missing.default not found")
+		expectApplyError(
+			&wasmev1.ConfigSource{ConfigMapKeyRef: &wasmev1.KeyReference{Name: "filter-config", Key: "missing"}},
+			"ConfigMap filter-config.default has no key missing")
+	})
+
+	It("reports missing Secrets and keys", func() {
+		expectApplyError(
+			&wasmev1.ConfigSource{SecretKeyRef: &wasmev1.KeyReference{Name: "missing", Key: "config"}},
+			"Secret missing.default not found")
+		expectApplyError(
+			&wasmev1.ConfigSource{SecretKeyRef: &wasmev1.KeyReference{Name: "filter-secret", Key: "missing"}},
+			"Secret filter-secret.default has no key missing")
+	})
+
+	It("requires exactly one complete reference", func() {
+		expectApplyError(
+			&wasmev1.ConfigSource{
+				ConfigMapKeyRef: &wasmev1.KeyReference{Name: "filter-config", Key: "config"},
+				SecretKeyRef:    &wasmev1.KeyReference{Name: "filter-secret", Key: "config"},
+			},
+			"configFrom must set only one of configMapKeyRef or secretKeyRef")
+		expectApplyError(
+			&wasmev1.ConfigSource{},
+			"configFrom must set one of configMapKeyRef or secretKeyRef")
+		expectApplyError(
+			&wasmev1.ConfigSource{ConfigMapKeyRef: &wasmev1.KeyReference{Name: "filter-config"}},
+			"configFrom.configMapKeyRef must set both name and key")
+	})
+
+	It("rejects filters which set both config and configFrom", func() {
+		config, err := types.MarshalAny(&types.StringValue{Value: "inline"})
+		Expect(err).NotTo(HaveOccurred())
+		filter.Config = config
+		filter.ConfigFrom = &wasmev1.ConfigSource{
+			ConfigMapKeyRef: &wasmev1.KeyReference{Name: "filter-config", Key: "config"},
+		}
+
+		err = provider.ApplyFilter(filter)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("configFrom: cannot set both config and configFrom"))
+	})
+
+	Context("the default config of the image", func() {
+		BeforeEach(func() {
+			provider.Puller.(*mockPuller).image.defaultConfig = &types.Value{Kind: &types.Value_StructValue{StructValue: &types.Struct{
+				Fields: map[string]*types.Value{"greeting": {Kind: &types.Value_StringValue{StringValue: "from-image"}}},
+			}}}
+		})
+
+		It("configures filters which set no config with the JSON encoding of the default config", func() {
+			err := provider.ApplyFilter(filter)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getEnvoyFilterSpec()).To(ContainSubstring(`{\"greeting\":\"from-image\"}`))
+			// the filter is not modified
+			Expect(filter.Config).To(BeNil())
+		})
+
+		It("passes string default configs as is", func() {
+			provider.Puller.(*mockPuller).image.defaultConfig = &types.Value{Kind: &types.Value_StringValue{StringValue: "plain-default"}}
+
+			err := provider.ApplyFilter(filter)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getEnvoyFilterSpec()).To(ContainSubstring(`value:"plain-default"`))
+		})
+
+		It("is checksummed by the provider when the filter is deployed with the deployer", func() {
+			filter.ConfigChecksum = true
+			deployer := &deploy.Deployer{Ctx: context.TODO(), Provider: provider}
+
+			configChecksum, err := deployer.ApplyResolvedFilter(filter)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getEnvoyFilterSpec()).To(ContainSubstring(`\"greeting\":\"from-image\"`))
+			Expect(getEnvoyFilterSpec()).To(ContainSubstring(envoyfilter.ConfigChecksumKey))
+			Expect(getEnvoyFilterSpec()).To(ContainSubstring(configChecksum))
+			Expect(filter.Config).To(BeNil())
+		})
+
+		It("checksums filters without a config when the image declares no default config", func() {
+			provider.Puller.(*mockPuller).image.defaultConfig = nil
+			filter.ConfigChecksum = true
+			deployer := &deploy.Deployer{Ctx: context.TODO(), Provider: provider}
+
+			err := deployer.ApplyFilter(filter)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getEnvoyFilterSpec()).To(ContainSubstring(envoyfilter.ConfigChecksumKey))
+		})
+
+		It("is not used by filters which set their config", func() {
+			config, err := types.MarshalAny(&types.StringValue{Value: "inline"})
+			Expect(err).NotTo(HaveOccurred())
+			filter.Config = config
+
+			err = provider.ApplyFilter(filter)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getEnvoyFilterSpec()).To(ContainSubstring("inline"))
+			Expect(getEnvoyFilterSpec()).NotTo(ContainSubstring("from-image"))
+		})
+
+		It("is not used by filters which read their config from the cluster", func() {
+			filter.ConfigFrom = &wasmev1.ConfigSource{
+				ConfigMapKeyRef: &wasmev1.KeyReference{Name: "filter-config", Key: "config"},
+			}
+
+			err := provider.ApplyFilter(filter)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getEnvoyFilterSpec()).To(ContainSubstring("from-configmap"))
+			Expect(getEnvoyFilterSpec()).NotTo(ContainSubstring("from-image"))
+		})
+	})
+})
@@ -0,0 +1,147 @@
+package istio
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// OpenShift DeploymentConfigs are read and written as unstructured objects
+// with the dynamic client, so wasme does not depend on the OpenShift client libraries
+var DeploymentConfigResource = schema.GroupVersionResource{
+	Group:    "apps.openshift.io",
+	Version:  "v1",
+	Resource: "deploymentconfigs",
+}
+
+func (p *Provider) deploymentConfigs() (dynamic.ResourceInterface, error) {
+	if p.DynamicClient == nil {
+		return nil, errors.Errorf("a dynamic client is required for workload type %v", WorkloadTypeDeploymentConfig)
+	}
+	return p.DynamicClient.Resource(DeploymentConfigResource).Namespace(p.Workload.Namespace), nil
+}
+
+// lists the selected DeploymentConfigs.
+// the pod template of each workload is a copy, written back to the object before it is updated
+func (p *Provider) listDeploymentConfigs() ([]selectedWorkload, error) {
+	client, err := p.deploymentConfigs()
+	if err != nil {
+		return nil, err
+	}
+	workloads, err := client.List(metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(p.Workload.Labels).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []selectedWorkload
+	for i := range workloads.Items {
+		workload := &workloads.Items[i]
+		meta, err := getDeploymentConfigMeta(workload)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading metadata of %v %v", WorkloadTypeDeploymentConfig, workload.GetName())
+		}
+		template, err := getDeploymentConfigTemplate(workload)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading pod template of %v %v", WorkloadTypeDeploymentConfig, workload.GetName())
+		}
+		replicas, _, _ := unstructured.NestedInt64(workload.Object, "spec", "replicas")
+		selected = append(selected, selectedWorkload{
+			info:     WorkloadInfo{Meta: meta, Replicas: int32(replicas)},
+			template: template,
+			object:   workload,
+			syncTemplate: func() error {
+				return setDeploymentConfigTemplate(workload, template)
+			},
+		})
+	}
+	return selected, nil
+}
+
+// applies the update to the pod template of the named DeploymentConfig
+func (p *Provider) updateDeploymentConfig(name string, update func(template *corev1.PodTemplateSpec)) error {
+	client, err := p.deploymentConfigs()
+	if err != nil {
+		return err
+	}
+	workload, err := client.Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	template, err := getDeploymentConfigTemplate(workload)
+	if err != nil {
+		return err
+	}
+	update(template)
+	if err := setDeploymentConfigTemplate(workload, template); err != nil {
+		return err
+	}
+	return p.Client.Ensure(p.Ctx, nil, workload)
+}
+
+// reads the rollout status of the named DeploymentConfig
+func (p *Provider) getDeploymentConfigRolloutStatus(name string) (*rolloutStatus, error) {
+	client, err := p.deploymentConfigs()
+	if err != nil {
+		return nil, err
+	}
+	workload, err := client.Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	field := func(fields ...string) int64 {
+		value, _, _ := unstructured.NestedInt64(workload.Object, fields...)
+		return value
+	}
+	replicas := field("spec", "replicas")
+	updated, available := field("status", "updatedReplicas"), field("status", "availableReplicas")
+	selector, _, _ := unstructured.NestedStringMap(workload.Object, "spec", "selector")
+
+	return &rolloutStatus{
+		done: workload.GetGeneration() <= field("status", "observedGeneration") &&
+			updated >= replicas &&
+			field("status", "replicas") <= updated &&
+			available >= updated,
+		progress: fmt.Sprintf("%v of %v replicas updated, %v available", updated, replicas, available),
+		selector: &metav1.LabelSelector{MatchLabels: selector},
+	}, nil
+}
+
+func getDeploymentConfigMeta(workload *unstructured.Unstructured) (metav1.ObjectMeta, error) {
+	raw, _, err := unstructured.NestedMap(workload.Object, "metadata")
+	if err != nil {
+		return metav1.ObjectMeta{}, err
+	}
+	var meta metav1.ObjectMeta
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &meta)
+	return meta, err
+}
+
+func getDeploymentConfigTemplate(workload *unstructured.Unstructured) (*corev1.PodTemplateSpec, error) {
+	raw, _, err := unstructured.NestedMap(workload.Object, "spec", "template")
+	if err != nil {
+		return nil, err
+	}
+	var template corev1.PodTemplateSpec
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &template); err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+func setDeploymentConfigTemplate(workload *unstructured.Unstructured, template *corev1.PodTemplateSpec) error {
+	raw, err := runtime.DefaultUnstructuredConverter.ToUnstructured(template)
+	if err != nil {
+		return err
+	}
+	return unstructured.SetNestedMap(workload.Object, raw, "spec", "template")
+}
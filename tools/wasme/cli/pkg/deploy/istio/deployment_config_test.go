@@ -0,0 +1,132 @@
+package istio_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/skv2/pkg/ezkube"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+var _ = Describe("DeploymentConfig workloads", func() {
+	var (
+		dynamicClient *dynamicfake.FakeDynamicClient
+		provider      *testProvider
+		filter        = &wasmev1.FilterSpec{
+			Id:     "filter-id",
+			Image:  "filter/image:v1",
+			RootID: "root_id",
+		}
+	)
+
+	makeDeploymentConfig := func(name string, labels map[string]string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apps.openshift.io/v1",
+			"kind":       "DeploymentConfig",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": "default",
+				"labels":    toInterfaceMap(labels),
+			},
+			"spec": map[string]interface{}{
+				"replicas": int64(2),
+				"selector": map[string]interface{}{"app": name},
+				"template": map[string]interface{}{
+					"metadata": map[string]interface{}{
+						"labels": map[string]interface{}{"app": name},
+					},
+					"spec": map[string]interface{}{
+						"containers": []interface{}{
+							map[string]interface{}{
+								"name":  "http-echo",
+								"image": "hashicorp/http-echo",
+							},
+						},
+					},
+				},
+			},
+		}}
+	}
+
+	getTemplateAnnotations := func(name string) map[string]string {
+		workload, err := dynamicClient.Resource(istio.DeploymentConfigResource).Namespace("default").Get(name, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		annotations, _, err := unstructured.NestedStringMap(workload.Object, "spec", "template", "metadata", "annotations")
+		Expect(err).NotTo(HaveOccurred())
+		return annotations
+	}
+
+	BeforeEach(func() {
+		dynamicClient = dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+			makeDeploymentConfig("work", map[string]string{"app": "work"}),
+			makeDeploymentConfig("other", map[string]string{"app": "other"}),
+		)
+
+		provider = newTestProvider()
+		// persist the updated DeploymentConfigs
+		provider.onEnsure = func(obj ezkube.Object) error {
+			if workload, ok := obj.(*unstructured.Unstructured); ok {
+				_, err := dynamicClient.Resource(istio.DeploymentConfigResource).Namespace(workload.GetNamespace()).Update(workload, metav1.UpdateOptions{})
+				return err
+			}
+			return nil
+		}
+		provider.DynamicClient = dynamicClient
+		provider.Workload = istio.Workload{
+			Labels:    map[string]string{"app": "work"},
+			Namespace: "default",
+			Kind:      istio.WorkloadTypeDeploymentConfig,
+		}
+	})
+
+	It("adds the filter to the pod template of the selected DeploymentConfigs", func() {
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(getTemplateAnnotations("work")).To(HaveKey("sidecar.istio.io/userVolume"))
+		Expect(getTemplateAnnotations("work")).To(HaveKey("sidecar.istio.io/userVolumeMount"))
+		Expect(getTemplateAnnotations("other")).To(BeEmpty())
+
+		Expect(provider.envoyFilters).To(HaveLen(1))
+		Expect(provider.envoyFilters[istio.EnvoyFilterName("work", filter.Id)].Spec.WorkloadSelector.Labels).To(Equal(map[string]string{"app": "work"}))
+	})
+
+	It("restores the pod template when the filter is removed", func() {
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = provider.RemoveFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(getTemplateAnnotations("work")).NotTo(HaveKey("sidecar.istio.io/userVolume"))
+		Expect(getTemplateAnnotations("work")).NotTo(HaveKey("sidecar.istio.io/userVolumeMount"))
+	})
+
+	It("requires a dynamic client", func() {
+		provider.DynamicClient = nil
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("a dynamic client is required for workload type deploymentconfig"))
+	})
+
+	It("lists the supported workload types for an unknown type", func() {
+		provider.Workload.Kind = "replicaset"
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(istio.WorkloadTypeDeploymentConfig))
+	})
+})
+
+func toInterfaceMap(m map[string]string) map[string]interface{} {
+	out := map[string]interface{}{}
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
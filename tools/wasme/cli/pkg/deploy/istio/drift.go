@@ -0,0 +1,53 @@
+package istio
+
+import (
+	"fmt"
+
+	"github.com/gogo/protobuf/proto"
+	"istio.io/client-go/pkg/apis/networking/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// reports drift corrected by ApplyFilter to OnDrift
+func (p *Provider) reportDrift(filterId, format string, args ...interface{}) {
+	drift := fmt.Sprintf(format, args...)
+	p.logger().WithFields(Fields{
+		"filter": filterId,
+	}).Warnf("correcting drift: %v", drift)
+	if p.OnDrift != nil {
+		p.OnDrift(drift)
+	}
+}
+
+// returns true if the filter is recorded on the workload as applied with the state,
+// so the sidecar annotations of a workload which are not applied were modified since
+func filterRecorded(template *corev1.PodTemplateSpec, filterId string, state AppliedFilter) bool {
+	applied, err := GetAppliedFilters(template)
+	if err != nil {
+		return false
+	}
+	current, ok := applied[filterId]
+	return ok && current == state
+}
+
+// reports drift if the EnvoyFilter of a filter which was already applied was deleted, or its spec was modified.
+// only checked if OnDrift is set, as it reads the EnvoyFilter before it is ensured
+func (p *Provider) checkEnvoyFilterDrift(filterId string, expected *v1alpha3.EnvoyFilter) error {
+	if p.OnDrift == nil {
+		return nil
+	}
+	existing := &v1alpha3.EnvoyFilter{}
+	existing.Name, existing.Namespace = expected.Name, expected.Namespace
+	if err := p.Client.Get(p.Ctx, existing); err != nil {
+		if !kubeerrors.IsNotFound(err) {
+			return err
+		}
+		p.reportDrift(filterId, "EnvoyFilter %v.%v was deleted", expected.Name, expected.Namespace)
+		return nil
+	}
+	if !proto.Equal(&existing.Spec, &expected.Spec) {
+		p.reportDrift(filterId, "EnvoyFilter %v.%v was modified", expected.Name, expected.Namespace)
+	}
+	return nil
+}
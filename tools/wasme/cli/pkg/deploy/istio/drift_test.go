@@ -0,0 +1,76 @@
+package istio_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	istiov1alpha3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Drift", func() {
+	var (
+		kube         *fake.Clientset
+		provider     *testProvider
+		envoyFilters map[string]*istiov1alpha3.EnvoyFilter
+		drifts       []string
+		filter       = &wasmev1.FilterSpec{
+			Id:     "filter-id",
+			Image:  "filter/image:v1",
+			RootID: "root_id",
+		}
+	)
+
+	BeforeEach(func() {
+		drifts = nil
+
+		provider = newTestProvider(makeDeployment("a-work", "default", nil))
+		kube = provider.kube
+		envoyFilters = provider.envoyFilters
+		provider.OnDrift = func(drift string) {
+			drifts = append(drifts, drift)
+		}
+
+		Expect(provider.ApplyFilter(filter)).NotTo(HaveOccurred())
+	})
+
+	It("reports no drift when the filter is applied again unchanged", func() {
+		Expect(provider.ApplyFilter(filter)).NotTo(HaveOccurred())
+		Expect(drifts).To(BeEmpty())
+	})
+
+	It("recreates and reports a deleted EnvoyFilter", func() {
+		name := istio.EnvoyFilterName("a-work", filter.Id)
+		delete(envoyFilters, name)
+
+		Expect(provider.ApplyFilter(filter)).NotTo(HaveOccurred())
+		Expect(drifts).To(Equal([]string{"EnvoyFilter " + name + ".default was deleted"}))
+		Expect(envoyFilters).To(HaveKey(name))
+	})
+
+	It("restores and reports a modified EnvoyFilter", func() {
+		name := istio.EnvoyFilterName("a-work", filter.Id)
+		envoyFilters[name].Spec.ConfigPatches = nil
+
+		Expect(provider.ApplyFilter(filter)).NotTo(HaveOccurred())
+		Expect(drifts).To(Equal([]string{"EnvoyFilter " + name + ".default was modified"}))
+		Expect(envoyFilters[name].Spec.ConfigPatches).NotTo(BeEmpty())
+	})
+
+	It("restores and reports modified sidecar annotations", func() {
+		workload, err := kube.AppsV1().Deployments("default").Get("a-work", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		delete(workload.Spec.Template.Annotations, "sidecar.istio.io/userVolumeMount")
+		_, err = kube.AppsV1().Deployments("default").Update(workload)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(provider.ApplyFilter(filter)).NotTo(HaveOccurred())
+		Expect(drifts).To(Equal([]string{"the sidecar annotations of workload a-work were modified"}))
+
+		workload, err = kube.AppsV1().Deployments("default").Get("a-work", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(workload.Spec.Template.Annotations).To(HaveKey("sidecar.istio.io/userVolumeMount"))
+	})
+})
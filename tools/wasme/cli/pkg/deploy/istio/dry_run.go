@@ -0,0 +1,153 @@
+package istio
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cache"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	pkgcache "github.com/solo-io/wasm/tools/wasme/pkg/cache"
+	"github.com/solo-io/wasm/tools/wasme/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// writes the resources ApplyFilter would create or update to the DryRunOutput, without reading or modifying the cluster:
+// the cache ConfigMap listing the image, the EnvoyFilter of the filter,
+// and a strategic merge patch of the pod template annotations of the workload named by Workload.Name.
+// as the cluster is not read, the cache ConfigMap only lists the image of the filter,
+// and the patch replaces the sidecar annotations and the filters recorded on the workload
+// rather than merging them with their current values.
+// filters reading their config from the cluster or ordered relative to a deployed filter cannot be rendered
+func (p *Provider) renderFilter(filter *v1.FilterSpec) error {
+	if p.Workload.Name == "" {
+		return errors.Errorf("rendering filter %v requires the name of the workload", filter.Id)
+	}
+	if filter.GetConfigFrom() != nil {
+		return errors.Errorf("cannot render filter %v: its config is read from the cluster", filter.Id)
+	}
+	if filter.GetOrderBefore() != "" || filter.GetOrderAfter() != "" {
+		return errors.Errorf("cannot render filter %v: ordering it relative to another filter reads the deployed filters", filter.Id)
+	}
+
+	prepared, err := p.prepareFilter(filter)
+	if err != nil {
+		return err
+	}
+
+	configMap, err := p.renderCacheConfigMap(filter, prepared.cachedImage, prepared.state.Digest)
+	if err != nil {
+		return err
+	}
+
+	selector := p.SelectorLabels
+	if len(selector) == 0 {
+		selector = p.Workload.Labels
+	}
+	if !p.MeshWide && len(selector) == 0 {
+		return errors.Errorf("rendering filter %v requires the labels of the workload or the selector labels", filter.Id)
+	}
+	var workloadName string
+	if !p.MeshWide {
+		workloadName = p.Workload.Name
+	}
+	envoyFilter, err := p.makeIstioEnvoyFilter(prepared.configured, prepared.image, prepared.proxyVersion, workloadName, selector)
+	if err != nil {
+		return err
+	}
+	envoyFilter.APIVersion = "networking.istio.io/v1alpha3"
+	envoyFilter.Kind = "EnvoyFilter"
+
+	patch, err := p.renderWorkloadPatch(filter, prepared.state)
+	if err != nil {
+		return err
+	}
+
+	for _, resource := range []struct {
+		comment string
+		obj     interface{}
+	}{
+		{comment: "the cache config, which must also list the images already cached", obj: configMap},
+		{comment: "the EnvoyFilter of filter " + filter.Id, obj: envoyFilter},
+		{comment: "strategic merge patch of " + strings.ToLower(patch["kind"].(string)) + " " + p.Workload.Name, obj: patch},
+	} {
+		out, err := yaml.Marshal(resource.obj)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(p.DryRunOutput, "---\n# %v\n%s", resource.comment, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// returns the cache ConfigMap listing the image, as added by addImageToCacheConfigMap
+func (p *Provider) renderCacheConfigMap(filter *v1.FilterSpec, imageRef, imageDigest string) (*corev1.ConfigMap, error) {
+	image, err := util.NormalizeImageRef(imageRef)
+	if err != nil {
+		return nil, err
+	}
+	listed := pkgcache.ListedImage{
+		Digest:  imageDigest,
+		AddedBy: p.Workload.Namespace + "/" + filter.Id,
+	}
+	if imageRef != filter.Image {
+		listed.PinnedFrom = filter.Image
+	}
+	images, err := pkgcache.ImageList{image: listed}.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      p.Cache.Name,
+			Namespace: p.Cache.Namespace,
+		},
+		Data: map[string]string{cache.ImagesKey: images},
+	}, nil
+}
+
+// returns the strategic merge patch adding the annotations written by annotateWorkload to the pod template of the workload
+func (p *Provider) renderWorkloadPatch(filter *v1.FilterSpec, state AppliedFilter) (map[string]interface{}, error) {
+	var apiVersion, kind string
+	switch strings.ToLower(p.Workload.Kind) {
+	case WorkloadTypeDeployment:
+		apiVersion, kind = "apps/v1", "Deployment"
+	case WorkloadTypeDaemonSet:
+		apiVersion, kind = "apps/v1", "DaemonSet"
+	case WorkloadTypeStatefulSet:
+		apiVersion, kind = "apps/v1", "StatefulSet"
+	case WorkloadTypeDeploymentConfig:
+		apiVersion, kind = DeploymentConfigResource.GroupVersion().String(), "DeploymentConfig"
+	default:
+		return nil, unknownWorkloadTypeError(p.Workload.Kind)
+	}
+
+	template := &corev1.PodTemplateSpec{}
+	if err := p.setAnnotations(p.Workload.Name, template); err != nil {
+		return nil, err
+	}
+	if err := p.setAppliedFilter(p.Workload.Name, template, filter.Id, state); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata": map[string]interface{}{
+			"name":      p.Workload.Name,
+			"namespace": p.Workload.Namespace,
+		},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": template.Annotations,
+				},
+			},
+		},
+	}, nil
+}
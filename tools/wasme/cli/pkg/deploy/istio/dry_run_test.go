@@ -0,0 +1,138 @@
+package istio_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cache"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	pkgcache "github.com/solo-io/wasm/tools/wasme/pkg/cache"
+	istiov1alpha3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	kubev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Dry run", func() {
+	const imageDigest = "sha256:e454cab754cf9234e8b41d7c5e30f53a4c125d7d9443cb3ef2b2eb1c4bd1ec14"
+	var (
+		out      *bytes.Buffer
+		provider *istio.Provider
+	)
+
+	filter := &wasmev1.FilterSpec{
+		Id:     "filter-a",
+		Image:  "filter/image:v1",
+		RootID: "root_id",
+	}
+
+	// splits the output into the YAML documents it contains
+	documents := func() []string {
+		docs := strings.Split(out.String(), "---\n")
+		Expect(docs[0]).To(BeEmpty())
+		return docs[1:]
+	}
+
+	BeforeEach(func() {
+		out = &bytes.Buffer{}
+		// no clients are set, so any request to the cluster panics
+		provider = &istio.Provider{
+			Ctx: context.TODO(),
+			Puller: &mockPuller{
+				image: mockImage{ref: "filter/image:v1", digest: imageDigest},
+			},
+			Workload: istio.Workload{
+				Name:      "work",
+				Namespace: "default",
+				Labels:    map[string]string{"app": "work"},
+				Kind:      istio.WorkloadTypeDeployment,
+			},
+			Cache: istio.Cache{
+				Name:      "wasme-cache",
+				Namespace: "wasme",
+			},
+			VersionInspector: istio.StaticVersionInspector("1.7.3"),
+			DryRunOutput:     out,
+		}
+	})
+
+	It("prints the cache config, the EnvoyFilter and the workload patch", func() {
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		docs := documents()
+		Expect(docs).To(HaveLen(3))
+
+		var configMap kubev1.ConfigMap
+		Expect(yaml.Unmarshal([]byte(docs[0]), &configMap)).NotTo(HaveOccurred())
+		Expect(configMap.Kind).To(Equal("ConfigMap"))
+		Expect(configMap.Name).To(Equal("wasme-cache"))
+		Expect(configMap.Namespace).To(Equal("wasme"))
+		images, err := pkgcache.ParseImageList(configMap.Data[cache.ImagesKey])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(images).To(HaveKey("filter/image:v1"))
+		Expect(images["filter/image:v1"].Digest).To(Equal(imageDigest))
+
+		var envoyFilter istiov1alpha3.EnvoyFilter
+		Expect(yaml.Unmarshal([]byte(docs[1]), &envoyFilter)).NotTo(HaveOccurred())
+		Expect(envoyFilter.APIVersion).To(Equal("networking.istio.io/v1alpha3"))
+		Expect(envoyFilter.Kind).To(Equal("EnvoyFilter"))
+		Expect(envoyFilter.Name).To(Equal(istio.EnvoyFilterName("work", "filter-a")))
+		Expect(envoyFilter.Namespace).To(Equal("default"))
+		Expect(envoyFilter.Spec.WorkloadSelector.Labels).To(Equal(map[string]string{"app": "work"}))
+		Expect(envoyFilter.Spec.ConfigPatches).To(HaveLen(1))
+
+		var patch struct {
+			APIVersion string `json:"apiVersion"`
+			Kind       string `json:"kind"`
+			Metadata   struct {
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"metadata"`
+			Spec struct {
+				Template kubev1.PodTemplateSpec `json:"template"`
+			} `json:"spec"`
+		}
+		Expect(yaml.Unmarshal([]byte(docs[2]), &patch)).NotTo(HaveOccurred())
+		Expect(patch.APIVersion).To(Equal("apps/v1"))
+		Expect(patch.Kind).To(Equal("Deployment"))
+		Expect(patch.Metadata.Name).To(Equal("work"))
+		Expect(patch.Metadata.Namespace).To(Equal("default"))
+		Expect(patch.Spec.Template.Annotations).To(HaveKey("sidecar.istio.io/userVolume"))
+		Expect(patch.Spec.Template.Annotations).To(HaveKey("sidecar.istio.io/userVolumeMount"))
+		applied, err := istio.GetAppliedFilters(&patch.Spec.Template)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(applied).To(HaveKey("filter-a"))
+		Expect(applied["filter-a"].Image).To(Equal("filter/image:v1"))
+	})
+
+	It("prints the mesh-wide EnvoyFilter", func() {
+		provider.MeshWide = true
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		var envoyFilter istiov1alpha3.EnvoyFilter
+		Expect(yaml.Unmarshal([]byte(documents()[1]), &envoyFilter)).NotTo(HaveOccurred())
+		Expect(envoyFilter.Name).To(Equal("filter-a"))
+		Expect(envoyFilter.Namespace).To(Equal("istio-system"))
+		Expect(envoyFilter.Spec.WorkloadSelector).To(BeNil())
+	})
+
+	It("requires the name of the workload", func() {
+		provider.Workload.Name = ""
+		err := provider.ApplyFilter(filter)
+		Expect(err).To(MatchError("rendering filter filter-a requires the name of the workload"))
+		Expect(out.Len()).To(BeZero())
+	})
+
+	It("does not render filters ordered relative to a deployed filter", func() {
+		ordered := *filter
+		ordered.OrderAfter = "filter-b"
+		err := provider.ApplyFilter(&ordered)
+		Expect(err).To(MatchError("cannot render filter filter-a: ordering it relative to another filter reads the deployed filters"))
+		Expect(out.Len()).To(BeZero())
+	})
+})
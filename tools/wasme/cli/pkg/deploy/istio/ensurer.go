@@ -0,0 +1,29 @@
+package istio
+
+import (
+	"context"
+	"log"
+
+	"github.com/solo-io/skv2/pkg/ezkube"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// NewEnsurer returns an ezkube.Ensurer for creating the resources managed by the Provider.
+// the backing manager is started in the background and stops when ctx is done,
+// which allows running the Provider headless, outside of the CLI and operator.
+func NewEnsurer(ctx context.Context, cfg *rest.Config) (ezkube.Ensurer, error) {
+	mgr, err := manager.New(cfg, manager.Options{})
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		err := mgr.Start(ctx.Done())
+		if err != nil {
+			log.Fatalf("failed to start kubernetes dynamic client")
+		}
+	}()
+
+	return ezkube.NewEnsurer(ezkube.NewRestClient(mgr)), nil
+}
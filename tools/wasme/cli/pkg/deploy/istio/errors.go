@@ -0,0 +1,75 @@
+package istio
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AbiIncompatibleError is returned by ApplyFilter if the ABI versions of the image,
+// or of every variant of a multi-variant image, are not supported by the installed version of istio
+type AbiIncompatibleError struct {
+	Image        string
+	IstioVersion string
+	// the ABI versions of each variant of a multi-variant image, empty for other images
+	Variants [][]string
+}
+
+func (e *AbiIncompatibleError) Error() string {
+	if len(e.Variants) == 0 {
+		return fmt.Sprintf("image %v not supported by istio version %v", e.Image, e.IstioVersion)
+	}
+	var abiVersions []string
+	for _, variant := range e.Variants {
+		abiVersions = append(abiVersions, "["+strings.Join(variant, ", ")+"]")
+	}
+	return fmt.Sprintf("no variant of image %v is supported by istio version %v, the variants have the abi versions %v",
+		e.Image, e.IstioVersion, strings.Join(abiVersions, ", "))
+}
+
+// IsAbiIncompatible returns true if the filter was not applied because its image is not supported by the istio version
+func IsAbiIncompatible(err error) bool {
+	var abiErr *AbiIncompatibleError
+	return errors.As(err, &abiErr)
+}
+
+// CacheError is returned by ApplyFilter if the image could not be added to the cache config,
+// or the cache did not publish an event for the image before the WaitForCacheTimeout
+type CacheError struct {
+	Image string
+	Err   error
+}
+
+func (e *CacheError) Error() string {
+	return fmt.Sprintf("adding image to cache: %v", e.Err)
+}
+
+func (e *CacheError) Unwrap() error {
+	return e.Err
+}
+
+// IsCacheError returns true if the filter was not applied because the image could not be cached
+func IsCacheError(err error) bool {
+	var cacheErr *CacheError
+	return errors.As(err, &cacheErr)
+}
+
+// CacheTimeoutError is the error of a CacheError if the cache did not publish
+// an event for the image on every ready instance before the WaitForCacheTimeout
+type CacheTimeoutError struct {
+	Timeout time.Duration
+	// the last error found while waiting for the events, if any
+	LastErr error
+}
+
+func (e *CacheTimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s (last err: %v)", e.Timeout, e.LastErr)
+}
+
+// IsCacheTimeout returns true if the filter was not applied because the cache timed out pulling the image
+func IsCacheTimeout(err error) bool {
+	var timeoutErr *CacheTimeoutError
+	return errors.As(err, &timeoutErr)
+}
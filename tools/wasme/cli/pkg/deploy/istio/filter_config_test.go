@@ -0,0 +1,86 @@
+package istio_test
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	envoyfilter "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/filter"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	istiov1alpha3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
+)
+
+var _ = Describe("Struct filter configs", func() {
+	// a config with a nested object, and a string containing newlines
+	const config = `{"headers":{"x-wasme":"on"},"limit":3,"message":"line 1\nline 2"}`
+	var (
+		provider     *testProvider
+		inspector    *countingInspector
+		envoyFilters map[string]*istiov1alpha3.EnvoyFilter
+		filter       *wasmev1.FilterSpec
+	)
+
+	BeforeEach(func() {
+		structConfig, err := envoyfilter.MakeStructConfig([]byte(config))
+		Expect(err).NotTo(HaveOccurred())
+		filter = &wasmev1.FilterSpec{
+			Id:     "struct-filter",
+			Image:  "filter/image:v1",
+			RootID: "root_id",
+			Config: structConfig,
+		}
+
+		provider = newTestProvider(makeDeployment("work", "default", nil))
+		envoyFilters = provider.envoyFilters
+		inspector = provider.VersionInspector.(*countingInspector)
+	})
+
+	// returns the value of the patch of the EnvoyFilter created for the filter, as marshaled to the cluster
+	getPatchValue := func() map[string]interface{} {
+		envoyFilter := envoyFilters[istio.EnvoyFilterName("work", "struct-filter")]
+		Expect(envoyFilter).NotTo(BeNil())
+		raw, err := json.Marshal(envoyFilter)
+		Expect(err).NotTo(HaveOccurred())
+		var marshaled struct {
+			Spec struct {
+				ConfigPatches []struct {
+					Patch struct {
+						Value map[string]interface{} `json:"value"`
+					} `json:"patch"`
+				} `json:"configPatches"`
+			} `json:"spec"`
+		}
+		Expect(json.Unmarshal(raw, &marshaled)).To(Succeed())
+		Expect(marshaled.Spec.ConfigPatches).To(HaveLen(1))
+		return marshaled.Spec.ConfigPatches[0].Patch.Value
+	}
+
+	// returns the value of a nested field of a JSON object
+	field := func(obj interface{}, path ...string) interface{} {
+		for _, key := range path {
+			Expect(obj).To(HaveKey(key))
+			obj = obj.(map[string]interface{})[key]
+		}
+		return obj
+	}
+
+	It("passes the config object unmangled to typed wasm filters", func() {
+		Expect(provider.ApplyFilter(filter)).NotTo(HaveOccurred())
+
+		configuration := field(getPatchValue(), "typedConfig", "value", "config", "configuration")
+		Expect(field(configuration, "@type")).To(Equal("type.googleapis.com/google.protobuf.Struct"))
+		value, err := json.Marshal(field(configuration, "value"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value).To(MatchJSON(config))
+	})
+
+	It("passes the JSON of the config object to the wasm filters of older versions of Istio", func() {
+		inspector.version = "1.6.8"
+		Expect(provider.ApplyFilter(filter)).NotTo(HaveOccurred())
+
+		configuration := field(getPatchValue(), "config", "config", "configuration")
+		Expect(configuration).To(BeAssignableToTypeOf(""))
+		Expect(configuration).To(MatchJSON(config))
+	})
+})
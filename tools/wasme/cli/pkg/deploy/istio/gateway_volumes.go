@@ -0,0 +1,210 @@
+package istio
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// set on the pod templates of gateways to the volumes and volume mounts added by wasme to mount the filter cache,
+	// so they are removed along with the filters
+	GatewayVolumesAnnotation = "wasme.io/gateway-volumes"
+)
+
+// the volumes added by wasme to the pod spec of a gateway, and the volume mounts added to its istio-proxy container
+type gatewayVolumes struct {
+	Volumes      []corev1.Volume      `json:"volumes,omitempty"`
+	VolumeMounts []corev1.VolumeMount `json:"volumeMounts,omitempty"`
+}
+
+// returns true if the cache is mounted by patching the pod spec of the workload rather than with the sidecar annotations:
+// the filter patches the gateway context and the istio-proxy container is part of the pod template,
+// as in the deployments of the Istio gateways, so istiod ignores the sidecar annotations
+func (p *Provider) mountsGatewayVolumes(filter *v1.FilterSpec, template *corev1.PodTemplateSpec) bool {
+	if p.RemoteDatasource || strings.ToLower(filter.GetPatchContext()) != PatchContextGateway {
+		return false
+	}
+	return proxyContainer(template) != nil
+}
+
+// returns true if the workload mounts the filter cache as required to run the filter
+func (p *Provider) cacheMounted(filter *v1.FilterSpec, template *corev1.PodTemplateSpec) bool {
+	if p.mountsGatewayVolumes(filter, template) {
+		return template.Annotations[appliedAnnotation] == "true" && gatewayVolumesMounted(template, requiredGatewayVolumes(p.Cache))
+	}
+	return sidecarAnnotationsApplied(template, p.sidecarAnnotations())
+}
+
+// the volume and volume mount of the cache, as written in the sidecar annotations
+func requiredGatewayVolumes(cache Cache) gatewayVolumes {
+	annotations := requiredSidecarAnnotations(cache)
+	var required gatewayVolumes
+	// the annotations are valid JSON
+	_ = json.Unmarshal([]byte(annotations["sidecar.istio.io/userVolume"]), &required.Volumes)
+	_ = json.Unmarshal([]byte(annotations["sidecar.istio.io/userVolumeMount"]), &required.VolumeMounts)
+	return required
+}
+
+func proxyContainer(template *corev1.PodTemplateSpec) *corev1.Container {
+	for i := range template.Spec.Containers {
+		if template.Spec.Containers[i].Name == istioProxyContainer {
+			return &template.Spec.Containers[i]
+		}
+	}
+	return nil
+}
+
+// returns true if the pod spec has the volumes and the istio-proxy container has the volume mounts, by name
+func gatewayVolumesMounted(template *corev1.PodTemplateSpec, volumes gatewayVolumes) bool {
+	container := proxyContainer(template)
+	if container == nil {
+		return false
+	}
+	for _, volume := range volumes.Volumes {
+		if findVolume(template.Spec.Volumes, volume.Name) < 0 {
+			return false
+		}
+	}
+	for _, mount := range volumes.VolumeMounts {
+		if findVolumeMount(container.VolumeMounts, mount) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// adds the cache volume to the pod spec of the gateway and mounts it on its istio-proxy container,
+// recording the volumes and mounts which were added in the GatewayVolumesAnnotation.
+// volumes and mounts which already exist are left as they are
+func (p *Provider) setGatewayVolumes(workloadName string, template *corev1.PodTemplateSpec) error {
+	container := proxyContainer(template)
+	if container == nil {
+		return errors.Errorf("workload %v has no %v container to mount the filter cache", workloadName, istioProxyContainer)
+	}
+	// the volumes added for another storage of the cache are replaced
+	removeGatewayVolumes(template)
+	container = proxyContainer(template)
+
+	required := requiredGatewayVolumes(p.Cache)
+	for _, mount := range required.VolumeMounts {
+		for _, existing := range container.VolumeMounts {
+			if existing.MountPath == mount.MountPath && existing.Name != mount.Name {
+				return errors.Errorf("container %v of workload %v already mounts volume %v at %v", istioProxyContainer, workloadName, existing.Name, mount.MountPath)
+			}
+		}
+	}
+
+	added := addGatewayVolumes(template, required)
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+	if len(added.Volumes) > 0 || len(added.VolumeMounts) > 0 {
+		value, err := json.Marshal(added)
+		if err != nil {
+			return err
+		}
+		template.Annotations[GatewayVolumesAnnotation] = string(value)
+	}
+	template.Annotations[appliedAnnotation] = "true"
+
+	p.logger().WithFields(Fields{
+		"workload": workloadName,
+		"volumes":  template.Annotations[GatewayVolumesAnnotation],
+	}).Infof("mounted the filter cache on the gateway")
+	return nil
+}
+
+// adds the volumes and volume mounts missing from the pod template, returning those which were added
+func addGatewayVolumes(template *corev1.PodTemplateSpec, volumes gatewayVolumes) gatewayVolumes {
+	var added gatewayVolumes
+	container := proxyContainer(template)
+	if container == nil {
+		return added
+	}
+	for _, volume := range volumes.Volumes {
+		if findVolume(template.Spec.Volumes, volume.Name) < 0 {
+			template.Spec.Volumes = append(template.Spec.Volumes, volume)
+			added.Volumes = append(added.Volumes, volume)
+		}
+	}
+	for _, mount := range volumes.VolumeMounts {
+		if findVolumeMount(container.VolumeMounts, mount) < 0 {
+			container.VolumeMounts = append(container.VolumeMounts, mount)
+			added.VolumeMounts = append(added.VolumeMounts, mount)
+		}
+	}
+	return added
+}
+
+// reads the volumes recorded in the GatewayVolumesAnnotation of the pod template, false if there are none
+func recordedGatewayVolumes(template *corev1.PodTemplateSpec) (gatewayVolumes, bool) {
+	var recorded gatewayVolumes
+	value, ok := template.Annotations[GatewayVolumesAnnotation]
+	if !ok {
+		return recorded, false
+	}
+	if err := json.Unmarshal([]byte(value), &recorded); err != nil {
+		return recorded, false
+	}
+	return recorded, true
+}
+
+// removes the volumes and volume mounts recorded in the GatewayVolumesAnnotation from the pod template,
+// along with the annotation
+func removeGatewayVolumes(template *corev1.PodTemplateSpec) {
+	recorded, ok := recordedGatewayVolumes(template)
+	delete(template.Annotations, GatewayVolumesAnnotation)
+	if !ok {
+		return
+	}
+	for _, volume := range recorded.Volumes {
+		if i := findVolume(template.Spec.Volumes, volume.Name); i >= 0 {
+			template.Spec.Volumes = append(template.Spec.Volumes[:i], template.Spec.Volumes[i+1:]...)
+		}
+	}
+	if len(template.Spec.Volumes) == 0 {
+		template.Spec.Volumes = nil
+	}
+	container := proxyContainer(template)
+	if container == nil {
+		return
+	}
+	for _, mount := range recorded.VolumeMounts {
+		if i := findVolumeMount(container.VolumeMounts, mount); i >= 0 {
+			container.VolumeMounts = append(container.VolumeMounts[:i], container.VolumeMounts[i+1:]...)
+		}
+	}
+	if len(container.VolumeMounts) == 0 {
+		container.VolumeMounts = nil
+	}
+}
+
+// re-adds the volumes and volume mounts recorded in the GatewayVolumesAnnotation of the pod template,
+// after the annotation was restored
+func restoreGatewayVolumes(template *corev1.PodTemplateSpec) {
+	if recorded, ok := recordedGatewayVolumes(template); ok {
+		addGatewayVolumes(template, recorded)
+	}
+}
+
+func findVolume(volumes []corev1.Volume, name string) int {
+	for i, volume := range volumes {
+		if volume.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func findVolumeMount(mounts []corev1.VolumeMount, mount corev1.VolumeMount) int {
+	for i, existing := range mounts {
+		if existing.Name == mount.Name && existing.MountPath == mount.MountPath {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,172 @@
+package istio_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	istiov1alpha3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	appsv1 "k8s.io/api/apps/v1"
+	kubev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Gateway volumes", func() {
+	var (
+		kube         *fake.Clientset
+		provider     *testProvider
+		envoyFilters map[string]*istiov1alpha3.EnvoyFilter
+		filter       *wasmev1.FilterSpec
+	)
+
+	// a gateway deployment, whose pod template contains the istio-proxy container
+	makeGateway := func(name, ns string) *appsv1.Deployment {
+		gateway := makeDeployment(name, ns, nil)
+		gateway.Labels = map[string]string{"istio": name}
+		gateway.Spec.Template.Spec.Containers = []kubev1.Container{{
+			Name:  "istio-proxy",
+			Image: "docker.io/istio/proxyv2:1.7.3",
+			VolumeMounts: []kubev1.VolumeMount{{
+				Name:      "istio-envoy",
+				MountPath: "/etc/istio/proxy",
+			}},
+		}}
+		gateway.Spec.Template.Spec.Volumes = []kubev1.Volume{{
+			Name:         "istio-envoy",
+			VolumeSource: kubev1.VolumeSource{EmptyDir: &kubev1.EmptyDirVolumeSource{}},
+		}}
+		return gateway
+	}
+
+	getGateway := func(name, ns string) *appsv1.Deployment {
+		gateway, err := kube.AppsV1().Deployments(ns).Get(name, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		return gateway
+	}
+
+	// targets the provider at the gateway, or at every gateway in the namespace if gatewayName is empty
+	selectGateway := func(ns, gatewayName string) {
+		provider.Workload = istio.Workload{
+			Name:      gatewayName,
+			Namespace: ns,
+			Kind:      istio.WorkloadTypeDeployment,
+		}
+	}
+
+	BeforeEach(func() {
+		filter = &wasmev1.FilterSpec{
+			Id:           "gateway-filter",
+			Image:        "filter/image:v1",
+			RootID:       "root_id",
+			PatchContext: istio.PatchContextGateway,
+		}
+		provider = newTestProvider(
+			// the istio-system namespace is not labeled for injection
+			&kubev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "istio-system"}},
+			makeInjectedNamespace("gateways"),
+			makeGateway("istio-ingressgateway", "istio-system"),
+			makeGateway("custom-gateway", "gateways"),
+		)
+		kube = provider.kube
+		envoyFilters = provider.envoyFilters
+	})
+
+	It("mounts the cache on the istio-proxy container of the istio-ingressgateway and unmounts it on removal", func() {
+		before := getGateway("istio-ingressgateway", "istio-system").Spec.Template
+		selectGateway("istio-system", "istio-ingressgateway")
+
+		Expect(provider.ApplyFilter(filter)).NotTo(HaveOccurred())
+
+		template := getGateway("istio-ingressgateway", "istio-system").Spec.Template
+		Expect(template.Annotations).NotTo(HaveKey("sidecar.istio.io/userVolume"))
+		Expect(template.Annotations).NotTo(HaveKey("sidecar.istio.io/userVolumeMount"))
+		Expect(template.Annotations).To(HaveKey(istio.GatewayVolumesAnnotation))
+		Expect(template.Spec.Volumes).To(ConsistOf(before.Spec.Volumes[0], kubev1.Volume{
+			Name: "cache-dir",
+			VolumeSource: kubev1.VolumeSource{
+				HostPath: &kubev1.HostPathVolumeSource{Path: "/var/local/lib/wasme-cache"},
+			},
+		}))
+		Expect(template.Spec.Containers[0].VolumeMounts).To(ConsistOf(before.Spec.Containers[0].VolumeMounts[0], kubev1.VolumeMount{
+			Name:      "cache-dir",
+			MountPath: "/var/local/lib/wasme-cache",
+		}))
+		Expect(envoyFilters).To(HaveLen(1))
+
+		// reapplying the filter does not mount the cache twice
+		Expect(provider.ApplyFilter(filter)).NotTo(HaveOccurred())
+		Expect(getGateway("istio-ingressgateway", "istio-system").Spec.Template.Spec.Volumes).To(HaveLen(2))
+
+		Expect(provider.RemoveFilter(filter)).NotTo(HaveOccurred())
+		after := getGateway("istio-ingressgateway", "istio-system").Spec.Template
+		Expect(after.Spec).To(Equal(before.Spec))
+		Expect(after.Annotations).NotTo(HaveKey(istio.GatewayVolumesAnnotation))
+		Expect(after.Annotations).NotTo(HaveKey(istio.AppliedFiltersAnnotation))
+		Expect(envoyFilters).To(BeEmpty())
+	})
+
+	It("mounts the cache volume claim on custom gateways in user namespaces, keeping their volumes", func() {
+		gateway := getGateway("custom-gateway", "gateways")
+		// the gateway already mounts the cache volume claim, which is kept on removal
+		gateway.Spec.Template.Spec.Volumes = append(gateway.Spec.Template.Spec.Volumes, kubev1.Volume{
+			Name: "cache-pvc",
+			VolumeSource: kubev1.VolumeSource{
+				PersistentVolumeClaim: &kubev1.PersistentVolumeClaimVolumeSource{ClaimName: "wasme-cache", ReadOnly: true},
+			},
+		})
+		_, err := kube.AppsV1().Deployments("gateways").Update(gateway)
+		Expect(err).NotTo(HaveOccurred())
+		before := gateway.Spec.Template
+
+		selectGateway("gateways", "custom-gateway")
+		provider.Cache.PersistentVolumeClaim = "wasme-cache"
+		Expect(provider.ApplyFilter(filter)).NotTo(HaveOccurred())
+
+		template := getGateway("custom-gateway", "gateways").Spec.Template
+		Expect(template.Spec.Volumes).To(Equal(before.Spec.Volumes))
+		Expect(template.Spec.Containers[0].VolumeMounts).To(ConsistOf(before.Spec.Containers[0].VolumeMounts[0], kubev1.VolumeMount{
+			Name:      "cache-pvc",
+			MountPath: "/var/local/lib/wasme-cache",
+			ReadOnly:  true,
+		}))
+		Expect(template.Annotations[istio.GatewayVolumesAnnotation]).To(MatchJSON(`{"volumeMounts":[{"name":"cache-pvc","readOnly":true,"mountPath":"/var/local/lib/wasme-cache"}]}`))
+
+		Expect(provider.RemoveFilter(filter)).NotTo(HaveOccurred())
+		Expect(getGateway("custom-gateway", "gateways").Spec.Template.Spec).To(Equal(before.Spec))
+	})
+
+	It("rolls back the gateway volumes when the cache cannot be mounted on every gateway", func() {
+		aGateway := makeGateway("a-gateway", "gateways")
+		_, err := kube.AppsV1().Deployments("gateways").Create(aGateway)
+		Expect(err).NotTo(HaveOccurred())
+		// custom-gateway, updated after a-gateway, already mounts another volume at the cache directory
+		gateway := getGateway("custom-gateway", "gateways")
+		gateway.Spec.Template.Spec.Containers[0].VolumeMounts = append(gateway.Spec.Template.Spec.Containers[0].VolumeMounts, kubev1.VolumeMount{
+			Name:      "istio-envoy",
+			MountPath: "/var/local/lib/wasme-cache",
+		})
+		_, err = kube.AppsV1().Deployments("gateways").Update(gateway)
+		Expect(err).NotTo(HaveOccurred())
+
+		selectGateway("gateways", "")
+		provider.AtomicApply = true
+		err = provider.ApplyFilter(filter)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("container istio-proxy of workload custom-gateway already mounts volume istio-envoy at /var/local/lib/wasme-cache"))
+
+		Expect(getGateway("a-gateway", "gateways").Spec.Template.Spec).To(Equal(aGateway.Spec.Template.Spec))
+		Expect(getGateway("a-gateway", "gateways").Spec.Template.Annotations).NotTo(HaveKey(istio.GatewayVolumesAnnotation))
+	})
+
+	It("mounts the cache with the sidecar annotations for other patch contexts", func() {
+		selectGateway("gateways", "custom-gateway")
+		filter.PatchContext = istio.PatchContextInbound
+		Expect(provider.ApplyFilter(filter)).NotTo(HaveOccurred())
+
+		template := getGateway("custom-gateway", "gateways").Spec.Template
+		Expect(template.Annotations).To(HaveKey("sidecar.istio.io/userVolume"))
+		Expect(template.Annotations).NotTo(HaveKey(istio.GatewayVolumesAnnotation))
+		Expect(template.Spec.Volumes).To(HaveLen(1))
+	})
+})
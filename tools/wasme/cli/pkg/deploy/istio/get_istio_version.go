@@ -1,9 +1,14 @@
 package istio
 
 import (
+	"sort"
+	"strings"
+
 	"github.com/pkg/errors"
 	"github.com/solo-io/wasm/tools/wasme/pkg/util"
+	appsv1 "k8s.io/api/apps/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -11,15 +16,48 @@ const (
 	pilotDeploymentName   = "istiod"
 	defaultIstioNamespace = "istio-system"
 	pilotContainerName    = "discovery"
+
+	// label set on istiod deployments and on namespaces pinned to a control plane revision
+	istioRevisionLabel = "istio.io/rev"
+	// label set on namespaces using the default control plane
+	istioInjectionLabel = "istio-injection"
+	// the revision of a control plane installed without --revision
+	defaultIstioRevision = "default"
 )
 
 type VersionInspector interface {
 	GetIstioVersion() (string, error)
 }
 
+// StaticVersionInspector returns the inspector of an istio version known in advance,
+// e.g. to render the resources of a filter without reading the cluster
+func StaticVersionInspector(istioVersion string) VersionInspector {
+	return staticVersionInspector(istioVersion)
+}
+
+type staticVersionInspector string
+
+func (i staticVersionInspector) GetIstioVersion() (string, error) {
+	return string(i), nil
+}
+
 type versionInspector struct {
 	istioNamespace string
-	kube           kubernetes.Interface
+	// if set, inspect the istiod deployment with this revision
+	istioRevision string
+	// namespace of the target workloads, used to pick a revision
+	// if more than one istiod is installed
+	targetNamespace string
+	kube            kubernetes.Interface
+}
+
+func NewVersionInspector(kube kubernetes.Interface, istioNamespace, istioRevision, targetNamespace string) VersionInspector {
+	return &versionInspector{
+		istioNamespace:  istioNamespace,
+		istioRevision:   istioRevision,
+		targetNamespace: targetNamespace,
+		kube:            kube,
+	}
 }
 
 func (i *versionInspector) GetIstioVersion() (string, error) {
@@ -27,8 +65,11 @@ func (i *versionInspector) GetIstioVersion() (string, error) {
 	if istioNamespace == "" {
 		istioNamespace = defaultIstioNamespace
 	}
-	pilotDeployment, err := i.kube.AppsV1().Deployments(istioNamespace).Get(pilotDeploymentName, metav1.GetOptions{})
+	pilotDeployment, err := i.getPilotDeployment(istioNamespace)
 	if err != nil {
+		return "", err
+	}
+	if pilotDeployment == nil {
 		return "", nil
 	}
 	var pilotImage string
@@ -46,3 +87,89 @@ func (i *versionInspector) GetIstioVersion() (string, error) {
 
 	return tag, err
 }
+
+// selects the istiod deployment for the configured revision.
+// if no revision is configured and multiple revisions are installed,
+// the revision is read from the labels on the target namespace.
+func (i *versionInspector) getPilotDeployment(istioNamespace string) (*appsv1.Deployment, error) {
+	revisions, err := i.listPilotRevisions(istioNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	revision := i.istioRevision
+	if revision == "" {
+		switch len(revisions) {
+		case 0:
+			// fall back to looking up istiod by name
+			pilotDeployment, err := i.kube.AppsV1().Deployments(istioNamespace).Get(pilotDeploymentName, metav1.GetOptions{})
+			if err != nil {
+				return nil, nil
+			}
+			return pilotDeployment, nil
+		case 1:
+			for _, pilotDeployment := range revisions {
+				return pilotDeployment, nil
+			}
+		}
+		revision, err = i.getNamespaceRevision()
+		if err != nil {
+			return nil, err
+		}
+		if revision == "" {
+			return nil, errors.Errorf("found multiple istiod revisions in namespace %v (%v), use --istio-revision to select one", istioNamespace, strings.Join(sortedRevisions(revisions), ", "))
+		}
+	}
+
+	pilotDeployment, ok := revisions[revision]
+	if !ok {
+		return nil, errors.Errorf("did not find istiod with revision %v in namespace %v, found revisions: %v", revision, istioNamespace, strings.Join(sortedRevisions(revisions), ", "))
+	}
+	return pilotDeployment, nil
+}
+
+// returns the istiod deployments in the istio namespace, keyed by revision
+func (i *versionInspector) listPilotRevisions(istioNamespace string) (map[string]*appsv1.Deployment, error) {
+	pilotDeployments, err := i.kube.AppsV1().Deployments(istioNamespace).List(metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(map[string]string{"app": pilotDeploymentName}).String(),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "listing istiod deployments in namespace %v", istioNamespace)
+	}
+	revisions := map[string]*appsv1.Deployment{}
+	for idx, pilotDeployment := range pilotDeployments.Items {
+		revision := pilotDeployment.Labels[istioRevisionLabel]
+		if revision == "" {
+			revision = defaultIstioRevision
+		}
+		revisions[revision] = &pilotDeployments.Items[idx]
+	}
+	return revisions, nil
+}
+
+// returns the revision the target namespace is injected with, or empty string if unknown
+func (i *versionInspector) getNamespaceRevision() (string, error) {
+	if i.targetNamespace == "" {
+		return "", nil
+	}
+	ns, err := i.kube.CoreV1().Namespaces().Get(i.targetNamespace, metav1.GetOptions{})
+	if err != nil {
+		return "", errors.Wrapf(err, "getting namespace %v", i.targetNamespace)
+	}
+	if revision := ns.Labels[istioRevisionLabel]; revision != "" {
+		return revision, nil
+	}
+	if ns.Labels[istioInjectionLabel] == "enabled" {
+		return defaultIstioRevision, nil
+	}
+	return "", nil
+}
+
+func sortedRevisions(revisions map[string]*appsv1.Deployment) []string {
+	var names []string
+	for revision := range revisions {
+		names = append(names, revision)
+	}
+	sort.Strings(names)
+	return names
+}
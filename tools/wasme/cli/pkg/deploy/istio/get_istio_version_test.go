@@ -0,0 +1,202 @@
+package istio_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	mock_ezkube "github.com/solo-io/skv2/pkg/ezkube/mocks"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/abi"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	kubev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("VersionInspector", func() {
+	var (
+		kube kubernetes.Interface
+	)
+
+	makeIstiod := func(name, revision, tag string) *appsv1.Deployment {
+		labels := map[string]string{"app": "istiod"}
+		if revision != "" {
+			labels["istio.io/rev"] = revision
+		}
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "istio-system",
+				Labels:    labels,
+			},
+			Spec: appsv1.DeploymentSpec{
+				Template: kubev1.PodTemplateSpec{
+					Spec: kubev1.PodSpec{
+						Containers: []kubev1.Container{{
+							Name:  "discovery",
+							Image: "docker.io/istio/pilot:" + tag,
+						}},
+					},
+				},
+			},
+		}
+	}
+
+	makeNamespace := func(name string, labels map[string]string) *kubev1.Namespace {
+		return &kubev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: labels,
+			},
+		}
+	}
+
+	Context("a single control plane", func() {
+		BeforeEach(func() {
+			kube = fake.NewSimpleClientset(makeIstiod("istiod", "", "1.7.3"))
+		})
+		It("returns the istiod version", func() {
+			version, err := istio.NewVersionInspector(kube, "", "", "default").GetIstioVersion()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(version).To(Equal("1.7.3"))
+		})
+	})
+
+	Context("multiple revisions", func() {
+		BeforeEach(func() {
+			kube = fake.NewSimpleClientset(
+				makeIstiod("istiod-1-16", "1-16", "1.16.2"),
+				makeIstiod("istiod-1-17", "1-17", "1.17.1"),
+				makeNamespace("pinned", map[string]string{"istio.io/rev": "1-17"}),
+				makeNamespace("unlabeled", nil),
+			)
+		})
+		It("selects the istiod with the given revision", func() {
+			version, err := istio.NewVersionInspector(kube, "istio-system", "1-16", "pinned").GetIstioVersion()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(version).To(Equal("1.16.2"))
+		})
+		It("selects the revision referenced by the target namespace", func() {
+			version, err := istio.NewVersionInspector(kube, "istio-system", "", "pinned").GetIstioVersion()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(version).To(Equal("1.17.1"))
+		})
+		It("errors with the detected revisions when the revision cannot be determined", func() {
+			_, err := istio.NewVersionInspector(kube, "istio-system", "", "unlabeled").GetIstioVersion()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("1-16, 1-17"))
+		})
+		It("errors when the given revision is not installed", func() {
+			_, err := istio.NewVersionInspector(kube, "istio-system", "1-18", "pinned").GetIstioVersion()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("did not find istiod with revision 1-18"))
+		})
+	})
+})
+
+var _ = Describe("Provider istio version lookup", func() {
+	var (
+		inspector *countingInspector
+		provider  *istio.Provider
+		filter    = &wasmev1.FilterSpec{
+			Id:     "filter-id",
+			Image:  "filter/image:v1",
+			RootID: "root_id",
+		}
+	)
+
+	BeforeEach(func() {
+		kube := fake.NewSimpleClientset(
+			makeInjectedNamespace("default"),
+			&kubev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "wasme-cache",
+					Namespace: "wasme",
+				},
+			},
+			makeDeployment("work-1", "default", nil),
+			makeDeployment("work-2", "default", nil),
+			makeDeployment("work-3", "default", nil),
+		)
+		client := mock_ezkube.NewMockEnsurer(gomock.NewController(GinkgoT()))
+		client.EXPECT().Ensure(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+
+		inspector = &countingInspector{version: "1.7.3"}
+		provider = &istio.Provider{
+			Ctx:        context.TODO(),
+			KubeClient: kube,
+			Client:     client,
+			Puller: &mockPuller{
+				image: mockImage{ref: filter.Image, digest: "sha256:e454cab754cf9234e8b41d7c5e30f53a4c125d7d9443cb3ef2b2eb1c4bd1ec14"},
+			},
+			Workload: istio.Workload{
+				Namespace: "default",
+				Kind:      istio.WorkloadTypeDeployment,
+			},
+			Cache: istio.Cache{
+				Name:      "wasme-cache",
+				Namespace: "wasme",
+			},
+			VersionInspector: inspector,
+		}
+	})
+
+	It("looks up the istio version once per ApplyFilter", func() {
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inspector.calls).To(Equal(1))
+
+		err = provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inspector.calls).To(Equal(2))
+	})
+
+	It("skips the abi check only for filters which ignore it", func() {
+		// supported by istio 1.5 only
+		provider.Puller = &mockPuller{
+			image: mockImage{
+				ref:         filter.Image,
+				digest:      "sha256:e454cab754cf9234e8b41d7c5e30f53a4c125d7d9443cb3ef2b2eb1c4bd1ec14",
+				abiVersions: []string{abi.Version_097b7f2e4cc1fb490cc1943d0d633655ac3c522f.Name},
+			},
+		}
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("not supported by istio version 1.7.3"))
+
+		err = provider.ApplyFilter(&wasmev1.FilterSpec{
+			Id:             "experimental-filter",
+			Image:          filter.Image,
+			RootID:         "root_id",
+			IgnoreAbiCheck: true,
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("reuses the istio version across calls within the ttl", func() {
+		provider.IstioVersionTTL = time.Hour
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inspector.calls).To(Equal(1))
+	})
+})
+
+type countingInspector struct {
+	version string
+	calls   int
+}
+
+func (i *countingInspector) GetIstioVersion() (string, error) {
+	i.calls++
+	return i.version, nil
+}
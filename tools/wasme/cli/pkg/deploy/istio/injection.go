@@ -0,0 +1,73 @@
+package istio
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// set on the pod template to enable or disable sidecar injection for the workload
+	sidecarInjectAnnotation = "sidecar.istio.io/inject"
+	// the name of the sidecar container, also used by the Istio gateways
+	istioProxyContainer = "istio-proxy"
+)
+
+// UninjectedWorkloadError is passed to the OnWorkload callback for the workloads
+// which were skipped because they do not run the Istio sidecar, so the filter could never take effect.
+// it is not returned by ApplyFilter
+type UninjectedWorkloadError struct {
+	Workload  string
+	Namespace string
+}
+
+func (e *UninjectedWorkloadError) Error() string {
+	return fmt.Sprintf("skipped workload %v: the istio sidecar is not injected into its pods. "+
+		"label namespace %v with %v=enabled or set the %v annotation on the pod template to apply the filter",
+		e.Workload, e.Namespace, istioInjectionLabel, sidecarInjectAnnotation)
+}
+
+// IsUninjectedWorkload returns true if the workload was skipped because it does not run the Istio sidecar
+func IsUninjectedWorkload(err error) bool {
+	_, ok := err.(*UninjectedWorkloadError)
+	return ok
+}
+
+// returns the labels of the target namespace which enable sidecar injection
+func (p *Provider) getNamespaceLabels() (map[string]string, error) {
+	ns, err := p.KubeClient.CoreV1().Namespaces().Get(p.Workload.Namespace, metav1.GetOptions{})
+	if err != nil {
+		if kubeerrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "getting namespace %v", p.Workload.Namespace)
+	}
+	return ns.Labels, nil
+}
+
+// returns true if the pods of the workload run the Istio sidecar, given the labels of its namespace.
+// pods which already contain the sidecar, such as the Istio gateways, are always injected
+func sidecarInjected(namespaceLabels map[string]string, template *corev1.PodTemplateSpec) bool {
+	for _, container := range template.Spec.Containers {
+		if container.Name == istioProxyContainer {
+			return true
+		}
+	}
+	switch template.Annotations[sidecarInjectAnnotation] {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	switch namespaceLabels[istioInjectionLabel] {
+	case "enabled":
+		return true
+	case "disabled":
+		return false
+	}
+	_, revisioned := namespaceLabels[istioRevisionLabel]
+	return revisioned
+}
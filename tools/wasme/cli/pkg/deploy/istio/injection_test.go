@@ -0,0 +1,108 @@
+package istio_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	istiov1alpha3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	appsv1 "k8s.io/api/apps/v1"
+	kubev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+var _ = Describe("Sidecar injection", func() {
+	var (
+		namespace    *kubev1.Namespace
+		workloads    []*appsv1.Deployment
+		envoyFilters map[string]*istiov1alpha3.EnvoyFilter
+		// the error passed to OnWorkload for each workload
+		results map[string]error
+		// sets IncludeUninjected on the provider
+		includeUninjected bool
+		filter            = &wasmev1.FilterSpec{
+			Id:     "filter-id",
+			Image:  "filter/image:v1",
+			RootID: "root_id",
+		}
+	)
+
+	BeforeEach(func() {
+		namespace = &kubev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}}
+
+		gateway := makeDeployment("gateway", "default", nil)
+		gateway.Spec.Template.Spec.Containers[0].Name = "istio-proxy"
+		workloads = []*appsv1.Deployment{
+			makeDeployment("plain", "default", nil),
+			makeDeployment("opted-in", "default", map[string]string{"sidecar.istio.io/inject": "true"}),
+			makeDeployment("opted-out", "default", map[string]string{"sidecar.istio.io/inject": "false"}),
+			gateway,
+		}
+		results = map[string]error{}
+		includeUninjected = false
+	})
+
+	// applies the filter to the workloads in the namespace
+	apply := func() {
+		objs := []runtime.Object{namespace}
+		for _, workload := range workloads {
+			objs = append(objs, workload)
+		}
+		provider := newTestProvider(objs...)
+		envoyFilters = provider.envoyFilters
+		provider.IncludeUninjected = includeUninjected
+		provider.OnWorkload = func(workloadMeta metav1.ObjectMeta, err error) {
+			results[workloadMeta.Name] = err
+		}
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	expectSkipped := func(skipped ...string) {
+		isSkipped := map[string]bool{}
+		for _, name := range skipped {
+			isSkipped[name] = true
+			Expect(istio.IsUninjectedWorkload(results[name])).To(BeTrue(), name)
+			Expect(envoyFilters).NotTo(HaveKey(istio.EnvoyFilterName(name, filter.Id)))
+		}
+		Expect(results).To(HaveLen(len(workloads)))
+		for name, err := range results {
+			if !isSkipped[name] {
+				Expect(err).NotTo(HaveOccurred(), name)
+				Expect(envoyFilters).To(HaveKey(istio.EnvoyFilterName(name, filter.Id)))
+			}
+		}
+	}
+
+	It("skips the workloads which do not run the sidecar", func() {
+		apply()
+		expectSkipped("plain", "opted-out")
+		Expect(results["plain"].Error()).To(ContainSubstring("skipped workload plain: the istio sidecar is not injected"))
+	})
+
+	It("applies the filter to the workloads of injected namespaces", func() {
+		namespace.Labels = map[string]string{"istio-injection": "enabled"}
+		apply()
+		expectSkipped("opted-out")
+	})
+
+	It("applies the filter to the workloads of namespaces injected by a revision", func() {
+		namespace.Labels = map[string]string{"istio.io/rev": "canary"}
+		apply()
+		expectSkipped("opted-out")
+	})
+
+	It("skips the workloads of namespaces with injection disabled", func() {
+		namespace.Labels = map[string]string{"istio-injection": "disabled", "istio.io/rev": "canary"}
+		apply()
+		expectSkipped("plain", "opted-out")
+	})
+
+	It("applies the filter to every workload if IncludeUninjected is set", func() {
+		includeUninjected = true
+		apply()
+		expectSkipped()
+	})
+})
@@ -2,43 +2,85 @@ package istio
 
 import (
 	"context"
+	"crypto/md5"
 	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/opencontainers/go-digest"
+	corev3 "github.com/solo-io/gloo/projects/gloo/pkg/api/external/envoy/config/core/v3"
 	"github.com/solo-io/skv2/pkg/ezkube"
+	"github.com/solo-io/solo-kit/pkg/api/external/envoy/api/v2/core"
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/abi"
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cache"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy"
 	envoyfilter "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/filter"
 	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
 	pkgcache "github.com/solo-io/wasm/tools/wasme/pkg/cache"
 	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
+	"github.com/solo-io/wasm/tools/wasme/pkg/signature"
 	"github.com/solo-io/wasm/tools/wasme/pkg/util"
 
 	"github.com/solo-io/gloo/pkg/utils/protoutils"
 
-	envoyhttp "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	"github.com/golang/protobuf/proto"
 	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
 	networkingv1alpha3 "istio.io/api/networking/v1alpha3"
 	"istio.io/client-go/pkg/apis/networking/v1alpha3"
 	corev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 const (
 	WorkloadTypeDaemonSet   = "daemonset"
 	WorkloadTypeDeployment  = "deployment"
 	WorkloadTypeStatefulSet = "statefulset"
-	backupAnnotationPrefix  = "wasme-backup."
-	PatchContextAny         = "any"
-	PatchContextInbound     = "inbound"
-	PatchContextOutbound    = "outbound"
-	PatchContextGateway     = "gateway"
+	// an OpenShift DeploymentConfig, requires Provider.DynamicClient
+	WorkloadTypeDeploymentConfig = "deploymentconfig"
+	backupAnnotationPrefix       = "wasme-backup."
+	PatchContextAny              = "any"
+	PatchContextInbound          = "inbound"
+	PatchContextOutbound         = "outbound"
+	PatchContextGateway          = "gateway"
+	FilterTypeHttp               = "http"
+	FilterTypeNetwork            = "network"
+
+	defaultCachePollInterval = time.Second
+	maxCachePollInterval     = 10 * time.Second
+	// the maximum fraction of the poll interval added to each wait for the cache
+	cachePollJitter = 0.2
+	// cache events created up to this long before the image was added to the cache are matched,
+	// as event timestamps are set by the clock of the cache or the API server
+	cacheEventClockSkew = 5 * time.Second
+	// the number of cache events read per request while waiting for the cache
+	cacheEventsPageSize = 500
+
+	// set on workloads while the sidecar annotations written by wasme are applied,
+	// so that wasme's own values are never backed up
+	appliedAnnotation = "wasme-applied"
+
+	// set on the EnvoyFilters created by wasme, truncated like the EnvoyFilter name if too long
+	FilterIdLabel = "wasme.io/filter-id"
+	WorkloadLabel = "wasme.io/workload"
+	// set on the EnvoyFilters created by wasme to a hash of the image ref, as refs are not valid label values.
+	// the ref itself is set as an annotation with the same key
+	ImageLabel = "wasme.io/image"
 )
 
 var SupportedPatchContexts = []string{
@@ -48,10 +90,16 @@ var SupportedPatchContexts = []string{
 	PatchContextGateway,
 }
 
+var SupportedFilterTypes = []string{
+	FilterTypeHttp,
+	FilterTypeNetwork,
+}
+
 // the target workload to deploy the filter to
 // can select all workloads in a namespace
 type Workload struct {
-	// leave name empty to select ALL workloads in the namespace
+	// leave name empty to select ALL workloads with the labels in the namespace
+	Name      string
 	Labels    map[string]string
 	Namespace string
 	Kind      string
@@ -62,6 +110,13 @@ type Workload struct {
 type Cache struct {
 	Name      string
 	Namespace string
+	// the kind of workload running the cache, one of daemonset or deployment.
+	// if empty, wasme will look for a daemonset and fall back to a deployment
+	Kind string
+	// the name of a ReadWriteMany PersistentVolumeClaim storing the cache directory.
+	// the claim must exist in the namespace of each workload, bound to the same shared storage as the cache.
+	// if empty, the cache directory is mounted from the host
+	PersistentVolumeClaim string
 }
 
 type Provider struct {
@@ -69,6 +124,10 @@ type Provider struct {
 	KubeClient kubernetes.Interface
 	Client     ezkube.Ensurer
 
+	// used to read OpenShift DeploymentConfigs,
+	// only required for WorkloadTypeDeploymentConfig
+	DynamicClient dynamic.Interface
+
 	// pulls the image descriptor so we can get the
 	// name of the file created by the cache
 	Puller pull.ImagePuller
@@ -85,27 +144,162 @@ type Provider struct {
 
 	// Callback to the caller when for when the istio provider
 	// updates a workload.
-	// err != nil in the case that update failed
+	// err != nil in the case that update failed.
+	// if WaitForRolloutTimeout is set, called once the workload has rolled out
 	OnWorkload func(workloadMeta metav1.ObjectMeta, err error)
 
+	// optional, called by ApplyFilter with the selected workloads, in the order the filter is applied to them,
+	// before any workload is updated. OnWorkload is then called for each workload the filter was applied to.
+	// the workloads after a failed workload are not passed to OnWorkload
+	OnWorkloadsSelected func(workloadMetas []metav1.ObjectMeta)
+
+	// optional, called by ApplyFilter with a description of each drift it corrected: the sidecar annotations
+	// of a workload the filter was already applied to were modified, or its EnvoyFilter was deleted or modified
+	OnDrift func(drift string)
+
+	// optional, called by ApplyFilter with each workload whose filter was updated without updating the workload,
+	// with the hash of the filter spec: only the config or image digest of the filter changed since it was applied,
+	// so only its EnvoyFilter was updated, and the pods of the workload were not restarted
+	OnConfigUpdated func(workloadMeta metav1.ObjectMeta, configHash string)
+
 	// namespace of the istio control plane
 	// Provider will use this to determine the installed version of istio
 	// for abi compatibility
 	// defaults to istio-system
 	IstioNamespace string
 
+	// revision of the istio control plane, matched against the istio.io/rev label on istiod.
+	// if empty and multiple revisions are installed, the revision is read
+	// from the labels on the target namespace
+	IstioRevision string
+
 	// if set to true, will attempt to deploy wasm filters
 	// to Istio even if the version check doesn't match known
 	// compatible versions for that filter.
+	// individual filters can skip the check with FilterSpec.IgnoreAbiCheck
+	IgnoreVersionCheck bool
+
+	// Deprecated: use IgnoreVersionCheck
 	IngoreVersionCheck bool
 
+	// the ABI versions compatible with each version of Istio.
+	// defaults to abi.DefaultRegistry
+	AbiRegistry abi.Registry
+
+	// by default, generated EnvoyFilters only match proxies running a version of Istio
+	// compatible with the ABI versions of the filter image.
+	// if set to true, EnvoyFilters match proxies of any version
+	DisableProxyVersionMatch bool
+
+	// if set to true, a single EnvoyFilter without a workload selector is created in the
+	// IstioNamespace (the Istio root namespace), applying the filter to every proxy in the mesh.
+	// the selected workloads are still annotated to mount the filter cache;
+	// proxies which do not mount the cache will reject the filter.
+	MeshWide bool
+
+	// if set to true, the proxies fetch the filters from the cache service over HTTP,
+	// and reject them unless they match the digest of the image.
+	// the workloads are not annotated to mount the cache directory, so no hostPath volumes are required,
+	// and MeshWide filters take effect on every proxy.
+	// requires the cache service, which is created with the cache
+	RemoteDatasource bool
+
+	// if set, used verbatim as the workload selector of the EnvoyFilter of every selected workload,
+	// so it should only match the pods of a single workload.
+	// by default, the labels of the pod template of each workload are used,
+	// without the labels added by controllers which change between rollouts, such as pod-template-hash
+	SelectorLabels map[string]string
+
+	// the order in which filters are applied to the selected workloads.
+	// filters are removed in the reverse order.
+	// defaults to OrderByName
+	WorkloadOrdering WorkloadOrdering
+
+	// if set to true, the tag of the filter image is pinned to the digest it resolved to when the filter is applied:
+	// the cache pulls the image by its digest, and the pinned ref is recorded on the workloads,
+	// so every node loads the module which passed the ABI check even if the tag is moved.
+	// images referenced by digest are always pulled by their digest
+	PinDigest bool
+
+	// if set, the cosign signature attached to the filter image must be valid for the digest of its manifest,
+	// otherwise the filter is not applied. the image is verified before it is added to the cache.
+	// the signatures are pulled with the Puller
+	VerifyOptions *signature.VerifyOptions
+
 	// if non-zero, wait for cache events to be populated with this timeout before
 	// creating istio EnvoyFilters.
 	// set to zero to skip the check
 	WaitForCacheTimeout time.Duration
+
+	// the interval between checks of the cache events while waiting for the cache.
+	// doubled after each check, up to maxCachePollInterval, and jittered
+	// so concurrent waits do not poll the API server in bursts.
+	// defaults to one second
+	CachePollInterval time.Duration
+
+	// used to wait for the cache, defaults to the real clock
+	Clock clock.Clock
+
+	// if true, the cache events for the image are left in place after waiting for the cache,
+	// e.g. to keep an audit trail of the images pulled by the cache.
+	// by default, the events are deleted once the cache has pulled the image
+	KeepCacheEvents bool
+
+	// if non-zero, wait with this timeout for each updated workload to finish
+	// restarting its pods with the updated annotations before moving on to the next workload.
+	// set to zero to return as soon as the workloads are updated
+	WaitForRolloutTimeout time.Duration
+
+	// if set, an Event is recorded on each workload the filter is applied to or removed from
+	Recorder record.EventRecorder
+
+	// if set to true, ApplyFilter undoes the changes it made to the cluster, in the reverse order,
+	// if the filter cannot be applied to every selected workload: the workload annotations,
+	// the created or updated EnvoyFilters, the workload snapshots and the image added to the cache config.
+	// RemoveFilter restores the annotations of the workloads the filter was removed from
+	// if it cannot be removed from every selected workload.
+	// if any changes were rolled back, the returned error is a *RollbackError
+	AtomicApply bool
+
+	// optional, records the duration and outcome of the operations of the provider
+	Metrics *Metrics
+
+	// if true, RemoveFilter deletes the EnvoyFilters of the filter even if they are owned by the ParentObject,
+	// and removes the images the filter was applied with from the cache config once no EnvoyFilter in the cluster uses them.
+	// set when the ParentObject is finalized, as its EnvoyFilters are only garbage collected once it is deleted.
+	// images are only removed if the filter is recorded on a selected workload, as their cached file is unknown otherwise
+	PruneCache bool
+
+	// by default, workloads which do not run the Istio sidecar are skipped when applying the filter,
+	// and passed to OnWorkload with an *UninjectedWorkloadError.
+	// if set to true, the filter is applied to every selected workload
+	IncludeUninjected bool
+
+	// the logger of the provider.
+	// defaults to the global logrus logger
+	Logger Logger
+
+	// detects the installed version of istio.
+	// if nil, one is created from the IstioNamespace, IstioRevision and target namespace
+	VersionInspector VersionInspector
+
+	// if non-zero, the detected istio version is reused across calls to
+	// ApplyFilter and RemoveFilter until it is older than this duration.
+	// if zero, the istio version is detected at most once per call
+	IstioVersionTTL time.Duration
+
+	// if set, ApplyFilter writes the resources it would create or update to DryRunOutput as YAML,
+	// rather than applying the filter: see renderFilter.
+	// the cluster is not read, except by the VersionInspector
+	DryRunOutput io.Writer
+
+	// memoized result of the istio version lookup
+	istioVersionLock      sync.Mutex
+	istioVersion          *string
+	istioVersionFetchedAt time.Time
 }
 
-func NewProvider(ctx context.Context, kubeClient kubernetes.Interface, client ezkube.Ensurer, puller pull.ImagePuller, workload Workload, cache Cache, parentObject ezkube.Object, onWorkload func(workloadMeta metav1.ObjectMeta, err error), istioNamespace string, cacheTimeout time.Duration, ignoreVersionCheck bool) (*Provider, error) {
+func NewProvider(ctx context.Context, kubeClient kubernetes.Interface, client ezkube.Ensurer, puller pull.ImagePuller, workload Workload, cache Cache, parentObject ezkube.Object, onWorkload func(workloadMeta metav1.ObjectMeta, err error), istioNamespace, istioRevision string, cacheTimeout time.Duration, ignoreVersionCheck bool) (*Provider, error) {
 
 	// ensure istio types are added to scheme
 	if err := v1alpha3.AddToScheme(client.Manager().GetScheme()); err != nil {
@@ -122,88 +316,342 @@ func NewProvider(ctx context.Context, kubeClient kubernetes.Interface, client ez
 		ParentObject:        parentObject,
 		OnWorkload:          onWorkload,
 		IstioNamespace:      istioNamespace,
+		IstioRevision:       istioRevision,
 		WaitForCacheTimeout: cacheTimeout,
-		IngoreVersionCheck:  ignoreVersionCheck,
+		IgnoreVersionCheck:  ignoreVersionCheck,
 	}, nil
 }
 
-// the sidecar annotations required on the pod
-func requiredSidecarAnnotations() map[string]string {
+// the keys of the sidecar annotations written by wasme
+var sidecarAnnotationKeys = []string{
+	"sidecar.istio.io/userVolume",
+	"sidecar.istio.io/userVolumeMount",
+}
+
+// the sidecar annotations required on the workloads, none if the proxies fetch the filters from the cache service
+func (p *Provider) sidecarAnnotations() map[string]string {
+	if p.RemoteDatasource {
+		return nil
+	}
+	return requiredSidecarAnnotations(p.Cache)
+}
+
+// the sidecar annotations required on the pod to mount the cache directory.
+// the volume is named after the storage of the cache, so switching the storage replaces the volume
+func requiredSidecarAnnotations(cache Cache) map[string]string {
+	if cache.PersistentVolumeClaim != "" {
+		claim, _ := json.Marshal(cache.PersistentVolumeClaim)
+		return map[string]string{
+			"sidecar.istio.io/userVolume":      `[{"name":"cache-pvc","persistentVolumeClaim":{"claimName":` + string(claim) + `,"readOnly":true}}]`,
+			"sidecar.istio.io/userVolumeMount": `[{"mountPath":"/var/local/lib/wasme-cache","name":"cache-pvc","readOnly":true}]`,
+		}
+	}
 	return map[string]string{
 		"sidecar.istio.io/userVolume":      `[{"name":"cache-dir","hostPath":{"path":"/var/local/lib/wasme-cache"}}]`,
 		"sidecar.istio.io/userVolumeMount": `[{"mountPath":"/var/local/lib/wasme-cache","name":"cache-dir"}]`,
 	}
 }
 
-// applies the filter to all selected workloads and updates the image cache configmap
+// applies the filter to all selected workloads and updates the image cache configmap.
+// if AtomicApply is set, the changes are rolled back if the filter cannot be applied to every workload
 func (p *Provider) ApplyFilter(filter *v1.FilterSpec) error {
+	_, err := p.ApplyResolvedFilter(filter)
+	return err
+}
 
+// ApplyResolvedFilter implements deploy.ConfigResolver: the config of the filter is read from its ConfigFrom,
+// or defaulted to the config of the image, before the checksum is injected
+func (p *Provider) ApplyResolvedFilter(filter *v1.FilterSpec) (string, error) {
+	p.expireIstioVersion()
+	if p.DryRunOutput != nil {
+		return "", p.renderFilter(filter)
+	}
+
+	var tx *transaction
+	if p.AtomicApply {
+		tx = &transaction{logger: p.logger()}
+	}
+	configChecksum, err := p.applyFilter(tx, filter)
+	if err != nil {
+		err = tx.rollback(err)
+	}
+	p.Metrics.observeOperation(operationApply, p.Workload, err)
+	p.updateManagedEnvoyFilters()
+	return configChecksum, err
+}
+
+// the filter prepared for deployment by prepareFilter
+type preparedFilter struct {
+	// the filter with the config read from ConfigFrom, or the default config of the image
+	configured *v1.FilterSpec
+	// the variant of the image supported by the istio version
+	image pull.Image
+	// recorded on the workloads, so unchanged workloads are not updated again
+	state AppliedFilter
+	// the ref the cache pulls the image by
+	cachedImage string
+	// the proxy versions matched by the created EnvoyFilters, empty matches all proxies
+	proxyVersion string
+}
+
+// validates the filter and pulls its image, checking the image is compatible with the istio version.
+// the cluster is only read, to resolve ConfigFrom and detect the istio version
+func (p *Provider) prepareFilter(filter *v1.FilterSpec) (*preparedFilter, error) {
+	// reject invalid filters before the cluster is modified
+	if err := Validate(filter); err != nil {
+		return nil, err
+	}
+	if err := p.validateSelectorLabels(); err != nil {
+		return nil, err
+	}
+
+	// the filter with the config read from ConfigFrom, which is only used to create the EnvoyFilters,
+	// so referenced secrets are never logged
+	configured, err := p.resolveConfig(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	pullStart := time.Now()
 	image, err := p.Puller.Pull(p.Ctx, filter.Image)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	p.Metrics.observePull(pullStart)
+
+	if err := p.verifySignature(image); err != nil {
+		return nil, err
+	}
+
+	// the variant of a multi-variant image supported by the istio version
+	image, selectedVariant, err := p.selectVariant(filter, image)
+	if err != nil {
+		return nil, err
 	}
 
 	cfg, err := image.FetchConfig(p.Ctx)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	// the image may declare the config of filters deployed without one
+	configured, err = applyDefaultConfig(configured, cfg)
+	if err != nil {
+		return nil, err
 	}
 
+	// inferred from the module if the image declares none, once the ABI version check is known to run
 	abiVersions := cfg.AbiVersions
 
-	if p.IngoreVersionCheck {
-		logrus.WithFields(logrus.Fields{
+	// recorded on the workloads, so unchanged workloads are not updated again
+	state, err := makeAppliedFilter(configured, image)
+	if err != nil {
+		return nil, err
+	}
+
+	// the ref the cache pulls the image by
+	cachedImage, err := p.pinImage(filter.Image, image, selectedVariant)
+	if err != nil {
+		return nil, err
+	}
+	if cachedImage != filter.Image {
+		state.PinnedImage = cachedImage
+	}
+
+	// the proxy versions matched by the created EnvoyFilters, empty matches all proxies
+	var proxyVersion string
+	if p.IgnoreVersionCheck || p.IngoreVersionCheck {
+		p.logger().WithFields(Fields{
 			"image": image.Ref(),
-		}).Warnf("ignoreVersionCheck is set, skipping ABI version check")
-	} else if len(abiVersions) > 0 {
+		}).Warnf("ignoreVersionCheck is set on the provider, skipping ABI version check")
+	} else if filter.IgnoreAbiCheck {
+		p.logger().WithFields(Fields{
+			"image":  image.Ref(),
+			"filter": filter.Id,
+		}).Warnf("ignoreAbiCheck is set on the filter, skipping ABI version check")
+	} else if abiVersions = p.checkedAbiVersions(image, abiVersions); len(abiVersions) > 0 {
 		istioVersion, err := p.getIstioVersion()
 		if err != nil {
-			return err
+			return nil, err
+		}
+		abiRegistry := p.abiRegistry()
+		if err := abiRegistry.ValidateIstioVersion(abiVersions, istioVersion); err != nil {
+			return nil, &AbiIncompatibleError{Image: image.Ref(), IstioVersion: istioVersion}
 		}
-		if err := abi.DefaultRegistry.ValidateIstioVersion(abiVersions, istioVersion); err != nil {
-			return errors.Errorf("image %v not supported by istio version %v", image.Ref(), istioVersion)
+		if !p.DisableProxyVersionMatch {
+			proxyVersion = abiRegistry.IstioProxyVersionRegex(abiVersions)
 		}
 	} else {
-		logrus.WithFields(logrus.Fields{
+		p.logger().WithFields(Fields{
 			"image": image.Ref(),
 		}).Warnf("no ABI Version found for image, skipping ABI version check")
 	}
 
-	if err := p.addImageToCacheConfigMap(filter.Image); err != nil {
-		return errors.Wrap(err, "adding image to cache")
+	return &preparedFilter{
+		configured:   configured,
+		image:        image,
+		state:        state,
+		cachedImage:  cachedImage,
+		proxyVersion: proxyVersion,
+	}, nil
+}
+
+// applies the filter, recording the mutations made to the cluster in the transaction.
+// returns the checksum injected into the resolved config of the filter, if any
+func (p *Provider) applyFilter(tx *transaction, filter *v1.FilterSpec) (string, error) {
+	prepared, err := p.prepareFilter(filter)
+	if err != nil {
+		return "", err
+	}
+	configured, image, state, cachedImage, proxyVersion := prepared.configured, prepared.image, prepared.state, prepared.cachedImage, prepared.proxyVersion
+
+	if err := p.addImageToCacheConfigMap(tx, filter, cachedImage, state.Digest); err != nil {
+		return "", &CacheError{Image: cachedImage, Err: err}
+	}
+
+	var namespaceLabels map[string]string
+	if !p.IncludeUninjected {
+		namespaceLabels, err = p.getNamespaceLabels()
+		if err != nil {
+			return "", err
+		}
 	}
 
-	err = p.forEachWorkload(func(meta metav1.ObjectMeta, spec *corev1.PodTemplateSpec) error {
-		err := p.applyFilterToWorkload(filter, image, meta, spec)
+	var workloadStart time.Time
+	// the mesh-wide EnvoyFilter was created before if the filter was already applied to every workload,
+	// with the same config unless it is updated in place
+	var annotated, updated, inPlace bool
+	err = p.updateEachWorkload(tx, false, func(meta metav1.ObjectMeta, spec *corev1.PodTemplateSpec) (bool, error) {
+		workloadStart = time.Now()
+		if !p.IncludeUninjected && !sidecarInjected(namespaceLabels, spec) {
+			// the filter could never take effect on the workload
+			skipped := &UninjectedWorkloadError{Workload: meta.Name, Namespace: meta.Namespace}
+			p.logger().WithFields(Fields{
+				"filter":   filter.Id,
+				"workload": meta.Name,
+			}).Warnf("%v", skipped)
+			return false, skipped
+		}
+		updatableInPlace := filterUpdatableInPlace(spec, p.cacheMounted(filter, spec), filter.Id, state)
+		var changed bool
+		var err error
+		if p.MeshWide {
+			// the mesh-wide EnvoyFilter is created once all workloads are annotated
+			changed, err = p.annotateWorkload(tx, configured, state, meta, spec)
+			annotated, updated, inPlace = true, updated || changed, inPlace || updatableInPlace
+		} else {
+			changed, err = p.applyFilterToWorkload(tx, configured, state, image, proxyVersion, meta, spec)
+		}
+		if err == nil && updatableInPlace && p.OnConfigUpdated != nil {
+			p.OnConfigUpdated(meta, state.ConfigHash)
+		}
+		return changed, err
+	}, func(workloads []selectedWorkload) {
+		if p.OnWorkloadsSelected == nil {
+			return
+		}
+		var metas []metav1.ObjectMeta
+		for _, workload := range workloads {
+			metas = append(metas, workload.info.Meta)
+		}
+		p.OnWorkloadsSelected(metas)
+	}, func(workload selectedWorkload, err error) {
+		p.Metrics.observeWorkloadApply(p.Workload, workloadStart)
+		p.recordWorkloadEvent(workload, EventReasonFilterApplied, "apply", "applied", filter, err)
 		if p.OnWorkload != nil {
-			p.OnWorkload(meta, err)
+			p.OnWorkload(workload.info.Meta, err)
 		}
-		return err
 	})
 	if err != nil {
-		return errors.Wrap(err, "applying filter to workload")
+		return "", errors.Wrap(err, "applying filter to workload")
 	}
 
-	return nil
+	if p.MeshWide {
+		logger := p.logger().WithFields(Fields{
+			"filter": filter.Id,
+		})
+		if err := p.ensureEnvoyFilter(tx, logger, configured, image, proxyVersion, "", nil, annotated && !updated && !inPlace); err != nil {
+			return "", errors.Wrap(err, "creating mesh-wide EnvoyFilter")
+		}
+	}
+
+	if !configured.ConfigChecksum {
+		return "", nil
+	}
+	return envoyfilter.GetConfigChecksum(configured.Config), nil
 }
 
-// applies the filter to the target workload: adds annotations and creates the EnvoyFilter CR
-func (p *Provider) applyFilterToWorkload(filter *v1.FilterSpec, image pull.Image, meta metav1.ObjectMeta, spec *corev1.PodTemplateSpec) error {
-	if err := p.setAnnotations(spec); err != nil {
-		return err
+// applies the filter to the target workload: adds annotations and creates the EnvoyFilter CR.
+// returns true if the workload was modified
+func (p *Provider) applyFilterToWorkload(tx *transaction, filter *v1.FilterSpec, state AppliedFilter, image pull.Image, proxyVersion string, meta metav1.ObjectMeta, spec *corev1.PodTemplateSpec) (bool, error) {
+	// the EnvoyFilter of a filter updated in place differs from the applied state
+	inPlace := filterUpdatableInPlace(spec, p.cacheMounted(filter, spec), filter.Id, state)
+	changed, err := p.annotateWorkload(tx, filter, state, meta, spec)
+	if err != nil {
+		return false, err
 	}
-	labels := spec.Labels
-	workloadName := meta.Name
 
-	logger := logrus.WithFields(logrus.Fields{
-		"filter":   filter,
-		"workload": workloadName,
+	logger := p.logger().WithFields(Fields{
+		"filter":   filter.Id,
+		"workload": meta.Name,
 	})
 
-	logger.Info("updated workload sidecar annotations")
+	selector := p.workloadSelectorLabels(spec.Labels)
+	p.checkSelectorMatchesPods(logger, selector)
 
+	// the EnvoyFilter is ensured even if the workload is unchanged, as it may have been modified or deleted
+	return changed, p.ensureEnvoyFilter(tx, logger, filter, image, proxyVersion, meta.Name, selector, !changed && !inPlace)
+}
+
+// adds the sidecar annotations mounting the filter cache to the target workload,
+// and records the filter as applied to it.
+// returns false without modifying the workload if the filter is already applied with the same state,
+// or only its config or image digest changed, see filterUpdatableInPlace
+func (p *Provider) annotateWorkload(tx *transaction, filter *v1.FilterSpec, state AppliedFilter, meta metav1.ObjectMeta, spec *corev1.PodTemplateSpec) (bool, error) {
+	logger := p.logger().WithFields(Fields{
+		"filter":   filter.Id,
+		"workload": meta.Name,
+	})
+
+	if filterAlreadyApplied(spec, p.cacheMounted(filter, spec), filter.Id, state) {
+		logger.Infof("filter already applied to workload and unchanged, skipping the workload update")
+		return false, nil
+	}
+	if filterUpdatableInPlace(spec, p.cacheMounted(filter, spec), filter.Id, state) {
+		logger.Infof("only the config or image digest of the filter changed, updating its EnvoyFilter without restarting the workload")
+		return false, nil
+	}
+	if filterRecorded(spec, filter.Id, state) {
+		p.reportDrift(filter.Id, "the sidecar annotations of workload %v were modified", meta.Name)
+	}
+
+	if err := p.saveSnapshot(tx, filter.Id, meta, spec); err != nil {
+		return false, errors.Wrap(err, "saving workload snapshot")
+	}
+	if p.mountsGatewayVolumes(filter, spec) {
+		// istiod ignores the sidecar annotations of the gateway pods
+		if err := p.setGatewayVolumes(meta.Name, spec); err != nil {
+			return false, err
+		}
+	} else if err := p.setAnnotations(meta.Name, spec); err != nil {
+		return false, err
+	}
+	if err := p.setAppliedFilter(meta.Name, spec, filter.Id, state); err != nil {
+		return false, err
+	}
+
+	logger.Infof("updated workload sidecar annotations")
+
+	return true, nil
+}
+
+// creates or updates the EnvoyFilter CR for the workload,
+// or the mesh-wide EnvoyFilter if MeshWide is set
+func (p *Provider) ensureEnvoyFilter(tx *transaction, logger Logger, filter *v1.FilterSpec, image pull.Image, proxyVersion, workloadName string, labels map[string]string, checkDrift bool) error {
 	istioEnvoyFilter, err := p.makeIstioEnvoyFilter(
 		filter,
 		image,
+		proxyVersion,
 		workloadName,
 		labels,
 	)
@@ -211,28 +659,140 @@ func (p *Provider) applyFilterToWorkload(filter *v1.FilterSpec, image pull.Image
 		return err
 	}
 
-	filterLogger := logger.WithFields(logrus.Fields{
+	// the EnvoyFilter of a filter which was already applied should exist unchanged
+	if checkDrift {
+		if err := p.checkEnvoyFilterDrift(filter.Id, istioEnvoyFilter); err != nil {
+			return errors.Wrap(err, "reading existing EnvoyFilter")
+		}
+	}
+
+	filterLogger := logger.WithFields(Fields{
 		"envoy_filter_resource": istioEnvoyFilter.Name + "." + istioEnvoyFilter.Namespace,
 	})
 
-	err = p.Client.Ensure(p.Ctx, p.ParentObject, istioEnvoyFilter)
+	parentObject := p.ParentObject
+	if p.MeshWide {
+		// owner references cannot cross namespaces, so the mesh-wide
+		// EnvoyFilter is deleted explicitly by RemoveFilter
+		parentObject = nil
+	}
+
+	if err := p.recordEnvoyFilterUpdate(tx, istioEnvoyFilter); err != nil {
+		return errors.Wrap(err, "reading existing EnvoyFilter")
+	}
+	err = p.Client.Ensure(p.Ctx, parentObject, istioEnvoyFilter)
 	if err != nil {
 		return err
 	}
-	filterLogger.Info("created Istio EnvoyFilter resource")
+	filterLogger.Infof("created Istio EnvoyFilter resource")
 
 	return nil
 }
 
+func (p *Provider) abiRegistry() abi.Registry {
+	if p.AbiRegistry == nil {
+		return abi.DefaultRegistry
+	}
+	return p.AbiRegistry
+}
+
+// returns the ABI versions declared by the image, or inferred from its module if it declares none
+func (p *Provider) checkedAbiVersions(image pull.Image, declared []string) []string {
+	if len(declared) > 0 {
+		return declared
+	}
+	return deploy.InferAbiVersions(p.Ctx, image)
+}
+
+// selects the variant of a multi-variant image whose ABI versions are supported by the istio version, or the default variant
+// if the ABI version check is skipped. variants without ABI versions are supported, like images without ABI versions.
+// returns the image itself, and false, if it is not a multi-variant image
+func (p *Provider) selectVariant(filter *v1.FilterSpec, image pull.Image) (pull.Image, bool, error) {
+	variantImage, ok := image.(pull.VariantImage)
+	if !ok || len(variantImage.Variants()) == 0 {
+		return image, false, nil
+	}
+	supported := func([]string) bool { return true }
+	if !p.IgnoreVersionCheck && !p.IngoreVersionCheck && !filter.IgnoreAbiCheck {
+		istioVersion, err := p.getIstioVersion()
+		if err != nil {
+			return nil, false, err
+		}
+		abiRegistry := p.abiRegistry()
+		supported = func(abiVersions []string) bool {
+			return len(abiVersions) == 0 || abiRegistry.ValidateIstioVersion(abiVersions, istioVersion) == nil
+		}
+		abiErr := &AbiIncompatibleError{Image: image.Ref(), IstioVersion: istioVersion}
+		for _, variant := range variantImage.Variants() {
+			if supported(variant.AbiVersions) {
+				abiErr = nil
+				break
+			}
+			abiErr.Variants = append(abiErr.Variants, variant.AbiVersions)
+		}
+		if abiErr != nil {
+			return nil, false, abiErr
+		}
+	}
+	selected, err := variantImage.SelectVariant(p.Ctx, supported)
+	if err != nil {
+		return nil, false, err
+	}
+	p.logger().WithFields(Fields{
+		"image":   image.Ref(),
+		"variant": selected.ManifestDigest(),
+	}).Infof("selected image variant")
+	return selected, true, nil
+}
+
+// returns the ref the cache pulls the image by: the ref of the filter, or the ref pinned to the digest
+// of the manifest of the image if the provider pins images and the ref of the filter has no digest.
+// selected variants of multi-variant images are always pinned, as the cache pulls the default variant of their ref
+func (p *Provider) pinImage(ref string, image pull.Image, variant bool) (string, error) {
+	if !p.PinDigest && !variant {
+		return ref, nil
+	}
+	_, _, refDigest, err := util.SplitImageRefDigest(ref)
+	if err != nil {
+		return "", err
+	}
+	if refDigest != "" && !variant {
+		return ref, nil
+	}
+	manifestImage, ok := image.(pull.ManifestImage)
+	if !ok {
+		return "", errors.Errorf("cannot pin image %v to a digest: the digest of its manifest is unknown", ref)
+	}
+	pinned, err := util.PinImageRef(ref, manifestImage.ManifestDigest())
+	if err != nil {
+		return "", err
+	}
+	p.logger().WithFields(Fields{
+		"image":  ref,
+		"pinned": pinned,
+	}).Infof("pinned image to digest")
+	return pinned, nil
+}
+
 // updates the deployed wasme-cache configmap
-// if configmap does not exist (cache not deployed), this will error
-func (p *Provider) addImageToCacheConfigMap(image string) error {
+// if configmap does not exist (cache not deployed), this will error.
+// the image is not added if a listed ref resolved to the same digest, e.g. the tag and digest forms of the image,
+// unless the image is pinned to its digest.
+// a configmap listing the images in the legacy format is migrated
+func (p *Provider) addImageToCacheConfigMap(tx *transaction, filter *v1.FilterSpec, imageRef, imageDigest string) error {
+	// the cache pulls the image by the ref written here
+	image, err := util.NormalizeImageRef(imageRef)
+	if err != nil {
+		return err
+	}
+	pinned := imageRef != filter.Image
+
 	cm, err := p.KubeClient.CoreV1().ConfigMaps(p.Cache.Namespace).Get(p.Cache.Name, metav1.GetOptions{})
 	if err != nil {
 		return err
 	}
 
-	logger := logrus.WithFields(logrus.Fields{
+	logger := p.logger().WithFields(Fields{
 		"cache": p.Cache,
 		"image": image,
 	})
@@ -241,31 +801,62 @@ func (p *Provider) addImageToCacheConfigMap(image string) error {
 		cm.Data = map[string]string{}
 	}
 
-	images := strings.Split(cm.Data[cache.ImagesKey], "\n")
+	images, err := pkgcache.ParseImageList(cm.Data[cache.ImagesKey])
+	if err != nil {
+		return errors.Wrapf(err, "reading images of cache config")
+	}
 
-	for _, existingImage := range images {
-		if image == existingImage {
-			logger.Info("image is already cached")
-			// already exists
-			return nil
-		}
+	if _, ok := images[image]; ok {
+		logger.Infof("image is already cached")
+		// already exists
+		return nil
+	}
+	// a tag listed with the same digest may be moved, so pinned images are always listed
+	if cachedRef, ok := images.RefWithDigest(imageDigest); ok && !pinned {
+		logger.Infof("image is already cached as %v", cachedRef)
+		return nil
 	}
 
-	images = append(images, image)
+	addedAt := p.clock().Now()
+	listed := pkgcache.ListedImage{
+		Digest:  imageDigest,
+		AddedBy: p.Workload.Namespace + "/" + filter.Id,
+		AddedAt: &addedAt,
+	}
+	if pinned {
+		listed.PinnedFrom = filter.Image
+	}
+	images[image] = listed
 
-	cm.Data[cache.ImagesKey] = strings.Trim(strings.Join(images, "\n"), "\n")
+	cm.Data[cache.ImagesKey], err = images.Marshal()
+	if err != nil {
+		return err
+	}
 
+	// only events published after the image is added are matched,
+	// so events left by earlier or concurrent deployments of the image are not counted
 	_, err = p.KubeClient.CoreV1().ConfigMaps(p.Cache.Namespace).Update(cm)
 	if err != nil {
 		return err
 	}
+	tx.record("add image "+image+" to cache config", func() error {
+		return p.removeImageFromCacheConfigMap(image)
+	})
 
-	logger.Info("added image to cache config...")
+	logger.Infof("added image to cache config...")
 
-	if err := p.waitForCacheEvents(image); err != nil {
+	cacheWaitStart := time.Now()
+	err = p.waitForCacheEvents(image, addedAt)
+	p.Metrics.observeCacheWait(cacheWaitStart)
+	if err != nil {
 		return errors.Wrapf(err, "waiting for cache to publish event for image")
 	}
 
+	if p.KeepCacheEvents {
+		logger.Infof("keeping cache events")
+		return nil
+	}
+
 	if err := p.cleanupCacheEvents(image); err != nil {
 		return errors.Wrapf(err, "cleaning up cache events for image")
 	}
@@ -274,60 +865,248 @@ func (p *Provider) addImageToCacheConfigMap(image string) error {
 
 }
 
+// removes the image from the deployed wasme-cache configmap
+func (p *Provider) removeImageFromCacheConfigMap(image string) error {
+	cm, err := p.KubeClient.CoreV1().ConfigMaps(p.Cache.Namespace).Get(p.Cache.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	images, err := pkgcache.ParseImageList(cm.Data[cache.ImagesKey])
+	if err != nil {
+		return errors.Wrapf(err, "reading images of cache config")
+	}
+	delete(images, image)
+	// the image was added by its normalized ref
+	if normalized, err := util.NormalizeImageRef(image); err == nil {
+		delete(images, normalized)
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[cache.ImagesKey], err = images.Marshal()
+	if err != nil {
+		return err
+	}
+
+	_, err = p.KubeClient.CoreV1().ConfigMaps(p.Cache.Namespace).Update(cm)
+	return err
+}
+
 // we want to see a cache event for each cache instance, with each ref
-// we can mark the events as processed after receiving
-func (p *Provider) waitForCacheEvents(image string) error {
+// published since the image was added to the cache.
+// events are not consumed, so concurrent waits for the same image may match the same events.
+// if no cache instance is ready, waits for one to become ready
+func (p *Provider) waitForCacheEvents(image string, since time.Time) error {
+	logger := p.logger().WithFields(Fields{
+		"image": image,
+		"cache": p.Cache.Name + "." + p.Cache.Namespace,
+	})
 
 	if p.WaitForCacheTimeout == 0 {
-		logrus.Infof("skipping cache events wait")
+		logger.Infof("skipping cache events wait")
 		return nil
 	}
 
-	timeout := time.After(p.WaitForCacheTimeout)
-	interval := time.Tick(time.Second)
+	clk := p.clock()
+	timeout := clk.After(p.WaitForCacheTimeout)
+	interval := p.cachePollInterval()
 
-	logrus.Infof("waiting for event with timeout %v", p.WaitForCacheTimeout)
+	logger.Infof("waiting for event with timeout %v", p.WaitForCacheTimeout)
 
-	cacheDaemonset, err := p.KubeClient.AppsV1().DaemonSets(p.Cache.Namespace).Get(p.Cache.Name, metav1.GetOptions{})
+	expectedEvents, err := p.getReadyCacheInstances()
 	if err != nil {
-		return errors.Wrapf(err, "getting daemonset for cache %v", p.Cache)
+		return err
 	}
 
 	var eventsErr error
+	// the message of the last image error reported by each node, which may still succeed on retry
+	imageErrors := map[string]string{}
 	for {
 		select {
 		case <-timeout:
-			return errors.Errorf("timed out after %s (last err: %v)", p.WaitForCacheTimeout, eventsErr)
-		case <-interval:
-			events, err := cache.GetImageEvents(p.KubeClient, p.Cache.Namespace, image)
+			return &CacheTimeoutError{Timeout: p.WaitForCacheTimeout, LastErr: eventsErr}
+		case <-clk.After(wait.Jitter(interval, cachePollJitter)):
+			// back off while the cache is not ready
+			interval = nextCachePollInterval(interval)
+			if expectedEvents == 0 {
+				// no cache instance can pull the image, e.g. because the cache pods fail to pull their own image,
+				// so wait for one to become ready rather than deploying a filter which no proxy can load
+				expectedEvents, err = p.getReadyCacheInstances()
+				if err != nil {
+					return err
+				}
+				if expectedEvents == 0 {
+					eventsErr = errors.Errorf("the cache %v.%v has no ready pods, check the status of the cache pods in namespace %v",
+						p.Cache.Name, p.Cache.Namespace, p.Cache.Namespace)
+					logger.Warnf("waiting for a cache instance to become ready")
+					continue
+				}
+			}
+			// events left by earlier deployments of the image are ignored
+			events, err := cache.ListParsedImageEvents(p.KubeClient, p.Cache.Namespace, cache.ImageEventQuery{
+				Image:     image,
+				CacheName: p.Cache.Name,
+				Since:     since.Add(-cacheEventClockSkew),
+				PageSize:  cacheEventsPageSize,
+			})
 			if err != nil {
 				return errors.Wrapf(err, "getting events for image %v", image)
 			}
 			// expect an event for each cache instance
 			successEvents := map[string]bool{}
+			// whether the cache on each node will retry pulling the image, according to its latest image error
+			retrying := map[string]bool{}
+			latestErrors := map[string]time.Time{}
 
 			for _, evt := range events {
+				node := evt.Node()
 				if evt.Reason == cache.Reason_ImageError {
-					logrus.Warnf("event %v was in Error state: %+v", evt.Name, evt)
+					message := evt.ErrorMessage()
+					if seenMessage, seen := imageErrors[node]; !seen || seenMessage != message {
+						logger.WithFields(Fields{
+							"event": evt.Name,
+							"node":  node,
+						}).Warnf("cache failed to pull image: %v", message)
+					}
+					imageErrors[node] = message
+					if latest, ok := latestErrors[node]; !ok || !cache.EventTime(evt.Event).Before(latest) {
+						latestErrors[node] = cache.EventTime(evt.Event)
+						retrying[node] = evt.Annotations[cache.CacheRetryingAnnotation] == "true"
+					}
+					continue
+				}
+				if evt.Reason != cache.Reason_ImageAdded {
+					// e.g. the image was unlisted by a concurrent removal
 					continue
 				}
-				successEvents[evt.Source.Host] = true
+				successEvents[node] = true
 			}
 
-			if len(successEvents) != int(cacheDaemonset.Status.NumberReady) {
-				eventsErr = errors.Errorf("expected %v image-ready events for image %v, only found %v", cacheDaemonset.Status.NumberReady, image, successEvents)
-				logrus.Warnf("event err: %v", eventsErr)
+			if len(successEvents) != expectedEvents {
+				// the nodes which failed to pull the image without succeeding since
+				failedNodes := map[string]string{}
+				var retryingNodes int
+				for node, message := range imageErrors {
+					if !successEvents[node] {
+						failedNodes[node] = message
+						if retrying[node] {
+							retryingNodes++
+						}
+					}
+				}
+				if len(failedNodes) > 0 && retryingNodes == 0 && len(successEvents)+len(failedNodes) >= expectedEvents {
+					// every remaining cache instance failed and stopped retrying, waiting longer will not help
+					return errors.Errorf("cache failed to pull image %v on %v of %v nodes: %v",
+						image, len(failedNodes), expectedEvents, formatImageErrors(failedNodes))
+				}
+
+				var readyNodes []string
+				for node := range successEvents {
+					readyNodes = append(readyNodes, node)
+				}
+				sort.Strings(readyNodes)
+				eventsErr = errors.Errorf("expected %v image-ready events for image %v, only found %v", expectedEvents, image, successEvents)
+				if len(failedNodes) > 0 {
+					eventsErr = errors.Errorf("%v, failed to pull image on the other nodes: %v", eventsErr, formatImageErrors(failedNodes))
+				}
+				logger.WithFields(Fields{
+					"expected":    expectedEvents,
+					"ready_nodes": readyNodes,
+				}).Warnf("waiting for the cache instances on the remaining nodes to pull the image")
 				continue
 			}
 
-			logrus.Debugf("ACK all events for image %v", image)
+			logger.Debugf("ACK all events for image %v", image)
 			return nil
 		}
 	}
 }
 
+// formats the image errors reported by each node, listing the nodes which reported each message
+func formatImageErrors(nodeErrors map[string]string) string {
+	nodesByMessage := map[string][]string{}
+	for node, message := range nodeErrors {
+		nodesByMessage[message] = append(nodesByMessage[message], node)
+	}
+	var formatted []string
+	for message, nodes := range nodesByMessage {
+		sort.Strings(nodes)
+		formatted = append(formatted, fmt.Sprintf("%v (%v)", message, strings.Join(nodes, ", ")))
+	}
+	sort.Strings(formatted)
+	return strings.Join(formatted, "; ")
+}
+
+func (p *Provider) clock() clock.Clock {
+	if p.Clock == nil {
+		return clock.RealClock{}
+	}
+	return p.Clock
+}
+
+func (p *Provider) cachePollInterval() time.Duration {
+	if p.CachePollInterval <= 0 {
+		return defaultCachePollInterval
+	}
+	return p.CachePollInterval
+}
+
+// doubles the poll interval, up to maxCachePollInterval.
+// intervals set above the maximum are left unchanged
+func nextCachePollInterval(interval time.Duration) time.Duration {
+	if interval >= maxCachePollInterval {
+		return interval
+	}
+	interval *= 2
+	if interval > maxCachePollInterval {
+		return maxCachePollInterval
+	}
+	return interval
+}
+
+// returns the number of ready cache instances we expect to publish an event for each image.
+// if the cache kind is unset, look for a daemonset first and then a deployment
+func (p *Provider) getReadyCacheInstances() (int, error) {
+	switch strings.ToLower(p.Cache.Kind) {
+	case WorkloadTypeDaemonSet:
+		return p.getReadyCacheDaemonSetPods()
+	case WorkloadTypeDeployment:
+		return p.getReadyCacheDeploymentPods()
+	case "":
+		if ready, err := p.getReadyCacheDaemonSetPods(); err == nil {
+			return ready, nil
+		}
+		if ready, err := p.getReadyCacheDeploymentPods(); err == nil {
+			return ready, nil
+		}
+		return 0, errors.Errorf("could not find cache %v.%v as a daemonset or deployment. "+
+			"use --cache-name, --cache-namespace and --cache-kind to point wasme at your cache installation", p.Cache.Name, p.Cache.Namespace)
+	default:
+		return 0, errors.Errorf("unknown cache kind %v, must be %v or %v", p.Cache.Kind, WorkloadTypeDaemonSet, WorkloadTypeDeployment)
+	}
+}
+
+func (p *Provider) getReadyCacheDaemonSetPods() (int, error) {
+	cacheDaemonset, err := p.KubeClient.AppsV1().DaemonSets(p.Cache.Namespace).Get(p.Cache.Name, metav1.GetOptions{})
+	if err != nil {
+		return 0, errors.Wrapf(err, "getting daemonset for cache %v", p.Cache)
+	}
+	return int(cacheDaemonset.Status.NumberReady), nil
+}
+
+func (p *Provider) getReadyCacheDeploymentPods() (int, error) {
+	cacheDeployment, err := p.KubeClient.AppsV1().Deployments(p.Cache.Namespace).Get(p.Cache.Name, metav1.GetOptions{})
+	if err != nil {
+		return 0, errors.Wrapf(err, "getting deployment for cache %v", p.Cache)
+	}
+	return int(cacheDeployment.Status.ReadyReplicas), nil
+}
+
 func (p *Provider) cleanupCacheEvents(image string) error {
-	logrus.Infof("cleaning up cache events for image %v", image)
+	p.logger().WithFields(Fields{
+		"image": image,
+	}).Infof("cleaning up cache events")
 	events, err := cache.GetImageEvents(p.KubeClient, p.Cache.Namespace, image)
 	if err != nil {
 		return errors.Wrapf(err, "getting events for image %v", image)
@@ -342,94 +1121,173 @@ func (p *Provider) cleanupCacheEvents(image string) error {
 	return nil
 }
 
-// runs a function on the workload pod template spec
+// runs a function on the workload pod template spec, updating the workloads for which do returns true.
 // selects all workloads in a namespace if workload.Name == ""
-func (p *Provider) forEachWorkload(do func(meta metav1.ObjectMeta, spec *corev1.PodTemplateSpec) error) error {
+// workloads are visited in the order defined by the WorkloadOrdering, or the reverse order if reverse is set.
+// if set, selected is called with the sorted workloads before they are updated,
+// and done is called with the result of updating each workload, including the rollout.
+// the updated workloads are recorded in the transaction
+func (p *Provider) updateEachWorkload(tx *transaction, reverse bool, do func(meta metav1.ObjectMeta, spec *corev1.PodTemplateSpec) (bool, error), selected func(workloads []selectedWorkload), done func(workload selectedWorkload, err error)) error {
+	workloads, err := p.listWorkloads()
+	if err != nil {
+		return err
+	}
+	if p.Workload.Name != "" {
+		workloads = workloadsNamed(workloads, p.Workload.Name)
+	}
+
+	sortWorkloads(workloads, p.WorkloadOrdering, reverse)
+	if selected != nil {
+		selected(workloads)
+	}
+
+	for _, workload := range workloads {
+		err := p.updateWorkloadObject(tx, workload, do)
+		if done != nil {
+			done(workload, err)
+		}
+		// skipped workloads are reported to done, but do not fail the update
+		if err != nil && !IsUninjectedWorkload(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *Provider) updateWorkloadObject(tx *transaction, workload selectedWorkload, do func(meta metav1.ObjectMeta, spec *corev1.PodTemplateSpec) (bool, error)) error {
+	before := touchedAnnotationValues(workload.template)
+	changed, err := do(workload.info.Meta, workload.template)
+	if err != nil || !changed {
+		return err
+	}
+
+	if workload.syncTemplate != nil {
+		if err := workload.syncTemplate(); err != nil {
+			return err
+		}
+	}
+	if err := p.Client.Ensure(p.Ctx, nil, workload.object); err != nil {
+		return err
+	}
+	p.recordWorkloadUpdate(tx, workload.info.Meta.Name, before)
+
+	return p.waitForRollout(p.Workload.Kind, workload.info.Meta.Name)
+}
+
+// lists the workloads selected by the Workload
+func (p *Provider) listWorkloads() ([]selectedWorkload, error) {
+	var selected []selectedWorkload
 	switch strings.ToLower(p.Workload.Kind) {
 	case WorkloadTypeDeployment:
 		workloads, err := p.KubeClient.AppsV1().Deployments(p.Workload.Namespace).List(metav1.ListOptions{
 			LabelSelector: labels.SelectorFromSet(p.Workload.Labels).String(),
 		})
 		if err != nil {
-			return err
+			return nil, err
 		}
-		for _, workload := range workloads.Items {
-			if err := do(workload.ObjectMeta, &workload.Spec.Template); err != nil {
-				return err
-			}
-
-			if err = p.Client.Ensure(p.Ctx, nil, &workload); err != nil {
-				return err
+		for i := range workloads.Items {
+			workload := &workloads.Items[i]
+			replicas := int32(1)
+			if workload.Spec.Replicas != nil {
+				replicas = *workload.Spec.Replicas
 			}
+			selected = append(selected, selectedWorkload{
+				info:     WorkloadInfo{Meta: workload.ObjectMeta, Replicas: replicas},
+				template: &workload.Spec.Template,
+				object:   workload,
+			})
 		}
 	case WorkloadTypeDaemonSet:
 		workloads, err := p.KubeClient.AppsV1().DaemonSets(p.Workload.Namespace).List(metav1.ListOptions{
 			LabelSelector: labels.SelectorFromSet(p.Workload.Labels).String(),
 		})
 		if err != nil {
-			return err
+			return nil, err
 		}
-		for _, workload := range workloads.Items {
-			if err := do(workload.ObjectMeta, &workload.Spec.Template); err != nil {
-				return err
-			}
-
-			if err = p.Client.Ensure(p.Ctx, nil, &workload); err != nil {
-				return err
-			}
+		for i := range workloads.Items {
+			workload := &workloads.Items[i]
+			selected = append(selected, selectedWorkload{
+				info:     WorkloadInfo{Meta: workload.ObjectMeta, Replicas: workload.Status.DesiredNumberScheduled},
+				template: &workload.Spec.Template,
+				object:   workload,
+			})
 		}
 	case WorkloadTypeStatefulSet:
 		workloads, err := p.KubeClient.AppsV1().StatefulSets(p.Workload.Namespace).List(metav1.ListOptions{
 			LabelSelector: labels.SelectorFromSet(p.Workload.Labels).String(),
 		})
 		if err != nil {
-			return nil
+			return nil, errors.Wrapf(err, "listing StatefulSets in namespace %v", p.Workload.Namespace)
 		}
-		for _, workload := range workloads.Items {
-			if err := do(workload.ObjectMeta, &workload.Spec.Template); err != nil {
-				return err
-			}
-
-			if err = p.Client.Ensure(p.Ctx, nil, &workload); err != nil {
-				return err
+		for i := range workloads.Items {
+			workload := &workloads.Items[i]
+			replicas := int32(1)
+			if workload.Spec.Replicas != nil {
+				replicas = *workload.Spec.Replicas
 			}
+			selected = append(selected, selectedWorkload{
+				info:     WorkloadInfo{Meta: workload.ObjectMeta, Replicas: replicas},
+				template: &workload.Spec.Template,
+				object:   workload,
+			})
 		}
+	case WorkloadTypeDeploymentConfig:
+		return p.listDeploymentConfigs()
 	default:
-		return errors.Errorf("unknown workload type %v, must be %v or %v", p.Workload.Kind, WorkloadTypeDeployment, WorkloadTypeDaemonSet)
+		return nil, unknownWorkloadTypeError(p.Workload.Kind)
 	}
 
-	return nil
+	return selected, nil
+}
+
+func workloadsNamed(workloads []selectedWorkload, name string) []selectedWorkload {
+	var named []selectedWorkload
+	for _, workload := range workloads {
+		if workload.info.Meta.Name == name {
+			named = append(named, workload)
+		}
+	}
+	return named
+}
 
+func unknownWorkloadTypeError(kind string) error {
+	return errors.Errorf("unknown workload type %v, must be one of %v", kind, strings.Join([]string{
+		WorkloadTypeDeployment,
+		WorkloadTypeDaemonSet,
+		WorkloadTypeStatefulSet,
+		WorkloadTypeDeploymentConfig,
+	}, ", "))
 }
 
 // set sidecar annotations on the workload
-func (p *Provider) setAnnotations(template *corev1.PodTemplateSpec) error {
+func (p *Provider) setAnnotations(workloadName string, template *corev1.PodTemplateSpec) error {
 	if template.Annotations == nil {
 		template.Annotations = map[string]string{}
 	}
-	for k, v := range requiredSidecarAnnotations() {
+	_, applied := template.Annotations[appliedAnnotation]
+	for k, v := range p.sidecarAnnotations() {
+		currentVal, ok := template.Annotations[k]
+		if ok && (applied || currentVal == v) {
+			// the current value was written by wasme, never back it up.
+			// the value to merge with is the existing backup, if any
+			currentVal, ok = template.Annotations[backupAnnotationPrefix+k]
+		}
 		// create backups of the existing annotations if they exist, and merge sidecar annotations
-		if currentVal, ok := template.Annotations[k]; ok {
-			template.Annotations[backupAnnotationPrefix+k] = currentVal
-			var currentAnnotations []map[string]interface{}
-			if err := json.Unmarshal([]byte(currentVal), &currentAnnotations); err != nil {
-				return err
+		if ok {
+			currentAnnotations, err := parseAnnotationEntries(currentVal)
+			if err != nil {
+				return errors.Wrapf(err, "parsing annotation %v of workload %v", k, workloadName)
 			}
-			var sidecarAnnotation []map[string]interface{}
-			if err := json.Unmarshal([]byte(v), &sidecarAnnotation); err != nil {
+			sidecarAnnotation, err := parseAnnotationEntries(v)
+			if err != nil {
 				return err
 			}
+			template.Annotations[backupAnnotationPrefix+k] = currentVal
 			// append if not exist
 			mergeAnnotations := currentAnnotations
 			for _, required := range sidecarAnnotation {
-				merge := true
-				for _, current := range mergeAnnotations {
-					if current["name"] == required["name"] {
-						merge = false
-						break
-					}
-				}
-				if merge {
+				if !containsEntry(mergeAnnotations, required) {
 					mergeAnnotations = append(mergeAnnotations, required)
 				}
 			}
@@ -438,7 +1296,7 @@ func (p *Provider) setAnnotations(template *corev1.PodTemplateSpec) error {
 				return err
 			}
 			v = string(merge)
-			logger := logrus.WithFields(logrus.Fields{
+			logger := p.logger().WithFields(Fields{
 				"before": currentVal,
 				"after":  v,
 			})
@@ -446,43 +1304,139 @@ func (p *Provider) setAnnotations(template *corev1.PodTemplateSpec) error {
 		}
 		template.Annotations[k] = v
 	}
+	template.Annotations[appliedAnnotation] = "true"
 	return nil
 }
 
-// construct Istio EnvoyFilter Custom Resource
-func (p *Provider) makeIstioEnvoyFilter(filter *v1.FilterSpec, image pull.Image, workloadName string, labels map[string]string) (*v1alpha3.EnvoyFilter, error) {
-	descriptor, err := image.Descriptor()
-	if err != nil {
+// returns true if the value of the sidecar annotation contains the cache volume written by wasme,
+// for any storage of the cache, or cannot be parsed
+func containsCacheVolume(key, value string) bool {
+	for _, cache := range []Cache{{}, {PersistentVolumeClaim: "claim"}} {
+		contains, err := containsEntries(value, requiredSidecarAnnotations(cache)[key])
+		if err != nil || contains {
+			return true
+		}
+	}
+	return false
+}
+
+// parses the entries of a sidecar annotation such as sidecar.istio.io/userVolume.
+// Istio accepts a single object as well as an array, so a single object is returned as one entry.
+// the entries are kept raw so fields unknown to wasme, and entries which are not objects, are preserved
+func parseAnnotationEntries(value string) ([]json.RawMessage, error) {
+	var raw json.RawMessage
+	if err := json.Unmarshal([]byte(value), &raw); err != nil {
 		return nil, err
 	}
+	switch raw[0] {
+	case '[':
+		var entries []json.RawMessage
+		if err := json.Unmarshal(raw, &entries); err != nil {
+			return nil, err
+		}
+		return entries, nil
+	case '{':
+		return []json.RawMessage{raw}, nil
+	default:
+		return nil, errors.Errorf("expected a JSON object or array, got %s", raw)
+	}
+}
+
+// returns true if the entries contain an entry with the same name
+func containsEntry(entries []json.RawMessage, entry json.RawMessage) bool {
+	name, ok := entryName(entry)
+	if !ok {
+		return false
+	}
+	for _, e := range entries {
+		if n, ok := entryName(e); ok && n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the name of an annotation entry, or false if the entry is not an object with a name
+func entryName(entry json.RawMessage) (string, bool) {
+	var named struct {
+		Name *string `json:"name"`
+	}
+	if err := json.Unmarshal(entry, &named); err != nil || named.Name == nil {
+		return "", false
+	}
+	return *named.Name, true
+}
+
+// returns the data source of the filter with the digest, for older and newer versions of Istio.
+// the filter is loaded from the file in the mounted cache directory,
+// or fetched from the cache service if RemoteDatasource is set
+func (p *Provider) makeDatasources(imageDigest digest.Digest) (*core.AsyncDataSource, *corev3.AsyncDataSource, error) {
+	if p.RemoteDatasource {
+		if imageDigest.Algorithm() != digest.SHA256 {
+			return nil, nil, errors.Errorf("image digest %v must be a sha256 digest to be verified by the proxies", imageDigest)
+		}
+		host := fmt.Sprintf("%v.%v.svc.cluster.local", p.Cache.Name, p.Cache.Namespace)
+		uri := fmt.Sprintf("http://%v:%v%v%v", host, cache.ServerPort, pkgcache.ModulesPath, imageDigest)
+		// the outbound cluster created by Istio for the cache service
+		cluster := fmt.Sprintf("outbound|%v||%v", cache.ServerPort, host)
+		return envoyfilter.MakeRemoteDataSource(uri, cluster, imageDigest.Encoded()),
+			envoyfilter.MakeV3RemoteDataSource(uri, cluster, imageDigest.Encoded()),
+			nil
+	}
 
 	// path to the file in the mounted host volume
-	// created by the cache
+	// created by the cache.
+	// the local datasources of Envoy carry no checksum in any version of the API, so the proxy cannot verify the file:
+	// the file is named after the digest, and the cache verifies the content against the digest before moving it into place.
+	// use the RemoteDatasource to have the proxies verify the sha256 of the module
+	cachedFile, err := pkgcache.Digest2filename(imageDigest)
+	if err != nil {
+		return nil, nil, err
+	}
 	filename := filepath.Join(
 		"/var/local/lib/wasme-cache",
-		pkgcache.Digest2filename(descriptor.Digest),
+		cachedFile,
 	)
+	return envoyfilter.MakeLocalDatasource(filename), envoyfilter.MakeV3LocalDatasource(filename), nil
+}
 
-	var wasmFilterConfig *envoyhttp.HttpFilter
-	istioVersion, err := p.getIstioVersion()
+// construct Istio EnvoyFilter Custom Resource
+// if proxyVersion is non-empty, the EnvoyFilter only applies to proxies with a matching version.
+// if MeshWide is set, the EnvoyFilter has no workload selector and the workload name and labels are ignored
+func (p *Provider) makeIstioEnvoyFilter(filter *v1.FilterSpec, image pull.Image, proxyVersion, workloadName string, labels map[string]string) (*v1alpha3.EnvoyFilter, error) {
+	descriptor, err := image.Descriptor()
 	if err != nil {
 		return nil, err
 	}
-	if isOlderIstio(istioVersion) {
-		wasmFilterConfig, err = envoyfilter.MakeIstioWasmFilter(filter,
-			envoyfilter.MakeLocalDatasource(filename),
-		)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		wasmFilterConfig, err = envoyfilter.MakeTypedIstioWasmFilter(filter,
-			envoyfilter.MakeV3LocalDatasource(filename),
-		)
-		if err != nil {
-			return nil, err
-		}
 
+	datasource, v3Datasource, err := p.makeDatasources(descriptor.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	network := isNetworkFilter(filter)
+	var wasmFilterConfig proto.Message
+	istioVersion, err := p.getIstioVersion()
+	if err != nil {
+		return nil, err
+	}
+	// the proxies of Istio 1.8 and older predate Envoy 1.17, and drop the environment variables of the VM
+	if len(filter.GetEnv()) > 0 && p.isIstioOlderThan(istioVersion, 9) {
+		return nil, errors.Errorf("environment variables of the VM of filter %v require Istio 1.9+, found Istio %v", filter.Id, istioVersion)
+	}
+	olderIstio := p.isOlderIstio(istioVersion)
+	switch {
+	case network && olderIstio:
+		wasmFilterConfig, err = envoyfilter.MakeIstioWasmNetworkFilter(filter, datasource)
+	case network:
+		wasmFilterConfig, err = envoyfilter.MakeTypedIstioWasmNetworkFilter(filter, v3Datasource)
+	case olderIstio:
+		wasmFilterConfig, err = envoyfilter.MakeIstioWasmFilter(filter, datasource)
+	default:
+		wasmFilterConfig, err = envoyfilter.MakeTypedIstioWasmFilter(filter, v3Datasource)
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	// We need to marshal to a structpb because of udpa,
@@ -512,18 +1466,45 @@ func (p *Provider) makeIstioEnvoyFilter(filter *v1.FilterSpec, image pull.Image,
 		return nil, errors.Errorf("unknown patch context %v, must be one of the following values: %s", filter.GetPatchContext(), strings.Join(SupportedPatchContexts, ", "))
 	}
 
+	var proxyMatch *networkingv1alpha3.EnvoyFilter_ProxyMatch
+	if proxyVersion != "" {
+		proxyMatch = &networkingv1alpha3.EnvoyFilter_ProxyMatch{
+			ProxyVersion: proxyVersion,
+		}
+	}
+
+	applyTo := networkingv1alpha3.EnvoyFilter_HTTP_FILTER
+	operation := networkingv1alpha3.EnvoyFilter_Patch_INSERT_BEFORE
+	var filterMatch *networkingv1alpha3.EnvoyFilter_ListenerMatch_FilterMatch
+	if network {
+		// insert the filter before the tcp_proxy filter, which terminates TCP filter chains
+		applyTo = networkingv1alpha3.EnvoyFilter_NETWORK_FILTER
+		filterMatch = &networkingv1alpha3.EnvoyFilter_ListenerMatch_FilterMatch{
+			Name: "envoy.tcp_proxy",
+		}
+	} else {
+		// insert the filter before the router, unless ordered relative to another filter
+		var subFilter string
+		operation, subFilter, err = p.filterPosition(filter, workloadName, olderIstio)
+		if err != nil {
+			return nil, err
+		}
+		filterMatch = &networkingv1alpha3.EnvoyFilter_ListenerMatch_FilterMatch{
+			Name: "envoy.http_connection_manager",
+			SubFilter: &networkingv1alpha3.EnvoyFilter_ListenerMatch_SubFilterMatch{
+				Name: subFilter,
+			},
+		}
+	}
+
 	makeMatch := func() *networkingv1alpha3.EnvoyFilter_EnvoyConfigObjectMatch {
 		return &networkingv1alpha3.EnvoyFilter_EnvoyConfigObjectMatch{
+			Proxy:   proxyMatch,
 			Context: patchContext,
 			ObjectTypes: &networkingv1alpha3.EnvoyFilter_EnvoyConfigObjectMatch_Listener{
 				Listener: &networkingv1alpha3.EnvoyFilter_ListenerMatch{
 					FilterChain: &networkingv1alpha3.EnvoyFilter_ListenerMatch_FilterChainMatch{
-						Filter: &networkingv1alpha3.EnvoyFilter_ListenerMatch_FilterMatch{
-							Name: "envoy.http_connection_manager",
-							SubFilter: &networkingv1alpha3.EnvoyFilter_ListenerMatch_SubFilterMatch{
-								Name: "envoy.router",
-							},
-						},
+						Filter: filterMatch,
 					},
 				},
 			},
@@ -534,10 +1515,10 @@ func (p *Provider) makeIstioEnvoyFilter(filter *v1.FilterSpec, image pull.Image,
 	// have to duplicate the config patch for each port we want
 	makeConfigPatch := func(match *networkingv1alpha3.EnvoyFilter_EnvoyConfigObjectMatch) *networkingv1alpha3.EnvoyFilter_EnvoyConfigObjectPatch {
 		return &networkingv1alpha3.EnvoyFilter_EnvoyConfigObjectPatch{
-			ApplyTo: networkingv1alpha3.EnvoyFilter_HTTP_FILTER,
+			ApplyTo: applyTo,
 			Match:   match,
 			Patch: &networkingv1alpha3.EnvoyFilter_Patch{
-				Operation: networkingv1alpha3.EnvoyFilter_Patch_INSERT_BEFORE,
+				Operation: operation,
 				Value:     typeStruct,
 			},
 		}
@@ -548,113 +1529,417 @@ func (p *Provider) makeIstioEnvoyFilter(filter *v1.FilterSpec, image pull.Image,
 	configPatches = append(configPatches, makeConfigPatch(makeMatch()))
 
 	spec := networkingv1alpha3.EnvoyFilter{
-		WorkloadSelector: &networkingv1alpha3.WorkloadSelector{
-			Labels: labels,
-		},
 		ConfigPatches: configPatches,
 	}
 
+	// in istio's case, filter ID must be a kube-compliant name
+	name := EnvoyFilterName(workloadName, filter.Id)
+	namespace := p.Workload.Namespace
+	// label values are limited to 63 characters, so long values are truncated like the name
+	envoyFilterLabels := map[string]string{
+		FilterIdLabel: truncateName(filter.Id, validation.LabelValueMaxLength),
+		ImageLabel:    imageLabelValue(filter.Image),
+	}
+	if p.MeshWide {
+		// an EnvoyFilter in the root namespace without a workload selector applies to all proxies
+		name = filter.Id
+		namespace = p.istioNamespace()
+	} else {
+		spec.WorkloadSelector = &networkingv1alpha3.WorkloadSelector{
+			Labels: labels,
+		}
+		envoyFilterLabels[WorkloadLabel] = truncateName(workloadName, validation.LabelValueMaxLength)
+	}
+
+	annotations := map[string]string{
+		ImageLabel: filter.Image,
+	}
+	if checksum := envoyfilter.GetConfigChecksum(filter.Config); filter.ConfigChecksum && checksum != "" {
+		annotations[envoyfilter.ConfigChecksumAnnotation] = checksum
+	}
+
 	return &v1alpha3.EnvoyFilter{
 		ObjectMeta: metav1.ObjectMeta{
-			// in istio's case, filter ID must be a kube-compliant name
-			Name:      istioEnvoyFilterName(workloadName, filter.Id),
-			Namespace: p.Workload.Namespace,
+			Name:        name,
+			Namespace:   namespace,
+			Labels:      envoyFilterLabels,
+			Annotations: annotations,
 		},
 		Spec: spec,
 	}, nil
 }
 
+// returns true if the filter is inserted into TCP filter chains rather than the HTTP filter chain
+func isNetworkFilter(filter *v1.FilterSpec) bool {
+	return strings.ToLower(filter.GetFilterType()) == FilterTypeNetwork
+}
+
+// returns the value of the ImageLabel for the image ref
+func imageLabelValue(ref string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(ref)))
+}
+
+// returns the patch operation and the name of the HTTP filter relative to which the filter is inserted.
+// if the filter is ordered relative to another filter, that filter must be deployed to the workload
+func (p *Provider) filterPosition(filter *v1.FilterSpec, workloadName string, olderIstio bool) (networkingv1alpha3.EnvoyFilter_Patch_Operation, string, error) {
+	operation, relativeTo := networkingv1alpha3.EnvoyFilter_Patch_INSERT_BEFORE, filter.GetOrderBefore()
+	switch {
+	case filter.GetOrderBefore() != "" && filter.GetOrderAfter() != "":
+		return 0, "", errors.Errorf("filter %v cannot be ordered both before and after another filter", filter.Id)
+	case filter.GetOrderAfter() != "":
+		operation, relativeTo = networkingv1alpha3.EnvoyFilter_Patch_INSERT_AFTER, filter.GetOrderAfter()
+	case relativeTo == "":
+		return operation, "envoy.router", nil
+	}
+
+	if relativeTo == filter.Id {
+		return 0, "", errors.Errorf("filter %v cannot be ordered relative to itself", filter.Id)
+	}
+	if olderIstio {
+		// older versions give every wasm filter the same name
+		return 0, "", errors.Errorf("ordering filter %v relative to another filter requires Istio 1.7+", filter.Id)
+	}
+
+	deployed, err := p.deployedFilterIds(workloadName)
+	if err != nil {
+		return 0, "", errors.Wrap(err, "listing deployed filters")
+	}
+	for _, filterId := range deployed {
+		if filterId == truncateName(relativeTo, validation.LabelValueMaxLength) {
+			return operation, envoyfilter.HttpFilterName(relativeTo), nil
+		}
+	}
+
+	// the filter itself is left out, as it may already be deployed
+	var others []string
+	for _, filterId := range deployed {
+		if filterId != truncateName(filter.Id, validation.LabelValueMaxLength) {
+			others = append(others, filterId)
+		}
+	}
+	target := "workload " + workloadName
+	if p.MeshWide {
+		target = "the mesh"
+	}
+	return 0, "", errors.Errorf("cannot order filter %v relative to filter %v, which is not deployed to %v. deployed filters: %v",
+		filter.Id, relativeTo, target, others)
+}
+
+// returns the ids of the filters deployed to the workload, read from the labels of their EnvoyFilters.
+// if MeshWide is set, returns the ids of the filters deployed mesh-wide
+func (p *Provider) deployedFilterIds(workloadName string) ([]string, error) {
+	namespace, selector := p.Workload.Namespace, client.MatchingLabels{
+		WorkloadLabel: truncateName(workloadName, validation.LabelValueMaxLength),
+	}
+	if p.MeshWide {
+		namespace, selector = p.istioNamespace(), client.MatchingLabels{}
+	}
+
+	var envoyFilters v1alpha3.EnvoyFilterList
+	if err := p.Client.List(p.Ctx, &envoyFilters, client.InNamespace(namespace), selector); err != nil {
+		return nil, err
+	}
+
+	var filterIds []string
+	for _, envoyFilter := range envoyFilters.Items {
+		filterId, ok := envoyFilter.Labels[FilterIdLabel]
+		if !ok {
+			continue
+		}
+		// mesh-wide EnvoyFilters are not labeled with a workload
+		if _, ok := envoyFilter.Labels[WorkloadLabel]; p.MeshWide && ok {
+			continue
+		}
+		filterIds = append(filterIds, filterId)
+	}
+	sort.Strings(filterIds)
+	return filterIds, nil
+}
+
 // Returns true if istio version is 1.6.x or older
-func isOlderIstio(istioVersion string) bool {
+func (p *Provider) isOlderIstio(istioVersion string) bool {
+	return p.isIstioOlderThan(istioVersion, 7)
+}
+
+// returns true if the minor version of istio is older than 1.<minVersion>.
+// if the version cannot be parsed, it is assumed to be recent
+func (p *Provider) isIstioOlderThan(istioVersion string, minVersion int) bool {
 	parts := strings.Split(istioVersion, ".")
 
 	// check minor version
 	minor, err := strconv.Atoi(parts[1])
 	if err != nil {
-		logrus.WithField("istioVersion", istioVersion).WithError(err).Warn("unable to determine istio version, assuming 1.7+")
+		p.logger().WithFields(Fields{"istioVersion": istioVersion}).WithError(err).Warnf("unable to determine istio version, assuming 1.%v+", minVersion)
 		return false
 	}
-	if minor >= 7 {
-		return false
+	return minor < minVersion
+}
+
+// EnvoyFilterName returns the name of the EnvoyFilter created for the filter on the workload.
+// names exceeding the kubernetes name limit are truncated and suffixed with a hash of the full name,
+// so the same name is computed when applying and removing the filter
+func EnvoyFilterName(workloadName, filterId string) string {
+	return truncateName(workloadName+"-"+filterId, validation.DNS1123SubdomainMaxLength)
+}
+
+// truncates names longer than maxLength, replacing the end of the name with a hash of the full name
+func truncateName(name string, maxLength int) string {
+	if len(name) <= maxLength {
+		return name
 	}
-	return true
+	hash := fnv.New32a()
+	hash.Write([]byte(name))
+	suffix := fmt.Sprintf("-%08x", hash.Sum32())
+	// names and label values must end with an alphanumeric character
+	return strings.TrimRight(name[:maxLength-len(suffix)], "-._") + suffix
 }
 
-func istioEnvoyFilterName(workloadName, filterId string) string {
-	return workloadName + "-" + filterId
+// the namespace of the istio control plane, which istio uses as the root namespace by default
+func (p *Provider) istioNamespace() string {
+	if p.IstioNamespace == "" {
+		return defaultIstioNamespace
+	}
+	return p.IstioNamespace
+}
+
+// deletes the EnvoyFilter created for the filter in the root namespace by a mesh-wide deployment
+func (p *Provider) deleteMeshWideEnvoyFilter(filterId string) error {
+	err := p.Client.Delete(p.Ctx, &v1alpha3.EnvoyFilter{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: p.istioNamespace(),
+			Name:      filterId,
+		},
+	})
+	if err != nil && !kubeerrors.IsNotFound(err) {
+		return err
+	}
+
+	p.logger().WithFields(Fields{
+		"filter": filterId + "." + p.istioNamespace(),
+	}).Infof("deleted mesh-wide Istio EnvoyFilter resource")
+
+	return nil
 }
 
-// removes the filter from all selected workloads in selected namespaces
+// removes the filter from all selected workloads in selected namespaces.
+// if AtomicApply is set, the annotations of the workloads are restored if the filter
+// cannot be removed from every workload
 func (p *Provider) RemoveFilter(filter *v1.FilterSpec) error {
-	logger := logrus.WithFields(logrus.Fields{
+	err := p.removeFilter(filter)
+	p.Metrics.observeOperation(operationRemove, p.Workload, err)
+	p.updateManagedEnvoyFilters()
+	return err
+}
+
+func (p *Provider) removeFilter(filter *v1.FilterSpec) error {
+	p.expireIstioVersion()
+
+	var tx *transaction
+	if p.AtomicApply {
+		tx = &transaction{logger: p.logger()}
+	}
+
+	logger := p.logger().WithFields(Fields{
 		"filter": filter.Id,
 	})
 
-	logger.WithFields(logrus.Fields{
+	logger.WithFields(Fields{
 		"params": p.Workload,
-	}).Info("removing filter from one or more workloads...")
+	}).Infof("removing filter from one or more workloads...")
 
 	var workloads []string
-	// remove annotations from workload
-	err := p.forEachWorkload(func(meta metav1.ObjectMeta, spec *corev1.PodTemplateSpec) error {
+	// the states the filter was applied with, to prune their images from the cache
+	var applied []AppliedFilter
+	// remove annotations from workload, in the reverse order they were applied
+	err := p.updateEachWorkload(tx, true, func(meta metav1.ObjectMeta, spec *corev1.PodTemplateSpec) (bool, error) {
 		// collect the name of the workload so we can delete its filter
 		workloads = append(workloads, meta.Name)
 
-		logger := logger.WithFields(logrus.Fields{
+		logger := logger.WithFields(Fields{
 			"workload": meta.Name,
 		})
 
-		for k := range requiredSidecarAnnotations() {
-			delete(spec.Annotations, k)
-		}
-		logger.Info("removing sidecar annotations from workload")
-
-		// restore backup annotations
-		for k, v := range spec.Annotations {
-			if strings.HasPrefix(k, backupAnnotationPrefix) {
-				key := strings.TrimPrefix(k, backupAnnotationPrefix)
-				spec.Annotations[key] = v
-				delete(spec.Annotations, k)
+		logger.Infof("removing sidecar annotations from workload")
+		removeSidecarAnnotations(spec)
+		if _, err := removeAppliedFilters(spec, func(filterId string, state AppliedFilter) bool {
+			if filterId != filter.Id {
+				return false
 			}
+			applied = append(applied, state)
+			return true
+		}); err != nil {
+			return false, err
 		}
 
-		return nil
+		return true, nil
+	}, nil, func(workload selectedWorkload, err error) {
+		p.recordWorkloadEvent(workload, EventReasonFilterRemoved, "remove", "removed", filter, err)
 	})
 	if err != nil {
-		return errors.Wrap(err, "removing annotations from workload")
+		return tx.rollback(errors.Wrap(err, "removing annotations from workload"))
 	}
 
-	if p.ParentObject != nil {
+	if err := p.pruneSnapshots(filter.Id, workloads); err != nil {
+		return errors.Wrap(err, "pruning workload snapshots")
+	}
+
+	if err := p.deleteEnvoyFilters(logger, filter.Id, workloads); err != nil {
+		return err
+	}
+
+	if p.PruneCache {
+		return p.pruneAppliedImages(applied)
+	}
+	return nil
+}
+
+// deletes the EnvoyFilters of the filter, unless they are garbage collected with the ParentObject
+func (p *Provider) deleteEnvoyFilters(logger Logger, filterId string, workloads []string) error {
+	if p.MeshWide {
+		// the mesh-wide EnvoyFilter has no owner reference, so it is always deleted here
+		return p.deleteMeshWideEnvoyFilter(filterId)
+	}
+
+	if p.ParentObject != nil && !p.PruneCache {
 		// no need to remove the istio filters as they will be garbage collected
 		return nil
 	}
 
+	// delete every EnvoyFilter created for the filter,
+	// including those of workloads which are no longer selected or were renamed
+	envoyFilters, err := p.listEnvoyFilters(filterId, workloads)
+	if err != nil {
+		return errors.Wrap(err, "listing Istio EnvoyFilter resources")
+	}
+	deleted := map[string]bool{}
+	for _, filterName := range envoyFilters {
+		if err := p.deleteEnvoyFilter(logger, filterName); err != nil {
+			return err
+		}
+		deleted[filterName] = true
+	}
+
+	// EnvoyFilters created by older versions of wasme are not labeled, so fall back to their names
 	for _, workloadName := range workloads {
+		filterName := EnvoyFilterName(workloadName, filterId)
+		if deleted[filterName] {
+			continue
+		}
+		if err := p.deleteEnvoyFilter(logger, filterName); err != nil && !kubeerrors.IsNotFound(err) {
+			return err
+		}
+	}
 
-		filterName := istioEnvoyFilterName(workloadName, filter.Id)
+	return nil
+}
 
-		err = p.Client.Delete(p.Ctx, &v1alpha3.EnvoyFilter{
-			ObjectMeta: metav1.ObjectMeta{
-				Namespace: p.Workload.Namespace,
-				Name:      filterName,
-			},
-		})
-		if err != nil {
-			return err
+// removes the sidecar annotations written by wasme from the pod template,
+// restoring the values they replaced, and the volumes wasme added to gateways
+func removeSidecarAnnotations(spec *corev1.PodTemplateSpec) {
+	removeGatewayVolumes(spec)
+	for _, k := range sidecarAnnotationKeys {
+		// the annotations are not written if the proxies fetch the filters from the cache service
+		if value, ok := spec.Annotations[k]; ok && containsCacheVolume(k, value) {
+			delete(spec.Annotations, k)
+		}
+	}
+	delete(spec.Annotations, appliedAnnotation)
+
+	// restore backup annotations
+	for k, v := range spec.Annotations {
+		if strings.HasPrefix(k, backupAnnotationPrefix) {
+			key := strings.TrimPrefix(k, backupAnnotationPrefix)
+			spec.Annotations[key] = v
+			delete(spec.Annotations, k)
+		}
+	}
+}
+
+// returns the names of the EnvoyFilters labeled with the filter id in the workload namespace.
+// the EnvoyFilters of the given workloads come first, in the same order
+func (p *Provider) listEnvoyFilters(filterId string, workloads []string) ([]string, error) {
+	var envoyFilters v1alpha3.EnvoyFilterList
+	if err := p.Client.List(p.Ctx, &envoyFilters,
+		client.InNamespace(p.Workload.Namespace),
+		client.MatchingLabels{FilterIdLabel: truncateName(filterId, validation.LabelValueMaxLength)},
+	); err != nil {
+		return nil, err
+	}
+
+	order := map[string]int{}
+	for i, workloadName := range workloads {
+		order[truncateName(workloadName, validation.LabelValueMaxLength)] = i
+	}
+	position := func(envoyFilter v1alpha3.EnvoyFilter) int {
+		if i, ok := order[envoyFilter.Labels[WorkloadLabel]]; ok {
+			return i
 		}
+		return len(workloads)
+	}
+	items := envoyFilters.Items
+	sort.SliceStable(items, func(i, j int) bool {
+		if a, b := position(items[i]), position(items[j]); a != b {
+			return a < b
+		}
+		return items[i].Name < items[j].Name
+	})
 
-		logger.WithFields(logrus.Fields{
-			"filter": filterName,
-		}).Info("deleted Istio EnvoyFilter resource")
+	var names []string
+	for _, envoyFilter := range items {
+		names = append(names, envoyFilter.Name)
+	}
+	return names, nil
+}
+
+func (p *Provider) deleteEnvoyFilter(logger Logger, filterName string) error {
+	err := p.Client.Delete(p.Ctx, &v1alpha3.EnvoyFilter{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: p.Workload.Namespace,
+			Name:      filterName,
+		},
+	})
+	if err != nil {
+		return err
 	}
 
+	logger.WithFields(Fields{
+		"filter": filterName,
+	}).Infof("deleted Istio EnvoyFilter resource")
 	return nil
 }
 
+// returns the installed version of istio, only querying the cluster
+// if the version has not been detected since it was last expired
 func (p *Provider) getIstioVersion() (string, error) {
-	inspector := &versionInspector{
-		kube:           p.KubeClient,
-		istioNamespace: p.IstioNamespace,
+	p.istioVersionLock.Lock()
+	defer p.istioVersionLock.Unlock()
+
+	if p.istioVersion != nil {
+		return *p.istioVersion, nil
+	}
+
+	inspector := p.VersionInspector
+	if inspector == nil {
+		inspector = NewVersionInspector(p.KubeClient, p.IstioNamespace, p.IstioRevision, p.Workload.Namespace)
+	}
+	istioVersion, err := inspector.GetIstioVersion()
+	if err != nil {
+		return "", err
+	}
+
+	p.istioVersion = &istioVersion
+	p.istioVersionFetchedAt = time.Now()
+
+	return istioVersion, nil
+}
+
+// clears the memoized istio version, unless it is still within the IstioVersionTTL
+func (p *Provider) expireIstioVersion() {
+	p.istioVersionLock.Lock()
+	defer p.istioVersionLock.Unlock()
+
+	if p.IstioVersionTTL > 0 && time.Since(p.istioVersionFetchedAt) < p.IstioVersionTTL {
+		return
 	}
-	return inspector.GetIstioVersion()
+	p.istioVersion = nil
 }
@@ -1,9 +1,14 @@
 package istio_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/abi"
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
 	"github.com/solo-io/wasm/tools/wasme/pkg/config"
 	"github.com/solo-io/wasm/tools/wasme/pkg/consts"
@@ -11,6 +16,7 @@ import (
 	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
 	"github.com/solo-io/wasm/tools/wasme/pkg/resolver"
 
+	gogotypes "github.com/gogo/protobuf/types"
 	"github.com/golang/mock/gomock"
 	mock_ezkube "github.com/solo-io/skv2/pkg/ezkube/mocks"
 
@@ -25,16 +31,22 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	. "github.com/onsi/gomega/gstruct"
+	"github.com/onsi/gomega/types"
 	"github.com/opencontainers/go-digest"
 	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 	istiov1alpha3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
 	appsv1 "k8s.io/api/apps/v1"
 	kubev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
 
 	"istio.io/api/networking/v1alpha3"
 	networkingv1alpha3 "istio.io/api/networking/v1alpha3"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
 
@@ -65,7 +77,8 @@ var _ = Describe("IstioProvider", func() {
 		kube = kubernetes.NewForConfigOrDie(cfg)
 
 		ns = "istio-provider-test-" + randutils.RandString(4)
-		err := kubeutils.CreateNamespacesInParallel(kube, ns)
+		// the filter is only applied to workloads which run the sidecar
+		_, err := kube.CoreV1().Namespaces().Create(makeInjectedNamespace(ns))
 		Expect(err).NotTo(HaveOccurred())
 
 		ctx, c := context.WithCancel(context.Background())
@@ -119,6 +132,7 @@ var _ = Describe("IstioProvider", func() {
 				callbackCalled = true
 			},
 			"",
+			"",
 			0,
 			false,
 		)
@@ -130,7 +144,7 @@ var _ = Describe("IstioProvider", func() {
 		dep, err := kube.AppsV1().Deployments(workload.Namespace).Get(deployment.Name, metav1.GetOptions{})
 		Expect(err).NotTo(HaveOccurred())
 
-		Expect(dep.Spec.Template.Annotations).To(Equal(requiredSidecarAnnotations()))
+		Expect(dep.Spec.Template.Annotations).To(MatchAllKeys(appliedSidecarAnnotations()))
 
 		cacheConfig, err := kube.CoreV1().ConfigMaps(cache.Namespace).Get(cache.Name, metav1.GetOptions{})
 		Expect(err).NotTo(HaveOccurred())
@@ -140,7 +154,7 @@ var _ = Describe("IstioProvider", func() {
 		ef := &istiov1alpha3.EnvoyFilter{
 			ObjectMeta: metav1.ObjectMeta{
 				Namespace: workload.Namespace,
-				Name:      istioEnvoyFilterName(deployment.Name, filter.Id),
+				Name:      istio.EnvoyFilterName(deployment.Name, filter.Id),
 			},
 		}
 		err = client.Get(context.TODO(), ef)
@@ -180,17 +194,17 @@ var _ = Describe("IstioProvider", func() {
 		dep1, err = kube.AppsV1().Deployments(workload.Namespace).Get(dep1.Name, metav1.GetOptions{})
 		Expect(err).NotTo(HaveOccurred())
 
-		Expect(dep1.Spec.Template.Annotations).To(Equal(requiredSidecarAnnotations()))
+		Expect(dep1.Spec.Template.Annotations).To(MatchAllKeys(appliedSidecarAnnotations()))
 
 		dep2, err = kube.AppsV1().Deployments(workload.Namespace).Get(dep2.Name, metav1.GetOptions{})
 		Expect(err).NotTo(HaveOccurred())
 
-		Expect(dep1.Spec.Template.Annotations).To(Equal(requiredSidecarAnnotations()))
+		Expect(dep1.Spec.Template.Annotations).To(MatchAllKeys(appliedSidecarAnnotations()))
 
 		ef1 := &istiov1alpha3.EnvoyFilter{
 			ObjectMeta: metav1.ObjectMeta{
 				Namespace: workload.Namespace,
-				Name:      istioEnvoyFilterName(dep1.Name, filter.Id),
+				Name:      istio.EnvoyFilterName(dep1.Name, filter.Id),
 			},
 		}
 		err = client.Get(context.TODO(), ef1)
@@ -202,7 +216,7 @@ var _ = Describe("IstioProvider", func() {
 		ef2 := &istiov1alpha3.EnvoyFilter{
 			ObjectMeta: metav1.ObjectMeta{
 				Namespace: workload.Namespace,
-				Name:      istioEnvoyFilterName(dep2.Name, filter.Id),
+				Name:      istio.EnvoyFilterName(dep2.Name, filter.Id),
 			},
 		}
 		err = client.Get(context.TODO(), ef2)
@@ -316,7 +330,7 @@ var _ = Describe("IstioProvider", func() {
 		ef := &istiov1alpha3.EnvoyFilter{
 			ObjectMeta: metav1.ObjectMeta{
 				Namespace: workload.Namespace,
-				Name:      istioEnvoyFilterName(deployment.Name, obfilter.Id),
+				Name:      istio.EnvoyFilterName(deployment.Name, obfilter.Id),
 			},
 		}
 		err = client.Get(context.TODO(), ef)
@@ -326,6 +340,38 @@ var _ = Describe("IstioProvider", func() {
 		Expect(ef.Spec.ConfigPatches[0].Match.Context).To(Equal(networkingv1alpha3.EnvoyFilter_SIDECAR_OUTBOUND))
 	})
 
+	It("returns an error pointing at the cache flags when the cache workload cannot be found", func() {
+		workload := istio.Workload{
+			//all workloads
+			Namespace: ns,
+			Kind:      istio.WorkloadTypeDeployment,
+		}
+
+		p := &istio.Provider{
+			Ctx:                 context.TODO(),
+			KubeClient:          kube,
+			Client:              client,
+			Puller:              puller,
+			Workload:            workload,
+			Cache:               cache,
+			WaitForCacheTimeout: time.Second,
+		}
+
+		err := p.ApplyFilter(filter)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("--cache-kind"))
+
+		// use a new image, as the first is already present in the cache configmap
+		p.Cache.Kind = istio.WorkloadTypeDeployment
+		err = p.ApplyFilter(&wasmev1.FilterSpec{
+			Id:     "filter-id",
+			Image:  "filter/image:v2",
+			RootID: "root_id",
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("getting deployment for cache"))
+	})
+
 	// note: this test assumes istio 1.5 installed to cluster
 	It("returns an error when the image abi version does not support the istio version", func() {
 		workload := istio.Workload{
@@ -397,6 +443,7 @@ var _ = Describe("IstioProvider", func() {
 
 		// Since this filter won't actually work (it's not compatible),
 		// we need to remove it again so we're not messing up the cluster
+		client.EXPECT().List(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
 		client.EXPECT().Delete(gomock.Any(), gomock.Any()).Times(1)
 		p.RemoveFilter(incompatibleFilter)
 
@@ -409,6 +456,567 @@ var _ = Describe("IstioProvider", func() {
 	})
 })
 
+var _ = Describe("EnvoyFilter proxy version match", func() {
+	var (
+		provider     *testProvider
+		envoyFilters []*istiov1alpha3.EnvoyFilter
+		filter       = &wasmev1.FilterSpec{
+			Id:     "filter-id",
+			Image:  "filter/image:v1",
+			RootID: "root_id",
+		}
+	)
+
+	BeforeEach(func() {
+		envoyFilters = nil
+
+		provider = newTestProvider(makeDeployment("work", "default", nil))
+		provider.onEnsure = func(obj ezkube.Object) error {
+			if envoyFilter, ok := obj.(*istiov1alpha3.EnvoyFilter); ok {
+				envoyFilters = append(envoyFilters, envoyFilter)
+			}
+			return nil
+		}
+		provider.Puller.(*mockPuller).image.abiVersions = []string{
+			abi.Version_097b7f2e4cc1fb490cc1943d0d633655ac3c522f.Name,
+			abi.Version_4689a30309abf31aee9ae36e73d34b1bb182685f.Name,
+		}
+	})
+
+	It("only matches proxies running an istio version compatible with the image", func() {
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(envoyFilters).To(HaveLen(1))
+		for _, configPatch := range envoyFilters[0].Spec.ConfigPatches {
+			Expect(configPatch.Match.Proxy).To(Equal(&networkingv1alpha3.EnvoyFilter_ProxyMatch{
+				ProxyVersion: `^(1\.5\..*|1\.6\..*|1\.7\..*|1\.8\..*)$`,
+			}))
+		}
+	})
+
+	It("matches proxies of any version when the proxy version match is disabled", func() {
+		provider.DisableProxyVersionMatch = true
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(envoyFilters).To(HaveLen(1))
+		for _, configPatch := range envoyFilters[0].Spec.ConfigPatches {
+			Expect(configPatch.Match.Proxy).To(BeNil())
+		}
+	})
+
+	It("checks the abi versions inferred from the module if the image declares none", func() {
+		provider.Puller = &mockPuller{image: mockImage{
+			ref:    filter.Image,
+			digest: testImageDigest,
+			module: testutils.ProxyWasmModule("proxy_abi_version_0_2_0"),
+		}}
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(envoyFilters).To(HaveLen(1))
+		for _, configPatch := range envoyFilters[0].Spec.ConfigPatches {
+			Expect(configPatch.Match.Proxy).To(Equal(&networkingv1alpha3.EnvoyFilter_ProxyMatch{
+				ProxyVersion: `^(1\.7\..*|1\.8\..*)$`,
+			}))
+		}
+
+		provider.Puller.(*mockPuller).image.module = testutils.ProxyWasmModule("proxy_abi_version_0_1_0")
+		err = provider.ApplyFilter(filter)
+		Expect(err).To(BeAssignableToTypeOf(&istio.AbiIncompatibleError{}))
+	})
+
+	It("matches proxies of any version when the abi check is skipped", func() {
+		err := provider.ApplyFilter(&wasmev1.FilterSpec{
+			Id:             filter.Id,
+			Image:          filter.Image,
+			RootID:         filter.RootID,
+			IgnoreAbiCheck: true,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(envoyFilters).To(HaveLen(1))
+		for _, configPatch := range envoyFilters[0].Spec.ConfigPatches {
+			Expect(configPatch.Match.Proxy).To(BeNil())
+		}
+	})
+})
+
+var _ = Describe("EnvoyFilter names", func() {
+	var (
+		provider     *testProvider
+		envoyFilters []*istiov1alpha3.EnvoyFilter
+		deleted      []string
+		// the longest name allowed for a deployment
+		workloadName = strings.Repeat("w", 253)
+		filter       = &wasmev1.FilterSpec{
+			Id:     strings.Repeat("f", 100),
+			Image:  "filter/image:v1",
+			RootID: "root_id",
+		}
+	)
+
+	BeforeEach(func() {
+		envoyFilters = nil
+		deleted = nil
+
+		provider = newTestProvider(makeDeployment(workloadName, "default", nil))
+		provider.onEnsure = func(obj ezkube.Object) error {
+			if envoyFilter, ok := obj.(*istiov1alpha3.EnvoyFilter); ok {
+				envoyFilters = append(envoyFilters, envoyFilter)
+			}
+			return nil
+		}
+		provider.onDelete = func(obj ezkube.Object) error {
+			deleted = append(deleted, obj.GetName())
+			return nil
+		}
+	})
+
+	It("does not change names within the kubernetes limit", func() {
+		Expect(istio.EnvoyFilterName("work", "filter-id")).To(Equal("work-filter-id"))
+	})
+
+	It("truncates long names deterministically", func() {
+		name := istio.EnvoyFilterName(workloadName, filter.Id)
+		Expect(len(name)).To(Equal(253))
+		Expect(validation.IsDNS1123Subdomain(name)).To(BeEmpty())
+		Expect(istio.EnvoyFilterName(workloadName, filter.Id)).To(Equal(name))
+
+		// names sharing the truncated prefix are distinguished by the hash
+		Expect(istio.EnvoyFilterName(workloadName, filter.Id+"-2")).NotTo(Equal(name))
+	})
+
+	It("creates and deletes the EnvoyFilter with the truncated name", func() {
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(envoyFilters).To(HaveLen(1))
+		Expect(envoyFilters[0].Name).To(Equal(istio.EnvoyFilterName(workloadName, filter.Id)))
+
+		err = provider.RemoveFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deleted).To(Equal([]string{envoyFilters[0].Name}))
+	})
+
+	It("rejects filter ids which are not valid kubernetes names", func() {
+		err := provider.ApplyFilter(&wasmev1.FilterSpec{
+			Id:     "My_Filter",
+			Image:  filter.Image,
+			RootID: filter.RootID,
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(`filter id "My_Filter" must be a valid Kubernetes resource name`))
+		Expect(envoyFilters).To(BeEmpty())
+	})
+
+	It("accepts root ids which are not valid kubernetes names", func() {
+		err := provider.ApplyFilter(&wasmev1.FilterSpec{
+			Id:     "filter-id",
+			Image:  filter.Image,
+			RootID: "Stats_Root",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(envoyFilters).To(HaveLen(1))
+		Expect(envoyFilters[0].Name).To(Equal(istio.EnvoyFilterName(workloadName, "filter-id")))
+	})
+
+	It("labels the EnvoyFilter with the workload and filter id", func() {
+		err := provider.ApplyFilter(&wasmev1.FilterSpec{
+			Id:     "filter-id",
+			Image:  filter.Image,
+			RootID: filter.RootID,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(envoyFilters).To(HaveLen(1))
+		Expect(envoyFilters[0].Labels).To(HaveKeyWithValue(istio.FilterIdLabel, "filter-id"))
+		// label values longer than 63 characters are truncated
+		workloadLabel := envoyFilters[0].Labels[istio.WorkloadLabel]
+		Expect(workloadLabel).To(HavePrefix(strings.Repeat("w", 54)))
+		Expect(validation.IsValidLabelValue(workloadLabel)).To(BeEmpty())
+	})
+})
+
+var _ = Describe("EnvoyFilter removal", func() {
+	var (
+		kube     *fake.Clientset
+		provider *testProvider
+		// the EnvoyFilters in the cluster, by name
+		envoyFilters map[string]*istiov1alpha3.EnvoyFilter
+		deleted      []string
+		filter       = &wasmev1.FilterSpec{
+			Id:     "filter-id",
+			Image:  "filter/image:v1",
+			RootID: "root_id",
+		}
+	)
+
+	BeforeEach(func() {
+		deleted = nil
+
+		provider = newTestProvider(
+			makeDeployment("work-1", "default", nil),
+			makeDeployment("work-2", "default", nil),
+		)
+		kube = provider.kube
+		envoyFilters = provider.envoyFilters
+		provider.onDelete = func(obj ezkube.Object) error {
+			if _, ok := envoyFilters[obj.GetName()]; !ok {
+				return kubeerrors.NewNotFound(istiov1alpha3.Resource("envoyfilters"), obj.GetName())
+			}
+			deleted = append(deleted, obj.GetName())
+			return nil
+		}
+	})
+
+	It("labels the EnvoyFilters with a hash of the image", func() {
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(envoyFilters).To(HaveLen(2))
+		for _, envoyFilter := range envoyFilters {
+			imageLabel := envoyFilter.Labels[istio.ImageLabel]
+			Expect(imageLabel).To(HaveLen(32))
+			Expect(validation.IsValidLabelValue(imageLabel)).To(BeEmpty())
+			Expect(envoyFilter.Annotations).To(HaveKeyWithValue(istio.ImageLabel, filter.Image))
+		}
+	})
+
+	It("deletes the EnvoyFilters of workloads which are no longer selected", func() {
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = kube.AppsV1().Deployments("default").Delete("work-2", nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = provider.RemoveFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		// the EnvoyFilters of the selected workloads are deleted first
+		Expect(deleted).To(Equal([]string{
+			istio.EnvoyFilterName("work-1", filter.Id),
+			istio.EnvoyFilterName("work-2", filter.Id),
+		}))
+		Expect(envoyFilters).To(BeEmpty())
+	})
+
+	It("does not delete the EnvoyFilters of other filters", func() {
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		err = provider.ApplyFilter(&wasmev1.FilterSpec{
+			Id:     "other-filter",
+			Image:  filter.Image,
+			RootID: filter.RootID,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = provider.RemoveFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(envoyFilters).To(HaveLen(2))
+		Expect(envoyFilters).To(HaveKey(istio.EnvoyFilterName("work-1", "other-filter")))
+		Expect(envoyFilters).To(HaveKey(istio.EnvoyFilterName("work-2", "other-filter")))
+	})
+
+	It("deletes unlabeled EnvoyFilters by name", func() {
+		// created by an older version of wasme, for one of the workloads only
+		name := istio.EnvoyFilterName("work-1", filter.Id)
+		envoyFilters[name] = &istiov1alpha3.EnvoyFilter{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		}
+
+		err := provider.RemoveFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deleted).To(Equal([]string{name}))
+	})
+})
+
+var _ = Describe("Filter ordering", func() {
+	var (
+		provider *testProvider
+		// the EnvoyFilters in the cluster, by name
+		envoyFilters map[string]*istiov1alpha3.EnvoyFilter
+		inspector    *countingInspector
+	)
+
+	makeFilter := func(filterId string) *wasmev1.FilterSpec {
+		return &wasmev1.FilterSpec{
+			Id:     filterId,
+			Image:  "filter/image:v1",
+			RootID: "root_id",
+		}
+	}
+
+	BeforeEach(func() {
+		provider = newTestProvider(makeDeployment("work", "default", nil))
+		envoyFilters = provider.envoyFilters
+		inspector = provider.VersionInspector.(*countingInspector)
+	})
+
+	// returns the patch of the EnvoyFilter created for the filter
+	getPatch := func(filterId string) *networkingv1alpha3.EnvoyFilter_EnvoyConfigObjectPatch {
+		envoyFilter := envoyFilters[istio.EnvoyFilterName("work", filterId)]
+		Expect(envoyFilter).NotTo(BeNil())
+		Expect(envoyFilter.Spec.ConfigPatches).To(HaveLen(1))
+		return envoyFilter.Spec.ConfigPatches[0]
+	}
+	subFilter := func(patch *networkingv1alpha3.EnvoyFilter_EnvoyConfigObjectPatch) string {
+		return patch.Match.GetListener().GetFilterChain().GetFilter().GetSubFilter().GetName()
+	}
+
+	It("inserts the filter before the router with a unique name", func() {
+		err := provider.ApplyFilter(makeFilter("filter-a"))
+		Expect(err).NotTo(HaveOccurred())
+
+		patch := getPatch("filter-a")
+		Expect(patch.Patch.Operation).To(Equal(networkingv1alpha3.EnvoyFilter_Patch_INSERT_BEFORE))
+		Expect(subFilter(patch)).To(Equal("envoy.router"))
+		Expect(patch.Patch.Value.Fields["name"].GetStringValue()).To(Equal("wasme.filter-a"))
+	})
+
+	It("inserts the filter before another filter", func() {
+		err := provider.ApplyFilter(makeFilter("filter-a"))
+		Expect(err).NotTo(HaveOccurred())
+
+		filter := makeFilter("filter-b")
+		filter.OrderBefore = "filter-a"
+		err = provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		patch := getPatch("filter-b")
+		Expect(patch.Patch.Operation).To(Equal(networkingv1alpha3.EnvoyFilter_Patch_INSERT_BEFORE))
+		Expect(subFilter(patch)).To(Equal("wasme.filter-a"))
+	})
+
+	It("inserts the filter after another filter", func() {
+		err := provider.ApplyFilter(makeFilter("filter-a"))
+		Expect(err).NotTo(HaveOccurred())
+
+		filter := makeFilter("filter-b")
+		filter.OrderAfter = "filter-a"
+		err = provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		patch := getPatch("filter-b")
+		Expect(patch.Patch.Operation).To(Equal(networkingv1alpha3.EnvoyFilter_Patch_INSERT_AFTER))
+		Expect(subFilter(patch)).To(Equal("wasme.filter-a"))
+	})
+
+	It("lists the deployed filters if the referenced filter is not deployed", func() {
+		err := provider.ApplyFilter(makeFilter("filter-a"))
+		Expect(err).NotTo(HaveOccurred())
+
+		filter := makeFilter("filter-b")
+		filter.OrderBefore = "filter-c"
+		err = provider.ApplyFilter(filter)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("filter filter-c, which is not deployed to workload work. deployed filters: [filter-a]"))
+		Expect(envoyFilters).To(HaveLen(1))
+	})
+
+	It("rejects invalid orderings", func() {
+		filter := makeFilter("filter-b")
+		filter.OrderBefore = "filter-a"
+		filter.OrderAfter = "filter-a"
+		err := provider.ApplyFilter(filter)
+		Expect(err).To(HaveOccurred())
+
+		filter = makeFilter("filter-b")
+		filter.OrderAfter = "filter-b"
+		err = provider.ApplyFilter(filter)
+		Expect(err).To(HaveOccurred())
+		Expect(envoyFilters).To(BeEmpty())
+	})
+
+	It("requires Istio 1.7+ to order filters", func() {
+		inspector.version = "1.6.8"
+		err := provider.ApplyFilter(makeFilter("filter-a"))
+		Expect(err).NotTo(HaveOccurred())
+
+		filter := makeFilter("filter-b")
+		filter.OrderAfter = "filter-a"
+		err = provider.ApplyFilter(filter)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("requires Istio 1.7+"))
+	})
+})
+
+var _ = Describe("VM environment variables", func() {
+	var (
+		provider  *testProvider
+		inspector *countingInspector
+		filter    *wasmev1.FilterSpec
+	)
+
+	BeforeEach(func() {
+		provider = newTestProvider(makeDeployment("work", "default", nil))
+		inspector = provider.VersionInspector.(*countingInspector)
+		filter = &wasmev1.FilterSpec{
+			Id:     "filter-a",
+			Image:  "filter/image:v1",
+			RootID: "root_id",
+			Env:    map[string]string{"LOG_LEVEL": "debug"},
+		}
+	})
+
+	It("requires Istio 1.9+ to set environment variables", func() {
+		inspector.version = "1.8.2"
+		err := provider.ApplyFilter(filter)
+		Expect(err).To(MatchError(ContainSubstring("environment variables of the VM of filter filter-a require Istio 1.9+, found Istio 1.8.2")))
+		Expect(provider.envoyFilters).To(BeEmpty())
+	})
+
+	It("sets the environment variables with Istio 1.9+", func() {
+		inspector.version = "1.9.0"
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(provider.envoyFilters).To(HaveKey(istio.EnvoyFilterName("work", "filter-a")))
+	})
+})
+
+var _ = Describe("EnvoyFilter image digests", func() {
+	var (
+		provider     *testProvider
+		puller       *mockPuller
+		envoyFilters []*istiov1alpha3.EnvoyFilter
+		filter       = &wasmev1.FilterSpec{
+			Id:     "filter-id",
+			Image:  "filter/image:v1",
+			RootID: "root_id",
+		}
+		sha = "e454cab754cf9234e8b41d7c5e30f53a4c125d7d9443cb3ef2b2eb1c4bd1ec14"
+	)
+
+	BeforeEach(func() {
+		envoyFilters = nil
+
+		provider = newTestProvider(makeDeployment("work", "default", nil))
+		provider.onEnsure = func(obj ezkube.Object) error {
+			if envoyFilter, ok := obj.(*istiov1alpha3.EnvoyFilter); ok {
+				envoyFilters = append(envoyFilters, envoyFilter)
+			}
+			return nil
+		}
+		puller = provider.Puller.(*mockPuller)
+	})
+
+	It("points the EnvoyFilter at the file named by the normalized digest", func() {
+		puller.image.digest = "sha256:" + strings.ToUpper(sha)
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(envoyFilters).To(HaveLen(1))
+		spec, err := envoyFilters[0].Spec.Marshal()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(spec)).To(ContainSubstring("/var/local/lib/wasme-cache/" + sha))
+	})
+
+	It("rejects truncated digests", func() {
+		puller.image.digest = "sha256:" + sha[:12]
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(puller.image.digest))
+		Expect(envoyFilters).To(BeEmpty())
+	})
+})
+
+// records the parents of the EnvoyFilters ensured by the client
+type parentRecordingClient struct {
+	ezkube.Ensurer
+	parents []ezkube.Object
+}
+
+func (c *parentRecordingClient) Ensure(ctx context.Context, parent ezkube.Object, obj ezkube.Object, reconcileFuncs ...ezkube.ReconcileFunc) error {
+	if _, ok := obj.(*istiov1alpha3.EnvoyFilter); ok {
+		c.parents = append(c.parents, parent)
+	}
+	return c.Ensurer.Ensure(ctx, parent, obj, reconcileFuncs...)
+}
+
+var _ = Describe("mesh-wide EnvoyFilter", func() {
+	var (
+		kube         *fake.Clientset
+		provider     *testProvider
+		envoyFilters map[string]*istiov1alpha3.EnvoyFilter
+		client       *parentRecordingClient
+		deleted      []ezkube.Object
+		filter       = &wasmev1.FilterSpec{
+			Id:     "filter-id",
+			Image:  "filter/image:v1",
+			RootID: "root_id",
+		}
+	)
+
+	BeforeEach(func() {
+		deleted = nil
+
+		provider = newTestProvider(
+			makeDeployment("work-1", "default", nil),
+			makeDeployment("work-2", "default", nil),
+		)
+		kube = provider.kube
+		envoyFilters = provider.envoyFilters
+		client = &parentRecordingClient{Ensurer: provider.Client}
+		provider.Client = client
+		provider.onDelete = func(obj ezkube.Object) error {
+			deleted = append(deleted, obj)
+			return nil
+		}
+		// owner references cannot cross namespaces
+		provider.ParentObject = &wasmev1.FilterDeployment{ObjectMeta: metav1.ObjectMeta{Name: "parent", Namespace: "default"}}
+		provider.IstioNamespace = "istio-system"
+		provider.MeshWide = true
+	})
+
+	It("creates a single EnvoyFilter without a workload selector in the istio namespace", func() {
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(envoyFilters).To(HaveLen(1))
+		Expect(envoyFilters).To(HaveKey(filter.Id))
+		Expect(envoyFilters[filter.Id].Namespace).To(Equal("istio-system"))
+		Expect(envoyFilters[filter.Id].Spec.WorkloadSelector).To(BeNil())
+		Expect(client.parents).To(Equal([]ezkube.Object{nil}))
+
+		// the workloads are still annotated to mount the filter cache
+		for _, name := range []string{"work-1", "work-2"} {
+			workload, err := kube.AppsV1().Deployments("default").Get(name, metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(workload.Spec.Template.Annotations).To(MatchAllKeys(appliedSidecarAnnotations()))
+		}
+	})
+
+	It("deletes the mesh-wide EnvoyFilter on remove", func() {
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = provider.RemoveFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(deleted).To(HaveLen(1))
+		Expect(deleted[0].GetName()).To(Equal(filter.Id))
+		Expect(deleted[0].GetNamespace()).To(Equal("istio-system"))
+
+		workload, err := kube.AppsV1().Deployments("default").Get("work-1", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(workload.Spec.Template.Annotations).To(BeEmpty())
+	})
+})
+
+// returns a namespace with sidecar injection enabled
+func makeInjectedNamespace(name string) *kubev1.Namespace {
+	return &kubev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{"istio-injection": "enabled"},
+		},
+	}
+}
+
 func makeDeployment(workloadName, ns string, annotations map[string]string) *appsv1.Deployment {
 	return &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
@@ -442,6 +1050,124 @@ func makeDeployment(workloadName, ns string, annotations map[string]string) *app
 	}
 }
 
+// the digest of the image deployed by the providers of newTestProvider
+const testImageDigest = "sha256:e454cab754cf9234e8b41d7c5e30f53a4c125d7d9443cb3ef2b2eb1c4bd1ec14"
+
+// a Provider deploying to the Deployments of the default namespace, see newTestProvider
+type testProvider struct {
+	*istio.Provider
+	kube *fake.Clientset
+	// the EnvoyFilters ensured by the provider and not deleted since, by name
+	envoyFilters map[string]*istiov1alpha3.EnvoyFilter
+	// optional, called with each object before it is ensured. the object is not ensured if it returns an error
+	onEnsure func(obj ezkube.Object) error
+	// optional, called with each object before it is updated. the object is not updated if it returns an error
+	onUpdate func(obj ezkube.Object) error
+	// optional, called with each object before it is deleted. the object is not deleted if it returns an error
+	onDelete func(obj ezkube.Object) error
+}
+
+// returns a Provider of the filter/image:v1 image with the digest testImageDigest, for Istio 1.7.3,
+// deploying to the Deployments of the default namespace of a fake clientset with the objects.
+// the injected default namespace and the wasme-cache ConfigMap are added unless the objects include them.
+// the mock client persists the workloads it ensures to the clientset, and stores the EnvoyFilters in envoyFilters
+func newTestProvider(objs ...runtime.Object) *testProvider {
+	var hasNamespace, hasCache bool
+	for _, obj := range objs {
+		switch obj := obj.(type) {
+		case *kubev1.Namespace:
+			hasNamespace = hasNamespace || obj.Name == "default"
+		case *kubev1.ConfigMap:
+			hasCache = hasCache || obj.Name == "wasme-cache" && obj.Namespace == "wasme"
+		}
+	}
+	if !hasNamespace {
+		objs = append(objs, makeInjectedNamespace("default"))
+	}
+	if !hasCache {
+		objs = append(objs, &kubev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "wasme-cache",
+				Namespace: "wasme",
+			},
+		})
+	}
+
+	p := &testProvider{
+		kube:         fake.NewSimpleClientset(objs...),
+		envoyFilters: map[string]*istiov1alpha3.EnvoyFilter{},
+	}
+	client := mock_ezkube.NewMockEnsurer(gomock.NewController(GinkgoT()))
+	client.EXPECT().Ensure(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, _ ezkube.Object, obj ezkube.Object) error {
+		if p.onEnsure != nil {
+			if err := p.onEnsure(obj); err != nil {
+				return err
+			}
+		}
+		var err error
+		switch obj := obj.(type) {
+		case *appsv1.Deployment:
+			_, err = p.kube.AppsV1().Deployments(obj.Namespace).Update(obj)
+		case *appsv1.StatefulSet:
+			_, err = p.kube.AppsV1().StatefulSets(obj.Namespace).Update(obj)
+		case *appsv1.DaemonSet:
+			_, err = p.kube.AppsV1().DaemonSets(obj.Namespace).Update(obj)
+		case *istiov1alpha3.EnvoyFilter:
+			p.envoyFilters[obj.Name] = obj.DeepCopy()
+		}
+		return err
+	}).AnyTimes()
+	client.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, obj ezkube.Object, _ ...ezkube.ReconcileFunc) error {
+		if p.onUpdate != nil {
+			if err := p.onUpdate(obj); err != nil {
+				return err
+			}
+		}
+		if envoyFilter, ok := obj.(*istiov1alpha3.EnvoyFilter); ok {
+			p.envoyFilters[envoyFilter.Name] = envoyFilter.DeepCopy()
+		}
+		return nil
+	}).AnyTimes()
+	client.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, obj ezkube.Object) error {
+		existing, ok := p.envoyFilters[obj.GetName()]
+		envoyFilter, isEnvoyFilter := obj.(*istiov1alpha3.EnvoyFilter)
+		if !ok || !isEnvoyFilter {
+			return kubeerrors.NewNotFound(schema.GroupResource{}, obj.GetName())
+		}
+		existing.DeepCopyInto(envoyFilter)
+		return nil
+	}).AnyTimes()
+	client.EXPECT().List(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(listEnvoyFilters(&p.envoyFilters)).AnyTimes()
+	client.EXPECT().Delete(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, obj ezkube.Object) error {
+		if p.onDelete != nil {
+			if err := p.onDelete(obj); err != nil {
+				return err
+			}
+		}
+		delete(p.envoyFilters, obj.GetName())
+		return nil
+	}).AnyTimes()
+
+	p.Provider = &istio.Provider{
+		Ctx:        context.TODO(),
+		KubeClient: p.kube,
+		Client:     client,
+		Puller: &mockPuller{
+			image: mockImage{ref: "filter/image:v1", digest: testImageDigest},
+		},
+		Workload: istio.Workload{
+			Namespace: "default",
+			Kind:      istio.WorkloadTypeDeployment,
+		},
+		Cache: istio.Cache{
+			Name:      "wasme-cache",
+			Namespace: "wasme",
+		},
+		VersionInspector: &countingInspector{version: "1.7.3"},
+	}
+	return p
+}
+
 type mockPuller struct {
 	image mockImage
 }
@@ -451,14 +1177,25 @@ func (p *mockPuller) Pull(ctx context.Context, ref string) (pull.Image, error) {
 }
 
 type mockImage struct {
-	ref    string
-	digest string
+	ref         string
+	digest      string
+	abiVersions []string
+	// the digest of the image manifest, which the image is pinned to
+	manifestDigest string
+	// the config of filters deployed without one
+	defaultConfig *gogotypes.Value
+	// the module the abi versions are inferred from when the image declares none
+	module []byte
 }
 
 func (m *mockImage) Ref() string {
 	return m.ref
 }
 
+func (m *mockImage) ManifestDigest() digest.Digest {
+	return digest.Digest(m.manifestDigest)
+}
+
 func (m *mockImage) Descriptor() (v1.Descriptor, error) {
 	return v1.Descriptor{
 		Digest: digest.Digest(m.digest),
@@ -466,19 +1203,52 @@ func (m *mockImage) Descriptor() (v1.Descriptor, error) {
 }
 
 func (m *mockImage) FetchFilter(ctx context.Context) (model.Filter, error) {
-	panic("implement me")
+	if m.module == nil {
+		return nil, fmt.Errorf("the module of %v is not fetched by the test", m.ref)
+	}
+	return bytes.NewReader(m.module), nil
 }
 
 func (m *mockImage) FetchConfig(ctx context.Context) (*config.Runtime, error) {
-	return &config.Runtime{}, nil
+	return &config.Runtime{AbiVersions: m.abiVersions, DefaultConfig: m.defaultConfig}, nil
 }
 
-func pointerToInt64(value int64) *int64 {
-	return &value
+// a multi-variant image, whose content is the content of its default variant
+type mockVariantImage struct {
+	mockImage
+	variants []mockImage
+}
+
+type mockVariantPuller struct {
+	image *mockVariantImage
 }
 
-func istioEnvoyFilterName(workloadName, filterId string) string {
-	return workloadName + "-" + filterId
+func (p *mockVariantPuller) Pull(ctx context.Context, ref string) (pull.Image, error) {
+	return p.image, nil
+}
+
+func (m *mockVariantImage) Variants() []pull.Variant {
+	var variants []pull.Variant
+	for _, variant := range m.variants {
+		variants = append(variants, pull.Variant{
+			Manifest:    v1.Descriptor{Digest: digest.Digest(variant.manifestDigest)},
+			AbiVersions: variant.abiVersions,
+		})
+	}
+	return variants
+}
+
+func (m *mockVariantImage) SelectVariant(ctx context.Context, supported func(abiVersions []string) bool) (pull.ManifestImage, error) {
+	for i := range m.variants {
+		if supported(m.variants[i].abiVersions) {
+			return &m.variants[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no variant of image %v is supported", m.ref)
+}
+
+func pointerToInt64(value int64) *int64 {
+	return &value
 }
 
 // the sidecar annotations required on the pod
@@ -489,6 +1259,27 @@ func requiredSidecarAnnotations() map[string]string {
 	}
 }
 
+// the annotations on the pod after the filter is applied
+func appliedSidecarAnnotations() Keys {
+	annotations := Keys{
+		"wasme-applied":    Equal("true"),
+		"wasme.io/filters": recordsAppliedFilter(),
+	}
+	for k, v := range requiredSidecarAnnotations() {
+		annotations[k] = Equal(v)
+	}
+	return annotations
+}
+
+// matches the annotation recording the filters applied to a workload, if it records a single filter
+func recordsAppliedFilter() types.GomegaMatcher {
+	return WithTransform(func(value string) map[string]istio.AppliedFilter {
+		var applied map[string]istio.AppliedFilter
+		_ = json.Unmarshal([]byte(value), &applied)
+		return applied
+	}, HaveLen(1))
+}
+
 // the sidecar annotations already exist on the pod
 func customSidecarAnnotations() map[string]string {
 	return map[string]string{
@@ -503,5 +1294,7 @@ func mergedSidecarAnnotations() Keys {
 		"sidecar.istio.io/userVolumeMount":              MatchJSON(`[{"mountPath":"/tmp","name":"tmp-dir"},{"mountPath":"/var/local/lib/wasme-cache","name":"cache-dir"}]`),
 		"wasme-backup.sidecar.istio.io/userVolume":      MatchJSON(`[{"name":"tmp-dir","emptyDir":{}}]`),
 		"wasme-backup.sidecar.istio.io/userVolumeMount": MatchJSON(`[{"mountPath":"/tmp","name":"tmp-dir"}]`),
+		"wasme-applied":                                 Equal("true"),
+		"wasme.io/filters":                              recordsAppliedFilter(),
 	}
 }
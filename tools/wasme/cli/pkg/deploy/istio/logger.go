@@ -0,0 +1,124 @@
+package istio
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/go-logr/logr"
+	"github.com/sirupsen/logrus"
+)
+
+// Fields are the structured context added to the entries of a Logger
+type Fields map[string]interface{}
+
+// Logger is the logger used by the Provider.
+// use NewLogrusLogger or NewLogrLogger to adapt an existing logger
+type Logger interface {
+	// returns a Logger which adds the fields to every entry
+	WithFields(fields Fields) Logger
+	// returns a Logger which adds the error to every entry
+	WithError(err error) Logger
+
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// the logger used by providers without a Logger, for backward compatibility
+var defaultLogger = NewLogrusLogger(logrus.StandardLogger())
+
+// returns the Logger of the provider, defaulting to the global logrus logger
+func (p *Provider) logger() Logger {
+	if p.Logger == nil {
+		return defaultLogger
+	}
+	return p.Logger
+}
+
+// NewLogrusLogger adapts a logrus logger to a Logger
+func NewLogrusLogger(logger logrus.FieldLogger) Logger {
+	return &logrusLogger{logger: logger}
+}
+
+type logrusLogger struct {
+	logger logrus.FieldLogger
+}
+
+func (l *logrusLogger) WithFields(fields Fields) Logger {
+	return &logrusLogger{logger: l.logger.WithFields(logrus.Fields(fields))}
+}
+
+func (l *logrusLogger) WithError(err error) Logger {
+	return &logrusLogger{logger: l.logger.WithError(err)}
+}
+
+func (l *logrusLogger) Debugf(format string, args ...interface{}) {
+	l.logger.Debugf(format, args...)
+}
+
+func (l *logrusLogger) Infof(format string, args ...interface{}) {
+	l.logger.Infof(format, args...)
+}
+
+func (l *logrusLogger) Warnf(format string, args ...interface{}) {
+	l.logger.Warnf(format, args...)
+}
+
+func (l *logrusLogger) Errorf(format string, args ...interface{}) {
+	l.logger.Errorf(format, args...)
+}
+
+// NewLogrLogger adapts a logr logger, such as the controller-runtime logger, to a Logger.
+// debug entries are logged at verbosity 1. logr has no warning level,
+// so warnings are logged as info entries with their error attached
+func NewLogrLogger(logger logr.Logger) Logger {
+	return &logrLogger{logger: logger}
+}
+
+type logrLogger struct {
+	logger logr.Logger
+	err    error
+}
+
+func (l *logrLogger) WithFields(fields Fields) Logger {
+	// sort the keys so entries list their fields in a stable order
+	var keys []string
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var keysAndValues []interface{}
+	for _, key := range keys {
+		keysAndValues = append(keysAndValues, key, fields[key])
+	}
+	return &logrLogger{logger: l.logger.WithValues(keysAndValues...), err: l.err}
+}
+
+func (l *logrLogger) WithError(err error) Logger {
+	return &logrLogger{logger: l.logger, err: err}
+}
+
+// the error attached to the logger as key/value pairs, for info entries
+func (l *logrLogger) errorValues() []interface{} {
+	if l.err == nil {
+		return nil
+	}
+	return []interface{}{"error", l.err.Error()}
+}
+
+func (l *logrLogger) Debugf(format string, args ...interface{}) {
+	l.logger.V(1).Info(fmt.Sprintf(format, args...), l.errorValues()...)
+}
+
+func (l *logrLogger) Infof(format string, args ...interface{}) {
+	l.logger.Info(fmt.Sprintf(format, args...), l.errorValues()...)
+}
+
+func (l *logrLogger) Warnf(format string, args ...interface{}) {
+	l.logger.Info(fmt.Sprintf(format, args...), l.errorValues()...)
+}
+
+func (l *logrLogger) Errorf(format string, args ...interface{}) {
+	l.logger.Error(l.err, fmt.Sprintf(format, args...))
+}
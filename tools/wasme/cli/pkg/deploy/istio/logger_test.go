@@ -0,0 +1,137 @@
+package istio_test
+
+import (
+	"bytes"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cache"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	kubev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	zaputil "sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+type logEntry struct {
+	level   string
+	message string
+	fields  istio.Fields
+}
+
+// records the entries logged by the provider
+type recordingLogger struct {
+	entries *[]logEntry
+	fields  istio.Fields
+}
+
+func newRecordingLogger() *recordingLogger {
+	return &recordingLogger{entries: &[]logEntry{}, fields: istio.Fields{}}
+}
+
+func (l *recordingLogger) WithFields(fields istio.Fields) istio.Logger {
+	merged := istio.Fields{}
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return &recordingLogger{entries: l.entries, fields: merged}
+}
+
+func (l *recordingLogger) WithError(err error) istio.Logger {
+	return l.WithFields(istio.Fields{"error": err})
+}
+
+func (l *recordingLogger) log(level, format string) {
+	*l.entries = append(*l.entries, logEntry{level: level, message: format, fields: l.fields})
+}
+
+func (l *recordingLogger) Debugf(format string, _ ...interface{}) { l.log("debug", format) }
+func (l *recordingLogger) Infof(format string, _ ...interface{})  { l.log("info", format) }
+func (l *recordingLogger) Warnf(format string, _ ...interface{})  { l.log("warn", format) }
+func (l *recordingLogger) Errorf(format string, _ ...interface{}) { l.log("error", format) }
+
+// returns the entries logged with the message
+func (l *recordingLogger) withMessage(message string) []logEntry {
+	var entries []logEntry
+	for _, entry := range *l.entries {
+		if entry.message == message {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+var _ = Describe("Logger", func() {
+	const image = "filter/image:v1"
+
+	It("logs which nodes the cache wait is stuck on", func() {
+		imageEvent := func(name, node, reason string) *kubev1.Event {
+			return &kubev1.Event{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: "wasme",
+					Labels:    cache.EventLabels(image),
+				},
+				Reason:        reason,
+				Source:        kubev1.EventSource{Host: node},
+				LastTimestamp: metav1.Now(),
+			}
+		}
+		provider := newTestProvider(
+			&appsv1.DaemonSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "wasme-cache",
+					Namespace: "wasme",
+				},
+				Status: appsv1.DaemonSetStatus{NumberReady: 3},
+			},
+			imageEvent("ready", "node-a", cache.Reason_ImageAdded),
+			imageEvent("failed", "node-b", cache.Reason_ImageError),
+		)
+		logger := newRecordingLogger()
+		provider.Cache.Kind = istio.WorkloadTypeDaemonSet
+		provider.WaitForCacheTimeout = 1500 * time.Millisecond
+		provider.Logger = logger
+
+		err := provider.ApplyFilter(&wasmev1.FilterSpec{
+			Id:     "filter-id",
+			Image:  image,
+			RootID: "root_id",
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("timed out"))
+
+		failed := logger.withMessage("cache failed to pull image: %v")
+		Expect(failed).NotTo(BeEmpty())
+		Expect(failed[0].level).To(Equal("warn"))
+		Expect(failed[0].fields).To(HaveKeyWithValue("image", image))
+		Expect(failed[0].fields).To(HaveKeyWithValue("node", "node-b"))
+
+		waiting := logger.withMessage("waiting for the cache instances on the remaining nodes to pull the image")
+		Expect(waiting).NotTo(BeEmpty())
+		Expect(waiting[0].fields).To(HaveKeyWithValue("image", image))
+		Expect(waiting[0].fields).To(HaveKeyWithValue("expected", 3))
+		Expect(waiting[0].fields).To(HaveKeyWithValue("ready_nodes", []string{"node-a"}))
+	})
+
+	It("adapts logr loggers", func() {
+		var buf bytes.Buffer
+		logger := istio.NewLogrLogger(zaputil.New(zaputil.WriteTo(&buf)))
+
+		logger.WithFields(istio.Fields{"image": image}).WithError(errors.New("pull failed")).Errorf("failed to cache %v", "image")
+		Expect(buf.String()).To(ContainSubstring(`"msg":"failed to cache image"`))
+		Expect(buf.String()).To(ContainSubstring(`"image":"filter/image:v1"`))
+		Expect(buf.String()).To(ContainSubstring(`"error":"pull failed"`))
+
+		// debug entries are only logged at higher verbosity
+		buf.Reset()
+		logger.Debugf("cache ACK")
+		Expect(buf.String()).To(BeEmpty())
+	})
+})
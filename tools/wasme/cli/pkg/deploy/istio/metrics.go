@@ -0,0 +1,132 @@
+package istio
+
+import (
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"istio.io/client-go/pkg/apis/networking/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	metricsNamespace = "wasme"
+
+	operationApply  = "apply"
+	operationRemove = "remove"
+)
+
+// Metrics instruments the Provider with prometheus metrics.
+// Metrics are registered once and shared by every Provider; a nil *Metrics records nothing
+type Metrics struct {
+	operations            *prometheus.CounterVec
+	failures              *prometheus.CounterVec
+	pullDuration          prometheus.Histogram
+	cacheWaitDuration     prometheus.Histogram
+	workloadApplyDuration *prometheus.HistogramVec
+	managedEnvoyFilters   *prometheus.GaugeVec
+}
+
+// NewMetrics registers the metrics of the Provider with the registerer
+func NewMetrics(registerer prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "filter_operations_total",
+			Help:      "The number of attempts to apply or remove a filter.",
+		}, []string{"operation", "namespace", "kind"}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "filter_operation_failures_total",
+			Help:      "The number of attempts to apply or remove a filter which failed.",
+		}, []string{"operation", "namespace", "kind"}),
+		pullDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "image_pull_duration_seconds",
+			Help:      "The time taken to pull the filter image.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		cacheWaitDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "cache_wait_duration_seconds",
+			Help:      "The time taken waiting for the filter cache to pull the image.",
+			Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+		}),
+		workloadApplyDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "workload_apply_duration_seconds",
+			Help:      "The time taken to apply a filter to a single workload, including its rollout.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"namespace", "kind"}),
+		managedEnvoyFilters: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "managed_envoyfilters",
+			Help:      "The number of EnvoyFilters managed by wasme, updated after each apply or remove.",
+		}, []string{"namespace"}),
+	}
+
+	for _, collector := range []prometheus.Collector{
+		m.operations,
+		m.failures,
+		m.pullDuration,
+		m.cacheWaitDuration,
+		m.workloadApplyDuration,
+		m.managedEnvoyFilters,
+	} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// records an attempt to apply or remove a filter, and whether it failed
+func (m *Metrics) observeOperation(operation string, workload Workload, err error) {
+	if m == nil {
+		return
+	}
+	kind := strings.ToLower(workload.Kind)
+	m.operations.WithLabelValues(operation, workload.Namespace, kind).Inc()
+	if err != nil {
+		m.failures.WithLabelValues(operation, workload.Namespace, kind).Inc()
+	}
+}
+
+func (m *Metrics) observePull(start time.Time) {
+	if m == nil {
+		return
+	}
+	m.pullDuration.Observe(time.Since(start).Seconds())
+}
+
+func (m *Metrics) observeCacheWait(start time.Time) {
+	if m == nil {
+		return
+	}
+	m.cacheWaitDuration.Observe(time.Since(start).Seconds())
+}
+
+func (m *Metrics) observeWorkloadApply(workload Workload, start time.Time) {
+	if m == nil {
+		return
+	}
+	m.workloadApplyDuration.WithLabelValues(workload.Namespace, strings.ToLower(workload.Kind)).Observe(time.Since(start).Seconds())
+}
+
+// sets the number of EnvoyFilters managed by wasme in the namespace the provider writes them to.
+// only lists the EnvoyFilters if metrics are enabled
+func (p *Provider) updateManagedEnvoyFilters() {
+	if p.Metrics == nil {
+		return
+	}
+	namespace := p.Workload.Namespace
+	if p.MeshWide {
+		namespace = p.istioNamespace()
+	}
+	var envoyFilters v1alpha3.EnvoyFilterList
+	if err := p.Client.List(p.Ctx, &envoyFilters, client.InNamespace(namespace), client.HasLabels{FilterIdLabel}); err != nil {
+		p.logger().WithError(err).Warnf("failed to count the EnvoyFilters managed by wasme")
+		return
+	}
+	p.Metrics.managedEnvoyFilters.WithLabelValues(namespace).Set(float64(len(envoyFilters.Items)))
+}
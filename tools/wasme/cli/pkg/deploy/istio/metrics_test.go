@@ -0,0 +1,114 @@
+package istio_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/solo-io/skv2/pkg/ezkube"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	"github.com/solo-io/wasm/tools/wasme/cli/test/metricsutils"
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+var _ = Describe("Metrics", func() {
+	var (
+		registry *prometheus.Registry
+		provider *testProvider
+		// workloads which cannot be updated
+		failingWorkloads map[string]bool
+		filter           = &wasmev1.FilterSpec{
+			Id:     "filter-id",
+			Image:  "filter/image:v1",
+			RootID: "root_id",
+		}
+	)
+
+	BeforeEach(func() {
+		failingWorkloads = map[string]bool{}
+
+		provider = newTestProvider(
+			makeDeployment("a-work", "default", nil),
+			makeDeployment("b-work", "default", nil),
+		)
+		provider.onEnsure = func(obj ezkube.Object) error {
+			if workload, ok := obj.(*appsv1.Deployment); ok && failingWorkloads[workload.Name] {
+				return errors.New("update rejected")
+			}
+			return nil
+		}
+
+		registry = prometheus.NewRegistry()
+		var err error
+		provider.Metrics, err = istio.NewMetrics(registry)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	// returns the labels of the metric as a map
+	labelsOf := func(metric *dto.Metric) map[string]string {
+		labels := map[string]string{}
+		for _, label := range metric.GetLabel() {
+			labels[label.GetName()] = label.GetValue()
+		}
+		return labels
+	}
+
+	It("records applies and removes", func() {
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		operations := metricsutils.Gather(registry, "wasme_filter_operations_total")
+		Expect(operations).To(HaveLen(1))
+		Expect(labelsOf(operations[0])).To(Equal(map[string]string{"operation": "apply", "namespace": "default", "kind": "deployment"}))
+		Expect(operations[0].GetCounter().GetValue()).To(Equal(1.0))
+		Expect(metricsutils.Gather(registry, "wasme_filter_operation_failures_total")).To(BeEmpty())
+
+		pulls := metricsutils.Gather(registry, "wasme_image_pull_duration_seconds")
+		Expect(pulls).To(HaveLen(1))
+		Expect(pulls[0].GetHistogram().GetSampleCount()).To(Equal(uint64(1)))
+		cacheWaits := metricsutils.Gather(registry, "wasme_cache_wait_duration_seconds")
+		Expect(cacheWaits).To(HaveLen(1))
+		Expect(cacheWaits[0].GetHistogram().GetSampleCount()).To(Equal(uint64(1)))
+		workloadApplies := metricsutils.Gather(registry, "wasme_workload_apply_duration_seconds")
+		Expect(workloadApplies).To(HaveLen(1))
+		Expect(workloadApplies[0].GetHistogram().GetSampleCount()).To(Equal(uint64(2)))
+
+		managed := metricsutils.Gather(registry, "wasme_managed_envoyfilters")
+		Expect(managed).To(HaveLen(1))
+		Expect(labelsOf(managed[0])).To(Equal(map[string]string{"namespace": "default"}))
+		Expect(managed[0].GetGauge().GetValue()).To(Equal(2.0))
+
+		err = provider.RemoveFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(metricsutils.Gather(registry, "wasme_filter_operations_total")).To(HaveLen(2))
+		Expect(metricsutils.Gather(registry, "wasme_managed_envoyfilters")[0].GetGauge().GetValue()).To(Equal(0.0))
+	})
+
+	It("records failed applies", func() {
+		failingWorkloads["b-work"] = true
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).To(HaveOccurred())
+
+		failures := metricsutils.Gather(registry, "wasme_filter_operation_failures_total")
+		Expect(failures).To(HaveLen(1))
+		Expect(labelsOf(failures[0])).To(Equal(map[string]string{"operation": "apply", "namespace": "default", "kind": "deployment"}))
+		Expect(failures[0].GetCounter().GetValue()).To(Equal(1.0))
+
+		// the failed workload is still timed
+		Expect(metricsutils.Gather(registry, "wasme_workload_apply_duration_seconds")[0].GetHistogram().GetSampleCount()).To(Equal(uint64(2)))
+		// the EnvoyFilter of the failed workload is created before its update is rejected
+		Expect(metricsutils.Gather(registry, "wasme_managed_envoyfilters")[0].GetGauge().GetValue()).To(Equal(2.0))
+	})
+
+	It("records nothing without metrics", func() {
+		provider.Metrics = nil
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(metricsutils.Gather(registry, "wasme_filter_operations_total")).To(BeEmpty())
+	})
+})
@@ -0,0 +1,134 @@
+package istio
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Cluster is a named cluster to which a MultiClusterProvider deploys filters.
+// the Provider holds the clients and istio namespace of the cluster,
+// so the abi compatibility of the filter is checked separately in each cluster
+type Cluster struct {
+	Name     string
+	Provider *Provider
+}
+
+// MultiClusterProvider applies filters to the selected workloads of several clusters
+type MultiClusterProvider struct {
+	Clusters []Cluster
+}
+
+// NewMultiClusterProvider returns a provider for the given clusters.
+// if set, onWorkload is called with the name of the cluster for every workload the filter is applied to (or removed from),
+// in addition to the OnWorkload callback of the cluster's Provider
+func NewMultiClusterProvider(clusters []Cluster, onWorkload func(cluster string, workloadMeta metav1.ObjectMeta, err error)) *MultiClusterProvider {
+	if onWorkload != nil {
+		for _, cluster := range clusters {
+			cluster := cluster
+			clusterOnWorkload := cluster.Provider.OnWorkload
+			cluster.Provider.OnWorkload = func(workloadMeta metav1.ObjectMeta, err error) {
+				if clusterOnWorkload != nil {
+					clusterOnWorkload(workloadMeta, err)
+				}
+				onWorkload(cluster.Name, workloadMeta, err)
+			}
+		}
+	}
+	return &MultiClusterProvider{Clusters: clusters}
+}
+
+// MultiClusterError is returned when a filter could not be applied to (or removed from) every cluster
+type MultiClusterError struct {
+	// the clusters which succeeded, in the order they were updated
+	Succeeded []string
+	// the clusters which failed, in the order they were updated
+	Failed []ClusterFailure
+}
+
+// ClusterFailure is the error returned by the Provider of a cluster
+type ClusterFailure struct {
+	Cluster string
+	Err     error
+}
+
+func (e *MultiClusterError) Error() string {
+	var failures []string
+	for _, failure := range e.Failed {
+		failures = append(failures, fmt.Sprintf("cluster %v: %v", failure.Cluster, failure.Err))
+	}
+	succeeded := "none"
+	if len(e.Succeeded) > 0 {
+		succeeded = strings.Join(e.Succeeded, ", ")
+	}
+	return fmt.Sprintf("failed in %v of %v clusters (succeeded: %v): %v",
+		len(e.Failed), len(e.Failed)+len(e.Succeeded), succeeded, strings.Join(failures, "; "))
+}
+
+// applies the filter to every cluster, continuing past the clusters which fail
+func (p *MultiClusterProvider) ApplyFilter(filter *v1.FilterSpec) error {
+	_, err := p.ApplyResolvedFilter(filter)
+	return err
+}
+
+// ApplyResolvedFilter implements deploy.ConfigResolver.
+// the clusters resolve the same config, so the checksum of any cluster the filter was applied to is returned
+func (p *MultiClusterProvider) ApplyResolvedFilter(filter *v1.FilterSpec) (string, error) {
+	var configChecksum string
+	err := p.forEachCluster("applied filter", func(provider *Provider) error {
+		checksum, err := provider.ApplyResolvedFilter(filter)
+		if err == nil && checksum != "" {
+			configChecksum = checksum
+		}
+		return err
+	})
+	return configChecksum, err
+}
+
+// removes the filter from every cluster, continuing past the clusters which fail
+func (p *MultiClusterProvider) RemoveFilter(filter *v1.FilterSpec) error {
+	return p.forEachCluster("removed filter", func(provider *Provider) error {
+		return provider.RemoveFilter(filter)
+	})
+}
+
+// lists the filters of every cluster whose id starts with the prefix, with the cluster of each filter.
+// fails if the filters of any cluster could not be listed
+func (p *MultiClusterProvider) ListFilters(idPrefix string) ([]DeployedFilter, error) {
+	var deployed []DeployedFilter
+	for _, cluster := range p.Clusters {
+		filters, err := cluster.Provider.ListFilters(idPrefix)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cluster %v", cluster.Name)
+		}
+		for _, filter := range filters {
+			filter.Cluster = cluster.Name
+			deployed = append(deployed, filter)
+		}
+	}
+	deploy.SortDeployedFilters(deployed)
+	return deployed, nil
+}
+
+func (p *MultiClusterProvider) forEachCluster(action string, do func(provider *Provider) error) error {
+	result := &MultiClusterError{}
+	for _, cluster := range p.Clusters {
+		logger := logrus.WithField("cluster", cluster.Name)
+		if err := do(cluster.Provider); err != nil {
+			logger.WithError(err).Error("failed in cluster")
+			result.Failed = append(result.Failed, ClusterFailure{Cluster: cluster.Name, Err: err})
+			continue
+		}
+		logger.Info(action + " in cluster")
+		result.Succeeded = append(result.Succeeded, cluster.Name)
+	}
+	if len(result.Failed) > 0 {
+		return result
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package istio_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/skv2/pkg/ezkube"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/abi"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	istiov1alpha3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("MultiClusterProvider", func() {
+	var (
+		// the EnvoyFilters created in each cluster
+		envoyFilters map[string][]*istiov1alpha3.EnvoyFilter
+		// the workloads reported to the callback, as <cluster>/<workload>
+		workloads []string
+		filter    = &wasmev1.FilterSpec{
+			Id:     "filter-id",
+			Image:  "filter/image:v1",
+			RootID: "root_id",
+		}
+	)
+
+	makeCluster := func(name, istioVersion string) istio.Cluster {
+		provider := newTestProvider(makeDeployment("work", "default", nil))
+		provider.onEnsure = func(obj ezkube.Object) error {
+			if envoyFilter, ok := obj.(*istiov1alpha3.EnvoyFilter); ok {
+				envoyFilters[name] = append(envoyFilters[name], envoyFilter)
+			}
+			return nil
+		}
+		provider.Puller.(*mockPuller).image.abiVersions = []string{
+			abi.Version_097b7f2e4cc1fb490cc1943d0d633655ac3c522f.Name,
+			abi.Version_4689a30309abf31aee9ae36e73d34b1bb182685f.Name,
+		}
+		provider.VersionInspector = &countingInspector{version: istioVersion}
+
+		return istio.Cluster{
+			Name:     name,
+			Provider: provider.Provider,
+		}
+	}
+
+	BeforeEach(func() {
+		envoyFilters = map[string][]*istiov1alpha3.EnvoyFilter{}
+		workloads = nil
+	})
+
+	makeProvider := func(clusters ...istio.Cluster) *istio.MultiClusterProvider {
+		return istio.NewMultiClusterProvider(clusters, func(cluster string, workloadMeta metav1.ObjectMeta, err error) {
+			workloads = append(workloads, cluster+"/"+workloadMeta.Name)
+		})
+	}
+
+	It("applies the filter to the workloads of every cluster", func() {
+		provider := makeProvider(makeCluster("east", "1.7.3"), makeCluster("west", "1.6.0"))
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(envoyFilters["east"]).To(HaveLen(1))
+		Expect(envoyFilters["west"]).To(HaveLen(1))
+		Expect(workloads).To(Equal([]string{"east/work", "west/work"}))
+	})
+
+	It("checks the abi compatibility in each cluster, and reports the clusters which succeeded", func() {
+		provider := makeProvider(makeCluster("east", "1.7.3"), makeCluster("old", "1.4.6"), makeCluster("west", "1.6.0"))
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).To(HaveOccurred())
+
+		multiClusterErr, ok := err.(*istio.MultiClusterError)
+		Expect(ok).To(BeTrue())
+		Expect(multiClusterErr.Succeeded).To(Equal([]string{"east", "west"}))
+		Expect(multiClusterErr.Failed).To(HaveLen(1))
+		Expect(multiClusterErr.Failed[0].Cluster).To(Equal("old"))
+		Expect(err.Error()).To(ContainSubstring("failed in 1 of 3 clusters (succeeded: east, west): cluster old: "))
+
+		// the remaining clusters are still updated
+		Expect(envoyFilters["east"]).To(HaveLen(1))
+		Expect(envoyFilters["old"]).To(BeEmpty())
+		Expect(envoyFilters["west"]).To(HaveLen(1))
+	})
+
+	It("keeps the callback of the cluster's provider", func() {
+		var clusterWorkloads []string
+		cluster := makeCluster("east", "1.7.3")
+		cluster.Provider.OnWorkload = func(workloadMeta metav1.ObjectMeta, err error) {
+			clusterWorkloads = append(clusterWorkloads, workloadMeta.Name)
+		}
+
+		err := makeProvider(cluster).ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clusterWorkloads).To(Equal([]string{"work"}))
+		Expect(workloads).To(Equal([]string{"east/work"}))
+	})
+})
@@ -0,0 +1,94 @@
+package istio_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	networkingv1alpha3 "istio.io/api/networking/v1alpha3"
+	istiov1alpha3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
+)
+
+var _ = Describe("Network filters", func() {
+	var (
+		provider     *testProvider
+		inspector    *countingInspector
+		envoyFilters map[string]*istiov1alpha3.EnvoyFilter
+	)
+
+	makeFilter := func(patchContext string) *wasmev1.FilterSpec {
+		return &wasmev1.FilterSpec{
+			Id:           "tcp-filter",
+			Image:        "filter/image:v1",
+			RootID:       "root_id",
+			PatchContext: patchContext,
+			FilterType:   istio.FilterTypeNetwork,
+		}
+	}
+
+	BeforeEach(func() {
+		provider = newTestProvider(makeDeployment("work", "default", nil))
+		envoyFilters = provider.envoyFilters
+		inspector = provider.VersionInspector.(*countingInspector)
+	})
+
+	// returns the patch of the EnvoyFilter created for the filter
+	getPatch := func() *networkingv1alpha3.EnvoyFilter_EnvoyConfigObjectPatch {
+		envoyFilter := envoyFilters[istio.EnvoyFilterName("work", "tcp-filter")]
+		Expect(envoyFilter).NotTo(BeNil())
+		Expect(envoyFilter.Spec.ConfigPatches).To(HaveLen(1))
+		return envoyFilter.Spec.ConfigPatches[0]
+	}
+
+	table.DescribeTable("inserts the filter before the tcp_proxy filter",
+		func(patchContext string, expectedContext networkingv1alpha3.EnvoyFilter_PatchContext) {
+			err := provider.ApplyFilter(makeFilter(patchContext))
+			Expect(err).NotTo(HaveOccurred())
+
+			patch := getPatch()
+			Expect(patch.ApplyTo).To(Equal(networkingv1alpha3.EnvoyFilter_NETWORK_FILTER))
+			Expect(patch.Patch.Operation).To(Equal(networkingv1alpha3.EnvoyFilter_Patch_INSERT_BEFORE))
+			Expect(patch.Match.Context).To(Equal(expectedContext))
+			filterMatch := patch.Match.GetListener().GetFilterChain().GetFilter()
+			Expect(filterMatch.GetName()).To(Equal("envoy.tcp_proxy"))
+			Expect(filterMatch.GetSubFilter()).To(BeNil())
+
+			value := patch.Patch.Value.Fields
+			Expect(value["name"].GetStringValue()).To(Equal("wasme.tcp-filter"))
+			typedConfig := value["typedConfig"].GetStructValue().Fields
+			Expect(typedConfig["typeUrl"].GetStringValue()).To(Equal("type.googleapis.com/envoy.extensions.filters.network.wasm.v3.Wasm"))
+			pluginConfig := typedConfig["value"].GetStructValue().Fields["config"].GetStructValue().Fields
+			Expect(pluginConfig["rootId"].GetStringValue()).To(Equal("root_id"))
+		},
+		table.Entry("sidecar inbound", istio.PatchContextInbound, networkingv1alpha3.EnvoyFilter_SIDECAR_INBOUND),
+		table.Entry("sidecar outbound", istio.PatchContextOutbound, networkingv1alpha3.EnvoyFilter_SIDECAR_OUTBOUND),
+		table.Entry("gateway", istio.PatchContextGateway, networkingv1alpha3.EnvoyFilter_GATEWAY),
+	)
+
+	It("creates untyped network filters for older versions of Istio", func() {
+		inspector.version = "1.6.8"
+		err := provider.ApplyFilter(makeFilter(istio.PatchContextGateway))
+		Expect(err).NotTo(HaveOccurred())
+
+		patch := getPatch()
+		Expect(patch.ApplyTo).To(Equal(networkingv1alpha3.EnvoyFilter_NETWORK_FILTER))
+		Expect(patch.Match.Context).To(Equal(networkingv1alpha3.EnvoyFilter_GATEWAY))
+		Expect(patch.Match.GetListener().GetFilterChain().GetFilter().GetName()).To(Equal("envoy.tcp_proxy"))
+		Expect(patch.Patch.Value.Fields["name"].GetStringValue()).To(Equal("envoy.filters.network.wasm"))
+		Expect(patch.Patch.Value.Fields["config"].GetStructValue().Fields["config"].GetStructValue().Fields["rootId"].GetStringValue()).To(Equal("root_id"))
+	})
+
+	It("leaves http filters in the HTTP filter chain", func() {
+		filter := makeFilter(istio.PatchContextInbound)
+		filter.FilterType = istio.FilterTypeHttp
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		patch := getPatch()
+		Expect(patch.ApplyTo).To(Equal(networkingv1alpha3.EnvoyFilter_HTTP_FILTER))
+		filterMatch := patch.Match.GetListener().GetFilterChain().GetFilter()
+		Expect(filterMatch.GetName()).To(Equal("envoy.http_connection_manager"))
+		Expect(filterMatch.GetSubFilter().GetName()).To(Equal("envoy.router"))
+	})
+})
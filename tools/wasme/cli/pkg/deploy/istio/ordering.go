@@ -0,0 +1,131 @@
+package istio
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/solo-io/skv2/pkg/ezkube"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	WorkloadOrderName     = "name"
+	WorkloadOrderReplicas = "replicas"
+	// followed by the label key, e.g. label:wasme.io/order
+	WorkloadOrderLabelPrefix = "label:"
+)
+
+var SupportedWorkloadOrders = []string{
+	WorkloadOrderName,
+	WorkloadOrderReplicas,
+	WorkloadOrderLabelPrefix + "<label key>",
+}
+
+// a workload selected by the Provider
+type WorkloadInfo struct {
+	Meta metav1.ObjectMeta
+	// the desired number of pods of the workload
+	Replicas int32
+}
+
+// WorkloadOrdering defines the order in which the Provider applies filters to workloads.
+// filters are removed from workloads in the reverse order.
+// ties are broken by workload name, so the order is deterministic
+type WorkloadOrdering interface {
+	// returns true if workload a should be visited before workload b
+	Less(a, b WorkloadInfo) bool
+}
+
+// visits workloads in alphabetical order
+type OrderByName struct{}
+
+func (OrderByName) Less(a, b WorkloadInfo) bool {
+	return a.Meta.Name < b.Meta.Name
+}
+
+// visits the workloads with the fewest replicas first
+type OrderByReplicas struct{}
+
+func (OrderByReplicas) Less(a, b WorkloadInfo) bool {
+	return a.Replicas < b.Replicas
+}
+
+// visits workloads in ascending order of the integer value of a label.
+// workloads without the label, or with a non-integer value, are visited last
+type OrderByLabel struct {
+	Label string
+}
+
+func (o OrderByLabel) Less(a, b WorkloadInfo) bool {
+	aOrder, aOk := o.order(a)
+	bOrder, bOk := o.order(b)
+	if aOk && bOk {
+		return aOrder < bOrder
+	}
+	return aOk && !bOk
+}
+
+func (o OrderByLabel) order(workload WorkloadInfo) (int, bool) {
+	value, ok := workload.Meta.Labels[o.Label]
+	if !ok {
+		return 0, false
+	}
+	order, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, false
+	}
+	return order, true
+}
+
+// ParseWorkloadOrdering returns the built-in WorkloadOrdering with the given name.
+// an empty name returns OrderByName
+func ParseWorkloadOrdering(name string) (WorkloadOrdering, error) {
+	switch {
+	case name == "" || name == WorkloadOrderName:
+		return OrderByName{}, nil
+	case name == WorkloadOrderReplicas:
+		return OrderByReplicas{}, nil
+	case strings.HasPrefix(name, WorkloadOrderLabelPrefix):
+		label := strings.TrimPrefix(name, WorkloadOrderLabelPrefix)
+		if label == "" {
+			return nil, errors.Errorf("workload order %v must specify a label key", name)
+		}
+		return OrderByLabel{Label: label}, nil
+	default:
+		return nil, errors.Errorf("unknown workload order %v, must be one of the following values: %s", name, strings.Join(SupportedWorkloadOrders, ", "))
+	}
+}
+
+// a workload to visit, along with the object to update
+type selectedWorkload struct {
+	info     WorkloadInfo
+	template *corev1.PodTemplateSpec
+	object   ezkube.Object
+	// if set, writes the template back to the object before it is updated,
+	// for objects which do not embed the template
+	syncTemplate func() error
+}
+
+// sorts the workloads by the ordering, breaking ties by name.
+// reverses the order if reverse is true
+func sortWorkloads(workloads []selectedWorkload, ordering WorkloadOrdering, reverse bool) {
+	if ordering == nil {
+		ordering = OrderByName{}
+	}
+	sort.SliceStable(workloads, func(i, j int) bool {
+		a, b := workloads[i].info, workloads[j].info
+		if reverse {
+			a, b = b, a
+		}
+		if ordering.Less(a, b) {
+			return true
+		}
+		if ordering.Less(b, a) {
+			return false
+		}
+		return a.Meta.Name < b.Meta.Name
+	})
+}
@@ -0,0 +1,143 @@
+package istio_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"github.com/solo-io/skv2/pkg/ezkube"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var _ = Describe("Workload ordering", func() {
+	var (
+		provider *testProvider
+		applied  []string
+		updated  []string
+		deleted  []string
+		filter   = &wasmev1.FilterSpec{
+			Id:     "filter-id",
+			Image:  "filter/image:v1",
+			RootID: "root_id",
+		}
+	)
+
+	BeforeEach(func() {
+		applied = nil
+		updated = nil
+		deleted = nil
+
+		provider = newTestProvider(
+			// created out of order, so the list order does not match any of the orderings
+			makeOrderedDeployment("e", 2, "x"),
+			makeOrderedDeployment("c", 3, ""),
+			makeOrderedDeployment("a", 3, "2"),
+			makeOrderedDeployment("d", 1, "1"),
+			makeOrderedDeployment("b", 1, "1"),
+		)
+		provider.onEnsure = func(obj ezkube.Object) error {
+			if workload, ok := obj.(*appsv1.Deployment); ok {
+				updated = append(updated, workload.Name)
+			}
+			return nil
+		}
+		provider.onDelete = func(obj ezkube.Object) error {
+			deleted = append(deleted, obj.GetName())
+			return nil
+		}
+		provider.OnWorkload = func(workloadMeta metav1.ObjectMeta, err error) {
+			Expect(err).NotTo(HaveOccurred())
+			applied = append(applied, workloadMeta.Name)
+		}
+	})
+
+	reversed := func(names []string) []string {
+		var out []string
+		for i := len(names) - 1; i >= 0; i-- {
+			out = append(out, names[i])
+		}
+		return out
+	}
+
+	envoyFilterNames := func(names []string) []string {
+		var out []string
+		for _, name := range names {
+			out = append(out, istio.EnvoyFilterName(name, filter.Id))
+		}
+		return out
+	}
+
+	// applies and removes the filter, expecting the workloads to be visited in the given order
+	expectOrder := func(order string, expected ...string) {
+		var err error
+		provider.WorkloadOrdering, err = istio.ParseWorkloadOrdering(order)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(applied).To(Equal(expected))
+		Expect(updated).To(Equal(expected))
+
+		updated = nil
+		err = provider.RemoveFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(updated).To(Equal(reversed(expected)))
+		Expect(deleted).To(Equal(envoyFilterNames(reversed(expected))))
+	}
+
+	It("visits the workloads by name by default", func() {
+		expectOrder("", "a", "b", "c", "d", "e")
+	})
+
+	It("visits the workloads by name", func() {
+		expectOrder(istio.WorkloadOrderName, "a", "b", "c", "d", "e")
+	})
+
+	It("visits the workloads by replicas, breaking ties by name", func() {
+		expectOrder(istio.WorkloadOrderReplicas, "b", "d", "e", "a", "c")
+	})
+
+	It("visits the workloads by label, breaking ties by name", func() {
+		// c has no label and e has a non-integer value, so both are visited last
+		expectOrder(istio.WorkloadOrderLabelPrefix+"order", "b", "d", "a", "c", "e")
+	})
+
+	It("only visits the workload with the name, if set", func() {
+		provider.Workload.Name = "c"
+		expectOrder("", "c")
+	})
+
+	It("returns the error of listing the workloads", func() {
+		provider.Workload.Kind = istio.WorkloadTypeStatefulSet
+		provider.kube.PrependReactor("list", "statefulsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.Errorf("connection refused")
+		})
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("listing StatefulSets in namespace default: connection refused"))
+		Expect(applied).To(BeEmpty())
+		Expect(provider.envoyFilters).To(BeEmpty())
+	})
+
+	It("rejects unknown orderings", func() {
+		_, err := istio.ParseWorkloadOrdering("traffic")
+		Expect(err).To(HaveOccurred())
+		_, err = istio.ParseWorkloadOrdering(istio.WorkloadOrderLabelPrefix)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+// a deployment with the given replicas and value of the order label, unlabeled if order is empty
+func makeOrderedDeployment(workloadName string, replicas int32, order string) *appsv1.Deployment {
+	workload := makeDeployment(workloadName, "default", nil)
+	workload.Spec.Replicas = &replicas
+	if order != "" {
+		workload.Labels = map[string]string{"order": order}
+	}
+	return workload
+}
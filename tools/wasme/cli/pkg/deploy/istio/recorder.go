@@ -0,0 +1,103 @@
+package istio
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/tools/reference"
+)
+
+const (
+	// reasons of the Events recorded on the workloads
+	EventReasonFilterApplied = "FilterApplied"
+	EventReasonFilterRemoved = "FilterRemoved"
+)
+
+// records an Event on the workload, of type Warning if the filter could not be applied or removed
+func (p *Provider) recordWorkloadEvent(workload selectedWorkload, reason, verb, pastVerb string, filter *v1.FilterSpec, err error) {
+	if p.Recorder == nil {
+		return
+	}
+	if err != nil {
+		p.Recorder.Eventf(workload.object, corev1.EventTypeWarning, reason, "failed to %v filter %v (image %v): %v", verb, filter.Id, filter.Image, err)
+		return
+	}
+	p.Recorder.Eventf(workload.object, corev1.EventTypeNormal, reason, "%v filter %v (image %v)", pastVerb, filter.Id, filter.Image)
+}
+
+// NewEventRecorder returns a record.EventRecorder which creates the Events with the kube client
+// before returning, so short-lived processes such as the CLI do not exit before the Events are written.
+// Events which cannot be written are logged and dropped
+func NewEventRecorder(kubeClient kubernetes.Interface, component string) record.EventRecorder {
+	return &syncRecorder{
+		kubeClient: kubeClient,
+		source:     corev1.EventSource{Component: component},
+	}
+}
+
+type syncRecorder struct {
+	kubeClient kubernetes.Interface
+	source     corev1.EventSource
+}
+
+func (r *syncRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	r.record(object, nil, metav1.Now(), eventtype, reason, message)
+}
+
+func (r *syncRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r *syncRecorder) PastEventf(object runtime.Object, timestamp metav1.Time, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.record(object, nil, timestamp, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r *syncRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.record(object, annotations, metav1.Now(), eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r *syncRecorder) record(object runtime.Object, annotations map[string]string, timestamp metav1.Time, eventtype, reason, message string) {
+	logger := logrus.WithFields(logrus.Fields{
+		"reason":  reason,
+		"message": message,
+	})
+
+	ref, err := reference.GetReference(scheme.Scheme, object)
+	if err != nil {
+		logger.WithError(err).Warn("dropping event for object without a reference")
+		return
+	}
+
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			// the same naming scheme as the events recorded by controllers
+			Name:        fmt.Sprintf("%v.%x", ref.Name, time.Now().UnixNano()),
+			Namespace:   namespace,
+			Annotations: annotations,
+		},
+		InvolvedObject: *ref,
+		Reason:         reason,
+		Message:        message,
+		FirstTimestamp: timestamp,
+		LastTimestamp:  timestamp,
+		Count:          1,
+		Type:           eventtype,
+		Source:         r.source,
+	}
+
+	if _, err := r.kubeClient.CoreV1().Events(namespace).Create(event); err != nil {
+		logger.WithError(err).Warn("failed to record event")
+	}
+}
@@ -0,0 +1,92 @@
+package istio_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"github.com/solo-io/skv2/pkg/ezkube"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	kubev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Workload events", func() {
+	var (
+		kube     *fake.Clientset
+		provider *testProvider
+		filter   = &wasmev1.FilterSpec{
+			Id:     "filter-id",
+			Image:  "filter/image:v1",
+			RootID: "root_id",
+		}
+	)
+
+	BeforeEach(func() {
+		provider = newTestProvider(makeDeployment("work", "default", nil))
+		kube = provider.kube
+		provider.Recorder = istio.NewEventRecorder(kube, "wasme")
+	})
+
+	getEvents := func() []kubev1.Event {
+		events, err := kube.CoreV1().Events("default").List(metav1.ListOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		return events.Items
+	}
+
+	expectInvolvedWorkload := func(event kubev1.Event) {
+		Expect(event.InvolvedObject.Kind).To(Equal("Deployment"))
+		Expect(event.InvolvedObject.APIVersion).To(Equal("apps/v1"))
+		Expect(event.InvolvedObject.Namespace).To(Equal("default"))
+		Expect(event.InvolvedObject.Name).To(Equal("work"))
+		Expect(event.Source.Component).To(Equal("wasme"))
+	}
+
+	It("records an event on the workload when the filter is applied and removed", func() {
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		events := getEvents()
+		Expect(events).To(HaveLen(1))
+		expectInvolvedWorkload(events[0])
+		Expect(events[0].Type).To(Equal(kubev1.EventTypeNormal))
+		Expect(events[0].Reason).To(Equal(istio.EventReasonFilterApplied))
+		Expect(events[0].Message).To(Equal("applied filter filter-id (image filter/image:v1)"))
+
+		err = provider.RemoveFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		events = getEvents()
+		Expect(events).To(HaveLen(2))
+		var removed kubev1.Event
+		for _, event := range events {
+			if event.Reason == istio.EventReasonFilterRemoved {
+				removed = event
+			}
+		}
+		expectInvolvedWorkload(removed)
+		Expect(removed.Type).To(Equal(kubev1.EventTypeNormal))
+		Expect(removed.Message).To(Equal("removed filter filter-id (image filter/image:v1)"))
+	})
+
+	It("records a warning when the filter cannot be applied to the workload", func() {
+		provider.onEnsure = func(obj ezkube.Object) error {
+			if _, ok := obj.(*appsv1.Deployment); ok {
+				return errors.New("update rejected")
+			}
+			return nil
+		}
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).To(HaveOccurred())
+
+		events := getEvents()
+		Expect(events).To(HaveLen(1))
+		expectInvolvedWorkload(events[0])
+		Expect(events[0].Type).To(Equal(kubev1.EventTypeWarning))
+		Expect(events[0].Reason).To(Equal(istio.EventReasonFilterApplied))
+		Expect(events[0].Message).To(Equal("failed to apply filter filter-id (image filter/image:v1): update rejected"))
+	})
+})
@@ -0,0 +1,131 @@
+package istio_test
+
+import (
+	"github.com/gogo/protobuf/types"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	istiov1alpha3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Remote datasource", func() {
+	var (
+		kube         *fake.Clientset
+		provider     *testProvider
+		inspector    *countingInspector
+		envoyFilters map[string]*istiov1alpha3.EnvoyFilter
+	)
+
+	filter := &wasmev1.FilterSpec{
+		Id:     "filter-a",
+		Image:  "filter/image:v1",
+		RootID: "root_id",
+	}
+
+	getAnnotations := func() map[string]string {
+		workload, err := kube.AppsV1().Deployments("default").Get("work", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		return workload.Spec.Template.Annotations
+	}
+
+	// returns the code of the vm of the EnvoyFilter created for the filter
+	getCode := func(config func(value map[string]*types.Value) *types.Struct) map[string]*types.Value {
+		envoyFilter := envoyFilters[istio.EnvoyFilterName("work", "filter-a")]
+		Expect(envoyFilter).NotTo(BeNil())
+		Expect(envoyFilter.Spec.ConfigPatches).To(HaveLen(1))
+		pluginConfig := config(envoyFilter.Spec.ConfigPatches[0].Patch.Value.Fields)
+		return pluginConfig.Fields["vmConfig"].GetStructValue().Fields["code"].GetStructValue().Fields
+	}
+	typedConfig := func(value map[string]*types.Value) *types.Struct {
+		return value["typedConfig"].GetStructValue().Fields["value"].GetStructValue().Fields["config"].GetStructValue()
+	}
+	untypedConfig := func(value map[string]*types.Value) *types.Struct {
+		return value["config"].GetStructValue().Fields["config"].GetStructValue()
+	}
+
+	BeforeEach(func() {
+		provider = newTestProvider(makeDeployment("work", "default", map[string]string{
+			"sidecar.istio.io/userVolume": `[{"name":"certs","secret":{"secretName":"certs"}}]`,
+		}))
+		kube = provider.kube
+		envoyFilters = provider.envoyFilters
+		inspector = provider.VersionInspector.(*countingInspector)
+		provider.RemoteDatasource = true
+	})
+
+	It("fetches the filter from the cache service", func() {
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		remote := getCode(typedConfig)["remote"].GetStructValue().Fields
+		httpUri := remote["httpUri"].GetStructValue().Fields
+		Expect(httpUri["uri"].GetStringValue()).To(Equal("http://wasme-cache.wasme.svc.cluster.local:9979/modules/" + testImageDigest))
+		Expect(httpUri["cluster"].GetStringValue()).To(Equal("outbound|9979||wasme-cache.wasme.svc.cluster.local"))
+		Expect(remote["sha256"].GetStringValue()).To(Equal("e454cab754cf9234e8b41d7c5e30f53a4c125d7d9443cb3ef2b2eb1c4bd1ec14"))
+		Expect(remote["retryPolicy"].GetStructValue().Fields["numRetries"].GetNumberValue()).To(BeNumerically(">", 0))
+	})
+
+	It("fetches the filter from the cache service with older versions of Istio", func() {
+		inspector.version = "1.6.8"
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		remote := getCode(untypedConfig)["remote"].GetStructValue().Fields
+		Expect(remote["httpUri"].GetStructValue().Fields["uri"].GetStringValue()).To(Equal("http://wasme-cache.wasme.svc.cluster.local:9979/modules/" + testImageDigest))
+		Expect(remote["sha256"].GetStringValue()).To(Equal("e454cab754cf9234e8b41d7c5e30f53a4c125d7d9443cb3ef2b2eb1c4bd1ec14"))
+	})
+
+	It("does not mount the cache directory on the workloads", func() {
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		annotations := getAnnotations()
+		Expect(annotations).To(HaveKeyWithValue("wasme-applied", "true"))
+		Expect(annotations).To(HaveKeyWithValue("sidecar.istio.io/userVolume", `[{"name":"certs","secret":{"secretName":"certs"}}]`))
+		Expect(annotations).NotTo(HaveKey("sidecar.istio.io/userVolumeMount"))
+
+		// the annotations of the workload are left in place
+		err = provider.RemoveFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		annotations = getAnnotations()
+		Expect(annotations).NotTo(HaveKey("wasme-applied"))
+		Expect(annotations).To(HaveKeyWithValue("sidecar.istio.io/userVolume", `[{"name":"certs","secret":{"secretName":"certs"}}]`))
+	})
+
+	It("loads the filter from the cache file named after the digest without the remote datasource", func() {
+		provider.RemoteDatasource = false
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		// local datasources carry no checksum, the file name pins the digest of the module
+		code := getCode(typedConfig)
+		Expect(code).NotTo(HaveKey("remote"))
+		local := code["local"].GetStructValue().Fields
+		Expect(local["filename"].GetStringValue()).To(Equal("/var/local/lib/wasme-cache/e454cab754cf9234e8b41d7c5e30f53a4c125d7d9443cb3ef2b2eb1c4bd1ec14"))
+		Expect(local).NotTo(HaveKey("sha256"))
+
+		inspector.version = "1.6.8"
+		err = provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		code = getCode(untypedConfig)
+		Expect(code).NotTo(HaveKey("remote"))
+		Expect(code["local"].GetStructValue().Fields["filename"].GetStringValue()).To(Equal("/var/local/lib/wasme-cache/e454cab754cf9234e8b41d7c5e30f53a4c125d7d9443cb3ef2b2eb1c4bd1ec14"))
+	})
+
+	It("removes the cache volume mounted before switching to the remote datasource", func() {
+		provider.RemoteDatasource = false
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getAnnotations()["sidecar.istio.io/userVolumeMount"]).To(ContainSubstring("cache-dir"))
+
+		provider.RemoteDatasource = true
+		err = provider.RemoveFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		annotations := getAnnotations()
+		Expect(annotations).To(HaveKeyWithValue("sidecar.istio.io/userVolume", `[{"name":"certs","secret":{"secretName":"certs"}}]`))
+		Expect(annotations).NotTo(HaveKey("sidecar.istio.io/userVolumeMount"))
+	})
+})
@@ -0,0 +1,190 @@
+package istio
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	pkgcache "github.com/solo-io/wasm/tools/wasme/pkg/cache"
+	"istio.io/client-go/pkg/apis/networking/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// RemoveFilterByImage removes every filter deployed by wasme from the image to the selected workloads,
+// whatever the ids the filters were deployed with.
+// the ref may be a tag or a digest; it is resolved with the Puller, and EnvoyFilters are matched
+// either by the image they were created from, or by the cached file of the image they load.
+// the sidecar annotations are removed from the workloads which have no filters left,
+// and the image is removed from the cache once no EnvoyFilter in the cluster uses it.
+// returns the ids of the removed filters
+func (p *Provider) RemoveFilterByImage(ref string) ([]string, error) {
+	p.expireIstioVersion()
+
+	logger := p.logger().WithFields(Fields{
+		"image": ref,
+	})
+
+	image, err := p.Puller.Pull(p.Ctx, ref)
+	if err != nil {
+		return nil, errors.Wrapf(err, "resolving image %v", ref)
+	}
+	descriptor, err := image.Descriptor()
+	if err != nil {
+		return nil, err
+	}
+	cachedFile, err := pkgcache.Digest2filename(descriptor.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := p.Workload.Namespace
+	if p.MeshWide {
+		namespace = p.istioNamespace()
+	}
+	var envoyFilters v1alpha3.EnvoyFilterList
+	if err := p.Client.List(p.Ctx, &envoyFilters, client.InNamespace(namespace), client.HasLabels{FilterIdLabel}); err != nil {
+		return nil, errors.Wrap(err, "listing Istio EnvoyFilter resources")
+	}
+
+	filterIds := map[string]bool{}
+	// the workloads the removed EnvoyFilters were applied to
+	workloads := map[string]bool{}
+	// the refs the removed EnvoyFilters were created from, which are removed from the cache
+	refs := map[string]bool{ref: true, image.Ref(): true}
+	for _, envoyFilter := range envoyFilters.Items {
+		if !envoyFilterUsesImage(envoyFilter, ref, cachedFile) {
+			continue
+		}
+		if err := p.Client.Delete(p.Ctx, &v1alpha3.EnvoyFilter{ObjectMeta: metav1.ObjectMeta{Name: envoyFilter.Name, Namespace: envoyFilter.Namespace}}); err != nil && !kubeerrors.IsNotFound(err) {
+			return nil, errors.Wrapf(err, "deleting EnvoyFilter %v.%v", envoyFilter.Name, envoyFilter.Namespace)
+		}
+		logger.WithFields(Fields{
+			"filter": envoyFilter.Name,
+		}).Infof("deleted Istio EnvoyFilter resource")
+
+		filterIds[envoyFilter.Labels[FilterIdLabel]] = true
+		if workloadName, ok := envoyFilter.Labels[WorkloadLabel]; ok {
+			workloads[workloadName] = true
+		}
+		if deployedRef, ok := envoyFilter.Annotations[ImageLabel]; ok {
+			refs[deployedRef] = true
+		}
+	}
+	if len(filterIds) == 0 {
+		logger.Infof("no filters deployed from the image found in namespace %v", namespace)
+		return nil, nil
+	}
+
+	var updatedWorkloads []string
+	err = p.updateEachWorkload(nil, true, func(meta metav1.ObjectMeta, spec *corev1.PodTemplateSpec) (bool, error) {
+		// mesh-wide filters apply to every workload
+		if !p.MeshWide && !workloads[truncateName(meta.Name, validation.LabelValueMaxLength)] {
+			return false, nil
+		}
+		updatedWorkloads = append(updatedWorkloads, meta.Name)
+
+		unrecorded, err := removeAppliedFilters(spec, func(_ string, state AppliedFilter) bool {
+			return refs[state.Image] || state.Digest == descriptor.Digest.String()
+		})
+		if err != nil {
+			return false, err
+		}
+
+		// the annotations mount the cache, which the other filters still need
+		remaining, err := p.deployedFilterIds(meta.Name)
+		if err != nil {
+			return false, err
+		}
+		if len(remaining) > 0 {
+			return unrecorded, nil
+		}
+		logger.WithFields(Fields{
+			"workload": meta.Name,
+		}).Infof("removing sidecar annotations from workload")
+		removeSidecarAnnotations(spec)
+		return true, nil
+	}, nil, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "removing annotations from workload")
+	}
+
+	var removed []string
+	for filterId := range filterIds {
+		removed = append(removed, filterId)
+		if err := p.pruneSnapshots(filterId, updatedWorkloads); err != nil {
+			return nil, errors.Wrap(err, "pruning workload snapshots")
+		}
+	}
+	sort.Strings(removed)
+
+	for deployedRef := range refs {
+		if err := p.removeUnusedImageFromCache(deployedRef, cachedFile); err != nil {
+			return nil, errors.Wrapf(err, "removing image %v from the cache", deployedRef)
+		}
+	}
+
+	return removed, nil
+}
+
+// returns true if the EnvoyFilter was created from the image ref, or loads the cached file of the image
+func envoyFilterUsesImage(envoyFilter v1alpha3.EnvoyFilter, ref, cachedFile string) bool {
+	if envoyFilter.Annotations[ImageLabel] == ref || envoyFilter.Labels[ImageLabel] == imageLabelValue(ref) {
+		return true
+	}
+	for _, configPatch := range envoyFilter.Spec.ConfigPatches {
+		if strings.Contains(configPatch.GetPatch().GetValue().String(), cachedFile) {
+			return true
+		}
+	}
+	return false
+}
+
+// removes the image from the cache configmap, unless an EnvoyFilter in any namespace was still created from it,
+// or loads its cached file, e.g. if it was created from another ref of the image which was not added to the cache
+func (p *Provider) removeUnusedImageFromCache(ref, cachedFile string) error {
+	var envoyFilters v1alpha3.EnvoyFilterList
+	if err := p.Client.List(p.Ctx, &envoyFilters, client.HasLabels{FilterIdLabel}); err != nil {
+		return err
+	}
+	for _, envoyFilter := range envoyFilters.Items {
+		if envoyFilterUsesImage(envoyFilter, ref, cachedFile) {
+			return nil
+		}
+	}
+	err := p.removeImageFromCacheConfigMap(ref)
+	if kubeerrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// removes the images the filter was applied with from the cache configmap, unless they are still used.
+// an image is listed in the cache by the ref it was applied with, or by its pinned ref if the provider pinned it
+func (p *Provider) pruneAppliedImages(applied []AppliedFilter) error {
+	pruned := map[string]bool{}
+	for _, state := range applied {
+		d, err := digest.Parse(state.Digest)
+		if err != nil {
+			continue
+		}
+		cachedFile, err := pkgcache.Digest2filename(d)
+		if err != nil {
+			return err
+		}
+		for _, ref := range []string{state.Image, state.PinnedImage} {
+			if ref == "" || pruned[ref] {
+				continue
+			}
+			pruned[ref] = true
+			if err := p.removeUnusedImageFromCache(ref, cachedFile); err != nil {
+				return errors.Wrapf(err, "removing image %v from the cache", ref)
+			}
+		}
+	}
+	return nil
+}
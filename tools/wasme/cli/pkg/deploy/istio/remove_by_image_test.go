@@ -0,0 +1,138 @@
+package istio_test
+
+import (
+	"context"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cache"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	pkgcache "github.com/solo-io/wasm/tools/wasme/pkg/cache"
+	istiov1alpha3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("RemoveFilterByImage", func() {
+	const otherRef = "other/image:v1"
+	var (
+		kube         *fake.Clientset
+		provider     *testProvider
+		envoyFilters map[string]*istiov1alpha3.EnvoyFilter
+		otherPuller  = &mockPuller{image: mockImage{ref: otherRef, digest: "sha256:" + strings.Repeat("a", 64)}}
+	)
+
+	makeFilter := func(id, image string) *wasmev1.FilterSpec {
+		return &wasmev1.FilterSpec{
+			Id:     id,
+			Image:  image,
+			RootID: "root_id",
+		}
+	}
+
+	BeforeEach(func() {
+		aWork, bWork := makeDeployment("a-work", "default", nil), makeDeployment("b-work", "default", nil)
+		aWork.Labels, bWork.Labels = map[string]string{"app": "a-work"}, map[string]string{"app": "b-work"}
+		provider = newTestProvider(aWork, bWork)
+		kube, envoyFilters = provider.kube, provider.envoyFilters
+		imagePuller := provider.Puller
+
+		// two teams deploy the image with their own ids, the second only to a-work
+		Expect(provider.ApplyFilter(makeFilter("team-a", "filter/image:v1"))).NotTo(HaveOccurred())
+		provider.Workload.Labels = map[string]string{"app": "a-work"}
+		Expect(provider.ApplyFilter(makeFilter("team-b", "filter/image:v1"))).NotTo(HaveOccurred())
+		provider.Puller = otherPuller
+		Expect(provider.ApplyFilter(makeFilter("other", otherRef))).NotTo(HaveOccurred())
+
+		provider.Workload.Labels = nil
+		provider.Puller = imagePuller
+	})
+
+	getAnnotations := func(name string) map[string]string {
+		workload, err := kube.AppsV1().Deployments("default").Get(name, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		return workload.Spec.Template.Annotations
+	}
+
+	getCachedImages := func() []string {
+		cm, err := kube.CoreV1().ConfigMaps("wasme").Get("wasme-cache", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		images, err := pkgcache.ParseImageList(cm.Data[cache.ImagesKey])
+		Expect(err).NotTo(HaveOccurred())
+		return images.Refs()
+	}
+
+	expectImageRemoved := func(removed []string, err error) {
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removed).To(Equal([]string{"team-a", "team-b"}))
+
+		Expect(envoyFilters).To(HaveLen(1))
+		Expect(envoyFilters).To(HaveKey(istio.EnvoyFilterName("a-work", "other")))
+
+		// a-work still runs the other filter, so it keeps mounting the cache
+		Expect(getAnnotations("a-work")).To(HaveKey("sidecar.istio.io/userVolumeMount"))
+		Expect(getAnnotations("b-work")).NotTo(HaveKey("sidecar.istio.io/userVolumeMount"))
+
+		Expect(getCachedImages()).To(Equal([]string{otherRef}))
+	}
+
+	It("removes the filters deployed from the image under any id", func() {
+		expectImageRemoved(provider.RemoveFilterByImage("filter/image:v1"))
+	})
+
+	It("resolves digest references to the deployed image", func() {
+		// the image is resolved to the same digest it was deployed with
+		expectImageRemoved(provider.RemoveFilterByImage("filter/image@" + testImageDigest))
+	})
+
+	It("does nothing when no filter was deployed from the image", func() {
+		provider.Puller = &mockPuller{image: mockImage{ref: "unused/image:v1", digest: "sha256:" + strings.Repeat("b", 64)}}
+
+		removed, err := provider.RemoveFilterByImage("unused/image:v1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removed).To(BeEmpty())
+		Expect(envoyFilters).To(HaveLen(4))
+	})
+
+	It("prunes the image from the cache once the filters of a finalized parent are removed", func() {
+		provider.ParentObject = &wasmev1.FilterDeployment{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Namespace: "default"}}
+		provider.PruneCache = true
+
+		Expect(provider.RemoveFilter(makeFilter("team-a", "filter/image:v1"))).NotTo(HaveOccurred())
+		// the EnvoyFilters owned by the parent are deleted, but the filter of team-b still uses the image
+		Expect(envoyFilters).To(HaveLen(2))
+		Expect(getCachedImages()).To(HaveLen(2))
+
+		provider.Workload.Labels = map[string]string{"app": "a-work"}
+		Expect(provider.RemoveFilter(makeFilter("team-b", "filter/image:v1"))).NotTo(HaveOccurred())
+		Expect(envoyFilters).To(HaveKey(istio.EnvoyFilterName("a-work", "other")))
+		Expect(getCachedImages()).To(Equal([]string{otherRef}))
+	})
+})
+
+// returns a fake implementation of List over the given EnvoyFilters, which honors the namespace and label selectors
+func listEnvoyFilters(envoyFilters *map[string]*istiov1alpha3.EnvoyFilter) func(_ context.Context, list runtime.Object, opts ...client.ListOption) error {
+	return func(_ context.Context, list runtime.Object, opts ...client.ListOption) error {
+		envoyFilterList, ok := list.(*istiov1alpha3.EnvoyFilterList)
+		if !ok {
+			return nil
+		}
+		listOpts := &client.ListOptions{}
+		listOpts.ApplyOptions(opts)
+		for _, envoyFilter := range *envoyFilters {
+			if listOpts.Namespace != "" && envoyFilter.Namespace != listOpts.Namespace {
+				continue
+			}
+			if listOpts.LabelSelector != nil && !listOpts.LabelSelector.Matches(labels.Set(envoyFilter.Labels)) {
+				continue
+			}
+			envoyFilterList.Items = append(envoyFilterList.Items, *envoyFilter)
+		}
+		return nil
+	}
+}
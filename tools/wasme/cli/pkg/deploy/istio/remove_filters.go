@@ -0,0 +1,202 @@
+package istio
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy"
+	"istio.io/client-go/pkg/apis/networking/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DeployedFilter is a filter deployed by wasme, as read from the labels and annotations of its EnvoyFilter
+type DeployedFilter = deploy.DeployedFilter
+
+// ListFilters lists the filters deployed by wasme to the selected workloads whose id starts with the prefix,
+// every filter if the prefix is empty. the filters are listed from the labels of their EnvoyFilters,
+// so filters deployed by older versions of wasme are not listed.
+// if MeshWide is set, lists the filters deployed mesh-wide instead
+func (p *Provider) ListFilters(idPrefix string) ([]DeployedFilter, error) {
+	namespace := p.Workload.Namespace
+	var workloads map[string]bool
+	if p.MeshWide {
+		namespace = p.istioNamespace()
+	} else {
+		var err error
+		workloads, err = p.selectedWorkloadNames()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var envoyFilters v1alpha3.EnvoyFilterList
+	if err := p.Client.List(p.Ctx, &envoyFilters, client.InNamespace(namespace), client.HasLabels{FilterIdLabel}); err != nil {
+		return nil, errors.Wrap(err, "listing Istio EnvoyFilter resources")
+	}
+
+	var deployed []DeployedFilter
+	for _, envoyFilter := range envoyFilters.Items {
+		filterId := envoyFilter.Labels[FilterIdLabel]
+		if !strings.HasPrefix(filterId, idPrefix) {
+			continue
+		}
+		workloadName, perWorkload := envoyFilter.Labels[WorkloadLabel]
+		// mesh-wide EnvoyFilters are not labeled with a workload
+		if perWorkload == p.MeshWide || (perWorkload && !workloads[workloadName]) {
+			continue
+		}
+		deployed = append(deployed, DeployedFilter{
+			Id:          filterId,
+			Image:       envoyFilter.Annotations[ImageLabel],
+			Workload:    workloadName,
+			EnvoyFilter: envoyFilter.Name,
+		})
+	}
+	deploy.SortDeployedFilters(deployed)
+	return deployed, nil
+}
+
+// RemoveFilters removes every filter deployed by wasme to the selected workloads whose id starts with the prefix,
+// every filter if the prefix is empty: the EnvoyFilters listed by ListFilters are deleted,
+// and the filters are removed from the filters recorded on the workloads.
+// the sidecar annotations are removed once from each workload which has no filters left, restoring the values they replaced,
+// and the images of the removed filters are removed from the cache once no EnvoyFilter in the cluster uses them.
+// returns the removed filters
+func (p *Provider) RemoveFilters(idPrefix string) ([]DeployedFilter, error) {
+	p.expireIstioVersion()
+
+	logger := p.logger().WithFields(Fields{
+		"id_prefix": idPrefix,
+	})
+
+	deployed, err := p.ListFilters(idPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := p.Workload.Namespace
+	if p.MeshWide {
+		namespace = p.istioNamespace()
+	}
+	// the workloads the removed EnvoyFilters were applied to
+	workloads := map[string]bool{}
+	// the filters removed from each workload, to report the filters only recorded on the workload
+	removedFrom := map[string]bool{}
+	for _, filter := range deployed {
+		if err := p.Client.Delete(p.Ctx, &v1alpha3.EnvoyFilter{ObjectMeta: metav1.ObjectMeta{Name: filter.EnvoyFilter, Namespace: namespace}}); err != nil && !kubeerrors.IsNotFound(err) {
+			return nil, errors.Wrapf(err, "deleting EnvoyFilter %v.%v", filter.EnvoyFilter, namespace)
+		}
+		logger.WithFields(Fields{
+			"filter": filter.EnvoyFilter,
+		}).Infof("deleted Istio EnvoyFilter resource")
+
+		workloads[filter.Workload] = true
+		removedFrom[filter.Workload+"/"+filter.Id] = true
+	}
+
+	// the states the removed filters were applied with, to prune their images from the cache
+	var applied []AppliedFilter
+	// the workloads each filter was removed from, to prune their snapshots
+	updatedWorkloads := map[string][]string{}
+	err = p.updateEachWorkload(nil, true, func(meta metav1.ObjectMeta, spec *corev1.PodTemplateSpec) (bool, error) {
+		workloadName := truncateName(meta.Name, validation.LabelValueMaxLength)
+		// the filters still deployed to the workload, by its own EnvoyFilters or mesh-wide
+		remaining, err := p.filtersDeployedTo(meta.Name)
+		if err != nil {
+			return false, err
+		}
+		// the recorded filters are removed even if their EnvoyFilters were already deleted
+		unrecorded, err := removeAppliedFilters(spec, func(filterId string, state AppliedFilter) bool {
+			filterId = truncateName(filterId, validation.LabelValueMaxLength)
+			if !strings.HasPrefix(filterId, idPrefix) || remaining[filterId] {
+				return false
+			}
+			applied = append(applied, state)
+			updatedWorkloads[filterId] = append(updatedWorkloads[filterId], meta.Name)
+			if !p.MeshWide && !removedFrom[workloadName+"/"+filterId] {
+				removedFrom[workloadName+"/"+filterId] = true
+				deployed = append(deployed, DeployedFilter{Id: filterId, Image: state.Image, Workload: workloadName})
+			}
+			return true
+		})
+		if err != nil {
+			return false, err
+		}
+		// mesh-wide filters apply to every workload
+		if !unrecorded && !p.MeshWide && !workloads[workloadName] {
+			return false, nil
+		}
+
+		// the annotations mount the cache, which the other filters still need.
+		// they are removed once every filter is removed, so the backups they replaced are restored once
+		if _, annotated := spec.Annotations[appliedAnnotation]; !annotated || len(remaining) > 0 {
+			return unrecorded, nil
+		}
+		logger.WithFields(Fields{
+			"workload": meta.Name,
+		}).Infof("removing sidecar annotations from workload")
+		removeSidecarAnnotations(spec)
+		return true, nil
+	}, nil, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "removing annotations from workload")
+	}
+
+	for filterId, workloadNames := range updatedWorkloads {
+		if err := p.pruneSnapshots(filterId, workloadNames); err != nil {
+			return nil, errors.Wrap(err, "pruning workload snapshots")
+		}
+	}
+	if err := p.pruneAppliedImages(applied); err != nil {
+		return nil, err
+	}
+
+	deploy.SortDeployedFilters(deployed)
+	return deployed, nil
+}
+
+// returns the names of the selected workloads, truncated like the WorkloadLabel of their EnvoyFilters
+func (p *Provider) selectedWorkloadNames() (map[string]bool, error) {
+	workloads, err := p.listWorkloads()
+	if err != nil {
+		return nil, err
+	}
+	if p.Workload.Name != "" {
+		workloads = workloadsNamed(workloads, p.Workload.Name)
+	}
+	names := map[string]bool{}
+	for _, workload := range workloads {
+		names[truncateName(workload.info.Meta.Name, validation.LabelValueMaxLength)] = true
+	}
+	return names, nil
+}
+
+// returns the ids of the filters deployed to the workload by its EnvoyFilters, or mesh-wide
+func (p *Provider) filtersDeployedTo(workloadName string) (map[string]bool, error) {
+	var workloadFilters, meshWideFilters v1alpha3.EnvoyFilterList
+	if err := p.Client.List(p.Ctx, &workloadFilters, client.InNamespace(p.Workload.Namespace), client.MatchingLabels{
+		WorkloadLabel: truncateName(workloadName, validation.LabelValueMaxLength),
+	}); err != nil {
+		return nil, errors.Wrap(err, "listing Istio EnvoyFilter resources")
+	}
+	if err := p.Client.List(p.Ctx, &meshWideFilters, client.InNamespace(p.istioNamespace()), client.HasLabels{FilterIdLabel}); err != nil {
+		return nil, errors.Wrap(err, "listing Istio EnvoyFilter resources")
+	}
+
+	filterIds := map[string]bool{}
+	for _, envoyFilter := range workloadFilters.Items {
+		if filterId, ok := envoyFilter.Labels[FilterIdLabel]; ok {
+			filterIds[filterId] = true
+		}
+	}
+	for _, envoyFilter := range meshWideFilters.Items {
+		if _, ok := envoyFilter.Labels[WorkloadLabel]; !ok {
+			filterIds[envoyFilter.Labels[FilterIdLabel]] = true
+		}
+	}
+	return filterIds, nil
+}
@@ -0,0 +1,136 @@
+package istio_test
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cache"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	pkgcache "github.com/solo-io/wasm/tools/wasme/pkg/cache"
+	istiov1alpha3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	kubev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("RemoveFilters", func() {
+	const (
+		otherRef = "other/image:v1"
+		// the volume of a-work which the sidecar annotations written by wasme replace
+		certsVolume = `[{"name":"certs","secret":{"secretName":"certs"}}]`
+	)
+	var (
+		kube         *fake.Clientset
+		provider     *testProvider
+		envoyFilters map[string]*istiov1alpha3.EnvoyFilter
+		otherPuller  = &mockPuller{image: mockImage{ref: otherRef, digest: "sha256:" + strings.Repeat("a", 64)}}
+	)
+
+	makeFilter := func(id, image string) *wasmev1.FilterSpec {
+		return &wasmev1.FilterSpec{
+			Id:     id,
+			Image:  image,
+			RootID: "root_id",
+		}
+	}
+
+	BeforeEach(func() {
+		aWork := makeDeployment("a-work", "default", map[string]string{"sidecar.istio.io/userVolume": certsVolume})
+		bWork := makeDeployment("b-work", "default", nil)
+		aWork.Labels, bWork.Labels = map[string]string{"app": "a-work"}, map[string]string{"app": "b-work"}
+		provider = newTestProvider(aWork, bWork)
+		kube = provider.kube
+		envoyFilters = provider.envoyFilters
+		imagePuller := provider.Puller
+
+		// two demo filters are deployed to a-work, one of them to b-work too, which also runs another filter
+		Expect(provider.ApplyFilter(makeFilter("demo-a", "filter/image:v1"))).NotTo(HaveOccurred())
+		provider.Workload.Labels = map[string]string{"app": "a-work"}
+		Expect(provider.ApplyFilter(makeFilter("demo-b", "filter/image:v1"))).NotTo(HaveOccurred())
+		provider.Workload.Labels = map[string]string{"app": "b-work"}
+		provider.Puller = otherPuller
+		Expect(provider.ApplyFilter(makeFilter("keep", otherRef))).NotTo(HaveOccurred())
+
+		provider.Workload.Labels = nil
+		provider.Puller = imagePuller
+	})
+
+	getAnnotations := func(name string) map[string]string {
+		workload, err := kube.AppsV1().Deployments("default").Get(name, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		return workload.Spec.Template.Annotations
+	}
+
+	getCachedImages := func() []string {
+		cm, err := kube.CoreV1().ConfigMaps("wasme").Get("wasme-cache", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		images, err := pkgcache.ParseImageList(cm.Data[cache.ImagesKey])
+		Expect(err).NotTo(HaveOccurred())
+		return images.Refs()
+	}
+
+	// a-work has no filters left, so its annotations are restored to their values before the first filter was deployed
+	expectRestored := func() {
+		Expect(getAnnotations("a-work")).To(Equal(map[string]string{"sidecar.istio.io/userVolume": certsVolume}))
+	}
+
+	It("lists the filters deployed to the selected workloads", func() {
+		provider.Workload.Name = "a-work"
+		filters, err := provider.ListFilters("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filters).To(Equal([]istio.DeployedFilter{
+			{Id: "demo-a", Image: "filter/image:v1", Workload: "a-work", EnvoyFilter: istio.EnvoyFilterName("a-work", "demo-a")},
+			{Id: "demo-b", Image: "filter/image:v1", Workload: "a-work", EnvoyFilter: istio.EnvoyFilterName("a-work", "demo-b")},
+		}))
+		Expect(envoyFilters).To(HaveLen(4))
+	})
+
+	It("removes every filter deployed by wasme", func() {
+		removed, err := provider.RemoveFilters("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removed).To(HaveLen(4))
+		Expect(envoyFilters).To(BeEmpty())
+
+		expectRestored()
+		Expect(getAnnotations("b-work")).To(BeEmpty())
+		Expect(getCachedImages()).To(BeEmpty())
+	})
+
+	It("removes the filters whose id starts with the prefix", func() {
+		removed, err := provider.RemoveFilters("demo-")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removed).To(Equal([]istio.DeployedFilter{
+			{Id: "demo-a", Image: "filter/image:v1", Workload: "a-work", EnvoyFilter: istio.EnvoyFilterName("a-work", "demo-a")},
+			{Id: "demo-a", Image: "filter/image:v1", Workload: "b-work", EnvoyFilter: istio.EnvoyFilterName("b-work", "demo-a")},
+			{Id: "demo-b", Image: "filter/image:v1", Workload: "a-work", EnvoyFilter: istio.EnvoyFilterName("a-work", "demo-b")},
+		}))
+		Expect(envoyFilters).To(HaveLen(1))
+		Expect(envoyFilters).To(HaveKey(istio.EnvoyFilterName("b-work", "keep")))
+
+		expectRestored()
+		// b-work still runs the other filter, so it keeps mounting the cache
+		Expect(getAnnotations("b-work")).To(HaveKey("sidecar.istio.io/userVolumeMount"))
+		applied, err := istio.GetAppliedFilters(&kubev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Annotations: getAnnotations("b-work")}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(applied).To(HaveLen(1))
+		Expect(applied).To(HaveKey("keep"))
+
+		Expect(getCachedImages()).To(Equal([]string{otherRef}))
+	})
+
+	It("removes the filters recorded on the workloads whose EnvoyFilters were deleted", func() {
+		delete(envoyFilters, istio.EnvoyFilterName("a-work", "demo-b"))
+
+		removed, err := provider.RemoveFilters("demo-b")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removed).To(Equal([]istio.DeployedFilter{
+			{Id: "demo-b", Image: "filter/image:v1", Workload: "a-work"},
+		}))
+		applied, err := istio.GetAppliedFilters(&kubev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Annotations: getAnnotations("a-work")}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(applied).NotTo(HaveKey("demo-b"))
+		Expect(applied).To(HaveKey("demo-a"))
+	})
+})
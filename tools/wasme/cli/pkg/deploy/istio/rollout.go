@@ -0,0 +1,166 @@
+package istio
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// the progress of a workload rollout
+type rolloutStatus struct {
+	// true once every pod runs the latest pod template
+	done bool
+	// a summary of the replica counts, for logging
+	progress string
+	// selects the pods of the workload
+	selector *metav1.LabelSelector
+}
+
+// waits until the workload has finished rolling out the updated pod template.
+// does nothing if WaitForRolloutTimeout is zero
+func (p *Provider) waitForRollout(kind, name string) error {
+	if p.WaitForRolloutTimeout == 0 {
+		return nil
+	}
+
+	logger := p.logger().WithFields(Fields{
+		"kind":     kind,
+		"workload": name,
+	})
+	logger.Infof("waiting for rollout with timeout %v", p.WaitForRolloutTimeout)
+
+	timeout := time.After(p.WaitForRolloutTimeout)
+	interval := time.NewTicker(time.Second)
+	defer interval.Stop()
+
+	for {
+		status, err := p.getRolloutStatus(kind, name)
+		if err != nil {
+			return errors.Wrapf(err, "getting rollout status of %v %v", kind, name)
+		}
+		if status.done {
+			logger.WithFields(Fields{"progress": status.progress}).Infof("workload rollout completed")
+			return nil
+		}
+		logger.WithFields(Fields{"progress": status.progress}).Infof("waiting for workload rollout")
+
+		select {
+		case <-p.Ctx.Done():
+			return p.Ctx.Err()
+		case <-timeout:
+			return errors.Errorf("timed out after %v waiting for %v %v to roll out (%v). pod conditions: %v",
+				p.WaitForRolloutTimeout, kind, name, status.progress, p.podConditions(status.selector))
+		case <-interval.C:
+		}
+	}
+}
+
+// reads the rollout status of the workload, following the checks of kubectl rollout status
+func (p *Provider) getRolloutStatus(kind, name string) (*rolloutStatus, error) {
+	apps := p.KubeClient.AppsV1()
+	switch strings.ToLower(kind) {
+	case WorkloadTypeDeployment:
+		workload, err := apps.Deployments(p.Workload.Namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, condition := range workload.Status.Conditions {
+			if condition.Type == appsv1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded" {
+				return nil, errors.Errorf("rollout exceeded its progress deadline: %v", condition.Message)
+			}
+		}
+		replicas := int32(1)
+		if workload.Spec.Replicas != nil {
+			replicas = *workload.Spec.Replicas
+		}
+		status := workload.Status
+		return &rolloutStatus{
+			done: workload.Generation <= status.ObservedGeneration &&
+				status.UpdatedReplicas >= replicas &&
+				status.Replicas <= status.UpdatedReplicas &&
+				status.AvailableReplicas >= status.UpdatedReplicas,
+			progress: fmt.Sprintf("%v of %v replicas updated, %v available", status.UpdatedReplicas, replicas, status.AvailableReplicas),
+			selector: workload.Spec.Selector,
+		}, nil
+	case WorkloadTypeDaemonSet:
+		workload, err := apps.DaemonSets(p.Workload.Namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		status := workload.Status
+		return &rolloutStatus{
+			// pods of OnDelete daemonsets are only updated once deleted
+			done: workload.Spec.UpdateStrategy.Type == appsv1.OnDeleteDaemonSetStrategyType ||
+				workload.Generation <= status.ObservedGeneration &&
+					status.UpdatedNumberScheduled >= status.DesiredNumberScheduled &&
+					status.NumberAvailable >= status.DesiredNumberScheduled,
+			progress: fmt.Sprintf("%v of %v pods updated, %v available", status.UpdatedNumberScheduled, status.DesiredNumberScheduled, status.NumberAvailable),
+			selector: workload.Spec.Selector,
+		}, nil
+	case WorkloadTypeStatefulSet:
+		workload, err := apps.StatefulSets(p.Workload.Namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		replicas := int32(1)
+		if workload.Spec.Replicas != nil {
+			replicas = *workload.Spec.Replicas
+		}
+		status := workload.Status
+		done := workload.Generation <= status.ObservedGeneration && status.ReadyReplicas >= replicas
+		switch strategy := workload.Spec.UpdateStrategy; {
+		case strategy.Type == appsv1.OnDeleteStatefulSetStrategyType:
+			// pods of OnDelete statefulsets are only updated once deleted
+			done = true
+		case strategy.RollingUpdate != nil && strategy.RollingUpdate.Partition != nil:
+			// only the pods above the partition are updated
+			done = done && status.UpdatedReplicas >= replicas-*strategy.RollingUpdate.Partition
+		default:
+			done = done && status.UpdateRevision == status.CurrentRevision
+		}
+		return &rolloutStatus{
+			done:     done,
+			progress: fmt.Sprintf("%v of %v replicas updated, %v ready", status.UpdatedReplicas, replicas, status.ReadyReplicas),
+			selector: workload.Spec.Selector,
+		}, nil
+	case WorkloadTypeDeploymentConfig:
+		return p.getDeploymentConfigRolloutStatus(name)
+	default:
+		return nil, unknownWorkloadTypeError(kind)
+	}
+}
+
+// summarizes the conditions of the selected pods which are not true, to explain a stuck rollout
+func (p *Provider) podConditions(selector *metav1.LabelSelector) []string {
+	if selector == nil {
+		return nil
+	}
+	pods, err := p.KubeClient.CoreV1().Pods(p.Workload.Namespace).List(metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(selector),
+	})
+	if err != nil {
+		return []string{fmt.Sprintf("listing pods: %v", err)}
+	}
+
+	var conditions []string
+	for _, pod := range pods.Items {
+		for _, condition := range pod.Status.Conditions {
+			if condition.Status == corev1.ConditionTrue {
+				continue
+			}
+			message := fmt.Sprintf("%v: %v=%v", pod.Name, condition.Type, condition.Status)
+			if condition.Reason != "" || condition.Message != "" {
+				message += fmt.Sprintf(" (%v: %v)", condition.Reason, condition.Message)
+			}
+			conditions = append(conditions, message)
+		}
+	}
+	sort.Strings(conditions)
+	return conditions
+}
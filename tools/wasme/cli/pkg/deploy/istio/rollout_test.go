@@ -0,0 +1,115 @@
+package istio_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/skv2/pkg/ezkube"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	kubev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Workload rollout", func() {
+	var (
+		kube     *fake.Clientset
+		provider *testProvider
+		results  []error
+		filter   = &wasmev1.FilterSpec{
+			Id:     "filter-id",
+			Image:  "filter/image:v1",
+			RootID: "root_id",
+		}
+	)
+
+	BeforeEach(func() {
+		results = nil
+
+		provider = newTestProvider(
+			makeDeployment("work", "default", nil),
+			&kubev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "work-pod",
+					Namespace: "default",
+					Labels:    map[string]string{"app": "work"},
+				},
+				Status: kubev1.PodStatus{
+					Conditions: []kubev1.PodCondition{
+						{Type: kubev1.PodScheduled, Status: kubev1.ConditionTrue},
+						{
+							Type:    kubev1.PodReady,
+							Status:  kubev1.ConditionFalse,
+							Reason:  "ContainersNotReady",
+							Message: "containers with unready status: [istio-proxy]",
+						},
+					},
+				},
+			},
+		)
+		kube = provider.kube
+		// the updated workloads have not rolled out yet
+		provider.onEnsure = func(obj ezkube.Object) error {
+			if workload, ok := obj.(*appsv1.Deployment); ok {
+				workload.Status = appsv1.DeploymentStatus{Replicas: 2, UpdatedReplicas: 0, AvailableReplicas: 1}
+			}
+			return nil
+		}
+		provider.OnWorkload = func(workloadMeta metav1.ObjectMeta, err error) {
+			results = append(results, err)
+		}
+	})
+
+	// completes the rollout of the workload once it is updated
+	completeRollout := func() {
+		go func() {
+			defer GinkgoRecover()
+			var workload *appsv1.Deployment
+			Eventually(func() (map[string]string, error) {
+				var err error
+				workload, err = kube.AppsV1().Deployments("default").Get("work", metav1.GetOptions{})
+				if err != nil {
+					return nil, err
+				}
+				return workload.Spec.Template.Annotations, nil
+			}, 5*time.Second, 10*time.Millisecond).Should(HaveKey("sidecar.istio.io/userVolume"))
+			workload.Status = appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}
+			_, err := kube.AppsV1().Deployments("default").UpdateStatus(workload)
+			Expect(err).NotTo(HaveOccurred())
+		}()
+	}
+
+	It("does not wait for the rollout by default", func() {
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).To(Equal([]error{nil}))
+	})
+
+	It("waits for the workload to roll out before reporting it", func() {
+		provider.WaitForRolloutTimeout = 10 * time.Second
+		completeRollout()
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).To(Equal([]error{nil}))
+
+		workload, err := kube.AppsV1().Deployments("default").Get("work", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(workload.Status.UpdatedReplicas).To(BeEquivalentTo(1))
+	})
+
+	It("names the stuck workload and its pod conditions on timeout", func() {
+		provider.WaitForRolloutTimeout = 50 * time.Millisecond
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("waiting for deployment work to roll out (0 of 1 replicas updated, 1 available)"))
+		Expect(err.Error()).To(ContainSubstring("work-pod: Ready=False (ContainersNotReady: containers with unready status: [istio-proxy])"))
+		Expect(err.Error()).NotTo(ContainSubstring("PodScheduled"))
+
+		Expect(results).To(HaveLen(1))
+		Expect(results[0]).To(HaveOccurred())
+	})
+})
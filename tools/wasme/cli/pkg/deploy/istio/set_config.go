@@ -0,0 +1,212 @@
+package istio
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/types"
+	"github.com/pkg/errors"
+	envoyfilter "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/filter"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	"istio.io/client-go/pkg/apis/networking/v1alpha3"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	stringValueTypeUrl = "type.googleapis.com/google.protobuf.StringValue"
+	structTypeUrl      = "type.googleapis.com/google.protobuf.Struct"
+)
+
+// SetFilterConfig applies a JSON merge patch to the plugin config of the live EnvoyFilters
+// created for the filter in the target namespace, without regenerating the rest of the EnvoyFilter.
+// if MeshWide is set, the mesh-wide EnvoyFilter in the IstioNamespace is patched instead.
+// if the filter was deployed with a config checksum, the checksum is recomputed.
+// EnvoyFilters managed by a FilterDeployment are updated, but the operator will revert the
+// change the next time it reconciles the FilterDeployment.
+func (p *Provider) SetFilterConfig(filterId string, patch []byte) error {
+	logger := p.logger().WithFields(Fields{
+		"filter": filterId,
+	})
+
+	namespace := p.Workload.Namespace
+	isFilterResource := func(envoyFilter *v1alpha3.EnvoyFilter) bool {
+		if id, ok := envoyFilter.Labels[FilterIdLabel]; ok {
+			return id == truncateName(filterId, validation.LabelValueMaxLength)
+		}
+		// EnvoyFilters created by older versions of wasme are not labeled
+		return strings.HasSuffix(envoyFilter.Name, "-"+filterId)
+	}
+	if p.MeshWide {
+		namespace = p.istioNamespace()
+		isFilterResource = func(envoyFilter *v1alpha3.EnvoyFilter) bool {
+			return envoyFilter.Name == filterId
+		}
+	}
+
+	var envoyFilters v1alpha3.EnvoyFilterList
+	if err := p.Client.List(p.Ctx, &envoyFilters, client.InNamespace(namespace)); err != nil {
+		return errors.Wrap(err, "listing Istio EnvoyFilter resources")
+	}
+
+	var updated int
+	for i := range envoyFilters.Items {
+		envoyFilter := &envoyFilters.Items[i]
+		if !isFilterResource(envoyFilter) {
+			continue
+		}
+
+		changed, err := p.patchEnvoyFilterConfig(envoyFilter, filterId, patch)
+		if err != nil {
+			return errors.Wrapf(err, "patching config of EnvoyFilter %v", envoyFilter.Name)
+		}
+		if !changed {
+			continue
+		}
+
+		filterLogger := logger.WithFields(Fields{
+			"envoy_filter_resource": envoyFilter.Name + "." + envoyFilter.Namespace,
+		})
+		for _, owner := range envoyFilter.OwnerReferences {
+			if owner.Kind == "FilterDeployment" {
+				filterLogger.Warnf("EnvoyFilter is managed by FilterDeployment %v, the patched config will be reverted "+
+					"when the FilterDeployment is next reconciled. update spec.filter.config on the FilterDeployment to persist the change", owner.Name)
+			}
+		}
+
+		if err := p.Client.Update(p.Ctx, envoyFilter); err != nil {
+			return err
+		}
+		filterLogger.Infof("patched filter config on Istio EnvoyFilter resource")
+		updated++
+	}
+
+	if updated == 0 {
+		return errors.Errorf("no EnvoyFilters found for filter %v in namespace %v", filterId, namespace)
+	}
+
+	return nil
+}
+
+// patches the plugin config of each wasm filter with the given id in the EnvoyFilter.
+// returns true if any config patch was modified
+func (p *Provider) patchEnvoyFilterConfig(envoyFilter *v1alpha3.EnvoyFilter, filterId string, patch []byte) (bool, error) {
+	var changed bool
+	for _, configPatch := range envoyFilter.Spec.ConfigPatches {
+		pluginConfig, typed := getPluginConfig(configPatch.GetPatch().GetValue())
+		if pluginConfig == nil || pluginConfig.Fields["name"].GetStringValue() != filterId {
+			continue
+		}
+
+		content, err := getPluginConfigContent(pluginConfig)
+		if err != nil {
+			return false, err
+		}
+
+		patched, err := envoyfilter.MergePatchConfig(content, patch)
+		if err != nil {
+			return false, err
+		}
+
+		// recompute the checksum if the filter was deployed with one
+		if _, ok := envoyFilter.Annotations[envoyfilter.ConfigChecksumAnnotation]; ok || bytes.Contains(content, []byte(envoyfilter.ConfigChecksumKey)) {
+			var checksum string
+			patched, checksum, err = injectConfigChecksum(patched)
+			if err != nil {
+				return false, err
+			}
+			if envoyFilter.Annotations == nil {
+				envoyFilter.Annotations = map[string]string{}
+			}
+			envoyFilter.Annotations[envoyfilter.ConfigChecksumAnnotation] = checksum
+		}
+
+		if err := setPluginConfigContent(pluginConfig, typed, patched); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// returns the wasm PluginConfig embedded in the EnvoyFilter patch value,
+// or nil if the patch value does not contain a wasm filter.
+// typed is true if the filter config is a TypedStruct, as generated for istio 1.7+
+func getPluginConfig(patchValue *types.Struct) (pluginConfig *types.Struct, typed bool) {
+	if typedConfig := patchValue.GetFields()["typedConfig"].GetStructValue(); typedConfig != nil {
+		return typedConfig.GetFields()["value"].GetStructValue().GetFields()["config"].GetStructValue(), true
+	}
+	return patchValue.GetFields()["config"].GetStructValue().GetFields()["config"].GetStructValue(), false
+}
+
+// returns the configuration passed to the filter as raw bytes
+func getPluginConfigContent(pluginConfig *types.Struct) ([]byte, error) {
+	configuration, ok := pluginConfig.Fields["configuration"]
+	if !ok {
+		return nil, nil
+	}
+	// older versions of istio embed the configuration as a string
+	if _, isString := configuration.Kind.(*types.Value_StringValue); isString {
+		return []byte(configuration.GetStringValue()), nil
+	}
+
+	// otherwise the configuration is an Any
+	configAny := configuration.GetStructValue()
+	switch typeUrl := configAny.GetFields()["@type"].GetStringValue(); typeUrl {
+	case stringValueTypeUrl:
+		return []byte(configAny.Fields["value"].GetStringValue()), nil
+	case structTypeUrl:
+		var buf bytes.Buffer
+		if err := (&jsonpb.Marshaler{}).Marshal(&buf, configAny.Fields["value"].GetStructValue()); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, errors.Errorf("unsupported filter config type %v, must be StringValue or Struct", typeUrl)
+	}
+}
+
+// sets the configuration passed to the filter, preserving the existing config type
+func setPluginConfigContent(pluginConfig *types.Struct, typed bool, content []byte) error {
+	if !typed {
+		pluginConfig.Fields["configuration"] = &types.Value{Kind: &types.Value_StringValue{StringValue: string(content)}}
+		return nil
+	}
+
+	configAny := pluginConfig.Fields["configuration"].GetStructValue()
+	if configAny.GetFields()["@type"].GetStringValue() == structTypeUrl {
+		var st types.Struct
+		if err := jsonpb.Unmarshal(bytes.NewReader(content), &st); err != nil {
+			return err
+		}
+		configAny.Fields["value"] = &types.Value{Kind: &types.Value_StructValue{StructValue: &st}}
+		return nil
+	}
+
+	pluginConfig.Fields["configuration"] = &types.Value{Kind: &types.Value_StructValue{StructValue: &types.Struct{
+		Fields: map[string]*types.Value{
+			"@type": {Kind: &types.Value_StringValue{StringValue: stringValueTypeUrl}},
+			"value": {Kind: &types.Value_StringValue{StringValue: string(content)}},
+		},
+	}}}
+	return nil
+}
+
+// injects the checksum of the config, returning the updated config and the checksum
+func injectConfigChecksum(content []byte) ([]byte, string, error) {
+	config, err := types.MarshalAny(&types.StringValue{Value: string(content)})
+	if err != nil {
+		return nil, "", err
+	}
+	filter := &v1.FilterSpec{Config: config}
+	checksum, err := envoyfilter.InjectConfigChecksum(filter)
+	if err != nil {
+		return nil, "", err
+	}
+	var injected types.StringValue
+	if err := types.UnmarshalAny(filter.Config, &injected); err != nil {
+		return nil, "", err
+	}
+	return []byte(injected.Value), checksum, nil
+}
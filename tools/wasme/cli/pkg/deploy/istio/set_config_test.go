@@ -0,0 +1,131 @@
+package istio_test
+
+import (
+	"strings"
+
+	"github.com/gogo/protobuf/types"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/skv2/pkg/ezkube"
+	envoyfilter "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/filter"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	istiov1alpha3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("SetFilterConfig", func() {
+	var (
+		provider     *testProvider
+		envoyFilters []istiov1alpha3.EnvoyFilter
+		updated      []*istiov1alpha3.EnvoyFilter
+	)
+
+	deploy := func(istioVersion string, filter *wasmev1.FilterSpec) {
+		provider.VersionInspector = &countingInspector{version: istioVersion}
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	// returns the configuration passed to the filter by the updated EnvoyFilter
+	getConfig := func(filter *istiov1alpha3.EnvoyFilter) string {
+		value := filter.Spec.ConfigPatches[0].Patch.Value
+		if typedConfig := value.Fields["typedConfig"].GetStructValue(); typedConfig != nil {
+			configuration := typedConfig.Fields["value"].GetStructValue().Fields["config"].GetStructValue().Fields["configuration"].GetStructValue()
+			Expect(configuration.Fields["@type"].GetStringValue()).To(Equal("type.googleapis.com/google.protobuf.StringValue"))
+			return configuration.Fields["value"].GetStringValue()
+		}
+		return value.Fields["config"].GetStructValue().Fields["config"].GetStructValue().Fields["configuration"].GetStringValue()
+	}
+
+	makeFilter := func(config string) *wasmev1.FilterSpec {
+		cfg, err := types.MarshalAny(&types.StringValue{Value: config})
+		Expect(err).NotTo(HaveOccurred())
+		return &wasmev1.FilterSpec{
+			Id:     "filter-id",
+			Image:  "filter/image:v1",
+			RootID: "root_id",
+			Config: cfg,
+		}
+	}
+
+	BeforeEach(func() {
+		envoyFilters = nil
+		updated = nil
+
+		provider = newTestProvider(
+			makeDeployment("work-1", "default", nil),
+			makeDeployment("work-2", "default", nil),
+		)
+		provider.envoyFilters["work-1-other-filter"] = &istiov1alpha3.EnvoyFilter{
+			ObjectMeta: metav1.ObjectMeta{Name: "work-1-other-filter", Namespace: "default"},
+		}
+		// record the created and updated EnvoyFilters
+		provider.onEnsure = func(obj ezkube.Object) error {
+			if envoyFilter, ok := obj.(*istiov1alpha3.EnvoyFilter); ok {
+				envoyFilters = append(envoyFilters, *envoyFilter)
+			}
+			return nil
+		}
+		provider.onUpdate = func(obj ezkube.Object) error {
+			updated = append(updated, obj.(*istiov1alpha3.EnvoyFilter))
+			return nil
+		}
+	})
+
+	for _, istioVersion := range []string{"1.7.3", "1.6.8"} {
+		istioVersion := istioVersion
+		It("merges the patch into the config of each EnvoyFilter for istio "+istioVersion, func() {
+			deploy(istioVersion, makeFilter(`{"rateLimit":10,"name":"limiter"}`))
+
+			err := provider.SetFilterConfig("filter-id", []byte(`{"rateLimit":50}`))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(updated).To(HaveLen(2))
+			for _, envoyFilter := range updated {
+				Expect(getConfig(envoyFilter)).To(MatchJSON(`{"rateLimit":50,"name":"limiter"}`))
+			}
+		})
+	}
+
+	It("recomputes the config checksum", func() {
+		filter := makeFilter(`{"rateLimit":10}`)
+		filter.ConfigChecksum = true
+		_, err := envoyfilter.InjectConfigChecksum(filter)
+		Expect(err).NotTo(HaveOccurred())
+		deploy("1.7.3", filter)
+		oldChecksum := envoyFilters[0].Annotations[envoyfilter.ConfigChecksumAnnotation]
+		Expect(oldChecksum).NotTo(BeEmpty())
+
+		err = provider.SetFilterConfig("filter-id", []byte(`{"rateLimit":50}`))
+		Expect(err).NotTo(HaveOccurred())
+
+		expected, err := envoyfilter.ConfigChecksum(makeFilter(`{"rateLimit":50}`).Config)
+		Expect(err).NotTo(HaveOccurred())
+		for _, envoyFilter := range updated {
+			Expect(envoyFilter.Annotations[envoyfilter.ConfigChecksumAnnotation]).To(Equal(expected))
+			Expect(getConfig(envoyFilter)).To(MatchJSON(`{"rateLimit":50,"` + envoyfilter.ConfigChecksumKey + `":"` + expected + `"}`))
+		}
+	})
+
+	It("finds EnvoyFilters with truncated names by the filter id label", func() {
+		filter := makeFilter(`{"rateLimit":10}`)
+		filter.Id = strings.Repeat("f", 250)
+		deploy("1.7.3", filter)
+		Expect(envoyFilters[0].Name).NotTo(HaveSuffix(filter.Id))
+
+		err := provider.SetFilterConfig(filter.Id, []byte(`{"rateLimit":50}`))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(updated).To(HaveLen(2))
+		for _, envoyFilter := range updated {
+			Expect(getConfig(envoyFilter)).To(MatchJSON(`{"rateLimit":50}`))
+		}
+	})
+
+	It("errors if no EnvoyFilters exist for the filter", func() {
+		err := provider.SetFilterConfig("missing-filter", []byte(`{"rateLimit":50}`))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("no EnvoyFilters found for filter missing-filter"))
+		Expect(updated).To(BeEmpty())
+	})
+})
@@ -0,0 +1,278 @@
+package istio
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+	"istio.io/client-go/pkg/apis/networking/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// name of the per-namespace ConfigMap storing the pre-deploy snapshots of workloads
+	SnapshotConfigMapName = "wasme-snapshots"
+)
+
+// the state of the fields wasme modifies on a workload,
+// captured before the filter is first deployed to it
+type workloadSnapshot struct {
+	FilterId string `json:"filterId"`
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	// the pod template annotations touched by wasme.
+	// annotations which were not present are omitted
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// the annotations written by wasme when deploying a filter
+func touchedAnnotations() []string {
+	keys := []string{appliedAnnotation, AppliedFiltersAnnotation, GatewayVolumesAnnotation}
+	for _, k := range sidecarAnnotationKeys {
+		keys = append(keys, k, backupAnnotationPrefix+k)
+	}
+	return keys
+}
+
+// returns the values of the annotations written by wasme which are set on the pod template
+func touchedAnnotationValues(template *corev1.PodTemplateSpec) map[string]string {
+	values := map[string]string{}
+	for _, k := range touchedAnnotations() {
+		if v, ok := template.Annotations[k]; ok {
+			values[k] = v
+		}
+	}
+	return values
+}
+
+// sets the annotations written by wasme on the pod template to the saved values,
+// removing those which were not saved. the gateway volumes follow the GatewayVolumesAnnotation
+func restoreTouchedAnnotations(template *corev1.PodTemplateSpec, saved map[string]string) {
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+	removeGatewayVolumes(template)
+	for _, k := range touchedAnnotations() {
+		if v, ok := saved[k]; ok {
+			template.Annotations[k] = v
+		} else {
+			delete(template.Annotations, k)
+		}
+	}
+	restoreGatewayVolumes(template)
+}
+
+// '_' is invalid in kubernetes names (and therefore istio filter ids), so keys cannot collide
+func snapshotKey(filterId, kind, workloadName string) string {
+	return filterId + "_" + kind + "_" + workloadName
+}
+
+// stores a snapshot of the workload annotations modified by wasme.
+// an existing snapshot is kept, so redeploying a filter does not overwrite the pre-deploy state
+func (p *Provider) saveSnapshot(tx *transaction, filterId string, meta metav1.ObjectMeta, template *corev1.PodTemplateSpec) error {
+	snapshot := workloadSnapshot{
+		FilterId:    filterId,
+		Kind:        strings.ToLower(p.Workload.Kind),
+		Name:        meta.Name,
+		Annotations: touchedAnnotationValues(template),
+	}
+	key := snapshotKey(snapshot.FilterId, snapshot.Kind, snapshot.Name)
+
+	create := false
+	cm, err := p.KubeClient.CoreV1().ConfigMaps(p.Workload.Namespace).Get(SnapshotConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		if !kubeerrors.IsNotFound(err) {
+			return err
+		}
+		create = true
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      SnapshotConfigMapName,
+				Namespace: p.Workload.Namespace,
+			},
+		}
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	if _, exists := cm.Data[key]; exists {
+		return nil
+	}
+
+	raw, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	cm.Data[key] = string(raw)
+
+	if create {
+		_, err = p.KubeClient.CoreV1().ConfigMaps(p.Workload.Namespace).Create(cm)
+	} else {
+		_, err = p.KubeClient.CoreV1().ConfigMaps(p.Workload.Namespace).Update(cm)
+	}
+	if err != nil {
+		return err
+	}
+	tx.record("save snapshot of "+snapshot.Kind+" "+snapshot.Name, func() error {
+		return p.deleteSnapshots([]string{key})
+	})
+
+	p.logger().WithFields(Fields{
+		"filter":   filterId,
+		"workload": meta.Name,
+	}).Infof("saved workload snapshot")
+
+	return nil
+}
+
+// returns the snapshots stored for the filter in the target namespace
+func (p *Provider) listSnapshots(filterId string) ([]workloadSnapshot, error) {
+	cm, err := p.KubeClient.CoreV1().ConfigMaps(p.Workload.Namespace).Get(SnapshotConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		if kubeerrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var snapshots []workloadSnapshot
+	for key, raw := range cm.Data {
+		var snapshot workloadSnapshot
+		if err := json.Unmarshal([]byte(raw), &snapshot); err != nil {
+			return nil, errors.Wrapf(err, "parsing snapshot %v", key)
+		}
+		if snapshot.FilterId == filterId {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return snapshots, nil
+}
+
+// removes the snapshots of the named workloads for the filter
+func (p *Provider) pruneSnapshots(filterId string, workloadNames []string) error {
+	kind := strings.ToLower(p.Workload.Kind)
+	var keys []string
+	for _, workloadName := range workloadNames {
+		keys = append(keys, snapshotKey(filterId, kind, workloadName))
+	}
+	return p.deleteSnapshots(keys)
+}
+
+// removes the snapshots with the given keys.
+// the snapshot ConfigMap is deleted once it is empty
+func (p *Provider) deleteSnapshots(keys []string) error {
+	cm, err := p.KubeClient.CoreV1().ConfigMaps(p.Workload.Namespace).Get(SnapshotConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		if kubeerrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, key := range keys {
+		delete(cm.Data, key)
+	}
+
+	if len(cm.Data) == 0 {
+		return p.KubeClient.CoreV1().ConfigMaps(p.Workload.Namespace).Delete(SnapshotConfigMapName, &metav1.DeleteOptions{})
+	}
+	_, err = p.KubeClient.CoreV1().ConfigMaps(p.Workload.Namespace).Update(cm)
+	return err
+}
+
+// restores the workload annotations stored in the snapshots for the filter
+// and deletes the filter's EnvoyFilters, regardless of the backup annotations
+// currently present on the workloads.
+// if MeshWide is set, the mesh-wide EnvoyFilter is deleted as well
+func (p *Provider) RevertFilter(filterId string) error {
+	logger := p.logger().WithFields(Fields{
+		"filter": filterId,
+	})
+
+	snapshots, err := p.listSnapshots(filterId)
+	if err != nil {
+		return errors.Wrap(err, "reading workload snapshots")
+	}
+	if len(snapshots) == 0 {
+		return errors.Errorf("no snapshots found for filter %v in namespace %v", filterId, p.Workload.Namespace)
+	}
+
+	var reverted []string
+	for _, snapshot := range snapshots {
+		logger := logger.WithFields(Fields{
+			"workload": snapshot.Name,
+		})
+
+		err := p.updateWorkload(snapshot.Kind, snapshot.Name, func(template *corev1.PodTemplateSpec) {
+			restoreTouchedAnnotations(template, snapshot.Annotations)
+		})
+		if err != nil {
+			if !kubeerrors.IsNotFound(err) {
+				return errors.Wrapf(err, "restoring snapshot of %v %v", snapshot.Kind, snapshot.Name)
+			}
+			logger.Warnf("workload no longer exists, skipping restore")
+		} else {
+			logger.Infof("restored workload annotations from snapshot")
+			if err := p.waitForRollout(snapshot.Kind, snapshot.Name); err != nil {
+				return err
+			}
+		}
+
+		filterName := EnvoyFilterName(snapshot.Name, filterId)
+		err = p.Client.Delete(p.Ctx, &v1alpha3.EnvoyFilter{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: p.Workload.Namespace,
+				Name:      filterName,
+			},
+		})
+		if err != nil && !kubeerrors.IsNotFound(err) {
+			return err
+		}
+
+		logger.WithFields(Fields{
+			"filter": filterName,
+		}).Infof("deleted Istio EnvoyFilter resource")
+
+		reverted = append(reverted, snapshotKey(filterId, snapshot.Kind, snapshot.Name))
+	}
+
+	if p.MeshWide {
+		if err := p.deleteMeshWideEnvoyFilter(filterId); err != nil {
+			return err
+		}
+	}
+
+	return p.deleteSnapshots(reverted)
+}
+
+// applies the update to the pod template of the named workload in the target namespace
+func (p *Provider) updateWorkload(kind, name string, update func(template *corev1.PodTemplateSpec)) error {
+	switch kind {
+	case WorkloadTypeDeployment:
+		workload, err := p.KubeClient.AppsV1().Deployments(p.Workload.Namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		update(&workload.Spec.Template)
+		return p.Client.Ensure(p.Ctx, nil, workload)
+	case WorkloadTypeDaemonSet:
+		workload, err := p.KubeClient.AppsV1().DaemonSets(p.Workload.Namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		update(&workload.Spec.Template)
+		return p.Client.Ensure(p.Ctx, nil, workload)
+	case WorkloadTypeStatefulSet:
+		workload, err := p.KubeClient.AppsV1().StatefulSets(p.Workload.Namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		update(&workload.Spec.Template)
+		return p.Client.Ensure(p.Ctx, nil, workload)
+	case WorkloadTypeDeploymentConfig:
+		return p.updateDeploymentConfig(name, update)
+	default:
+		return unknownWorkloadTypeError(kind)
+	}
+}
@@ -0,0 +1,100 @@
+package istio_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var _ = Describe("Workload snapshots", func() {
+	var (
+		kube     kubernetes.Interface
+		provider *testProvider
+		ns       = "default"
+		filter   = &wasmev1.FilterSpec{
+			Id:     "filter-id",
+			Image:  "filter/image:v1",
+			RootID: "root_id",
+		}
+		originalAnnotations = map[string]string{
+			"sidecar.istio.io/userVolume":      `[{"name":"tmp-dir","emptyDir":{}}]`,
+			"sidecar.istio.io/userVolumeMount": `[{"mountPath":"/tmp","name":"tmp-dir"}]`,
+			"unrelated":                        "value",
+		}
+	)
+
+	getAnnotations := func() map[string]string {
+		dep, err := kube.AppsV1().Deployments(ns).Get("work", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		return dep.Spec.Template.Annotations
+	}
+
+	BeforeEach(func() {
+		provider = newTestProvider(makeDeployment("work", ns, originalAnnotations))
+		provider.IgnoreVersionCheck = true
+		kube = provider.kube
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("restores the pre-deploy annotations after they were edited", func() {
+		// someone edits the annotations after the filter was deployed, dropping the wasme backups
+		dep, err := kube.AppsV1().Deployments(ns).Get("work", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		dep.Spec.Template.Annotations = map[string]string{
+			"sidecar.istio.io/userVolume": `[{"name":"edited","emptyDir":{}}]`,
+			"unrelated":                   "edited",
+		}
+		_, err = kube.AppsV1().Deployments(ns).Update(dep)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(provider.envoyFilters).To(HaveKey(istio.EnvoyFilterName("work", filter.Id)))
+
+		err = provider.RevertFilter(filter.Id)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(provider.envoyFilters).To(BeEmpty())
+
+		// only the annotations touched by wasme are restored
+		Expect(getAnnotations()).To(Equal(map[string]string{
+			"sidecar.istio.io/userVolume":      originalAnnotations["sidecar.istio.io/userVolume"],
+			"sidecar.istio.io/userVolumeMount": originalAnnotations["sidecar.istio.io/userVolumeMount"],
+			"unrelated":                        "edited",
+		}))
+
+		_, err = kube.CoreV1().ConfigMaps(ns).Get(istio.SnapshotConfigMapName, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("keeps the original snapshot when the filter is redeployed", func() {
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = provider.RevertFilter(filter.Id)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getAnnotations()).To(Equal(originalAnnotations))
+		Expect(provider.envoyFilters).To(BeEmpty())
+	})
+
+	It("prunes the snapshots on undeploy", func() {
+		cm, err := kube.CoreV1().ConfigMaps(ns).Get(istio.SnapshotConfigMapName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cm.Data).To(HaveLen(1))
+
+		err = provider.RemoveFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getAnnotations()).To(Equal(originalAnnotations))
+		Expect(provider.envoyFilters).To(BeEmpty())
+
+		_, err = kube.CoreV1().ConfigMaps(ns).Get(istio.SnapshotConfigMapName, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+
+		err = provider.RevertFilter(filter.Id)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("no snapshots found"))
+	})
+})
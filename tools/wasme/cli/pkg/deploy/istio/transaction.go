@@ -0,0 +1,122 @@
+package istio
+
+import (
+	"fmt"
+	"strings"
+
+	"istio.io/client-go/pkg/apis/networking/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// RollbackError is returned when a change was rolled back after it failed partway.
+// Failures holds the mutations which could not be undone, in the order they were attempted;
+// if it is empty, the cluster was returned to its state before the change
+type RollbackError struct {
+	// the error which caused the rollback
+	Cause error
+	// the number of mutations which were undone
+	RolledBack int
+	// the mutations which could not be undone
+	Failures []error
+}
+
+func (e *RollbackError) Error() string {
+	if len(e.Failures) == 0 {
+		return fmt.Sprintf("%v (rolled back %v changes)", e.Cause, e.RolledBack)
+	}
+	var failures []string
+	for _, failure := range e.Failures {
+		failures = append(failures, failure.Error())
+	}
+	return fmt.Sprintf("%v (rolled back %v changes, %v could not be rolled back: %v)",
+		e.Cause, e.RolledBack, len(e.Failures), strings.Join(failures, "; "))
+}
+
+func (e *RollbackError) Unwrap() error {
+	return e.Cause
+}
+
+// a mutation made to the cluster, and how to undo it
+type mutation struct {
+	description string
+	undo        func() error
+}
+
+// records the mutations made by an operation, so they can be undone if it fails partway.
+// a nil transaction records nothing
+type transaction struct {
+	mutations []mutation
+	logger    Logger
+}
+
+func (t *transaction) record(description string, undo func() error) {
+	if t == nil {
+		return
+	}
+	t.mutations = append(t.mutations, mutation{description: description, undo: undo})
+}
+
+// undoes the recorded mutations in the reverse order they were made.
+// every mutation is attempted, even if undoing a later one failed
+func (t *transaction) rollback(cause error) error {
+	if t == nil || len(t.mutations) == 0 {
+		return cause
+	}
+	t.logger.WithError(cause).Warnf("rolling back %v changes", len(t.mutations))
+
+	rollbackErr := &RollbackError{Cause: cause}
+	for i := len(t.mutations) - 1; i >= 0; i-- {
+		m := t.mutations[i]
+		logger := t.logger.WithFields(Fields{"change": m.description})
+		if err := m.undo(); err != nil {
+			logger.WithError(err).Errorf("failed to roll back change")
+			rollbackErr.Failures = append(rollbackErr.Failures, fmt.Errorf("%v: %v", m.description, err))
+			continue
+		}
+		logger.Infof("rolled back change")
+		rollbackErr.RolledBack++
+	}
+	t.mutations = nil
+	return rollbackErr
+}
+
+// records the update of the workload, so the annotations written by wasme
+// can be restored to their values before the update
+func (p *Provider) recordWorkloadUpdate(tx *transaction, workloadName string, before map[string]string) {
+	kind := strings.ToLower(p.Workload.Kind)
+	tx.record(fmt.Sprintf("update annotations of %v %v", kind, workloadName), func() error {
+		return p.updateWorkload(kind, workloadName, func(template *corev1.PodTemplateSpec) {
+			restoreTouchedAnnotations(template, before)
+		})
+	})
+}
+
+// records the creation or update of the EnvoyFilter.
+// must be called before the EnvoyFilter is written, so an existing EnvoyFilter can be restored
+func (p *Provider) recordEnvoyFilterUpdate(tx *transaction, envoyFilter *v1alpha3.EnvoyFilter) error {
+	if tx == nil {
+		return nil
+	}
+	existing := &v1alpha3.EnvoyFilter{}
+	existing.Name, existing.Namespace = envoyFilter.Name, envoyFilter.Namespace
+	if err := p.Client.Get(p.Ctx, existing); err != nil {
+		if !kubeerrors.IsNotFound(err) {
+			return err
+		}
+		tx.record("create EnvoyFilter "+envoyFilter.Name+"."+envoyFilter.Namespace, func() error {
+			err := p.Client.Delete(p.Ctx, &v1alpha3.EnvoyFilter{ObjectMeta: envoyFilter.ObjectMeta})
+			if kubeerrors.IsNotFound(err) {
+				return nil
+			}
+			return err
+		})
+		return nil
+	}
+	tx.record("update EnvoyFilter "+envoyFilter.Name+"."+envoyFilter.Namespace, func() error {
+		previous := existing.DeepCopy()
+		previous.ResourceVersion = ""
+		return p.Client.Ensure(p.Ctx, nil, previous)
+	})
+	return nil
+}
@@ -0,0 +1,176 @@
+package istio_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"github.com/solo-io/skv2/pkg/ezkube"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cache"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	pkgcache "github.com/solo-io/wasm/tools/wasme/pkg/cache"
+	istiov1alpha3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	appsv1 "k8s.io/api/apps/v1"
+	kubev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Atomic apply", func() {
+	var (
+		kube         *fake.Clientset
+		provider     *testProvider
+		envoyFilters map[string]*istiov1alpha3.EnvoyFilter
+		// workloads which cannot be updated
+		failingWorkloads map[string]bool
+		deleteErr        error
+		filter           = &wasmev1.FilterSpec{
+			Id:     "filter-id",
+			Image:  "filter/image:v1",
+			RootID: "root_id",
+		}
+	)
+
+	BeforeEach(func() {
+		failingWorkloads = map[string]bool{"b-work": true}
+		deleteErr = nil
+
+		provider = newTestProvider(
+			&kubev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "wasme-cache",
+					Namespace: "wasme",
+				},
+				Data: map[string]string{cache.ImagesKey: "docker.io/other/image:v1"},
+			},
+			makeDeployment("a-work", "default", map[string]string{"sidecar.istio.io/userVolume": `[{"name":"other"}]`}),
+			makeDeployment("b-work", "default", nil),
+			makeDeployment("c-work", "default", nil),
+		)
+		kube = provider.kube
+		envoyFilters = provider.envoyFilters
+		provider.onEnsure = func(obj ezkube.Object) error {
+			if workload, ok := obj.(*appsv1.Deployment); ok && failingWorkloads[workload.Name] {
+				return errors.New("update rejected")
+			}
+			return nil
+		}
+		provider.onDelete = func(obj ezkube.Object) error {
+			if deleteErr != nil {
+				return deleteErr
+			}
+			if _, ok := envoyFilters[obj.GetName()]; !ok {
+				return kubeerrors.NewNotFound(schema.GroupResource{}, obj.GetName())
+			}
+			return nil
+		}
+		provider.AtomicApply = true
+	})
+	getAnnotations := func(name string) map[string]string {
+		workload, err := kube.AppsV1().Deployments("default").Get(name, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		return workload.Spec.Template.Annotations
+	}
+
+	getCachedImages := func() []string {
+		cm, err := kube.CoreV1().ConfigMaps("wasme").Get("wasme-cache", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		images, err := pkgcache.ParseImageList(cm.Data[cache.ImagesKey])
+		Expect(err).NotTo(HaveOccurred())
+		return images.Refs()
+	}
+
+	expectSnapshotsDeleted := func() {
+		_, err := kube.CoreV1().ConfigMaps("default").Get(istio.SnapshotConfigMapName, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+	}
+
+	It("rolls back the changes made before the failing workload", func() {
+		err := provider.ApplyFilter(filter)
+		Expect(err).To(HaveOccurred())
+
+		rollbackErr, ok := err.(*istio.RollbackError)
+		Expect(ok).To(BeTrue())
+		Expect(rollbackErr.Cause.Error()).To(ContainSubstring("update rejected"))
+		Expect(rollbackErr.Failures).To(BeEmpty())
+		Expect(rollbackErr.RolledBack).To(BeNumerically(">", 0))
+
+		Expect(getAnnotations("a-work")).To(Equal(map[string]string{"sidecar.istio.io/userVolume": `[{"name":"other"}]`}))
+		Expect(getAnnotations("c-work")).To(BeEmpty())
+		Expect(envoyFilters).To(BeEmpty())
+		Expect(getCachedImages()).To(Equal([]string{"docker.io/other/image:v1"}))
+		expectSnapshotsDeleted()
+	})
+
+	It("restores the EnvoyFilters which existed before the apply", func() {
+		previous := &istiov1alpha3.EnvoyFilter{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "a-work-filter-id",
+				Namespace:   "default",
+				Annotations: map[string]string{"previous": "true"},
+			},
+		}
+		envoyFilters[previous.Name] = previous.DeepCopy()
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).To(HaveOccurred())
+
+		Expect(envoyFilters).To(HaveKey("a-work-filter-id"))
+		Expect(envoyFilters["a-work-filter-id"].Annotations).To(Equal(previous.Annotations))
+	})
+
+	It("reports the changes which could not be rolled back", func() {
+		deleteErr = errors.New("delete forbidden")
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).To(HaveOccurred())
+
+		rollbackErr, ok := err.(*istio.RollbackError)
+		Expect(ok).To(BeTrue())
+		var failures []string
+		for _, failure := range rollbackErr.Failures {
+			failures = append(failures, failure.Error())
+		}
+		Expect(failures).To(Equal([]string{
+			"create EnvoyFilter b-work-filter-id.default: delete forbidden",
+			"create EnvoyFilter a-work-filter-id.default: delete forbidden",
+		}))
+		Expect(err.Error()).To(ContainSubstring("2 could not be rolled back"))
+
+		// the remaining changes are still rolled back
+		Expect(getAnnotations("a-work")).NotTo(HaveKey("sidecar.istio.io/userVolumeMount"))
+		Expect(getCachedImages()).To(Equal([]string{"docker.io/other/image:v1"}))
+	})
+
+	It("leaves the applied workloads in place when not atomic", func() {
+		provider.AtomicApply = false
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).To(HaveOccurred())
+		_, ok := err.(*istio.RollbackError)
+		Expect(ok).To(BeFalse())
+
+		Expect(getAnnotations("a-work")).To(HaveKey("sidecar.istio.io/userVolumeMount"))
+		Expect(envoyFilters).To(HaveKey("a-work-filter-id"))
+	})
+
+	It("restores the annotations of the workloads when the filter cannot be removed from every workload", func() {
+		failingWorkloads = map[string]bool{}
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+		applied := getAnnotations("c-work")
+		Expect(applied).To(HaveKey("sidecar.istio.io/userVolumeMount"))
+
+		// workloads are removed in the reverse order
+		failingWorkloads = map[string]bool{"a-work": true}
+		err = provider.RemoveFilter(filter)
+		Expect(err).To(HaveOccurred())
+		_, ok := err.(*istio.RollbackError)
+		Expect(ok).To(BeTrue())
+
+		Expect(getAnnotations("c-work")).To(Equal(applied))
+		Expect(envoyFilters).To(HaveLen(3))
+	})
+})
@@ -0,0 +1,121 @@
+package istio
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/docker/distribution/reference"
+	"github.com/gogo/protobuf/types"
+	envoyfilter "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/filter"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	"github.com/solo-io/wasm/tools/wasme/pkg/signature"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Violation is a field of a FilterSpec which is invalid
+type Violation struct {
+	// the field of the FilterSpec, as it is named in the FilterDeployment
+	Field   string
+	Message string
+}
+
+func (v Violation) String() string {
+	return v.Field + ": " + v.Message
+}
+
+// ValidationError holds every violation found in a FilterSpec
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	var violations []string
+	for _, violation := range e.Violations {
+		violations = append(violations, violation.String())
+	}
+	return "invalid filter: " + strings.Join(violations, "; ")
+}
+
+// Validate checks that the filter can be deployed to istio, without touching the cluster.
+// returns a *ValidationError with every violation found, or nil if the filter is valid
+func Validate(filter *v1.FilterSpec) error {
+	var violations []Violation
+	violate := func(field, format string, args ...interface{}) {
+		violations = append(violations, Violation{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// the filter id names the EnvoyFilters, while the root id may be any string the proxy accepts
+	if errs := validation.IsDNS1123Subdomain(filter.GetId()); len(errs) > 0 {
+		violate("id", "filter id %q must be a valid Kubernetes resource name: %v", filter.GetId(), strings.Join(errs, ", "))
+	}
+
+	if filter.GetImage() == "" {
+		violate("image", "must not be empty")
+	} else if _, err := reference.ParseNormalizedNamed(filter.GetImage()); err != nil {
+		violate("image", "%q is not a valid image reference: %v", filter.GetImage(), err)
+	}
+
+	if patchContext := filter.GetPatchContext(); patchContext != "" && !isSupportedPatchContext(patchContext) {
+		violate("patchContext", "unknown patch context %v, must be one of the following values: %s", patchContext, strings.Join(SupportedPatchContexts, ", "))
+	}
+
+	if filterType := filter.GetFilterType(); filterType != "" && !isSupportedFilterType(filterType) {
+		violate("filterType", "unknown filter type %v, must be one of the following values: %s", filterType, strings.Join(SupportedFilterTypes, ", "))
+	} else if isNetworkFilter(filter) {
+		// the filter position of network filters is fixed
+		if filter.GetOrderBefore() != "" {
+			violate("orderBefore", "network filters cannot be ordered relative to other filters")
+		}
+		if filter.GetOrderAfter() != "" {
+			violate("orderAfter", "network filters cannot be ordered relative to other filters")
+		}
+	}
+
+	if config := filter.GetConfig(); config != nil {
+		var da types.DynamicAny
+		if err := types.UnmarshalAny(config, &da); err != nil {
+			violate("config", "cannot be read: %v", err)
+		}
+		if filter.GetConfigFrom() != nil {
+			violate("configFrom", "cannot set both config and configFrom")
+		}
+	}
+
+	if opts := SignatureVerifyOptions(filter.GetVerifySignature()); opts != nil {
+		if _, err := signature.NewVerifier(nil, *opts); err != nil {
+			violate("verifySignature", "%v", err)
+		}
+	}
+
+	if err := envoyfilter.ValidateEnv(filter.GetEnv()); err != nil {
+		violate("env", "%v", err)
+	}
+
+	if strings.IndexFunc(filter.GetRootID(), unicode.IsSpace) >= 0 {
+		violate("rootID", "root id %q must not contain whitespace", filter.GetRootID())
+	}
+
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+func isSupportedPatchContext(patchContext string) bool {
+	for _, supported := range SupportedPatchContexts {
+		if strings.ToLower(patchContext) == supported {
+			return true
+		}
+	}
+	return false
+}
+
+func isSupportedFilterType(filterType string) bool {
+	for _, supported := range SupportedFilterTypes {
+		if strings.ToLower(filterType) == supported {
+			return true
+		}
+	}
+	return false
+}
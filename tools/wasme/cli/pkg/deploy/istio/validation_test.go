@@ -0,0 +1,144 @@
+package istio_test
+
+import (
+	"github.com/gogo/protobuf/types"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/skv2/pkg/ezkube"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cache"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Validate", func() {
+	validFilter := func() *wasmev1.FilterSpec {
+		config, err := types.MarshalAny(&types.StringValue{Value: `{"greeting":"hello"}`})
+		Expect(err).NotTo(HaveOccurred())
+		return &wasmev1.FilterSpec{
+			Id:           "my-filter.default",
+			Image:        "webassemblyhub.io/me/filter:v0.2",
+			RootID:       "Stats_Root",
+			PatchContext: istio.PatchContextOutbound,
+			Config:       config,
+		}
+	}
+
+	getFields := func(err error) []string {
+		validationErr, ok := err.(*istio.ValidationError)
+		Expect(ok).To(BeTrue())
+		var fields []string
+		for _, violation := range validationErr.Violations {
+			fields = append(fields, violation.Field)
+		}
+		return fields
+	}
+
+	It("accepts valid filters", func() {
+		Expect(istio.Validate(validFilter())).NotTo(HaveOccurred())
+
+		// the patch context and config are optional
+		filter := validFilter()
+		filter.PatchContext = ""
+		filter.Config = nil
+		Expect(istio.Validate(filter)).NotTo(HaveOccurred())
+	})
+
+	It("accepts images referenced by digest", func() {
+		filter := validFilter()
+		filter.Image = "webassemblyhub.io/me/filter@sha256:e454cab754cf9234e8b41d7c5e30f53a4c125d7d9443cb3ef2b2eb1c4bd1ec14"
+		Expect(istio.Validate(filter)).NotTo(HaveOccurred())
+	})
+
+	It("returns every violation at once", func() {
+		err := istio.Validate(&wasmev1.FilterSpec{
+			Id:           "My_Filter",
+			Image:        "",
+			RootID:       "stats root",
+			PatchContext: "sideways",
+			Config:       &types.Any{TypeUrl: "type.googleapis.com/unknown.Type"},
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(getFields(err)).To(Equal([]string{"id", "image", "patchContext", "config", "rootID"}))
+		Expect(err.Error()).To(ContainSubstring(`filter id "My_Filter" must be a valid Kubernetes resource name`))
+		Expect(err.Error()).To(ContainSubstring("image: must not be empty"))
+		Expect(err.Error()).To(ContainSubstring("unknown patch context sideways"))
+	})
+
+	It("rejects malformed image references", func() {
+		filter := validFilter()
+		filter.Image = "WebAssemblyHub.io/Me/Filter:v0.2"
+		Expect(getFields(istio.Validate(filter))).To(Equal([]string{"image"}))
+	})
+
+	It("rejects filters which set both config and configFrom", func() {
+		filter := validFilter()
+		filter.ConfigFrom = &wasmev1.ConfigSource{
+			ConfigMapKeyRef: &wasmev1.KeyReference{Name: "filter-config", Key: "config"},
+		}
+		Expect(getFields(istio.Validate(filter))).To(Equal([]string{"configFrom"}))
+	})
+
+	It("rejects unknown filter types", func() {
+		filter := validFilter()
+		filter.FilterType = "udp"
+		Expect(getFields(istio.Validate(filter))).To(Equal([]string{"filterType"}))
+
+		filter.FilterType = istio.FilterTypeNetwork
+		Expect(istio.Validate(filter)).NotTo(HaveOccurred())
+	})
+
+	It("rejects ordering network filters", func() {
+		filter := validFilter()
+		filter.FilterType = istio.FilterTypeNetwork
+		filter.OrderBefore = "other-filter"
+		filter.OrderAfter = "other-filter"
+		Expect(getFields(istio.Validate(filter))).To(Equal([]string{"orderBefore", "orderAfter"}))
+	})
+
+	It("rejects signature verifications without a valid public key or roots", func() {
+		filter := validFilter()
+		filter.VerifySignature = &wasmev1.SignatureVerification{}
+		Expect(getFields(istio.Validate(filter))).To(Equal([]string{"verifySignature"}))
+
+		filter.VerifySignature.PublicKey = "not a key"
+		Expect(istio.Validate(filter)).To(MatchError(ContainSubstring("no PEM encoded public key found")))
+	})
+
+	It("rejects invalid or reserved environment variables", func() {
+		filter := validFilter()
+		filter.Env = map[string]string{"LOG_LEVEL": "debug", "1_INVALID": "x"}
+		Expect(getFields(istio.Validate(filter))).To(Equal([]string{"env"}))
+
+		filter.Env = map[string]string{"wasme_filter": "x"}
+		Expect(istio.Validate(filter)).To(MatchError(ContainSubstring("the WASME_ prefix is reserved")))
+
+		filter.Env = map[string]string{"LOG_LEVEL": "debug"}
+		Expect(istio.Validate(filter)).NotTo(HaveOccurred())
+	})
+
+	It("rejects invalid filters before the cluster is modified", func() {
+		provider := newTestProvider()
+		provider.onEnsure = func(obj ezkube.Object) error {
+			Fail("the cluster was modified: ensured " + obj.GetName())
+			return nil
+		}
+		provider.onDelete = func(obj ezkube.Object) error {
+			Fail("the cluster was modified: deleted " + obj.GetName())
+			return nil
+		}
+
+		err := provider.ApplyFilter(&wasmev1.FilterSpec{
+			Id:           "filter-id",
+			Image:        "filter/image:v1",
+			PatchContext: "sideways",
+		})
+		Expect(err).To(HaveOccurred())
+		_, ok := err.(*istio.ValidationError)
+		Expect(ok).To(BeTrue())
+
+		cm, err := provider.kube.CoreV1().ConfigMaps("wasme").Get("wasme-cache", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cm.Data[cache.ImagesKey]).To(BeEmpty())
+	})
+})
@@ -0,0 +1,47 @@
+package istio
+
+import (
+	"github.com/pkg/errors"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
+	"github.com/solo-io/wasm/tools/wasme/pkg/signature"
+)
+
+// SignatureVerifyOptions returns the options to verify the signatures of the image of a FilterDeployment,
+// or nil if the signatures are not verified
+func SignatureVerifyOptions(verification *v1.SignatureVerification) *signature.VerifyOptions {
+	if verification == nil {
+		return nil
+	}
+	opts := &signature.VerifyOptions{Annotations: verification.GetAnnotations()}
+	if verification.GetPublicKey() != "" {
+		opts.PublicKey = []byte(verification.GetPublicKey())
+	}
+	if verification.GetRoots() != "" {
+		opts.Roots = []byte(verification.GetRoots())
+	}
+	return opts
+}
+
+// checks the signature of the image against the digest of its manifest, if the provider verifies signatures
+func (p *Provider) verifySignature(image pull.Image) error {
+	if p.VerifyOptions == nil {
+		return nil
+	}
+	manifestImage, ok := image.(pull.ManifestImage)
+	if !ok {
+		return errors.Errorf("cannot verify the signature of image %v: the digest of its manifest is unknown", image.Ref())
+	}
+	verifier, err := signature.NewVerifier(p.Puller, *p.VerifyOptions)
+	if err != nil {
+		return err
+	}
+	if err := verifier.Verify(p.Ctx, image.Ref(), manifestImage.ManifestDigest()); err != nil {
+		return errors.Wrap(err, "verifying image signature")
+	}
+	p.logger().WithFields(Fields{
+		"image":  image.Ref(),
+		"digest": manifestImage.ManifestDigest(),
+	}).Infof("verified image signature")
+	return nil
+}
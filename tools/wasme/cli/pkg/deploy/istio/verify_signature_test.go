@@ -0,0 +1,143 @@
+package istio_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cache"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
+	"github.com/solo-io/wasm/tools/wasme/pkg/signature"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Signature verification", func() {
+	const manifestDigest = "sha256:4c0a1c93e9b3d1ea6fa5b3e9a23e0d2b1d42c1b89917a4ffdbc450e3c81f3f5e"
+	var (
+		kube     *fake.Clientset
+		provider *testProvider
+		puller   *signedPuller
+		key      *ecdsa.PrivateKey
+	)
+
+	filter := &wasmev1.FilterSpec{Id: "filter-a", Image: "filter/image:v1", RootID: "root_id"}
+
+	BeforeEach(func() {
+		var err error
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+
+		provider = newTestProvider(makeDeployment("work", "default", nil))
+		kube = provider.kube
+
+		puller = &signedPuller{image: mockImage{ref: "docker.io/filter/image:v1", digest: testImageDigest, manifestDigest: manifestDigest}}
+		provider.Puller = puller
+		der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		Expect(err).NotTo(HaveOccurred())
+		provider.VerifyOptions = &signature.VerifyOptions{
+			PublicKey: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}),
+		}
+	})
+
+	// attaches a signature of the digest made with the key
+	sign := func(key *ecdsa.PrivateKey, signedDigest string) {
+		payload, err := json.Marshal(map[string]interface{}{
+			"critical": map[string]interface{}{
+				"image": map[string]string{"docker-manifest-digest": signedDigest},
+				"type":  "cosign container image signature",
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		hash := sha256.Sum256(payload)
+		sig, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+		Expect(err).NotTo(HaveOccurred())
+		puller.signature = &signatureImage{
+			desc: v1.Descriptor{
+				MediaType:   signature.SimpleSigningMediaType,
+				Digest:      digest.FromBytes(payload),
+				Size:        int64(len(payload)),
+				Annotations: map[string]string{signature.SignatureAnnotation: base64.StdEncoding.EncodeToString(sig)},
+			},
+			payload: payload,
+		}
+	}
+
+	getCachedImages := func() string {
+		cm, err := kube.CoreV1().ConfigMaps("wasme").Get("wasme-cache", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		return cm.Data[cache.ImagesKey]
+	}
+
+	It("applies the filter if the image is signed with the key", func() {
+		sign(key, manifestDigest)
+		Expect(provider.ApplyFilter(filter)).To(Succeed())
+		Expect(getCachedImages()).To(ContainSubstring("filter/image:v1"))
+		Expect(puller.pulled).To(ContainElement("docker.io/filter/image:sha256-" + strings.TrimPrefix(manifestDigest, "sha256:") + ".sig"))
+	})
+
+	It("does not add unsigned images to the cache", func() {
+		err := provider.ApplyFilter(filter)
+		Expect(err).To(MatchError(ContainSubstring("verifying image signature")))
+		Expect(getCachedImages()).NotTo(ContainSubstring("filter/image:v1"))
+	})
+
+	It("does not add images signed with another key, or for another digest, to the cache", func() {
+		otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		sign(otherKey, manifestDigest)
+		Expect(provider.ApplyFilter(filter)).To(MatchError(ContainSubstring("invalid signature")))
+
+		sign(key, testImageDigest)
+		Expect(provider.ApplyFilter(filter)).To(MatchError(ContainSubstring("not " + manifestDigest)))
+		Expect(getCachedImages()).NotTo(ContainSubstring("filter/image:v1"))
+	})
+})
+
+// returns the signature for the refs of signatures, and the image for other refs
+type signedPuller struct {
+	image     mockImage
+	signature *signatureImage
+	pulled    []string
+}
+
+func (p *signedPuller) Pull(ctx context.Context, ref string) (pull.Image, error) {
+	p.pulled = append(p.pulled, ref)
+	if !strings.HasSuffix(ref, ".sig") {
+		return &p.image, nil
+	}
+	if p.signature == nil {
+		return nil, errors.Errorf("%v: not found", ref)
+	}
+	return p.signature, nil
+}
+
+type signatureImage struct {
+	mockImage
+	desc    v1.Descriptor
+	payload []byte
+}
+
+func (i *signatureImage) Blobs() []v1.Descriptor {
+	return []v1.Descriptor{i.desc}
+}
+
+func (i *signatureImage) FetchBlob(ctx context.Context, desc v1.Descriptor) (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(i.payload)), nil
+}
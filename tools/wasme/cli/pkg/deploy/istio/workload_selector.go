@@ -0,0 +1,61 @@
+package istio
+
+import (
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// labels set by controllers and tooling which change between rollouts of a workload.
+// they are left out of the workload selectors of the EnvoyFilters,
+// which would otherwise stop matching the pods of the workload after it is redeployed
+var volatileLabels = []string{
+	appsv1.DefaultDeploymentUniqueLabelKey,
+	appsv1.ControllerRevisionHashLabelKey,
+	extensionsv1beta1.DaemonSetTemplateGenerationKey,
+}
+
+// checks that the SelectorLabels of the provider are valid labels
+func (p *Provider) validateSelectorLabels() error {
+	if err := metav1validation.ValidateLabels(p.SelectorLabels, field.NewPath("selectorLabels")).ToAggregate(); err != nil {
+		return errors.Wrap(err, "invalid selector labels")
+	}
+	return nil
+}
+
+// returns the labels of the workload selector of the EnvoyFilter for a workload with the given pod template labels.
+// the SelectorLabels are used verbatim if set, otherwise the template labels without the volatile labels
+func (p *Provider) workloadSelectorLabels(templateLabels map[string]string) map[string]string {
+	if len(p.SelectorLabels) > 0 {
+		return p.SelectorLabels
+	}
+	selector := map[string]string{}
+	for k, v := range templateLabels {
+		selector[k] = v
+	}
+	for _, volatile := range volatileLabels {
+		delete(selector, volatile)
+	}
+	return selector
+}
+
+// warns if the selector does not match any current pod in the target namespace,
+// as the EnvoyFilter would not apply to any proxy
+func (p *Provider) checkSelectorMatchesPods(logger Logger, selector map[string]string) {
+	pods, err := p.KubeClient.CoreV1().Pods(p.Workload.Namespace).List(metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(selector).String(),
+	})
+	if err != nil {
+		logger.WithError(err).Debugf("failed to list the pods matched by the workload selector")
+		return
+	}
+	if len(pods.Items) == 0 {
+		logger.WithFields(Fields{
+			"selector": selector,
+		}).Warnf("the workload selector of the EnvoyFilter does not match any pod, the filter will not take effect until a pod with these labels is created")
+	}
+}
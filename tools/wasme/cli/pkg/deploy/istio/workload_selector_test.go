@@ -0,0 +1,93 @@
+package istio_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	wasmev1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	istiov1alpha3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	kubev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("EnvoyFilter workload selector", func() {
+	const warning = "the workload selector of the EnvoyFilter does not match any pod, the filter will not take effect until a pod with these labels is created"
+	var (
+		provider     *testProvider
+		logger       *recordingLogger
+		envoyFilters map[string]*istiov1alpha3.EnvoyFilter
+		filter       = &wasmev1.FilterSpec{
+			Id:     "filter-id",
+			Image:  "filter/image:v1",
+			RootID: "root_id",
+		}
+	)
+
+	BeforeEach(func() {
+		workload := makeDeployment("work", "default", nil)
+		workload.Spec.Template.Labels = map[string]string{
+			"app":               "work",
+			"version":           "v1",
+			"pod-template-hash": "5d4f8b7c9",
+		}
+		provider = newTestProvider(
+			workload,
+			&kubev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "work-5d4f8b7c9-x2k4p",
+					Namespace: "default",
+					Labels:    map[string]string{"app": "work", "version": "v1", "pod-template-hash": "5d4f8b7c9"},
+				},
+			},
+		)
+		envoyFilters = provider.envoyFilters
+
+		logger = newRecordingLogger()
+		provider.Logger = logger
+	})
+
+	getSelector := func() map[string]string {
+		envoyFilter, ok := envoyFilters[istio.EnvoyFilterName("work", filter.Id)]
+		Expect(ok).To(BeTrue())
+		return envoyFilter.Spec.WorkloadSelector.Labels
+	}
+
+	It("leaves out the labels which change between rollouts", func() {
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(getSelector()).To(Equal(map[string]string{"app": "work", "version": "v1"}))
+		Expect(logger.withMessage(warning)).To(BeEmpty())
+	})
+
+	It("uses the selector labels verbatim", func() {
+		provider.SelectorLabels = map[string]string{"app": "work"}
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(getSelector()).To(Equal(map[string]string{"app": "work"}))
+		Expect(logger.withMessage(warning)).To(BeEmpty())
+	})
+
+	It("warns when the selector does not match any pod", func() {
+		provider.SelectorLabels = map[string]string{"app": "work", "version": "v2"}
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		warnings := logger.withMessage(warning)
+		Expect(warnings).To(HaveLen(1))
+		Expect(warnings[0].fields).To(HaveKeyWithValue("workload", "work"))
+		Expect(warnings[0].fields).To(HaveKeyWithValue("selector", map[string]string{"app": "work", "version": "v2"}))
+	})
+
+	It("rejects invalid selector labels before the cluster is modified", func() {
+		provider.SelectorLabels = map[string]string{"app": "not a label value"}
+
+		err := provider.ApplyFilter(filter)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("invalid selector labels"))
+		Expect(envoyFilters).To(BeEmpty())
+	})
+})
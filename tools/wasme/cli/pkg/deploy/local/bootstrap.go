@@ -0,0 +1,288 @@
+package local
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultListenerPort = 8080
+	DefaultAdminPort    = 19000
+)
+
+// BasicEnvoyConfig is the bootstrap rendered with the DefaultBootstrapOptions,
+// with a single route to jsonplaceholder.typicode.com
+var BasicEnvoyConfig = mustRenderBootstrap(DefaultBootstrapOptions())
+
+// BootstrapOptions are templated into the default bootstrap config
+type BootstrapOptions struct {
+	// the port of the listener the filter is added to
+	ListenerPort uint32
+	// the port of the Envoy admin API
+	AdminPort uint32
+	// the clusters the requests are routed to, by path prefix
+	Upstreams []Upstream
+	// render the bootstrap in the v3 API, e.g. for the proxies of Istio 1.7+
+	V3 bool
+}
+
+// Upstream is a cluster of the bootstrap config, and the route to it
+type Upstream struct {
+	// the name of the cluster
+	Name string
+	Host string
+	Port uint32
+	// connect to the upstream with TLS, using the host as SNI
+	TLS bool
+	// the requests whose path starts with the prefix are routed to the upstream
+	PathPrefix string
+}
+
+func DefaultBootstrapOptions() BootstrapOptions {
+	return BootstrapOptions{
+		ListenerPort: DefaultListenerPort,
+		AdminPort:    DefaultAdminPort,
+		Upstreams: []Upstream{{
+			Name:       "static-cluster",
+			Host:       "jsonplaceholder.typicode.com",
+			Port:       443,
+			TLS:        true,
+			PathPrefix: "/",
+		}},
+	}
+}
+
+// ParseUpstream parses an upstream in the format [<path prefix>=][http://|https://]<host>:<port>, e.g. /api=localhost:9000.
+// the path prefix defaults to /, and the upstream is connected to with TLS if the scheme is https
+func ParseUpstream(name, s string) (Upstream, error) {
+	upstream := Upstream{Name: name, PathPrefix: "/"}
+	address := s
+	if i := strings.Index(s, "="); i >= 0 {
+		upstream.PathPrefix, address = s[:i], s[i+1:]
+	}
+	switch {
+	case strings.HasPrefix(address, "https://"):
+		upstream.TLS = true
+		address = strings.TrimPrefix(address, "https://")
+	case strings.HasPrefix(address, "http://"):
+		address = strings.TrimPrefix(address, "http://")
+	}
+
+	if !strings.HasPrefix(upstream.PathPrefix, "/") || strings.ContainsAny(upstream.PathPrefix, "\"' \t") {
+		return Upstream{}, errors.Errorf("invalid upstream %v: the path prefix must start with / and cannot contain quotes or spaces", s)
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return Upstream{}, errors.Wrapf(err, "invalid upstream %v, expected [<path prefix>=]<host>:<port>", s)
+	}
+	if host == "" || strings.ContainsAny(host, "/\"' \t,{}[]") {
+		return Upstream{}, errors.Errorf("invalid upstream %v: invalid host %q", s, host)
+	}
+	upstream.Host = host
+	upstream.Port, err = parsePort(port)
+	if err != nil {
+		return Upstream{}, errors.Wrapf(err, "invalid upstream %v", s)
+	}
+	return upstream, nil
+}
+
+func parsePort(s string) (uint32, error) {
+	port, err := strconv.ParseUint(s, 10, 16)
+	if err != nil || port == 0 {
+		return 0, errors.Errorf("invalid port %v, must be between 1 and 65535", s)
+	}
+	return uint32(port), nil
+}
+
+// Validate checks the ports of the options do not conflict, and each path prefix is routed to a single upstream
+func (opts BootstrapOptions) Validate() error {
+	for _, port := range []uint32{opts.ListenerPort, opts.AdminPort} {
+		if port == 0 || port > 65535 {
+			return errors.Errorf("invalid port %v, must be between 1 and 65535", port)
+		}
+	}
+	if opts.ListenerPort == opts.AdminPort {
+		return errors.Errorf("the listener and the admin API cannot both use port %v", opts.ListenerPort)
+	}
+	if len(opts.Upstreams) == 0 {
+		return errors.Errorf("at least one upstream is required")
+	}
+	prefixes := map[string]string{}
+	for _, upstream := range opts.Upstreams {
+		if other, ok := prefixes[upstream.PathPrefix]; ok {
+			return errors.Errorf("upstreams %v and %v are both routed the path prefix %v", other, upstream.Name, upstream.PathPrefix)
+		}
+		prefixes[upstream.PathPrefix] = upstream.Name
+	}
+	return nil
+}
+
+// the routes to the upstreams. the longest prefixes are matched first, as envoy uses the first matching route
+func (opts BootstrapOptions) routes() []Upstream {
+	routes := append([]Upstream{}, opts.Upstreams...)
+	sort.SliceStable(routes, func(i, j int) bool {
+		return len(routes[i].PathPrefix) > len(routes[j].PathPrefix)
+	})
+	return routes
+}
+
+// RenderBootstrap returns the default bootstrap config with the options templated into it
+func RenderBootstrap(opts BootstrapOptions) (string, error) {
+	if err := opts.Validate(); err != nil {
+		return "", err
+	}
+	tmpl := bootstrapTemplate
+	if opts.V3 {
+		tmpl = bootstrapV3Template
+	}
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, struct {
+		BootstrapOptions
+		Routes []Upstream
+	}{
+		BootstrapOptions: opts,
+		Routes:           opts.routes(),
+	}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func mustRenderBootstrap(opts BootstrapOptions) string {
+	bootstrap, err := RenderBootstrap(opts)
+	if err != nil {
+		panic(err)
+	}
+	return bootstrap
+}
+
+// returns an error if the ports conflict with each other or with a service listening on the local machine
+func checkPortsAvailable(ports []uint32) error {
+	used := map[uint32]bool{}
+	for _, port := range ports {
+		if used[port] {
+			return errors.Errorf("port %v is used by more than one listener of the bootstrap config", port)
+		}
+		used[port] = true
+
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%v", port))
+		if err != nil {
+			return errors.Wrapf(err, "port %v is not available, it may be used by another service", port)
+		}
+		if err := listener.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var bootstrapTemplate = template.Must(template.New("bootstrap").Parse(`
+admin:
+  access_log_path: /dev/null
+  address:
+    socket_address:
+      address: 0.0.0.0
+      port_value: {{ .AdminPort }}
+static_resources:
+  listeners:
+  - name: listener_0
+    address:
+      socket_address: { address: 0.0.0.0, port_value: {{ .ListenerPort }} }
+    filter_chains:
+    - filters:
+      - name: envoy.http_connection_manager
+        config:
+          codec_type: AUTO
+          stat_prefix: ingress_http
+          route_config:
+            name: local_route
+            virtual_hosts:
+            - name: upstreams
+              domains: ["*"]
+              routes:
+{{- range .Routes }}
+              - match: { prefix: "{{ .PathPrefix }}" }
+                route:
+                  cluster: {{ .Name }}
+                  auto_host_rewrite: true
+{{- end }}
+          http_filters:
+          - name: envoy.router
+  clusters:
+{{- range .Upstreams }}
+  - name: {{ .Name }}
+    connect_timeout: 0.25s
+    type: LOGICAL_DNS
+    lb_policy: ROUND_ROBIN
+    dns_lookup_family: V4_ONLY
+{{- if .TLS }}
+    tls_context:
+      sni: {{ .Host }}
+{{- end }}
+    hosts: [{ socket_address: { address: {{ .Host }}, port_value: {{ .Port }}, ipv4_compat: true } }]
+{{- end }}
+`))
+
+var bootstrapV3Template = template.Must(template.New("bootstrap-v3").Parse(`
+admin:
+  access_log_path: /dev/null
+  address:
+    socket_address:
+      address: 0.0.0.0
+      port_value: {{ .AdminPort }}
+static_resources:
+  listeners:
+  - name: listener_0
+    address:
+      socket_address: { address: 0.0.0.0, port_value: {{ .ListenerPort }} }
+    filter_chains:
+    - filters:
+      - name: envoy.filters.network.http_connection_manager
+        typed_config:
+          "@type": type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager
+          codec_type: AUTO
+          stat_prefix: ingress_http
+          route_config:
+            name: local_route
+            virtual_hosts:
+            - name: upstreams
+              domains: ["*"]
+              routes:
+{{- range .Routes }}
+              - match: { prefix: "{{ .PathPrefix }}" }
+                route:
+                  cluster: {{ .Name }}
+                  auto_host_rewrite: true
+{{- end }}
+          http_filters:
+          - name: envoy.filters.http.router
+  clusters:
+{{- range .Upstreams }}
+  - name: {{ .Name }}
+    connect_timeout: 0.25s
+    type: LOGICAL_DNS
+    lb_policy: ROUND_ROBIN
+    dns_lookup_family: V4_ONLY
+{{- if .TLS }}
+    transport_socket:
+      name: envoy.transport_sockets.tls
+      typed_config:
+        "@type": type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.UpstreamTlsContext
+        sni: {{ .Host }}
+{{- end }}
+    load_assignment:
+      cluster_name: {{ .Name }}
+      endpoints:
+      - lb_endpoints:
+        - endpoint:
+            address:
+              socket_address: { address: {{ .Host }}, port_value: {{ .Port }}, ipv4_compat: true }
+{{- end }}
+`))
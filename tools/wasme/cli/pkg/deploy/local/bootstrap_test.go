@@ -0,0 +1,73 @@
+package local_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/local"
+)
+
+var _ = Describe("Bootstrap", func() {
+	It("parses upstreams", func() {
+		Expect(ParseUpstream("u", "localhost:8000")).To(Equal(Upstream{Name: "u", Host: "localhost", Port: 8000, PathPrefix: "/"}))
+		Expect(ParseUpstream("u", "/api=https://api.example.com:443")).To(Equal(Upstream{Name: "u", Host: "api.example.com", Port: 443, TLS: true, PathPrefix: "/api"}))
+		Expect(ParseUpstream("u", "/api=http://10.0.0.1:80")).To(Equal(Upstream{Name: "u", Host: "10.0.0.1", Port: 80, PathPrefix: "/api"}))
+
+		for _, invalid := range []string{"localhost", "localhost:0", "localhost:70000", ":80", "api=localhost:80", "/a b=localhost:80"} {
+			_, err := ParseUpstream("u", invalid)
+			Expect(err).To(HaveOccurred(), invalid)
+		}
+	})
+
+	It("rejects conflicting ports and routes", func() {
+		opts := DefaultBootstrapOptions()
+		opts.AdminPort = opts.ListenerPort
+		_, err := RenderBootstrap(opts)
+		Expect(err).To(MatchError("the listener and the admin API cannot both use port 8080"))
+
+		opts = DefaultBootstrapOptions()
+		opts.Upstreams = append(opts.Upstreams, Upstream{Name: "other", Host: "localhost", Port: 80, PathPrefix: "/"})
+		_, err = RenderBootstrap(opts)
+		Expect(err).To(MatchError("upstreams static-cluster and other are both routed the path prefix /"))
+	})
+
+	It("templates the ports and upstreams into the bootstrap", func() {
+		bootstrap, err := RenderBootstrap(BootstrapOptions{
+			ListenerPort: 9090,
+			AdminPort:    9901,
+			Upstreams: []Upstream{
+				{Name: "backend", Host: "localhost", Port: 8000, PathPrefix: "/"},
+				{Name: "api", Host: "api.example.com", Port: 443, TLS: true, PathPrefix: "/api"},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bootstrap).To(ContainSubstring("port_value: 9901\n"))
+		Expect(bootstrap).To(ContainSubstring("socket_address: { address: 0.0.0.0, port_value: 9090 }"))
+		// the longest prefix is routed first
+		Expect(bootstrap).To(ContainSubstring(`
+              - match: { prefix: "/api" }
+                route:
+                  cluster: api
+                  auto_host_rewrite: true
+              - match: { prefix: "/" }
+                route:
+                  cluster: backend
+                  auto_host_rewrite: true
+`))
+		Expect(bootstrap).To(ContainSubstring(`
+  - name: backend
+    connect_timeout: 0.25s
+    type: LOGICAL_DNS
+    lb_policy: ROUND_ROBIN
+    dns_lookup_family: V4_ONLY
+    hosts: [{ socket_address: { address: localhost, port_value: 8000, ipv4_compat: true } }]
+  - name: api
+    connect_timeout: 0.25s
+    type: LOGICAL_DNS
+    lb_policy: ROUND_ROBIN
+    dns_lookup_family: V4_ONLY
+    tls_context:
+      sni: api.example.com
+    hosts: [{ socket_address: { address: api.example.com, port_value: 443, ipv4_compat: true } }]
+`))
+	})
+})
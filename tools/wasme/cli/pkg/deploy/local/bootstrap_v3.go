@@ -0,0 +1,149 @@
+package local
+
+import (
+	"strconv"
+	"strings"
+
+	envoy_config_bootstrap_v3 "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v3"
+	envoy_config_listener_v3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	envoy_extensions_filters_network_hcm_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	"github.com/ghodss/yaml"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/pkg/errors"
+	corev3 "github.com/solo-io/gloo/projects/gloo/pkg/api/external/envoy/config/core/v3"
+	envoyfilter "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/filter"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	wasmeutil "github.com/solo-io/wasm/tools/wasme/pkg/util"
+
+	// registers the types of the typed configs of the default v3 bootstrap
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+)
+
+// IstioProxyImage is the image of the proxies of Istio, whose tags are the versions of Istio
+const IstioProxyImage = "docker.io/istio/proxyv2"
+
+const (
+	hcmV3TypeUrl = "type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager"
+
+	// the name of the router filter, and its deprecated name
+	routerFilterName           = "envoy.filters.http.router"
+	deprecatedRouterFilterName = "envoy.router"
+)
+
+// IstioUsesV3 returns true if the proxies of the Istio version run filters configured with the v3 API, and typed wasm filters
+func IstioUsesV3(istioVersion string) (bool, error) {
+	parts := strings.Split(strings.TrimPrefix(istioVersion, "v"), ".")
+	if len(parts) < 2 {
+		return false, errors.Errorf("invalid istio version %v, expected <major>.<minor>[.<patch>]", istioVersion)
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false, errors.Errorf("invalid istio version %v, expected <major>.<minor>[.<patch>]", istioVersion)
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false, errors.Errorf("invalid istio version %v, expected <major>.<minor>[.<patch>]", istioVersion)
+	}
+	return major > 1 || minor >= 7, nil
+}
+
+type v3Bootstrap struct {
+	bootstrap *envoy_config_bootstrap_v3.Bootstrap
+}
+
+func parseV3Bootstrap(b []byte) (*v3Bootstrap, error) {
+	b, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		return nil, err
+	}
+	var bootstrap envoy_config_bootstrap_v3.Bootstrap
+	if err := wasmeutil.UnmarshalBytes(b, &bootstrap); err != nil {
+		return nil, errors.Wrap(err, "parsing the v3 bootstrap config")
+	}
+	return &v3Bootstrap{bootstrap: &bootstrap}, nil
+}
+
+func (cfg *v3Bootstrap) ports() []uint32 {
+	var ports []uint32
+	for _, listener := range cfg.bootstrap.GetStaticResources().GetListeners() {
+		if port := listener.GetAddress().GetSocketAddress().GetPortValue(); port != 0 {
+			ports = append(ports, port)
+		}
+	}
+	if port := cfg.bootstrap.GetAdmin().GetAddress().GetSocketAddress().GetPortValue(); port != 0 {
+		ports = append(ports, port)
+	}
+	return ports
+}
+
+// adds the typed wasm filter created by the istio Provider for Istio 1.7+ before the router of each HTTP connection manager
+func (cfg *v3Bootstrap) addFilter(filter *v1.FilterSpec, code filterCode) error {
+	datasource := envoyfilter.MakeV3LocalDatasource(code.filename)
+	if code.inline != nil {
+		datasource = envoyfilter.MakeV3InlineDatasource(code.inline)
+	}
+	wasmFilter, err := makeV3WasmFilter(filter, datasource)
+	if err != nil {
+		return err
+	}
+
+	for _, listener := range cfg.bootstrap.GetStaticResources().GetListeners() {
+		for _, chain := range listener.GetFilterChains() {
+			for _, networkFilter := range chain.GetFilters() {
+				if networkFilter.GetTypedConfig().GetTypeUrl() != hcmV3TypeUrl {
+					continue
+				}
+				var hcm envoy_extensions_filters_network_hcm_v3.HttpConnectionManager
+				if err := ptypes.UnmarshalAny(networkFilter.GetTypedConfig(), &hcm); err != nil {
+					return err
+				}
+				if err := insertBeforeRouter(&hcm, wasmFilter); err != nil {
+					return errors.Wrapf(err, "listener %v", listener.GetName())
+				}
+				typedConfig, err := ptypes.MarshalAny(&hcm)
+				if err != nil {
+					return err
+				}
+				networkFilter.ConfigType = &envoy_config_listener_v3.Filter_TypedConfig{
+					TypedConfig: typedConfig,
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (cfg *v3Bootstrap) marshal() ([]byte, error) {
+	b, err := wasmeutil.MarshalBytes(cfg.bootstrap)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.JSONToYAML(b)
+}
+
+func makeV3WasmFilter(filter *v1.FilterSpec, datasource *corev3.AsyncDataSource) (*envoy_extensions_filters_network_hcm_v3.HttpFilter, error) {
+	// the typed filter is created with the v2 API types, which share the wire format of the v3 types
+	typedFilter, err := envoyfilter.MakeTypedIstioWasmFilter(filter, datasource)
+	if err != nil {
+		return nil, err
+	}
+	return &envoy_extensions_filters_network_hcm_v3.HttpFilter{
+		Name: typedFilter.GetName(),
+		ConfigType: &envoy_extensions_filters_network_hcm_v3.HttpFilter_TypedConfig{
+			TypedConfig: typedFilter.GetTypedConfig(),
+		},
+	}, nil
+}
+
+func insertBeforeRouter(hcm *envoy_extensions_filters_network_hcm_v3.HttpConnectionManager, wasmFilter *envoy_extensions_filters_network_hcm_v3.HttpFilter) error {
+	for i, httpFilter := range hcm.GetHttpFilters() {
+		if httpFilter.GetName() == wasmFilter.GetName() {
+			return errors.Errorf("filter %v already present", wasmFilter.GetName())
+		}
+		if httpFilter.GetName() == routerFilterName || httpFilter.GetName() == deprecatedRouterFilterName {
+			hcm.HttpFilters = append(hcm.HttpFilters[:i], append([]*envoy_extensions_filters_network_hcm_v3.HttpFilter{wasmFilter}, hcm.HttpFilters[i:]...)...)
+			return nil
+		}
+	}
+	return errors.Errorf("found no router in the http filters")
+}
@@ -0,0 +1,59 @@
+package local
+
+import (
+	envoy_extensions_filters_network_hcm_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	"github.com/golang/protobuf/ptypes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+)
+
+var _ = Describe("Bootstrap v3", func() {
+	It("uses the v3 API for Istio 1.7+", func() {
+		for version, v3 := range map[string]bool{"1.5.1": false, "1.6": false, "1.7.0": true, "v1.8.2": true, "2.0": true} {
+			usesV3, err := IstioUsesV3(version)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(usesV3).To(Equal(v3), version)
+		}
+		_, err := IstioUsesV3("latest")
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("adding the filter", func() {
+		var cfg *v3Bootstrap
+
+		httpFilterNames := func() []string {
+			typedConfig := cfg.bootstrap.GetStaticResources().GetListeners()[0].GetFilterChains()[0].GetFilters()[0].GetTypedConfig()
+			var hcm envoy_extensions_filters_network_hcm_v3.HttpConnectionManager
+			Expect(ptypes.UnmarshalAny(typedConfig, &hcm)).NotTo(HaveOccurred())
+			var names []string
+			for _, httpFilter := range hcm.GetHttpFilters() {
+				names = append(names, httpFilter.GetName())
+			}
+			return names
+		}
+
+		BeforeEach(func() {
+			opts := DefaultBootstrapOptions()
+			opts.V3 = true
+			bootstrap, err := RenderBootstrap(opts)
+			Expect(err).NotTo(HaveOccurred())
+			cfg, err = parseV3Bootstrap([]byte(bootstrap))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.ports()).To(Equal([]uint32{DefaultListenerPort, DefaultAdminPort}))
+		})
+
+		It("inserts the typed wasm filter before the router", func() {
+			filter := &v1.FilterSpec{Id: "my_filter", RootID: "root"}
+			Expect(cfg.addFilter(filter, filterCode{filename: "/etc/envoy/filter.wasm"})).NotTo(HaveOccurred())
+			Expect(httpFilterNames()).To(Equal([]string{"wasme.my_filter", routerFilterName}))
+
+			b, err := cfg.marshal()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(ContainSubstring("type.googleapis.com/udpa.type.v1.TypedStruct"))
+			Expect(string(b)).To(ContainSubstring("filename: /etc/envoy/filter.wasm"))
+
+			Expect(cfg.addFilter(filter, filterCode{filename: "/etc/envoy/filter.wasm"})).To(MatchError("listener listener_0: filter wasme.my_filter already present"))
+		})
+	})
+})
@@ -9,7 +9,10 @@ import (
 	"path/filepath"
 
 	"github.com/sirupsen/logrus"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/abi"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy"
 	"github.com/solo-io/wasm/tools/wasme/pkg/model"
+	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
 	"github.com/solo-io/wasm/tools/wasme/pkg/store"
 
 	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
@@ -21,6 +24,7 @@ import (
 	"github.com/ghodss/yaml"
 	"github.com/pkg/errors"
 	"github.com/solo-io/gloo/projects/gloo/pkg/api/external/envoy/api/v2/config"
+	"github.com/solo-io/solo-kit/pkg/api/external/envoy/api/v2/core"
 	"github.com/solo-io/solo-kit/pkg/api/v1/control-plane/util"
 	envoyfilter "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/filter"
 	wasmeutil "github.com/solo-io/wasm/tools/wasme/pkg/util"
@@ -47,31 +51,104 @@ type Runner struct {
 
 	// the image ref for Envoy to run with docker. Ignored if using DryRyn
 	EnvoyDockerImage string
+
+	// if set, write the bootstrap config, the filter module and a docker-compose.yaml running Envoy
+	// to this directory, rather than invoking docker run. Ignored if using DryRun
+	ComposeDir string
+
+	// inline the filter module into the bootstrap config, rather than mounting it.
+	// Ignored unless using DryRun or ComposeDir
+	InlineFilter bool
+
+	// if set, the image is pulled to the Store if it is not stored yet
+	Puller pull.ImagePuller
+
+	// if set, the generated bootstrap config is also written to PrintConfig before Envoy is run. Ignored if using DryRun
+	PrintConfig io.Writer
+
+	// if set, Envoy is run with the filter reloaded whenever its module or config changes.
+	// Ignored if using DryRun or ComposeDir
+	Watch *Watch
+
+	// if set, the filter is added to the bootstrap config like the istio Provider adds it to the proxies of this Istio version:
+	// for Istio 1.7+, the bootstrap config must be in the v3 API, and the filter is added as a typed wasm filter.
+	// the abi versions of the image must be supported by the Istio version
+	IstioVersion string
+}
+
+// ApplyFilter runs the filter, implementing the deploy.Provider of wasme deploy envoy
+func (p *Runner) ApplyFilter(filter *v1.FilterSpec) error {
+	return p.RunFilter(filter)
+}
+
+// RemoveFilter is not supported: the filters run until Envoy is stopped
+func (p *Runner) RemoveFilter(filter *v1.FilterSpec) error {
+	return p.unsupported("removing filters")
+}
+
+// ListFilters is not supported: the filters are not recorded once Envoy is run
+func (p *Runner) ListFilters(idPrefix string) ([]deploy.DeployedFilter, error) {
+	return nil, p.unsupported("listing the deployed filters")
+}
+
+// Verify is not supported, as the filters are not listed
+func (p *Runner) Verify(idPrefix string) ([]deploy.DeployedFilter, error) {
+	return nil, p.unsupported("verifying the deployed filters")
+}
+
+// Capabilities returns the features of the runner. the filter is added to the bootstrap config without a patch context,
+// and the bootstrap config is only printed when run with Output (dry-run)
+func (p *Runner) Capabilities() deploy.Capabilities {
+	return deploy.Capabilities{
+		Provider: "envoy",
+		DryRun:   true,
+	}
+}
+
+func (p *Runner) unsupported(feature string) error {
+	return &deploy.UnsupportedError{Provider: p.Capabilities().Provider, Feature: feature}
 }
 
 // applies the filter to all static listeners in the bootstrap config
 func (p *Runner) RunFilter(filter *v1.FilterSpec) error {
-	cfg, err := p.getConfig()
+	cfg, err := p.getBootstrap()
 	if err != nil {
 		return err
 	}
+	ports := cfg.ports()
+
+	bundle := p.Output == nil && p.ComposeDir != ""
+	if p.Output == nil && !bundle {
+		// check the ports before the image is pulled, rather than failing to start envoy
+		if err := checkPortsAvailable(ports); err != nil {
+			return err
+		}
+	}
 
-	image, err := p.Store.Get(filter.Image)
+	image, err := p.getImage(filter.Image)
 	if err != nil {
-		return errors.Wrapf(err, "failed to retrieve image. make sure to run `wasme pull %v` to pull the image to your local storage.", filter.Image)
+		return err
 	}
-	if filter.RootID == "" {
-		imageCfg, err := image.FetchConfig(p.Ctx)
-		if err != nil {
+	imageCfg, err := image.FetchConfig(p.Ctx)
+	if err != nil {
+		return err
+	}
+	if p.IstioVersion != "" {
+		if err := validateAbiVersions(image.Ref(), imageCfg.GetAbiVersions(), p.IstioVersion); err != nil {
 			return err
 		}
+	}
+	if filter.RootID == "" {
 		roots := imageCfg.GetConfig().GetRootIds()
-		if len(roots) == 0 {
+		switch {
+		case len(roots) > 0:
+			// default to first root
+			filter.RootID = roots[0]
+		case filter.Id != "":
+			filter.RootID = filter.Id
+		default:
 			return errors.Errorf("found no root_id on image or in params")
 		}
-
-		// default to first root
-		filter.RootID = roots[0]
 	}
 
 	// allow filter ID to be empty, as we don't care in local envoy
@@ -89,11 +166,40 @@ func (p *Runner) RunFilter(filter *v1.FilterSpec) error {
 	}
 	filterFile := filepath.Join(filterDir, model.CodeFilename)
 
-	if err := addFilterToListeners(filter, cfg.GetStaticResources().GetListeners(), filterFile); err != nil {
+	if p.Watch != nil && p.Output == nil && !bundle {
+		v2Cfg, ok := cfg.(*v2Bootstrap)
+		if !ok {
+			return errors.Errorf("watching the filter is not supported with v3 bootstrap configs")
+		}
+		// the checksum is injected into the config on each reload, as the config may be read from a watched file
+		return p.watchFilter(filter, v2Cfg.bootstrap, filterFile)
+	}
+
+	if filter.ConfigChecksum {
+		checksum, err := envoyfilter.InjectConfigChecksum(filter)
+		if err != nil {
+			return err
+		}
+		logrus.Infof("injected config checksum %v into filter config", checksum)
+	}
+
+	code := filterCode{filename: filterFile}
+	switch {
+	case p.InlineFilter && (p.Output != nil || bundle):
+		code.inline, err = ioutil.ReadFile(filterFile)
+		if err != nil {
+			return err
+		}
+	case bundle:
+		// the module is copied into the bundle and mounted into the container, so the bundle does not depend on the store
+		code.filename = composeFilterFile
+	}
+
+	if err := cfg.addFilter(filter, code); err != nil {
 		return err
 	}
 
-	configYaml, err := marshalConfig(cfg)
+	configYaml, err := cfg.marshal()
 	if err != nil {
 		return err
 	}
@@ -103,15 +209,20 @@ func (p *Runner) RunFilter(filter *v1.FilterSpec) error {
 		return err
 	}
 
+	if p.PrintConfig != nil {
+		if _, err := p.PrintConfig.Write(configYaml); err != nil {
+			return err
+		}
+	}
+
+	if bundle {
+		return p.writeComposeBundle(filter, ports, configYaml, filterFile)
+	}
+
 	logrus.Infof("mounting filter file at %v", filterFile)
 
 	logrus.Debugf("using bootstrap config: \n%s", string(configYaml))
 
-	ports, err := getListenerPorts(cfg)
-	if err != nil {
-		return err
-	}
-
 	dockerArgs := append([]string{
 		"--rm",
 		"--name", filter.Id,
@@ -141,6 +252,186 @@ func (p *Runner) RunFilter(filter *v1.FilterSpec) error {
 	return nil
 }
 
+// validates the abi versions of the image are supported by the Istio version, as the istio Provider does
+func validateAbiVersions(ref string, abiVersions []string, istioVersion string) error {
+	if len(abiVersions) == 0 {
+		logrus.WithFields(logrus.Fields{
+			"image": ref,
+		}).Warnf("no ABI Version found for image, skipping ABI version check")
+		return nil
+	}
+	if err := abi.DefaultRegistry.ValidateIstioVersion(abiVersions, istioVersion); err != nil {
+		return errors.Wrapf(err, "image %v is not compatible with istio %v", ref, istioVersion)
+	}
+	return nil
+}
+
+// the bootstrap config the filter is added to, in the v2 API or the v3 API of Istio 1.7+ proxies
+type bootstrapConfig interface {
+	// the ports of the listeners and the admin API
+	ports() []uint32
+	// adds the filter to the HTTP connection managers of the static listeners, with the module loaded from the code
+	addFilter(filter *v1.FilterSpec, code filterCode) error
+	marshal() ([]byte, error)
+}
+
+// the module of the filter, loaded from the filename, or inlined into the config if inline is set
+type filterCode struct {
+	filename string
+	inline   []byte
+}
+
+type v2Bootstrap struct {
+	bootstrap *envoy_config_bootstrap_v2.Bootstrap
+}
+
+func (cfg *v2Bootstrap) ports() []uint32 {
+	return getListenerPorts(cfg.bootstrap)
+}
+
+func (cfg *v2Bootstrap) addFilter(filter *v1.FilterSpec, code filterCode) error {
+	datasource := envoyfilter.MakeLocalDatasource(code.filename)
+	if code.inline != nil {
+		datasource = envoyfilter.MakeInlineDatasource(code.inline)
+	}
+	return addFilterToListeners(filter, cfg.bootstrap.GetStaticResources().GetListeners(), datasource)
+}
+
+func (cfg *v2Bootstrap) marshal() ([]byte, error) {
+	return marshalConfig(cfg.bootstrap)
+}
+
+// returns the image from the Store, pulling it first if it is not stored and the Puller is set
+func (p *Runner) getImage(ref string) (store.Image, error) {
+	image, err := p.Store.Get(ref)
+	if err == nil {
+		return image, nil
+	}
+	if p.Puller == nil {
+		return nil, errors.Wrapf(err, "failed to retrieve image. make sure to run `wasme pull %v` to pull the image to your local storage.", ref)
+	}
+
+	logrus.Infof("image %v is not stored, pulling it to the local storage", ref)
+	pulled, err := p.Puller.Pull(p.Ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Store.Add(p.Ctx, pulled); err != nil {
+		return nil, err
+	}
+	image, err = p.Store.Get(ref)
+	if err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+// the paths of the files of the bundle written to the ComposeDir
+const (
+	ComposeFilename   = "docker-compose.yaml"
+	BootstrapFilename = "envoy.yaml"
+
+	// the paths the bootstrap and the module are mounted at in the Envoy container
+	composeBootstrapFile = "/etc/envoy/" + BootstrapFilename
+	composeFilterFile    = "/etc/envoy/" + model.CodeFilename
+)
+
+// the subset of the docker-compose file format written to the ComposeDir
+type composeFile struct {
+	Version  string                    `json:"version"`
+	Services map[string]composeService `json:"services"`
+}
+
+type composeService struct {
+	Image      string   `json:"image"`
+	Entrypoint []string `json:"entrypoint"`
+	Command    []string `json:"command"`
+	Ports      []string `json:"ports,omitempty"`
+	Volumes    []string `json:"volumes"`
+}
+
+// writes the bootstrap config, the filter module unless it is inlined, and a docker-compose.yaml running Envoy to the ComposeDir.
+// the compose file mounts the bootstrap and the module by paths relative to the ComposeDir, so the bundle can be moved or checked in
+func (p *Runner) writeComposeBundle(filter *v1.FilterSpec, ports []uint32, configYaml []byte, filterFile string) error {
+	if err := os.MkdirAll(p.ComposeDir, 0755); err != nil {
+		return err
+	}
+
+	service := composeService{
+		Image:      p.EnvoyDockerImage,
+		Entrypoint: []string{"envoy"},
+		Command: append([]string{
+			"--disable-hot-restart",
+			"-c", composeBootstrapFile,
+		}, p.EnvoyArgs...),
+		Volumes: []string{"./" + BootstrapFilename + ":" + composeBootstrapFile + ":ro"},
+	}
+	for _, port := range ports {
+		service.Ports = append(service.Ports, fmt.Sprintf("%v:%v", port, port))
+	}
+
+	if !p.InlineFilter {
+		code, err := ioutil.ReadFile(filterFile)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(p.ComposeDir, model.CodeFilename), code, 0644); err != nil {
+			return err
+		}
+		service.Volumes = append(service.Volumes, "./"+model.CodeFilename+":"+composeFilterFile+":ro")
+	}
+
+	composeYaml, err := yaml.Marshal(composeFile{
+		Version:  "3",
+		Services: map[string]composeService{filter.Id: service},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(p.ComposeDir, BootstrapFilename), configYaml, 0644); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(p.ComposeDir, ComposeFilename), composeYaml, 0644); err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"dir":          p.ComposeDir,
+		"envoy_image":  p.EnvoyDockerImage,
+		"filter_image": filter.Image,
+	}).Infof("wrote docker-compose bundle, run `docker-compose up` in the directory to start envoy")
+	return nil
+}
+
+// returns the bootstrap config of the Input, in the v3 API if the IstioVersion is 1.7+
+func (p *Runner) getBootstrap() (bootstrapConfig, error) {
+	v3 := false
+	if p.IstioVersion != "" {
+		var err error
+		v3, err = IstioUsesV3(p.IstioVersion)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !v3 {
+		cfg, err := p.getConfig()
+		if err != nil {
+			return nil, err
+		}
+		return &v2Bootstrap{bootstrap: cfg}, nil
+	}
+
+	b, err := ioutil.ReadAll(p.Input)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Input.Close(); err != nil {
+		return nil, err
+	}
+	return parseV3Bootstrap(b)
+}
+
 func (p *Runner) getConfig() (*envoy_config_bootstrap_v2.Bootstrap, error) {
 	b, err := ioutil.ReadAll(p.Input)
 	if err != nil {
@@ -174,7 +465,7 @@ func marshalConfig(bootstrap *envoy_config_bootstrap_v2.Bootstrap) ([]byte, erro
 	return b, nil
 }
 
-func getListenerPorts(bootstrap *envoy_config_bootstrap_v2.Bootstrap) ([]uint32, error) {
+func getListenerPorts(bootstrap *envoy_config_bootstrap_v2.Bootstrap) []uint32 {
 	var ports []uint32
 	for _, listener := range bootstrap.GetStaticResources().GetListeners() {
 		port := listener.GetAddress().GetSocketAddress().GetPortValue()
@@ -185,7 +476,7 @@ func getListenerPorts(bootstrap *envoy_config_bootstrap_v2.Bootstrap) ([]uint32,
 	if port := bootstrap.GetAdmin().GetAddress().GetSocketAddress().GetPortValue(); port != 0 {
 		ports = append(ports, port)
 	}
-	return ports, nil
+	return ports
 }
 
 // for each hcm in each filter (where it exists)
@@ -210,9 +501,9 @@ func forEachHcm(listeners []*envoy_api_v2.Listener, fn func(networkFilter *envoy
 	return nil
 }
 
-func addFilterToListeners(filter *v1.FilterSpec, listeners []*envoy_api_v2.Listener, filterPath string) error {
+func addFilterToListeners(filter *v1.FilterSpec, listeners []*envoy_api_v2.Listener, datasource *core.AsyncDataSource) error {
 
-	wasmFilter, err := envoyfilter.MakeIstioWasmFilter(filter, envoyfilter.MakeLocalDatasource(filterPath))
+	wasmFilter, err := envoyfilter.MakeIstioWasmFilter(filter, datasource)
 	if err != nil {
 		return err
 	}
@@ -252,44 +543,3 @@ func addFilterToListeners(filter *v1.FilterSpec, listeners []*envoy_api_v2.Liste
 }
 
 const DefaultEnvoyImage = "docker.io/istio/proxyv2:1.5.1"
-
-const BasicEnvoyConfig = `
-admin:
-  access_log_path: /dev/null
-  address:
-    socket_address:
-      address: 0.0.0.0
-      port_value: 19000
-static_resources:
-  listeners:
-  - name: listener_0
-    address:
-      socket_address: { address: 0.0.0.0, port_value: 8080 }
-    filter_chains:
-    - filters:
-      - name: envoy.http_connection_manager
-        config:
-          codec_type: AUTO
-          stat_prefix: ingress_http
-          route_config:
-            name: test
-            virtual_hosts:
-            - name: jsonplaceholder
-              domains: ["*"]
-              routes:
-              - match: { prefix: "/" }
-                route:
-                  cluster: static-cluster
-                  auto_host_rewrite: true
-          http_filters:
-          - name: envoy.router
-  clusters:
-  - name: static-cluster
-    connect_timeout: 0.25s
-    type: LOGICAL_DNS
-    lb_policy: ROUND_ROBIN
-    dns_lookup_family: V4_ONLY
-    tls_context:
-      sni: jsonplaceholder.typicode.com
-    hosts: [{ socket_address: { address: jsonplaceholder.typicode.com, port_value: 443, ipv4_compat: true } }]
-`
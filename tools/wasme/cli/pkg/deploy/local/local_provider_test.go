@@ -7,11 +7,13 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
 	"github.com/solo-io/wasm/tools/wasme/cli/test"
 	"github.com/solo-io/wasm/tools/wasme/pkg/consts"
+	"github.com/solo-io/wasm/tools/wasme/pkg/model"
 	"github.com/solo-io/wasm/tools/wasme/pkg/store"
 	"github.com/solo-io/wasm/tools/wasme/pkg/util"
 
@@ -77,6 +79,75 @@ var _ = Describe("LocalProvider", func() {
 
 		Expect(buf.String()).To(Equal(expectedConfig(filterDir)))
 	})
+	Context("writing a docker-compose bundle", func() {
+		var composeDir string
+		BeforeEach(func() {
+			dir, err := ioutil.TempDir("", "local-wasme-compose")
+			Expect(err).NotTo(HaveOccurred())
+			composeDir = dir
+		})
+		AfterEach(func() {
+			os.RemoveAll(composeDir)
+		})
+		runBundle := func(inline bool) {
+			p := &Runner{
+				Ctx:              context.TODO(),
+				Input:            ioutil.NopCloser(bytes.NewBuffer([]byte(BasicEnvoyConfig))),
+				Store:            imageStore,
+				EnvoyArgs:        []string{"-l", "debug"},
+				EnvoyDockerImage: DefaultEnvoyImage,
+				ComposeDir:       composeDir,
+				InlineFilter:     inline,
+			}
+			err := p.RunFilter(filter)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		readFile := func(name string) string {
+			b, err := ioutil.ReadFile(filepath.Join(composeDir, name))
+			Expect(err).NotTo(HaveOccurred())
+			return string(b)
+		}
+
+		It("mounts the module copied into the bundle", func() {
+			runBundle(false)
+
+			Expect(readFile(BootstrapFilename)).To(Equal(expectedConfig("/etc/envoy")))
+
+			filterDir, err := imageStore.Dir(filter.Image)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(readFile(model.CodeFilename)).To(Equal(readStoredFile(filepath.Join(filterDir, model.CodeFilename))))
+
+			Expect(readFile(ComposeFilename)).To(Equal(`services:
+  my_filter:
+    command:
+    - --disable-hot-restart
+    - -c
+    - /etc/envoy/envoy.yaml
+    - -l
+    - debug
+    entrypoint:
+    - envoy
+    image: ` + DefaultEnvoyImage + `
+    ports:
+    - 8080:8080
+    - 19000:19000
+    volumes:
+    - ./envoy.yaml:/etc/envoy/envoy.yaml:ro
+    - ./filter.wasm:/etc/envoy/filter.wasm:ro
+version: "3"
+`))
+		})
+
+		It("inlines the module into the bootstrap", func() {
+			runBundle(true)
+
+			Expect(readFile(BootstrapFilename)).To(ContainSubstring("inlineBytes: "))
+			Expect(readFile(BootstrapFilename)).NotTo(ContainSubstring("filename: "))
+			Expect(readFile(ComposeFilename)).NotTo(ContainSubstring(model.CodeFilename))
+			_, err := os.Stat(filepath.Join(composeDir, model.CodeFilename))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+	})
 	AfterEach(func() {
 		util.Docker(nil, nil, nil, "kill", filter.Id)
 	})
@@ -133,6 +204,12 @@ var _ = Describe("LocalProvider", func() {
 	})
 })
 
+func readStoredFile(path string) string {
+	b, err := ioutil.ReadFile(path)
+	Expect(err).NotTo(HaveOccurred())
+	return string(b)
+}
+
 func expectedConfig(dir string) string {
 	return fmt.Sprintf(`admin:
   accessLogPath: /dev/null
@@ -176,11 +253,11 @@ staticResources:
             name: envoy.filters.http.wasm
           - name: envoy.router
           routeConfig:
-            name: test
+            name: local_route
             virtualHosts:
             - domains:
               - '*'
-              name: jsonplaceholder
+              name: upstreams
               routes:
               - match:
                   prefix: /
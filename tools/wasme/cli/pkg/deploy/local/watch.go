@@ -0,0 +1,332 @@
+package local
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	envoy_api_v2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	envoy_api_v2_core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	envoy_config_bootstrap_v2 "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v2"
+	"github.com/gogo/protobuf/types"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	envoyfilter "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/filter"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	wasmeutil "github.com/solo-io/wasm/tools/wasme/pkg/util"
+)
+
+const (
+	// the file the listeners are served to Envoy from, with the filter of the last reload
+	listenersFilename = "listeners.json"
+
+	DefaultWatchInterval = time.Second
+	DefaultDrainTime     = 5 * time.Second
+)
+
+// Watch configures the Runner to reload the filter whenever its module or config changes, without restarting Envoy.
+// the listeners of the bootstrap are served to Envoy from a file, which Envoy watches:
+// on each change the listeners are rewritten with the new filter, so Envoy drains the connections
+// of the old listeners while the new listeners accept the new connections
+type Watch struct {
+	// path to the .wasm module to run instead of the module of the image, e.g. the output of the build of the filter.
+	// if empty, the module of the image in the Store is watched, e.g. to reload the filter when `wasme build` replaces the image
+	ModuleFile string
+
+	// optional path to a file containing the config of the filter, passed to the filter as a string
+	ConfigFile string
+
+	// how often the files are checked for changes. defaults to DefaultWatchInterval
+	Interval time.Duration
+
+	// how long Envoy drains the connections of the listeners replaced by a reload. defaults to DefaultDrainTime
+	DrainTime time.Duration
+
+	// the reload log is written to Log. defaults to os.Stdout
+	Log io.Writer
+}
+
+// runs Envoy with the listeners of the bootstrap served from a file, and rewrites the file when the watched files change
+func (p *Runner) watchFilter(filter *v1.FilterSpec, cfg *envoy_config_bootstrap_v2.Bootstrap, imageFilterFile string) error {
+	ports := getListenerPorts(cfg)
+
+	// the directory is mounted into the container, so it must be readable by the user of envoy
+	dir, err := ioutil.TempDir("", "wasme-watch-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chmod(dir, 0755); err != nil {
+		return err
+	}
+
+	w := newWatcher(filter, *p.Watch, cfg.GetStaticResources().GetListeners(), imageFilterFile, dir)
+	if _, err := w.reload(); err != nil {
+		return err
+	}
+
+	cfg.StaticResources.Listeners = nil
+	cfg.DynamicResources = &envoy_config_bootstrap_v2.Bootstrap_DynamicResources{
+		LdsConfig: &envoy_api_v2_core.ConfigSource{
+			ConfigSourceSpecifier: &envoy_api_v2_core.ConfigSource_Path{
+				Path: w.listenersFile(),
+			},
+		},
+	}
+	// envoy requires the node to be identified to subscribe to a file
+	if cfg.GetNode().GetId() == "" || cfg.GetNode().GetCluster() == "" {
+		cfg.Node = &envoy_api_v2_core.Node{Id: filter.Id, Cluster: "wasme"}
+	}
+
+	configYaml, err := marshalConfig(cfg)
+	if err != nil {
+		return err
+	}
+	logrus.Debugf("using bootstrap config: \n%s", string(configYaml))
+	if p.PrintConfig != nil {
+		// the listeners with the filter are served from the listeners file
+		if _, err := p.PrintConfig.Write(configYaml); err != nil {
+			return err
+		}
+	}
+
+	dockerArgs := append([]string{
+		"--rm",
+		"--name", filter.Id,
+		"--entrypoint", "envoy",
+		"-v", dir + ":" + dir + ":ro",
+	}, p.DockerRunArgs...)
+	for _, port := range ports {
+		dockerArgs = append(dockerArgs, "-p", fmt.Sprintf("%v:%v", port, port))
+	}
+
+	envoyArgs := append([]string{
+		"--disable-hot-restart",
+		"--drain-time-s", strconv.Itoa(int(w.drainTime.Seconds())),
+		"--config-yaml", string(configYaml),
+	}, p.EnvoyArgs...)
+
+	logrus.WithFields(logrus.Fields{
+		"container_name": filter.Id,
+		"envoy_image":    p.EnvoyDockerImage,
+		"filter_image":   filter.Image,
+		"module":         w.moduleFile,
+		"config":         w.configFile,
+	}).Infof("running envoy-in-docker, watching the filter for changes")
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- wasmeutil.DockerRun(os.Stdout, os.Stderr, nil, p.EnvoyDockerImage, dockerArgs, envoyArgs)
+	}()
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-exited:
+			return err
+		case <-p.Ctx.Done():
+			return p.Ctx.Err()
+		case <-ticker.C:
+			// the filter keeps running with its last config if the changed files are invalid, e.g. while they are written
+			if _, err := w.reloadIfChanged(); err != nil {
+				logrus.WithError(err).Warnf("failed to reload filter %v", filter.Id)
+			}
+		}
+	}
+}
+
+// the modification of a watched file when it was last read
+type fileStamp struct {
+	modTime int64
+	size    int64
+}
+
+type watcher struct {
+	filter *v1.FilterSpec
+	// the listeners of the bootstrap, before the filter is added
+	listeners []*envoy_api_v2.Listener
+
+	moduleFile string
+	configFile string
+	interval   time.Duration
+	drainTime  time.Duration
+	log        io.Writer
+
+	// the directory the listeners and the copies of the module are written to
+	dir string
+
+	stamps map[string]fileStamp
+	// the content last published, to skip the changes which do not change the filter, e.g. touching the module
+	lastModuleSum, lastConfig string
+	// the copy of the module referenced by the published listeners
+	publishedModule string
+	version         int
+}
+
+func newWatcher(filter *v1.FilterSpec, watch Watch, listeners []*envoy_api_v2.Listener, imageFilterFile, dir string) *watcher {
+	moduleFile := watch.ModuleFile
+	if moduleFile == "" {
+		moduleFile = imageFilterFile
+	}
+	w := &watcher{
+		filter:     filter,
+		moduleFile: moduleFile,
+		configFile: watch.ConfigFile,
+		interval:   watch.Interval,
+		drainTime:  watch.DrainTime,
+		log:        watch.Log,
+		dir:        dir,
+		stamps:     map[string]fileStamp{},
+	}
+	if w.interval <= 0 {
+		w.interval = DefaultWatchInterval
+	}
+	if w.drainTime <= 0 {
+		w.drainTime = DefaultDrainTime
+	}
+	if w.log == nil {
+		w.log = os.Stdout
+	}
+	for _, listener := range listeners {
+		w.listeners = append(w.listeners, proto.Clone(listener).(*envoy_api_v2.Listener))
+	}
+	return w
+}
+
+func (w *watcher) listenersFile() string {
+	return filepath.Join(w.dir, listenersFilename)
+}
+
+// returns the watched files whose modification changed since they were last read
+func (w *watcher) changedFiles() ([]string, error) {
+	var changed []string
+	for _, file := range []string{w.moduleFile, w.configFile} {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		stamp := fileStamp{modTime: info.ModTime().UnixNano(), size: info.Size()}
+		if w.stamps[file] != stamp {
+			changed = append(changed, file)
+		}
+	}
+	return changed, nil
+}
+
+// reloads the filter if the watched files changed. returns true if the filter was reloaded
+func (w *watcher) reloadIfChanged() (bool, error) {
+	changed, err := w.changedFiles()
+	if err != nil || len(changed) == 0 {
+		return false, err
+	}
+	reloaded, err := w.reload()
+	if err != nil || !reloaded {
+		return false, err
+	}
+	fmt.Fprintf(w.log, "%v reloaded filter %v (version %v): %v changed\n", time.Now().Format(time.RFC3339), w.filter.Id, w.version, changed)
+	return true, nil
+}
+
+// publishes the listeners with the filter read from the watched files, unless the filter did not change.
+// returns true if the listeners were published
+func (w *watcher) reload() (bool, error) {
+	// the stamps are read before the content, so writes made while the files are read are reloaded on the next check
+	for _, file := range []string{w.moduleFile, w.configFile} {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return false, err
+		}
+		w.stamps[file] = fileStamp{modTime: info.ModTime().UnixNano(), size: info.Size()}
+	}
+
+	code, err := ioutil.ReadFile(w.moduleFile)
+	if err != nil {
+		return false, err
+	}
+	filter := *w.filter
+	var rawConfig string
+	if w.configFile != "" {
+		b, err := ioutil.ReadFile(w.configFile)
+		if err != nil {
+			return false, err
+		}
+		rawConfig = string(b)
+		config, err := types.MarshalAny(&types.StringValue{Value: rawConfig})
+		if err != nil {
+			return false, err
+		}
+		filter.Config = config
+	}
+	moduleSum := fmt.Sprintf("%x", sha256.Sum256(code))
+	if w.version > 0 && moduleSum == w.lastModuleSum && rawConfig == w.lastConfig {
+		return false, nil
+	}
+	if filter.ConfigChecksum {
+		if _, err := envoyfilter.InjectConfigChecksum(&filter); err != nil {
+			return false, err
+		}
+	}
+
+	// each module is copied to a new file, so the listeners referencing it change and Envoy loads the new module
+	moduleCopy := filepath.Join(w.dir, "filter-"+moduleSum[:12]+".wasm")
+	if err := ioutil.WriteFile(moduleCopy, code, 0644); err != nil {
+		return false, err
+	}
+
+	var listeners []*envoy_api_v2.Listener
+	for _, listener := range w.listeners {
+		listeners = append(listeners, proto.Clone(listener).(*envoy_api_v2.Listener))
+	}
+	if err := addFilterToListeners(&filter, listeners, envoyfilter.MakeLocalDatasource(moduleCopy)); err != nil {
+		return false, err
+	}
+
+	response := &envoy_api_v2.DiscoveryResponse{
+		VersionInfo: strconv.Itoa(w.version + 1),
+	}
+	for _, listener := range listeners {
+		resource, err := ptypes.MarshalAny(listener)
+		if err != nil {
+			return false, err
+		}
+		response.Resources = append(response.Resources, resource)
+	}
+	b, err := wasmeutil.MarshalBytes(response)
+	if err != nil {
+		return false, err
+	}
+
+	// envoy reloads the file when it is moved into place, so it never reads a partially written file
+	tmpFile := w.listenersFile() + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, b, 0644); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmpFile, w.listenersFile()); err != nil {
+		return false, errors.Wrap(err, "publishing the listeners")
+	}
+
+	// the previous module is loaded by envoy, and no longer referenced by the listeners
+	if w.publishedModule != "" && w.publishedModule != moduleCopy {
+		if err := os.Remove(w.publishedModule); err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+	w.publishedModule = moduleCopy
+	w.lastModuleSum, w.lastConfig = moduleSum, rawConfig
+	w.version++
+	return true, nil
+}
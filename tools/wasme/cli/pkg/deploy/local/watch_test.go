@@ -0,0 +1,128 @@
+package local
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	envoy_api_v2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/golang/protobuf/ptypes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	wasmeutil "github.com/solo-io/wasm/tools/wasme/pkg/util"
+)
+
+var _ = Describe("watcher", func() {
+	var (
+		dir, moduleFile, configFile string
+		log                         *bytes.Buffer
+		w                           *watcher
+	)
+
+	writeFile := func(path, content string, modTime time.Time) {
+		Expect(ioutil.WriteFile(path, []byte(content), 0644)).NotTo(HaveOccurred())
+		// the files are only checked for changes by their modification
+		Expect(os.Chtimes(path, modTime, modTime)).NotTo(HaveOccurred())
+	}
+
+	// returns the listeners published to envoy
+	readListeners := func() []*envoy_api_v2.Listener {
+		b, err := ioutil.ReadFile(w.listenersFile())
+		Expect(err).NotTo(HaveOccurred())
+		var response envoy_api_v2.DiscoveryResponse
+		Expect(wasmeutil.UnmarshalBytes(b, &response)).NotTo(HaveOccurred())
+		var listeners []*envoy_api_v2.Listener
+		for _, resource := range response.GetResources() {
+			var listener envoy_api_v2.Listener
+			Expect(ptypes.UnmarshalAny(resource, &listener)).NotTo(HaveOccurred())
+			listeners = append(listeners, &listener)
+		}
+		return listeners
+	}
+
+	// returns the module files in the watch directory
+	moduleCopies := func() []string {
+		copies, err := filepath.Glob(filepath.Join(dir, "filter-*.wasm"))
+		Expect(err).NotTo(HaveOccurred())
+		return copies
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "wasme-watch-test")
+		Expect(err).NotTo(HaveOccurred())
+		moduleFile, configFile = filepath.Join(dir, "module.wasm"), filepath.Join(dir, "config.json")
+		writeFile(moduleFile, "module-1", time.Unix(1000, 0))
+		writeFile(configFile, `{"header":"one"}`, time.Unix(1000, 0))
+
+		cfg, err := (&Runner{Input: ioutil.NopCloser(bytes.NewBufferString(BasicEnvoyConfig))}).getConfig()
+		Expect(err).NotTo(HaveOccurred())
+
+		log = &bytes.Buffer{}
+		w = newWatcher(&v1.FilterSpec{Id: "my_filter", RootID: "root"}, Watch{ConfigFile: configFile, Log: log}, cfg.GetStaticResources().GetListeners(), moduleFile, dir)
+		reloaded, err := w.reload()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reloaded).To(BeTrue())
+	})
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("publishes the listeners with a copy of the module and the config of the file", func() {
+		listeners := readListeners()
+		Expect(listeners).To(HaveLen(1))
+		b, err := wasmeutil.MarshalBytes(listeners[0])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(b)).To(ContainSubstring(`"configuration":"{\"header\":\"one\"}"`))
+
+		Expect(moduleCopies()).To(HaveLen(1))
+		Expect(string(b)).To(ContainSubstring(moduleCopies()[0]))
+		code, err := ioutil.ReadFile(moduleCopies()[0])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(code)).To(Equal("module-1"))
+	})
+
+	It("reloads the filter when the module changes", func() {
+		reloaded, err := w.reloadIfChanged()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reloaded).To(BeFalse())
+
+		writeFile(moduleFile, "module-2", time.Unix(2000, 0))
+		reloaded, err = w.reloadIfChanged()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reloaded).To(BeTrue())
+		Expect(log.String()).To(MatchRegexp(`^\d{4}-\d\d-\d\dT\S+ reloaded filter my_filter \(version 2\): \[` + moduleFile + `\] changed\n$`))
+
+		// the listeners reference the new copy, and the previous copy is removed
+		Expect(moduleCopies()).To(HaveLen(1))
+		code, err := ioutil.ReadFile(moduleCopies()[0])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(code)).To(Equal("module-2"))
+		b, err := wasmeutil.MarshalBytes(readListeners()[0])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(b)).To(ContainSubstring(moduleCopies()[0]))
+	})
+
+	It("reloads the filter when the config changes", func() {
+		writeFile(configFile, `{"header":"two"}`, time.Unix(2000, 0))
+		reloaded, err := w.reloadIfChanged()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reloaded).To(BeTrue())
+
+		b, err := wasmeutil.MarshalBytes(readListeners()[0])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(b)).To(ContainSubstring(`"configuration":"{\"header\":\"two\"}"`))
+	})
+
+	It("does not reload the filter when the files are touched without changing", func() {
+		writeFile(moduleFile, "module-1", time.Unix(2000, 0))
+		reloaded, err := w.reloadIfChanged()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reloaded).To(BeFalse())
+		Expect(log.String()).To(BeEmpty())
+		Expect(w.version).To(Equal(1))
+	})
+})
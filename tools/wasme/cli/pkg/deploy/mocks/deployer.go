@@ -8,6 +8,7 @@ import (
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
+	deploy "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy"
 	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
 )
 
@@ -48,6 +49,35 @@ func (mr *MockProviderMockRecorder) ApplyFilter(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ApplyFilter", reflect.TypeOf((*MockProvider)(nil).ApplyFilter), arg0)
 }
 
+// Capabilities mocks base method
+func (m *MockProvider) Capabilities() deploy.Capabilities {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Capabilities")
+	ret0, _ := ret[0].(deploy.Capabilities)
+	return ret0
+}
+
+// Capabilities indicates an expected call of Capabilities
+func (mr *MockProviderMockRecorder) Capabilities() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Capabilities", reflect.TypeOf((*MockProvider)(nil).Capabilities))
+}
+
+// ListFilters mocks base method
+func (m *MockProvider) ListFilters(arg0 string) ([]deploy.DeployedFilter, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListFilters", arg0)
+	ret0, _ := ret[0].([]deploy.DeployedFilter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListFilters indicates an expected call of ListFilters
+func (mr *MockProviderMockRecorder) ListFilters(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListFilters", reflect.TypeOf((*MockProvider)(nil).ListFilters), arg0)
+}
+
 // RemoveFilter mocks base method
 func (m *MockProvider) RemoveFilter(arg0 *v1.FilterSpec) error {
 	m.ctrl.T.Helper()
@@ -61,3 +91,18 @@ func (mr *MockProviderMockRecorder) RemoveFilter(arg0 interface{}) *gomock.Call
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveFilter", reflect.TypeOf((*MockProvider)(nil).RemoveFilter), arg0)
 }
+
+// Verify mocks base method
+func (m *MockProvider) Verify(arg0 string) ([]deploy.DeployedFilter, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Verify", arg0)
+	ret0, _ := ret[0].([]deploy.DeployedFilter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Verify indicates an expected call of Verify
+func (mr *MockProviderMockRecorder) Verify(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Verify", reflect.TypeOf((*MockProvider)(nil).Verify), arg0)
+}
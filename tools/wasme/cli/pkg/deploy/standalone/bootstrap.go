@@ -0,0 +1,194 @@
+package standalone
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/pkg/errors"
+	envoyfilter "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/filter"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+)
+
+const (
+	// the names of the http connection manager, and its deprecated name
+	hcmFilterName           = "envoy.filters.network.http_connection_manager"
+	deprecatedHcmFilterName = "envoy.http_connection_manager"
+	hcmTypeUrlSuffix        = ".HttpConnectionManager"
+
+	// the names of the router filter, and its deprecated name
+	routerFilterName           = "envoy.filters.http.router"
+	deprecatedRouterFilterName = "envoy.router"
+	routerTypeUrlSuffix        = ".Router"
+)
+
+// the bootstrap config of the Envoy deployment, edited as generic JSON so that the extensions
+// configured by the bootstrap need not be known to wasme
+type bootstrap struct {
+	config map[string]interface{}
+	// the bootstrap is written back in the format it was read in
+	json bool
+}
+
+func parseBootstrap(data string) (*bootstrap, error) {
+	isJson := strings.HasPrefix(strings.TrimSpace(data), "{")
+	b, err := yaml.YAMLToJSON([]byte(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing the bootstrap config")
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, errors.Wrap(err, "parsing the bootstrap config")
+	}
+	return &bootstrap{config: config, json: isJson}, nil
+}
+
+func (b *bootstrap) marshal() (string, error) {
+	data, err := json.MarshalIndent(b.config, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if b.json {
+		return string(data) + "\n", nil
+	}
+	data, err = yaml.JSONToYAML(data)
+	return string(data), err
+}
+
+// adds the typed wasm filter loading the module from the file before the router of each http connection manager
+// of the static listeners with the names, or of every static listener if no names are given.
+// a filter with the same id is replaced, so the filter is updated if it was already added
+func (b *bootstrap) addFilter(filter *v1.FilterSpec, filename string, listenerNames []string) error {
+	wasmFilter, err := envoyfilter.MakeTypedIstioWasmFilter(filter, envoyfilter.MakeV3LocalDatasource(filename))
+	if err != nil {
+		return err
+	}
+	// the filter is marshaled with the field names of the bootstrap config
+	wasmFilterJson, err := (&jsonpb.Marshaler{OrigName: true}).MarshalToString(wasmFilter)
+	if err != nil {
+		return err
+	}
+	var wasmFilterConfig map[string]interface{}
+	if err := json.Unmarshal([]byte(wasmFilterJson), &wasmFilterConfig); err != nil {
+		return err
+	}
+
+	var patched int
+	err = b.forEachHcm(listenerNames, func(listenerName string, hcm map[string]interface{}) error {
+		httpFilters, _ := hcm["http_filters"].([]interface{})
+		for i, httpFilter := range httpFilters {
+			if httpFilterName(httpFilter) == wasmFilter.GetName() {
+				httpFilters[i] = wasmFilterConfig
+				patched++
+				return nil
+			}
+		}
+		for i, httpFilter := range httpFilters {
+			if isRouter(httpFilter) {
+				hcm["http_filters"] = append(httpFilters[:i], append([]interface{}{wasmFilterConfig}, httpFilters[i:]...)...)
+				patched++
+				return nil
+			}
+		}
+		return errors.Errorf("listener %v: found no router in the http filters", listenerName)
+	})
+	if err != nil {
+		return err
+	}
+	if patched == 0 {
+		return errors.Errorf("found no http_connection_manager in the static listeners of the bootstrap config")
+	}
+	return nil
+}
+
+// removes the wasm filter added by addFilter from every static listener. returns false if the filter was not found
+func (b *bootstrap) removeFilter(filterId string) (bool, error) {
+	name := envoyfilter.HttpFilterName(filterId)
+	var removed bool
+	err := b.forEachHcm(nil, func(_ string, hcm map[string]interface{}) error {
+		httpFilters, _ := hcm["http_filters"].([]interface{})
+		for i, httpFilter := range httpFilters {
+			if httpFilterName(httpFilter) == name {
+				hcm["http_filters"] = append(httpFilters[:i], httpFilters[i+1:]...)
+				removed = true
+				return nil
+			}
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// calls fn with the config of each http connection manager of the static listeners with the names,
+// or of every static listener if no names are given. fails if a named listener is not found
+func (b *bootstrap) forEachHcm(listenerNames []string, fn func(listenerName string, hcm map[string]interface{}) error) error {
+	selected := map[string]bool{}
+	for _, name := range listenerNames {
+		selected[name] = false
+	}
+	staticResources, _ := b.config["static_resources"].(map[string]interface{})
+	listeners, _ := staticResources["listeners"].([]interface{})
+	for _, listener := range listeners {
+		listener, _ := listener.(map[string]interface{})
+		listenerName, _ := listener["name"].(string)
+		if len(listenerNames) > 0 {
+			if _, ok := selected[listenerName]; !ok {
+				continue
+			}
+			selected[listenerName] = true
+		}
+		filterChains, _ := listener["filter_chains"].([]interface{})
+		for _, filterChain := range filterChains {
+			filterChain, _ := filterChain.(map[string]interface{})
+			networkFilters, _ := filterChain["filters"].([]interface{})
+			for _, networkFilter := range networkFilters {
+				hcm := hcmConfig(networkFilter)
+				if hcm == nil {
+					continue
+				}
+				if err := fn(listenerName, hcm); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for name, found := range selected {
+		if !found {
+			return errors.Errorf("listener %v not found in the static listeners of the bootstrap config", name)
+		}
+	}
+	return nil
+}
+
+// returns the config of the network filter if it is an http connection manager
+func hcmConfig(networkFilter interface{}) map[string]interface{} {
+	filter, _ := networkFilter.(map[string]interface{})
+	if typedConfig, ok := filter["typed_config"].(map[string]interface{}); ok {
+		if typeUrl, _ := typedConfig["@type"].(string); strings.HasSuffix(typeUrl, hcmTypeUrlSuffix) {
+			return typedConfig
+		}
+		return nil
+	}
+	if name, _ := filter["name"].(string); name == hcmFilterName || name == deprecatedHcmFilterName {
+		config, _ := filter["config"].(map[string]interface{})
+		return config
+	}
+	return nil
+}
+
+func httpFilterName(httpFilter interface{}) string {
+	filter, _ := httpFilter.(map[string]interface{})
+	name, _ := filter["name"].(string)
+	return name
+}
+
+func isRouter(httpFilter interface{}) bool {
+	if name := httpFilterName(httpFilter); name == routerFilterName || name == deprecatedRouterFilterName {
+		return true
+	}
+	filter, _ := httpFilter.(map[string]interface{})
+	typedConfig, _ := filter["typed_config"].(map[string]interface{})
+	typeUrl, _ := typedConfig["@type"].(string)
+	return strings.HasSuffix(typeUrl, routerTypeUrlSuffix)
+}
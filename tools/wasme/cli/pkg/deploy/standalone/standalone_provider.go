@@ -0,0 +1,406 @@
+package standalone
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cache"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy"
+	envoyfilter "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/filter"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	pkgcache "github.com/solo-io/wasm/tools/wasme/pkg/cache"
+	"github.com/solo-io/wasm/tools/wasme/pkg/model"
+	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
+	"github.com/solo-io/wasm/tools/wasme/pkg/store"
+	"github.com/solo-io/wasm/tools/wasme/pkg/util"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// set on the Deployment to the images of the filters added to it by wasme, as a JSON object keyed by filter id.
+	// the filters are only removed from the Deployments recording them
+	AppliedFiltersAnnotation = "wasme.io/filters"
+
+	// set on the pod template of the Deployment to the hash of the bootstrap config,
+	// so that the pods are restarted with the bootstrap config when the filters change
+	BootstrapHashAnnotation = "wasme.io/bootstrap-hash"
+
+	// the modules are mounted into the Envoy container under this directory, in a directory named by filter id
+	ModulesDir = "/var/local/lib/wasme-filters"
+
+	// the ways the module is made available to the Envoy pods
+	ModuleSourceInitContainer = "init-container"
+	ModuleSourceHostPath      = "host-path"
+
+	// the host directory the wasme cache writes the modules to
+	DefaultHostPath = "/var/local/lib/wasme-cache"
+
+	// the container running Envoy, unless the Deployment has a single container
+	DefaultContainerName = "envoy"
+)
+
+var SupportedModuleSources = []string{ModuleSourceInitContainer, ModuleSourceHostPath}
+
+// the Deployment running Envoy, and the ConfigMap which holds its bootstrap config
+type Deployment struct {
+	Name      string
+	Namespace string
+
+	// the container running Envoy. defaults to DefaultContainerName, or the only container of the Deployment
+	Container string
+
+	ConfigMap    string
+	ConfigMapKey string
+}
+
+// Provider adds the filters to the http connection managers of the bootstrap config of a Deployment of Envoy
+// which runs without a control plane, e.g. without a service mesh.
+// the module of the filter is mounted into the pods of the Deployment, whose pod template is updated to roll out
+// the bootstrap config with the filter
+type Provider struct {
+	Ctx        context.Context
+	KubeClient kubernetes.Interface
+
+	// pulls the image of the filter for its digest
+	Puller pull.ImagePuller
+
+	Deployment Deployment
+
+	// the names of the static listeners to add the filter to. if empty, the filter is added to every static listener
+	Listeners []string
+
+	// how the module is made available to the pods, ModuleSourceInitContainer by default:
+	// - ModuleSourceInitContainer: an init container pulls the image, pinned to its digest, into an emptyDir volume
+	// - ModuleSourceHostPath: the module is read from the host directory, as the file named by the digest of the image,
+	//   which the wasme cache writes for the images it caches
+	ModuleSource string
+
+	// the image of the init container, which runs wasme pull. defaults to the image of the wasme cache
+	InitImage string
+
+	// the host directory the module is read from with ModuleSourceHostPath. defaults to DefaultHostPath
+	HostPath string
+}
+
+// Capabilities returns the features of the provider. the bootstrap config has no patch contexts,
+// and the filters are not checked in the running proxies
+func (p *Provider) Capabilities() deploy.Capabilities {
+	return deploy.Capabilities{
+		Provider:    "envoy-k8s",
+		ListFilters: true,
+	}
+}
+
+// ApplyFilter adds the filter to the bootstrap config, and mounts its module into the pods of the Deployment.
+// the filter is updated if it was already applied
+func (p *Provider) ApplyFilter(filter *v1.FilterSpec) error {
+	// the deployer leaves the checksum of filters without a config to the provider
+	if filter.ConfigChecksum && filter.GetConfig() == nil {
+		if _, err := envoyfilter.InjectConfigChecksum(filter); err != nil {
+			return err
+		}
+	}
+	image, err := p.Puller.Pull(p.Ctx, filter.Image)
+	if err != nil {
+		return err
+	}
+	module, err := p.makeModule(filter, image)
+	if err != nil {
+		return err
+	}
+
+	return p.updateDeployment(func(dep *appsv1.Deployment, bootstrap *bootstrap) (bool, error) {
+		if err := bootstrap.addFilter(filter, module.filename, p.Listeners); err != nil {
+			return false, err
+		}
+		container, err := p.envoyContainer(dep)
+		if err != nil {
+			return false, err
+		}
+		removeModule(dep, container, filter.Id)
+		module.mount(dep, container)
+		applied := appliedFilters(dep)
+		applied[filter.Id] = filter.Image
+		return true, writeAppliedFilters(dep, applied)
+	})
+}
+
+// RemoveFilter removes the filter from the bootstrap config, and the module from the pods of the Deployment.
+// does nothing if the filter was not applied to the Deployment by wasme
+func (p *Provider) RemoveFilter(filter *v1.FilterSpec) error {
+	return p.updateDeployment(func(dep *appsv1.Deployment, bootstrap *bootstrap) (bool, error) {
+		applied := appliedFilters(dep)
+		if _, ok := applied[filter.Id]; !ok {
+			logrus.WithFields(logrus.Fields{
+				"filter":     filter.Id,
+				"deployment": dep.Name + "." + dep.Namespace,
+			}).Warnf("filter was not deployed to the deployment by wasme, not removing it")
+			return false, nil
+		}
+		if _, err := bootstrap.removeFilter(filter.Id); err != nil {
+			return false, err
+		}
+		container, err := p.envoyContainer(dep)
+		if err != nil {
+			return false, err
+		}
+		removeModule(dep, container, filter.Id)
+		delete(applied, filter.Id)
+		return true, writeAppliedFilters(dep, applied)
+	})
+}
+
+// ListFilters lists the filters recorded on the Deployment whose id starts with the prefix, every filter if the prefix is empty
+func (p *Provider) ListFilters(idPrefix string) ([]deploy.DeployedFilter, error) {
+	dep, err := p.KubeClient.AppsV1().Deployments(p.Deployment.Namespace).Get(p.Deployment.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var filters []deploy.DeployedFilter
+	for id, image := range appliedFilters(dep) {
+		if !strings.HasPrefix(id, idPrefix) {
+			continue
+		}
+		filters = append(filters, deploy.DeployedFilter{
+			Id:       id,
+			Image:    image,
+			Workload: dep.Name + "." + dep.Namespace,
+		})
+	}
+	deploy.SortDeployedFilters(filters)
+	return filters, nil
+}
+
+// Verify is not supported: the config of the proxies is not read back from the pods
+func (p *Provider) Verify(idPrefix string) ([]deploy.DeployedFilter, error) {
+	return nil, &deploy.UnsupportedError{Provider: p.Capabilities().Provider, Feature: "verifying the deployed filters"}
+}
+
+// updates the bootstrap config in the ConfigMap and the Deployment with the update, retrying on conflicts.
+// the ConfigMap is updated first, and the pod template is annotated with the hash of the bootstrap config,
+// so the Deployment rolls out the pods with the new config if it changed.
+// nothing is written if the update returns false
+func (p *Provider) updateDeployment(update func(dep *appsv1.Deployment, bootstrap *bootstrap) (bool, error)) error {
+	var (
+		dep     *appsv1.Deployment
+		updated bool
+	)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var err error
+		dep, err = p.KubeClient.AppsV1().Deployments(p.Deployment.Namespace).Get(p.Deployment.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		cm, err := p.KubeClient.CoreV1().ConfigMaps(p.Deployment.Namespace).Get(p.Deployment.ConfigMap, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		data, ok := cm.Data[p.Deployment.ConfigMapKey]
+		if !ok {
+			return errors.Errorf("configmap %v.%v has no key %v", cm.Name, cm.Namespace, p.Deployment.ConfigMapKey)
+		}
+		bootstrap, err := parseBootstrap(data)
+		if err != nil {
+			return errors.Wrapf(err, "configmap %v.%v", cm.Name, cm.Namespace)
+		}
+
+		updated, err = update(dep, bootstrap)
+		if err != nil || !updated {
+			return err
+		}
+
+		data, err = bootstrap.marshal()
+		if err != nil {
+			return err
+		}
+		cm.Data[p.Deployment.ConfigMapKey] = data
+		if _, err := p.KubeClient.CoreV1().ConfigMaps(cm.Namespace).Update(cm); err != nil {
+			return err
+		}
+
+		if dep.Spec.Template.Annotations == nil {
+			dep.Spec.Template.Annotations = map[string]string{}
+		}
+		dep.Spec.Template.Annotations[BootstrapHashAnnotation] = fmt.Sprintf("%x", sha256.Sum256([]byte(data)))
+		dep, err = p.KubeClient.AppsV1().Deployments(dep.Namespace).Update(dep)
+		return err
+	})
+	if err != nil || !updated {
+		return err
+	}
+	logrus.Infof("updated deployment %v.%v, rolling out the bootstrap config of configmap %v", dep.Name, dep.Namespace, p.Deployment.ConfigMap)
+	return nil
+}
+
+func (p *Provider) envoyContainer(dep *appsv1.Deployment) (*corev1.Container, error) {
+	containers := dep.Spec.Template.Spec.Containers
+	name := p.Deployment.Container
+	if name == "" {
+		if len(containers) == 1 {
+			return &containers[0], nil
+		}
+		name = DefaultContainerName
+	}
+	for i := range containers {
+		if containers[i].Name == name {
+			return &containers[i], nil
+		}
+	}
+	return nil, errors.Errorf("did not find container named %v on deployment %v.%v", name, dep.Name, dep.Namespace)
+}
+
+// the module of the filter, and the volume (and init container) which make it available to the Envoy container
+type module struct {
+	filename string
+	mount    func(dep *appsv1.Deployment, container *corev1.Container)
+}
+
+func (p *Provider) makeModule(filter *v1.FilterSpec, image pull.Image) (*module, error) {
+	name := volumeName(filter.Id)
+	mountPath := filepath.Join(ModulesDir, filter.Id)
+	volumeMount := corev1.VolumeMount{Name: name, MountPath: mountPath, ReadOnly: true}
+
+	switch p.ModuleSource {
+	case "", ModuleSourceInitContainer:
+		// the init container pulls the image pinned to its digest, so the pods run the same module
+		// even if the tag is moved, and the store directory of the image is known
+		pinned, err := pinImage(filter.Image, image)
+		if err != nil {
+			return nil, err
+		}
+		fullRef, err := model.FullRef(pinned)
+		if err != nil {
+			return nil, err
+		}
+		initImage := p.InitImage
+		if initImage == "" {
+			initImage = cache.CacheImageRepository + ":" + cache.CacheImageTag
+		}
+		volume := corev1.Volume{Name: name, VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}
+		initContainer := corev1.Container{
+			Name:         name,
+			Image:        initImage,
+			Args:         []string{"pull", fullRef, "--store", mountPath},
+			VolumeMounts: []corev1.VolumeMount{{Name: name, MountPath: mountPath}},
+		}
+		return &module{
+			filename: filepath.Join(mountPath, store.Dirname(fullRef), model.CodeFilename),
+			mount: func(dep *appsv1.Deployment, container *corev1.Container) {
+				spec := &dep.Spec.Template.Spec
+				spec.Volumes = append(spec.Volumes, volume)
+				spec.InitContainers = append(spec.InitContainers, initContainer)
+				container.VolumeMounts = append(container.VolumeMounts, volumeMount)
+			},
+		}, nil
+	case ModuleSourceHostPath:
+		descriptor, err := image.Descriptor()
+		if err != nil {
+			return nil, err
+		}
+		cachedFile, err := pkgcache.Digest2filename(descriptor.Digest)
+		if err != nil {
+			return nil, err
+		}
+		hostPath := p.HostPath
+		if hostPath == "" {
+			hostPath = DefaultHostPath
+		}
+		volume := corev1.Volume{Name: name, VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: hostPath}}}
+		return &module{
+			filename: filepath.Join(mountPath, cachedFile),
+			mount: func(dep *appsv1.Deployment, container *corev1.Container) {
+				spec := &dep.Spec.Template.Spec
+				spec.Volumes = append(spec.Volumes, volume)
+				container.VolumeMounts = append(container.VolumeMounts, volumeMount)
+			},
+		}, nil
+	}
+	return nil, errors.Errorf("unknown module source %v, must be one of %v", p.ModuleSource, strings.Join(SupportedModuleSources, ", "))
+}
+
+// returns the ref pinned to the digest of the manifest of the image, unless it is already referenced by digest
+func pinImage(ref string, image pull.Image) (string, error) {
+	_, _, refDigest, err := util.SplitImageRefDigest(ref)
+	if err != nil {
+		return "", err
+	}
+	if refDigest != "" {
+		return ref, nil
+	}
+	manifestImage, ok := image.(pull.ManifestImage)
+	if !ok {
+		return "", errors.Errorf("cannot pin image %v to a digest: the digest of its manifest is unknown", ref)
+	}
+	return util.PinImageRef(ref, manifestImage.ManifestDigest())
+}
+
+// removes the volume, init container and volume mount of the module of the filter, if present
+func removeModule(dep *appsv1.Deployment, container *corev1.Container, filterId string) {
+	name := volumeName(filterId)
+	spec := &dep.Spec.Template.Spec
+	var volumes []corev1.Volume
+	for _, volume := range spec.Volumes {
+		if volume.Name != name {
+			volumes = append(volumes, volume)
+		}
+	}
+	spec.Volumes = volumes
+	var initContainers []corev1.Container
+	for _, initContainer := range spec.InitContainers {
+		if initContainer.Name != name {
+			initContainers = append(initContainers, initContainer)
+		}
+	}
+	spec.InitContainers = initContainers
+	var mounts []corev1.VolumeMount
+	for _, mount := range container.VolumeMounts {
+		if mount.Name != name {
+			mounts = append(mounts, mount)
+		}
+	}
+	container.VolumeMounts = mounts
+}
+
+// the name of the volume and init container of the module of the filter
+func volumeName(filterId string) string {
+	return "wasme-filter-" + filterId
+}
+
+// returns the filters recorded on the Deployment, by id
+func appliedFilters(dep *appsv1.Deployment) map[string]string {
+	applied := map[string]string{}
+	if value := dep.Annotations[AppliedFiltersAnnotation]; value != "" {
+		if err := json.Unmarshal([]byte(value), &applied); err != nil {
+			logrus.WithError(err).Warnf("ignoring invalid %v annotation on deployment %v.%v", AppliedFiltersAnnotation, dep.Name, dep.Namespace)
+			return map[string]string{}
+		}
+	}
+	return applied
+}
+
+// writes the filters to the annotation, removing it once no filters are left
+func writeAppliedFilters(dep *appsv1.Deployment, applied map[string]string) error {
+	if len(applied) == 0 {
+		delete(dep.Annotations, AppliedFiltersAnnotation)
+		return nil
+	}
+	b, err := json.Marshal(applied)
+	if err != nil {
+		return err
+	}
+	if dep.Annotations == nil {
+		dep.Annotations = map[string]string{}
+	}
+	dep.Annotations[AppliedFiltersAnnotation] = string(b)
+	return nil
+}
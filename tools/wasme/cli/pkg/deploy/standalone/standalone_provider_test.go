@@ -0,0 +1,294 @@
+package standalone_test
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy"
+	. "github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/standalone"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	"github.com/solo-io/wasm/tools/wasme/pkg/config"
+	"github.com/solo-io/wasm/tools/wasme/pkg/model"
+	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
+	"github.com/solo-io/wasm/tools/wasme/pkg/store"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const bootstrapYaml = `
+static_resources:
+  listeners:
+  - name: ingress
+    address:
+      socket_address: {address: 0.0.0.0, port_value: 8080}
+    filter_chains:
+    - filters:
+      - name: envoy.filters.network.http_connection_manager
+        typed_config:
+          "@type": type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager
+          stat_prefix: ingress
+          http_filters:
+          - name: envoy.filters.http.cors
+          - name: envoy.filters.http.router
+  - name: admin
+    address:
+      socket_address: {address: 0.0.0.0, port_value: 8081}
+    filter_chains:
+    - filters:
+      - name: envoy.http_connection_manager
+        config:
+          stat_prefix: admin
+          http_filters:
+          - name: envoy.router
+`
+
+var _ = Describe("Provider", func() {
+	var (
+		kubeClient kubernetes.Interface
+		provider   *Provider
+
+		manifestDigest = digest.FromString("manifest")
+		moduleDigest   = digest.FromString("module")
+		filter         = &v1.FilterSpec{Id: "myfilter", Image: "webassemblyhub.io/test/filter:v1"}
+	)
+	BeforeEach(func() {
+		kubeClient = fake.NewSimpleClientset(
+			&appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "envoy", Namespace: "edge"},
+				Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "envoy"}, {Name: "sidecar"}},
+				}}},
+			},
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "envoy-config", Namespace: "edge"},
+				Data:       map[string]string{"envoy.yaml": bootstrapYaml},
+			},
+		)
+		provider = &Provider{
+			Ctx:        context.TODO(),
+			KubeClient: kubeClient,
+			Puller:     &mockPuller{manifestDigest: manifestDigest, moduleDigest: moduleDigest},
+			Deployment: Deployment{
+				Name:         "envoy",
+				Namespace:    "edge",
+				ConfigMap:    "envoy-config",
+				ConfigMapKey: "envoy.yaml",
+			},
+		}
+	})
+
+	getDeployment := func() *appsv1.Deployment {
+		dep, err := kubeClient.AppsV1().Deployments("edge").Get("envoy", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		return dep
+	}
+	getBootstrap := func() string {
+		cm, err := kubeClient.CoreV1().ConfigMaps("edge").Get("envoy-config", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		return cm.Data["envoy.yaml"]
+	}
+	// the names of the http filters of each listener, and the filename of the module of each wasm filter
+	httpFilters := func() map[string][]string {
+		type hcmConfig struct {
+			HttpFilters []struct {
+				Name        string
+				TypedConfig struct {
+					Value struct {
+						Config struct {
+							VmConfig struct {
+								Code struct {
+									Local struct{ Filename string }
+								}
+							}
+						}
+					}
+				} `json:"typed_config"`
+			} `json:"http_filters"`
+		}
+		var bootstrap struct {
+			StaticResources struct {
+				Listeners []struct {
+					Name         string
+					FilterChains []struct {
+						Filters []struct {
+							TypedConfig hcmConfig `json:"typed_config"`
+							Config      hcmConfig
+						}
+					} `json:"filter_chains"`
+				}
+			} `json:"static_resources"`
+		}
+		Expect(yaml.Unmarshal([]byte(getBootstrap()), &bootstrap)).NotTo(HaveOccurred())
+		filters := map[string][]string{}
+		for _, listener := range bootstrap.StaticResources.Listeners {
+			for _, hcm := range listener.FilterChains[0].Filters {
+				httpFilters := hcm.TypedConfig.HttpFilters
+				if len(httpFilters) == 0 {
+					httpFilters = hcm.Config.HttpFilters
+				}
+				for _, httpFilter := range httpFilters {
+					name := httpFilter.Name
+					if filename := httpFilter.TypedConfig.Value.Config.VmConfig.Code.Local.Filename; filename != "" {
+						name += " " + filename
+					}
+					filters[listener.Name] = append(filters[listener.Name], name)
+				}
+			}
+		}
+		return filters
+	}
+
+	It("adds the filter before the router of every static listener, pulling the module with an init container", func() {
+		Expect(provider.ApplyFilter(filter)).NotTo(HaveOccurred())
+
+		pinned := "webassemblyhub.io/test/filter@" + manifestDigest.String()
+		filename := "/var/local/lib/wasme-filters/myfilter/" + store.Dirname(pinned) + "/" + model.CodeFilename
+		Expect(httpFilters()).To(Equal(map[string][]string{
+			"ingress": {"envoy.filters.http.cors", "wasme.myfilter " + filename, "envoy.filters.http.router"},
+			"admin":   {"wasme.myfilter " + filename, "envoy.router"},
+		}))
+
+		dep := getDeployment()
+		Expect(dep.Annotations).To(HaveKeyWithValue(AppliedFiltersAnnotation, `{"myfilter":"webassemblyhub.io/test/filter:v1"}`))
+		Expect(dep.Spec.Template.Annotations).To(HaveKey(BootstrapHashAnnotation))
+		podSpec := dep.Spec.Template.Spec
+		Expect(podSpec.Volumes).To(Equal([]corev1.Volume{{
+			Name:         "wasme-filter-myfilter",
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		}}))
+		Expect(podSpec.InitContainers).To(HaveLen(1))
+		Expect(podSpec.InitContainers[0].Args).To(Equal([]string{"pull", pinned, "--store", "/var/local/lib/wasme-filters/myfilter"}))
+		Expect(podSpec.Containers[0].VolumeMounts).To(Equal([]corev1.VolumeMount{{
+			Name: "wasme-filter-myfilter", MountPath: "/var/local/lib/wasme-filters/myfilter", ReadOnly: true,
+		}}))
+		Expect(podSpec.Containers[1].VolumeMounts).To(BeEmpty())
+	})
+
+	It("updates the filter when it is applied again", func() {
+		Expect(provider.ApplyFilter(filter)).NotTo(HaveOccurred())
+		hash := getDeployment().Spec.Template.Annotations[BootstrapHashAnnotation]
+
+		provider.ModuleSource = ModuleSourceHostPath
+		Expect(provider.ApplyFilter(filter)).NotTo(HaveOccurred())
+
+		filename := "/var/local/lib/wasme-filters/myfilter/" + moduleDigest.Encoded()
+		Expect(httpFilters()["ingress"]).To(Equal([]string{"envoy.filters.http.cors", "wasme.myfilter " + filename, "envoy.filters.http.router"}))
+		dep := getDeployment()
+		// the pods are rolled out with the new bootstrap config
+		Expect(dep.Spec.Template.Annotations[BootstrapHashAnnotation]).NotTo(Equal(hash))
+		podSpec := dep.Spec.Template.Spec
+		Expect(podSpec.InitContainers).To(BeEmpty())
+		Expect(podSpec.Volumes).To(Equal([]corev1.Volume{{
+			Name:         "wasme-filter-myfilter",
+			VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: DefaultHostPath}},
+		}}))
+		Expect(podSpec.Containers[0].VolumeMounts).To(HaveLen(1))
+	})
+
+	It("only patches the selected listeners", func() {
+		provider.Listeners = []string{"admin"}
+		Expect(provider.ApplyFilter(filter)).NotTo(HaveOccurred())
+		filters := httpFilters()
+		Expect(filters["ingress"]).To(Equal([]string{"envoy.filters.http.cors", "envoy.filters.http.router"}))
+		Expect(filters["admin"]).To(HaveLen(2))
+
+		provider.Listeners = []string{"egress"}
+		err := provider.ApplyFilter(filter)
+		Expect(err).To(MatchError("listener egress not found in the static listeners of the bootstrap config"))
+	})
+
+	It("removes the filter, its module and its annotations", func() {
+		Expect(provider.ApplyFilter(filter)).NotTo(HaveOccurred())
+		Expect(provider.RemoveFilter(filter)).NotTo(HaveOccurred())
+
+		Expect(httpFilters()).To(Equal(map[string][]string{
+			"ingress": {"envoy.filters.http.cors", "envoy.filters.http.router"},
+			"admin":   {"envoy.router"},
+		}))
+		dep := getDeployment()
+		Expect(dep.Annotations).NotTo(HaveKey(AppliedFiltersAnnotation))
+		Expect(dep.Spec.Template.Spec.Volumes).To(BeEmpty())
+		Expect(dep.Spec.Template.Spec.InitContainers).To(BeEmpty())
+		Expect(dep.Spec.Template.Spec.Containers[0].VolumeMounts).To(BeEmpty())
+	})
+
+	It("does not remove the filters deployed without wasme", func() {
+		bootstrap := getBootstrap()
+		Expect(provider.RemoveFilter(filter)).NotTo(HaveOccurred())
+		Expect(getBootstrap()).To(Equal(bootstrap))
+	})
+
+	It("keeps JSON bootstrap configs in JSON", func() {
+		jsonBootstrap, err := yaml.YAMLToJSON([]byte(bootstrapYaml))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = kubeClient.CoreV1().ConfigMaps("edge").Update(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "envoy-config", Namespace: "edge"},
+			Data:       map[string]string{"envoy.yaml": string(jsonBootstrap)},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(provider.ApplyFilter(filter)).NotTo(HaveOccurred())
+		Expect(strings.TrimSpace(getBootstrap())).To(HavePrefix("{"))
+		Expect(httpFilters()["ingress"]).To(HaveLen(3))
+	})
+
+	It("lists the filters recorded on the deployment", func() {
+		Expect(provider.ApplyFilter(filter)).NotTo(HaveOccurred())
+		Expect(provider.ApplyFilter(&v1.FilterSpec{Id: "other", Image: "webassemblyhub.io/test/other:v1"})).NotTo(HaveOccurred())
+
+		filters, err := provider.ListFilters("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filters).To(Equal([]deploy.DeployedFilter{
+			{Id: "myfilter", Image: "webassemblyhub.io/test/filter:v1", Workload: "envoy.edge"},
+			{Id: "other", Image: "webassemblyhub.io/test/other:v1", Workload: "envoy.edge"},
+		}))
+
+		filters, err = provider.ListFilters("oth")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filters).To(HaveLen(1))
+	})
+})
+
+type mockPuller struct {
+	manifestDigest digest.Digest
+	moduleDigest   digest.Digest
+}
+
+func (p *mockPuller) Pull(ctx context.Context, ref string) (pull.Image, error) {
+	return &mockImage{ref: ref, manifestDigest: p.manifestDigest, moduleDigest: p.moduleDigest}, nil
+}
+
+type mockImage struct {
+	ref            string
+	manifestDigest digest.Digest
+	moduleDigest   digest.Digest
+}
+
+func (i *mockImage) Ref() string {
+	return i.ref
+}
+
+func (i *mockImage) ManifestDigest() digest.Digest {
+	return i.manifestDigest
+}
+
+func (i *mockImage) Descriptor() (ocispec.Descriptor, error) {
+	return ocispec.Descriptor{Digest: i.moduleDigest}, nil
+}
+
+func (i *mockImage) FetchFilter(ctx context.Context) (model.Filter, error) {
+	return ioutil.NopCloser(strings.NewReader("")), nil
+}
+
+func (i *mockImage) FetchConfig(ctx context.Context) (*config.Runtime, error) {
+	return &config.Runtime{}, nil
+}
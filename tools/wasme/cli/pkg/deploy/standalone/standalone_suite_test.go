@@ -0,0 +1,13 @@
+package standalone_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestStandalone(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Standalone Suite")
+}
@@ -0,0 +1,154 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultQueueSize        = 100
+	DefaultRetryInterval    = time.Second
+	DefaultMaxRetryInterval = 30 * time.Second
+)
+
+type EmitterOptions struct {
+	// the maximum number of undelivered events. once the queue is full, new events are dropped.
+	// defaults to DefaultQueueSize
+	QueueSize int
+	// the delay before retrying a failed delivery, doubled after each attempt.
+	// defaults to DefaultRetryInterval
+	RetryInterval time.Duration
+	// defaults to DefaultMaxRetryInterval
+	MaxRetryInterval time.Duration
+}
+
+// Emitter delivers events in the background, so a down sink never blocks the caller.
+// events are retried until delivered or the emitter is stopped (at-least-once delivery),
+// and held in a bounded queue in the meantime.
+type Emitter struct {
+	transport Transport
+	source    string
+	opts      EmitterOptions
+	queue     chan *Event
+
+	lock sync.Mutex
+	// the number of events emitted but not yet delivered, including the event being sent
+	pending int
+	dropped int
+}
+
+// NewEmitter creates an Emitter for events originating from source.
+// call Start to begin delivering events
+func NewEmitter(transport Transport, source string, opts EmitterOptions) *Emitter {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = DefaultRetryInterval
+	}
+	if opts.MaxRetryInterval <= 0 {
+		opts.MaxRetryInterval = DefaultMaxRetryInterval
+	}
+	return &Emitter{
+		transport: transport,
+		source:    source,
+		opts:      opts,
+		queue:     make(chan *Event, opts.QueueSize),
+	}
+}
+
+// Start delivers the queued events until the context is cancelled
+func (e *Emitter) Start(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-e.queue:
+				if e.deliver(ctx, event) {
+					e.lock.Lock()
+					e.pending--
+					e.lock.Unlock()
+				}
+			}
+		}
+	}()
+}
+
+// Emit queues an event for delivery without blocking.
+// the event is dropped if it cannot be encoded or the queue is full
+func (e *Emitter) Emit(eventType, subject string, data interface{}) {
+	logger := logrus.WithFields(logrus.Fields{
+		"type":    eventType,
+		"subject": subject,
+	})
+	event, err := NewEvent(eventType, e.source, subject, data)
+	if err != nil {
+		logger.WithError(err).Warn("dropping event which could not be encoded")
+		return
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	select {
+	case e.queue <- event:
+		e.pending++
+	default:
+		e.dropped++
+		logger.Warnf("dropping event, %v events are waiting for delivery", e.opts.QueueSize)
+	}
+}
+
+// Flush waits up to timeout for the queued events to be delivered
+func (e *Emitter) Flush(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		e.lock.Lock()
+		pending := e.pending
+		e.lock.Unlock()
+		if pending == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.Errorf("timed out waiting for %v event(s) to be delivered", pending)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Dropped returns the number of events dropped because the queue was full
+func (e *Emitter) Dropped() int {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.dropped
+}
+
+// sends the event until it is delivered. returns false if the context was cancelled first
+func (e *Emitter) deliver(ctx context.Context, event *Event) bool {
+	interval := e.opts.RetryInterval
+	for {
+		err := e.transport.Send(ctx, event)
+		if err == nil {
+			return true
+		}
+		logrus.WithFields(logrus.Fields{
+			"type":  event.Type,
+			"id":    event.Id,
+			"retry": interval,
+		}).WithError(err).Warn("failed to deliver event")
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(interval):
+		}
+		interval *= 2
+		if interval > e.opts.MaxRetryInterval {
+			interval = e.opts.MaxRetryInterval
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package events_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/solo-io/wasm/tools/wasme/cli/pkg/events"
+)
+
+// an HTTP sink recording the received events.
+// responds with the given status codes in order, then 200
+type sink struct {
+	lock     sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+	// blocks requests until unblocked
+	block     chan struct{}
+	unblocked sync.Once
+}
+
+func (s *sink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.block != nil {
+		<-s.block
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.requests = append(s.requests, r)
+	s.bodies = append(s.bodies, body)
+	if len(s.statuses) > 0 {
+		w.WriteHeader(s.statuses[0])
+		s.statuses = s.statuses[1:]
+	}
+}
+
+func (s *sink) unblock() {
+	if s.block != nil {
+		s.unblocked.Do(func() { close(s.block) })
+	}
+}
+
+func (s *sink) received() ([]*http.Request, [][]byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.requests, s.bodies
+}
+
+var _ = Describe("Emitter", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		recv   *sink
+		server *httptest.Server
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		recv = &sink{}
+		server = httptest.NewServer(recv)
+	})
+
+	AfterEach(func() {
+		cancel()
+		recv.unblock()
+		server.Close()
+	})
+
+	newEmitter := func(opts EmitterOptions) *Emitter {
+		emitter := NewEmitter(NewHTTPTransport(server.URL), "wasme-test", opts)
+		emitter.Start(ctx)
+		return emitter
+	}
+
+	It("sends structured CloudEvents to the sink", func() {
+		emitter := newEmitter(EmitterOptions{})
+		emitter.Emit(TypeFilterDeployed, "default/my-filter", DeployReport{
+			FilterId: "my-filter",
+			Image:    "webassemblyhub.io/example/filter:v1",
+			RootId:   "root",
+		})
+		Expect(emitter.Flush(5 * time.Second)).NotTo(HaveOccurred())
+
+		requests, bodies := recv.received()
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Method).To(Equal(http.MethodPost))
+		Expect(requests[0].Header.Get("Content-Type")).To(Equal("application/cloudevents+json"))
+
+		var event map[string]interface{}
+		Expect(json.Unmarshal(bodies[0], &event)).NotTo(HaveOccurred())
+		Expect(event).To(HaveKeyWithValue("specversion", "1.0"))
+		Expect(event).To(HaveKeyWithValue("type", "io.wasme.filter.deployed"))
+		Expect(event).To(HaveKeyWithValue("source", "wasme-test"))
+		Expect(event).To(HaveKeyWithValue("subject", "default/my-filter"))
+		Expect(event).To(HaveKeyWithValue("datacontenttype", "application/json"))
+		Expect(event["id"]).NotTo(BeEmpty())
+		_, err := time.Parse(time.RFC3339, event["time"].(string))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(event["data"]).To(Equal(map[string]interface{}{
+			"filterId": "my-filter",
+			"image":    "webassemblyhub.io/example/filter:v1",
+			"rootId":   "root",
+		}))
+	})
+
+	It("gives each event a unique id", func() {
+		emitter := newEmitter(EmitterOptions{})
+		emitter.Emit(TypeFilterDeployed, "filter", DeployReport{FilterId: "filter"})
+		emitter.Emit(TypeFilterRemoved, "filter", DeployReport{FilterId: "filter", Remove: true})
+		Expect(emitter.Flush(5 * time.Second)).NotTo(HaveOccurred())
+
+		_, bodies := recv.received()
+		var ids []string
+		for _, body := range bodies {
+			var event Event
+			Expect(json.Unmarshal(body, &event)).NotTo(HaveOccurred())
+			ids = append(ids, event.Id)
+		}
+		Expect(ids).To(HaveLen(2))
+		Expect(ids[0]).NotTo(Equal(ids[1]))
+	})
+
+	It("retries until the sink accepts the event", func() {
+		recv.statuses = []int{http.StatusServiceUnavailable, http.StatusInternalServerError}
+		emitter := newEmitter(EmitterOptions{RetryInterval: 10 * time.Millisecond})
+		emitter.Emit(TypeFilterFailed, "filter", DeployReport{FilterId: "filter", Error: "boom"})
+		Expect(emitter.Flush(5 * time.Second)).NotTo(HaveOccurred())
+
+		// the same event is sent each time
+		_, bodies := recv.received()
+		Expect(bodies).To(HaveLen(3))
+		Expect(bodies[1]).To(Equal(bodies[0]))
+		Expect(bodies[2]).To(Equal(bodies[0]))
+	})
+
+	It("does not block or grow beyond the queue size while the sink is down", func() {
+		recv.block = make(chan struct{})
+		emitter := newEmitter(EmitterOptions{QueueSize: 2})
+
+		emitted := make(chan struct{})
+		go func() {
+			defer close(emitted)
+			for i := 0; i < 5; i++ {
+				emitter.Emit(TypeFilterDeployed, "filter", DeployReport{FilterId: "filter"})
+			}
+		}()
+		Eventually(emitted).Should(BeClosed())
+
+		// at most one event is in flight and two are queued
+		Expect(emitter.Dropped()).To(BeNumerically(">=", 2))
+		Expect(emitter.Flush(50 * time.Millisecond)).To(HaveOccurred())
+
+		recv.unblock()
+		Expect(emitter.Flush(5 * time.Second)).NotTo(HaveOccurred())
+		requests, _ := recv.received()
+		Expect(requests).To(HaveLen(5 - emitter.Dropped()))
+	})
+})
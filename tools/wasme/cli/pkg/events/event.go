@@ -0,0 +1,81 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+const (
+	// the version of the CloudEvents specification implemented by Event
+	SpecVersion = "1.0"
+
+	// the content type of an Event encoded in the structured content mode
+	ContentType = "application/cloudevents+json"
+
+	TypeFilterDeployed = "io.wasme.filter.deployed"
+	TypeFilterRemoved  = "io.wasme.filter.removed"
+	TypeFilterFailed   = "io.wasme.filter.failed"
+)
+
+// a CloudEvent, encoded as JSON in the structured content mode
+// https://github.com/cloudevents/spec/blob/v1.0/spec.md
+type Event struct {
+	SpecVersion     string          `json:"specversion"`
+	Id              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+}
+
+// the data of the filter lifecycle events
+type DeployReport struct {
+	FilterId string `json:"filterId"`
+	Image    string `json:"image"`
+	RootId   string `json:"rootId,omitempty"`
+	// the checksum injected into the deployed config of the filter, see FilterSpec.configChecksum
+	ConfigChecksum string `json:"configChecksum,omitempty"`
+	// true if the filter was being removed
+	Remove bool `json:"remove,omitempty"`
+	// set for failed events
+	Error string `json:"error,omitempty"`
+}
+
+// NewEvent creates an event with a unique id and the current time, encoding data as JSON
+func NewEvent(eventType, source, subject string, data interface{}) (*Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	id, err := newId()
+	if err != nil {
+		return nil, err
+	}
+	return &Event{
+		SpecVersion:     SpecVersion,
+		Id:              id,
+		Source:          source,
+		Type:            eventType,
+		Subject:         subject,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Data:            raw,
+	}, nil
+}
+
+// Encode returns the event in the structured content mode, to be sent with the ContentType
+func Encode(event *Event) ([]byte, error) {
+	return json.Marshal(event)
+}
+
+func newId() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
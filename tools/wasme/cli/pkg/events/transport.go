@@ -0,0 +1,57 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// delivers events to a sink
+type Transport interface {
+	Send(ctx context.Context, event *Event) error
+}
+
+// sends events to an HTTP sink, such as a Knative broker or a Kafka HTTP bridge accepting CloudEvents.
+// any response other than 2xx is treated as a failed delivery
+type HTTPTransport struct {
+	URL string
+	// defaults to http.DefaultClient
+	Client *http.Client
+}
+
+func NewHTTPTransport(url string) *HTTPTransport {
+	return &HTTPTransport{URL: url}
+}
+
+func (t *HTTPTransport) Send(ctx context.Context, event *Event) error {
+	body, err := Encode(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ContentType)
+
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrapf(err, "sending event to %v", t.URL)
+	}
+	defer res.Body.Close()
+	// drain the body so the connection is reused
+	io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return errors.Errorf("sink %v responded with %v", t.URL, res.Status)
+	}
+	return nil
+}
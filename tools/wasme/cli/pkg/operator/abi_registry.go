@@ -0,0 +1,40 @@
+package operator
+
+import (
+	"github.com/pkg/errors"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/abi"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// the key in the abi registry ConfigMap containing the registry YAML
+	AbiRegistryConfigMapKey = "registry.yaml"
+)
+
+// reference to an optional ConfigMap extending the abi registry
+type AbiRegistryConfigMap struct {
+	Name      string
+	Namespace string
+}
+
+// LoadAbiRegistry returns abi.DefaultRegistry merged with the registry stored in the ConfigMap.
+// if no ConfigMap is configured or it does not exist, abi.DefaultRegistry is returned unmodified.
+func LoadAbiRegistry(kubeClient kubernetes.Interface, ref AbiRegistryConfigMap) (abi.Registry, error) {
+	if ref.Name == "" {
+		return abi.DefaultRegistry, nil
+	}
+	cm, err := kubeClient.CoreV1().ConfigMaps(ref.Namespace).Get(ref.Name, metav1.GetOptions{})
+	if err != nil {
+		if kubeerrors.IsNotFound(err) {
+			return abi.DefaultRegistry, nil
+		}
+		return nil, errors.Wrapf(err, "getting abi registry configmap %v.%v", ref.Name, ref.Namespace)
+	}
+	customRegistry, err := abi.ParseRegistry([]byte(cm.Data[AbiRegistryConfigMapKey]))
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing %v in abi registry configmap %v.%v", AbiRegistryConfigMapKey, ref.Name, ref.Namespace)
+	}
+	return abi.DefaultRegistry.Merge(customRegistry), nil
+}
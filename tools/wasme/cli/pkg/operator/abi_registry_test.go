@@ -0,0 +1,48 @@
+package operator
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/abi"
+	kubev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("LoadAbiRegistry", func() {
+	ref := AbiRegistryConfigMap{Name: "abi-registry", Namespace: "wasme"}
+
+	makeConfigMap := func(registry string) *kubev1.ConfigMap {
+		return &kubev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: ref.Name, Namespace: ref.Namespace},
+			Data:       map[string]string{AbiRegistryConfigMapKey: registry},
+		}
+	}
+
+	It("returns the default registry when the configmap does not exist", func() {
+		registry, err := LoadAbiRegistry(fake.NewSimpleClientset(), ref)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(registry).To(Equal(abi.DefaultRegistry))
+	})
+
+	It("merges the configmap into the default registry", func() {
+		kubeClient := fake.NewSimpleClientset(makeConfigMap(`
+v0-4689a30309abf31aee9ae36e73d34b1bb182685f:
+  istio: [1.9.x]
+`))
+		registry, err := LoadAbiRegistry(kubeClient, ref)
+		Expect(err).NotTo(HaveOccurred())
+		err = registry.ValidateIstioVersion([]string{abi.Version_4689a30309abf31aee9ae36e73d34b1bb182685f.Name}, "1.9.2")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("errors on a malformed registry", func() {
+		kubeClient := fake.NewSimpleClientset(makeConfigMap(`
+v0-4689a30309abf31aee9ae36e73d34b1bb182685f:
+  istio: 1.9.x
+`))
+		_, err := LoadAbiRegistry(kubeClient, ref)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("line 3"))
+	})
+})
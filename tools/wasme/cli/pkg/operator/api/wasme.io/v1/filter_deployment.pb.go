@@ -26,21 +26,35 @@ const _ = proto.GoGoProtoPackageIsVersion3 // please upgrade the proto package
 type WorkloadStatus_State int32
 
 const (
-	WorkloadStatus_Pending   WorkloadStatus_State = 0
+	// the filter has not been applied to the workload yet
+	WorkloadStatus_Pending WorkloadStatus_State = 0
+	// the filter was created for the workload
+	WorkloadStatus_FilterCreated WorkloadStatus_State = 1
+	// Deprecated: alias of FilterCreated
 	WorkloadStatus_Succeeded WorkloadStatus_State = 1
 	WorkloadStatus_Failed    WorkloadStatus_State = 2
+	// the filter was not applied, as the workload does not run the Istio sidecar
+	WorkloadStatus_Skipped WorkloadStatus_State = 3
+	// the workload was annotated for the filter, but the mesh-wide EnvoyFilter was not created
+	WorkloadStatus_AnnotationsApplied WorkloadStatus_State = 4
 )
 
 var WorkloadStatus_State_name = map[int32]string{
 	0: "Pending",
-	1: "Succeeded",
+	1: "FilterCreated",
+	// Duplicate value: 1: "Succeeded",
 	2: "Failed",
+	3: "Skipped",
+	4: "AnnotationsApplied",
 }
 
 var WorkloadStatus_State_value = map[string]int32{
-	"Pending":   0,
-	"Succeeded": 1,
-	"Failed":    2,
+	"Pending":            0,
+	"FilterCreated":      1,
+	"Succeeded":          1,
+	"Failed":             2,
+	"Skipped":            3,
+	"AnnotationsApplied": 4,
 }
 
 func (x WorkloadStatus_State) String() string {
@@ -48,7 +62,7 @@ func (x WorkloadStatus_State) String() string {
 }
 
 func (WorkloadStatus_State) EnumDescriptor() ([]byte, []int) {
-	return fileDescriptor_24d13e575ab7b28c, []int{6, 0}
+	return fileDescriptor_24d13e575ab7b28c, []int{11, 0}
 }
 
 // A FilterDeployment tells the Wasme Operator
@@ -126,6 +140,9 @@ type FilterSpec struct {
 	// the first time it must pull the image and inspect it
 	// second time it will cache it locally
 	// if the user provides
+	// the root id is independent of the id: it may be any string accepted by the proxy,
+	// while the id names the resources created for the filter.
+	// if the image does not declare a root id, defaults to the id
 	RootID string `protobuf:"bytes,4,opt,name=rootID,proto3" json:"rootID,omitempty"`
 	// custom options if pulling from private / custom repositories
 	ImagePullOptions *ImagePullOptions `protobuf:"bytes,5,opt,name=imagePullOptions,proto3" json:"imagePullOptions,omitempty"`
@@ -133,10 +150,54 @@ type FilterSpec struct {
 	// and workload type.
 	// defaults to `inbound`.
 	// See https://istio.io/latest/docs/reference/config/networking/envoy-filter/#EnvoyFilter-PatchContext for more details.
-	PatchContext         string   `protobuf:"bytes,6,opt,name=patchContext,proto3" json:"patchContext,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	PatchContext string `protobuf:"bytes,6,opt,name=patchContext,proto3" json:"patchContext,omitempty"`
+	// if true, wasme computes a sha256 checksum of the filter configuration
+	// and injects it into the configuration under the `__wasme_config_checksum` key,
+	// so the filter can verify the configuration it received.
+	// the configuration must be empty or a JSON object.
+	ConfigChecksum bool `protobuf:"varint,7,opt,name=configChecksum,proto3" json:"configChecksum,omitempty"`
+	// if true, skip the check that the filter's ABI versions
+	// are compatible with the installed version of Istio.
+	// use for experimental filters; has no effect for other providers.
+	IgnoreAbiCheck bool `protobuf:"varint,8,opt,name=ignoreAbiCheck,proto3" json:"ignoreAbiCheck,omitempty"`
+	// the id of another filter deployed by wasme to the same workloads.
+	// if set, this filter is inserted before the referenced filter in the HTTP filter chain,
+	// rather than before the router.
+	// requires Istio 1.7+; cannot be combined with orderAfter.
+	OrderBefore string `protobuf:"bytes,9,opt,name=orderBefore,proto3" json:"orderBefore,omitempty"`
+	// the id of another filter deployed by wasme to the same workloads.
+	// if set, this filter is inserted after the referenced filter in the HTTP filter chain,
+	// rather than before the router.
+	// requires Istio 1.7+; cannot be combined with orderBefore.
+	OrderAfter string `protobuf:"bytes,10,opt,name=orderAfter,proto3" json:"orderAfter,omitempty"`
+	// read the filter configuration from a key of a ConfigMap or Secret
+	// instead of the inline config, e.g. for large configurations or credentials.
+	// the contents of the key are passed to the filter as a string.
+	// the FilterDeployment is redeployed when a referenced ConfigMap changes.
+	// only supported by the Istio provider; cannot be combined with config.
+	ConfigFrom *ConfigSource `protobuf:"bytes,11,opt,name=configFrom,proto3" json:"configFrom,omitempty"`
+	// the type of filter chain the filter is inserted into.
+	// `http` filters are inserted into the HTTP filter chain, before the router.
+	// `network` filters are inserted into TCP filter chains, before the tcp_proxy filter;
+	// they cannot be ordered relative to other filters.
+	// only supported by the Istio provider.
+	// defaults to `http`.
+	FilterType string `protobuf:"bytes,12,opt,name=filterType,proto3" json:"filterType,omitempty"`
+	// verify the cosign signature attached to the image before the filter is deployed.
+	// the filter is not deployed unless a signature is valid for the digest the image resolves to.
+	// only supported by the Istio provider.
+	VerifySignature *SignatureVerification `protobuf:"bytes,13,opt,name=verifySignature,proto3" json:"verifySignature,omitempty"`
+	// if true, the proxy may use a precompiled version of the module embedded in the image,
+	// sets `allow_precompiled` on the VM configuration of the filter.
+	// not supported by the Gloo provider.
+	AllowPrecompiled bool `protobuf:"varint,14,opt,name=allowPrecompiled,proto3" json:"allowPrecompiled,omitempty"`
+	// environment variables exposed to the VM of the filter, which reads them through the proxy-wasm environment support.
+	// keys must be valid environment variable names; the `WASME_` prefix is reserved.
+	// requires Istio 1.7+; not supported by the Gloo provider.
+	Env                  map[string]string `protobuf:"bytes,15,rep,name=env,proto3" json:"env,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
 }
 
 func (m *FilterSpec) Reset()         { *m = FilterSpec{} }
@@ -205,6 +266,240 @@ func (m *FilterSpec) GetPatchContext() string {
 	return ""
 }
 
+func (m *FilterSpec) GetConfigChecksum() bool {
+	if m != nil {
+		return m.ConfigChecksum
+	}
+	return false
+}
+
+func (m *FilterSpec) GetIgnoreAbiCheck() bool {
+	if m != nil {
+		return m.IgnoreAbiCheck
+	}
+	return false
+}
+
+func (m *FilterSpec) GetOrderBefore() string {
+	if m != nil {
+		return m.OrderBefore
+	}
+	return ""
+}
+
+func (m *FilterSpec) GetOrderAfter() string {
+	if m != nil {
+		return m.OrderAfter
+	}
+	return ""
+}
+
+func (m *FilterSpec) GetConfigFrom() *ConfigSource {
+	if m != nil {
+		return m.ConfigFrom
+	}
+	return nil
+}
+
+func (m *FilterSpec) GetFilterType() string {
+	if m != nil {
+		return m.FilterType
+	}
+	return ""
+}
+
+func (m *FilterSpec) GetVerifySignature() *SignatureVerification {
+	if m != nil {
+		return m.VerifySignature
+	}
+	return nil
+}
+
+func (m *FilterSpec) GetAllowPrecompiled() bool {
+	if m != nil {
+		return m.AllowPrecompiled
+	}
+	return false
+}
+
+func (m *FilterSpec) GetEnv() map[string]string {
+	if m != nil {
+		return m.Env
+	}
+	return nil
+}
+
+// how to verify the cosign signatures of the filter image, which are pulled from the
+// `sha256-<digest>.sig` tag of the repository of the image.
+// at least one of publicKey or roots must be set
+type SignatureVerification struct {
+	// the PEM encoded public key of the signer, which verifies the signatures made with `cosign sign --key`
+	PublicKey string `protobuf:"bytes,1,opt,name=publicKey,proto3" json:"publicKey,omitempty"`
+	// the PEM encoded root certificates of a Fulcio instance, which verify keyless signatures
+	// whose certificate chains to one of the roots.
+	// the certificate is verified at the time it was issued; entries of the transparency log are not verified.
+	Roots string `protobuf:"bytes,2,opt,name=roots,proto3" json:"roots,omitempty"`
+	// annotations which must be set to these values on the signed payload, e.g. with `cosign sign -a`
+	Annotations          map[string]string `protobuf:"bytes,3,rep,name=annotations,proto3" json:"annotations,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *SignatureVerification) Reset()         { *m = SignatureVerification{} }
+func (m *SignatureVerification) String() string { return proto.CompactTextString(m) }
+func (*SignatureVerification) ProtoMessage()    {}
+func (*SignatureVerification) Descriptor() ([]byte, []int) {
+	return fileDescriptor_24d13e575ab7b28c, []int{2}
+}
+func (m *SignatureVerification) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SignatureVerification.Unmarshal(m, b)
+}
+func (m *SignatureVerification) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SignatureVerification.Marshal(b, m, deterministic)
+}
+func (m *SignatureVerification) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SignatureVerification.Merge(m, src)
+}
+func (m *SignatureVerification) XXX_Size() int {
+	return xxx_messageInfo_SignatureVerification.Size(m)
+}
+func (m *SignatureVerification) XXX_DiscardUnknown() {
+	xxx_messageInfo_SignatureVerification.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SignatureVerification proto.InternalMessageInfo
+
+func (m *SignatureVerification) GetPublicKey() string {
+	if m != nil {
+		return m.PublicKey
+	}
+	return ""
+}
+
+func (m *SignatureVerification) GetRoots() string {
+	if m != nil {
+		return m.Roots
+	}
+	return ""
+}
+
+func (m *SignatureVerification) GetAnnotations() map[string]string {
+	if m != nil {
+		return m.Annotations
+	}
+	return nil
+}
+
+// a reference to the filter configuration stored in a ConfigMap or Secret.
+// exactly one of configMapKeyRef or secretKeyRef must be set
+type ConfigSource struct {
+	// read the configuration from a key of a ConfigMap
+	ConfigMapKeyRef *KeyReference `protobuf:"bytes,1,opt,name=configMapKeyRef,proto3" json:"configMapKeyRef,omitempty"`
+	// read the configuration from a key of a Secret
+	SecretKeyRef         *KeyReference `protobuf:"bytes,2,opt,name=secretKeyRef,proto3" json:"secretKeyRef,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
+	XXX_unrecognized     []byte        `json:"-"`
+	XXX_sizecache        int32         `json:"-"`
+}
+
+func (m *ConfigSource) Reset()         { *m = ConfigSource{} }
+func (m *ConfigSource) String() string { return proto.CompactTextString(m) }
+func (*ConfigSource) ProtoMessage()    {}
+func (*ConfigSource) Descriptor() ([]byte, []int) {
+	return fileDescriptor_24d13e575ab7b28c, []int{3}
+}
+func (m *ConfigSource) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ConfigSource.Unmarshal(m, b)
+}
+func (m *ConfigSource) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ConfigSource.Marshal(b, m, deterministic)
+}
+func (m *ConfigSource) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ConfigSource.Merge(m, src)
+}
+func (m *ConfigSource) XXX_Size() int {
+	return xxx_messageInfo_ConfigSource.Size(m)
+}
+func (m *ConfigSource) XXX_DiscardUnknown() {
+	xxx_messageInfo_ConfigSource.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ConfigSource proto.InternalMessageInfo
+
+func (m *ConfigSource) GetConfigMapKeyRef() *KeyReference {
+	if m != nil {
+		return m.ConfigMapKeyRef
+	}
+	return nil
+}
+
+func (m *ConfigSource) GetSecretKeyRef() *KeyReference {
+	if m != nil {
+		return m.SecretKeyRef
+	}
+	return nil
+}
+
+// selects a key of a ConfigMap or Secret
+type KeyReference struct {
+	// the name of the ConfigMap or Secret
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// the key containing the configuration
+	Key string `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	// the namespace of the ConfigMap or Secret.
+	// defaults to the namespace of the target workloads
+	Namespace            string   `protobuf:"bytes,3,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *KeyReference) Reset()         { *m = KeyReference{} }
+func (m *KeyReference) String() string { return proto.CompactTextString(m) }
+func (*KeyReference) ProtoMessage()    {}
+func (*KeyReference) Descriptor() ([]byte, []int) {
+	return fileDescriptor_24d13e575ab7b28c, []int{4}
+}
+func (m *KeyReference) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_KeyReference.Unmarshal(m, b)
+}
+func (m *KeyReference) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_KeyReference.Marshal(b, m, deterministic)
+}
+func (m *KeyReference) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_KeyReference.Merge(m, src)
+}
+func (m *KeyReference) XXX_Size() int {
+	return xxx_messageInfo_KeyReference.Size(m)
+}
+func (m *KeyReference) XXX_DiscardUnknown() {
+	xxx_messageInfo_KeyReference.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_KeyReference proto.InternalMessageInfo
+
+func (m *KeyReference) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *KeyReference) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *KeyReference) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
 type ImagePullOptions struct {
 	// if a username/password is required,
 	// specify here the name of a secret:
@@ -228,7 +523,7 @@ func (m *ImagePullOptions) Reset()         { *m = ImagePullOptions{} }
 func (m *ImagePullOptions) String() string { return proto.CompactTextString(m) }
 func (*ImagePullOptions) ProtoMessage()    {}
 func (*ImagePullOptions) Descriptor() ([]byte, []int) {
-	return fileDescriptor_24d13e575ab7b28c, []int{2}
+	return fileDescriptor_24d13e575ab7b28c, []int{5}
 }
 func (m *ImagePullOptions) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ImagePullOptions.Unmarshal(m, b)
@@ -273,6 +568,7 @@ func (m *ImagePullOptions) GetPlainHttp() bool {
 type DeploymentSpec struct {
 	// Types that are valid to be assigned to DeploymentType:
 	//	*DeploymentSpec_Istio
+	//	*DeploymentSpec_Gloo
 	DeploymentType       isDeploymentSpec_DeploymentType `protobuf_oneof:"deploymentType"`
 	XXX_NoUnkeyedLiteral struct{}                        `json:"-"`
 	XXX_unrecognized     []byte                          `json:"-"`
@@ -283,7 +579,7 @@ func (m *DeploymentSpec) Reset()         { *m = DeploymentSpec{} }
 func (m *DeploymentSpec) String() string { return proto.CompactTextString(m) }
 func (*DeploymentSpec) ProtoMessage()    {}
 func (*DeploymentSpec) Descriptor() ([]byte, []int) {
-	return fileDescriptor_24d13e575ab7b28c, []int{3}
+	return fileDescriptor_24d13e575ab7b28c, []int{6}
 }
 func (m *DeploymentSpec) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_DeploymentSpec.Unmarshal(m, b)
@@ -310,8 +606,12 @@ type isDeploymentSpec_DeploymentType interface {
 type DeploymentSpec_Istio struct {
 	Istio *IstioDeploymentSpec `protobuf:"bytes,2,opt,name=istio,proto3,oneof" json:"istio,omitempty"`
 }
+type DeploymentSpec_Gloo struct {
+	Gloo *GlooDeploymentSpec `protobuf:"bytes,3,opt,name=gloo,proto3,oneof" json:"gloo,omitempty"`
+}
 
 func (*DeploymentSpec_Istio) isDeploymentSpec_DeploymentType() {}
+func (*DeploymentSpec_Gloo) isDeploymentSpec_DeploymentType()  {}
 
 func (m *DeploymentSpec) GetDeploymentType() isDeploymentSpec_DeploymentType {
 	if m != nil {
@@ -327,17 +627,25 @@ func (m *DeploymentSpec) GetIstio() *IstioDeploymentSpec {
 	return nil
 }
 
+func (m *DeploymentSpec) GetGloo() *GlooDeploymentSpec {
+	if x, ok := m.GetDeploymentType().(*DeploymentSpec_Gloo); ok {
+		return x.Gloo
+	}
+	return nil
+}
+
 // XXX_OneofWrappers is for the internal use of the proto package.
 func (*DeploymentSpec) XXX_OneofWrappers() []interface{} {
 	return []interface{}{
 		(*DeploymentSpec_Istio)(nil),
+		(*DeploymentSpec_Gloo)(nil),
 	}
 }
 
 // how to deploy to Istio
 type IstioDeploymentSpec struct {
 	// the kind of workload to deploy the filter to
-	// can either be Deployment, DaemonSet or Statefulset
+	// can either be Deployment, DaemonSet, StatefulSet or DeploymentConfig (OpenShift)
 	Kind string `protobuf:"bytes,1,opt,name=kind,proto3" json:"kind,omitempty"`
 	// deploy the filter to workloads with these labels
 	// the workload must live in the same namespace as the FilterDeployment
@@ -345,17 +653,55 @@ type IstioDeploymentSpec struct {
 	Labels map[string]string `protobuf:"bytes,2,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
 	// the namespace where the Istio control plane is installed.
 	// defaults to `istio-system`.
-	IstioNamespace       string   `protobuf:"bytes,3,opt,name=istioNamespace,proto3" json:"istioNamespace,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	IstioNamespace string `protobuf:"bytes,3,opt,name=istioNamespace,proto3" json:"istioNamespace,omitempty"`
+	// the revision of the Istio control plane used to check abi compatibility,
+	// matched against the `istio.io/rev` label on istiod.
+	// if empty and multiple revisions are installed, the revision is read
+	// from the labels on the FilterDeployment namespace.
+	IstioRevision string `protobuf:"bytes,4,opt,name=istioRevision,proto3" json:"istioRevision,omitempty"`
+	// by default, the created EnvoyFilters only match proxies running a version of Istio
+	// which supports the abi versions of the filter image.
+	// set to true to apply the filter to proxies of any version.
+	DisableProxyVersionMatch bool `protobuf:"varint,5,opt,name=disableProxyVersionMatch,proto3" json:"disableProxyVersionMatch,omitempty"`
+	// if true, a single EnvoyFilter without a workload selector is created in the istioNamespace,
+	// applying the filter to every proxy in the mesh.
+	// the selected workloads are still annotated to mount the filter cache;
+	// proxies which do not mount the cache will reject the filter.
+	MeshWide bool `protobuf:"varint,6,opt,name=meshWide,proto3" json:"meshWide,omitempty"`
+	// the order in which the filter is applied to the selected workloads:
+	// `name` (default), `replicas` (fewest replicas first),
+	// or `label:<label key>` (ascending integer value of the label, unlabeled workloads last).
+	// the filter is removed from the workloads in the reverse order.
+	WorkloadOrder string `protobuf:"bytes,7,opt,name=workloadOrder,proto3" json:"workloadOrder,omitempty"`
+	// by default, workloads which do not run the Istio sidecar are skipped, as the filter
+	// cannot take effect on them. a workload runs the sidecar if its namespace is labeled with
+	// `istio-injection=enabled` or `istio.io/rev`, or its pod template sets `sidecar.istio.io/inject: "true"`.
+	// set to true to apply the filter to every selected workload, e.g. if injection is enabled later.
+	IncludeUninjected bool `protobuf:"varint,8,opt,name=includeUninjected,proto3" json:"includeUninjected,omitempty"`
+	// if set, used verbatim as the workload selector of the EnvoyFilter created for each selected workload,
+	// so it should only match the pods of a single workload.
+	// by default, the pod template labels of each workload are used, without the labels which change between
+	// rollouts such as `pod-template-hash`.
+	SelectorLabels map[string]string `protobuf:"bytes,9,rep,name=selectorLabels,proto3" json:"selectorLabels,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	// if true, the proxies fetch the filter from the wasme cache service over HTTP,
+	// and reject it unless it matches the sha256 digest of the image.
+	// the workloads are not annotated to mount the cache directory, so no hostPath volumes are required,
+	// and meshWide filters take effect on every proxy.
+	RemoteDatasource bool `protobuf:"varint,10,opt,name=remoteDatasource,proto3" json:"remoteDatasource,omitempty"`
+	// deploy the filter to each of these targets, rather than to the workloads with the labels.
+	// if set, labels is ignored, and kind is the default kind of the targets.
+	// removing a target removes the filter from the workloads it selected
+	Targets              []*WorkloadTarget `protobuf:"bytes,11,rep,name=targets,proto3" json:"targets,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
 }
 
 func (m *IstioDeploymentSpec) Reset()         { *m = IstioDeploymentSpec{} }
 func (m *IstioDeploymentSpec) String() string { return proto.CompactTextString(m) }
 func (*IstioDeploymentSpec) ProtoMessage()    {}
 func (*IstioDeploymentSpec) Descriptor() ([]byte, []int) {
-	return fileDescriptor_24d13e575ab7b28c, []int{4}
+	return fileDescriptor_24d13e575ab7b28c, []int{7}
 }
 func (m *IstioDeploymentSpec) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_IstioDeploymentSpec.Unmarshal(m, b)
@@ -396,24 +742,217 @@ func (m *IstioDeploymentSpec) GetIstioNamespace() string {
 	return ""
 }
 
+func (m *IstioDeploymentSpec) GetIstioRevision() string {
+	if m != nil {
+		return m.IstioRevision
+	}
+	return ""
+}
+
+func (m *IstioDeploymentSpec) GetDisableProxyVersionMatch() bool {
+	if m != nil {
+		return m.DisableProxyVersionMatch
+	}
+	return false
+}
+
+func (m *IstioDeploymentSpec) GetMeshWide() bool {
+	if m != nil {
+		return m.MeshWide
+	}
+	return false
+}
+
+func (m *IstioDeploymentSpec) GetWorkloadOrder() string {
+	if m != nil {
+		return m.WorkloadOrder
+	}
+	return ""
+}
+
+func (m *IstioDeploymentSpec) GetIncludeUninjected() bool {
+	if m != nil {
+		return m.IncludeUninjected
+	}
+	return false
+}
+
+func (m *IstioDeploymentSpec) GetSelectorLabels() map[string]string {
+	if m != nil {
+		return m.SelectorLabels
+	}
+	return nil
+}
+
+func (m *IstioDeploymentSpec) GetRemoteDatasource() bool {
+	if m != nil {
+		return m.RemoteDatasource
+	}
+	return false
+}
+
+func (m *IstioDeploymentSpec) GetTargets() []*WorkloadTarget {
+	if m != nil {
+		return m.Targets
+	}
+	return nil
+}
+
+// selects the workloads of a target of an Istio deployment
+type WorkloadTarget struct {
+	// the kind of the target workloads, see IstioDeploymentSpec.kind.
+	// defaults to the kind of the IstioDeploymentSpec
+	Kind string `protobuf:"bytes,1,opt,name=kind,proto3" json:"kind,omitempty"`
+	// select the workloads with these labels.
+	// if empty, every workload of the kind in the namespace is selected
+	Labels map[string]string `protobuf:"bytes,2,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	// if set, only the workload with this name is selected
+	Name string `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	// the namespace of the target workloads.
+	// defaults to the namespace of the FilterDeployment.
+	// the EnvoyFilters created in other namespaces are not owned by the FilterDeployment,
+	// they are deleted when the filter is removed
+	Namespace            string   `protobuf:"bytes,4,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *WorkloadTarget) Reset()         { *m = WorkloadTarget{} }
+func (m *WorkloadTarget) String() string { return proto.CompactTextString(m) }
+func (*WorkloadTarget) ProtoMessage()    {}
+func (*WorkloadTarget) Descriptor() ([]byte, []int) {
+	return fileDescriptor_24d13e575ab7b28c, []int{8}
+}
+func (m *WorkloadTarget) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_WorkloadTarget.Unmarshal(m, b)
+}
+func (m *WorkloadTarget) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_WorkloadTarget.Marshal(b, m, deterministic)
+}
+func (m *WorkloadTarget) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_WorkloadTarget.Merge(m, src)
+}
+func (m *WorkloadTarget) XXX_Size() int {
+	return xxx_messageInfo_WorkloadTarget.Size(m)
+}
+func (m *WorkloadTarget) XXX_DiscardUnknown() {
+	xxx_messageInfo_WorkloadTarget.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_WorkloadTarget proto.InternalMessageInfo
+
+func (m *WorkloadTarget) GetKind() string {
+	if m != nil {
+		return m.Kind
+	}
+	return ""
+}
+
+func (m *WorkloadTarget) GetLabels() map[string]string {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
+func (m *WorkloadTarget) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *WorkloadTarget) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+// how to deploy to Gloo.
+// the filter is added to the httpGateway of the selected Gateway resources
+type GlooDeploymentSpec struct {
+	// the namespaces of the Gateways to deploy the filter to.
+	// if empty, the Gateways of every namespace are selected
+	Namespaces []string `protobuf:"bytes,1,rep,name=namespaces,proto3" json:"namespaces,omitempty"`
+	// deploy the filter to the Gateways with these labels.
+	// if empty, every Gateway in the namespaces is selected
+	GatewayLabels        map[string]string `protobuf:"bytes,2,rep,name=gatewayLabels,proto3" json:"gatewayLabels,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *GlooDeploymentSpec) Reset()         { *m = GlooDeploymentSpec{} }
+func (m *GlooDeploymentSpec) String() string { return proto.CompactTextString(m) }
+func (*GlooDeploymentSpec) ProtoMessage()    {}
+func (*GlooDeploymentSpec) Descriptor() ([]byte, []int) {
+	return fileDescriptor_24d13e575ab7b28c, []int{9}
+}
+func (m *GlooDeploymentSpec) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GlooDeploymentSpec.Unmarshal(m, b)
+}
+func (m *GlooDeploymentSpec) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GlooDeploymentSpec.Marshal(b, m, deterministic)
+}
+func (m *GlooDeploymentSpec) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GlooDeploymentSpec.Merge(m, src)
+}
+func (m *GlooDeploymentSpec) XXX_Size() int {
+	return xxx_messageInfo_GlooDeploymentSpec.Size(m)
+}
+func (m *GlooDeploymentSpec) XXX_DiscardUnknown() {
+	xxx_messageInfo_GlooDeploymentSpec.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GlooDeploymentSpec proto.InternalMessageInfo
+
+func (m *GlooDeploymentSpec) GetNamespaces() []string {
+	if m != nil {
+		return m.Namespaces
+	}
+	return nil
+}
+
+func (m *GlooDeploymentSpec) GetGatewayLabels() map[string]string {
+	if m != nil {
+		return m.GatewayLabels
+	}
+	return nil
+}
+
 // the current status of the deployment
 type FilterDeploymentStatus struct {
 	// the observed generation of the FilterDeployment
 	ObservedGeneration int64 `protobuf:"varint,1,opt,name=observedGeneration,proto3" json:"observedGeneration,omitempty"`
 	// for each workload, was the deployment successful?
+	// Deprecated: use workloadStatuses, which also lists the workloads the filter is pending for
 	Workloads map[string]*WorkloadStatus `protobuf:"bytes,2,rep,name=workloads,proto3" json:"workloads,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
 	// a human-readable string explaining the error, if any
-	Reason               string   `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	Reason string `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+	// the checksum of the deployed filter configuration,
+	// set if spec.filter.configChecksum is true
+	ConfigHash string `protobuf:"bytes,4,opt,name=configHash,proto3" json:"configHash,omitempty"`
+	// the status of each workload selected by the deployment,
+	// in the order the filter is applied to them.
+	// written even if the filter could only be applied to some of the workloads
+	WorkloadStatuses []*WorkloadStatus `protobuf:"bytes,5,rep,name=workloadStatuses,proto3" json:"workloadStatuses,omitempty"`
+	// the number of workloads the filter was created for, out of the selected workloads
+	// the filter can take effect on, e.g. 2/3. skipped workloads are not counted
+	Ready string `protobuf:"bytes,6,opt,name=ready,proto3" json:"ready,omitempty"`
+	// the conditions of the deployment: Ready, CacheReady and AbiCompatible
+	Conditions           []*Condition `protobuf:"bytes,7,rep,name=conditions,proto3" json:"conditions,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
+	XXX_unrecognized     []byte       `json:"-"`
+	XXX_sizecache        int32        `json:"-"`
 }
 
 func (m *FilterDeploymentStatus) Reset()         { *m = FilterDeploymentStatus{} }
 func (m *FilterDeploymentStatus) String() string { return proto.CompactTextString(m) }
 func (*FilterDeploymentStatus) ProtoMessage()    {}
 func (*FilterDeploymentStatus) Descriptor() ([]byte, []int) {
-	return fileDescriptor_24d13e575ab7b28c, []int{5}
+	return fileDescriptor_24d13e575ab7b28c, []int{10}
 }
 func (m *FilterDeploymentStatus) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_FilterDeploymentStatus.Unmarshal(m, b)
@@ -454,10 +993,54 @@ func (m *FilterDeploymentStatus) GetReason() string {
 	return ""
 }
 
+func (m *FilterDeploymentStatus) GetConfigHash() string {
+	if m != nil {
+		return m.ConfigHash
+	}
+	return ""
+}
+
+func (m *FilterDeploymentStatus) GetWorkloadStatuses() []*WorkloadStatus {
+	if m != nil {
+		return m.WorkloadStatuses
+	}
+	return nil
+}
+
+func (m *FilterDeploymentStatus) GetReady() string {
+	if m != nil {
+		return m.Ready
+	}
+	return ""
+}
+
+func (m *FilterDeploymentStatus) GetConditions() []*Condition {
+	if m != nil {
+		return m.Conditions
+	}
+	return nil
+}
+
 type WorkloadStatus struct {
 	State WorkloadStatus_State `protobuf:"varint,1,opt,name=state,proto3,enum=wasme.io.WorkloadStatus_State" json:"state,omitempty"`
 	// a human-readable string explaining the error, if any
-	Reason               string   `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
+	// Deprecated: use message
+	Reason string `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
+	// the name of the workload
+	Name string `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	// the namespace of the workload
+	Namespace string `protobuf:"bytes,4,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	// a human-readable string explaining the state, if any
+	Message string `protobuf:"bytes,5,opt,name=message,proto3" json:"message,omitempty"`
+	// the generation of the FilterDeployment the state was observed for
+	ObservedGeneration int64 `protobuf:"varint,6,opt,name=observedGeneration,proto3" json:"observedGeneration,omitempty"`
+	// the target which selected the workload, with the defaults of the deployment applied
+	Target *WorkloadTarget `protobuf:"bytes,7,opt,name=target,proto3" json:"target,omitempty"`
+	// true if the filter was updated without updating the workload, so its pods were not restarted:
+	// only the config or image digest of the filter changed, so only its EnvoyFilter was updated
+	RestartSkipped bool `protobuf:"varint,8,opt,name=restartSkipped,proto3" json:"restartSkipped,omitempty"`
+	// the hash of the filter spec the EnvoyFilter of the workload was updated to, set with restartSkipped
+	ConfigHash           string   `protobuf:"bytes,9,opt,name=configHash,proto3" json:"configHash,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -467,7 +1050,7 @@ func (m *WorkloadStatus) Reset()         { *m = WorkloadStatus{} }
 func (m *WorkloadStatus) String() string { return proto.CompactTextString(m) }
 func (*WorkloadStatus) ProtoMessage()    {}
 func (*WorkloadStatus) Descriptor() ([]byte, []int) {
-	return fileDescriptor_24d13e575ab7b28c, []int{6}
+	return fileDescriptor_24d13e575ab7b28c, []int{11}
 }
 func (m *WorkloadStatus) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_WorkloadStatus.Unmarshal(m, b)
@@ -501,17 +1084,153 @@ func (m *WorkloadStatus) GetReason() string {
 	return ""
 }
 
+func (m *WorkloadStatus) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *WorkloadStatus) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+func (m *WorkloadStatus) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+func (m *WorkloadStatus) GetObservedGeneration() int64 {
+	if m != nil {
+		return m.ObservedGeneration
+	}
+	return 0
+}
+
+func (m *WorkloadStatus) GetTarget() *WorkloadTarget {
+	if m != nil {
+		return m.Target
+	}
+	return nil
+}
+
+func (m *WorkloadStatus) GetRestartSkipped() bool {
+	if m != nil {
+		return m.RestartSkipped
+	}
+	return false
+}
+
+func (m *WorkloadStatus) GetConfigHash() string {
+	if m != nil {
+		return m.ConfigHash
+	}
+	return ""
+}
+
+// a condition of the FilterDeployment
+type Condition struct {
+	// the type of the condition: Ready, CacheReady or AbiCompatible
+	Type string `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	// the status of the condition: True, False or Unknown
+	Status string `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	// a CamelCase reason for the status of the condition
+	Reason string `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+	// a human-readable string explaining the status of the condition
+	Message string `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`
+	// the generation of the FilterDeployment the condition was observed for
+	ObservedGeneration   int64    `protobuf:"varint,5,opt,name=observedGeneration,proto3" json:"observedGeneration,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Condition) Reset()         { *m = Condition{} }
+func (m *Condition) String() string { return proto.CompactTextString(m) }
+func (*Condition) ProtoMessage()    {}
+func (*Condition) Descriptor() ([]byte, []int) {
+	return fileDescriptor_24d13e575ab7b28c, []int{12}
+}
+func (m *Condition) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Condition.Unmarshal(m, b)
+}
+func (m *Condition) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Condition.Marshal(b, m, deterministic)
+}
+func (m *Condition) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Condition.Merge(m, src)
+}
+func (m *Condition) XXX_Size() int {
+	return xxx_messageInfo_Condition.Size(m)
+}
+func (m *Condition) XXX_DiscardUnknown() {
+	xxx_messageInfo_Condition.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Condition proto.InternalMessageInfo
+
+func (m *Condition) GetType() string {
+	if m != nil {
+		return m.Type
+	}
+	return ""
+}
+
+func (m *Condition) GetStatus() string {
+	if m != nil {
+		return m.Status
+	}
+	return ""
+}
+
+func (m *Condition) GetReason() string {
+	if m != nil {
+		return m.Reason
+	}
+	return ""
+}
+
+func (m *Condition) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+func (m *Condition) GetObservedGeneration() int64 {
+	if m != nil {
+		return m.ObservedGeneration
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterEnum("wasme.io.WorkloadStatus_State", WorkloadStatus_State_name, WorkloadStatus_State_value)
 	proto.RegisterType((*FilterDeploymentSpec)(nil), "wasme.io.FilterDeploymentSpec")
 	proto.RegisterType((*FilterSpec)(nil), "wasme.io.FilterSpec")
+	proto.RegisterMapType((map[string]string)(nil), "wasme.io.FilterSpec.EnvEntry")
+	proto.RegisterType((*SignatureVerification)(nil), "wasme.io.SignatureVerification")
+	proto.RegisterMapType((map[string]string)(nil), "wasme.io.SignatureVerification.AnnotationsEntry")
+	proto.RegisterType((*ConfigSource)(nil), "wasme.io.ConfigSource")
+	proto.RegisterType((*KeyReference)(nil), "wasme.io.KeyReference")
 	proto.RegisterType((*ImagePullOptions)(nil), "wasme.io.ImagePullOptions")
 	proto.RegisterType((*DeploymentSpec)(nil), "wasme.io.DeploymentSpec")
 	proto.RegisterType((*IstioDeploymentSpec)(nil), "wasme.io.IstioDeploymentSpec")
 	proto.RegisterMapType((map[string]string)(nil), "wasme.io.IstioDeploymentSpec.LabelsEntry")
+	proto.RegisterMapType((map[string]string)(nil), "wasme.io.IstioDeploymentSpec.SelectorLabelsEntry")
+	proto.RegisterType((*WorkloadTarget)(nil), "wasme.io.WorkloadTarget")
+	proto.RegisterMapType((map[string]string)(nil), "wasme.io.WorkloadTarget.LabelsEntry")
+	proto.RegisterType((*GlooDeploymentSpec)(nil), "wasme.io.GlooDeploymentSpec")
+	proto.RegisterMapType((map[string]string)(nil), "wasme.io.GlooDeploymentSpec.GatewayLabelsEntry")
 	proto.RegisterType((*FilterDeploymentStatus)(nil), "wasme.io.FilterDeploymentStatus")
 	proto.RegisterMapType((map[string]*WorkloadStatus)(nil), "wasme.io.FilterDeploymentStatus.WorkloadsEntry")
 	proto.RegisterType((*WorkloadStatus)(nil), "wasme.io.WorkloadStatus")
+	proto.RegisterType((*Condition)(nil), "wasme.io.Condition")
 }
 
 func init() {
@@ -519,47 +1238,94 @@ func init() {
 }
 
 var fileDescriptor_24d13e575ab7b28c = []byte{
-	// 660 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x54, 0x5d, 0x6f, 0xd3, 0x30,
-	0x14, 0x5d, 0xd2, 0xb5, 0xac, 0xb7, 0x50, 0x55, 0x66, 0x9a, 0x42, 0x05, 0xd3, 0x94, 0x07, 0x34,
-	0x24, 0x48, 0xb4, 0x01, 0xd2, 0xe0, 0x6d, 0x63, 0x94, 0x4d, 0xe2, 0x63, 0x4a, 0x61, 0x08, 0x5e,
-	0x90, 0x9b, 0xdc, 0x76, 0x56, 0x5d, 0xdb, 0x4a, 0x9c, 0x8e, 0xbe, 0x20, 0xde, 0x78, 0xe4, 0xa7,
-	0xf1, 0x27, 0xf8, 0x21, 0x28, 0x4e, 0xba, 0xa4, 0x5d, 0x41, 0x3c, 0xc5, 0xbe, 0x39, 0xe7, 0xdc,
-	0x7b, 0x7c, 0x7d, 0x0d, 0x1f, 0x46, 0x4c, 0x5f, 0xa4, 0x03, 0x2f, 0x94, 0x13, 0x3f, 0x91, 0x5c,
-	0x3e, 0x62, 0xd2, 0xbf, 0xa4, 0xc9, 0xc4, 0xd7, 0x52, 0xf2, 0xc4, 0x2c, 0xd1, 0x0f, 0x39, 0xf3,
-	0xa5, 0xc2, 0x98, 0x6a, 0x19, 0xfb, 0x54, 0xb1, 0x22, 0x3c, 0xdd, 0xf3, 0x87, 0x8c, 0x6b, 0x8c,
-	0xbf, 0x44, 0xa8, 0xb8, 0x9c, 0x4d, 0x50, 0x68, 0x4f, 0xc5, 0x52, 0x4b, 0xb2, 0x61, 0x10, 0x1e,
-	0x93, 0xdd, 0x3b, 0x23, 0x29, 0x47, 0x1c, 0x7d, 0x13, 0x1f, 0xa4, 0x43, 0x9f, 0x8a, 0x59, 0x0e,
-	0x72, 0xbf, 0xc1, 0x66, 0xcf, 0xf0, 0x8f, 0xaf, 0xe8, 0x7d, 0x85, 0x21, 0x79, 0x08, 0x8d, 0x5c,
-	0xd7, 0xb1, 0x76, 0xac, 0xdd, 0xd6, 0xfe, 0xa6, 0x37, 0x57, 0xf3, 0x72, 0x7c, 0x86, 0x0a, 0x0a,
-	0x0c, 0x39, 0x00, 0x28, 0xd3, 0x3b, 0xb6, 0x61, 0x38, 0x25, 0x63, 0x51, 0x3b, 0xa8, 0x60, 0xdd,
-	0xdf, 0x16, 0x40, 0x29, 0x48, 0xda, 0x60, 0xb3, 0xc8, 0xa4, 0x6c, 0x06, 0x36, 0x8b, 0xc8, 0x26,
-	0xd4, 0xd9, 0x84, 0x8e, 0xd0, 0x68, 0x36, 0x83, 0x7c, 0x93, 0x15, 0x17, 0x4a, 0x31, 0x64, 0x23,
-	0xa7, 0x56, 0x14, 0x97, 0x1b, 0xf4, 0xe6, 0x06, 0xbd, 0x43, 0x31, 0x0b, 0x0a, 0x0c, 0xd9, 0x82,
-	0x46, 0x2c, 0xa5, 0x3e, 0x3d, 0x76, 0xd6, 0x8d, 0x48, 0xb1, 0x23, 0x3d, 0xe8, 0x18, 0xb9, 0xb3,
-	0x94, 0xf3, 0x77, 0x4a, 0x33, 0x29, 0x12, 0xa7, 0x6e, 0xf4, 0xba, 0x65, 0xe9, 0xa7, 0x4b, 0x88,
-	0xe0, 0x1a, 0x87, 0xb8, 0x70, 0x53, 0x51, 0x1d, 0x5e, 0xbc, 0x90, 0x42, 0xe3, 0x57, 0xed, 0x34,
-	0x4c, 0x96, 0x85, 0x98, 0xfb, 0xdd, 0x82, 0xce, 0xb2, 0x14, 0xd9, 0x06, 0x50, 0x29, 0xe7, 0x7d,
-	0x0c, 0x63, 0xd4, 0x85, 0xe9, 0x4a, 0x84, 0x78, 0x40, 0x98, 0x48, 0x30, 0x4c, 0x63, 0xec, 0x8f,
-	0x99, 0x3a, 0xc7, 0x98, 0x0d, 0x67, 0xe6, 0x24, 0x36, 0x82, 0x15, 0x7f, 0xc8, 0x5d, 0x68, 0x2a,
-	0x4e, 0x99, 0x38, 0xd1, 0x5a, 0x99, 0x93, 0xd9, 0x08, 0xca, 0x80, 0xfb, 0x09, 0xda, 0x4b, 0x3d,
-	0x7e, 0x0a, 0x75, 0x96, 0x68, 0x26, 0x8b, 0x86, 0xdd, 0xab, 0xb8, 0xce, 0xc2, 0x8b, 0xe8, 0x93,
-	0xb5, 0x20, 0x47, 0x1f, 0x75, 0xa0, 0x5d, 0x36, 0xf0, 0xfd, 0x4c, 0xa1, 0xfb, 0xcb, 0x82, 0xdb,
-	0x2b, 0x28, 0x84, 0xc0, 0xfa, 0x98, 0x89, 0x79, 0x3f, 0xcd, 0x9a, 0x1c, 0x42, 0x83, 0xd3, 0x01,
-	0xf2, 0xc4, 0xb1, 0x77, 0x6a, 0xbb, 0xad, 0xfd, 0x07, 0xff, 0xcc, 0xea, 0xbd, 0x36, 0xd8, 0x97,
-	0x42, 0xc7, 0xb3, 0xa0, 0x20, 0x92, 0xfb, 0xd0, 0x36, 0x95, 0xbc, 0xa5, 0x13, 0x4c, 0x14, 0x0d,
-	0xd1, 0x98, 0x6d, 0x06, 0x4b, 0xd1, 0xee, 0x33, 0x68, 0x55, 0xe8, 0xa4, 0x03, 0xb5, 0x31, 0xce,
-	0x8a, 0x62, 0xb2, 0x65, 0x76, 0xbb, 0xa6, 0x94, 0xa7, 0x57, 0xb7, 0xcb, 0x6c, 0x9e, 0xdb, 0x07,
-	0x96, 0xfb, 0xc3, 0x86, 0xad, 0x6b, 0x73, 0xa1, 0xa9, 0x4e, 0x93, 0xac, 0x2b, 0x72, 0x90, 0x60,
-	0x3c, 0xc5, 0xe8, 0x15, 0x8a, 0x6c, 0x20, 0x99, 0x14, 0x46, 0xb5, 0x16, 0xac, 0xf8, 0x43, 0xde,
-	0x40, 0xf3, 0x52, 0xc6, 0x63, 0x2e, 0x69, 0x34, 0xf7, 0xec, 0x2f, 0x0f, 0xd3, 0x72, 0x12, 0xef,
-	0xe3, 0x9c, 0x91, 0x3b, 0x2f, 0x15, 0xcc, 0x6d, 0x46, 0x9a, 0x48, 0x51, 0x98, 0x2e, 0x76, 0xdd,
-	0x73, 0x68, 0x2f, 0x92, 0x56, 0xf8, 0xf5, 0xaa, 0x7e, 0x17, 0x26, 0x74, 0x4e, 0xcd, 0xd3, 0x57,
-	0x4f, 0xe2, 0xa7, 0x55, 0x0a, 0x17, 0x27, 0xf0, 0x04, 0xea, 0x89, 0xa6, 0x1a, 0x8d, 0x74, 0x7b,
-	0x7f, 0xfb, 0x6f, 0x32, 0x5e, 0xf6, 0xc1, 0x20, 0x07, 0x57, 0x0a, 0xb7, 0xab, 0x85, 0xbb, 0x3e,
-	0xd4, 0x0d, 0x8e, 0xb4, 0xe0, 0xc6, 0x19, 0x8a, 0x88, 0x89, 0x51, 0x67, 0x8d, 0xdc, 0x82, 0x66,
-	0x3f, 0x0d, 0x43, 0xc4, 0x08, 0xa3, 0x8e, 0x45, 0x00, 0x1a, 0x3d, 0xca, 0x38, 0x46, 0x1d, 0xfb,
-	0xa8, 0xf7, 0xf9, 0xf8, 0x7f, 0x1f, 0x4c, 0x35, 0x1e, 0xad, 0x78, 0x34, 0x3d, 0x26, 0xfd, 0xe9,
-	0xde, 0xa0, 0x61, 0x5e, 0x8b, 0xc7, 0x7f, 0x02, 0x00, 0x00, 0xff, 0xff, 0x2c, 0x58, 0x44, 0xc3,
-	0x7f, 0x05, 0x00, 0x00,
+	// 1415 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x57, 0xdd, 0x6e, 0x1b, 0x37,
+	0x16, 0xce, 0x48, 0x96, 0x2c, 0x1d, 0xd9, 0x8a, 0xc2, 0x64, 0x8d, 0x59, 0x21, 0x9b, 0x35, 0x84,
+	0x60, 0x91, 0x5d, 0x64, 0x47, 0x89, 0xb3, 0x1b, 0x64, 0x83, 0xc5, 0x22, 0x8e, 0x1d, 0x27, 0x46,
+	0x92, 0x8d, 0x41, 0xe7, 0x07, 0xed, 0x4d, 0x41, 0xcd, 0x1c, 0xcb, 0xac, 0x47, 0xc3, 0x01, 0x87,
+	0x92, 0xa3, 0x9b, 0xa2, 0x0f, 0xd0, 0x3e, 0x40, 0xaf, 0xfa, 0x06, 0xbd, 0xee, 0x6d, 0x1f, 0xa0,
+	0xe8, 0x23, 0xf4, 0x55, 0x0a, 0x92, 0x23, 0xcd, 0x8f, 0x24, 0x37, 0x46, 0xaf, 0x34, 0xfc, 0xf8,
+	0x9d, 0x43, 0x9e, 0x1f, 0x7e, 0xa4, 0xe0, 0xdd, 0x90, 0xab, 0xd3, 0xf1, 0xc0, 0xf3, 0xc5, 0xa8,
+	0x9f, 0x88, 0x50, 0xfc, 0x93, 0x8b, 0xfe, 0x39, 0x4b, 0x46, 0x7d, 0x25, 0x44, 0x98, 0x98, 0x4f,
+	0xec, 0xfb, 0x21, 0xef, 0x8b, 0x18, 0x25, 0x53, 0x42, 0xf6, 0x59, 0xcc, 0x53, 0x78, 0x72, 0xbf,
+	0x7f, 0xc2, 0x43, 0x85, 0xf2, 0x8b, 0x00, 0xe3, 0x50, 0x4c, 0x47, 0x18, 0x29, 0x2f, 0x96, 0x42,
+	0x09, 0xd2, 0x30, 0x0c, 0x8f, 0x8b, 0xee, 0x9f, 0x87, 0x42, 0x0c, 0x43, 0xec, 0x1b, 0x7c, 0x30,
+	0x3e, 0xe9, 0xb3, 0x68, 0x6a, 0x49, 0xbd, 0xaf, 0xe0, 0xc6, 0x81, 0xb1, 0xdf, 0x9f, 0x9b, 0x1f,
+	0xc7, 0xe8, 0x93, 0xbb, 0x50, 0xb7, 0x7e, 0x5d, 0x67, 0xdb, 0xb9, 0xd3, 0xda, 0xb9, 0xe1, 0xcd,
+	0xbc, 0x79, 0x96, 0xaf, 0x59, 0x34, 0xe5, 0x90, 0x47, 0x00, 0xd9, 0xf2, 0x6e, 0xc5, 0x58, 0xb8,
+	0x99, 0x45, 0xd1, 0x37, 0xcd, 0x71, 0x7b, 0x3f, 0xd4, 0x00, 0x32, 0x87, 0xa4, 0x0d, 0x15, 0x1e,
+	0x98, 0x25, 0x9b, 0xb4, 0xc2, 0x03, 0x72, 0x03, 0x6a, 0x7c, 0xc4, 0x86, 0x68, 0x7c, 0x36, 0xa9,
+	0x1d, 0xe8, 0xcd, 0xf9, 0x22, 0x3a, 0xe1, 0x43, 0xb7, 0x9a, 0x6e, 0xce, 0x06, 0xe8, 0xcd, 0x02,
+	0xf4, 0x76, 0xa3, 0x29, 0x4d, 0x39, 0x64, 0x0b, 0xea, 0x52, 0x08, 0x75, 0xb8, 0xef, 0xae, 0x19,
+	0x27, 0xe9, 0x88, 0x1c, 0x40, 0xc7, 0xb8, 0x3b, 0x1a, 0x87, 0xe1, 0x9b, 0x58, 0x71, 0x11, 0x25,
+	0x6e, 0xcd, 0xf8, 0xeb, 0x66, 0x5b, 0x3f, 0x2c, 0x31, 0xe8, 0x82, 0x0d, 0xe9, 0xc1, 0x46, 0xcc,
+	0x94, 0x7f, 0xba, 0x27, 0x22, 0x85, 0x1f, 0x95, 0x5b, 0x37, 0xab, 0x14, 0x30, 0xf2, 0x37, 0x68,
+	0xdb, 0xdd, 0xec, 0x9d, 0xa2, 0x7f, 0x96, 0x8c, 0x47, 0xee, 0xfa, 0xb6, 0x73, 0xa7, 0x41, 0x4b,
+	0xa8, 0xe6, 0xf1, 0x61, 0x24, 0x24, 0xee, 0x0e, 0xb8, 0x01, 0xdd, 0x86, 0xe5, 0x15, 0x51, 0xb2,
+	0x0d, 0x2d, 0x21, 0x03, 0x94, 0x4f, 0xf1, 0x44, 0x48, 0x74, 0x9b, 0x66, 0xc9, 0x3c, 0x44, 0x6e,
+	0x01, 0x98, 0xe1, 0xee, 0x89, 0x2e, 0x22, 0x18, 0x42, 0x0e, 0x21, 0x0f, 0x01, 0xec, 0xda, 0x07,
+	0x52, 0x8c, 0xdc, 0x96, 0x89, 0x7b, 0x2b, 0x8b, 0x7b, 0xcf, 0xcc, 0x1d, 0x8b, 0xb1, 0xf4, 0x91,
+	0xe6, 0x98, 0xda, 0xaf, 0x2d, 0xfa, 0xdb, 0x69, 0x8c, 0xee, 0x86, 0xf5, 0x9b, 0x21, 0xe4, 0x10,
+	0xae, 0x4e, 0x50, 0xf2, 0x93, 0xe9, 0x31, 0x1f, 0x46, 0x4c, 0x8d, 0x25, 0xba, 0x9b, 0xc6, 0xf9,
+	0x5f, 0x33, 0xe7, 0xf3, 0xa9, 0xf7, 0x9a, 0xc9, 0x7d, 0xa6, 0x13, 0x49, 0xcb, 0x76, 0xe4, 0x1f,
+	0xd0, 0x61, 0x61, 0x28, 0xce, 0x8f, 0x24, 0xfa, 0x62, 0x14, 0xf3, 0x10, 0x03, 0xb7, 0x6d, 0xd2,
+	0xb1, 0x80, 0x93, 0x3e, 0x54, 0x31, 0x9a, 0xb8, 0x57, 0xb7, 0xab, 0x77, 0x5a, 0x3b, 0x7f, 0x59,
+	0xd6, 0xac, 0xde, 0xb3, 0x68, 0xf2, 0x2c, 0x52, 0x72, 0x4a, 0x35, 0xb3, 0xfb, 0x10, 0x1a, 0x33,
+	0x80, 0x74, 0xa0, 0x7a, 0x86, 0xd3, 0xb4, 0xed, 0xf4, 0xa7, 0xee, 0xbb, 0x09, 0x0b, 0xc7, 0xf3,
+	0xbe, 0x33, 0x83, 0xc7, 0x95, 0x47, 0x4e, 0xef, 0x57, 0x07, 0xfe, 0xb4, 0x74, 0xff, 0xe4, 0x26,
+	0x34, 0xe3, 0xf1, 0x20, 0xe4, 0xfe, 0xcb, 0xb9, 0xaf, 0x0c, 0xd0, 0x1e, 0x75, 0xdf, 0x25, 0x33,
+	0x8f, 0x66, 0x40, 0x28, 0xb4, 0x58, 0x14, 0x09, 0xc5, 0x6c, 0xfb, 0x55, 0xcd, 0xf6, 0xef, 0xfd,
+	0x4e, 0xa6, 0xbc, 0xdd, 0xcc, 0xc4, 0x46, 0x94, 0x77, 0xd2, 0xfd, 0x1f, 0x74, 0xca, 0x84, 0x4b,
+	0x45, 0xf8, 0x8d, 0x03, 0x1b, 0xf9, 0xf2, 0x93, 0x27, 0x70, 0xd5, 0x36, 0xc0, 0x6b, 0x16, 0xbf,
+	0xc4, 0x29, 0xc5, 0x13, 0xd7, 0x29, 0xf7, 0x8b, 0xc5, 0x51, 0x62, 0xe4, 0x23, 0x2d, 0xd3, 0xc9,
+	0x63, 0xd8, 0x48, 0xd0, 0x97, 0xa8, 0x52, 0xf3, 0xca, 0x85, 0xe6, 0x05, 0x6e, 0x8f, 0xc2, 0x46,
+	0x7e, 0x96, 0x10, 0x58, 0x8b, 0xd8, 0x08, 0xd3, 0x58, 0xcc, 0xf7, 0x2c, 0xbc, 0x4a, 0x16, 0xde,
+	0x4d, 0x68, 0xea, 0x99, 0x24, 0x66, 0x3e, 0x1a, 0x95, 0x68, 0xd2, 0x0c, 0xe8, 0x7d, 0xed, 0x40,
+	0xa7, 0x7c, 0xb2, 0x75, 0x67, 0xc7, 0xe3, 0x30, 0x3c, 0x36, 0x8b, 0xa7, 0xee, 0x73, 0x08, 0xf1,
+	0x80, 0xf0, 0x28, 0x41, 0x7f, 0x2c, 0xf1, 0xf8, 0x8c, 0xc7, 0xa6, 0x22, 0x76, 0xcd, 0x06, 0x5d,
+	0x32, 0x63, 0xfa, 0x21, 0x64, 0x3c, 0x7a, 0xa1, 0x54, 0x6c, 0xb6, 0xd0, 0xa0, 0x19, 0xd0, 0xfb,
+	0xd6, 0x81, 0x76, 0x49, 0x73, 0xff, 0x0d, 0x35, 0x9e, 0x28, 0x2e, 0xd2, 0xf4, 0xe4, 0xba, 0xf8,
+	0x50, 0xc3, 0x45, 0xf6, 0x8b, 0x2b, 0xd4, 0xb2, 0xc9, 0x0e, 0xac, 0x0d, 0x43, 0x21, 0x52, 0x2d,
+	0xbc, 0x99, 0x59, 0x3d, 0x0f, 0xc5, 0xa2, 0x91, 0xe1, 0x3e, 0xed, 0x40, 0x3b, 0x13, 0x61, 0x7d,
+	0x6e, 0x7b, 0xdf, 0xd7, 0xe0, 0xfa, 0x92, 0x65, 0x74, 0xba, 0xcf, 0x78, 0x34, 0xd3, 0x64, 0xf3,
+	0x4d, 0x76, 0xa1, 0x1e, 0xb2, 0x01, 0x86, 0xba, 0x99, 0x75, 0xc3, 0xfe, 0xfd, 0xc2, 0x9d, 0x7a,
+	0xaf, 0x0c, 0xd7, 0x76, 0x6a, 0x6a, 0x68, 0x84, 0x4e, 0x53, 0xff, 0x5f, 0x2a, 0x52, 0x09, 0x25,
+	0xb7, 0x61, 0xd3, 0x20, 0x14, 0x27, 0x3c, 0xe1, 0x22, 0x4a, 0x35, 0xbc, 0x08, 0x92, 0xc7, 0xe0,
+	0x06, 0x3c, 0x61, 0x83, 0x10, 0x8f, 0xa4, 0xf8, 0x38, 0x7d, 0x8f, 0x52, 0xc3, 0xaf, 0xb5, 0x02,
+	0x1b, 0x49, 0x6f, 0xd0, 0x95, 0xf3, 0xa4, 0x0b, 0x8d, 0x11, 0x26, 0xa7, 0x1f, 0x78, 0x80, 0x46,
+	0xba, 0x1b, 0x74, 0x3e, 0xd6, 0xab, 0x9f, 0x0b, 0x79, 0x16, 0x0a, 0x16, 0xbc, 0xd1, 0xd2, 0x69,
+	0x54, 0xbb, 0x49, 0x8b, 0x20, 0xb9, 0x0b, 0xd7, 0x78, 0xe4, 0x87, 0xe3, 0x00, 0xdf, 0x45, 0x3c,
+	0xfa, 0x12, 0x7d, 0x85, 0x41, 0xaa, 0xdb, 0x8b, 0x13, 0xe4, 0x33, 0x68, 0x27, 0x18, 0xa2, 0xaf,
+	0x84, 0xb4, 0x89, 0x71, 0x9b, 0x26, 0x89, 0xf7, 0x2f, 0x4e, 0xe2, 0x71, 0xc1, 0xc6, 0x26, 0xb3,
+	0xe4, 0x48, 0x0b, 0xa6, 0xc4, 0x91, 0x50, 0xb8, 0xcf, 0x14, 0x4b, 0xcc, 0xe1, 0x35, 0xca, 0xdf,
+	0xa0, 0x0b, 0x38, 0xd9, 0x81, 0x75, 0xc5, 0xe4, 0x10, 0x55, 0xe2, 0xb6, 0xb6, 0xab, 0xc5, 0xfb,
+	0xfa, 0x43, 0x1a, 0xde, 0x5b, 0x43, 0xa0, 0x33, 0x62, 0xf7, 0x3f, 0xd0, 0xca, 0x2d, 0x7f, 0x19,
+	0x51, 0xe9, 0xee, 0xc2, 0xf5, 0x25, 0x11, 0x5c, 0x4a, 0x97, 0x7e, 0x71, 0xa0, 0x5d, 0xdc, 0xd9,
+	0xd2, 0xe6, 0xfc, 0x6f, 0xa9, 0x39, 0x6f, 0xaf, 0x8a, 0x6b, 0x69, 0x5f, 0xce, 0xd4, 0xa5, 0x9a,
+	0x53, 0x97, 0x82, 0x96, 0xac, 0x95, 0xb4, 0xe4, 0x0f, 0x24, 0xa5, 0xf7, 0xb3, 0x03, 0x64, 0xf1,
+	0x90, 0x6a, 0x21, 0x9a, 0xbb, 0x4f, 0x5c, 0x67, 0xbb, 0xaa, 0x85, 0x28, 0x43, 0xc8, 0x3b, 0xd8,
+	0x1c, 0x32, 0x85, 0xe7, 0x6c, 0xfa, 0x2a, 0x1f, 0x68, 0xff, 0xa2, 0x93, 0xef, 0x3d, 0xcf, 0x5b,
+	0xd8, 0x98, 0x8b, 0x5e, 0xba, 0x4f, 0x80, 0x2c, 0x92, 0x2e, 0x15, 0xcf, 0x8f, 0x55, 0xd8, 0x5a,
+	0x78, 0x4d, 0x2a, 0xa6, 0xc6, 0x89, 0x16, 0x4f, 0x31, 0x48, 0x50, 0x4e, 0x30, 0x78, 0x8e, 0x11,
+	0x4a, 0x73, 0x39, 0x19, 0xaf, 0x55, 0xba, 0x64, 0x86, 0xbc, 0x86, 0xe6, 0xec, 0x90, 0x2d, 0x89,
+	0x6f, 0xf9, 0x22, 0xf3, 0xfa, 0xa6, 0xf1, 0x65, 0x1e, 0xcc, 0x1b, 0x10, 0x59, 0x22, 0xa2, 0xb4,
+	0xb0, 0xe9, 0x48, 0xa7, 0xda, 0xde, 0x55, 0x2f, 0x58, 0x72, 0x9a, 0xd6, 0x36, 0x87, 0x90, 0x7d,
+	0xe8, 0xcc, 0x9c, 0xd8, 0x35, 0x50, 0xbf, 0x11, 0x57, 0x1c, 0x17, 0xcb, 0xa0, 0x0b, 0x16, 0xe6,
+	0xee, 0x47, 0x16, 0x4c, 0xd3, 0xa7, 0xa1, 0x1d, 0x90, 0x07, 0x66, 0xed, 0x80, 0xdb, 0xab, 0x7f,
+	0xdd, 0x78, 0xbd, 0x5e, 0x78, 0x81, 0xd9, 0x39, 0x9a, 0xa3, 0x75, 0xdf, 0x43, 0xbb, 0x18, 0xe5,
+	0x92, 0x02, 0x79, 0xf9, 0x02, 0x5d, 0xb4, 0xd3, 0x5c, 0xe9, 0x7e, 0xaa, 0x42, 0xbb, 0x38, 0x4b,
+	0xfe, 0x05, 0xb5, 0x44, 0x31, 0x65, 0x6f, 0xda, 0xf6, 0xce, 0xad, 0x55, 0x6e, 0x3c, 0xfd, 0x83,
+	0xd4, 0x92, 0x73, 0x99, 0xae, 0x14, 0x32, 0x7d, 0xe9, 0x83, 0x45, 0x5c, 0x58, 0x1f, 0x61, 0x92,
+	0xe8, 0xd7, 0x7f, 0xcd, 0xcc, 0xcd, 0x86, 0x2b, 0x9a, 0xa9, 0xbe, 0xb2, 0x99, 0xee, 0x41, 0xdd,
+	0x4a, 0x98, 0xbb, 0xbe, 0x2a, 0x23, 0xa9, 0xd4, 0xa5, 0x3c, 0x7d, 0x3d, 0x49, 0x4c, 0x14, 0x93,
+	0x4a, 0x5f, 0xe8, 0xf1, 0x5c, 0xcf, 0x4b, 0x68, 0xa9, 0x7f, 0x9a, 0xe5, 0xfe, 0xe9, 0x9d, 0x41,
+	0xcd, 0x64, 0x87, 0xb4, 0x60, 0xfd, 0x08, 0xa3, 0x80, 0x47, 0xc3, 0xce, 0x15, 0x72, 0x0d, 0x36,
+	0x6d, 0x07, 0xef, 0x49, 0x64, 0x0a, 0x83, 0x8e, 0x43, 0x36, 0xa1, 0x79, 0x3c, 0xf6, 0x7d, 0xc4,
+	0xc0, 0x0c, 0x01, 0xea, 0x07, 0x4c, 0x3f, 0x6c, 0x3b, 0x15, 0x6d, 0x9a, 0x2e, 0xd7, 0xa9, 0x92,
+	0x2d, 0x20, 0xb9, 0xc7, 0xdd, 0x6e, 0x1c, 0x87, 0x1c, 0x83, 0xce, 0x5a, 0xb7, 0xd2, 0x71, 0x7a,
+	0xdf, 0x39, 0xd0, 0x9c, 0x77, 0x8d, 0x4e, 0xb8, 0x9a, 0xc6, 0xb6, 0x7a, 0x4d, 0x6a, 0xbe, 0x75,
+	0x71, 0x12, 0x53, 0xb3, 0x59, 0x71, 0xec, 0x68, 0xe5, 0xf1, 0xc8, 0x95, 0x60, 0xed, 0x53, 0x4a,
+	0x50, 0x5b, 0x55, 0x82, 0xa7, 0x07, 0x9f, 0xef, 0x7f, 0xea, 0xbf, 0xdc, 0xf8, 0x6c, 0xb8, 0xe4,
+	0x9f, 0xae, 0xc7, 0x45, 0x7f, 0x72, 0x7f, 0x50, 0x37, 0x7f, 0xf1, 0x1e, 0xfc, 0x36, 0x00, 0x71,
+	0x47, 0x0e, 0x14, 0x34, 0x0f, 0x00, 0x00,
 }
@@ -40,6 +40,39 @@ func (this *FilterSpec) UnmarshalJSON(b []byte) error {
 	return FilterDeploymentUnmarshaler.Unmarshal(bytes.NewReader(b), this)
 }
 
+// MarshalJSON is a custom marshaler for SignatureVerification
+func (this *SignatureVerification) MarshalJSON() ([]byte, error) {
+	str, err := FilterDeploymentMarshaler.MarshalToString(this)
+	return []byte(str), err
+}
+
+// UnmarshalJSON is a custom unmarshaler for SignatureVerification
+func (this *SignatureVerification) UnmarshalJSON(b []byte) error {
+	return FilterDeploymentUnmarshaler.Unmarshal(bytes.NewReader(b), this)
+}
+
+// MarshalJSON is a custom marshaler for ConfigSource
+func (this *ConfigSource) MarshalJSON() ([]byte, error) {
+	str, err := FilterDeploymentMarshaler.MarshalToString(this)
+	return []byte(str), err
+}
+
+// UnmarshalJSON is a custom unmarshaler for ConfigSource
+func (this *ConfigSource) UnmarshalJSON(b []byte) error {
+	return FilterDeploymentUnmarshaler.Unmarshal(bytes.NewReader(b), this)
+}
+
+// MarshalJSON is a custom marshaler for KeyReference
+func (this *KeyReference) MarshalJSON() ([]byte, error) {
+	str, err := FilterDeploymentMarshaler.MarshalToString(this)
+	return []byte(str), err
+}
+
+// UnmarshalJSON is a custom unmarshaler for KeyReference
+func (this *KeyReference) UnmarshalJSON(b []byte) error {
+	return FilterDeploymentUnmarshaler.Unmarshal(bytes.NewReader(b), this)
+}
+
 // MarshalJSON is a custom marshaler for ImagePullOptions
 func (this *ImagePullOptions) MarshalJSON() ([]byte, error) {
 	str, err := FilterDeploymentMarshaler.MarshalToString(this)
@@ -73,6 +106,28 @@ func (this *IstioDeploymentSpec) UnmarshalJSON(b []byte) error {
 	return FilterDeploymentUnmarshaler.Unmarshal(bytes.NewReader(b), this)
 }
 
+// MarshalJSON is a custom marshaler for WorkloadTarget
+func (this *WorkloadTarget) MarshalJSON() ([]byte, error) {
+	str, err := FilterDeploymentMarshaler.MarshalToString(this)
+	return []byte(str), err
+}
+
+// UnmarshalJSON is a custom unmarshaler for WorkloadTarget
+func (this *WorkloadTarget) UnmarshalJSON(b []byte) error {
+	return FilterDeploymentUnmarshaler.Unmarshal(bytes.NewReader(b), this)
+}
+
+// MarshalJSON is a custom marshaler for GlooDeploymentSpec
+func (this *GlooDeploymentSpec) MarshalJSON() ([]byte, error) {
+	str, err := FilterDeploymentMarshaler.MarshalToString(this)
+	return []byte(str), err
+}
+
+// UnmarshalJSON is a custom unmarshaler for GlooDeploymentSpec
+func (this *GlooDeploymentSpec) UnmarshalJSON(b []byte) error {
+	return FilterDeploymentUnmarshaler.Unmarshal(bytes.NewReader(b), this)
+}
+
 // MarshalJSON is a custom marshaler for FilterDeploymentStatus
 func (this *FilterDeploymentStatus) MarshalJSON() ([]byte, error) {
 	str, err := FilterDeploymentMarshaler.MarshalToString(this)
@@ -95,6 +150,17 @@ func (this *WorkloadStatus) UnmarshalJSON(b []byte) error {
 	return FilterDeploymentUnmarshaler.Unmarshal(bytes.NewReader(b), this)
 }
 
+// MarshalJSON is a custom marshaler for Condition
+func (this *Condition) MarshalJSON() ([]byte, error) {
+	str, err := FilterDeploymentMarshaler.MarshalToString(this)
+	return []byte(str), err
+}
+
+// UnmarshalJSON is a custom unmarshaler for Condition
+func (this *Condition) UnmarshalJSON(b []byte) error {
+	return FilterDeploymentUnmarshaler.Unmarshal(bytes.NewReader(b), this)
+}
+
 var (
 	FilterDeploymentMarshaler   = &github_com_gogo_protobuf_jsonpb.Marshaler{}
 	FilterDeploymentUnmarshaler = &github_com_gogo_protobuf_jsonpb.Unmarshaler{}
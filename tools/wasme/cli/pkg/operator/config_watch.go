@@ -0,0 +1,87 @@
+package operator
+
+import (
+	"context"
+
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1/controller"
+	kubev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// the index of FilterDeployments by the <namespace>/<name> of the ConfigMap their filter config is read from
+const configMapReferenceIndex = "spec.filter.configFrom.configMapKeyRef"
+
+// returns the <namespace>/<name> of the ConfigMap referenced by the FilterDeployment, if any
+func configMapReference(obj *v1.FilterDeployment) (string, bool) {
+	ref := obj.Spec.GetFilter().GetConfigFrom().GetConfigMapKeyRef()
+	if ref == nil {
+		return "", false
+	}
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = obj.Namespace
+	}
+	return namespace + "/" + ref.Name, true
+}
+
+// AddConfigMapWatch re-deploys the FilterDeployments whose filter config is read from a ConfigMap
+// whenever that ConfigMap changes.
+// Secrets are not watched; filters reading their config from a Secret pick up changes on their next update.
+func AddConfigMapWatch(ctx context.Context, mgr manager.Manager, filterDeploymentHandler controller.FilterDeploymentEventHandler) error {
+	if err := mgr.GetFieldIndexer().IndexField(&v1.FilterDeployment{}, configMapReferenceIndex, func(obj runtime.Object) []string {
+		if ref, ok := configMapReference(obj.(*v1.FilterDeployment)); ok {
+			return []string{ref}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	ctl, err := ctrlcontroller.New("wasme-configmaps", mgr, ctrlcontroller.Options{
+		Reconciler: &configMapReconciler{ctx: ctx, client: mgr.GetClient(), handler: filterDeploymentHandler},
+	})
+	if err != nil {
+		return err
+	}
+	return ctl.Watch(&source.Kind{Type: &kubev1.ConfigMap{}}, &handler.EnqueueRequestForObject{})
+}
+
+// re-deploys the FilterDeployments referencing the reconciled ConfigMap
+type configMapReconciler struct {
+	ctx     context.Context
+	client  client.Client
+	handler controller.FilterDeploymentEventHandler
+}
+
+func (r *configMapReconciler) Reconcile(req reconcile.Request) (reconcile.Result, error) {
+	ref := req.Namespace + "/" + req.Name
+
+	var filterDeployments v1.FilterDeploymentList
+	if err := r.client.List(r.ctx, &filterDeployments, client.MatchingFields{configMapReferenceIndex: ref}); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	for i := range filterDeployments.Items {
+		obj := &filterDeployments.Items[i]
+		// filter on the reference again, as not every client supports field selectors
+		if objRef, ok := configMapReference(obj); !ok || objRef != ref {
+			continue
+		}
+		if obj.DeletionTimestamp != nil {
+			continue
+		}
+		log.Log.Info("filter config changed, re-deploying filter", "configmap", ref, "filterdeployment", obj.Name)
+		if err := r.handler.UpdateFilterDeployment(obj, obj); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	return reconcile.Result{}, nil
+}
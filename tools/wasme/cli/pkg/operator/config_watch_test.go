@@ -0,0 +1,66 @@
+package operator
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1/controller"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// records the FilterDeployments which were updated
+type recordingHandler struct {
+	controller.FilterDeploymentEventHandler
+	updated []string
+}
+
+func (h *recordingHandler) UpdateFilterDeployment(_, obj *v1.FilterDeployment) error {
+	h.updated = append(h.updated, obj.Namespace+"/"+obj.Name)
+	return nil
+}
+
+var _ = Describe("ConfigMap watch", func() {
+	makeFilterDeployment := func(name, namespace string, configFrom *v1.ConfigSource) *v1.FilterDeployment {
+		return &v1.FilterDeployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: v1.FilterDeploymentSpec{
+				Filter: &v1.FilterSpec{ConfigFrom: configFrom},
+			},
+		}
+	}
+	configMapRef := func(name, namespace string) *v1.ConfigSource {
+		return &v1.ConfigSource{ConfigMapKeyRef: &v1.KeyReference{Name: name, Key: "config", Namespace: namespace}}
+	}
+
+	It("re-deploys the FilterDeployments which read their config from the ConfigMap", func() {
+		deleted := makeFilterDeployment("deleted", "default", configMapRef("filter-config", ""))
+		now := metav1.NewTime(time.Now())
+		deleted.DeletionTimestamp = &now
+
+		scheme := runtime.NewScheme()
+		Expect(v1.AddToScheme(scheme)).NotTo(HaveOccurred())
+		client := fake.NewFakeClientWithScheme(scheme,
+			makeFilterDeployment("same-namespace", "default", configMapRef("filter-config", "")),
+			makeFilterDeployment("other-namespace", "bookinfo", configMapRef("filter-config", "default")),
+			makeFilterDeployment("other-configmap", "default", configMapRef("other-config", "")),
+			makeFilterDeployment("same-name-other-namespace", "bookinfo", configMapRef("filter-config", "")),
+			makeFilterDeployment("secret", "default", &v1.ConfigSource{SecretKeyRef: &v1.KeyReference{Name: "filter-config", Key: "config"}}),
+			makeFilterDeployment("inline", "default", nil),
+			deleted,
+		)
+
+		handler := &recordingHandler{}
+		reconciler := &configMapReconciler{ctx: context.TODO(), client: client, handler: handler}
+
+		_, err := reconciler.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: "filter-config", Namespace: "default"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(handler.updated).To(ConsistOf("default/same-namespace", "bookinfo/other-namespace"))
+	})
+})
@@ -0,0 +1,158 @@
+package operator
+
+import (
+	"context"
+	"time"
+
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1/controller"
+	"istio.io/client-go/pkg/apis/networking/v1alpha3"
+	appsv1 "k8s.io/api/apps/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// the default interval of the periodic re-deploys of every FilterDeployment
+	DefaultResyncInterval = 10 * time.Minute
+
+	// reason of the Event recorded on a FilterDeployment whose filter was modified or removed outside of the operator
+	EventReasonDriftCorrected = "DriftCorrected"
+)
+
+// AddDriftWatch re-deploys FilterDeployments whose filter may have been modified or removed outside of the operator,
+// so the drift is corrected by applying the filter again:
+// when an EnvoyFilter owned by a FilterDeployment is modified or deleted,
+// when a Deployment or DaemonSet selected by a FilterDeployment is modified,
+// and every resyncInterval for every FilterDeployment, e.g. for mesh-wide EnvoyFilters
+// and the EnvoyFilters of targets in other namespaces, which have no owner.
+// a resyncInterval of 0 disables the periodic re-deploys.
+// OpenShift DeploymentConfigs are only re-deployed periodically.
+func AddDriftWatch(ctx context.Context, mgr manager.Manager, filterDeploymentHandler controller.FilterDeploymentEventHandler, resyncInterval time.Duration) error {
+	if err := v1alpha3.AddToScheme(mgr.GetScheme()); err != nil {
+		return err
+	}
+
+	kubeClient := mgr.GetClient()
+	ctl, err := ctrlcontroller.New("wasme-drift", mgr, ctrlcontroller.Options{
+		Reconciler: &driftReconciler{ctx: ctx, client: kubeClient, handler: filterDeploymentHandler},
+	})
+	if err != nil {
+		return err
+	}
+
+	// the operator creates the EnvoyFilters, so only their updates and deletions are drift
+	if err := ctl.Watch(
+		&source.Kind{Type: &v1alpha3.EnvoyFilter{}},
+		&handler.EnqueueRequestForOwner{OwnerType: &v1.FilterDeployment{}, IsController: true},
+		predicate.Funcs{CreateFunc: func(event.CreateEvent) bool { return false }},
+		predicate.GenerationChangedPredicate{},
+	); err != nil {
+		return err
+	}
+
+	workloadHandler := &handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(func(obj handler.MapObject) []reconcile.Request {
+		kind := istio.WorkloadTypeDeployment
+		if _, ok := obj.Object.(*appsv1.DaemonSet); ok {
+			kind = istio.WorkloadTypeDaemonSet
+		}
+		requests, err := selectingFilterDeployments(ctx, kubeClient, kind, obj.Meta.GetNamespace(), obj.Meta.GetName(), obj.Meta.GetLabels())
+		if err != nil {
+			log.Log.Error(err, "failed to list the FilterDeployments of workload", "workload", obj.Meta.GetName())
+		}
+		return requests
+	})}
+	for _, workload := range []runtime.Object{&appsv1.Deployment{}, &appsv1.DaemonSet{}} {
+		// status updates, e.g. of rollouts, do not change the generation
+		if err := ctl.Watch(&source.Kind{Type: workload}, workloadHandler, predicate.GenerationChangedPredicate{}); err != nil {
+			return err
+		}
+	}
+
+	if resyncInterval == 0 {
+		return nil
+	}
+	return mgr.Add(manager.RunnableFunc(func(stop <-chan struct{}) error {
+		ticker := time.NewTicker(resyncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return nil
+			case <-ticker.C:
+				Resync(ctx, kubeClient, filterDeploymentHandler)
+			}
+		}
+	}))
+}
+
+// returns the requests of the FilterDeployments with a target which selects the workload of the kind with the name and labels.
+// FilterDeployments in every namespace are listed, as their targets may be in other namespaces
+func selectingFilterDeployments(ctx context.Context, kubeClient client.Client, kind, namespace, name string, workloadLabels map[string]string) ([]reconcile.Request, error) {
+	var filterDeployments v1.FilterDeploymentList
+	if err := kubeClient.List(ctx, &filterDeployments); err != nil {
+		return nil, err
+	}
+
+	var requests []reconcile.Request
+	for i := range filterDeployments.Items {
+		obj := &filterDeployments.Items[i]
+		for _, target := range deploymentTargets(obj) {
+			if targetSelects(target, kind, namespace, name, workloadLabels) {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: obj.Name, Namespace: obj.Namespace}})
+				break
+			}
+		}
+	}
+	return requests, nil
+}
+
+// Resync re-deploys every FilterDeployment with the handler,
+// finalizing the FilterDeployments being deleted whose filter was not removed yet
+func Resync(ctx context.Context, kubeClient client.Client, handler controller.FilterDeploymentEventHandler) {
+	var filterDeployments v1.FilterDeploymentList
+	if err := kubeClient.List(ctx, &filterDeployments); err != nil {
+		log.Log.Error(err, "failed to list FilterDeployments to resync")
+		return
+	}
+	for i := range filterDeployments.Items {
+		obj := &filterDeployments.Items[i]
+		log.Log.V(1).Info("resyncing filter", "filterdeployment", obj.Name)
+		if err := handler.UpdateFilterDeployment(obj, obj); err != nil {
+			log.Log.Error(err, "failed to resync filter", "filterdeployment", obj.Name)
+		}
+	}
+}
+
+// re-deploys the reconciled FilterDeployment, correcting the drift of its filter
+type driftReconciler struct {
+	ctx     context.Context
+	client  client.Client
+	handler controller.FilterDeploymentEventHandler
+}
+
+func (r *driftReconciler) Reconcile(req reconcile.Request) (reconcile.Result, error) {
+	obj := &v1.FilterDeployment{}
+	if err := r.client.Get(r.ctx, req.NamespacedName, obj); err != nil {
+		if kubeerrors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+	if obj.DeletionTimestamp != nil {
+		return reconcile.Result{}, nil
+	}
+	log.Log.Info("filter may have drifted, re-deploying filter", "filterdeployment", obj.Name)
+	return reconcile.Result{}, r.handler.UpdateFilterDeployment(obj, obj)
+}
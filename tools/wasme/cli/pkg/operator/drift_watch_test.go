@@ -0,0 +1,101 @@
+package operator
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Drift watch", func() {
+	var (
+		kubeClient client.Client
+		handler    *recordingHandler
+	)
+
+	makeFilterDeployment := func(name, namespace, kind string, labels map[string]string) *v1.FilterDeployment {
+		return &v1.FilterDeployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: v1.FilterDeploymentSpec{
+				Filter: &v1.FilterSpec{},
+				Deployment: &v1.DeploymentSpec{
+					DeploymentType: &v1.DeploymentSpec_Istio{Istio: &v1.IstioDeploymentSpec{
+						Kind:   kind,
+						Labels: labels,
+					}},
+				},
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		deleted := makeFilterDeployment("deleted", "default", "Deployment", nil)
+		now := metav1.NewTime(time.Now())
+		deleted.DeletionTimestamp = &now
+
+		targeting := makeFilterDeployment("targets", "bookinfo", "Deployment", nil)
+		targeting.Spec.Deployment.GetIstio().Targets = []*v1.WorkloadTarget{
+			{Name: "ratings", Namespace: "bookinfo"},
+			{Name: "reviews", Namespace: "default"},
+		}
+
+		scheme := runtime.NewScheme()
+		Expect(v1.AddToScheme(scheme)).NotTo(HaveOccurred())
+		kubeClient = fake.NewFakeClientWithScheme(scheme,
+			makeFilterDeployment("all-deployments", "default", "Deployment", nil),
+			makeFilterDeployment("matching-labels", "default", "deployment", map[string]string{"app": "reviews"}),
+			makeFilterDeployment("other-labels", "default", "Deployment", map[string]string{"app": "ratings"}),
+			makeFilterDeployment("daemonsets", "default", "DaemonSet", nil),
+			makeFilterDeployment("other-namespace", "bookinfo", "Deployment", nil),
+			targeting,
+			deleted,
+		)
+		handler = &recordingHandler{}
+	})
+
+	It("maps workloads to the FilterDeployments selecting them", func() {
+		requests, err := selectingFilterDeployments(context.TODO(), kubeClient, istio.WorkloadTypeDeployment, "default", "reviews", map[string]string{"app": "reviews", "version": "v1"})
+		Expect(err).NotTo(HaveOccurred())
+		var names []string
+		for _, req := range requests {
+			names = append(names, req.Namespace+"/"+req.Name)
+		}
+		Expect(names).To(ConsistOf("default/all-deployments", "default/matching-labels", "default/deleted", "bookinfo/targets"))
+
+		requests, err = selectingFilterDeployments(context.TODO(), kubeClient, istio.WorkloadTypeDaemonSet, "default", "reviews", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(requests).To(ConsistOf(reconcile.Request{NamespacedName: types.NamespacedName{Name: "daemonsets", Namespace: "default"}}))
+	})
+
+	It("re-deploys the reconciled FilterDeployment", func() {
+		reconciler := &driftReconciler{ctx: context.TODO(), client: kubeClient, handler: handler}
+
+		for _, name := range []string{"matching-labels", "deleted", "missing"} {
+			_, err := reconciler.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: "default"}})
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(handler.updated).To(Equal([]string{"default/matching-labels"}))
+	})
+
+	It("resyncs every FilterDeployment, including those being deleted", func() {
+		Resync(context.TODO(), kubeClient, handler)
+		Expect(handler.updated).To(ConsistOf(
+			"default/all-deployments",
+			"default/matching-labels",
+			"default/other-labels",
+			"default/daemonsets",
+			"bookinfo/other-namespace",
+			"bookinfo/targets",
+			"default/deleted",
+		))
+	})
+})
@@ -0,0 +1,82 @@
+package operator
+
+import (
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// the finalizer added to FilterDeployments, so the filter is removed from the workloads before the FilterDeployment is deleted
+	CleanupFinalizer = "wasme.io/cleanup"
+
+	// the number of times the removal of the filter of a deleted FilterDeployment is attempted,
+	// before its finalizer is removed anyway
+	DefaultCleanupAttempts = 5
+
+	// reason of the Event recorded on a FilterDeployment deleted without removing its filter
+	EventReasonCleanupFailed = "CleanupFailed"
+)
+
+func hasFinalizer(obj *v1.FilterDeployment) bool {
+	for _, finalizer := range obj.Finalizers {
+		if finalizer == CleanupFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// adds the finalizer to the FilterDeployment, if it is missing
+func (f *filterDeploymentHandler) addFinalizer(obj *v1.FilterDeployment) error {
+	if hasFinalizer(obj) {
+		return nil
+	}
+	obj.Finalizers = append(obj.Finalizers, CleanupFinalizer)
+	return f.client.Update(f.ctx, obj)
+}
+
+// removes the filter of the deleted FilterDeployment from its workloads, restoring their annotations
+// and pruning its image from the cache config, then removes the finalizer so the FilterDeployment is deleted.
+// if the filter cannot be removed, e.g. because the namespace of the workloads is being deleted,
+// the error is returned so the removal is retried with the backoff of the controller,
+// until it failed cleanupAttempts times: the finalizer is then removed anyway, recording a Warning Event
+func (f *filterDeploymentHandler) finalize(obj *v1.FilterDeployment) error {
+	if !hasFinalizer(obj) {
+		return nil
+	}
+
+	// including the targets the filter could not be removed from when they were removed
+	targets := deploymentTargets(obj)
+	if err := f.handleFilter(obj, true, append(targets, removedTargets(obj, targets)...), nil, nil, nil, nil); err != nil {
+		attempts := f.cleanupAttempts
+		if attempts == 0 {
+			attempts = DefaultCleanupAttempts
+		}
+		if f.cleanupFailures == nil {
+			f.cleanupFailures = map[string]int{}
+		}
+		key := obj.Namespace + "/" + obj.Name
+		f.cleanupFailures[key]++
+		if failures := f.cleanupFailures[key]; failures < attempts {
+			log.Log.Error(err, "failed to remove filter, retrying", "filterdeployment", obj.Name, "attempt", failures)
+			return err
+		}
+		log.Log.Error(err, "failed to remove filter, deleting the FilterDeployment anyway", "filterdeployment", obj.Name)
+		if f.recorder != nil {
+			f.recorder.Eventf(obj, corev1.EventTypeWarning, EventReasonCleanupFailed,
+				"failed to remove filter after %v attempts, the workloads may keep the annotations of the filter: %v", attempts, err)
+		}
+	}
+	delete(f.cleanupFailures, obj.Namespace+"/"+obj.Name)
+	f.reconcileMetrics.forget(obj)
+
+	var finalizers []string
+	for _, finalizer := range obj.Finalizers {
+		if finalizer != CleanupFinalizer {
+			finalizers = append(finalizers, finalizer)
+		}
+	}
+	obj.Finalizers = finalizers
+	return f.client.Update(f.ctx, obj)
+}
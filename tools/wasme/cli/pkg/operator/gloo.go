@@ -0,0 +1,83 @@
+package operator
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	gatewayv1 "github.com/solo-io/gloo/projects/gateway/pkg/api/v1"
+	"github.com/solo-io/gloo/projects/gloo/cli/pkg/helpers"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/gloo"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NewGatewayClientFunc returns the function creating the client of the Gloo Gateways in the namespaces of the scope.
+// the client is created by the first deployment to Gloo, so the operator runs on clusters without Gloo,
+// and reused by the next deployments; creating it is retried by the next deployment if it fails
+func NewGatewayClientFunc(scope WatchScope) func() (gatewayv1.GatewayClient, error) {
+	var (
+		lock   sync.Mutex
+		client gatewayv1.GatewayClient
+	)
+	return func() (gatewayv1.GatewayClient, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if client != nil {
+			return client, nil
+		}
+		namespaces := scope.Namespaces
+		if len(namespaces) == 0 {
+			namespaces = []string{corev1.NamespaceAll}
+		}
+		created, err := helpers.GatewayClient(namespaces)
+		if err != nil {
+			return nil, errors.Wrap(err, "creating the client of the Gloo Gateways")
+		}
+		client = created
+		return client, nil
+	}
+}
+
+// makes the provider adding the filter to the Gateways selected by the Gloo deployment.
+// the Gateways are reported to the callbacks as the workloads of the FilterDeployment.
+// the ABI versions of the image are checked against the version of Gloo installed in the default gloo namespace
+func (f *filterDeploymentHandler) makeGlooProvider(dep *v1.GlooDeploymentSpec, puller pull.ImagePuller, onWorkloadsSelected func(workloadMetas []metav1.ObjectMeta), onWorkload func(workloadMeta metav1.ObjectMeta, err error)) (*gloo.Provider, error) {
+	if f.gatewayClient == nil {
+		return nil, errors.Errorf("deploying to Gloo is not supported by the operator")
+	}
+
+	// a deployment without namespaces updates the Gateways of every watched namespace
+	namespaces := dep.GetNamespaces()
+	if len(namespaces) == 0 {
+		namespaces = f.scope.Namespaces
+	}
+	for _, namespace := range namespaces {
+		if !f.scope.WatchesNamespace(namespace) {
+			return nil, errors.Errorf("namespace %v is not watched by the operator", namespace)
+		}
+	}
+
+	gatewayClient, err := f.gatewayClient()
+	if err != nil {
+		return nil, err
+	}
+	abiRegistry, err := LoadAbiRegistry(f.kubeClient, f.abiRegistry)
+	if err != nil {
+		return nil, err
+	}
+	return &gloo.Provider{
+		Ctx:           f.ctx,
+		GatewayClient: gatewayClient,
+		Selector: gloo.Selector{
+			Namespaces:    namespaces,
+			GatewayLabels: dep.GetGatewayLabels(),
+		},
+		OnWorkloadsSelected: onWorkloadsSelected,
+		OnWorkload:          onWorkload,
+		Puller:              puller,
+		VersionInspector:    gloo.NewVersionInspector(f.kubeClient, gloo.DefaultGlooNamespace),
+		AbiRegistry:         abiRegistry,
+	}, nil
+}
@@ -0,0 +1,209 @@
+package operator
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1/controller"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// the default name of the Lease held by the leader of the operator replicas
+	DefaultLeaseName = "wasme-operator"
+
+	DefaultLeaseDuration = 15 * time.Second
+	DefaultRenewDeadline = 10 * time.Second
+	DefaultRetryPeriod   = 2 * time.Second
+)
+
+// LeaderElectionOptions configure the election of the operator replica which deploys the filters,
+// with a coordination.k8s.io Lease
+type LeaderElectionOptions struct {
+	// if false, the replica deploys the filters without electing a leader
+	Enabled bool
+
+	// the name and namespace of the Lease
+	LeaseName      string
+	LeaseNamespace string
+
+	// how long the other replicas wait before taking over the Lease of a leader which stopped renewing it
+	LeaseDuration time.Duration
+	// how long the leader retries renewing the Lease before it stops leading.
+	// must be less than the LeaseDuration
+	RenewDeadline time.Duration
+	// the interval between the attempts to acquire or renew the Lease
+	RetryPeriod time.Duration
+}
+
+// LeaderGate passes the events of FilterDeployments to the handler only while the replica is the leader,
+// so a single replica updates the workloads, EnvoyFilters and cache config.
+// replicas which are not the leader keep their informer caches synced and serve the health endpoints,
+// dropping the events; once a replica becomes the leader, every FilterDeployment is re-deployed.
+type LeaderGate struct {
+	handler controller.FilterDeploymentEventHandler
+
+	lock    sync.Mutex
+	leading bool
+	// the events being handled
+	handling sync.WaitGroup
+}
+
+// NewLeaderGate returns a closed gate, which is opened by RunLeaderElection.
+// the gate of a replica running without leader election is opened by Open
+func NewLeaderGate(handler controller.FilterDeploymentEventHandler) *LeaderGate {
+	return &LeaderGate{handler: handler}
+}
+
+// IsLeader returns true while the events are passed to the handler
+func (g *LeaderGate) IsLeader() bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.leading
+}
+
+// Open passes the events to the handler
+func (g *LeaderGate) Open() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.leading = true
+}
+
+// Close drops the next events, without waiting for the events being handled
+func (g *LeaderGate) Close() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.leading = false
+}
+
+// waits for the events being handled when the gate was closed
+func (g *LeaderGate) wait() {
+	g.handling.Wait()
+}
+
+// calls handle if the gate is open
+func (g *LeaderGate) handle(event string, obj *v1.FilterDeployment, handle func() error) error {
+	g.lock.Lock()
+	if !g.leading {
+		g.lock.Unlock()
+		log.Log.V(1).Info("not the leader, ignoring event", "event", event, "filterdeployment", obj.Name)
+		return nil
+	}
+	g.handling.Add(1)
+	g.lock.Unlock()
+
+	defer g.handling.Done()
+	return handle()
+}
+
+func (g *LeaderGate) CreateFilterDeployment(obj *v1.FilterDeployment) error {
+	return g.handle("create", obj, func() error {
+		return g.handler.CreateFilterDeployment(obj)
+	})
+}
+
+func (g *LeaderGate) UpdateFilterDeployment(old, obj *v1.FilterDeployment) error {
+	return g.handle("update", obj, func() error {
+		return g.handler.UpdateFilterDeployment(old, obj)
+	})
+}
+
+func (g *LeaderGate) DeleteFilterDeployment(obj *v1.FilterDeployment) error {
+	return g.handle("delete", obj, func() error {
+		return g.handler.DeleteFilterDeployment(obj)
+	})
+}
+
+func (g *LeaderGate) GenericFilterDeployment(obj *v1.FilterDeployment) error {
+	return g.handle("generic", obj, func() error {
+		return g.handler.GenericFilterDeployment(obj)
+	})
+}
+
+// RunLeaderElection campaigns for the Lease until ctx is done, opening the gate while the replica is the leader.
+// onStartedLeading is called once the gate is opened, e.g. to re-deploy the FilterDeployments whose events were dropped.
+// once ctx is done, the gate is closed and the Lease is released after the events being handled are done,
+// so the next leader can take over without waiting for the Lease to expire.
+// returns an error if the replica fails to renew the Lease, as a replica which lost the Lease
+// while deploying a filter must exit rather than compete with the new leader
+func RunLeaderElection(ctx context.Context, kubeClient kubernetes.Interface, opts LeaderElectionOptions, gate *LeaderGate, onStartedLeading func()) error {
+	identity, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	// unique across restarts of the same pod
+	identity = identity + "_" + string(uuid.NewUUID())
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      opts.LeaseName,
+			Namespace: opts.LeaseNamespace,
+		},
+		Client:     kubeClient.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}
+
+	// the Lease is only released once the events being handled are done
+	electionCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-ctx.Done():
+			gate.Close()
+			gate.wait()
+			cancel()
+		case <-electionCtx.Done():
+		}
+	}()
+
+	var lost bool
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   opts.LeaseDuration,
+		RenewDeadline:   opts.RenewDeadline,
+		RetryPeriod:     opts.RetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            opts.LeaseNamespace + "/" + opts.LeaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(leadingCtx context.Context) {
+				if leadingCtx.Err() != nil {
+					// stopped leading before the callback ran
+					return
+				}
+				log.Log.Info("started leading, deploying filters", "identity", identity)
+				gate.Open()
+				if onStartedLeading != nil {
+					onStartedLeading()
+				}
+			},
+			OnStoppedLeading: func() {
+				gate.Close()
+				lost = electionCtx.Err() == nil
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					log.Log.Info("following the leader", "leader", leader)
+				}
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// returns once ctx is done, or the replica stops leading
+	elector.Run(electionCtx)
+	if lost {
+		return errors.Errorf("lost the leader election lease %v.%v", opts.LeaseName, opts.LeaseNamespace)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package operator
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1/controller"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// records the handled events, blocking on the FilterDeployment named "blocked" until released
+type blockingHandler struct {
+	controller.FilterDeploymentEventHandler
+
+	lock    sync.Mutex
+	updated []string
+
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingHandler() *blockingHandler {
+	return &blockingHandler{started: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (h *blockingHandler) UpdateFilterDeployment(_, obj *v1.FilterDeployment) error {
+	if obj.Name == "blocked" {
+		close(h.started)
+		<-h.release
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.updated = append(h.updated, obj.Name)
+	return nil
+}
+
+func (h *blockingHandler) handled() []string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return append([]string(nil), h.updated...)
+}
+
+var _ = Describe("Leader election", func() {
+	update := func(gate *LeaderGate, name string) {
+		obj := &v1.FilterDeployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+		Expect(gate.UpdateFilterDeployment(obj, obj)).NotTo(HaveOccurred())
+	}
+
+	It("passes the events to the handler only while the gate is open", func() {
+		handler := newBlockingHandler()
+		gate := NewLeaderGate(handler)
+
+		update(gate, "closed")
+		gate.Open()
+		Expect(gate.IsLeader()).To(BeTrue())
+		update(gate, "open")
+		gate.Close()
+		update(gate, "closed-again")
+
+		Expect(handler.handled()).To(Equal([]string{"open"}))
+	})
+
+	Context("with multiple replicas", func() {
+		var (
+			kube *fake.Clientset
+			opts = LeaderElectionOptions{
+				Enabled:        true,
+				LeaseName:      DefaultLeaseName,
+				LeaseNamespace: "wasme",
+				LeaseDuration:  time.Second,
+				RenewDeadline:  500 * time.Millisecond,
+				RetryPeriod:    100 * time.Millisecond,
+			}
+		)
+
+		type replica struct {
+			handler *blockingHandler
+			gate    *LeaderGate
+			cancel  context.CancelFunc
+			done    chan error
+
+			lock    sync.Mutex
+			resyncs int
+		}
+
+		startReplica := func() *replica {
+			r := &replica{handler: newBlockingHandler(), done: make(chan error, 1)}
+			r.gate = NewLeaderGate(r.handler)
+			var ctx context.Context
+			ctx, r.cancel = context.WithCancel(context.Background())
+			go func() {
+				defer GinkgoRecover()
+				r.done <- RunLeaderElection(ctx, kube, opts, r.gate, func() {
+					r.lock.Lock()
+					defer r.lock.Unlock()
+					r.resyncs++
+				})
+			}()
+			return r
+		}
+
+		resyncs := func(r *replica) func() int {
+			return func() int {
+				r.lock.Lock()
+				defer r.lock.Unlock()
+				return r.resyncs
+			}
+		}
+
+		BeforeEach(func() {
+			kube = fake.NewSimpleClientset()
+		})
+
+		It("transfers leadership once the leader is done with the event being handled", func() {
+			leader := startReplica()
+			Eventually(leader.gate.IsLeader, 5*time.Second).Should(BeTrue())
+			Eventually(resyncs(leader)).Should(Equal(1))
+
+			follower := startReplica()
+			defer follower.cancel()
+			Consistently(follower.gate.IsLeader, 2*opts.LeaseDuration).Should(BeFalse())
+			update(follower.gate, "dropped")
+			Expect(follower.handler.handled()).To(BeEmpty())
+			Expect(resyncs(follower)()).To(Equal(0))
+
+			// stop the leader in the middle of a reconcile
+			go func() {
+				defer GinkgoRecover()
+				update(leader.gate, "blocked")
+			}()
+			<-leader.handler.started
+			leader.cancel()
+
+			// the leader handles no more events, but keeps renewing the lease until the reconcile is done
+			Eventually(leader.gate.IsLeader).Should(BeFalse())
+			update(leader.gate, "after-cancel")
+			Consistently(follower.gate.IsLeader, 2*opts.LeaseDuration).Should(BeFalse())
+			Expect(leader.done).NotTo(Receive())
+
+			close(leader.handler.release)
+			Eventually(leader.done, 5*time.Second).Should(Receive(BeNil()))
+			Expect(leader.handler.handled()).To(Equal([]string{"blocked"}))
+
+			// the lease was released, so the follower takes over without waiting for it to expire
+			Eventually(follower.gate.IsLeader, opts.LeaseDuration).Should(BeTrue())
+			Eventually(resyncs(follower)).Should(Equal(1))
+			update(follower.gate, "new-leader")
+			Expect(follower.handler.handled()).To(Equal([]string{"new-leader"}))
+
+			lease, err := kube.CoordinationV1().Leases(opts.LeaseNamespace).Get(opts.LeaseName, metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*lease.Spec.LeaseTransitions).To(BeEquivalentTo(1))
+		})
+
+		It("returns an error once the leader fails to renew the lease", func() {
+			leader := startReplica()
+			defer leader.cancel()
+			Eventually(leader.gate.IsLeader, 5*time.Second).Should(BeTrue())
+
+			// another replica took over the lease
+			lease, err := kube.CoordinationV1().Leases(opts.LeaseNamespace).Get(opts.LeaseName, metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			other := "other"
+			now := metav1.NewMicroTime(time.Now())
+			lease.Spec.HolderIdentity = &other
+			lease.Spec.RenewTime = &now
+			_, err = kube.CoordinationV1().Leases(opts.LeaseNamespace).Update(lease)
+			Expect(err).NotTo(HaveOccurred())
+
+			var runErr error
+			Eventually(leader.done, 5*time.Second).Should(Receive(&runErr))
+			Expect(runErr).To(MatchError("lost the leader election lease wasme-operator.wasme"))
+			Expect(leader.gate.IsLeader()).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,87 @@
+package operator
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+)
+
+const (
+	metricsNamespace = "wasme"
+
+	reconcileResultSuccess = "success"
+	reconcileResultFailure = "failure"
+)
+
+// ReconcileMetrics instruments the deployments of FilterDeployments with prometheus metrics,
+// in addition to the metrics of the providers and of the controller-runtime controllers.
+// a nil *ReconcileMetrics records nothing
+type ReconcileMetrics struct {
+	reconcileDuration *prometheus.HistogramVec
+	reconcileFailures *prometheus.CounterVec
+	workloadsFailed   *prometheus.GaugeVec
+}
+
+// NewReconcileMetrics registers the metrics of the operator with the registerer
+func NewReconcileMetrics(registerer prometheus.Registerer) (*ReconcileMetrics, error) {
+	m := &ReconcileMetrics{
+		reconcileDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "filterdeployment_reconcile_duration_seconds",
+			Help:      "The time taken to deploy the filter of a FilterDeployment to its workloads.",
+			Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+		}, []string{"namespace", "result"}),
+		reconcileFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "filterdeployment_reconcile_failures_total",
+			Help:      "The number of deployments of the filter of a FilterDeployment which failed.",
+		}, []string{"namespace", "name"}),
+		workloadsFailed: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "filterdeployment_workloads_failed",
+			Help:      "The number of workloads the filter of a FilterDeployment failed to deploy to, as of its last deployment.",
+		}, []string{"namespace", "name"}),
+	}
+
+	for _, collector := range []prometheus.Collector{
+		m.reconcileDuration,
+		m.reconcileFailures,
+		m.workloadsFailed,
+	} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// records a deployment of the FilterDeployment, which failed if err is non-nil
+func (m *ReconcileMetrics) observeReconcile(obj *v1.FilterDeployment, start time.Time, statuses []*v1.WorkloadStatus, err error) {
+	if m == nil {
+		return
+	}
+	result := reconcileResultSuccess
+	if err != nil {
+		result = reconcileResultFailure
+		m.reconcileFailures.WithLabelValues(obj.Namespace, obj.Name).Inc()
+	}
+	m.reconcileDuration.WithLabelValues(obj.Namespace, result).Observe(time.Since(start).Seconds())
+
+	var failed int
+	for _, status := range statuses {
+		if status.GetState() == v1.WorkloadStatus_Failed {
+			failed++
+		}
+	}
+	m.workloadsFailed.WithLabelValues(obj.Namespace, obj.Name).Set(float64(failed))
+}
+
+// deletes the metrics of the FilterDeployment once its filter is removed
+func (m *ReconcileMetrics) forget(obj *v1.FilterDeployment) {
+	if m == nil {
+		return
+	}
+	m.reconcileFailures.DeleteLabelValues(obj.Namespace, obj.Name)
+	m.workloadsFailed.DeleteLabelValues(obj.Namespace, obj.Name)
+}
@@ -2,12 +2,15 @@ package operator
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/events"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	"github.com/pkg/errors"
+	gatewayv1 "github.com/solo-io/gloo/projects/gateway/pkg/api/v1"
 	"github.com/solo-io/skv2/pkg/ezkube"
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
 	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
@@ -15,8 +18,11 @@ import (
 	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
 	"github.com/solo-io/wasm/tools/wasme/pkg/resolver"
 	kubev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 )
 
 const (
@@ -27,19 +33,62 @@ const (
 type filterDeploymentHandler struct {
 	ctx context.Context
 
-	kubeClient kubernetes.Interface
-	client     ezkube.Ensurer
+	kubeClient    kubernetes.Interface
+	dynamicClient dynamic.Interface
+	client        ezkube.Ensurer
+	// creates the client of the Gloo Gateways, see NewGatewayClientFunc.
+	// deploying to Gloo fails if nil
+	gatewayClient func() (gatewayv1.GatewayClient, error)
 
-	cache        istio.Cache
-	cacheTimeout time.Duration
+	cache             istio.Cache
+	cacheTimeout      time.Duration
+	cachePollInterval time.Duration
+
+	// read before each deployment to extend the abi registry
+	abiRegistry AbiRegistryConfigMap
+
+	// optional, emits the filter lifecycle events
+	events *events.Emitter
+
+	// optional, records Kubernetes Events on the workloads
+	recorder record.EventRecorder
+
+	// optional, records the metrics of the providers
+	metrics *istio.Metrics
+
+	// optional, records the metrics of the deployments of FilterDeployments
+	reconcileMetrics *ReconcileMetrics
+
+	// the registry settings and timeout of every pull
+	pullOptions PullOptions
+
+	// the FilterDeployments managed by the handler, and the namespaces they may target
+	scope WatchScope
+
+	// serializes the deployments triggered by FilterDeployment and ConfigMap events
+	lock sync.Mutex
+
+	// the number of times the removal of the filter of a deleted FilterDeployment is attempted.
+	// defaults to DefaultCleanupAttempts
+	cleanupAttempts int
+	// the number of failed removals of the filter of each deleted FilterDeployment, by namespace/name
+	cleanupFailures map[string]int
 
 	// custom overrides for testing
 	makePullerFn   func(secretNamespace string, opts *v1.ImagePullOptions) (pull.ImagePuller, error)
-	makeProviderFn func(obj *v1.FilterDeployment, puller pull.ImagePuller, onWorkload func(workloadMeta metav1.ObjectMeta, err error)) (deploy.Provider, error)
+	makeProviderFn func(obj *v1.FilterDeployment, target *v1.WorkloadTarget, puller pull.ImagePuller, onWorkloadsSelected func(workloadMetas []metav1.ObjectMeta), onWorkload func(workloadMeta metav1.ObjectMeta, err error), onConfigUpdated func(workloadMeta metav1.ObjectMeta, configHash string)) (deploy.Provider, error)
+}
+
+// PullOptions configure how the operator pulls filter images.
+// the image pull options of a FilterDeployment add to the registry options
+type PullOptions struct {
+	Registry resolver.RegistryOptions
+	// if non-zero, the maximum length of time of each pull
+	Timeout time.Duration
 }
 
-func NewFilterDeploymentHandler(ctx context.Context, kubeClient kubernetes.Interface, client ezkube.Ensurer, cache istio.Cache, cacheTimeout time.Duration) controller.FilterDeploymentEventHandler {
-	return &filterDeploymentHandler{ctx: ctx, kubeClient: kubeClient, client: client, cache: cache, cacheTimeout: cacheTimeout}
+func NewFilterDeploymentHandler(ctx context.Context, kubeClient kubernetes.Interface, dynamicClient dynamic.Interface, client ezkube.Ensurer, gatewayClient func() (gatewayv1.GatewayClient, error), cache istio.Cache, cacheTimeout, cachePollInterval time.Duration, abiRegistry AbiRegistryConfigMap, emitter *events.Emitter, recorder record.EventRecorder, metrics *istio.Metrics, reconcileMetrics *ReconcileMetrics, pullOptions PullOptions, scope WatchScope) controller.FilterDeploymentEventHandler {
+	return &filterDeploymentHandler{ctx: ctx, kubeClient: kubeClient, dynamicClient: dynamicClient, client: client, gatewayClient: gatewayClient, cache: cache, cacheTimeout: cacheTimeout, cachePollInterval: cachePollInterval, abiRegistry: abiRegistry, events: emitter, recorder: recorder, metrics: metrics, reconcileMetrics: reconcileMetrics, pullOptions: pullOptions, scope: scope}
 }
 
 func (f *filterDeploymentHandler) CreateFilterDeployment(obj *v1.FilterDeployment) error {
@@ -61,37 +110,84 @@ func (f *filterDeploymentHandler) GenericFilterDeployment(obj *v1.FilterDeployme
 }
 
 func (f *filterDeploymentHandler) deploy(obj *v1.FilterDeployment) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
 	// refresh obj
 	if err := f.client.Get(f.ctx, obj); err != nil {
+		if kubeerrors.IsNotFound(err) {
+			// deleted once its finalizer was removed
+			return nil
+		}
 		return err
 	}
 
-	status := v1.FilterDeploymentStatus{
-		ObservedGeneration: obj.Generation,
-		Workloads:          map[string]*v1.WorkloadStatus{},
+	// a FilterDeployment which left the scope keeps its filter, status and finalizer
+	if !f.scope.Selects(obj) {
+		log.Log.V(1).Info("ignoring FilterDeployment outside of the watch scope", "filterdeployment", obj.Name)
+		return nil
 	}
 
-	setWorkloadStatus := func(workloadMeta metav1.ObjectMeta, err error) {
-		workloadStatus := &v1.WorkloadStatus{
-			State: v1.WorkloadStatus_Succeeded,
-		}
-		if err != nil {
-			workloadStatus = &v1.WorkloadStatus{
-				Reason: err.Error(),
-				State:  v1.WorkloadStatus_Failed,
+	if obj.DeletionTimestamp != nil {
+		return f.finalize(obj)
+	}
+	if err := f.addFinalizer(obj); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	previous := obj.Status
+	f.recordApplyStarted(obj)
+
+	workloads := newWorkloadStatuses(obj)
+	targets := deploymentTargets(obj)
+
+	// the filter is removed from the targets removed since the last deployment before it is applied,
+	// so the workloads selected by both a removed and a current target keep the filter
+	var removeErr error
+	for _, target := range removedTargets(obj, targets) {
+		if err := f.handleFilter(obj, true, []*v1.WorkloadTarget{target}, nil, nil, nil, nil); err != nil {
+			log.Log.Error(err, "failed to remove filter from removed target", "filterdeployment", obj.Name, "target", describeTarget(target))
+			workloads.removeFailed(&obj.Status, target, err)
+			if removeErr == nil {
+				removeErr = errors.Wrapf(err, "removing filter from %v", describeTarget(target))
 			}
 		}
-		log.Log.V(1).Info("applied filter to workload", "result", workloadStatus)
-		status.Workloads[workloadMeta.Name] = workloadStatus
 	}
 
-	err := f.handleFilter(obj, false, setWorkloadStatus)
+	// the status is written even if the filter was only applied to some of the workloads
+	// the config of the filter may be resolved from its configFrom or defaulted from the image by the provider,
+	// so the checksum is that of the deployed config rather than the spec
+	var configHash string
+	err := f.handleFilter(obj, false, targets, workloads.selected, workloads.set, workloads.configUpdated, func(configChecksum string) {
+		if configHash == "" {
+			configHash = configChecksum
+		}
+	})
+	workloads.done(err)
+	if err == nil {
+		err = removeErr
+	}
+
+	status := v1.FilterDeploymentStatus{
+		ObservedGeneration: obj.Generation,
+		Workloads:          workloads.legacy,
+		WorkloadStatuses:   workloads.statuses,
+		Ready:              workloads.ready(),
+		Conditions:         deploymentConditions(obj.Generation, err, workloads),
+	}
 
 	if err != nil {
 		status.Reason = err.Error()
 	}
 
+	if obj.Spec.GetFilter().GetConfigChecksum() {
+		status.ConfigHash = configHash
+	}
+
 	obj.Status = status
+	f.reconcileMetrics.observeReconcile(obj, start, status.WorkloadStatuses, err)
+	f.recordApplyOutcome(obj, previous, err)
 
 	if err := f.client.UpdateStatus(f.ctx, obj); err != nil {
 		log.Log.Error(err, "failed to update status", "filterdeployment", obj.Name)
@@ -100,28 +196,22 @@ func (f *filterDeploymentHandler) deploy(obj *v1.FilterDeployment) error {
 	return nil
 }
 
+// removes the filter of a FilterDeployment deleted without the cleanup finalizer, e.g. before the operator added it.
+// the filter of a FilterDeployment deleted with the finalizer was removed when it was finalized
 func (f *filterDeploymentHandler) undeploy(obj *v1.FilterDeployment) error {
-	// refresh obj
-	if err := f.client.Get(f.ctx, obj); err != nil {
-		return err
-	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
 
-	status := v1.FilterDeploymentStatus{
-		ObservedGeneration: obj.Generation,
-		Workloads:          map[string]*v1.WorkloadStatus{},
+	if obj.DeletionTimestamp != nil || !f.scope.Selects(obj) {
+		return nil
 	}
 
-	err := f.handleFilter(obj, true, nil)
-
-	if err != nil {
-		status.Reason = err.Error()
-	}
-
-	obj.Status = status
-
-	if err := f.client.UpdateStatus(f.ctx, obj); err != nil {
-		log.Log.Error(err, "failed to update status", "filterdeployment", obj.Name)
+	// the FilterDeployment no longer exists, so its status cannot be written
+	targets := deploymentTargets(obj)
+	if err := f.handleFilter(obj, true, append(targets, removedTargets(obj, targets)...), nil, nil, nil, nil); err != nil {
+		log.Log.Error(err, "failed to remove filter", "filterdeployment", obj.Name)
 	}
+	f.reconcileMetrics.forget(obj)
 
 	return nil
 }
@@ -142,14 +232,27 @@ func getDeployment(obj *v1.FilterDeployment) (*v1.DeploymentSpec, error) {
 	if deployment == nil {
 		return nil, errors.Errorf("must provide spec.deployment")
 	}
+	if deployment.GetDeploymentType() == nil {
+		return nil, errors.Errorf("must provide one of spec.deployment.istio, spec.deployment.gloo")
+	}
 	return deployment, nil
 }
 
-func (f *filterDeploymentHandler) handleFilter(obj *v1.FilterDeployment, remove bool, onWorkload func(workloadMeta metav1.ObjectMeta, err error)) error {
+// applies or removes the filter for each of the targets, continuing with the next targets if it fails for a target.
+// the callbacks are called with the target which selected the workloads, if set,
+// and onConfigResolved with the checksum injected into the deployed config of the filter for each target it was applied to.
+// returns the first error; the error of a FilterDeployment with several targets names the target it failed for
+func (f *filterDeploymentHandler) handleFilter(obj *v1.FilterDeployment, remove bool, targets []*v1.WorkloadTarget, onWorkloadsSelected func(target *v1.WorkloadTarget, workloadMetas []metav1.ObjectMeta), onWorkload func(target *v1.WorkloadTarget, workloadMeta metav1.ObjectMeta, err error), onConfigUpdated func(target *v1.WorkloadTarget, workloadMeta metav1.ObjectMeta, configHash string), onConfigResolved func(configChecksum string)) error {
 	filter, err := getFilter(obj)
 	if err != nil {
 		return err
 	}
+	// report every invalid field in the status, before pulling the image
+	if !remove && obj.Spec.GetDeployment().GetIstio() != nil {
+		if err := istio.Validate(filter); err != nil {
+			return err
+		}
+	}
 
 	makePuller := f.makePuller
 	if f.makePullerFn != nil {
@@ -164,19 +267,61 @@ func (f *filterDeploymentHandler) handleFilter(obj *v1.FilterDeployment, remove
 	if f.makeProviderFn != nil {
 		makeProvider = f.makeProviderFn
 	}
-	deployer, err := makeProvider(obj, puller, onWorkload)
-	if err != nil {
-		return err
-	}
 
-	if remove {
-		return deployer.RemoveFilter(filter)
-	}
+	var firstErr error
+	for _, target := range targets {
+		target := target
+		var selected func(workloadMetas []metav1.ObjectMeta)
+		if onWorkloadsSelected != nil {
+			selected = func(workloadMetas []metav1.ObjectMeta) { onWorkloadsSelected(target, workloadMetas) }
+		}
+		var done func(workloadMeta metav1.ObjectMeta, err error)
+		if onWorkload != nil {
+			done = func(workloadMeta metav1.ObjectMeta, err error) { onWorkload(target, workloadMeta, err) }
+		}
+		var configUpdated func(workloadMeta metav1.ObjectMeta, configHash string)
+		if onConfigUpdated != nil {
+			configUpdated = func(workloadMeta metav1.ObjectMeta, configHash string) {
+				onConfigUpdated(target, workloadMeta, configHash)
+			}
+		}
 
-	return deployer.ApplyFilter(filter)
+		var deployer deploy.Provider
+		if target != nil && !f.scope.WatchesNamespace(target.Namespace) {
+			err = errors.Errorf("namespace %v is not watched by the operator", target.Namespace)
+		} else {
+			deployer, err = makeProvider(obj, target, puller, selected, done, configUpdated)
+		}
+		if err == nil {
+			if remove {
+				err = deployer.RemoveFilter(filter)
+			} else if resolver, ok := deployer.(deploy.ConfigResolver); ok && onConfigResolved != nil {
+				var configChecksum string
+				configChecksum, err = resolver.ApplyResolvedFilter(filter)
+				if err == nil {
+					onConfigResolved(configChecksum)
+				}
+			} else {
+				err = deployer.ApplyFilter(filter)
+			}
+		}
+		if err == nil {
+			continue
+		}
+		if len(targets) > 1 {
+			err = errors.Wrapf(err, "%v", describeTarget(target))
+		}
+		if firstErr != nil {
+			log.Log.Error(err, "failed to deploy filter to target", "filterdeployment", obj.Name)
+			continue
+		}
+		firstErr = err
+	}
+	return firstErr
 }
 
-func (f *filterDeploymentHandler) makeProvider(obj *v1.FilterDeployment, puller pull.ImagePuller, onWorkload func(workloadMeta metav1.ObjectMeta, err error)) (deploy.Provider, error) {
+// makes the provider deploying the filter to the target, see deploymentTargets
+func (f *filterDeploymentHandler) makeProvider(obj *v1.FilterDeployment, target *v1.WorkloadTarget, puller pull.ImagePuller, onWorkloadsSelected func(workloadMetas []metav1.ObjectMeta), onWorkload func(workloadMeta metav1.ObjectMeta, err error), onConfigUpdated func(workloadMeta metav1.ObjectMeta, configHash string)) (deploy.Provider, error) {
 	deployment, err := getDeployment(obj)
 	if err != nil {
 		return nil, err
@@ -186,35 +331,80 @@ func (f *filterDeploymentHandler) makeProvider(obj *v1.FilterDeployment, puller
 	switch dep := deployment.GetDeploymentType().(type) {
 	case *v1.DeploymentSpec_Istio:
 		workload := istio.Workload{
-			Kind:      dep.Istio.GetKind(),
-			Labels:    dep.Istio.GetLabels(),
-			Namespace: obj.Namespace,
+			Kind:      target.GetKind(),
+			Name:      target.GetName(),
+			Labels:    target.GetLabels(),
+			Namespace: target.GetNamespace(),
+		}
+		var parentObject ezkube.Object = obj
+		if workload.Namespace != obj.Namespace {
+			// owner references cannot cross namespaces, so the EnvoyFilters
+			// of the target are deleted explicitly by RemoveFilter
+			parentObject = nil
 		}
 
-		provider, err = istio.NewProvider(
+		istioProvider, err := istio.NewProvider(
 			f.ctx,
 			f.kubeClient,
 			f.client,
 			puller,
 			workload,
 			f.cache,
-			obj,
+			parentObject,
 			onWorkload,
 			dep.Istio.IstioNamespace,
+			dep.Istio.IstioRevision,
 			f.cacheTimeout,
 			false,
 		)
 		if err != nil {
 			return nil, err
 		}
+		istioProvider.AbiRegistry, err = LoadAbiRegistry(f.kubeClient, f.abiRegistry)
+		if err != nil {
+			return nil, err
+		}
+		istioProvider.CachePollInterval = f.cachePollInterval
+		istioProvider.OnWorkloadsSelected = onWorkloadsSelected
+		istioProvider.OnConfigUpdated = onConfigUpdated
+		// the EnvoyFilters of a FilterDeployment being finalized are not garbage collected until it is deleted
+		istioProvider.PruneCache = obj.DeletionTimestamp != nil
+		istioProvider.DisableProxyVersionMatch = dep.Istio.DisableProxyVersionMatch
+		istioProvider.MeshWide = dep.Istio.MeshWide
+		istioProvider.RemoteDatasource = dep.Istio.RemoteDatasource
+		istioProvider.IncludeUninjected = dep.Istio.IncludeUninjected
+		istioProvider.SelectorLabels = dep.Istio.SelectorLabels
+		istioProvider.VerifyOptions = istio.SignatureVerifyOptions(obj.Spec.GetFilter().GetVerifySignature())
+		istioProvider.Recorder = f.recorder
+		if f.recorder != nil {
+			istioProvider.OnDrift = func(drift string) {
+				f.recorder.Eventf(obj, kubev1.EventTypeNormal, EventReasonDriftCorrected, "corrected drift of filter: %v", drift)
+			}
+		}
+		istioProvider.Metrics = f.metrics
+		// log with the controller-runtime logger, tagging entries with the FilterDeployment
+		istioProvider.Logger = istio.NewLogrLogger(log.Log.WithValues("filterdeployment", obj.Name+"."+obj.Namespace))
+		istioProvider.DynamicClient = f.dynamicClient
+		istioProvider.WorkloadOrdering, err = istio.ParseWorkloadOrdering(dep.Istio.WorkloadOrder)
+		if err != nil {
+			return nil, err
+		}
+		provider = istioProvider
+	case *v1.DeploymentSpec_Gloo:
+		provider, err = f.makeGlooProvider(dep.Gloo, puller, onWorkloadsSelected, onWorkload)
+		if err != nil {
+			return nil, err
+		}
 	default:
 		return nil, errors.Errorf("internal error: %T not implemented", deployment)
 	}
 	// deployer sets the root_id on the filter if the user hasn't provided one
 	return &deploy.Deployer{
-		Ctx:      f.ctx,
-		Puller:   puller,
-		Provider: provider,
+		Ctx:          f.ctx,
+		Puller:       puller,
+		Provider:     provider,
+		Events:       f.events,
+		EventSubject: obj.Namespace + "/" + obj.Name,
 	}, nil
 }
 
@@ -252,7 +442,17 @@ func (f *filterDeploymentHandler) makePuller(secretNamespace string, opts *v1.Im
 		password = string(p)
 	}
 
-	resolver, _ := resolver.NewResolver(username, password, opts.GetInsecureSkipVerify(), opts.GetPlainHttp())
+	registryOptions := f.pullOptions.Registry
+	if opts.GetInsecureSkipVerify() {
+		registryOptions.InsecureHosts = append(registryOptions.InsecureHosts, resolver.AllHosts)
+	}
+	if opts.GetPlainHttp() {
+		registryOptions.PlainHTTPHosts = append(registryOptions.PlainHTTPHosts, resolver.AllHosts)
+	}
+	res, _, err := resolver.NewResolverWithOptions(resolver.ConfigCredentials(username, password), registryOptions)
+	if err != nil {
+		return nil, err
+	}
 
-	return pull.NewPuller(resolver), nil
+	return pull.NewPullerWithOptions(res, pull.Options{Timeout: f.pullOptions.Timeout}), nil
 }
@@ -2,18 +2,37 @@ package operator
 
 import (
 	"context"
+	"io/ioutil"
+	"strings"
 	"time"
 
 	"github.com/solo-io/skv2/pkg/ezkube"
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy"
 	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	"github.com/solo-io/wasm/tools/wasme/pkg/config"
 	"github.com/solo-io/wasm/tools/wasme/pkg/consts/test"
+	"github.com/solo-io/wasm/tools/wasme/pkg/model"
 	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
 
 	"github.com/gogo/protobuf/types"
 	"github.com/golang/mock/gomock"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/solo-io/wasm/tools/wasme/cli/test/metricsutils"
+	appsv1 "k8s.io/api/apps/v1"
+	kubev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	gatewayv1 "github.com/solo-io/gloo/projects/gateway/pkg/api/v1"
+	"github.com/solo-io/solo-kit/pkg/api/v1/clients"
+	"github.com/solo-io/solo-kit/pkg/api/v1/clients/factory"
+	"github.com/solo-io/solo-kit/pkg/api/v1/clients/memory"
+	"github.com/solo-io/solo-kit/pkg/api/v1/resources/core"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -32,6 +51,8 @@ var _ = Describe("FilterDeploymentEventHandler", func() {
 		client           *mockClient
 		provider         *mockProvider
 		mockCtrl         *gomock.Controller
+		// the targets providers were made for
+		providerTargets []*v1.WorkloadTarget
 	)
 	BeforeEach(func() {
 		kubeClient = fake.NewSimpleClientset()
@@ -40,21 +61,27 @@ var _ = Describe("FilterDeploymentEventHandler", func() {
 
 		client = &mockClient{MockEnsurer: mock_ezkube.NewMockEnsurer(mockCtrl)}
 		provider = &mockProvider{MockProvider: mock_deploy.NewMockProvider(mockCtrl)}
+		providerTargets = nil
 
 		handler = &filterDeploymentHandler{
 			ctx:        context.TODO(),
 			kubeClient: kubeClient,
 			client:     client,
 			cache:      istio.Cache{Name: "cache-name", Namespace: "cache-namespace"},
-			makeProviderFn: func(obj *v1.FilterDeployment, puller pull.ImagePuller, onWorkload func(workloadMeta metav1.ObjectMeta, err error)) (deploy.Provider, error) {
+			makeProviderFn: func(obj *v1.FilterDeployment, target *v1.WorkloadTarget, puller pull.ImagePuller, onWorkloadsSelected func(workloadMetas []metav1.ObjectMeta), onWorkload func(workloadMeta metav1.ObjectMeta, err error), onConfigUpdated func(workloadMeta metav1.ObjectMeta, configHash string)) (deploy.Provider, error) {
+				providerTargets = append(providerTargets, target)
+				provider.onWorkloadsSelectedFn = onWorkloadsSelected
 				provider.onWorkloadFn = onWorkload
+				provider.onConfigUpdatedFn = onConfigUpdated
 				return provider, nil
 			},
 		}
 
-		// need to set deletion timestamp or fmt.Sprintf() panics
 		d := metav1.NewTime(time.Now())
 
+		config, err := types.MarshalAny(&types.StringValue{Value: `{"name":"hello","value":"world"}`})
+		Expect(err).NotTo(HaveOccurred())
+
 		filterDeployment = &v1.FilterDeployment{
 			TypeMeta: metav1.TypeMeta{
 				Kind:       "FilterDeployment",
@@ -65,15 +92,12 @@ var _ = Describe("FilterDeploymentEventHandler", func() {
 				Name:              "myfilter",
 				Namespace:         "bookinfo",
 				CreationTimestamp: d,
-				DeletionTimestamp: &d,
+				Finalizers:        []string{CleanupFinalizer},
 			},
 			Spec: v1.FilterDeploymentSpec{
 				Filter: &v1.FilterSpec{
-					Image: test.IstioAssemblyScriptImage,
-					Config: &types.Any{
-						TypeUrl: "type.googleapis.com/google.protobuf.StringValue",
-						Value:   []byte(`{"name":"hello","value":"world"}`),
-					},
+					Image:  test.IstioAssemblyScriptImage,
+					Config: config,
 				},
 				Deployment: &v1.DeploymentSpec{
 					DeploymentType: &v1.DeploymentSpec_Istio{Istio: &v1.IstioDeploymentSpec{
@@ -86,6 +110,8 @@ var _ = Describe("FilterDeploymentEventHandler", func() {
 	AfterEach(func() {
 		mockCtrl.Finish()
 	})
+	// the target of the kind of the deployment
+	target := &v1.WorkloadTarget{Kind: "deployment", Namespace: "bookinfo"}
 	applyTest := func(applyFunc func(obj *v1.FilterDeployment) error) {
 		provider.EXPECT().ApplyFilter(filterDeployment.Spec.Filter).Return(nil)
 		client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil)
@@ -109,8 +135,24 @@ var _ = Describe("FilterDeploymentEventHandler", func() {
 			Workloads: map[string]*v1.WorkloadStatus{
 				"test-workload": {State: v1.WorkloadStatus_Succeeded},
 			},
+			WorkloadStatuses: []*v1.WorkloadStatus{
+				{Name: "test-workload", State: v1.WorkloadStatus_FilterCreated, ObservedGeneration: 1, Target: target},
+			},
+			Ready: "1/1",
+			Conditions: []*v1.Condition{
+				{Type: ConditionReady, Status: ConditionTrue, Reason: "FilterDeployed", Message: "the filter was created for 1/1 workloads", ObservedGeneration: 1},
+				{Type: ConditionCacheReady, Status: ConditionTrue, Reason: "ImageCached", ObservedGeneration: 1},
+				{Type: ConditionAbiCompatible, Status: ConditionTrue, Reason: "AbiVersionSupported", ObservedGeneration: 1},
+			},
 		}))
 	}
+	conditionStatuses := func(status v1.FilterDeploymentStatus) map[string]string {
+		statuses := map[string]string{}
+		for _, condition := range status.Conditions {
+			statuses[condition.Type] = condition.Status
+		}
+		return statuses
+	}
 	It("handles create event", func() {
 		applyTest(handler.CreateFilterDeployment)
 	})
@@ -119,39 +161,666 @@ var _ = Describe("FilterDeploymentEventHandler", func() {
 			return handler.UpdateFilterDeployment(nil, obj)
 		})
 	})
-	It("handles delete event", func() {
-		provider.EXPECT().RemoveFilter(filterDeployment.Spec.Filter).Return(nil)
+	It("reports the workloads skipped for not running the sidecar", func() {
+		provider.EXPECT().ApplyFilter(filterDeployment.Spec.Filter).Return(nil)
 		client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil)
 		client.EXPECT().UpdateStatus(gomock.Any(), gomock.Any()).Return(nil)
 
-		err := handler.DeleteFilterDeployment(filterDeployment)
+		provider.workloadMeta = metav1.ObjectMeta{Name: "test-workload"}
+		provider.err = &istio.UninjectedWorkloadError{Workload: "test-workload", Namespace: "bookinfo"}
+
+		err := handler.CreateFilterDeployment(filterDeployment)
 		Expect(err).NotTo(HaveOccurred())
 
-		updated := client.updatedObjStatus
-		Expect(updated).NotTo(BeNil())
+		updatedFilter := client.updatedObjStatus.(*v1.FilterDeployment)
+		Expect(updatedFilter.Status.Reason).To(BeEmpty())
+		Expect(updatedFilter.Status.Workloads).To(HaveKeyWithValue("test-workload", &v1.WorkloadStatus{
+			State:  v1.WorkloadStatus_Skipped,
+			Reason: provider.err.Error(),
+		}))
+	})
+	It("writes the status of every selected workload if the filter is only applied to some of them", func() {
+		applyErr := errors.New("rollout timed out")
+		provider.EXPECT().ApplyFilter(filterDeployment.Spec.Filter).Return(applyErr)
+		client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil)
+		client.EXPECT().UpdateStatus(gomock.Any(), gomock.Any()).Return(nil)
 
-		Expect(updated).To(BeAssignableToTypeOf(&v1.FilterDeployment{}))
+		provider.selected = []metav1.ObjectMeta{
+			{Name: "first", Namespace: "bookinfo"},
+			{Name: "second", Namespace: "bookinfo"},
+			{Name: "third", Namespace: "bookinfo"},
+		}
+		provider.workloadMeta = provider.selected[0]
 
-		updatedFilter := updated.(*v1.FilterDeployment)
-		Expect(updatedFilter.Status).To(Equal(v1.FilterDeploymentStatus{
-			ObservedGeneration: 1,
-			Workloads:          map[string]*v1.WorkloadStatus{},
+		err := handler.CreateFilterDeployment(filterDeployment)
+		Expect(err).NotTo(HaveOccurred())
+
+		status := client.updatedObjStatus.(*v1.FilterDeployment).Status
+		Expect(status.Reason).To(Equal(applyErr.Error()))
+		Expect(status.Ready).To(Equal("1/3"))
+		Expect(status.WorkloadStatuses).To(Equal([]*v1.WorkloadStatus{
+			{Name: "first", Namespace: "bookinfo", Target: target, State: v1.WorkloadStatus_FilterCreated, ObservedGeneration: 1},
+			{Name: "second", Namespace: "bookinfo", Target: target, State: v1.WorkloadStatus_Pending, Message: notReachedMessage, ObservedGeneration: 1},
+			{Name: "third", Namespace: "bookinfo", Target: target, State: v1.WorkloadStatus_Pending, Message: notReachedMessage, ObservedGeneration: 1},
+		}))
+		Expect(conditionStatuses(status)).To(Equal(map[string]string{
+			ConditionReady:         ConditionFalse,
+			ConditionCacheReady:    ConditionTrue,
+			ConditionAbiCompatible: ConditionTrue,
+		}))
+	})
+	It("reports the workloads whose filter config was updated without restarting them", func() {
+		provider.EXPECT().ApplyFilter(filterDeployment.Spec.Filter).Return(nil)
+		client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil)
+		client.EXPECT().UpdateStatus(gomock.Any(), gomock.Any()).Return(nil)
+		provider.workloadMeta = metav1.ObjectMeta{Name: "test-workload"}
+		provider.configHash = "sha256:abc"
+
+		Expect(handler.UpdateFilterDeployment(nil, filterDeployment)).NotTo(HaveOccurred())
+
+		status := client.updatedObjStatus.(*v1.FilterDeployment).Status
+		Expect(status.WorkloadStatuses).To(Equal([]*v1.WorkloadStatus{
+			{Name: "test-workload", State: v1.WorkloadStatus_FilterCreated, ObservedGeneration: 1, Target: target, RestartSkipped: true, ConfigHash: "sha256:abc"},
+		}))
+		Expect(status.Ready).To(Equal("1/1"))
+	})
+	It("reports the checksum of the config resolved by the provider", func() {
+		// the config of filters read from configFrom is only injected with the checksum by the provider
+		filterDeployment.Spec.Filter.Config = nil
+		filterDeployment.Spec.Filter.ConfigChecksum = true
+		filterDeployment.Spec.Filter.ConfigFrom = &v1.ConfigSource{ConfigMapKeyRef: &v1.KeyReference{Name: "my-config", Key: "config.json"}}
+		provider.EXPECT().ApplyFilter(filterDeployment.Spec.Filter).Return(nil)
+		client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil)
+		client.EXPECT().UpdateStatus(gomock.Any(), gomock.Any()).Return(nil)
+		provider.resolvedConfigChecksum = "sha256:abc"
+
+		Expect(handler.UpdateFilterDeployment(nil, filterDeployment)).NotTo(HaveOccurred())
+
+		Expect(client.updatedObjStatus.(*v1.FilterDeployment).Status.ConfigHash).To(Equal("sha256:abc"))
+	})
+	It("does not count the skipped workloads as ready", func() {
+		provider.EXPECT().ApplyFilter(filterDeployment.Spec.Filter).Return(nil)
+		client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil)
+		client.EXPECT().UpdateStatus(gomock.Any(), gomock.Any()).Return(nil)
+
+		provider.workloadMeta = metav1.ObjectMeta{Name: "test-workload"}
+		provider.err = &istio.UninjectedWorkloadError{Workload: "test-workload", Namespace: "bookinfo"}
+
+		err := handler.CreateFilterDeployment(filterDeployment)
+		Expect(err).NotTo(HaveOccurred())
+
+		status := client.updatedObjStatus.(*v1.FilterDeployment).Status
+		Expect(status.Ready).To(Equal("0/0"))
+		Expect(status.WorkloadStatuses[0].State).To(Equal(v1.WorkloadStatus_Skipped))
+		Expect(status.WorkloadStatuses[0].Message).To(Equal(provider.err.Error()))
+	})
+	It("reports the annotated workloads of mesh-wide filters as created once the filter is created", func() {
+		filterDeployment.Spec.Deployment.GetIstio().MeshWide = true
+		provider.EXPECT().ApplyFilter(filterDeployment.Spec.Filter).Return(nil)
+		client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil)
+		client.EXPECT().UpdateStatus(gomock.Any(), gomock.Any()).Return(nil)
+
+		provider.workloadMeta = metav1.ObjectMeta{Name: "test-workload"}
+
+		err := handler.CreateFilterDeployment(filterDeployment)
+		Expect(err).NotTo(HaveOccurred())
+
+		status := client.updatedObjStatus.(*v1.FilterDeployment).Status
+		Expect(status.WorkloadStatuses[0].State).To(Equal(v1.WorkloadStatus_FilterCreated))
+		Expect(status.Ready).To(Equal("1/1"))
+	})
+	It("reports the annotated workloads of mesh-wide filters if the mesh-wide filter is not created", func() {
+		filterDeployment.Spec.Deployment.GetIstio().MeshWide = true
+		provider.EXPECT().ApplyFilter(filterDeployment.Spec.Filter).Return(errors.New("creating mesh-wide EnvoyFilter: conflict"))
+		client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil)
+		client.EXPECT().UpdateStatus(gomock.Any(), gomock.Any()).Return(nil)
+
+		provider.workloadMeta = metav1.ObjectMeta{Name: "test-workload"}
+
+		err := handler.CreateFilterDeployment(filterDeployment)
+		Expect(err).NotTo(HaveOccurred())
+
+		status := client.updatedObjStatus.(*v1.FilterDeployment).Status
+		Expect(status.WorkloadStatuses[0].State).To(Equal(v1.WorkloadStatus_AnnotationsApplied))
+		Expect(status.Ready).To(Equal("0/1"))
+	})
+	It("reports images which are not supported by the istio version", func() {
+		provider.EXPECT().ApplyFilter(filterDeployment.Spec.Filter).Return(&istio.AbiIncompatibleError{Image: test.IstioAssemblyScriptImage, IstioVersion: "1.5.0"})
+		client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil)
+		client.EXPECT().UpdateStatus(gomock.Any(), gomock.Any()).Return(nil)
+
+		err := handler.CreateFilterDeployment(filterDeployment)
+		Expect(err).NotTo(HaveOccurred())
+
+		status := client.updatedObjStatus.(*v1.FilterDeployment).Status
+		Expect(status.Ready).To(Equal("0/0"))
+		Expect(conditionStatuses(status)).To(Equal(map[string]string{
+			ConditionReady:         ConditionFalse,
+			ConditionCacheReady:    ConditionUnknown,
+			ConditionAbiCompatible: ConditionFalse,
 		}))
 	})
+	It("reports images which could not be cached", func() {
+		cacheErr := &istio.CacheError{Image: test.IstioAssemblyScriptImage, Err: errors.New("timed out")}
+		provider.EXPECT().ApplyFilter(filterDeployment.Spec.Filter).Return(errors.Wrap(cacheErr, "deploying filter"))
+		client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil)
+		client.EXPECT().UpdateStatus(gomock.Any(), gomock.Any()).Return(nil)
+
+		err := handler.CreateFilterDeployment(filterDeployment)
+		Expect(err).NotTo(HaveOccurred())
+
+		status := client.updatedObjStatus.(*v1.FilterDeployment).Status
+		Expect(conditionStatuses(status)).To(Equal(map[string]string{
+			ConditionReady:         ConditionFalse,
+			ConditionCacheReady:    ConditionFalse,
+			ConditionAbiCompatible: ConditionTrue,
+		}))
+	})
+	It("reports every invalid field of the filter without deploying it", func() {
+		filterDeployment.Spec.Filter.Image = ""
+		filterDeployment.Spec.Filter.PatchContext = "sideways"
+		client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil)
+		client.EXPECT().UpdateStatus(gomock.Any(), gomock.Any()).Return(nil)
+
+		err := handler.CreateFilterDeployment(filterDeployment)
+		Expect(err).NotTo(HaveOccurred())
+
+		updatedFilter := client.updatedObjStatus.(*v1.FilterDeployment)
+		Expect(updatedFilter.Status.Reason).To(ContainSubstring("image: must not be empty"))
+		Expect(updatedFilter.Status.Reason).To(ContainSubstring("unknown patch context sideways"))
+	})
+	It("adds the cleanup finalizer before deploying the filter", func() {
+		filterDeployment.Finalizers = nil
+		provider.EXPECT().ApplyFilter(filterDeployment.Spec.Filter).Return(nil)
+		client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil)
+		client.EXPECT().Update(gomock.Any(), filterDeployment).Return(nil)
+		client.EXPECT().UpdateStatus(gomock.Any(), gomock.Any()).Return(nil)
+
+		err := handler.CreateFilterDeployment(filterDeployment)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filterDeployment.Finalizers).To(Equal([]string{CleanupFinalizer}))
+	})
+	Context("deleted FilterDeployments", func() {
+		BeforeEach(func() {
+			d := metav1.NewTime(time.Now())
+			filterDeployment.DeletionTimestamp = &d
+			filterDeployment.Finalizers = []string{"other", CleanupFinalizer}
+		})
+		It("removes the filter, then the finalizer", func() {
+			gomock.InOrder(
+				client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil),
+				provider.EXPECT().RemoveFilter(filterDeployment.Spec.Filter).Return(nil),
+				client.EXPECT().Update(gomock.Any(), filterDeployment).Return(nil),
+			)
+
+			err := handler.UpdateFilterDeployment(nil, filterDeployment)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filterDeployment.Finalizers).To(Equal([]string{"other"}))
+		})
+		It("retries the removal of the filter, then removes the finalizer with a warning", func() {
+			recorder := record.NewFakeRecorder(10)
+			handler.recorder = recorder
+			handler.cleanupAttempts = 3
+			removeErr := errors.New("namespace bookinfo is being terminated")
+			client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil).Times(3)
+			provider.EXPECT().RemoveFilter(filterDeployment.Spec.Filter).Return(removeErr).Times(3)
+
+			for i := 0; i < 2; i++ {
+				err := handler.UpdateFilterDeployment(nil, filterDeployment)
+				Expect(err).To(Equal(removeErr))
+				Expect(filterDeployment.Finalizers).To(ContainElement(CleanupFinalizer))
+			}
+
+			client.EXPECT().Update(gomock.Any(), filterDeployment).Return(nil)
+			err := handler.UpdateFilterDeployment(nil, filterDeployment)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filterDeployment.Finalizers).To(Equal([]string{"other"}))
+			Expect(recorder.Events).To(Receive(ContainSubstring(EventReasonCleanupFailed)))
+		})
+		It("ignores FilterDeployments which were already deleted", func() {
+			client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(kubeerrors.NewNotFound(schema.GroupResource{Group: "wasme.io", Resource: "filterdeployments"}, filterDeployment.Name))
+
+			err := handler.UpdateFilterDeployment(nil, filterDeployment)
+			Expect(err).NotTo(HaveOccurred())
+		})
+		It("does not remove the filter again once the FilterDeployment is deleted", func() {
+			filterDeployment.Finalizers = nil
+
+			err := handler.DeleteFilterDeployment(filterDeployment)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+	Context("multiple targets", func() {
+		var reviews, ratings *v1.WorkloadTarget
+		BeforeEach(func() {
+			filterDeployment.Spec.Deployment.GetIstio().Targets = []*v1.WorkloadTarget{
+				{Name: "reviews"},
+				{Kind: "DaemonSet", Labels: map[string]string{"app": "ratings"}, Namespace: "ratings"},
+			}
+			reviews = &v1.WorkloadTarget{Kind: "deployment", Name: "reviews", Namespace: "bookinfo"}
+			ratings = &v1.WorkloadTarget{Kind: "daemonset", Labels: map[string]string{"app": "ratings"}, Namespace: "ratings"}
+		})
+		It("applies the filter for each target", func() {
+			provider.EXPECT().ApplyFilter(filterDeployment.Spec.Filter).Return(nil).Times(2)
+			client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil)
+			client.EXPECT().UpdateStatus(gomock.Any(), gomock.Any()).Return(nil)
+
+			provider.workloadMeta = metav1.ObjectMeta{Name: "reviews", Namespace: "bookinfo"}
+
+			err := handler.CreateFilterDeployment(filterDeployment)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(providerTargets).To(Equal([]*v1.WorkloadTarget{reviews, ratings}))
+
+			status := client.updatedObjStatus.(*v1.FilterDeployment).Status
+			Expect(status.WorkloadStatuses).To(Equal([]*v1.WorkloadStatus{
+				{Name: "reviews", Namespace: "bookinfo", Target: reviews, State: v1.WorkloadStatus_FilterCreated, ObservedGeneration: 1},
+			}))
+		})
+		It("applies the filter for the other targets if it fails for a target", func() {
+			gomock.InOrder(
+				provider.EXPECT().ApplyFilter(filterDeployment.Spec.Filter).Return(errors.New("rollout timed out")),
+				provider.EXPECT().ApplyFilter(filterDeployment.Spec.Filter).Return(nil),
+			)
+			client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil)
+			client.EXPECT().UpdateStatus(gomock.Any(), gomock.Any()).Return(nil)
+
+			err := handler.CreateFilterDeployment(filterDeployment)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(providerTargets).To(HaveLen(2))
+
+			status := client.updatedObjStatus.(*v1.FilterDeployment).Status
+			Expect(status.Reason).To(Equal("deployment reviews.bookinfo: rollout timed out"))
+		})
+		It("removes the filter from the targets removed from the deployment", func() {
+			removed := &v1.WorkloadTarget{Kind: "deployment", Name: "details", Namespace: "bookinfo"}
+			filterDeployment.Status.WorkloadStatuses = []*v1.WorkloadStatus{
+				{Name: "details", Namespace: "bookinfo", Target: removed, State: v1.WorkloadStatus_FilterCreated},
+				{Name: "reviews", Namespace: "bookinfo", Target: reviews, State: v1.WorkloadStatus_FilterCreated},
+			}
+			gomock.InOrder(
+				provider.EXPECT().RemoveFilter(filterDeployment.Spec.Filter).Return(nil),
+				provider.EXPECT().ApplyFilter(filterDeployment.Spec.Filter).Return(nil).Times(2),
+			)
+			client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil)
+			client.EXPECT().UpdateStatus(gomock.Any(), gomock.Any()).Return(nil)
+
+			err := handler.UpdateFilterDeployment(nil, filterDeployment)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(providerTargets).To(Equal([]*v1.WorkloadTarget{removed, reviews, ratings}))
+
+			status := client.updatedObjStatus.(*v1.FilterDeployment).Status
+			Expect(status.Reason).To(BeEmpty())
+			Expect(status.WorkloadStatuses).To(BeEmpty())
+		})
+		It("keeps the workloads of removed targets the filter could not be removed from", func() {
+			removed := &v1.WorkloadTarget{Kind: "deployment", Name: "details", Namespace: "bookinfo"}
+			filterDeployment.Status.WorkloadStatuses = []*v1.WorkloadStatus{
+				{Name: "details", Namespace: "bookinfo", Target: removed, State: v1.WorkloadStatus_FilterCreated},
+			}
+			provider.EXPECT().RemoveFilter(filterDeployment.Spec.Filter).Return(errors.New("update rejected"))
+			provider.EXPECT().ApplyFilter(filterDeployment.Spec.Filter).Return(nil).Times(2)
+			client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil)
+			client.EXPECT().UpdateStatus(gomock.Any(), gomock.Any()).Return(nil)
+
+			err := handler.UpdateFilterDeployment(nil, filterDeployment)
+			Expect(err).NotTo(HaveOccurred())
+
+			status := client.updatedObjStatus.(*v1.FilterDeployment).Status
+			Expect(status.Reason).To(Equal("removing filter from deployment details.bookinfo: update rejected"))
+			Expect(status.WorkloadStatuses).To(Equal([]*v1.WorkloadStatus{
+				{
+					Name:               "details",
+					Namespace:          "bookinfo",
+					Target:             removed,
+					State:              v1.WorkloadStatus_Failed,
+					Message:            "failed to remove the filter of a removed target: update rejected",
+					ObservedGeneration: 1,
+				},
+			}))
+			Expect(conditionStatuses(status)[ConditionReady]).To(Equal(ConditionFalse))
+		})
+		It("removes the filter from every target once the FilterDeployment is deleted", func() {
+			d := metav1.NewTime(time.Now())
+			filterDeployment.DeletionTimestamp = &d
+			removed := &v1.WorkloadTarget{Kind: "deployment", Name: "details", Namespace: "bookinfo"}
+			filterDeployment.Status.WorkloadStatuses = []*v1.WorkloadStatus{
+				{Name: "details", Namespace: "bookinfo", Target: removed, State: v1.WorkloadStatus_Failed},
+			}
+			client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil)
+			provider.EXPECT().RemoveFilter(filterDeployment.Spec.Filter).Return(nil).Times(3)
+			client.EXPECT().Update(gomock.Any(), filterDeployment).Return(nil)
+
+			err := handler.UpdateFilterDeployment(nil, filterDeployment)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(providerTargets).To(Equal([]*v1.WorkloadTarget{reviews, ratings, removed}))
+		})
+	})
+	Context("events and metrics", func() {
+		var (
+			recorder *record.FakeRecorder
+			registry *prometheus.Registry
+		)
+		BeforeEach(func() {
+			recorder = record.NewFakeRecorder(10)
+			handler.recorder = recorder
+			registry = prometheus.NewRegistry()
+			var err error
+			handler.reconcileMetrics, err = NewReconcileMetrics(registry)
+			Expect(err).NotTo(HaveOccurred())
+		})
+		// returns the reasons of the recorded events
+		recordedReasons := func() []string {
+			var reasons []string
+			for {
+				select {
+				case evt := <-recorder.Events:
+					reasons = append(reasons, strings.Fields(evt)[1])
+				default:
+					return reasons
+				}
+			}
+		}
+		failApply := func(applyErr error) {
+			provider.EXPECT().ApplyFilter(filterDeployment.Spec.Filter).Return(applyErr)
+			client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil)
+			client.EXPECT().UpdateStatus(gomock.Any(), gomock.Any()).Return(nil)
+			provider.workloadMeta = metav1.ObjectMeta{Name: "test-workload"}
+			provider.err = applyErr
+
+			Expect(handler.CreateFilterDeployment(filterDeployment)).NotTo(HaveOccurred())
+		}
+
+		It("records the start and success of the deployment of a new generation", func() {
+			applyTest(handler.CreateFilterDeployment)
+			Expect(recordedReasons()).To(Equal([]string{EventReasonApplyStarted, EventReasonApplySucceeded}))
+
+			durations := metricsutils.Gather(registry, "wasme_filterdeployment_reconcile_duration_seconds")
+			Expect(durations).To(HaveLen(1))
+			Expect(durations[0].GetHistogram().GetSampleCount()).To(Equal(uint64(1)))
+			Expect(durations[0].GetLabel()[1].GetValue()).To(Equal("success"))
+			failed := metricsutils.Gather(registry, "wasme_filterdeployment_workloads_failed")
+			Expect(failed).To(HaveLen(1))
+			Expect(failed[0].GetGauge().GetValue()).To(Equal(0.0))
+			Expect(metricsutils.Gather(registry, "wasme_filterdeployment_reconcile_failures_total")).To(BeEmpty())
+
+			// redeployed unchanged, e.g. by the periodic resync
+			applyTest(handler.CreateFilterDeployment)
+			Expect(recordedReasons()).To(BeEmpty())
+			Expect(metricsutils.Gather(registry, "wasme_filterdeployment_reconcile_duration_seconds")[0].GetHistogram().GetSampleCount()).To(Equal(uint64(2)))
+		})
+		It("records images which are not supported by the istio version", func() {
+			failApply(&istio.AbiIncompatibleError{Image: test.IstioAssemblyScriptImage, IstioVersion: "1.5.0"})
+			Expect(recordedReasons()).To(Equal([]string{EventReasonApplyStarted, EventReasonAbiCheckFailed}))
+
+			failures := metricsutils.Gather(registry, "wasme_filterdeployment_reconcile_failures_total")
+			Expect(failures).To(HaveLen(1))
+			Expect(failures[0].GetCounter().GetValue()).To(Equal(1.0))
+			Expect(metricsutils.Gather(registry, "wasme_filterdeployment_workloads_failed")[0].GetGauge().GetValue()).To(Equal(1.0))
+		})
+		It("records images the cache timed out pulling", func() {
+			cacheErr := &istio.CacheError{Image: test.IstioAssemblyScriptImage, Err: errors.Wrap(&istio.CacheTimeoutError{Timeout: time.Minute}, "waiting for cache")}
+			failApply(errors.Wrap(cacheErr, "deploying filter"))
+			Expect(recordedReasons()).To(Equal([]string{EventReasonApplyStarted, EventReasonCacheTimeout}))
+		})
+		It("records a failure once until its reason changes", func() {
+			failApply(errors.New("rollout timed out"))
+			Expect(recordedReasons()).To(Equal([]string{EventReasonApplyStarted, EventReasonApplyFailed}))
+
+			failApply(errors.New("rollout timed out"))
+			Expect(recordedReasons()).To(BeEmpty())
+			Expect(metricsutils.Gather(registry, "wasme_filterdeployment_reconcile_failures_total")[0].GetCounter().GetValue()).To(Equal(2.0))
+
+			failApply(errors.New("update rejected"))
+			Expect(recordedReasons()).To(Equal([]string{EventReasonApplyFailed}))
+		})
+		It("deletes the metrics of finalized FilterDeployments", func() {
+			applyTest(handler.CreateFilterDeployment)
+			Expect(metricsutils.Gather(registry, "wasme_filterdeployment_workloads_failed")).To(HaveLen(1))
+
+			d := metav1.NewTime(time.Now())
+			filterDeployment.DeletionTimestamp = &d
+			client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil)
+			provider.EXPECT().RemoveFilter(filterDeployment.Spec.Filter).Return(nil)
+			client.EXPECT().Update(gomock.Any(), filterDeployment).Return(nil)
+			Expect(handler.UpdateFilterDeployment(nil, filterDeployment)).NotTo(HaveOccurred())
+
+			Expect(metricsutils.Gather(registry, "wasme_filterdeployment_workloads_failed")).To(BeEmpty())
+		})
+	})
+	Context("watch scope", func() {
+		BeforeEach(func() {
+			scope, err := ParseWatchScope("bookinfo,ratings", "team=reviews")
+			Expect(err).NotTo(HaveOccurred())
+			handler.scope = scope
+			// previously managed, before the scope of the operator was narrowed
+			filterDeployment.Status.WorkloadStatuses = []*v1.WorkloadStatus{
+				{Name: "reviews", Namespace: "bookinfo", Target: target, State: v1.WorkloadStatus_FilterCreated},
+			}
+		})
+		It("deploys the filter of FilterDeployments in the scope", func() {
+			filterDeployment.Labels = map[string]string{"team": "reviews"}
+			applyTest(handler.CreateFilterDeployment)
+		})
+		It("ignores FilterDeployments which left the scope, keeping their filter, status and finalizer", func() {
+			// only refreshed, neither updated nor removed
+			client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil)
+			Expect(handler.UpdateFilterDeployment(nil, filterDeployment)).NotTo(HaveOccurred())
+
+			Expect(handler.DeleteFilterDeployment(filterDeployment)).NotTo(HaveOccurred())
+
+			Expect(filterDeployment.Finalizers).To(Equal([]string{CleanupFinalizer}))
+			Expect(filterDeployment.Status.WorkloadStatuses).To(HaveLen(1))
+		})
+		It("does not finalize FilterDeployments outside of the scope", func() {
+			d := metav1.NewTime(time.Now())
+			filterDeployment.DeletionTimestamp = &d
+			client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil)
+
+			Expect(handler.UpdateFilterDeployment(nil, filterDeployment)).NotTo(HaveOccurred())
+			Expect(filterDeployment.Finalizers).To(Equal([]string{CleanupFinalizer}))
+		})
+		It("rejects targets outside of the watched namespaces", func() {
+			filterDeployment.Labels = map[string]string{"team": "reviews"}
+			filterDeployment.Spec.Deployment.GetIstio().Targets = []*v1.WorkloadTarget{
+				{Name: "reviews"},
+				{Name: "details", Namespace: "details"},
+			}
+			filterDeployment.Status.WorkloadStatuses = nil
+			provider.EXPECT().ApplyFilter(filterDeployment.Spec.Filter).Return(nil)
+			client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil)
+			client.EXPECT().UpdateStatus(gomock.Any(), gomock.Any()).Return(nil)
+
+			Expect(handler.CreateFilterDeployment(filterDeployment)).NotTo(HaveOccurred())
+			Expect(providerTargets).To(Equal([]*v1.WorkloadTarget{{Kind: "deployment", Name: "reviews", Namespace: "bookinfo"}}))
+
+			status := client.updatedObjStatus.(*v1.FilterDeployment).Status
+			Expect(status.Reason).To(Equal("deployment details.details: namespace details is not watched by the operator"))
+		})
+	})
+	Context("gloo deployments", func() {
+		var gatewayClient gatewayv1.GatewayClient
+		BeforeEach(func() {
+			var err error
+			gatewayClient, err = gatewayv1.NewGatewayClient(&factory.MemoryResourceClientFactory{Cache: memory.NewInMemoryResourceCache()})
+			Expect(err).NotTo(HaveOccurred())
+			for _, gw := range []*gatewayv1.Gateway{
+				{
+					Metadata:    core.Metadata{Name: "gateway-proxy", Namespace: "gloo-system", Labels: map[string]string{"gateway": "public"}},
+					GatewayType: &gatewayv1.Gateway_HttpGateway{HttpGateway: &gatewayv1.HttpGateway{}},
+				},
+				{
+					Metadata:    core.Metadata{Name: "internal-proxy", Namespace: "gloo-system"},
+					GatewayType: &gatewayv1.Gateway_HttpGateway{HttpGateway: &gatewayv1.HttpGateway{}},
+				},
+			} {
+				_, err := gatewayClient.Write(gw, clients.WriteOpts{})
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			// the abi versions of the image are supported by the installed gloo
+			_, err = kubeClient.AppsV1().Deployments("gloo-system").Create(&appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "gloo", Namespace: "gloo-system"},
+				Spec: appsv1.DeploymentSpec{Template: kubev1.PodTemplateSpec{Spec: kubev1.PodSpec{
+					Containers: []kubev1.Container{{Name: "gloo", Image: "quay.io/solo-io/gloo:1.6.0"}},
+				}}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			handler.makeProviderFn = nil
+			handler.makePullerFn = func(string, *v1.ImagePullOptions) (pull.ImagePuller, error) {
+				return &abiVersionsPuller{abiVersions: []string{"v0.2.1"}}, nil
+			}
+			handler.gatewayClient = func() (gatewayv1.GatewayClient, error) { return gatewayClient, nil }
+
+			// not pulled to read its root id
+			filterDeployment.Spec.Filter.RootID = "root"
+			filterDeployment.Spec.Deployment = &v1.DeploymentSpec{
+				DeploymentType: &v1.DeploymentSpec_Gloo{Gloo: &v1.GlooDeploymentSpec{
+					Namespaces:    []string{"gloo-system"},
+					GatewayLabels: map[string]string{"gateway": "public"},
+				}},
+			}
+		})
+		filterNames := func(name string) []string {
+			gw, err := gatewayClient.Read("gloo-system", name, clients.ReadOpts{})
+			Expect(err).NotTo(HaveOccurred())
+			var names []string
+			for _, filter := range gw.GetHttpGateway().GetOptions().GetWasm().GetFilters() {
+				names = append(names, filter.GetName())
+			}
+			return names
+		}
+
+		It("adds the filter to the selected gateways, reporting them in the status", func() {
+			client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil)
+			client.EXPECT().UpdateStatus(gomock.Any(), gomock.Any()).Return(nil)
+
+			Expect(handler.CreateFilterDeployment(filterDeployment)).NotTo(HaveOccurred())
+			Expect(filterNames("gateway-proxy")).To(Equal([]string{"myfilter.bookinfo"}))
+			Expect(filterNames("internal-proxy")).To(BeEmpty())
+
+			status := client.updatedObjStatus.(*v1.FilterDeployment).Status
+			Expect(status.WorkloadStatuses).To(Equal([]*v1.WorkloadStatus{
+				{Name: "gateway-proxy", Namespace: "gloo-system", State: v1.WorkloadStatus_FilterCreated, ObservedGeneration: 1},
+			}))
+			Expect(status.Ready).To(Equal("1/1"))
+			Expect(status.Conditions).To(Equal([]*v1.Condition{
+				{Type: ConditionReady, Status: ConditionTrue, Reason: "FilterDeployed", Message: "the filter was created for 1/1 workloads", ObservedGeneration: 1},
+			}))
+		})
+		It("removes the filter from the gateways once the FilterDeployment is deleted", func() {
+			client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+			client.EXPECT().UpdateStatus(gomock.Any(), gomock.Any()).Return(nil)
+			Expect(handler.CreateFilterDeployment(filterDeployment)).NotTo(HaveOccurred())
+
+			d := metav1.NewTime(time.Now())
+			filterDeployment.DeletionTimestamp = &d
+			client.EXPECT().Update(gomock.Any(), filterDeployment).Return(nil)
+			Expect(handler.UpdateFilterDeployment(nil, filterDeployment)).NotTo(HaveOccurred())
+
+			Expect(filterNames("gateway-proxy")).To(BeEmpty())
+			Expect(filterDeployment.Finalizers).To(BeEmpty())
+		})
+		It("rejects images whose abi versions are not supported by the installed gloo", func() {
+			handler.makePullerFn = func(string, *v1.ImagePullOptions) (pull.ImagePuller, error) {
+				return &abiVersionsPuller{abiVersions: []string{"v0-edc016b1fa5adca3ebd3d7020eaed0ad7b8814ca"}}, nil
+			}
+			client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil)
+			client.EXPECT().UpdateStatus(gomock.Any(), gomock.Any()).Return(nil)
+
+			Expect(handler.CreateFilterDeployment(filterDeployment)).NotTo(HaveOccurred())
+			Expect(filterNames("gateway-proxy")).To(BeEmpty())
+
+			status := client.updatedObjStatus.(*v1.FilterDeployment).Status
+			Expect(status.Reason).To(Equal("image " + filterDeployment.Spec.Filter.Image + " not supported by gloo version 1.6.0"))
+		})
+		It("rejects gateway namespaces outside of the watched namespaces", func() {
+			handler.scope = WatchScope{Namespaces: []string{"bookinfo"}}
+			client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil)
+			client.EXPECT().UpdateStatus(gomock.Any(), gomock.Any()).Return(nil)
+
+			Expect(handler.CreateFilterDeployment(filterDeployment)).NotTo(HaveOccurred())
+			Expect(filterNames("gateway-proxy")).To(BeEmpty())
+
+			status := client.updatedObjStatus.(*v1.FilterDeployment).Status
+			Expect(status.Reason).To(Equal("namespace gloo-system is not watched by the operator"))
+		})
+	})
+	It("removes the filter of FilterDeployments deleted without the finalizer", func() {
+		filterDeployment.Finalizers = nil
+		provider.EXPECT().RemoveFilter(filterDeployment.Spec.Filter).Return(nil)
+
+		err := handler.DeleteFilterDeployment(filterDeployment)
+		Expect(err).NotTo(HaveOccurred())
+	})
 })
 
 type mockProvider struct {
+	// the workloads passed to onWorkloadsSelectedFn, if any
+	selected []metav1.ObjectMeta
+	// the workload passed to onWorkloadFn, if any
 	workloadMeta metav1.ObjectMeta
 	err          error
-	onWorkloadFn func(workloadMeta metav1.ObjectMeta, err error)
+	// if set, the config hash the workload is passed to onConfigUpdatedFn with
+	configHash string
+	// the checksum of the config the provider resolved for the filter
+	resolvedConfigChecksum string
+	onWorkloadsSelectedFn  func(workloadMetas []metav1.ObjectMeta)
+	onWorkloadFn           func(workloadMeta metav1.ObjectMeta, err error)
+	onConfigUpdatedFn      func(workloadMeta metav1.ObjectMeta, configHash string)
 	*mock_deploy.MockProvider
 }
 
 func (c *mockProvider) ApplyFilter(f *v1.FilterSpec) error {
-	c.onWorkloadFn(c.workloadMeta, c.err)
+	if len(c.selected) > 0 {
+		c.onWorkloadsSelectedFn(c.selected)
+	}
+	if c.workloadMeta.Name != "" && c.configHash != "" {
+		c.onConfigUpdatedFn(c.workloadMeta, c.configHash)
+	}
+	if c.workloadMeta.Name != "" {
+		c.onWorkloadFn(c.workloadMeta, c.err)
+	}
 	return c.MockProvider.ApplyFilter(f)
 }
 
+func (c *mockProvider) ApplyResolvedFilter(f *v1.FilterSpec) (string, error) {
+	if err := c.ApplyFilter(f); err != nil {
+		return "", err
+	}
+	return c.resolvedConfigChecksum, nil
+}
+
+// pulls images declaring the abi versions
+type abiVersionsPuller struct {
+	abiVersions []string
+}
+
+func (p *abiVersionsPuller) Pull(ctx context.Context, ref string) (pull.Image, error) {
+	return &abiVersionsImage{ref: ref, abiVersions: p.abiVersions}, nil
+}
+
+type abiVersionsImage struct {
+	ref         string
+	abiVersions []string
+}
+
+func (i *abiVersionsImage) Ref() string {
+	return i.ref
+}
+
+func (i *abiVersionsImage) Descriptor() (ocispec.Descriptor, error) {
+	return ocispec.Descriptor{}, nil
+}
+
+func (i *abiVersionsImage) FetchFilter(ctx context.Context) (model.Filter, error) {
+	return ioutil.NopCloser(strings.NewReader("")), nil
+}
+
+func (i *abiVersionsImage) FetchConfig(ctx context.Context) (*config.Runtime, error) {
+	return &config.Runtime{AbiVersions: i.abiVersions}, nil
+}
+
 type mockClient struct {
 	updatedObjStatus ezkube.Object
 	*mock_ezkube.MockEnsurer
@@ -0,0 +1,62 @@
+package operator
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// HealthProbePort is the port the operator serves /readyz and /healthz on
+const HealthProbePort = 9092
+
+// ReadinessGate reports the operator as ready once its informer caches have synced and the abi registry is loaded,
+// so that the operator does not act on an empty view of the cluster, or check filters against an incomplete registry, after a restart.
+type ReadinessGate struct {
+	// set to 1 once the caches have synced
+	synced int32
+	// set to 1 once the abi registry was loaded
+	abiRegistryLoaded int32
+}
+
+func NewReadinessGate() *ReadinessGate {
+	return &ReadinessGate{}
+}
+
+// WaitForSync blocks until waitForCacheSync returns, marking the caches synced if they did.
+// pass the manager's cache.WaitForCacheSync.
+func (g *ReadinessGate) WaitForSync(stop <-chan struct{}, waitForCacheSync func(stop <-chan struct{}) bool) {
+	if waitForCacheSync(stop) {
+		atomic.StoreInt32(&g.synced, 1)
+	}
+}
+
+// LoadAbiRegistry runs loadAbiRegistry, marking the abi registry loaded if it returns no error.
+// returns the error of loadAbiRegistry
+func (g *ReadinessGate) LoadAbiRegistry(loadAbiRegistry func() error) error {
+	if err := loadAbiRegistry(); err != nil {
+		return err
+	}
+	atomic.StoreInt32(&g.abiRegistryLoaded, 1)
+	return nil
+}
+
+// Ready returns true once the informer caches have synced and the abi registry is loaded
+func (g *ReadinessGate) Ready() bool {
+	return g.check() == nil
+}
+
+// Check implements healthz.Checker for the manager's /readyz endpoint
+func (g *ReadinessGate) Check(_ *http.Request) error {
+	return g.check()
+}
+
+func (g *ReadinessGate) check() error {
+	if atomic.LoadInt32(&g.synced) != 1 {
+		return errors.Errorf("informer caches have not synced")
+	}
+	if atomic.LoadInt32(&g.abiRegistryLoaded) != 1 {
+		return errors.Errorf("abi registry has not been loaded")
+	}
+	return nil
+}
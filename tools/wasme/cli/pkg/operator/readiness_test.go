@@ -0,0 +1,59 @@
+package operator
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ReadinessGate", func() {
+	loaded := func() error { return nil }
+
+	It("reports ready only after the caches have synced", func() {
+		gate := NewReadinessGate()
+		Expect(gate.LoadAbiRegistry(loaded)).NotTo(HaveOccurred())
+		synced := make(chan bool)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			gate.WaitForSync(nil, func(stop <-chan struct{}) bool {
+				return <-synced
+			})
+		}()
+
+		Expect(gate.Ready()).To(BeFalse())
+		Expect(gate.Check(nil)).To(MatchError("informer caches have not synced"))
+
+		synced <- true
+		Eventually(done).Should(BeClosed())
+
+		Expect(gate.Ready()).To(BeTrue())
+		Expect(gate.Check(nil)).NotTo(HaveOccurred())
+	})
+
+	It("does not report ready if the caches fail to sync", func() {
+		gate := NewReadinessGate()
+		Expect(gate.LoadAbiRegistry(loaded)).NotTo(HaveOccurred())
+		gate.WaitForSync(nil, func(stop <-chan struct{}) bool {
+			return false
+		})
+		Expect(gate.Check(nil)).To(HaveOccurred())
+	})
+
+	It("reports ready only after the abi registry is loaded", func() {
+		gate := NewReadinessGate()
+		gate.WaitForSync(nil, func(stop <-chan struct{}) bool {
+			return true
+		})
+		Expect(gate.Ready()).To(BeFalse())
+		Expect(gate.Check(nil)).To(MatchError("abi registry has not been loaded"))
+
+		err := gate.LoadAbiRegistry(func() error { return errors.New("malformed registry") })
+		Expect(err).To(MatchError("malformed registry"))
+		Expect(gate.Ready()).To(BeFalse())
+
+		Expect(gate.LoadAbiRegistry(loaded)).NotTo(HaveOccurred())
+		Expect(gate.Ready()).To(BeTrue())
+	})
+})
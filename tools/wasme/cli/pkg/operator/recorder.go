@@ -0,0 +1,47 @@
+package operator
+
+import (
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// reasons of the Events recorded on a FilterDeployment when the deployment of its filter changes,
+	// so `kubectl describe filterdeployment` shows its history
+	EventReasonApplyStarted   = "ApplyStarted"
+	EventReasonApplySucceeded = "ApplySucceeded"
+	EventReasonApplyFailed    = "ApplyFailed"
+	EventReasonAbiCheckFailed = "AbiCheckFailed"
+	EventReasonCacheTimeout   = "CacheTimeout"
+)
+
+// records the start of the deployment of a new generation of the FilterDeployment.
+// the deployments of an unchanged FilterDeployment, e.g. by the periodic resync, are not recorded
+func (f *filterDeploymentHandler) recordApplyStarted(obj *v1.FilterDeployment) {
+	if f.recorder == nil || obj.Generation == obj.Status.ObservedGeneration {
+		return
+	}
+	f.recorder.Eventf(obj, corev1.EventTypeNormal, EventReasonApplyStarted, "applying generation %v of filter (image %v)", obj.Generation, obj.Spec.GetFilter().GetImage())
+}
+
+// records the outcome of the deployment of the FilterDeployment, if it changed since the previous status:
+// a new generation was deployed, the deployment succeeded or failed for another reason, or the number of ready workloads changed
+func (f *filterDeploymentHandler) recordApplyOutcome(obj *v1.FilterDeployment, previous v1.FilterDeploymentStatus, err error) {
+	if f.recorder == nil {
+		return
+	}
+	if previous.ObservedGeneration == obj.Status.ObservedGeneration && previous.Reason == obj.Status.Reason && previous.Ready == obj.Status.Ready {
+		return
+	}
+	switch {
+	case err == nil:
+		f.recorder.Eventf(obj, corev1.EventTypeNormal, EventReasonApplySucceeded, "applied filter %v to %v workloads", obj.Spec.GetFilter().GetId(), obj.Status.Ready)
+	case istio.IsAbiIncompatible(err):
+		f.recorder.Eventf(obj, corev1.EventTypeWarning, EventReasonAbiCheckFailed, "filter %v was not applied: %v", obj.Spec.GetFilter().GetId(), err)
+	case istio.IsCacheTimeout(err):
+		f.recorder.Eventf(obj, corev1.EventTypeWarning, EventReasonCacheTimeout, "filter %v was not applied: %v", obj.Spec.GetFilter().GetId(), err)
+	default:
+		f.recorder.Eventf(obj, corev1.EventTypeWarning, EventReasonApplyFailed, "failed to apply filter %v: %v", obj.Spec.GetFilter().GetId(), err)
+	}
+}
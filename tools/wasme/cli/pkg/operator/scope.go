@@ -0,0 +1,92 @@
+package operator
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// WatchScope restricts the FilterDeployments managed by the operator, e.g. to run one operator per tenant.
+// FilterDeployments outside of the scope are ignored: their filters are neither updated nor removed,
+// so they stay deployed until an operator managing them removes them.
+// the zero value manages every FilterDeployment
+type WatchScope struct {
+	// the namespaces of the managed FilterDeployments and of the workloads they target.
+	// every namespace if empty
+	Namespaces []string
+
+	// selects the managed FilterDeployments by their labels. every FilterDeployment if nil
+	Selector labels.Selector
+}
+
+// ParseWatchScope parses the comma-separated list of namespaces and the label selector of the scope
+func ParseWatchScope(namespaces, selector string) (WatchScope, error) {
+	var scope WatchScope
+	for _, namespace := range strings.Split(namespaces, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			scope.Namespaces = append(scope.Namespaces, namespace)
+		}
+	}
+	if selector != "" {
+		parsed, err := labels.Parse(selector)
+		if err != nil {
+			return WatchScope{}, errors.Wrapf(err, "parsing filter selector %v", selector)
+		}
+		scope.Selector = parsed
+	}
+	return scope, nil
+}
+
+// NewCache returns the function creating the cache of the manager, restricted to the namespaces of the scope.
+// returns nil if every namespace is watched, so the manager uses its default cache
+func (s WatchScope) NewCache() cache.NewCacheFunc {
+	if len(s.Namespaces) == 0 {
+		return nil
+	}
+	return cache.MultiNamespacedCacheBuilder(s.Namespaces)
+}
+
+// WatchesNamespace returns true if the namespace is in the scope
+func (s WatchScope) WatchesNamespace(namespace string) bool {
+	if len(s.Namespaces) == 0 {
+		return true
+	}
+	for _, watched := range s.Namespaces {
+		if watched == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// Selects returns true if the FilterDeployment is managed by the operator
+func (s WatchScope) Selects(obj metav1.Object) bool {
+	if !s.WatchesNamespace(obj.GetNamespace()) {
+		return false
+	}
+	return s.Selector == nil || s.Selector.Matches(labels.Set(obj.GetLabels()))
+}
+
+// Predicate filters out the events of the FilterDeployments outside of the scope.
+// the update of a FilterDeployment which left the scope is filtered out, rather than handled as a deletion
+func (s WatchScope) Predicate() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return s.Selects(e.Meta)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return s.Selects(e.MetaNew)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return s.Selects(e.Meta)
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return s.Selects(e.Meta)
+		},
+	}
+}
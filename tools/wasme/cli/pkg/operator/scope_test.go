@@ -0,0 +1,56 @@
+package operator
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+var _ = Describe("Watch scope", func() {
+	makeFilterDeployment := func(namespace string, labels map[string]string) *v1.FilterDeployment {
+		return &v1.FilterDeployment{ObjectMeta: metav1.ObjectMeta{Name: "myfilter", Namespace: namespace, Labels: labels}}
+	}
+
+	It("manages every FilterDeployment by default", func() {
+		scope, err := ParseWatchScope("", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(scope.NewCache()).To(BeNil())
+		Expect(scope.Selects(makeFilterDeployment("bookinfo", nil))).To(BeTrue())
+		Expect(scope.WatchesNamespace("istio-system")).To(BeTrue())
+	})
+
+	It("selects the FilterDeployments in the namespaces, matching the selector", func() {
+		scope, err := ParseWatchScope(" bookinfo, ratings,", "team in (reviews, ratings)")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(scope.Namespaces).To(Equal([]string{"bookinfo", "ratings"}))
+		Expect(scope.NewCache()).NotTo(BeNil())
+
+		Expect(scope.Selects(makeFilterDeployment("ratings", map[string]string{"team": "ratings"}))).To(BeTrue())
+		Expect(scope.Selects(makeFilterDeployment("ratings", map[string]string{"team": "details"}))).To(BeFalse())
+		Expect(scope.Selects(makeFilterDeployment("ratings", nil))).To(BeFalse())
+		Expect(scope.Selects(makeFilterDeployment("details", map[string]string{"team": "ratings"}))).To(BeFalse())
+	})
+
+	It("rejects invalid selectors", func() {
+		_, err := ParseWatchScope("", "team in reviews")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("filters out the events of FilterDeployments outside of the scope", func() {
+		scope, err := ParseWatchScope("", "team=reviews")
+		Expect(err).NotTo(HaveOccurred())
+		predicate := scope.Predicate()
+
+		selected := makeFilterDeployment("bookinfo", map[string]string{"team": "reviews"})
+		other := makeFilterDeployment("bookinfo", nil)
+		Expect(predicate.Create(event.CreateEvent{Meta: selected, Object: selected})).To(BeTrue())
+		Expect(predicate.Create(event.CreateEvent{Meta: other, Object: other})).To(BeFalse())
+		Expect(predicate.Delete(event.DeleteEvent{Meta: other, Object: other})).To(BeFalse())
+
+		// leaving the scope is not a deletion
+		Expect(predicate.Update(event.UpdateEvent{MetaOld: selected, ObjectOld: selected, MetaNew: other, ObjectNew: other})).To(BeFalse())
+		Expect(predicate.Update(event.UpdateEvent{MetaOld: other, ObjectOld: other, MetaNew: selected, ObjectNew: selected})).To(BeTrue())
+	})
+})
@@ -0,0 +1,218 @@
+package operator
+
+import (
+	"fmt"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// the types of the conditions of a FilterDeployment
+const (
+	// the filter was created for every selected workload it can take effect on
+	ConditionReady = "Ready"
+	// the image of the filter was added to the cache config, and pulled by the cache
+	ConditionCacheReady = "CacheReady"
+	// the ABI versions of the image are supported by the installed version of istio
+	ConditionAbiCompatible = "AbiCompatible"
+)
+
+// the statuses of the conditions
+const (
+	ConditionTrue    = "True"
+	ConditionFalse   = "False"
+	ConditionUnknown = "Unknown"
+)
+
+// the message of the workloads the filter was not applied to, as it failed for an earlier workload
+const notReachedMessage = "the filter was not applied to the workload, as the deployment failed before the workload was updated"
+
+// collects the status of each workload of a deployment from the callbacks of the provider
+type workloadStatuses struct {
+	generation int64
+	// the cache and abi checks only apply to Istio deployments
+	istio bool
+	// mesh-wide filters are created once every workload is annotated
+	meshWide bool
+
+	// in the order the workloads were selected or reported
+	statuses []*v1.WorkloadStatus
+	// by the namespace/name of the workloads
+	byName map[string]*v1.WorkloadStatus
+	// the statuses in the legacy format of FilterDeploymentStatus.Workloads,
+	// with only the workloads reported to OnWorkload
+	legacy map[string]*v1.WorkloadStatus
+}
+
+func newWorkloadStatuses(obj *v1.FilterDeployment) *workloadStatuses {
+	return &workloadStatuses{
+		generation: obj.Generation,
+		istio:      obj.Spec.GetDeployment().GetIstio() != nil,
+		meshWide:   obj.Spec.GetDeployment().GetIstio().GetMeshWide(),
+		byName:     map[string]*v1.WorkloadStatus{},
+		legacy:     map[string]*v1.WorkloadStatus{},
+	}
+}
+
+// a workload selected by several targets keeps the first target which selected it
+func (w *workloadStatuses) get(target *v1.WorkloadTarget, workloadMeta metav1.ObjectMeta) *v1.WorkloadStatus {
+	key := workloadMeta.Namespace + "/" + workloadMeta.Name
+	if status, ok := w.byName[key]; ok {
+		return status
+	}
+	status := &v1.WorkloadStatus{
+		Name:               workloadMeta.Name,
+		Namespace:          workloadMeta.Namespace,
+		State:              v1.WorkloadStatus_Pending,
+		ObservedGeneration: w.generation,
+		Target:             target,
+	}
+	w.byName[key] = status
+	w.statuses = append(w.statuses, status)
+	return status
+}
+
+// the workloads are pending until they are reported to set
+func (w *workloadStatuses) selected(target *v1.WorkloadTarget, workloadMetas []metav1.ObjectMeta) {
+	for _, workloadMeta := range workloadMetas {
+		w.get(target, workloadMeta)
+	}
+}
+
+// keeps the statuses of the workloads of a removed target the filter could not be removed from,
+// so the removal is retried on the next deployment
+func (w *workloadStatuses) removeFailed(previous *v1.FilterDeploymentStatus, target *v1.WorkloadTarget, err error) {
+	for _, status := range previous.GetWorkloadStatuses() {
+		if !proto.Equal(status.GetTarget(), target) {
+			continue
+		}
+		failed := w.get(target, metav1.ObjectMeta{Name: status.Name, Namespace: status.Namespace})
+		failed.State = v1.WorkloadStatus_Failed
+		failed.Message = fmt.Sprintf("failed to remove the filter of a removed target: %v", err)
+	}
+}
+
+func (w *workloadStatuses) set(target *v1.WorkloadTarget, workloadMeta metav1.ObjectMeta, err error) {
+	status := w.get(target, workloadMeta)
+	legacy := &v1.WorkloadStatus{
+		State: v1.WorkloadStatus_Succeeded,
+	}
+	switch {
+	case istio.IsUninjectedWorkload(err):
+		status.State = v1.WorkloadStatus_Skipped
+		legacy.State = v1.WorkloadStatus_Skipped
+	case err != nil:
+		status.State = v1.WorkloadStatus_Failed
+		legacy.State = v1.WorkloadStatus_Failed
+	case w.meshWide:
+		status.State = v1.WorkloadStatus_AnnotationsApplied
+	default:
+		status.State = v1.WorkloadStatus_FilterCreated
+	}
+	if err != nil {
+		status.Message = err.Error()
+		status.Reason = err.Error()
+		legacy.Reason = err.Error()
+	}
+	log.Log.V(1).Info("applied filter to workload", "result", status)
+	w.legacy[workloadMeta.Name] = legacy
+}
+
+// the filter of the workload was updated without restarting its pods
+func (w *workloadStatuses) configUpdated(target *v1.WorkloadTarget, workloadMeta metav1.ObjectMeta, configHash string) {
+	status := w.get(target, workloadMeta)
+	status.RestartSkipped = true
+	status.ConfigHash = configHash
+}
+
+// called with the error of ApplyFilter once it returns
+func (w *workloadStatuses) done(err error) {
+	for _, status := range w.statuses {
+		switch {
+		case status.State == v1.WorkloadStatus_AnnotationsApplied && err == nil:
+			// the mesh-wide EnvoyFilter was created
+			status.State = v1.WorkloadStatus_FilterCreated
+		case status.State == v1.WorkloadStatus_Pending && err != nil:
+			status.Message = notReachedMessage
+		}
+	}
+}
+
+// reached is true if the filter was applied to any workload, so the cache and ABI checks passed
+func (w *workloadStatuses) reached() bool {
+	return len(w.legacy) > 0
+}
+
+// the number of workloads the filter was created for, out of the workloads which were not skipped
+func (w *workloadStatuses) ready() string {
+	var created, total int
+	for _, status := range w.statuses {
+		switch status.State {
+		case v1.WorkloadStatus_Skipped:
+			continue
+		case v1.WorkloadStatus_FilterCreated:
+			created++
+		}
+		total++
+	}
+	return fmt.Sprintf("%d/%d", created, total)
+}
+
+// returns the Ready, CacheReady and AbiCompatible conditions of a deployment, given the error of ApplyFilter.
+// the filter is only added to the cache once the ABI check passed, and only applied to the workloads once it is cached.
+// the Gateways of a Gloo deployment pull the image themselves, so it only has the Ready condition
+func deploymentConditions(generation int64, err error, workloads *workloadStatuses) []*v1.Condition {
+	condition := func(conditionType, status, reason, message string) *v1.Condition {
+		return &v1.Condition{
+			Type:               conditionType,
+			Status:             status,
+			Reason:             reason,
+			Message:            message,
+			ObservedGeneration: generation,
+		}
+	}
+	if !workloads.istio {
+		if err == nil {
+			return []*v1.Condition{condition(ConditionReady, ConditionTrue, "FilterDeployed", fmt.Sprintf("the filter was created for %v workloads", workloads.ready()))}
+		}
+		return []*v1.Condition{condition(ConditionReady, ConditionFalse, "DeploymentFailed", err.Error())}
+	}
+	if err == nil {
+		return []*v1.Condition{
+			condition(ConditionReady, ConditionTrue, "FilterDeployed", fmt.Sprintf("the filter was created for %v workloads", workloads.ready())),
+			condition(ConditionCacheReady, ConditionTrue, "ImageCached", ""),
+			condition(ConditionAbiCompatible, ConditionTrue, "AbiVersionSupported", ""),
+		}
+	}
+
+	ready := condition(ConditionReady, ConditionFalse, "DeploymentFailed", err.Error())
+	switch {
+	case istio.IsAbiIncompatible(err):
+		return []*v1.Condition{
+			ready,
+			condition(ConditionCacheReady, ConditionUnknown, "AbiVersionUnsupported", "the image is not cached, as it is not supported by the istio version"),
+			condition(ConditionAbiCompatible, ConditionFalse, "AbiVersionUnsupported", err.Error()),
+		}
+	case istio.IsCacheError(err):
+		return []*v1.Condition{
+			ready,
+			condition(ConditionCacheReady, ConditionFalse, "CacheFailed", err.Error()),
+			condition(ConditionAbiCompatible, ConditionTrue, "AbiVersionSupported", ""),
+		}
+	case workloads.reached():
+		return []*v1.Condition{
+			ready,
+			condition(ConditionCacheReady, ConditionTrue, "ImageCached", ""),
+			condition(ConditionAbiCompatible, ConditionTrue, "AbiVersionSupported", ""),
+		}
+	default:
+		return []*v1.Condition{
+			ready,
+			condition(ConditionCacheReady, ConditionUnknown, "DeploymentFailed", "the deployment failed before the image was cached"),
+			condition(ConditionAbiCompatible, ConditionUnknown, "DeploymentFailed", "the deployment failed before the abi versions of the image were checked"),
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package operator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gogo/protobuf/proto"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// returns the targets of the Istio deployment of the FilterDeployment, with the defaults of the deployment applied.
+// a deployment without targets has the single target of its kind and labels, in the namespace of the FilterDeployment.
+// returns a single nil target for FilterDeployments without an Istio deployment: a Gloo deployment selects
+// its Gateways without targets, and makeProvider rejects FilterDeployments without a deployment
+func deploymentTargets(obj *v1.FilterDeployment) []*v1.WorkloadTarget {
+	dep := obj.Spec.GetDeployment().GetIstio()
+	if dep == nil {
+		return []*v1.WorkloadTarget{nil}
+	}
+	if len(dep.GetTargets()) == 0 {
+		return []*v1.WorkloadTarget{{
+			Kind:      strings.ToLower(dep.GetKind()),
+			Labels:    dep.GetLabels(),
+			Namespace: obj.Namespace,
+		}}
+	}
+
+	var targets []*v1.WorkloadTarget
+	for _, target := range dep.GetTargets() {
+		target = proto.Clone(target).(*v1.WorkloadTarget)
+		if target.Kind == "" {
+			target.Kind = dep.GetKind()
+		}
+		target.Kind = strings.ToLower(target.Kind)
+		if target.Namespace == "" {
+			target.Namespace = obj.Namespace
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// returns the targets recorded in the status of the FilterDeployment which are not in targets,
+// so the filter is removed from the workloads they selected
+func removedTargets(obj *v1.FilterDeployment, targets []*v1.WorkloadTarget) []*v1.WorkloadTarget {
+	var removed []*v1.WorkloadTarget
+	for _, status := range obj.Status.GetWorkloadStatuses() {
+		if status.GetTarget() == nil || containsTarget(targets, status.GetTarget()) || containsTarget(removed, status.GetTarget()) {
+			continue
+		}
+		removed = append(removed, status.GetTarget())
+	}
+	return removed
+}
+
+func containsTarget(targets []*v1.WorkloadTarget, target *v1.WorkloadTarget) bool {
+	for _, t := range targets {
+		if proto.Equal(t, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns true if the target selects the workload of the kind with the name and labels
+func targetSelects(target *v1.WorkloadTarget, kind, namespace, name string, workloadLabels map[string]string) bool {
+	if target == nil || target.Kind != kind || target.Namespace != namespace {
+		return false
+	}
+	if target.Name != "" && target.Name != name {
+		return false
+	}
+	return labels.SelectorFromSet(target.Labels).Matches(labels.Set(workloadLabels))
+}
+
+func describeTarget(target *v1.WorkloadTarget) string {
+	description := target.Kind + " workloads in namespace " + target.Namespace
+	if target.Name != "" {
+		description = fmt.Sprintf("%v %v.%v", target.Kind, target.Name, target.Namespace)
+	}
+	if len(target.Labels) > 0 {
+		description += " with labels " + labels.SelectorFromSet(target.Labels).String()
+	}
+	return description
+}
@@ -0,0 +1,140 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/solo-io/wasm/tools/wasme/pkg/progress"
+)
+
+const (
+	barWidth = 30
+	// the percentages printed when the output is not a terminal are multiples of the step
+	percentageStep = 25
+	// the interval of the log lines of the progress of each transfer
+	DefaultLogInterval = 10 * time.Second
+)
+
+// NewTerminal returns a progress function which renders a progress bar of each transfer to out if it is a terminal,
+// or else prints the percentage of each transfer every 25%
+func NewTerminal(out *os.File) progress.Func {
+	return newPrinter(out, isTerminal(out))
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func newPrinter(out io.Writer, bars bool) progress.Func {
+	p := &printer{out: out, bars: bars, printed: map[string]int{}}
+	return p.print
+}
+
+// prints the progress of the transfers to out.
+// a bar is redrawn whenever its percentage changes, and is ended with a new line once its transfer is done
+type printer struct {
+	out  io.Writer
+	bars bool
+
+	lock sync.Mutex
+	// the last percentage printed for each transfer
+	printed map[string]int
+}
+
+func (p *printer) print(update progress.Update) {
+	percentage := 100
+	if update.Total() > 0 {
+		percentage = int(update.Transferred * 100 / update.Total())
+	}
+	if !p.bars {
+		percentage -= percentage % percentageStep
+	}
+	key := update.Ref + "@" + update.Descriptor.Digest.String()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	last, ok := p.printed[key]
+	if ok && last == percentage {
+		return
+	}
+	p.printed[key] = percentage
+
+	if !p.bars {
+		fmt.Fprintf(p.out, "%v: %3d%% of %v\n", blobName(update), percentage, formatBytes(update.Total()))
+		return
+	}
+	filled := barWidth * percentage / 100
+	bar := strings.Repeat("=", filled)
+	if filled < barWidth {
+		bar += ">" + strings.Repeat(" ", barWidth-filled-1)
+	}
+	fmt.Fprintf(p.out, "\r%v [%v] %3d%% %v/%v", blobName(update), bar, percentage, formatBytes(update.Transferred), formatBytes(update.Total()))
+	if update.Done() {
+		fmt.Fprintln(p.out)
+	}
+}
+
+// NewLogger returns a progress function which logs the progress of each transfer at most once per interval,
+// and once it is done, for processes whose output is not read by a user, such as the cache
+func NewLogger(interval time.Duration) progress.Func {
+	l := &logger{interval: interval, logged: map[string]time.Time{}}
+	return l.log
+}
+
+type logger struct {
+	interval time.Duration
+
+	lock sync.Mutex
+	// when the progress of each transfer was logged, or started
+	logged map[string]time.Time
+}
+
+func (l *logger) log(update progress.Update) {
+	key := update.Ref + "@" + update.Descriptor.Digest.String()
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	logged, ok := l.logged[key]
+	switch {
+	case update.Done():
+		delete(l.logged, key)
+		logrus.Infof("transferred %v of image %v (%v)", update.Descriptor.Digest, update.Ref, formatBytes(update.Total()))
+	case !ok:
+		l.logged[key] = time.Now()
+	case time.Since(logged) >= l.interval:
+		l.logged[key] = time.Now()
+		logrus.Infof("transferring %v of image %v: %v of %v", update.Descriptor.Digest, update.Ref, formatBytes(update.Transferred), formatBytes(update.Total()))
+	}
+}
+
+// the title of the blob, e.g. filter.wasm, or its short digest
+func blobName(update progress.Update) string {
+	name := update.Descriptor.Digest.Encoded()
+	if len(name) > 12 {
+		name = name[:12]
+	}
+	if title := update.Descriptor.Annotations[ocispec.AnnotationTitle]; title != "" {
+		name = title + " " + name
+	}
+	return name
+}
+
+func formatBytes(b int64) string {
+	const unit = 1000
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(b)/float64(div), "kMGTPE"[exp])
+}
@@ -2,6 +2,7 @@ package build_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"io"
 	"os"
 	"path/filepath"
@@ -213,4 +214,49 @@ var _ = Describe("Build", func() {
 			ExpectTinyGoExampleToWorkInIstioVersion("1.7")
 		})
 	})
+	Context("init templates", func() {
+		// every template listed by wasme init --list-templates, initialized without the prompt
+		type listedTemplate struct {
+			Language  string `json:"language"`
+			Platforms []struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			} `json:"platforms"`
+		}
+
+		It("builds every template with the build of its language", func() {
+			out, err := test.WasmeCliOutput("init", "--list-templates")
+			Expect(err).NotTo(HaveOccurred())
+			var templates []listedTemplate
+			Expect(json.Unmarshal([]byte(out), &templates)).NotTo(HaveOccurred())
+			Expect(templates).NotTo(BeEmpty())
+
+			err = test.RunMake("builder-image")
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, template := range templates {
+				platform := template.Platforms[0]
+				By(template.Language + " for " + platform.Name + " " + platform.Version)
+				os.RemoveAll("test-filter")
+
+				err := test.WasmeCli("init", "test-filter",
+					"--disable-prompt",
+					"--language="+template.Language,
+					"--platform="+platform.Name,
+					"--platform-version="+platform.Version,
+				)
+				Expect(err).NotTo(HaveOccurred())
+
+				err = test.WasmeCli(
+					"build",
+					template.Language,
+					// need to run with --tmp-dir=. in CI due to docker mount concerns
+					"--tmp-dir=.",
+					"-t=testimage-"+template.Language,
+					"test-filter",
+				)
+				Expect(err).NotTo(HaveOccurred())
+			}
+		})
+	})
 })
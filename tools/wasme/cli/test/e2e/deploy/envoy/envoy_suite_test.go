@@ -0,0 +1,14 @@
+package envoy_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/solo-io/solo-kit/test/helpers"
+)
+
+func TestOperator(t *testing.T) {
+	helpers.RegisterCommonFailHandlers()
+	helpers.SetupLog()
+	RunSpecs(t, "Deploy Envoy Suite")
+}
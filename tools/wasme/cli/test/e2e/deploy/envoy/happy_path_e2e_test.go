@@ -0,0 +1,80 @@
+package envoy_test
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/wasm/tools/wasme/cli/test"
+	testvars "github.com/solo-io/wasm/tools/wasme/pkg/consts/test"
+	"github.com/solo-io/wasm/tools/wasme/pkg/util"
+)
+
+// the version of the Istio proxy the v3 filter is run in, unless ISTIO_PROXY_VERSION is set
+const defaultIstioProxyVersion = "1.8.2"
+
+var _ = Describe("wasme deploy envoy", func() {
+	const filterId = "e2e_envoy_filter"
+
+	AfterEach(func() {
+		util.Docker(nil, nil, nil, "kill", filterId)
+	})
+
+	// runs the filter with wasme deploy envoy, and expects the header added by the filter in the responses of the listener
+	expectFilterRuns := func(port int, args ...string) {
+		args = append([]string{"deploy", "envoy",
+			"--id=" + filterId,
+			"--config=world",
+			fmt.Sprintf("--port=%v", port),
+			fmt.Sprintf("--admin-port=%v", port+1),
+		}, args...)
+
+		var runError error
+		var errLock sync.RWMutex
+		go func() {
+			defer GinkgoRecover()
+			err := test.WasmeCli(args...)
+			errLock.Lock()
+			runError = err
+			errLock.Unlock()
+		}()
+
+		t := time.Tick(time.Second)
+		testRequest := func() (string, error) {
+			errLock.RLock()
+			Expect(runError).NotTo(HaveOccurred())
+			errLock.RUnlock()
+			b := &bytes.Buffer{}
+			err := util.ExecCmd(b, b, nil, "curl", "-v", fmt.Sprintf("localhost:%v/", port))
+
+			out := b.String()
+			select {
+			case <-t:
+				log.Printf("out: %v", out)
+				log.Printf("err: %v", err)
+			default:
+			}
+			return out, err
+		}
+
+		Eventually(testRequest, time.Minute*5).Should(ContainSubstring("hello: world"))
+	}
+
+	It("runs the filter in the default envoy image", func() {
+		expectFilterRuns(8080, testvars.IstioAssemblyScriptImage)
+	})
+
+	It("runs the filter in the istio proxy", func() {
+		image := test.GetImageTagIstioV3()
+		version := os.Getenv("ISTIO_PROXY_VERSION")
+		if version == "" {
+			version = defaultIstioProxyVersion
+		}
+		expectFilterRuns(8090, image, "--istio-proxy-version="+version)
+	})
+})
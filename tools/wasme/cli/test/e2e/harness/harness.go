@@ -0,0 +1,242 @@
+// Package harness provides helpers for verifying the EnvoyFilters generated by wasme
+// against a real istiod.
+//
+// A harness Cluster wraps a kind cluster (or the cluster in the current KUBECONFIG)
+// with a pinned version of Istio installed. Filters are deployed to sample workloads
+// with the istio Provider, and the resulting sidecar config is read back with
+// `istioctl proxy-config`. The Istio version is read from the environment,
+// so the same tests can run against a matrix of Istio versions.
+package harness
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/solo-io/go-utils/kubeutils"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// the version of Istio to test against, e.g. 1.7.3. required
+	IstioVersionEnv = "ISTIO_VERSION"
+
+	// if set, a kind cluster with this name is created (unless it already exists)
+	// and deleted on Teardown. otherwise the cluster in the current KUBECONFIG is used
+	KindClusterEnv = "WASME_TEST_KIND_CLUSTER"
+
+	// path to an istioctl binary for the Istio version.
+	// if unset, istioctl is used from the PATH if its version matches,
+	// otherwise the istioctl release is downloaded
+	IstioctlEnv = "ISTIOCTL"
+
+	// the image repository and tag of the wasme cache.
+	// default to the cache image of this version of wasme
+	CacheImageRepoEnv = "WASME_TEST_CACHE_IMAGE_REPO"
+	CacheImageTagEnv  = "WASME_TEST_CACHE_IMAGE_TAG"
+
+	istioNamespace = "istio-system"
+)
+
+type Config struct {
+	// the version of Istio to install
+	IstioVersion string
+
+	// if set, run against a kind cluster with this name
+	KindCluster string
+
+	// path to the istioctl binary
+	Istioctl string
+
+	// the image of the wasme cache
+	CacheImageRepo string
+	CacheImageTag  string
+}
+
+// ConfigFromEnv reads the harness Config from the environment
+func ConfigFromEnv() Config {
+	return Config{
+		IstioVersion:   strings.TrimSpace(os.Getenv(IstioVersionEnv)),
+		KindCluster:    strings.TrimSpace(os.Getenv(KindClusterEnv)),
+		Istioctl:       strings.TrimSpace(os.Getenv(IstioctlEnv)),
+		CacheImageRepo: strings.TrimSpace(os.Getenv(CacheImageRepoEnv)),
+		CacheImageTag:  strings.TrimSpace(os.Getenv(CacheImageTagEnv)),
+	}
+}
+
+// a cluster running the pinned version of Istio
+type Cluster struct {
+	Config     Config
+	RestConfig *rest.Config
+	KubeClient kubernetes.Interface
+
+	// path to the kubeconfig passed to istioctl, empty for the default
+	kubeconfig string
+	istioctl   string
+
+	// temporary files created by the harness
+	workDir string
+	// true if the kind cluster was created by Setup
+	createdKindCluster bool
+}
+
+// Setup prepares the cluster for the tests: creates the kind cluster if configured,
+// then installs Istio unless the configured version is already installed
+func Setup(ctx context.Context, cfg Config) (*Cluster, error) {
+	if cfg.IstioVersion == "" {
+		return nil, errors.Errorf("must specify the istio version to test against with %v", IstioVersionEnv)
+	}
+
+	workDir, err := ioutil.TempDir("", "wasme-harness")
+	if err != nil {
+		return nil, err
+	}
+	c := &Cluster{
+		Config:  cfg,
+		workDir: workDir,
+	}
+
+	if err := c.setup(ctx); err != nil {
+		if teardownErr := c.Teardown(); teardownErr != nil {
+			logrus.Warnf("failed to tear down cluster: %v", teardownErr)
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Cluster) setup(ctx context.Context) error {
+	if c.Config.KindCluster != "" {
+		if err := c.ensureKindCluster(); err != nil {
+			return errors.Wrap(err, "creating kind cluster")
+		}
+	}
+
+	if err := c.connect(); err != nil {
+		return errors.Wrap(err, "connecting to cluster")
+	}
+
+	istioctl, err := c.resolveIstioctl()
+	if err != nil {
+		return errors.Wrap(err, "resolving istioctl")
+	}
+	c.istioctl = istioctl
+
+	return c.ensureIstio(ctx)
+}
+
+// Teardown deletes the kind cluster if it was created by Setup
+func (c *Cluster) Teardown() error {
+	defer os.RemoveAll(c.workDir)
+	if !c.createdKindCluster {
+		return nil
+	}
+	return run("kind", "delete", "cluster", "--name", c.Config.KindCluster)
+}
+
+// LoadImage makes a locally built image available to the kind cluster.
+// it is a no-op when running against the cluster in the current KUBECONFIG
+func (c *Cluster) LoadImage(image string) error {
+	if c.Config.KindCluster == "" {
+		return nil
+	}
+	return run("kind", "load", "docker-image", "--name", c.Config.KindCluster, image)
+}
+
+func (c *Cluster) ensureKindCluster() error {
+	out, err := output("kind", "get", "clusters")
+	if err != nil {
+		return err
+	}
+	exists := false
+	for _, name := range strings.Fields(string(out)) {
+		if name == c.Config.KindCluster {
+			exists = true
+		}
+	}
+	if !exists {
+		if err := run("kind", "create", "cluster", "--name", c.Config.KindCluster, "--wait", "5m"); err != nil {
+			return err
+		}
+		c.createdKindCluster = true
+	}
+
+	kubeconfig, err := output("kind", "get", "kubeconfig", "--name", c.Config.KindCluster)
+	if err != nil {
+		return err
+	}
+	c.kubeconfig = filepath.Join(c.workDir, "kubeconfig")
+	return ioutil.WriteFile(c.kubeconfig, kubeconfig, 0600)
+}
+
+func (c *Cluster) connect() error {
+	var err error
+	if c.kubeconfig != "" {
+		c.RestConfig, err = clientcmd.BuildConfigFromFlags("", c.kubeconfig)
+	} else {
+		c.RestConfig, err = kubeutils.GetConfig("", "")
+	}
+	if err != nil {
+		return err
+	}
+	c.KubeClient, err = kubernetes.NewForConfig(c.RestConfig)
+	return err
+}
+
+// installs Istio if it is not already installed.
+// errors if a different version of Istio is installed
+func (c *Cluster) ensureIstio(ctx context.Context) error {
+	installedVersion, err := istio.NewVersionInspector(c.KubeClient, istioNamespace, "", "").GetIstioVersion()
+	if err != nil {
+		return errors.Wrap(err, "checking installed istio version")
+	}
+	if installedVersion != "" {
+		if !strings.HasPrefix(installedVersion, c.Config.IstioVersion) {
+			return errors.Errorf("cluster is running istio %v, expected %v", installedVersion, c.Config.IstioVersion)
+		}
+		logrus.Infof("istio %v is already installed", installedVersion)
+		return nil
+	}
+
+	logrus.Infof("installing istio %v", c.Config.IstioVersion)
+	// manifest apply is deprecated after Istio 1.5, use install for later versions
+	if strings.HasPrefix(c.Config.IstioVersion, "1.5") {
+		err = c.runIstioctl("manifest", "apply", "--set", "profile=minimal")
+	} else {
+		err = c.runIstioctl("install", "--set", "profile=minimal", "--skip-confirmation")
+	}
+	if err != nil {
+		return errors.Wrap(err, "installing istio")
+	}
+
+	return c.waitForDeployment(ctx, istioNamespace, "istiod", 5*time.Minute)
+}
+
+func run(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "running %v %v", name, strings.Join(args, " "))
+	}
+	return nil
+}
+
+func output(name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "running %v %v", name, strings.Join(args, " "))
+	}
+	return out, nil
+}
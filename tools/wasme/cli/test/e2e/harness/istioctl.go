@@ -0,0 +1,119 @@
+package harness
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const istioReleaseUrl = "https://github.com/istio/istio/releases/download"
+
+// returns the path to an istioctl binary for the configured Istio version
+func (c *Cluster) resolveIstioctl() (string, error) {
+	if c.Config.Istioctl != "" {
+		return c.Config.Istioctl, nil
+	}
+
+	if path, err := exec.LookPath("istioctl"); err == nil {
+		out, err := output(path, "version", "--remote=false", "--short")
+		if err == nil && strings.TrimSpace(string(out)) == c.Config.IstioVersion {
+			return path, nil
+		}
+	}
+
+	return c.downloadIstioctl()
+}
+
+// downloads the istioctl release for the configured Istio version into the work dir
+func (c *Cluster) downloadIstioctl() (string, error) {
+	url, err := istioctlReleaseUrl(c.Config.IstioVersion)
+	if err != nil {
+		return "", err
+	}
+	logrus.Infof("downloading istioctl from %v", url)
+
+	res, err := http.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", errors.Errorf("downloading %v: %v", url, res.Status)
+	}
+
+	gz, err := gzip.NewReader(res.Body)
+	if err != nil {
+		return "", err
+	}
+	archive := tar.NewReader(gz)
+
+	binary := fmt.Sprintf("istio-%v/bin/istioctl", c.Config.IstioVersion)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return "", errors.Errorf("%v not found in %v", binary, url)
+		}
+		if err != nil {
+			return "", err
+		}
+		if header.Name != binary {
+			continue
+		}
+
+		path := filepath.Join(c.workDir, "istioctl")
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		if _, err := io.Copy(f, archive); err != nil {
+			return "", err
+		}
+		return path, nil
+	}
+}
+
+// the url of the istio release archive for the current platform
+func istioctlReleaseUrl(istioVersion string) (string, error) {
+	var platform string
+	switch runtime.GOOS {
+	case "linux":
+		platform = "linux-" + runtime.GOARCH
+		// istio 1.5 only released a single linux archive
+		if strings.HasPrefix(istioVersion, "1.5") {
+			platform = "linux"
+		}
+	case "darwin":
+		platform = "osx"
+	default:
+		return "", errors.Errorf("no istio release available for %v", runtime.GOOS)
+	}
+	return fmt.Sprintf("%v/%v/istio-%v-%v.tar.gz", istioReleaseUrl, istioVersion, istioVersion, platform), nil
+}
+
+func (c *Cluster) istioctlArgs(args ...string) []string {
+	if c.kubeconfig != "" {
+		args = append(args, "--kubeconfig", c.kubeconfig)
+	}
+	return args
+}
+
+func (c *Cluster) runIstioctl(args ...string) error {
+	return run(c.istioctl, c.istioctlArgs(args...)...)
+}
+
+// ListenerConfig returns the listener config of the pod's sidecar as JSON,
+// as reported by `istioctl proxy-config listener`
+func (c *Cluster) ListenerConfig(namespace, podName string) ([]byte, error) {
+	return output(c.istioctl, c.istioctlArgs("proxy-config", "listener", podName+"."+namespace, "-o", "json")...)
+}
@@ -0,0 +1,264 @@
+package harness
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/cache"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/deploy/istio"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
+	"github.com/solo-io/wasm/tools/wasme/pkg/resolver"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const pollInterval = 2 * time.Second
+
+// DeploySampleWorkload creates a namespace with sidecar injection enabled
+// and an http echo Deployment, and waits for the Deployment to become ready.
+// the pods of the Deployment have the label app=<name>
+func (c *Cluster) DeploySampleWorkload(ctx context.Context, namespace, name string) error {
+	_, err := c.KubeClient.CoreV1().Namespaces().Create(&corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   namespace,
+			Labels: map[string]string{"istio-injection": "enabled"},
+		},
+	})
+	if err != nil && !kubeerrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	podLabels := map[string]string{"app": name}
+	_, err = c.KubeClient.AppsV1().Deployments(namespace).Create(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: podLabels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: podLabels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:  "http-echo",
+						Image: "hashicorp/http-echo",
+						Args:  []string{"-text=hi"},
+						Ports: []corev1.ContainerPort{{
+							Name:          "http",
+							ContainerPort: 5678,
+						}},
+					}},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.waitForDeployment(ctx, namespace, name, 5*time.Minute)
+}
+
+// DeleteNamespace deletes a namespace created by DeploySampleWorkload
+func (c *Cluster) DeleteNamespace(namespace string) error {
+	err := c.KubeClient.CoreV1().Namespaces().Delete(namespace, &metav1.DeleteOptions{})
+	if kubeerrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// ApplyFilter deploys the wasme cache and applies the filter to all Deployments
+// in the namespace with the istio Provider, as `wasme deploy istio` would
+func (c *Cluster) ApplyFilter(ctx context.Context, namespace string, filter *v1.FilterSpec) error {
+	cacheDeployer := cache.NewDeployer(
+		c.KubeClient,
+		cache.CacheNamespace,
+		cache.CacheName,
+		c.Config.CacheImageRepo,
+		c.Config.CacheImageTag,
+		nil,
+		corev1.PullIfNotPresent,
+		"",
+		"",
+	)
+	if err := cacheDeployer.EnsureCache(); err != nil {
+		return errors.Wrap(err, "deploying wasme cache")
+	}
+	if err := c.waitForDaemonSet(ctx, cache.CacheNamespace, cache.CacheName, 5*time.Minute); err != nil {
+		return errors.Wrap(err, "waiting for wasme cache")
+	}
+
+	client, err := istio.NewEnsurer(ctx, c.RestConfig)
+	if err != nil {
+		return err
+	}
+
+	resolver, _ := resolver.NewResolver("", "", false, false)
+	puller := pull.NewPuller(resolver)
+
+	provider, err := istio.NewProvider(
+		ctx,
+		c.KubeClient,
+		client,
+		puller,
+		istio.Workload{
+			Namespace: namespace,
+			Kind:      istio.WorkloadTypeDeployment,
+		},
+		istio.Cache{
+			Name:      cache.CacheName,
+			Namespace: cache.CacheNamespace,
+		},
+		nil,
+		nil,
+		istioNamespace,
+		"",
+		time.Minute,
+		false,
+	)
+	if err != nil {
+		return err
+	}
+
+	deployer := &deploy.Deployer{
+		Ctx:      ctx,
+		Puller:   puller,
+		Provider: provider,
+	}
+	return deployer.ApplyFilter(filter)
+}
+
+// WaitForFilterInListeners waits until the listener config of every running pod
+// in the namespace matching the selector contains the wasm filter with the given id
+func (c *Cluster) WaitForFilterInListeners(ctx context.Context, namespace string, selector map[string]string, filterId string, timeout time.Duration) error {
+	return poll(ctx, timeout, func() error {
+		pods, err := c.KubeClient.CoreV1().Pods(namespace).List(metav1.ListOptions{
+			LabelSelector: labels.SelectorFromSet(selector).String(),
+		})
+		if err != nil {
+			return err
+		}
+		var running int
+		for _, pod := range pods.Items {
+			if pod.DeletionTimestamp != nil {
+				continue
+			}
+			if pod.Status.Phase != corev1.PodRunning {
+				return errors.Errorf("pod %v is %v", pod.Name, pod.Status.Phase)
+			}
+			listeners, err := c.ListenerConfig(namespace, pod.Name)
+			if err != nil {
+				return err
+			}
+			found, err := hasWasmFilter(listeners, filterId)
+			if err != nil {
+				return errors.Wrapf(err, "parsing listener config of pod %v", pod.Name)
+			}
+			if !found {
+				return errors.Errorf("wasm filter %v not found in listener config of pod %v", filterId, pod.Name)
+			}
+			running++
+		}
+		if running == 0 {
+			return errors.Errorf("no running pods found in namespace %v matching %v", namespace, selector)
+		}
+		return nil
+	})
+}
+
+// returns true if the listener config contains an http filter
+// named envoy.filters.http.wasm (or envoy.wasm for older proxies) configured with the filter id
+func hasWasmFilter(listeners []byte, filterId string) (bool, error) {
+	var config interface{}
+	if err := json.Unmarshal(listeners, &config); err != nil {
+		return false, err
+	}
+	pluginName, err := json.Marshal(map[string]string{"name": filterId})
+	if err != nil {
+		return false, err
+	}
+	// match the "name" field of the plugin config
+	pluginName = bytes.Trim(pluginName, "{}")
+
+	var found bool
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if name, _ := v["name"].(string); strings.HasSuffix(name, ".wasm") {
+				raw, err := json.Marshal(v)
+				if err == nil && bytes.Contains(raw, pluginName) {
+					found = true
+					return
+				}
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(config)
+	return found, nil
+}
+
+func (c *Cluster) waitForDeployment(ctx context.Context, namespace, name string, timeout time.Duration) error {
+	return poll(ctx, timeout, func() error {
+		deployment, err := c.KubeClient.AppsV1().Deployments(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if deployment.Status.ObservedGeneration < deployment.Generation ||
+			deployment.Status.UpdatedReplicas != deployment.Status.Replicas ||
+			deployment.Status.AvailableReplicas == 0 {
+			return errors.Errorf("deployment %v.%v is not ready", name, namespace)
+		}
+		return nil
+	})
+}
+
+func (c *Cluster) waitForDaemonSet(ctx context.Context, namespace, name string, timeout time.Duration) error {
+	return poll(ctx, timeout, func() error {
+		daemonSet, err := c.KubeClient.AppsV1().DaemonSets(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if daemonSet.Status.DesiredNumberScheduled == 0 || daemonSet.Status.NumberReady != daemonSet.Status.DesiredNumberScheduled {
+			return errors.Errorf("daemonset %v.%v is not ready", name, namespace)
+		}
+		return nil
+	})
+}
+
+// calls check until it succeeds, returning the last error on timeout
+func poll(ctx context.Context, timeout time.Duration, check func() error) error {
+	deadline := time.After(timeout)
+	for {
+		err := check()
+		if err == nil {
+			return nil
+		}
+		logrus.Debugf("waiting: %v", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			return errors.Errorf("timed out after %v (last err: %v)", timeout, err)
+		case <-time.After(pollInterval):
+		}
+	}
+}
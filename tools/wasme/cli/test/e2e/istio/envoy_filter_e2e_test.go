@@ -0,0 +1,64 @@
+package istio_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/solo-io/go-utils/randutils"
+	v1 "github.com/solo-io/wasm/tools/wasme/cli/pkg/operator/api/wasme.io/v1"
+	"github.com/solo-io/wasm/tools/wasme/cli/test"
+	"github.com/solo-io/wasm/tools/wasme/cli/test/e2e/harness"
+)
+
+var _ = Describe("EnvoyFilter semantics", func() {
+	var (
+		ctx     context.Context
+		cancel  = func() {}
+		cluster *harness.Cluster
+		ns      string
+	)
+
+	BeforeEach(func() {
+		cfg := harness.ConfigFromEnv()
+		if cfg.IstioVersion == "" {
+			Skip("Skipping EnvoyFilter semantics test. To enable, set " + harness.IstioVersionEnv + " to the version of Istio to test against")
+		}
+
+		ctx, cancel = context.WithCancel(context.Background())
+
+		var err error
+		cluster, err = harness.Setup(ctx, cfg)
+		Expect(err).NotTo(HaveOccurred())
+
+		ns = "wasme-harness-" + randutils.RandString(4)
+	})
+
+	AfterEach(func() {
+		cancel()
+		if cluster == nil {
+			return
+		}
+		Expect(cluster.DeleteNamespace(ns)).NotTo(HaveOccurred())
+		Expect(cluster.Teardown()).NotTo(HaveOccurred())
+	})
+
+	It("adds the wasm filter to the listeners of the workload sidecars", func() {
+		image := test.GetImageTagIstio()
+
+		err := cluster.DeploySampleWorkload(ctx, ns, "echo")
+		Expect(err).NotTo(HaveOccurred())
+
+		filter := &v1.FilterSpec{
+			Id:    "harness-filter",
+			Image: image,
+		}
+		err = cluster.ApplyFilter(ctx, ns, filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cluster.WaitForFilterInListeners(ctx, ns, map[string]string{"app": "echo"}, filter.Id, 5*time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
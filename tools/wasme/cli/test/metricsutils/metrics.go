@@ -0,0 +1,21 @@
+// helpers for testing the prometheus metrics. this package must not import the packages under test,
+// so that their internal tests can use it
+package metricsutils
+
+import (
+	"github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Gather returns the metrics of the family with the given name gathered by the gatherer
+func Gather(gatherer prometheus.Gatherer, name string) []*dto.Metric {
+	families, err := gatherer.Gather()
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred())
+	for _, family := range families {
+		if family.GetName() == name {
+			return family.GetMetric()
+		}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package test
 
 import (
+	"bytes"
 	"io/ioutil"
 	"log"
 	"os"
@@ -28,6 +29,16 @@ func WasmeCli(args ...string) error {
 	return c.Execute()
 }
 
+// runs the CLI, returning what the command printed
+func WasmeCliOutput(args ...string) (string, error) {
+	out := &bytes.Buffer{}
+	c := cmd.Cmd()
+	c.SetArgs(args)
+	c.SetOut(out)
+	err := c.Execute()
+	return out.String(), err
+}
+
 func RunMake(target string, opts ...func(*exec.Cmd)) error {
 	cmd := exec.Command("make", "-B", "-C", filepath.Dir(util.GoModPath()), target)
 	cmd.Stderr = os.Stderr
@@ -68,6 +79,11 @@ func GetImageTagIstio() string {
 	return GetEnv("FILTER_IMAGE_ISTIO_TAG")
 }
 
+// the tag of a filter image built for the proxies of Istio 1.7+
+func GetImageTagIstioV3() string {
+	return GetEnv("FILTER_IMAGE_ISTIO_V3_TAG")
+}
+
 func GetBuildImageTag() string {
 	return GetEnv("FILTER_BUILD_IMAGE_TAG")
 }
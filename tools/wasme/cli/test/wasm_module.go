@@ -0,0 +1,18 @@
+package test
+
+// ProxyWasmModule returns a minimal wasm module exporting the symbols of a proxy-wasm module implementing
+// the ABI version, e.g. proxy_abi_version_0_2_0. only the exports of the module are defined
+func ProxyWasmModule(abiVersionExport string) []byte {
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	exports := []string{"proxy_on_context_create", abiVersionExport}
+	section := []byte{byte(len(exports))}
+	for i, export := range exports {
+		section = append(section, byte(len(export)))
+		section = append(section, export...)
+		// a function export, and its index
+		section = append(section, 0x00, byte(i))
+	}
+	// the export section
+	module = append(module, 0x07, byte(len(section)))
+	return append(module, section...)
+}
@@ -0,0 +1,300 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/solo-io/wasm/tools/wasme/pkg/config"
+	"github.com/solo-io/wasm/tools/wasme/pkg/model"
+	"github.com/solo-io/wasm/tools/wasme/pkg/push"
+)
+
+const (
+	indexFilename = "index.json"
+	blobsDirname  = "blobs"
+)
+
+// Save writes the images to w as a tarball of an OCI image layout, which can be read by Load.
+// each image is written with the manifest, config and wasm layer it is pushed with,
+// and is named by its ref in the org.opencontainers.image.ref.name annotation of the index.
+// the descriptor of the wasm layer, including its digest, is kept
+func Save(ctx context.Context, w io.Writer, images ...model.Image) error {
+	tw := tar.NewWriter(w)
+	written := map[digest.Digest]bool{}
+	writeBlob := func(desc ocispec.Descriptor, blob []byte) error {
+		if written[desc.Digest] {
+			return nil
+		}
+		written[desc.Digest] = true
+		return writeFile(tw, path.Join(blobsDirname, desc.Digest.Algorithm().String(), desc.Digest.Encoded()), blob)
+	}
+
+	index := ocispec.Index{Versioned: specs.Versioned{SchemaVersion: 2}}
+	for _, image := range images {
+		manifestDesc, blobs, err := imageBlobs(ctx, image)
+		if err != nil {
+			return errors.Wrapf(err, "saving image %v", image.Ref())
+		}
+		for _, blob := range blobs {
+			if err := writeBlob(blob.desc, blob.content); err != nil {
+				return err
+			}
+		}
+		index.Manifests = append(index.Manifests, manifestDesc)
+	}
+
+	layout, err := json.Marshal(ocispec.ImageLayout{Version: ocispec.ImageLayoutVersion})
+	if err != nil {
+		return err
+	}
+	if err := writeFile(tw, ocispec.ImageLayoutFile, layout); err != nil {
+		return err
+	}
+	indexBytes, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(tw, indexFilename, indexBytes); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+type blob struct {
+	desc    ocispec.Descriptor
+	content []byte
+}
+
+// returns the descriptor of the manifest of the image, named by the ref of the image, and the blobs of the image
+func imageBlobs(ctx context.Context, image model.Image) (ocispec.Descriptor, []blob, error) {
+	cfg, err := image.FetchConfig(ctx)
+	if err != nil {
+		return ocispec.Descriptor{}, nil, err
+	}
+	cfgBytes, err := cfg.ToBytes()
+	if err != nil {
+		return ocispec.Descriptor{}, nil, err
+	}
+	cfgDesc := ocispec.Descriptor{
+		MediaType:   model.ConfigMediaType,
+		Digest:      digest.FromBytes(cfgBytes),
+		Size:        int64(len(cfgBytes)),
+		Annotations: map[string]string{ocispec.AnnotationTitle: model.ConfigFilename},
+	}
+
+	filterDesc, err := image.Descriptor()
+	if err != nil {
+		return ocispec.Descriptor{}, nil, err
+	}
+	filter, err := image.FetchFilter(ctx)
+	if err != nil {
+		return ocispec.Descriptor{}, nil, err
+	}
+	filterBytes, err := ioutil.ReadAll(filter)
+	if err != nil {
+		return ocispec.Descriptor{}, nil, err
+	}
+	if err := verify(filterDesc, filterBytes); err != nil {
+		return ocispec.Descriptor{}, nil, err
+	}
+
+	// the layers of the manifest are the layers pushed by wasme push
+	layers, err := push.ManifestLayers(model.ImageFormat(image), cfgDesc, filterDesc)
+	if err != nil {
+		return ocispec.Descriptor{}, nil, err
+	}
+	manifestBytes, err := json.Marshal(ocispec.Manifest{
+		Versioned:   specs.Versioned{SchemaVersion: 2},
+		Config:      cfgDesc,
+		Layers:      layers,
+		Annotations: push.ManifestAnnotations(cfg),
+	})
+	if err != nil {
+		return ocispec.Descriptor{}, nil, err
+	}
+	manifestDesc := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Digest:    digest.FromBytes(manifestBytes),
+		Size:      int64(len(manifestBytes)),
+	}
+
+	blobs := []blob{
+		{desc: cfgDesc, content: cfgBytes},
+		{desc: filterDesc, content: filterBytes},
+		{desc: manifestDesc, content: manifestBytes},
+	}
+	manifestDesc.Annotations = map[string]string{ocispec.AnnotationRefName: image.Ref()}
+	return manifestDesc, blobs, nil
+}
+
+func writeFile(tw *tar.Writer, name string, content []byte) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(content)),
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return err
+	}
+	_, err := tw.Write(content)
+	return err
+}
+
+// Load reads the images of a tarball of an OCI image layout written by Save, in the order of the index.
+// the content of every blob is verified against its digest.
+// images without a ref in the org.opencontainers.image.ref.name annotation return an empty ref
+func Load(r io.Reader) ([]model.Image, error) {
+	files := map[string][]byte{}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "reading image archive")
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading image archive")
+		}
+		files[path.Clean(header.Name)] = content
+	}
+
+	var layout ocispec.ImageLayout
+	if err := unmarshalFile(files, ocispec.ImageLayoutFile, &layout); err != nil {
+		return nil, err
+	}
+	if layout.Version != ocispec.ImageLayoutVersion {
+		return nil, errors.Errorf("unsupported image layout version %q", layout.Version)
+	}
+	var index ocispec.Index
+	if err := unmarshalFile(files, indexFilename, &index); err != nil {
+		return nil, err
+	}
+
+	readBlob := func(desc ocispec.Descriptor) ([]byte, error) {
+		if err := desc.Digest.Validate(); err != nil {
+			return nil, err
+		}
+		content, ok := files[path.Join(blobsDirname, desc.Digest.Algorithm().String(), desc.Digest.Encoded())]
+		if !ok {
+			return nil, errors.Errorf("blob %v not found in image archive", desc.Digest)
+		}
+		if err := verify(desc, content); err != nil {
+			return nil, err
+		}
+		return content, nil
+	}
+
+	var images []model.Image
+	for _, manifestDesc := range index.Manifests {
+		ref := manifestDesc.Annotations[ocispec.AnnotationRefName]
+		image, err := loadImage(ref, manifestDesc, readBlob)
+		if err != nil {
+			return nil, errors.Wrapf(err, "loading image %v", ref)
+		}
+		images = append(images, image)
+	}
+	return images, nil
+}
+
+func loadImage(ref string, manifestDesc ocispec.Descriptor, readBlob func(desc ocispec.Descriptor) ([]byte, error)) (model.Image, error) {
+	manifestBytes, err := readBlob(manifestDesc)
+	if err != nil {
+		return nil, err
+	}
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return nil, errors.Wrap(err, "parsing manifest")
+	}
+	// images published by other tools have no wasme config
+	cfg := model.DefaultConfig()
+	if manifest.Config.MediaType == model.ConfigMediaType {
+		cfgBytes, err := readBlob(manifest.Config)
+		if err != nil {
+			return nil, err
+		}
+		cfg, err = config.FromBytes(cfgBytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, mediaType := range model.ContentMediaTypes {
+		for _, layer := range manifest.Layers {
+			if layer.MediaType != mediaType {
+				continue
+			}
+			filterBytes, err := readBlob(layer)
+			if err != nil {
+				return nil, err
+			}
+			return &loadedImage{
+				ref:         ref,
+				descriptor:  layer,
+				filterBytes: filterBytes,
+				config:      cfg,
+			}, nil
+		}
+	}
+	return nil, errors.Errorf("media type %v not found on image", strings.Join(model.ContentMediaTypes, " or "))
+}
+
+func unmarshalFile(files map[string][]byte, name string, v interface{}) error {
+	content, ok := files[name]
+	if !ok {
+		return errors.Errorf("%v not found in image archive", name)
+	}
+	if err := json.Unmarshal(content, v); err != nil {
+		return errors.Wrapf(err, "parsing %v", name)
+	}
+	return nil
+}
+
+func verify(desc ocispec.Descriptor, content []byte) error {
+	if actual := desc.Digest.Algorithm().FromBytes(content); actual != desc.Digest {
+		return errors.Errorf("content of blob %v has digest %v", desc.Digest, actual)
+	}
+	if desc.Size != int64(len(content)) {
+		return errors.Errorf("blob %v has size %v, expected %v", desc.Digest, len(content), desc.Size)
+	}
+	return nil
+}
+
+// an image read from an archive
+type loadedImage struct {
+	ref         string
+	descriptor  ocispec.Descriptor
+	filterBytes []byte
+	config      *config.Runtime
+}
+
+func (i *loadedImage) Ref() string {
+	return i.ref
+}
+
+func (i *loadedImage) Descriptor() (ocispec.Descriptor, error) {
+	return i.descriptor, nil
+}
+
+func (i *loadedImage) FetchFilter(ctx context.Context) (model.Filter, error) {
+	return bytes.NewReader(i.filterBytes), nil
+}
+
+func (i *loadedImage) FetchConfig(ctx context.Context) (*config.Runtime, error) {
+	return i.config, nil
+}
@@ -0,0 +1,217 @@
+package archive_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/solo-io/wasm/tools/wasme/pkg/archive"
+	"github.com/solo-io/wasm/tools/wasme/pkg/cache"
+	"github.com/solo-io/wasm/tools/wasme/pkg/config"
+	"github.com/solo-io/wasm/tools/wasme/pkg/model"
+)
+
+var _ = Describe("Archive", func() {
+	filterBytes := []byte("\x00asm module")
+	descriptor := ocispec.Descriptor{
+		MediaType:   model.ContentMediaType,
+		Digest:      digest.FromBytes(filterBytes),
+		Size:        int64(len(filterBytes)),
+		Annotations: map[string]string{ocispec.AnnotationTitle: model.CodeFilename},
+	}
+	runtime := &config.Runtime{
+		Type:        model.ConfigMediaType,
+		AbiVersions: []string{"v0-097b7f2e4cc1fb490cc1943d0d633655ac3c522f"},
+		Config:      &config.EnvoyConfig{RootIds: []string{"add_header"}},
+	}
+
+	image := &testImage{
+		ref:         "webassemblyhub.io/user/filter:v1",
+		descriptor:  descriptor,
+		filterBytes: filterBytes,
+		config:      runtime,
+	}
+
+	It("loads the saved images with their descriptors and configs", func() {
+		other := &testImage{ref: "webassemblyhub.io/user/other:v1", descriptor: descriptor, filterBytes: filterBytes, config: runtime}
+		buf := &bytes.Buffer{}
+		Expect(archive.Save(context.TODO(), buf, image, other)).To(Succeed())
+
+		images, err := archive.Load(buf)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(images).To(HaveLen(2))
+		Expect(images[0].Ref()).To(Equal(image.ref))
+		Expect(images[1].Ref()).To(Equal(other.ref))
+
+		loaded := images[0]
+		desc, err := loaded.Descriptor()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(desc).To(Equal(descriptor))
+		filename, err := cache.Digest2filename(desc.Digest)
+		Expect(err).NotTo(HaveOccurred())
+		expectedFilename, err := cache.Digest2filename(descriptor.Digest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filename).To(Equal(expectedFilename))
+
+		filter, err := loaded.FetchFilter(context.TODO())
+		Expect(err).NotTo(HaveOccurred())
+		content, err := ioutil.ReadAll(filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(content).To(Equal(filterBytes))
+
+		cfg, err := loaded.FetchConfig(context.TODO())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.AbiVersions).To(Equal(runtime.AbiVersions))
+		Expect(cfg.Config.RootIds).To(Equal(runtime.Config.RootIds))
+	})
+
+	It("writes an OCI image layout", func() {
+		buf := &bytes.Buffer{}
+		Expect(archive.Save(context.TODO(), buf, image)).To(Succeed())
+
+		var names []string
+		tr := tar.NewReader(buf)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+			names = append(names, header.Name)
+		}
+		Expect(names).To(ContainElement(ocispec.ImageLayoutFile))
+		Expect(names).To(ContainElement("index.json"))
+		Expect(names).To(ContainElement("blobs/sha256/" + descriptor.Digest.Encoded()))
+		// config, filter and manifest
+		Expect(names).To(HaveLen(5))
+	})
+
+	It("saves images in the format they record", func() {
+		compat := &testImage{ref: image.ref, descriptor: descriptor, filterBytes: filterBytes, config: runtime, format: model.FormatCompat}
+		buf := &bytes.Buffer{}
+		Expect(archive.Save(context.TODO(), buf, compat)).To(Succeed())
+
+		var manifest ocispec.Manifest
+		Expect(json.Unmarshal(readManifest(buf.Bytes()), &manifest)).To(Succeed())
+		Expect(manifest.Config.MediaType).To(Equal(model.ConfigMediaType))
+		Expect(manifest.Layers).To(Equal([]ocispec.Descriptor{descriptor}))
+
+		images, err := archive.Load(buf)
+		Expect(err).NotTo(HaveOccurred())
+		cfg, err := images[0].FetchConfig(context.TODO())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.AbiVersions).To(Equal(runtime.AbiVersions))
+	})
+
+	It("loads the images of other tools with the default config", func() {
+		layer := ocispec.Descriptor{MediaType: model.WasmContentMediaType, Digest: descriptor.Digest, Size: descriptor.Size}
+		cfgBytes := []byte("{}")
+		cfgDesc := ocispec.Descriptor{MediaType: "application/vnd.wasm.config.v0+json", Digest: digest.FromBytes(cfgBytes), Size: int64(len(cfgBytes))}
+		manifestBytes, err := json.Marshal(ocispec.Manifest{Versioned: specs.Versioned{SchemaVersion: 2}, Config: cfgDesc, Layers: []ocispec.Descriptor{layer}})
+		Expect(err).NotTo(HaveOccurred())
+		manifestDesc := ocispec.Descriptor{
+			MediaType:   ocispec.MediaTypeImageManifest,
+			Digest:      digest.FromBytes(manifestBytes),
+			Size:        int64(len(manifestBytes)),
+			Annotations: map[string]string{ocispec.AnnotationRefName: image.ref},
+		}
+		indexBytes, err := json.Marshal(ocispec.Index{Versioned: specs.Versioned{SchemaVersion: 2}, Manifests: []ocispec.Descriptor{manifestDesc}})
+		Expect(err).NotTo(HaveOccurred())
+
+		buf := &bytes.Buffer{}
+		tw := tar.NewWriter(buf)
+		for name, content := range map[string][]byte{
+			ocispec.ImageLayoutFile: []byte(`{"imageLayoutVersion":"1.0.0"}`),
+			"index.json":            indexBytes,
+			"blobs/sha256/" + cfgDesc.Digest.Encoded():      cfgBytes,
+			"blobs/sha256/" + layer.Digest.Encoded():        filterBytes,
+			"blobs/sha256/" + manifestDesc.Digest.Encoded(): manifestBytes,
+		} {
+			Expect(tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})).To(Succeed())
+			_, err := tw.Write(content)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(tw.Close()).To(Succeed())
+
+		images, err := archive.Load(buf)
+		Expect(err).NotTo(HaveOccurred())
+		desc, err := images[0].Descriptor()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(desc).To(Equal(layer))
+		cfg, err := images[0].FetchConfig(context.TODO())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg).To(Equal(model.DefaultConfig()))
+	})
+
+	It("does not save images whose filter does not match their descriptor", func() {
+		corrupt := &testImage{ref: image.ref, descriptor: descriptor, filterBytes: []byte("corrupt"), config: runtime}
+		err := archive.Save(context.TODO(), ioutil.Discard, corrupt)
+		Expect(err).To(MatchError(ContainSubstring("content of blob " + descriptor.Digest.String())))
+	})
+
+	It("does not load blobs whose content does not match their digest", func() {
+		buf := &bytes.Buffer{}
+		Expect(archive.Save(context.TODO(), buf, image)).To(Succeed())
+
+		// replaces the content of the filter with content of the same length
+		corrupted := bytes.Replace(buf.Bytes(), filterBytes, []byte("\x00ASM MODULE"), -1)
+		_, err := archive.Load(bytes.NewReader(corrupted))
+		Expect(err).To(MatchError(ContainSubstring("content of blob " + descriptor.Digest.String())))
+	})
+})
+
+// returns the manifest of the single image of an archive
+func readManifest(archiveBytes []byte) []byte {
+	files := map[string][]byte{}
+	tr := tar.NewReader(bytes.NewReader(archiveBytes))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		Expect(err).NotTo(HaveOccurred())
+		content, err := ioutil.ReadAll(tr)
+		Expect(err).NotTo(HaveOccurred())
+		files[header.Name] = content
+	}
+	var index ocispec.Index
+	Expect(json.Unmarshal(files["index.json"], &index)).To(Succeed())
+	Expect(index.Manifests).To(HaveLen(1))
+	return files["blobs/sha256/"+index.Manifests[0].Digest.Encoded()]
+}
+
+type testImage struct {
+	ref         string
+	descriptor  ocispec.Descriptor
+	filterBytes []byte
+	config      *config.Runtime
+	format      model.Format
+}
+
+func (i *testImage) Format() model.Format {
+	return i.format
+}
+
+func (i *testImage) Ref() string {
+	return i.ref
+}
+
+func (i *testImage) Descriptor() (ocispec.Descriptor, error) {
+	return i.descriptor, nil
+}
+
+func (i *testImage) FetchFilter(ctx context.Context) (model.Filter, error) {
+	return bytes.NewReader(i.filterBytes), nil
+}
+
+func (i *testImage) FetchConfig(ctx context.Context) (*config.Runtime, error) {
+	return i.config, nil
+}
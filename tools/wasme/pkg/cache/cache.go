@@ -19,6 +19,7 @@ import (
 	"github.com/opencontainers/go-digest"
 	"github.com/solo-io/wasm/tools/wasme/pkg/model"
 	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
+	"github.com/solo-io/wasm/tools/wasme/pkg/util"
 )
 
 // Cache stores digests and image contents in memory
@@ -52,6 +53,10 @@ func NewCacheWithConext(ctx context.Context, puller pull.ImagePuller) Cache {
 }
 
 func (c *CacheImpl) Add(ctx context.Context, ref string) (digest.Digest, error) {
+	ref, err := util.NormalizeImageRef(ref)
+	if err != nil {
+		return "", err
+	}
 	if img := c.cacheState.findImage(ref); img != nil {
 		c.logger.Debugf("found cached image ref %v", ref)
 		desc, err := img.Descriptor()
@@ -112,7 +117,12 @@ func (c *CacheImpl) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 func (c *CacheImpl) ServeHTTPSha(rw http.ResponseWriter, r *http.Request, sha string) {
 	// parse the url
 	ctx := r.Context()
-	image := c.cacheState.find(digest.Digest("sha256:" + sha))
+	imageDigest, err := util.NormalizeDigest(sha)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	image := c.cacheState.find(imageDigest)
 	if image == nil {
 		c.logger.Errorf("image with sha %v not found", sha)
 		http.NotFound(rw, r)
@@ -0,0 +1,43 @@
+//go:build go1.18
+// +build go1.18
+
+package cache_test
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/solo-io/wasm/tools/wasme/pkg/cache"
+	"github.com/solo-io/wasm/tools/wasme/pkg/util"
+)
+
+// Digest2filename must only derive names from validated digests,
+// so the name always matches the file written by the cache
+func FuzzDigest2filename(f *testing.F) {
+	f.Add("sha256:e454cab754cf9234e8b41d7c5e30f53a4c125d7d9443cb3ef2b2eb1c4bd1ec14")
+	f.Add("sha256:E454CAB754CF9234E8B41D7C5E30F53A4C125D7D9443CB3EF2B2EB1C4BD1EC14")
+	f.Add("sha256:e454cab754cf")
+	f.Add("sha256:../../etc/passwd")
+	f.Add("sha384:" + strings.Repeat("0", 96))
+	f.Fuzz(func(t *testing.T, value string) {
+		filename, err := cache.Digest2filename(digest.Digest(value))
+		normalized, normalizeErr := util.NormalizeDigest(value)
+		if (err == nil) != (normalizeErr == nil) {
+			t.Fatalf("Digest2filename(%q) returned %v, but the digest normalizes with error %v", value, err, normalizeErr)
+		}
+		if err != nil {
+			return
+		}
+		if filename != normalized.Encoded() {
+			t.Fatalf("Digest2filename(%q) = %q, expected %q", value, filename, normalized.Encoded())
+		}
+		if _, err := hex.DecodeString(filename); err != nil || strings.ToLower(filename) != filename {
+			t.Fatalf("Digest2filename(%q) = %q which is not lowercase hex", value, filename)
+		}
+		if len(filename) != hex.EncodedLen(normalized.Algorithm().Size()) {
+			t.Fatalf("Digest2filename(%q) = %q which is not a full length %v digest", value, filename, normalized.Algorithm())
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// removes the files of images which are no longer listed in the ref file,
+// once they have been unreferenced for the grace period.
+// files are only considered referenced while they are listed, so the grace period
+// restarts when the cache restarts.
+func (f *localImagePuller) CollectGarbage(ctx context.Context, interval, grace time.Duration) error {
+	if f.directory == "" || interval <= 0 {
+		return nil
+	}
+	logrus.Infof("collecting unused files from %v every %v, with grace period %v", f.directory, interval, grace)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+			if err := f.collectGarbage(time.Now(), grace); err != nil {
+				logrus.Errorf("collecting unused files failed: %v", err)
+			}
+		}
+	}
+}
+
+func (f *localImagePuller) collectGarbage(now time.Time, grace time.Duration) error {
+	referenced, err := f.referencedFiles()
+	if err != nil {
+		return err
+	}
+	if referenced == nil {
+		// a listed image has not been pulled yet, so its file cannot be told apart from unused files
+		return nil
+	}
+
+	files, err := ioutil.ReadDir(f.directory)
+	if err != nil {
+		return err
+	}
+
+	if f.unreferencedSince == nil {
+		f.unreferencedSince = map[string]time.Time{}
+	}
+	unreferenced := map[string]time.Time{}
+	for _, file := range files {
+		name := file.Name()
+		if !file.Mode().IsRegular() || !isDigestFilename(name) || referenced[name] {
+			continue
+		}
+		since, ok := f.unreferencedSince[name]
+		if !ok {
+			since = now
+		}
+		if now.Sub(since) < grace {
+			unreferenced[name] = since
+			continue
+		}
+
+		logrus.Infof("removing unused file %v, unreferenced since %v", name, since)
+		if err := os.Remove(filepath.Join(f.directory, name)); err != nil {
+			logrus.Errorf("removing unused file %v failed: %v", name, err)
+			unreferenced[name] = since
+			continue
+		}
+		if f.cacheNotifier != nil {
+			if err := f.cacheNotifier.NotifyRemoved(Removal{Filename: name}); err != nil {
+				logrus.Errorf("sending event for removed file %v failed: %v", name, err)
+			}
+		}
+	}
+	// forget files which were removed or are referenced again
+	f.unreferencedSince = unreferenced
+
+	return nil
+}
+
+// returns the names of the files of the images listed in the ref file,
+// or nil if a listed image has not been pulled yet
+func (f *localImagePuller) referencedFiles() (map[string]bool, error) {
+	refs, err := fileToRefs(f.refFile)
+	if err != nil {
+		return nil, err
+	}
+	referenced := map[string]bool{}
+	for _, ref := range refs {
+		if ref == "" {
+			continue
+		}
+		imageDigest, ok := f.getDigest(ref)
+		if !ok {
+			logrus.Debugf("skipping garbage collection, image %v has not been pulled", ref)
+			return nil, nil
+		}
+		name, err := Digest2filename(imageDigest)
+		if err != nil {
+			return nil, err
+		}
+		referenced[name] = true
+	}
+	return referenced, nil
+}
+
+// returns true if the file could have been written by the cache, so other files in the directory are never removed
+func isDigestFilename(name string) bool {
+	if strings.ToLower(name) != name {
+		return false
+	}
+	if _, err := hex.DecodeString(name); err != nil {
+		return false
+	}
+	for _, algorithm := range []digest.Algorithm{digest.SHA256, digest.SHA384, digest.SHA512} {
+		if len(name) == hex.EncodedLen(algorithm.Size()) {
+			return true
+		}
+	}
+	return false
+}
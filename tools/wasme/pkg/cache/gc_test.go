@@ -0,0 +1,281 @@
+package cache_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"github.com/solo-io/wasm/tools/wasme/pkg/cache"
+	"github.com/solo-io/wasm/tools/wasme/pkg/model"
+)
+
+// a cache of images with fixed contents, by ref
+type fakeCache struct {
+	contents map[string]string
+}
+
+func (c *fakeCache) Add(_ context.Context, image string) (digest.Digest, error) {
+	content, ok := c.contents[image]
+	if !ok {
+		return "", errors.Errorf("image %v not found", image)
+	}
+	return digest.FromString(content), nil
+}
+
+func (c *fakeCache) Get(_ context.Context, imageDigest digest.Digest) (model.Filter, error) {
+	for _, content := range c.contents {
+		if digest.FromString(content) == imageDigest {
+			return bytes.NewReader([]byte(content)), nil
+		}
+	}
+	return nil, errors.Errorf("image with digest %v not found", imageDigest)
+}
+
+func (c *fakeCache) ServeHTTP(http.ResponseWriter, *http.Request) {}
+
+// records the errors notified for each image and the removed files
+type recordingNotifier struct {
+	lock    sync.Mutex
+	errors  map[string]string
+	removed []string
+	// the number of failed attempts and times each image was added, and whether the last failure was retried
+	failures map[string]int
+	added    map[string]int
+	retrying map[string]bool
+	// the bytes written to the directory for each image
+	written map[string]int64
+	// the removals reported for refs which are no longer listed
+	unlisted []cache.Removal
+}
+
+func (n *recordingNotifier) Notify(result cache.PullResult) error {
+	err, image := result.Err, result.Image
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.errors == nil {
+		n.errors = map[string]string{}
+		n.failures = map[string]int{}
+		n.added = map[string]int{}
+		n.retrying = map[string]bool{}
+		n.written = map[string]int64{}
+	}
+	n.written[image] += result.BytesWritten
+	if err != nil {
+		n.errors[image] = err.Error()
+		n.failures[image]++
+		n.retrying[image] = cache.IsRetrying(err)
+	} else {
+		n.added[image]++
+	}
+	return err
+}
+
+func (n *recordingNotifier) NotifyRemoved(removal cache.Removal) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if removal.Filename != "" {
+		n.removed = append(n.removed, removal.Filename)
+	}
+	if removal.Image != "" {
+		n.unlisted = append(n.unlisted, removal)
+	}
+	return nil
+}
+
+func (n *recordingNotifier) getErrors() map[string]string {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	errs := map[string]string{}
+	for image, message := range n.errors {
+		errs[image] = message
+	}
+	return errs
+}
+
+func (n *recordingNotifier) getFailures(image string) int {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.failures[image]
+}
+
+func (n *recordingNotifier) getAdded(image string) int {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.added[image]
+}
+
+func (n *recordingNotifier) getWritten(image string) int64 {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.written[image]
+}
+
+func (n *recordingNotifier) isRetrying(image string) bool {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.retrying[image]
+}
+
+func (n *recordingNotifier) getUnlisted() []cache.Removal {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return append([]cache.Removal{}, n.unlisted...)
+}
+
+func (n *recordingNotifier) getRemoved() []string {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return append([]string{}, n.removed...)
+}
+
+var _ = Describe("CollectGarbage", func() {
+	var (
+		directory string
+		refFile   string
+		notifier  *recordingNotifier
+		ctx       context.Context
+		cancel    context.CancelFunc
+
+		listedDigest = digest.FromString("listed")
+		staleDigest  = digest.FromString("stale")
+	)
+
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(directory, name))
+		return err == nil
+	}
+
+	BeforeEach(func() {
+		var err error
+		directory, err = ioutil.TempDir("", "wasme-cache")
+		Expect(err).NotTo(HaveOccurred())
+		refFile = filepath.Join(directory, "..", filepath.Base(directory)+"-images.txt")
+		notifier = &recordingNotifier{}
+		ctx, cancel = context.WithCancel(context.Background())
+
+		// left by an image which is no longer listed, and a file not written by the cache
+		for _, name := range []string{staleDigest.Encoded(), "notes.txt"} {
+			Expect(ioutil.WriteFile(filepath.Join(directory, name), []byte("old"), 0644)).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		cancel()
+		os.RemoveAll(directory)
+		os.Remove(refFile)
+	})
+
+	run := func(refs string) {
+		Expect(ioutil.WriteFile(refFile, []byte(refs), 0644)).To(Succeed())
+		puller := cache.NewLocalImagePuller(
+			&fakeCache{contents: map[string]string{"filter/listed:v1": "listed"}},
+			refFile,
+			directory,
+			notifier,
+		)
+		go puller.WatchFile(ctx, cache.WatchOptions{Backoff: cache.DefaultBackoff})
+		go puller.CollectGarbage(ctx, 50*time.Millisecond, 200*time.Millisecond)
+	}
+
+	It("removes the files of images which are no longer listed after the grace period", func() {
+		run("filter/listed:v1\n")
+
+		Eventually(func() bool { return exists(listedDigest.Encoded()) }, 5*time.Second).Should(BeTrue())
+		Eventually(notifier.getRemoved, 5*time.Second).Should(ConsistOf(staleDigest.Encoded()))
+		Expect(exists(staleDigest.Encoded())).To(BeFalse())
+		Expect(exists(listedDigest.Encoded())).To(BeTrue())
+		Expect(exists("notes.txt")).To(BeTrue())
+	})
+
+	It("does not remove any file while a listed image has not been pulled", func() {
+		run("filter/listed:v1\nfilter/missing:v1\n")
+
+		Eventually(notifier.getErrors, 5*time.Second).Should(HaveKey("filter/missing:v1"))
+		Consistently(func() bool { return exists(staleDigest.Encoded()) }, 500*time.Millisecond).Should(BeTrue())
+		Expect(notifier.getRemoved()).To(BeEmpty())
+	})
+})
+
+var _ = Describe("removing unlisted refs", func() {
+	var (
+		directory string
+		refFile   string
+		notifier  *recordingNotifier
+		ctx       context.Context
+		cancel    context.CancelFunc
+
+		sharedDigest = digest.FromString("shared")
+		uniqueDigest = digest.FromString("unique")
+	)
+
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(directory, name))
+		return err == nil
+	}
+
+	BeforeEach(func() {
+		var err error
+		directory, err = ioutil.TempDir("", "wasme-cache")
+		Expect(err).NotTo(HaveOccurred())
+		refFile = filepath.Join(directory, "..", filepath.Base(directory)+"-images.txt")
+		notifier = &recordingNotifier{}
+		ctx, cancel = context.WithCancel(context.Background())
+
+		Expect(ioutil.WriteFile(refFile, []byte("filter/shared:v1\nfilter/shared:latest\nfilter/unique:v1\n"), 0644)).To(Succeed())
+		puller := cache.NewLocalImagePuller(
+			&fakeCache{contents: map[string]string{
+				"filter/shared:v1":     "shared",
+				"filter/shared:latest": "shared",
+				"filter/unique:v1":     "unique",
+			}},
+			refFile,
+			directory,
+			notifier,
+		)
+		go puller.WatchFile(ctx, cache.WatchOptions{Backoff: cache.DefaultBackoff, RemoveUnlisted: true})
+		Eventually(func() bool {
+			return exists(sharedDigest.Encoded()) && exists(uniqueDigest.Encoded())
+		}, 5*time.Second).Should(BeTrue())
+	})
+
+	AfterEach(func() {
+		cancel()
+		os.RemoveAll(directory)
+		os.Remove(refFile)
+	})
+
+	It("removes the file of a ref once it is no longer listed", func() {
+		Expect(ioutil.WriteFile(refFile, []byte("filter/shared:v1\nfilter/shared:latest\n"), 0644)).To(Succeed())
+
+		Eventually(notifier.getUnlisted, 5*time.Second).Should(ConsistOf(cache.Removal{
+			Image:    "filter/unique:v1",
+			Digest:   uniqueDigest,
+			Filename: uniqueDigest.Encoded(),
+		}))
+		Expect(exists(uniqueDigest.Encoded())).To(BeFalse())
+		Expect(exists(sharedDigest.Encoded())).To(BeTrue())
+	})
+
+	It("keeps the file of an unlisted ref while another listed ref has the same digest", func() {
+		Expect(ioutil.WriteFile(refFile, []byte("filter/shared:v1\nfilter/unique:v1\n"), 0644)).To(Succeed())
+		Eventually(notifier.getUnlisted, 5*time.Second).Should(ConsistOf(cache.Removal{
+			Image:  "filter/shared:latest",
+			Digest: sharedDigest,
+		}))
+		Expect(exists(sharedDigest.Encoded())).To(BeTrue())
+
+		// every ref is unlisted
+		Expect(ioutil.WriteFile(refFile, nil, 0644)).To(Succeed())
+		Eventually(notifier.getRemoved, 5*time.Second).Should(ConsistOf(sharedDigest.Encoded(), uniqueDigest.Encoded()))
+		Expect(notifier.getUnlisted()).To(HaveLen(3))
+	})
+})
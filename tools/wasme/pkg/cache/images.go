@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ImageList is the list of images pulled by the cache, by image ref,
+// as stored in the cache ConfigMap and read by the cache from the ref file
+type ImageList map[string]ListedImage
+
+// ListedImage is the metadata recorded for an image of the ImageList
+type ListedImage struct {
+	// the digest the ref resolved to when the image was added
+	Digest string `json:"digest,omitempty"`
+	// who added the image, e.g. the namespace and id of the filter deployed from it
+	AddedBy string     `json:"addedBy,omitempty"`
+	AddedAt *time.Time `json:"addedAt,omitempty"`
+	// the ref the image was pinned from, if the image is listed by the digest a tag resolved to
+	PinnedFrom string `json:"pinnedFrom,omitempty"`
+}
+
+// ParseImageList parses an ImageList written by Marshal.
+// the legacy format, a ref per line, is accepted too; the images it lists have no metadata.
+// blank lines and empty refs are ignored
+func ParseImageList(data string) (ImageList, error) {
+	images := ImageList{}
+	data = strings.TrimSpace(data)
+	if strings.HasPrefix(data, "{") {
+		if err := json.Unmarshal([]byte(data), &images); err != nil {
+			return nil, errors.Wrap(err, "parsing image list")
+		}
+		delete(images, "")
+		return images, nil
+	}
+	for _, line := range strings.Split(data, "\n") {
+		if ref := strings.TrimSpace(line); ref != "" {
+			images[ref] = ListedImage{}
+		}
+	}
+	return images, nil
+}
+
+// Refs returns the listed refs, sorted
+func (l ImageList) Refs() []string {
+	var refs []string
+	for ref := range l {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+// RefWithDigest returns the first listed ref, in sorted order, which resolved to the digest when it was added
+func (l ImageList) RefWithDigest(imageDigest string) (string, bool) {
+	for _, ref := range l.Refs() {
+		if imageDigest != "" && l[ref].Digest == imageDigest {
+			return ref, true
+		}
+	}
+	return "", false
+}
+
+// Marshal returns the document stored in the cache ConfigMap.
+// an empty list is stored as an empty string
+func (l ImageList) Marshal() (string, error) {
+	if len(l) == 0 {
+		return "", nil
+	}
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
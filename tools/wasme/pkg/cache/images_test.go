@@ -0,0 +1,54 @@
+package cache_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/wasm/tools/wasme/pkg/cache"
+)
+
+var _ = Describe("ImageList", func() {
+	It("parses the legacy format, ignoring blank lines", func() {
+		images, err := cache.ParseImageList("\n\ndocker.io/filter/b:v1\n  \ndocker.io/filter/a:v1\n")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(images.Refs()).To(Equal([]string{"docker.io/filter/a:v1", "docker.io/filter/b:v1"}))
+		Expect(images["docker.io/filter/a:v1"]).To(Equal(cache.ListedImage{}))
+
+		images, err = cache.ParseImageList("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(images).To(BeEmpty())
+	})
+
+	It("round trips the images with their metadata", func() {
+		addedAt := time.Date(2020, time.August, 1, 12, 0, 0, 0, time.UTC)
+		images := cache.ImageList{
+			"docker.io/filter/a:v1": {Digest: "sha256:e454cab754cf9234e8b41d7c5e30f53a4c125d7d9443cb3ef2b2eb1c4bd1ec14", AddedBy: "default/filter-a", AddedAt: &addedAt},
+			"docker.io/filter/b:v1": {},
+		}
+		data, err := images.Marshal()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(HavePrefix("{"))
+
+		parsed, err := cache.ParseImageList(data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed).To(Equal(images))
+
+		ref, ok := parsed.RefWithDigest("sha256:e454cab754cf9234e8b41d7c5e30f53a4c125d7d9443cb3ef2b2eb1c4bd1ec14")
+		Expect(ok).To(BeTrue())
+		Expect(ref).To(Equal("docker.io/filter/a:v1"))
+		_, ok = parsed.RefWithDigest("")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("stores an empty list as an empty string", func() {
+		data, err := cache.ImageList{}.Marshal()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(BeEmpty())
+	})
+
+	It("rejects malformed documents", func() {
+		_, err := cache.ParseImageList(`{"docker.io/filter/a:v1": `)
+		Expect(err).To(MatchError(ContainSubstring("parsing image list")))
+	})
+})
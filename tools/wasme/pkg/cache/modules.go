@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"github.com/solo-io/wasm/tools/wasme/pkg/util"
+)
+
+// the path the files written to the cache directory are served at, followed by the digest of the image
+const ModulesPath = "/modules/"
+
+// ServeHTTP serves the file of the image with the digest in the path, e.g. /modules/sha256:<hex>.
+// responds 503 while the file may still be written, so the client retries, and 404 if it is unknown.
+// files are renamed into place once complete, so a file is never served partially written
+func (f *localImagePuller) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	imageDigest, err := util.NormalizeDigest(strings.TrimPrefix(r.URL.Path, ModulesPath))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	name, err := Digest2filename(imageDigest)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if f.directory == "" {
+		http.NotFound(rw, r)
+		return
+	}
+
+	// check for pulls before opening the file, so a file completed in between is not reported missing
+	inProgress := f.pullInProgress(imageDigest)
+	file, err := os.Open(filepath.Join(f.directory, name))
+	switch {
+	case os.IsNotExist(err) && inProgress:
+		rw.Header().Set("Retry-After", "1")
+		http.Error(rw, "image "+imageDigest.String()+" is being pulled", http.StatusServiceUnavailable)
+		return
+	case os.IsNotExist(err):
+		http.NotFound(rw, r)
+		return
+	case err != nil:
+		logrus.Errorf("opening cached file %v failed: %v", name, err)
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// the file stays readable if it is garbage collected while being served
+	defer file.Close()
+
+	rw.Header().Set("Content-Type", "application/wasm")
+	rw.Header().Set("Etag", "\""+imageDigest.String()+"\"")
+	// content of digests never changes so set mod time to a constant
+	modTime := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	http.ServeContent(rw, r, name, modTime, file)
+}
+
+// returns true if the file of the image may still be written:
+// it is being written, or an image whose digest is not known yet is being pulled
+func (f *localImagePuller) pullInProgress(imageDigest digest.Digest) bool {
+	f.progressLock.Lock()
+	defer f.progressLock.Unlock()
+	return f.writing[imageDigest] != nil || f.pendingPulls > 0
+}
+
+// returns true if the file of the image is being written
+func (f *localImagePuller) writingFile(imageDigest digest.Digest) bool {
+	f.progressLock.Lock()
+	defer f.progressLock.Unlock()
+	return f.writing[imageDigest] != nil
+}
+
+func (f *localImagePuller) startPull() {
+	f.progressLock.Lock()
+	defer f.progressLock.Unlock()
+	f.pendingPulls++
+}
+
+func (f *localImagePuller) finishPull() {
+	f.progressLock.Lock()
+	defer f.progressLock.Unlock()
+	f.pendingPulls--
+}
+
+// a write of the file of an image to the directory
+type fileWrite struct {
+	// closed once the write completed, with the error of the write
+	done chan struct{}
+	err  error
+}
+
+// returns the write of the file of the image in progress, or starts a new one.
+// returns true if the write was started and must be finished by the caller
+func (f *localImagePuller) startWriting(imageDigest digest.Digest) (*fileWrite, bool) {
+	f.progressLock.Lock()
+	defer f.progressLock.Unlock()
+	if write, ok := f.writing[imageDigest]; ok {
+		return write, false
+	}
+	if f.writing == nil {
+		f.writing = map[digest.Digest]*fileWrite{}
+	}
+	write := &fileWrite{done: make(chan struct{})}
+	f.writing[imageDigest] = write
+	return write, true
+}
+
+func (f *localImagePuller) finishWriting(imageDigest digest.Digest, write *fileWrite, err error) {
+	f.progressLock.Lock()
+	defer f.progressLock.Unlock()
+	delete(f.writing, imageDigest)
+	write.err = err
+	close(write.done)
+}
@@ -0,0 +1,132 @@
+package cache_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	"github.com/solo-io/wasm/tools/wasme/pkg/cache"
+	"github.com/solo-io/wasm/tools/wasme/pkg/model"
+	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
+)
+
+// a reader which blocks until released
+type gatedReader struct {
+	release <-chan struct{}
+	reader  io.Reader
+}
+
+func (r *gatedReader) Read(p []byte) (int, error) {
+	<-r.release
+	return r.reader.Read(p)
+}
+
+// an image whose filter content is only transferred once released
+type gatedImage struct {
+	*fakeImage
+	release chan struct{}
+}
+
+func (i *gatedImage) FetchFilter(ctx context.Context) (model.Filter, error) {
+	filter, err := i.fakeImage.FetchFilter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &gatedReader{release: i.release, reader: filter}, nil
+}
+
+type gatedPuller struct {
+	image *gatedImage
+}
+
+func (p *gatedPuller) Pull(context.Context, string) (pull.Image, error) {
+	return p.image, nil
+}
+
+var _ = Describe("Serving modules", func() {
+	const ref = "webassemblyhub.io/filter/image:v1"
+	var (
+		directory string
+		refFile   string
+		ctx       context.Context
+		cancel    context.CancelFunc
+		server    *httptest.Server
+		image     *gatedImage
+
+		content       = []byte("filter content")
+		contentDigest = digest.FromBytes(content)
+	)
+
+	BeforeEach(func() {
+		var err error
+		directory, err = ioutil.TempDir("", "wasme-cache")
+		Expect(err).NotTo(HaveOccurred())
+		refFile = filepath.Join(directory, "..", filepath.Base(directory)+"-images.txt")
+		Expect(ioutil.WriteFile(refFile, []byte(ref+"\n"), 0644)).To(Succeed())
+		ctx, cancel = context.WithCancel(context.Background())
+
+		image = &gatedImage{
+			fakeImage: &fakeImage{ref: ref, digest: contentDigest, contents: [][]byte{content}},
+			release:   make(chan struct{}),
+		}
+		puller := cache.NewLocalImagePuller(cache.NewCache(&gatedPuller{image: image}), refFile, directory, nil)
+		server = httptest.NewServer(puller)
+		go puller.WatchFile(ctx, cache.WatchOptions{Backoff: cache.DefaultBackoff})
+	})
+
+	AfterEach(func() {
+		cancel()
+		server.Close()
+		os.RemoveAll(directory)
+		os.Remove(refFile)
+	})
+
+	get := func(imageDigest digest.Digest) *http.Response {
+		res, err := http.Get(server.URL + cache.ModulesPath + imageDigest.String())
+		Expect(err).NotTo(HaveOccurred())
+		return res
+	}
+	status := func(imageDigest digest.Digest) func() int {
+		return func() int {
+			res := get(imageDigest)
+			res.Body.Close()
+			return res.StatusCode
+		}
+	}
+
+	It("responds unavailable while the image is pulled, and serves it once written", func() {
+		Eventually(status(contentDigest), 10*time.Second).Should(Equal(http.StatusServiceUnavailable))
+		Consistently(status(contentDigest), time.Second).Should(Equal(http.StatusServiceUnavailable))
+
+		close(image.release)
+		Eventually(status(contentDigest), 10*time.Second).Should(Equal(http.StatusOK))
+
+		res := get(contentDigest)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(body).To(Equal(content))
+		Expect(res.ContentLength).To(Equal(int64(len(content))))
+		Expect(res.Header.Get("Etag")).To(Equal(`"` + contentDigest.String() + `"`))
+	})
+
+	It("responds not found for unknown digests", func() {
+		close(image.release)
+		Eventually(status(contentDigest), 10*time.Second).Should(Equal(http.StatusOK))
+
+		Expect(status(digest.FromString("unknown"))()).To(Equal(http.StatusNotFound))
+
+		res, err := http.Get(server.URL + cache.ModulesPath + "not-a-digest")
+		Expect(err).NotTo(HaveOccurred())
+		res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+})
@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"time"
+)
+
+// Backoff configures how failed pulls of the images listed in the ref file are retried
+type Backoff struct {
+	// the delay before the first retry, doubled after each failed attempt
+	Initial time.Duration
+	// the longest delay between two attempts
+	Max time.Duration
+	// retries stop once the next attempt would be made this long after the first failed attempt,
+	// until the next resync. 0 retries forever
+	MaxElapsed time.Duration
+}
+
+var DefaultBackoff = Backoff{
+	Initial:    2 * time.Second,
+	Max:        2 * time.Minute,
+	MaxElapsed: 10 * time.Minute,
+}
+
+// RetryError is reported for a failed pull which will be retried
+type RetryError struct {
+	Err error
+	// the delay before the next attempt
+	RetryIn time.Duration
+}
+
+// the message is the message of the failure, so the failures of a pull can be grouped across attempts
+func (e *RetryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryError) Cause() error {
+	return e.Err
+}
+
+// IsRetrying returns true if the error was reported for a failed pull which will be retried
+func IsRetrying(err error) bool {
+	_, ok := err.(*RetryError)
+	return ok
+}
+
+// the state of pulling a ref listed in the ref file
+type pullState struct {
+	// the ref was written to the directory by the last attempt
+	pulled bool
+	// the time of the first of the consecutive failed attempts
+	failingSince time.Time
+	// the delay after the last failed attempt
+	backoff     time.Duration
+	nextAttempt time.Time
+	// retries stopped after the max elapsed time
+	gaveUp bool
+}
+
+// returns true if the ref should be pulled now.
+// on resync, every ref is pulled again, so deleted files are written again and retries resume
+func (s *pullState) due(now time.Time, resync bool) bool {
+	switch {
+	case resync:
+		return true
+	case s.pulled, s.gaveUp:
+		return false
+	default:
+		return !now.Before(s.nextAttempt)
+	}
+}
+
+// records a failed attempt and schedules the next one.
+// returns the error to report, a *RetryError unless retries stopped
+func (s *pullState) failed(err error, now time.Time, backoff Backoff) error {
+	if s.failingSince.IsZero() || s.pulled || s.gaveUp {
+		*s = pullState{failingSince: now, backoff: backoff.Initial}
+	} else {
+		s.backoff *= 2
+		if backoff.Max > 0 && s.backoff > backoff.Max {
+			s.backoff = backoff.Max
+		}
+	}
+	s.nextAttempt = now.Add(s.backoff)
+	if backoff.MaxElapsed > 0 && s.nextAttempt.Sub(s.failingSince) > backoff.MaxElapsed {
+		s.gaveUp = true
+		return err
+	}
+	return &RetryError{Err: err, RetryIn: s.backoff}
+}
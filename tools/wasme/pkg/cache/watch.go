@@ -1,28 +1,64 @@
 package cache
 
 import (
-	"bufio"
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
-	"strings"
+	"sync"
 	"time"
 
+	"github.com/avast/retry-go"
 	"github.com/sirupsen/logrus"
+	"github.com/solo-io/wasm/tools/wasme/pkg/util"
 
 	"github.com/opencontainers/go-digest"
 )
 
+// PullResult is the outcome of an attempt to pull an image listed in the ref file to the directory
+type PullResult struct {
+	Image string
+	// empty if the image could not be resolved
+	Digest digest.Digest
+	// the time taken to pull the image and write it to the directory
+	Duration time.Duration
+	// the size of the file written to the directory, 0 if the file was already written
+	BytesWritten int64
+	// the error of the attempt, a *RetryError if the pull will be retried
+	Err error
+}
+
+// Removal is reported when a file is removed from the directory, or a ref is no longer listed in the ref file
+type Removal struct {
+	// the ref which is no longer listed, empty if an unused file was removed by garbage collection
+	Image string
+	// the digest the unlisted ref was pulled with, empty if it was not pulled
+	Digest digest.Digest
+	// the name of the removed file, empty if no file was removed,
+	// e.g. as another listed ref has the same digest
+	Filename string
+}
+
 type EventNotifier interface {
-	Notify(err error, image string) error
+	// returns the error of the result, with the error of publishing the result if any
+	Notify(result PullResult) error
+	// called when a file is removed from the cache directory, or a ref is no longer listed
+	NotifyRemoved(removal Removal) error
 }
 
 // pulls images for a local cache
 type LocalImagePuller interface {
 	// watches ref file (images.txt) pulls each image to disk
-	WatchFile(ctx context.Context) error
+	WatchFile(ctx context.Context, opts WatchOptions) error
+
+	// periodically removes the files of images which are no longer listed in the ref file
+	CollectGarbage(ctx context.Context, interval, grace time.Duration) error
+
+	// serves the files written to the directory by digest, at ModulesPath
+	http.Handler
 }
 
 type localImagePuller struct {
@@ -30,124 +66,352 @@ type localImagePuller struct {
 	refFile       string
 	directory     string
 	cacheNotifier EventNotifier
+
+	// the digest of each ref pulled to the directory
+	digests     map[string]digest.Digest
+	digestsLock sync.RWMutex
+
+	// the time each unreferenced file was first seen, by filename
+	unreferencedSince map[string]time.Time
+
+	// the files being written by digest, and the number of refs being pulled
+	// whose digest is not known yet
+	writing      map[digest.Digest]*fileWrite
+	pendingPulls int
+	progressLock sync.Mutex
 }
 
 func NewLocalImagePuller(imageCache Cache, refFile string, directory string, cacheNotifier EventNotifier) *localImagePuller {
 	return &localImagePuller{imageCache: imageCache, refFile: refFile, directory: directory, cacheNotifier: cacheNotifier}
 }
 
-func (f *localImagePuller) WatchFile(ctx context.Context) error {
+// WatchOptions configures how the images listed in the ref file are pulled
+type WatchOptions struct {
+	// interval at which every listed image is pulled again, e.g. to write files removed from the directory.
+	// 0 disables resyncs
+	ResyncInterval time.Duration
+	// how failed pulls are retried
+	Backoff Backoff
+	// the maximum number of images pulled at once. defaults to 1
+	Concurrency int
+	// remove the file of a ref as soon as the ref is no longer listed, unless a listed ref has the same digest.
+	// otherwise, and for the files of refs unlisted while the cache was not running, files are removed by CollectGarbage
+	RemoveUnlisted bool
+}
+
+func (f *localImagePuller) WatchFile(ctx context.Context, opts WatchOptions) error {
 	logrus.Infof("starting writing images to %v, reading from %v", f.directory, f.refFile)
-	for ref := range f.watchFileAndGetRefs(ctx, f.refFile) {
-		logrus.Infof("pulling ref %v", ref)
-		digest, err := f.imageCache.Add(ctx, ref)
-		if err == nil {
-			err = f.addToDirectory(ctx, digest)
-		}
-		if f.cacheNotifier != nil {
-			err = f.cacheNotifier.Notify(err, ref)
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	workers := make(chan struct{}, concurrency)
+	// the refs being pulled or waiting for a worker, which are not pulled again until done
+	var (
+		inFlight     = map[string]bool{}
+		inFlightLock sync.Mutex
+		pulls        sync.WaitGroup
+	)
+	defer pulls.Wait()
+
+	// the state of each listed ref. refs which are no longer listed are forgotten,
+	// so they are pulled and reported again if they are listed again.
+	// a state is only accessed by the pull of its ref while the pull is in flight
+	states := map[string]*pullState{}
+	lastResync := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Second * 2):
 		}
+		// read refs from file
+		refs, err := fileToRefs(f.refFile)
 		if err != nil {
-			logrus.Errorf("caching image failed: %v", err)
+			// TODO: log? panic?
+			fmt.Fprintln(os.Stderr, "failed parsing refs file: "+err.Error())
+			continue
 		}
-	}
-	return nil
-}
-
-func (f *localImagePuller) watchFileAndGetRefs(ctx context.Context, refFile string) <-chan string {
-	res := make(chan string)
-	go func() {
-		defer close(res)
-		for {
-			var refs []string
-
-			select {
-			case <-ctx.Done():
-				return
-			case <-time.After(time.Second * 2):
-				var err error
-				// read refs from file
-				refs, err = fileToRefs(refFile)
-				if err != nil {
-					// TODO: log? panic?
-					fmt.Fprintln(os.Stderr, "failed parsing refs file: "+err.Error())
-				}
-				logrus.Infof("detected refs %v", refs)
+		logrus.Infof("detected refs %v", refs)
+
+		now := time.Now()
+		resync := opts.ResyncInterval > 0 && now.Sub(lastResync) >= opts.ResyncInterval
+		if resync {
+			logrus.Infof("resyncing %v refs with the cache directory", len(refs))
+			lastResync = now
+		}
+
+		listed := map[string]bool{}
+		for _, ref := range refs {
+			listed[ref] = true
+			state, ok := states[ref]
+			if !ok {
+				state = &pullState{}
+				states[ref] = state
 			}
 
-			for _, ref := range refs {
+			inFlightLock.Lock()
+			pull := !inFlight[ref] && state.due(now, resync)
+			if pull {
+				inFlight[ref] = true
+			}
+			inFlightLock.Unlock()
+			if !pull {
+				continue
+			}
+
+			pulls.Add(1)
+			go func(ref string, state *pullState) {
+				defer pulls.Done()
+				defer func() {
+					inFlightLock.Lock()
+					defer inFlightLock.Unlock()
+					delete(inFlight, ref)
+				}()
 				select {
 				case <-ctx.Done():
 					return
-				case res <- ref:
+				case workers <- struct{}{}:
 				}
+				defer func() { <-workers }()
+				f.pullRef(ctx, ref, state, opts.Backoff)
+			}(ref, state)
+		}
+		for ref := range states {
+			if listed[ref] {
+				continue
+			}
+			inFlightLock.Lock()
+			pulling := inFlight[ref]
+			inFlightLock.Unlock()
+			if pulling {
+				// forgotten once the pull is done, so the file it writes is removed too
+				continue
+			}
+			delete(states, ref)
+			if opts.RemoveUnlisted {
+				f.removeUnlisted(ref, listed)
 			}
 		}
-	}()
-	return res
+	}
+}
+
+// removes the file of a ref which is no longer listed, unless a listed ref has the same digest or the file is being written,
+// and reports the ref as removed. the digest of the ref is forgotten
+func (f *localImagePuller) removeUnlisted(ref string, listed map[string]bool) {
+	imageDigest, pulled := f.getDigest(ref)
+	f.forgetDigest(ref)
+	removal := Removal{Image: ref, Digest: imageDigest}
+	if pulled && f.directory != "" && !f.digestListed(imageDigest, listed) && !f.writingFile(imageDigest) {
+		name, err := Digest2filename(imageDigest)
+		if err != nil {
+			logrus.Errorf("removing file of unlisted ref %v failed: %v", ref, err)
+			return
+		}
+		err = os.Remove(filepath.Join(f.directory, name))
+		switch {
+		case err == nil:
+			logrus.Infof("removed file %v of unlisted ref %v", name, ref)
+			removal.Filename = name
+		case !os.IsNotExist(err):
+			// left to garbage collection
+			logrus.Errorf("removing file %v of unlisted ref %v failed: %v", name, ref, err)
+		}
+	}
+	if f.cacheNotifier != nil {
+		if err := f.cacheNotifier.NotifyRemoved(removal); err != nil {
+			logrus.Errorf("sending event for unlisted ref %v failed: %v", ref, err)
+		}
+	}
+}
+
+// returns true if a listed ref was pulled with the digest
+func (f *localImagePuller) digestListed(imageDigest digest.Digest, listed map[string]bool) bool {
+	f.digestsLock.RLock()
+	defer f.digestsLock.RUnlock()
+	for ref, refDigest := range f.digests {
+		if listed[ref] && refDigest == imageDigest {
+			return true
+		}
+	}
+	return false
 }
 
-func (f *localImagePuller) addToDirectory(ctx context.Context, digest digest.Digest) error {
+// pulls the ref to the directory and reports the outcome of the attempt
+func (f *localImagePuller) pullRef(ctx context.Context, ref string, state *pullState, backoff Backoff) {
+	logrus.Infof("pulling ref %v", ref)
+	result := PullResult{Image: ref}
+	start := time.Now()
+	_, pulled := f.getDigest(ref)
+	if !pulled {
+		f.startPull()
+	}
+	result.Digest, result.Err = f.imageCache.Add(ctx, ref)
+	if result.Err == nil {
+		result.BytesWritten, result.Err = f.addToDirectory(ctx, result.Digest)
+	}
+	if !pulled {
+		f.finishPull()
+	}
+	result.Duration = time.Since(start)
+	if result.Err == nil {
+		f.setDigest(ref, result.Digest)
+		*state = pullState{pulled: true}
+	} else {
+		result.Err = state.failed(result.Err, time.Now(), backoff)
+		if retryErr, ok := result.Err.(*RetryError); ok {
+			logrus.Warnf("retrying pulling ref %v in %v", ref, retryErr.RetryIn)
+		} else {
+			logrus.Warnf("giving up pulling ref %v until the next resync", ref)
+		}
+	}
+	err := result.Err
+	if f.cacheNotifier != nil {
+		err = f.cacheNotifier.Notify(result)
+	}
+	if err != nil {
+		logrus.Errorf("caching image failed: %v", err)
+	}
+}
+
+func (f *localImagePuller) setDigest(ref string, imageDigest digest.Digest) {
+	f.digestsLock.Lock()
+	defer f.digestsLock.Unlock()
+	if f.digests == nil {
+		f.digests = map[string]digest.Digest{}
+	}
+	f.digests[ref] = imageDigest
+}
+
+func (f *localImagePuller) forgetDigest(ref string) {
+	f.digestsLock.Lock()
+	defer f.digestsLock.Unlock()
+	delete(f.digests, ref)
+}
+
+func (f *localImagePuller) getDigest(ref string) (digest.Digest, bool) {
+	f.digestsLock.RLock()
+	defer f.digestsLock.RUnlock()
+	imageDigest, ok := f.digests[ref]
+	return imageDigest, ok
+}
+
+// returns the number of bytes written to the directory by this call
+func (f *localImagePuller) addToDirectory(ctx context.Context, digest digest.Digest) (int64, error) {
 	if f.directory == "" {
-		return nil
+		return 0, nil
 	}
 	// get filename from ref
 	// check if filename exists
-	filename := filepath.Join(f.directory, Digest2filename(digest))
+	name, err := Digest2filename(digest)
+	if err != nil {
+		return 0, err
+	}
+	filename := filepath.Join(f.directory, name)
 
 	logrus.Infof("writing image to %v", filename)
 
-	err := f.copyToFile(ctx, filename, digest)
-	if err != nil {
+	// refs resolving to the same digest share a single write of the file
+	write, started := f.startWriting(digest)
+	if !started {
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-write.done:
+			return 0, write.err
+		}
 	}
-	return err
+	// the content is fetched again on each attempt, in case the transfer was corrupted
+	var written int64
+	err = util.RetryOnFunc(func() error {
+		var err error
+		written, err = f.copyToFile(ctx, filename, digest)
+		return err
+	}, func(err error) bool {
+		_, mismatch := err.(*digestMismatchError)
+		if mismatch {
+			logrus.Warnf("retrying writing image to %v: %v", filename, err)
+		}
+		return mismatch
+	},
+		retry.Attempts(4),
+		retry.Delay(250*time.Millisecond),
+		retry.LastErrorOnly(true),
+	)
+	f.finishWriting(digest, write, err)
+	return written, err
 }
 
-func (f *localImagePuller) copyToFile(ctx context.Context, filename string, digest digest.Digest) error {
+// the content fetched for an image does not match the digest of the image
+type digestMismatchError struct {
+	expected, actual digest.Digest
+}
+
+func (e *digestMismatchError) Error() string {
+	return fmt.Sprintf("downloaded content has digest %v, expected %v", e.actual, e.expected)
+}
+
+// returns the number of bytes written, 0 if the file was already written
+func (f *localImagePuller) copyToFile(ctx context.Context, filename string, digest digest.Digest) (int64, error) {
 
 	if _, err := os.Stat(filename); err == nil {
 		// file already cached, nothing to do
-		return nil
+		return 0, nil
 	}
 
 	filter, err := f.imageCache.Get(ctx, digest)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	if closer, ok := filter.(io.ReadCloser); ok {
 		defer closer.Close()
 	}
 
-	// fail if file exists
-	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	// write to a temporary file and rename it once complete, so the proxies never load a partial copy.
+	// the directory may be shared by the caches on several nodes, which all write the same content
+	file, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
 	if err != nil {
-		return err
+		return 0, err
 	}
-	_, err = io.Copy(file, filter)
+	// verify the content while writing it, so a corrupted file is never left for the proxies to load
+	digester := digest.Algorithm().Digester()
+	written, err := io.Copy(io.MultiWriter(file, digester.Hash()), filter)
 	file.Close()
+	if err == nil && digester.Digest() != digest {
+		err = &digestMismatchError{expected: digest, actual: digester.Digest()}
+	}
+	if err == nil {
+		err = os.Chmod(file.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), filename)
+	}
 	if err != nil {
-		// to avoid partial copies, delete the file if it exists
-		os.Remove(filename)
+		os.Remove(file.Name())
+		return 0, err
 	}
-	return err
+	return written, nil
 }
 
-func Digest2filename(digest digest.Digest) string {
-	return digest.Encoded()
+// Digest2filename returns the name of the file the cache writes the image with the given digest to.
+// the digest is validated and normalized first, so the name always matches the file written by the cache
+func Digest2filename(digest digest.Digest) (string, error) {
+	normalized, err := util.NormalizeDigest(string(digest))
+	if err != nil {
+		return "", err
+	}
+	return normalized.Encoded(), nil
 }
 
+// reads the refs of the ImageList in the ref file, in either format
 func fileToRefs(refFile string) ([]string, error) {
-	var refs []string
-	file, err := os.Open(refFile)
+	data, err := ioutil.ReadFile(refFile)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		ref := strings.TrimSpace(scanner.Text())
-		refs = append(refs, ref)
+	images, err := ParseImageList(string(data))
+	if err != nil {
+		return nil, err
 	}
-	return refs, scanner.Err()
+	return images.Refs(), nil
 }
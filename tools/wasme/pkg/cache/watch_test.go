@@ -0,0 +1,310 @@
+package cache_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/solo-io/wasm/tools/wasme/pkg/cache"
+	"github.com/solo-io/wasm/tools/wasme/pkg/config"
+	"github.com/solo-io/wasm/tools/wasme/pkg/model"
+	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
+)
+
+// an image whose filter is fetched with each of the contents in turn, repeating the last
+type fakeImage struct {
+	ref      string
+	digest   digest.Digest
+	lock     sync.Mutex
+	contents [][]byte
+}
+
+func (i *fakeImage) Ref() string {
+	return i.ref
+}
+
+func (i *fakeImage) Descriptor() (ocispec.Descriptor, error) {
+	return ocispec.Descriptor{MediaType: model.ContentMediaType, Digest: i.digest}, nil
+}
+
+func (i *fakeImage) FetchFilter(context.Context) (model.Filter, error) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	content := i.contents[0]
+	if len(i.contents) > 1 {
+		i.contents = i.contents[1:]
+	}
+	return bytes.NewReader(content), nil
+}
+
+func (i *fakeImage) FetchConfig(context.Context) (*config.Runtime, error) {
+	return nil, nil
+}
+
+type fakePuller struct {
+	image *fakeImage
+}
+
+func (p *fakePuller) Pull(context.Context, string) (pull.Image, error) {
+	return p.image, nil
+}
+
+// a puller which fails until it is allowed to pull, or for the given number of attempts
+type flakyPuller struct {
+	fakePuller
+	lock         sync.Mutex
+	failuresLeft int
+}
+
+func (p *flakyPuller) Pull(ctx context.Context, ref string) (pull.Image, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.failuresLeft != 0 {
+		p.failuresLeft--
+		return nil, errors.New("connection refused")
+	}
+	return p.fakePuller.Pull(ctx, ref)
+}
+
+func (p *flakyPuller) setFailures(failures int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.failuresLeft = failures
+}
+
+// a puller which takes a while to pull each image, recording the most pulls in progress at once
+type slowPuller struct {
+	delay  time.Duration
+	images map[string]*slowImage
+
+	lock       sync.Mutex
+	pulling    int
+	maxPulling int
+	firstPull  time.Time
+}
+
+func (p *slowPuller) Pull(_ context.Context, ref string) (pull.Image, error) {
+	p.lock.Lock()
+	if p.firstPull.IsZero() {
+		p.firstPull = time.Now()
+	}
+	p.pulling++
+	if p.pulling > p.maxPulling {
+		p.maxPulling = p.pulling
+	}
+	p.lock.Unlock()
+
+	time.Sleep(p.delay)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.pulling--
+	return p.images[ref], nil
+}
+
+func (p *slowPuller) getFirstPull() time.Time {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.firstPull
+}
+
+func (p *slowPuller) getMaxPulling() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.maxPulling
+}
+
+// an image whose filter takes a while to fetch, counting the fetches
+type slowImage struct {
+	*fakeImage
+	delay   time.Duration
+	lock    sync.Mutex
+	fetches int
+}
+
+func (i *slowImage) FetchFilter(ctx context.Context) (model.Filter, error) {
+	i.lock.Lock()
+	i.fetches++
+	i.lock.Unlock()
+	time.Sleep(i.delay)
+	return i.fakeImage.FetchFilter(ctx)
+}
+
+func (i *slowImage) getFetches() int {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return i.fetches
+}
+
+var _ = Describe("WatchFile", func() {
+	const ref = "webassemblyhub.io/filter/image:v1"
+	var (
+		directory string
+		refFile   string
+		notifier  *recordingNotifier
+		ctx       context.Context
+		cancel    context.CancelFunc
+
+		content       = []byte("filter content")
+		contentDigest = digest.FromBytes(content)
+		corrupted     = []byte("corrupted content")
+	)
+
+	BeforeEach(func() {
+		var err error
+		directory, err = ioutil.TempDir("", "wasme-cache")
+		Expect(err).NotTo(HaveOccurred())
+		refFile = filepath.Join(directory, "..", filepath.Base(directory)+"-images.txt")
+		Expect(ioutil.WriteFile(refFile, []byte(ref+"\n"), 0644)).To(Succeed())
+		notifier = &recordingNotifier{}
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+		os.RemoveAll(directory)
+		os.Remove(refFile)
+	})
+
+	run := func(contents ...[]byte) {
+		imageCache := cache.NewCache(&fakePuller{image: &fakeImage{ref: ref, digest: contentDigest, contents: contents}})
+		go cache.NewLocalImagePuller(imageCache, refFile, directory, notifier).WatchFile(ctx, cache.WatchOptions{Backoff: cache.DefaultBackoff})
+	}
+
+	readFile := func() ([]byte, error) {
+		return ioutil.ReadFile(filepath.Join(directory, contentDigest.Encoded()))
+	}
+
+	It("does not write content which does not match the image digest", func() {
+		run(corrupted)
+
+		Eventually(notifier.getErrors, 10*time.Second).Should(HaveKeyWithValue(ref, ContainSubstring(
+			"downloaded content has digest "+digest.FromBytes(corrupted).String()+", expected "+contentDigest.String())))
+		_, err := readFile()
+		Expect(os.IsNotExist(err)).To(BeTrue())
+		// the partial copies are removed too
+		files, err := ioutil.ReadDir(directory)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(BeEmpty())
+	})
+
+	Context("when the registry cannot be reached", func() {
+		var puller *flakyPuller
+
+		BeforeEach(func() {
+			puller = &flakyPuller{fakePuller: fakePuller{image: &fakeImage{ref: ref, digest: contentDigest, contents: [][]byte{content}}}}
+		})
+
+		watch := func(resyncInterval time.Duration, backoff cache.Backoff) {
+			go cache.NewLocalImagePuller(cache.NewCache(puller), refFile, directory, notifier).WatchFile(ctx, cache.WatchOptions{ResyncInterval: resyncInterval, Backoff: backoff})
+		}
+
+		It("retries failed pulls and reports the image once pulled", func() {
+			puller.setFailures(2)
+			watch(0, cache.Backoff{Initial: time.Millisecond, Max: time.Second, MaxElapsed: time.Minute})
+
+			Eventually(readFile, 10*time.Second).Should(Equal(content))
+			Eventually(func() int { return notifier.getAdded(ref) }).Should(Equal(1))
+			Expect(notifier.getFailures(ref)).To(Equal(2))
+			Expect(notifier.isRetrying(ref)).To(BeTrue())
+
+			// pulled images are not reported again until the next resync
+			Consistently(func() int { return notifier.getAdded(ref) }, 3*time.Second).Should(Equal(1))
+		})
+
+		It("stops retrying after the max elapsed time until the next resync", func() {
+			puller.setFailures(-1)
+			watch(3*time.Second, cache.Backoff{Initial: time.Second, MaxElapsed: time.Millisecond})
+
+			Eventually(func() int { return notifier.getFailures(ref) }, 5*time.Second).Should(Equal(1))
+			Expect(notifier.isRetrying(ref)).To(BeFalse())
+			puller.setFailures(0)
+
+			Consistently(func() bool {
+				_, err := readFile()
+				return os.IsNotExist(err)
+			}, time.Second).Should(BeTrue())
+			Eventually(readFile, 5*time.Second).Should(Equal(content))
+			Expect(notifier.getFailures(ref)).To(Equal(1))
+			Expect(notifier.getAdded(ref)).To(Equal(1))
+		})
+	})
+
+	It("pulls images concurrently, writing each file once", func() {
+		const delay = 500 * time.Millisecond
+		puller := &slowPuller{delay: delay, images: map[string]*slowImage{}}
+		var refs []string
+		for i := 0; i < 6; i++ {
+			imageRef := fmt.Sprintf("webassemblyhub.io/filter/image-%v:v1", i)
+			imageContent := []byte(imageRef)
+			puller.images[imageRef] = &slowImage{
+				fakeImage: &fakeImage{ref: imageRef, digest: digest.FromBytes(imageContent), contents: [][]byte{imageContent}},
+				delay:     delay,
+			}
+			refs = append(refs, imageRef)
+		}
+		// another ref resolving to the same image, pulled at the same time
+		const sameDigestRef = "webassemblyhub.io/filter/image-0:latest"
+		puller.images[sameDigestRef] = puller.images[refs[0]]
+		refs = append([]string{refs[0], sameDigestRef}, refs[1:]...)
+		Expect(ioutil.WriteFile(refFile, []byte(strings.Join(refs, "\n")+"\n"), 0644)).To(Succeed())
+
+		go cache.NewLocalImagePuller(cache.NewCache(puller), refFile, directory, notifier).WatchFile(ctx, cache.WatchOptions{
+			Backoff:     cache.DefaultBackoff,
+			Concurrency: 4,
+		})
+
+		Eventually(func() int {
+			var added int
+			for _, imageRef := range refs {
+				added += notifier.getAdded(imageRef)
+			}
+			return added
+		}, 10*time.Second, 10*time.Millisecond).Should(Equal(len(refs)))
+		// pulling and writing the images one at a time would take over 6 seconds
+		Expect(time.Since(puller.getFirstPull())).To(BeNumerically("<", 6*delay))
+		Expect(puller.getMaxPulling()).To(Equal(4))
+
+		var written, expectedWritten int64
+		for imageRef, image := range puller.images {
+			content, err := ioutil.ReadFile(filepath.Join(directory, image.digest.Encoded()))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(content).To(Equal(image.contents[0]))
+			Expect(image.getFetches()).To(Equal(1), imageRef)
+			written += notifier.getWritten(imageRef)
+			if imageRef != sameDigestRef {
+				expectedWritten += int64(len(content))
+			}
+		}
+		// only the pull which wrote the shared file reports its size
+		Expect(written).To(Equal(expectedWritten))
+		Expect(notifier.getErrors()).To(BeEmpty())
+	})
+
+	It("reads the refs of the structured image list", func() {
+		data, err := cache.ImageList{ref: {Digest: contentDigest.String()}}.Marshal()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.WriteFile(refFile, []byte(data), 0644)).To(Succeed())
+		run(content)
+
+		Eventually(readFile, 10*time.Second).Should(Equal(content))
+	})
+
+	It("retries fetching corrupted content", func() {
+		run(corrupted, corrupted, content)
+
+		Eventually(readFile, 10*time.Second).Should(Equal(content))
+		Expect(notifier.getErrors()).To(BeEmpty())
+	})
+})
@@ -1,9 +1,11 @@
 package config
 
 import (
+	"bytes"
 	"io"
 	"io/ioutil"
 
+	"github.com/gogo/protobuf/jsonpb"
 	"github.com/solo-io/go-utils/protoutils"
 )
 
@@ -23,3 +25,15 @@ func FromReader(r io.Reader) (*Runtime, error) {
 	}
 	return FromBytes(b)
 }
+
+// MarshalJSON encodes the config with the proto field names, as encoding/json does for the fields of the struct,
+// so the DefaultConfig is encoded as the JSON value it holds
+func (cfg *Runtime) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := (&jsonpb.Marshaler{OrigName: true}).Marshal(buf, cfg)
+	return buf.Bytes(), err
+}
+
+func (cfg *Runtime) UnmarshalJSON(b []byte) error {
+	return jsonpb.Unmarshal(bytes.NewReader(b), cfg)
+}
@@ -7,6 +7,7 @@ import (
 	fmt "fmt"
 	math "math"
 
+	types "github.com/gogo/protobuf/types"
 	proto "github.com/golang/protobuf/proto"
 )
 
@@ -27,15 +28,20 @@ const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 // Example:
 //
 // ```json
-// {
-//   "type": "envoy_proxy",
-//   "abiVersions": ["v0-541b2c1155fffb15ccde92b8324f3e38f7339ba6"],
-//   "config": {
-//     "rootIds": [
-//       "add_header_root_id"
-//     ]
-//   }
-// }
+//
+//	{
+//	  "type": "envoy_proxy",
+//	  "abiVersions": ["v0-541b2c1155fffb15ccde92b8324f3e38f7339ba6"],
+//	  "config": {
+//	    "rootIds": [
+//	      "add_header_root_id"
+//	    ]
+//	  },
+//	  "defaultConfig": {"header": "hello"},
+//	  "description": "adds a header to the responses",
+//	  "docsUrl": "https://example.com/add-header"
+//	}
+//
 // ```
 type Runtime struct {
 	// the type of the runtime
@@ -46,10 +52,17 @@ type Runtime struct {
 	AbiVersions []string `protobuf:"bytes,2,rep,name=abi_versions,json=abiVersions,proto3" json:"abi_versions,omitempty"`
 	// the config for running the module
 	// currently, wasme only supports Envoy config
-	Config               *EnvoyConfig `protobuf:"bytes,3,opt,name=config,proto3" json:"config,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
-	XXX_unrecognized     []byte       `json:"-"`
-	XXX_sizecache        int32        `json:"-"`
+	Config *EnvoyConfig `protobuf:"bytes,3,opt,name=config,proto3" json:"config,omitempty"`
+	// the config passed to the filter when the deployment does not set one.
+	// any JSON value: strings are passed to the filter as is, other values as their JSON encoding
+	DefaultConfig *types.Value `protobuf:"bytes,4,opt,name=default_config,json=defaultConfig,proto3" json:"default_config,omitempty"`
+	// a description of the filter
+	Description string `protobuf:"bytes,5,opt,name=description,proto3" json:"description,omitempty"`
+	// the URL of the documentation of the filter
+	DocsUrl              string   `protobuf:"bytes,6,opt,name=docs_url,json=docsUrl,proto3" json:"docs_url,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
 func (m *Runtime) Reset()         { *m = Runtime{} }
@@ -98,6 +111,27 @@ func (m *Runtime) GetConfig() *EnvoyConfig {
 	return nil
 }
 
+func (m *Runtime) GetDefaultConfig() *types.Value {
+	if m != nil {
+		return m.DefaultConfig
+	}
+	return nil
+}
+
+func (m *Runtime) GetDescription() string {
+	if m != nil {
+		return m.Description
+	}
+	return ""
+}
+
+func (m *Runtime) GetDocsUrl() string {
+	if m != nil {
+		return m.DocsUrl
+	}
+	return ""
+}
+
 // configuration for an Envoy Filter WASM Image
 type EnvoyConfig struct {
 	// the set of root IDs exposed by the Envoy Filter
@@ -149,17 +183,22 @@ func init() {
 }
 
 var fileDescriptor_86e2dd377c869464 = []byte{
-	// 180 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0x2d, 0x2a, 0xcd, 0x2b,
-	0xc9, 0xcc, 0x4d, 0xd5, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x12, 0xca, 0xcd, 0x4f, 0x29, 0xcd,
-	0x49, 0xd5, 0x2b, 0x4f, 0x2c, 0xce, 0xd5, 0x4b, 0xce, 0xcf, 0x4b, 0xcb, 0x4c, 0x57, 0xaa, 0xe4,
-	0x62, 0x0f, 0x82, 0x28, 0x12, 0x12, 0xe2, 0x62, 0x29, 0xa9, 0x2c, 0x48, 0x95, 0x60, 0x54, 0x60,
-	0xd4, 0xe0, 0x0c, 0x02, 0xb3, 0x85, 0x14, 0xb9, 0x78, 0x12, 0x93, 0x32, 0xe3, 0xcb, 0x52, 0x8b,
-	0x8a, 0x33, 0xf3, 0xf3, 0x8a, 0x25, 0x98, 0x14, 0x98, 0x35, 0x38, 0x83, 0xb8, 0x13, 0x93, 0x32,
-	0xc3, 0xa0, 0x42, 0x42, 0xe6, 0x5c, 0x6c, 0x10, 0xb3, 0x24, 0x98, 0x15, 0x18, 0x35, 0xb8, 0x8d,
-	0xe4, 0xf5, 0x30, 0xad, 0xd1, 0x73, 0xcd, 0x2b, 0xcb, 0xaf, 0x74, 0x06, 0xb3, 0x83, 0xa0, 0xca,
-	0x95, 0x34, 0xb8, 0xb8, 0x91, 0x84, 0x85, 0x24, 0xb9, 0x38, 0x8a, 0xf2, 0xf3, 0x4b, 0xe2, 0x33,
-	0x53, 0x8a, 0x25, 0x18, 0xc1, 0xd6, 0xb0, 0x83, 0xf8, 0x9e, 0x29, 0xc5, 0x4e, 0x1c, 0x51, 0x50,
-	0x3d, 0x49, 0x6c, 0x60, 0x9f, 0x18, 0x03, 0x02, 0x00, 0x00, 0xff, 0xff, 0xf6, 0x48, 0x98, 0xef,
-	0xda, 0x00, 0x00, 0x00,
+	// 265 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x64, 0x8f, 0xbf, 0x4b, 0xc4, 0x30,
+	0x18, 0x86, 0xa9, 0x77, 0xb6, 0x77, 0xa9, 0xe7, 0x90, 0x41, 0xa2, 0x08, 0xd6, 0x9b, 0x3a, 0xe5,
+	0x40, 0x07, 0x27, 0x17, 0xc5, 0xc1, 0xb5, 0xe0, 0x0d, 0x2e, 0xa5, 0x6d, 0xd2, 0x12, 0x48, 0xf3,
+	0x95, 0xfc, 0x38, 0xb9, 0x3f, 0xdc, 0x5d, 0x9a, 0x44, 0x38, 0xb8, 0xed, 0xfb, 0xde, 0xbc, 0x79,
+	0xf2, 0x04, 0x6d, 0xb4, 0x53, 0x56, 0x8c, 0x9c, 0x4e, 0x1a, 0x2c, 0x60, 0x3c, 0x02, 0x73, 0x92,
+	0xd3, 0x9f, 0xc6, 0x8c, 0xb4, 0x03, 0xd5, 0x8b, 0xe1, 0xee, 0x7e, 0x00, 0x18, 0x24, 0xdf, 0xf9,
+	0x46, 0xeb, 0xfa, 0x9d, 0xb1, 0xda, 0x75, 0x36, 0xdc, 0xd8, 0xfe, 0x26, 0x28, 0xab, 0x02, 0x03,
+	0x63, 0xb4, 0xb4, 0xc7, 0x89, 0x93, 0xa4, 0x48, 0xca, 0x75, 0xe5, 0x67, 0xfc, 0x88, 0xae, 0x9a,
+	0x56, 0xd4, 0x07, 0xae, 0x8d, 0x00, 0x65, 0xc8, 0x45, 0xb1, 0x28, 0xd7, 0x55, 0xde, 0xb4, 0x62,
+	0x1f, 0x23, 0xfc, 0x82, 0xd2, 0xf0, 0x14, 0x59, 0x14, 0x49, 0x99, 0x3f, 0x3d, 0xd0, 0x73, 0x0b,
+	0xfa, 0xa1, 0x0e, 0x70, 0x7c, 0xf7, 0x73, 0x15, 0xeb, 0xf8, 0x15, 0x5d, 0x33, 0xde, 0x37, 0x4e,
+	0xda, 0x3a, 0x02, 0x96, 0x1e, 0x70, 0x43, 0x83, 0x32, 0xfd, 0x57, 0xa6, 0xfb, 0x46, 0x3a, 0x5e,
+	0x6d, 0x62, 0x3b, 0x60, 0x70, 0x81, 0x72, 0xc6, 0x4d, 0xa7, 0xc5, 0x64, 0x05, 0x28, 0x72, 0xe9,
+	0xad, 0x4f, 0x23, 0x7c, 0x8b, 0x56, 0x0c, 0x3a, 0x53, 0x3b, 0x2d, 0x49, 0xea, 0x8f, 0xb3, 0x79,
+	0xff, 0xd2, 0x72, 0x5b, 0xa2, 0xfc, 0x44, 0x69, 0x6e, 0x6a, 0x00, 0x5b, 0x0b, 0x66, 0x48, 0xe2,
+	0xbf, 0x98, 0xcd, 0xfb, 0x27, 0x33, 0x6f, 0xab, 0xef, 0xe8, 0xdb, 0xa6, 0xde, 0xe7, 0xf9, 0x6f,
+	0x00, 0x2b, 0x9f, 0x3a, 0x68, 0x75, 0x01, 0x00, 0x00,
 }
@@ -0,0 +1,161 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// RuntimeSchema is the JSON schema of the runtime config of an image, e.g. the runtime-config.json of a filter
+const RuntimeSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "title": "wasme runtime config",
+  "type": "object",
+  "additionalProperties": false,
+  "properties": {
+    "type": {"type": "string", "minLength": 1},
+    "abiVersions": {"type": "array", "items": {"type": "string", "minLength": 1}},
+    "config": {
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "rootIds": {"type": "array", "items": {"type": "string", "minLength": 1}}
+      }
+    },
+    "defaultConfig": {},
+    "description": {"type": "string"},
+    "docsUrl": {"type": "string", "format": "uri"}
+  }
+}`
+
+// the subset of JSON schema used by RuntimeSchema
+type schema struct {
+	Type                 string             `json:"type"`
+	Properties           map[string]*schema `json:"properties"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Items                *schema            `json:"items"`
+	MinLength            int                `json:"minLength"`
+	Format               string             `json:"format"`
+}
+
+var runtimeSchema = mustParseSchema(RuntimeSchema)
+
+func mustParseSchema(raw string) *schema {
+	var s schema
+	if err := json.Unmarshal([]byte(raw), &s); err != nil {
+		panic(err)
+	}
+	return &s
+}
+
+// Validate validates the runtime config against the RuntimeSchema.
+// the error lists every invalid field by its path, e.g. abiVersions[1]
+func Validate(b []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return errors.Wrap(err, "parsing runtime config")
+	}
+
+	var problems []string
+	runtimeSchema.validate("", value, &problems)
+	if len(problems) > 0 {
+		return errors.Errorf("invalid runtime config: %v", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (s *schema) validate(path string, value interface{}, problems *[]string) {
+	report := func(format string, args ...interface{}) {
+		field := path
+		if field == "" {
+			field = "the config"
+		}
+		*problems = append(*problems, field+": "+fmt.Sprintf(format, args...))
+	}
+
+	if s.Type != "" && jsonType(value) != s.Type {
+		report("expected %v, got %v", s.Type, jsonType(value))
+		return
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		var keys []string
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			property, ok := s.property(key)
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					report("unknown field %q", key)
+				}
+				continue
+			}
+			property.validate(joinPath(path, key), value[key], problems)
+		}
+	case []interface{}:
+		if s.Items == nil {
+			return
+		}
+		for i, item := range value {
+			s.Items.validate(fmt.Sprintf("%v[%v]", path, i), item, problems)
+		}
+	case string:
+		if len(value) < s.MinLength {
+			report("must not be empty")
+		}
+		if s.Format == "uri" {
+			if parsed, err := url.Parse(value); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+				report("%q is not an absolute URL", value)
+			}
+		}
+	}
+}
+
+// returns the schema of the property, which may also be named by its proto field name, e.g. abi_versions
+func (s *schema) property(key string) (*schema, bool) {
+	if property, ok := s.Properties[key]; ok {
+		return property, true
+	}
+	parts := strings.Split(key, "_")
+	for i := 1; i < len(parts); i++ {
+		parts[i] = strings.Title(parts[i])
+	}
+	property, ok := s.Properties[strings.Join(parts, "")]
+	return property, ok
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// returns the JSON schema type of the decoded value
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,58 @@
+package config_test
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/wasm/tools/wasme/pkg/config"
+)
+
+var _ = Describe("Schema", func() {
+	It("accepts a complete runtime config", func() {
+		err := config.Validate([]byte(`{
+  "type": "envoy_proxy",
+  "abiVersions": ["v0.2.1"],
+  "config": {"rootIds": ["root_id"]},
+  "defaultConfig": {"header": "hello", "values": [1, 2]},
+  "description": "adds a header",
+  "docsUrl": "https://example.com/add-header"
+}`))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("accepts the proto field names", func() {
+		err := config.Validate([]byte(`{"type": "envoy_proxy", "abi_versions": ["v0.2.1"], "config": {"root_ids": ["root_id"]}}`))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("reports every invalid field by its path", func() {
+		err := config.Validate([]byte(`{
+  "abiVersions": ["v0.2.1", 2],
+  "config": {"rootIds": [""], "rootId": "root_id"},
+  "docsUrl": "example.com",
+  "descripton": "typo"
+}`))
+		Expect(err).To(MatchError(`invalid runtime config: abiVersions[1]: expected string, got number; ` +
+			`config: unknown field "rootId"; config.rootIds[0]: must not be empty; ` +
+			`the config: unknown field "descripton"; docsUrl: "example.com" is not an absolute URL`))
+	})
+
+	It("rejects configs which are not JSON objects", func() {
+		Expect(config.Validate([]byte(`["v0.2.1"]`))).To(MatchError("invalid runtime config: the config: expected object, got array"))
+		Expect(config.Validate([]byte(`{`))).To(HaveOccurred())
+	})
+
+	It("encodes the default config as the JSON value it holds", func() {
+		cfg, err := config.FromBytes([]byte(`{"abiVersions": ["v0.2.1"], "defaultConfig": {"header": "hello"}, "docsUrl": "https://example.com"}`))
+		Expect(err).NotTo(HaveOccurred())
+
+		encoded, err := json.Marshal(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(encoded).To(MatchJSON(`{"abi_versions": ["v0.2.1"], "default_config": {"header": "hello"}, "docs_url": "https://example.com"}`))
+
+		var decoded config.Runtime
+		Expect(json.Unmarshal(encoded, &decoded)).NotTo(HaveOccurred())
+		Expect(decoded.GetDefaultConfig().GetStructValue().GetFields()["header"].GetStringValue()).To(Equal("hello"))
+	})
+})
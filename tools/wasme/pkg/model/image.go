@@ -7,6 +7,7 @@ import (
 
 	"github.com/deislabs/oras/pkg/content"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
 	"github.com/solo-io/wasm/tools/wasme/pkg/config"
 	"github.com/solo-io/wasm/tools/wasme/pkg/util"
 )
@@ -44,6 +45,68 @@ const (
 	ContentMediaType = "application/vnd.module.wasm.content.layer.v1+wasm"
 )
 
+// the media types of the module layers of the wasm images published by other tools, e.g. wasm-to-oci
+// and the CNCF Wasm OCI artifact layout, which are pulled in addition to ContentMediaType.
+// their config is not a wasme config
+const (
+	WasmToOciContentMediaType = "application/vnd.wasm.content.layer.v1+wasm"
+	WasmContentMediaType      = "application/wasm"
+)
+
+// AbiVersionAnnotation is the annotation of the manifests of images, and of the variants of multi-variant images,
+// listing the ABI versions of the filter separated by commas
+const AbiVersionAnnotation = "module.wasm.runtime/abi_version"
+
+// ContentMediaTypes are the media types of module layers, in the order they are looked for on pulled images
+var ContentMediaTypes = []string{ContentMediaType, WasmToOciContentMediaType, WasmContentMediaType}
+
+// Format is the layout of the manifest of a pushed image
+type Format string
+
+const (
+	// the wasme config is pushed as the config of the manifest and as a layer, next to the module layer
+	FormatWasme Format = "wasme"
+	// the wasme config is only pushed as the config of the manifest, so the module is the single layer,
+	// the layout pulled by the OCI image fetcher of istiod
+	FormatCompat Format = "compat"
+)
+
+// SupportedFormats are the formats images can be pushed in
+var SupportedFormats = []Format{FormatWasme, FormatCompat}
+
+// ParseFormat returns the format with the name, defaulting to FormatWasme if the name is empty
+func ParseFormat(name string) (Format, error) {
+	if name == "" {
+		return FormatWasme, nil
+	}
+	for _, format := range SupportedFormats {
+		if string(format) == name {
+			return format, nil
+		}
+	}
+	return "", errors.Errorf("unknown image format %v, must be one of %v", name, SupportedFormats)
+}
+
+// FormattedImage is an image which records the format it is pushed in, e.g. an image built with wasme build --format
+type FormattedImage interface {
+	Image
+	Format() Format
+}
+
+// ImageFormat returns the format the image is pushed in, defaulting to FormatWasme
+func ImageFormat(image Image) Format {
+	if formatted, ok := image.(FormattedImage); ok && formatted.Format() != "" {
+		return formatted.Format()
+	}
+	return FormatWasme
+}
+
+// DefaultConfig is the config of the images which have no wasme config, e.g. images published by other tools.
+// it declares no ABI versions or root ids
+func DefaultConfig() *config.Runtime {
+	return &config.Runtime{Type: string(Runtime_EnvoyProxy)}
+}
+
 // default filenames stored in a Wasm Module Image
 const (
 	ConfigFilename = "runtime-config.json"
@@ -65,8 +128,17 @@ func GetDescriptor(filter Filter) (ocispec.Descriptor, error) {
 	return store.Add(CodeFilename, ContentMediaType, bytes), nil
 }
 
-// expand the ref to contain :latest suffix if no tag provided
+// expand the ref to contain :latest suffix if no tag or digest provided
 func FullRef(ref string) (string, error) {
-	name, tag, err := util.SplitImageRef(ref)
-	return name + ":" + tag, err
+	name, tag, imageDigest, err := util.SplitImageRefDigest(ref)
+	if err != nil {
+		return "", err
+	}
+	if tag != "" {
+		name += ":" + tag
+	}
+	if imageDigest != "" {
+		name += "@" + imageDigest.String()
+	}
+	return name, nil
 }
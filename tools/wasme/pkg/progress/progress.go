@@ -0,0 +1,98 @@
+package progress
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+
+	"github.com/containerd/containerd/content"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Update is the progress of the transfer of a blob of an image
+type Update struct {
+	// the ref of the image
+	Ref string
+	// the descriptor of the transferred blob
+	Descriptor ocispec.Descriptor
+	// the number of bytes of the blob transferred so far
+	Transferred int64
+}
+
+// Total returns the size of the blob
+func (u Update) Total() int64 {
+	return u.Descriptor.Size
+}
+
+// Done returns true once every byte of the blob was transferred
+func (u Update) Done() bool {
+	return u.Transferred >= u.Descriptor.Size
+}
+
+// Func is called with the progress of each transfer, after every read of the blob.
+// it is called concurrently for the blobs transferred concurrently, so it must be safe for concurrent use
+type Func func(update Update)
+
+// NewReader returns a reader which reports the bytes read from rc, or rc if report is nil
+func NewReader(rc io.ReadCloser, ref string, desc ocispec.Descriptor, report Func) io.ReadCloser {
+	if report == nil {
+		return rc
+	}
+	return &reader{ReadCloser: rc, update: Update{Ref: ref, Descriptor: desc}, report: report}
+}
+
+type reader struct {
+	io.ReadCloser
+	update Update
+	report Func
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.update.Transferred += int64(n)
+		r.report(r.update)
+	}
+	return n, err
+}
+
+// NewProvider returns a provider which reports the bytes read from the blobs of the provider, or the provider if report is nil.
+// used to report the progress of pushes, which read the pushed blobs from a provider
+func NewProvider(provider content.Provider, ref string, report Func) content.Provider {
+	if report == nil {
+		return provider
+	}
+	return &reportingProvider{Provider: provider, ref: ref, report: report}
+}
+
+type reportingProvider struct {
+	content.Provider
+	ref    string
+	report Func
+}
+
+func (p *reportingProvider) ReaderAt(ctx context.Context, desc ocispec.Descriptor) (content.ReaderAt, error) {
+	ra, err := p.Provider.ReaderAt(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	return &readerAt{ReaderAt: ra, update: Update{Ref: p.ref, Descriptor: desc}, report: p.report}, nil
+}
+
+// blobs are read sequentially with ReadAt, so the bytes read are the bytes transferred
+type readerAt struct {
+	content.ReaderAt
+	update      Update
+	transferred int64
+	report      Func
+}
+
+func (r *readerAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.ReaderAt.ReadAt(p, off)
+	if n > 0 {
+		update := r.update
+		update.Transferred = atomic.AddInt64(&r.transferred, int64(n))
+		r.report(update)
+	}
+	return n, err
+}
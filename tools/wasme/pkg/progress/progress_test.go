@@ -0,0 +1,79 @@
+package progress_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"sync"
+
+	"github.com/containerd/containerd/content"
+	orascontent "github.com/deislabs/oras/pkg/content"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/solo-io/wasm/tools/wasme/pkg/progress"
+)
+
+var _ = Describe("Progress", func() {
+	var (
+		lock sync.Mutex
+		// the last update of each blob
+		updates map[digest.Digest]progress.Update
+	)
+
+	report := func(update progress.Update) {
+		lock.Lock()
+		defer lock.Unlock()
+		Expect(update.Transferred).To(BeNumerically(">=", updates[update.Descriptor.Digest].Transferred))
+		updates[update.Descriptor.Digest] = update
+	}
+
+	BeforeEach(func() {
+		updates = map[digest.Digest]progress.Update{}
+	})
+
+	It("reports the bytes read from each blob", func() {
+		blob := bytes.Repeat([]byte("module"), 10000)
+		desc := ocispec.Descriptor{Digest: digest.FromBytes(blob), Size: int64(len(blob))}
+		content, err := ioutil.ReadAll(progress.NewReader(ioutil.NopCloser(bytes.NewReader(blob)), "webassemblyhub.io/user/filter:v1", desc, report))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(content).To(Equal(blob))
+
+		update := updates[desc.Digest]
+		Expect(update.Ref).To(Equal("webassemblyhub.io/user/filter:v1"))
+		Expect(update.Transferred).To(Equal(desc.Size))
+		Expect(update.Done()).To(BeTrue())
+	})
+
+	It("reports the totals of every blob read from a provider", func() {
+		store := orascontent.NewMemoryStore()
+		descriptors := []ocispec.Descriptor{
+			store.Add("runtime-config.json", "application/vnd.module.wasm.config.v1+json", []byte(`{"type":"envoy_proxy"}`)),
+			store.Add("filter.wasm", "application/vnd.module.wasm.content.layer.v1+wasm", bytes.Repeat([]byte("module"), 100000)),
+		}
+		provider := progress.NewProvider(store, "webassemblyhub.io/user/filter:v1", report)
+
+		var total int64
+		for _, desc := range descriptors {
+			_, err := content.ReadBlob(context.TODO(), provider, desc)
+			Expect(err).NotTo(HaveOccurred())
+			total += desc.Size
+		}
+
+		var transferred int64
+		for _, desc := range descriptors {
+			Expect(updates[desc.Digest].Done()).To(BeTrue())
+			transferred += updates[desc.Digest].Transferred
+		}
+		Expect(updates).To(HaveLen(2))
+		Expect(transferred).To(Equal(total))
+	})
+
+	It("does not wrap readers or providers without a progress function", func() {
+		rc := ioutil.NopCloser(bytes.NewReader(nil))
+		Expect(progress.NewReader(rc, "", ocispec.Descriptor{}, nil)).To(BeIdenticalTo(rc))
+		store := orascontent.NewMemoryStore()
+		Expect(progress.NewProvider(store, "", nil)).To(BeIdenticalTo(store))
+	})
+})
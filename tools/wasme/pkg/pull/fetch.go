@@ -0,0 +1,99 @@
+package pull
+
+import (
+	"context"
+	"io/ioutil"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/solo-io/wasm/tools/wasme/pkg/util"
+)
+
+// fetches the blobs of the image concurrently, writing them through the blob store of the puller.
+// without a blob store, the blobs are kept by the image until they are read once.
+// the first failed fetch cancels the others, and the blobs which were not stored are discarded
+func (p *puller) fetchBlobs(ctx context.Context, image *pulledImage) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		fetches  sync.WaitGroup
+		lock     sync.Mutex
+		fetched  = map[digest.Digest][]byte{}
+		firstErr error
+	)
+	fail := func(err error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+	// the config of images pushed by wasme is also a layer
+	queued := map[digest.Digest]bool{}
+	for _, desc := range image.children {
+		if queued[desc.Digest] {
+			continue
+		}
+		queued[desc.Digest] = true
+
+		fetches.Add(1)
+		go func(desc ocispec.Descriptor) {
+			defer fetches.Done()
+			blobDigest, content, err := p.fetchBlob(ctx, image.ref, desc)
+			if err != nil {
+				fail(errors.Wrapf(err, "fetching blob %v of image %v", desc.Digest, image.ref))
+				return
+			}
+			if p.blobs == nil {
+				lock.Lock()
+				defer lock.Unlock()
+				fetched[blobDigest] = content
+			}
+		}(desc)
+	}
+	fetches.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	if p.blobs == nil {
+		image.prefetch(fetched)
+	}
+	return nil
+}
+
+// fetches the blob while holding a fetch token, returning its normalized digest and verified content.
+// the content of the blobs written to the blob store is verified by the store
+func (p *puller) fetchBlob(ctx context.Context, ref string, desc ocispec.Descriptor) (digest.Digest, []byte, error) {
+	blobDigest, err := util.NormalizeDigest(string(desc.Digest))
+	if err != nil {
+		return "", nil, err
+	}
+	select {
+	case p.fetches <- struct{}{}:
+	case <-ctx.Done():
+		return "", nil, ctx.Err()
+	}
+	defer func() { <-p.fetches }()
+
+	rc, err := fetchBlob(ctx, p.resolver, p.blobs, ref, desc, p.progress)
+	if err != nil {
+		return "", nil, err
+	}
+	defer rc.Close()
+	content, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return "", nil, err
+	}
+	if p.blobs != nil {
+		return blobDigest, content, nil
+	}
+	if actual := blobDigest.Algorithm().FromBytes(content); actual != blobDigest {
+		return "", nil, errors.Errorf("downloaded content has digest %v, expected %v", actual, blobDigest)
+	}
+	return blobDigest, content, nil
+}
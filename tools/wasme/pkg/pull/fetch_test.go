@@ -0,0 +1,253 @@
+package pull_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/solo-io/wasm/tools/wasme/pkg/model"
+	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
+	"github.com/solo-io/wasm/tools/wasme/pkg/resolver"
+)
+
+// a registry serving images with a config and module layer at user/filter<i>:v1
+type testRegistry struct {
+	*httptest.Server
+	// the delay of the response to each request for a blob
+	latency time.Duration
+
+	lock      sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	// the number of requests for each blob, and the maximum number of requests for blobs served at once
+	fetched     map[string]int
+	inFlight    int
+	maxInFlight int
+}
+
+func newTestRegistry(images int, latency time.Duration) *testRegistry {
+	r := &testRegistry{latency: latency, blobs: map[string][]byte{}, manifests: map[string][]byte{}, fetched: map[string]int{}}
+	for i := 0; i < images; i++ {
+		cfg := []byte(fmt.Sprintf(`{"type":"envoy_proxy","config":{"root_ids":["filter%v"]}}`, i))
+		module := bytes.Repeat([]byte(fmt.Sprintf("\x00asm module %v", i)), 10000)
+		cfgDesc := ocispec.Descriptor{MediaType: model.ConfigMediaType, Digest: digest.FromBytes(cfg), Size: int64(len(cfg))}
+		moduleDesc := ocispec.Descriptor{MediaType: model.ContentMediaType, Digest: digest.FromBytes(module), Size: int64(len(module))}
+		manifest, err := json.Marshal(ocispec.Manifest{Versioned: specs.Versioned{SchemaVersion: 2}, Config: cfgDesc, Layers: []ocispec.Descriptor{cfgDesc, moduleDesc}})
+		if err != nil {
+			panic(err)
+		}
+		repository := "user/filter" + strconv.Itoa(i)
+		r.manifests["/v2/"+repository+"/manifests/v1"] = manifest
+		r.manifests["/v2/"+repository+"/manifests/"+digest.FromBytes(manifest).String()] = manifest
+		r.blobs["/v2/"+repository+"/blobs/"+cfgDesc.Digest.String()] = cfg
+		r.blobs["/v2/"+repository+"/blobs/"+moduleDesc.Digest.String()] = module
+	}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	return r
+}
+
+func (r *testRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	if manifest, ok := r.manifests[req.URL.Path]; ok {
+		w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+		w.Header().Set("Docker-Content-Digest", digest.FromBytes(manifest).String())
+		w.Header().Set("Content-Length", strconv.Itoa(len(manifest)))
+		if req.Method != http.MethodHead {
+			w.Write(manifest)
+		}
+		return
+	}
+	r.lock.Lock()
+	blob, ok := r.blobs[req.URL.Path]
+	r.fetched[req.URL.Path]++
+	r.inFlight++
+	if r.inFlight > r.maxInFlight {
+		r.maxInFlight = r.inFlight
+	}
+	r.lock.Unlock()
+	defer func() {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		r.inFlight--
+	}()
+
+	time.Sleep(r.latency)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(blob)))
+	w.Write(blob)
+}
+
+func (r *testRegistry) ref(i int) string {
+	serverUrl, err := url.Parse(r.URL)
+	if err != nil {
+		panic(err)
+	}
+	return serverUrl.Host + "/user/filter" + strconv.Itoa(i) + ":v1"
+}
+
+func (r *testRegistry) newPuller(opts pull.Options) pull.ImagePuller {
+	res, _, err := resolver.NewResolverWithOptions(
+		func(string) (string, string, error) { return "", "", nil },
+		resolver.RegistryOptions{PlainHTTPHosts: []string{resolver.AllHosts}},
+	)
+	if err != nil {
+		panic(err)
+	}
+	return pull.NewPullerWithOptions(res, opts)
+}
+
+// pulls the images concurrently, and reads their configs and modules
+func pullImages(puller pull.ImagePuller, refs ...string) error {
+	errs := make(chan error, len(refs))
+	for _, ref := range refs {
+		go func(ref string) {
+			image, err := puller.Pull(context.TODO(), ref)
+			if err == nil {
+				_, err = image.FetchConfig(context.TODO())
+			}
+			if err == nil {
+				var filter io.Reader
+				filter, err = image.FetchFilter(context.TODO())
+				if err == nil {
+					_, err = ioutil.ReadAll(filter)
+				}
+			}
+			errs <- err
+		}(ref)
+	}
+	for range refs {
+		if err := <-errs; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var _ = Describe("Fetching blobs", func() {
+	var registry *testRegistry
+
+	AfterEach(func() {
+		registry.Close()
+	})
+
+	DescribeTable("fetches the blobs of the pulled images concurrently, within the bound shared by the pulls",
+		func(prefetch bool) {
+			registry = newTestRegistry(3, 20*time.Millisecond)
+			puller := registry.newPuller(pull.Options{MaxConcurrentFetches: 2, Prefetch: prefetch})
+			Expect(pullImages(puller, registry.ref(0), registry.ref(1), registry.ref(2))).To(Succeed())
+
+			Expect(registry.maxInFlight).To(Equal(2))
+			// the blobs fetched by the pulls are read without fetching them again
+			Expect(registry.fetched).To(HaveLen(6))
+			for path, fetches := range registry.fetched {
+				Expect(fetches).To(Equal(1), path)
+			}
+		},
+		Entry("when the blobs are read", false),
+		Entry("when the blobs are prefetched", true),
+	)
+
+	It("does not fetch the blobs of the pulled images until they are read", func() {
+		registry = newTestRegistry(1, 0)
+		image, err := registry.newPuller(pull.Options{}).Pull(context.TODO(), registry.ref(0))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(registry.fetched).To(BeEmpty())
+
+		_, err = image.FetchConfig(context.TODO())
+		Expect(err).NotTo(HaveOccurred())
+		// the module is not fetched to read the config
+		Expect(registry.fetched).To(HaveLen(1))
+	})
+
+	It("fails reading a blob which does not match its digest", func() {
+		registry = newTestRegistry(1, 0)
+		for path, blob := range registry.blobs {
+			if len(blob) > 1000 {
+				registry.blobs[path] = bytes.ToUpper(blob)
+			}
+		}
+		image, err := registry.newPuller(pull.Options{}).Pull(context.TODO(), registry.ref(0))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = image.FetchFilter(context.TODO())
+		Expect(err).To(MatchError(ContainSubstring("downloaded content has digest")))
+	})
+
+	It("writes the prefetched blobs through the blob store", func() {
+		registry = newTestRegistry(1, 0)
+		store := &memoryBlobStore{blobs: map[digest.Digest][]byte{}}
+		image, err := registry.newPuller(pull.Options{BlobStore: store, Prefetch: true}).Pull(context.TODO(), registry.ref(0))
+		Expect(err).NotTo(HaveOccurred())
+		// the manifest, config and module
+		Expect(store.blobs).To(HaveLen(3))
+
+		registry.fetched = map[string]int{}
+		_, err = image.FetchFilter(context.TODO())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(registry.fetched).To(BeEmpty())
+	})
+
+	It("fails the prefetching pull if a blob does not match its digest", func() {
+		registry = newTestRegistry(1, 0)
+		for path, blob := range registry.blobs {
+			if len(blob) > 1000 {
+				registry.blobs[path] = bytes.ToUpper(blob)
+			}
+		}
+		_, err := registry.newPuller(pull.Options{Prefetch: true}).Pull(context.TODO(), registry.ref(0))
+		Expect(err).To(MatchError(ContainSubstring("downloaded content has digest")))
+	})
+
+	It("fails the prefetching pull if a blob cannot be fetched, without storing it", func() {
+		registry = newTestRegistry(1, 0)
+		var module string
+		for path, blob := range registry.blobs {
+			if len(blob) > 1000 {
+				module = path
+			}
+		}
+		delete(registry.blobs, module)
+		store := &memoryBlobStore{blobs: map[digest.Digest][]byte{}}
+		_, err := registry.newPuller(pull.Options{BlobStore: store, Prefetch: true}).Pull(context.TODO(), registry.ref(0))
+		Expect(err).To(MatchError(ContainSubstring("fetching blob " + module[strings.LastIndex(module, "/")+1:])))
+		Expect(store.blobs).NotTo(HaveKey(digest.Digest(module[strings.LastIndex(module, "/")+1:])))
+	})
+})
+
+// pulls several images from a registry which delays the responses for blobs, as a remote registry would
+func BenchmarkPull(b *testing.B) {
+	const images = 8
+	registry := newTestRegistry(images, 5*time.Millisecond)
+	defer registry.Close()
+	var refs []string
+	for i := 0; i < images; i++ {
+		refs = append(refs, registry.ref(i))
+	}
+	for _, concurrency := range []int{1, pull.DefaultMaxConcurrentFetches, 2 * images} {
+		b.Run(fmt.Sprintf("%v concurrent fetches", concurrency), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				if err := pullImages(registry.newPuller(pull.Options{MaxConcurrentFetches: concurrency}), refs...); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -1,30 +1,80 @@
 package pull
 
 import (
+	"bytes"
 	"context"
 	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/solo-io/wasm/tools/wasme/pkg/model"
 
-	"github.com/containerd/containerd/remotes"
+	"github.com/opencontainers/go-digest"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/solo-io/wasm/tools/wasme/pkg/config"
+	"github.com/solo-io/wasm/tools/wasme/pkg/util"
 )
 
 // an image that was pulled from a remote registry
 type pulledImage struct {
 	children []ocispec.Descriptor
-	ref      string
-	resolver remotes.Resolver
+	manifest ocispec.Descriptor
+	// the annotations of the manifest
+	annotations map[string]string
+	ref         string
+	// zero if fetches do not time out
+	timeout time.Duration
+	// fetches the blobs, and pulls the variants, of the image
+	puller *puller
+
+	// the index the ref of the image references, and its variants, if the image is the default variant of a multi-variant image.
+	// nil if the ref references the manifest of the image
+	index    *ocispec.Descriptor
+	variants []Variant
+
+	// the blobs fetched by the pull which were not read yet, if the blobs are fetched from the registry.
+	// a blob is only kept until it is read once, so images kept by the cache do not keep their modules in memory
+	prefetchedLock sync.Mutex
+	prefetched     map[digest.Digest][]byte
 }
 
 func (i *pulledImage) Ref() string {
 	return i.ref
 }
 
+// the digest of the index, if the ref of the image references an index of variants
+func (i *pulledImage) ManifestDigest() digest.Digest {
+	if i.index != nil {
+		return i.index.Digest
+	}
+	return i.manifest.Digest
+}
+
+func (i *pulledImage) Blobs() []ocispec.Descriptor {
+	return i.children
+}
+
+func (i *pulledImage) FetchBlob(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+	return i.fetchBlob(ctx, desc)
+}
+
+// the descriptor of the module layer, which has one of the model.ContentMediaTypes,
+// so images published by other tools are pulled too.
+// the digest of the returned descriptor is validated and normalized
 func (i *pulledImage) Descriptor() (ocispec.Descriptor, error) {
-	return i.getDescriptor(model.ContentMediaType)
+	desc, err := i.getDescriptor(model.ContentMediaTypes...)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	desc.Digest, err = util.NormalizeDigest(string(desc.Digest))
+	if err != nil {
+		return ocispec.Descriptor{}, errors.Wrapf(err, "image %v", i.ref)
+	}
+	return desc, nil
 }
 
 func (i *pulledImage) FetchFilter(ctx context.Context) (model.Filter, error) {
@@ -36,34 +86,74 @@ func (i *pulledImage) FetchFilter(ctx context.Context) (model.Filter, error) {
 	return i.fetchBlob(ctx, desc)
 }
 
+// images without a wasme config, e.g. images published by other tools, return the model.DefaultConfig
 func (i *pulledImage) FetchConfig(ctx context.Context) (*config.Runtime, error) {
 	desc, err := i.getDescriptor(model.ConfigMediaType)
 	if err != nil {
-		return nil, err
+		logrus.Debugf("image %v has no wasme config, using the default config", i.ref)
+		return model.DefaultConfig(), nil
 	}
 
 	rc, err := i.fetchBlob(ctx, desc)
 	if err != nil {
 		return nil, err
 	}
+	defer rc.Close()
 
 	return config.FromReader(rc)
 }
 
-func (i *pulledImage) getDescriptor(mediaType string) (ocispec.Descriptor, error) {
-	for _, child := range i.children {
-		if child.MediaType == mediaType {
-			return child, nil
+// returns the first child with the first of the media types found
+func (i *pulledImage) getDescriptor(mediaTypes ...string) (ocispec.Descriptor, error) {
+	for _, mediaType := range mediaTypes {
+		for _, child := range i.children {
+			if child.MediaType == mediaType {
+				return child, nil
+			}
 		}
 	}
-	return ocispec.Descriptor{}, errors.Errorf("media type %v not found on image", mediaType)
+	return ocispec.Descriptor{}, errors.Errorf("media type %v not found on image", strings.Join(mediaTypes, " or "))
+}
+
+func (i *pulledImage) prefetch(blobs map[digest.Digest][]byte) {
+	i.prefetchedLock.Lock()
+	defer i.prefetchedLock.Unlock()
+	i.prefetched = blobs
+}
+
+// returns the blob if it was fetched by the pull and not read yet. the blobs are stored by their normalized digest
+func (i *pulledImage) takePrefetched(desc ocispec.Descriptor) ([]byte, bool) {
+	blobDigest, err := util.NormalizeDigest(string(desc.Digest))
+	if err != nil {
+		return nil, false
+	}
+	i.prefetchedLock.Lock()
+	defer i.prefetchedLock.Unlock()
+	content, ok := i.prefetched[blobDigest]
+	delete(i.prefetched, blobDigest)
+	return content, ok
+}
+
+// returns the blobs which were not read yet, so they are read by another image of the same manifest instead
+func (i *pulledImage) takeAllPrefetched() map[digest.Digest][]byte {
+	i.prefetchedLock.Lock()
+	defer i.prefetchedLock.Unlock()
+	prefetched := i.prefetched
+	i.prefetched = nil
+	return prefetched
 }
 
+// the fetch times out after the timeout of the puller, and is bounded by the concurrent fetches of the puller.
+// the blobs prefetched by the pull are only fetched again once they were read
 func (i *pulledImage) fetchBlob(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
-	fetcher, err := i.resolver.Fetcher(ctx, i.ref)
+	if content, ok := i.takePrefetched(desc); ok {
+		return ioutil.NopCloser(bytes.NewReader(content)), nil
+	}
+	ctx, cancel := withTimeout(ctx, i.timeout)
+	defer cancel()
+	_, content, err := i.puller.fetchBlob(ctx, i.ref, desc)
 	if err != nil {
 		return nil, err
 	}
-
-	return fetcher.Fetch(ctx, desc)
+	return ioutil.NopCloser(bytes.NewReader(content)), nil
 }
@@ -0,0 +1,68 @@
+package pull
+
+import (
+	"context"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/solo-io/wasm/tools/wasme/pkg/config"
+	"github.com/solo-io/wasm/tools/wasme/pkg/model"
+)
+
+// ImageInspector describes images without pulling their module
+type ImageInspector interface {
+	// Inspect fetches the manifest and config of the image with the ref
+	Inspect(ctx context.Context, ref string) (*ImageInfo, error)
+}
+
+// ImageInfo describes an image by its manifest and config
+type ImageInfo struct {
+	// the full ref of the image
+	Ref string `json:"ref"`
+	// the descriptor of the manifest, including its digest. the manifest of the default variant of multi-variant images
+	Manifest ocispec.Descriptor `json:"manifest"`
+	// the descriptor of the index of multi-variant images, and their variants
+	Index    *ocispec.Descriptor `json:"index,omitempty"`
+	Variants []Variant           `json:"variants,omitempty"`
+	// the descriptor of the module layer, including the size of the module
+	Module ocispec.Descriptor `json:"module"`
+	// the config and layers of the manifest
+	Blobs []ocispec.Descriptor `json:"blobs"`
+	// the annotations of the manifest
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// the config of the image, including the ABI versions and root ids of the filter.
+	// the model.DefaultConfig if the image has no wasme config
+	Config *config.Runtime `json:"config"`
+	// false if the image has no wasme config, e.g. images published by other tools
+	HasConfig bool `json:"hasConfig"`
+}
+
+// Inspect only fetches the manifest and config of the image, or of the default variant of multi-variant images, from the blob store of the puller if they are stored in it
+func (p *puller) Inspect(ctx context.Context, ref string) (*ImageInfo, error) {
+	ctx, cancel := withTimeout(ctx, p.timeout)
+	defer cancel()
+	image, err := p.pull(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	module, err := image.Descriptor()
+	if err != nil {
+		return nil, errors.Wrapf(err, "image %v is not a wasm filter image", image.Ref())
+	}
+	cfg, err := image.FetchConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, noConfig := image.getDescriptor(model.ConfigMediaType)
+	return &ImageInfo{
+		Ref:         image.Ref(),
+		Manifest:    image.manifest,
+		Index:       image.index,
+		Variants:    image.variants,
+		Module:      module,
+		Blobs:       image.children,
+		Annotations: image.annotations,
+		Config:      cfg,
+		HasConfig:   noConfig == nil,
+	}, nil
+}
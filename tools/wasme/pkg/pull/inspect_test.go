@@ -0,0 +1,175 @@
+package pull_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/solo-io/wasm/tools/wasme/pkg/config"
+	"github.com/solo-io/wasm/tools/wasme/pkg/model"
+	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
+	"github.com/solo-io/wasm/tools/wasme/pkg/resolver"
+)
+
+var _ = Describe("Inspect", func() {
+	var (
+		registry *httptest.Server
+		// the blobs served by the registry, by digest
+		blobs map[digest.Digest][]byte
+		// the paths of the requests for blobs served by the registry
+		fetched []string
+		ref     string
+	)
+
+	module := []byte("\x00asm module")
+	moduleDesc := ocispec.Descriptor{MediaType: model.ContentMediaType, Digest: digest.FromBytes(module), Size: int64(len(module))}
+
+	// serves the manifest with the layers at user/filter:v1
+	serve := func(cfg ocispec.Descriptor, layers ...ocispec.Descriptor) ocispec.Descriptor {
+		manifestBytes, err := json.Marshal(ocispec.Manifest{
+			Versioned:   specs.Versioned{SchemaVersion: 2},
+			Config:      cfg,
+			Layers:      layers,
+			Annotations: map[string]string{"org.opencontainers.image.source": "github.com/user/filter"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		manifestDigest := digest.FromBytes(manifestBytes)
+		blobs[manifestDigest] = manifestBytes
+		registry = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var content []byte
+			switch r.URL.Path {
+			case "/v2/user/filter/manifests/v1", "/v2/user/filter/manifests/" + manifestDigest.String():
+				w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+				w.Header().Set("Docker-Content-Digest", manifestDigest.String())
+				content = manifestBytes
+			default:
+				blob, ok := blobs[digest.Digest(r.URL.Path[len("/v2/user/filter/blobs/"):])]
+				if !ok {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				fetched = append(fetched, r.URL.Path)
+				content = blob
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			if r.Method != http.MethodHead {
+				w.Write(content)
+			}
+		}))
+		serverUrl, err := url.Parse(registry.URL)
+		Expect(err).NotTo(HaveOccurred())
+		ref = serverUrl.Host + "/user/filter:v1"
+		return ocispec.Descriptor{MediaType: ocispec.MediaTypeImageManifest, Digest: manifestDigest, Size: int64(len(manifestBytes))}
+	}
+
+	wasmeConfig := func() ocispec.Descriptor {
+		cfgBytes, err := (&config.Runtime{
+			Type:        model.ConfigMediaType,
+			AbiVersions: []string{"v0-097b7f2e4cc1fb490cc1943d0d633655ac3c522f"},
+			Config:      &config.EnvoyConfig{RootIds: []string{"add_header"}},
+		}).ToBytes()
+		Expect(err).NotTo(HaveOccurred())
+		desc := ocispec.Descriptor{MediaType: model.ConfigMediaType, Digest: digest.FromBytes(cfgBytes), Size: int64(len(cfgBytes))}
+		blobs[desc.Digest] = cfgBytes
+		return desc
+	}
+
+	newPuller := func(store pull.BlobStore) pull.ImageInspector {
+		res, _, err := resolver.NewResolverWithOptions(
+			func(string) (string, string, error) { return "", "", nil },
+			resolver.RegistryOptions{PlainHTTPHosts: []string{resolver.AllHosts}},
+		)
+		Expect(err).NotTo(HaveOccurred())
+		return pull.NewPullerWithBlobStore(res, store)
+	}
+
+	BeforeEach(func() {
+		blobs = map[digest.Digest][]byte{moduleDesc.Digest: module}
+		fetched = nil
+	})
+
+	AfterEach(func() {
+		registry.Close()
+	})
+
+	It("describes the image by its manifest and config, without fetching the module", func() {
+		cfgDesc := wasmeConfig()
+		manifestDesc := serve(cfgDesc, cfgDesc, moduleDesc)
+
+		info, err := newPuller(nil).Inspect(context.TODO(), ref)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Ref).To(Equal(ref))
+		Expect(info.Manifest.Digest).To(Equal(manifestDesc.Digest))
+		Expect(info.Module).To(Equal(moduleDesc))
+		Expect(info.Blobs).To(Equal([]ocispec.Descriptor{cfgDesc, cfgDesc, moduleDesc}))
+		Expect(info.Annotations).To(HaveKeyWithValue("org.opencontainers.image.source", "github.com/user/filter"))
+		Expect(info.HasConfig).To(BeTrue())
+		Expect(info.Config.AbiVersions).To(Equal([]string{"v0-097b7f2e4cc1fb490cc1943d0d633655ac3c522f"}))
+		Expect(info.Config.Config.RootIds).To(Equal([]string{"add_header"}))
+		Expect(fetched).NotTo(ContainElement("/v2/user/filter/blobs/" + moduleDesc.Digest.String()))
+	})
+
+	It("reads the manifest and config from the blob store once they are stored", func() {
+		cfgDesc := wasmeConfig()
+		serve(cfgDesc, cfgDesc, moduleDesc)
+		store := &memoryBlobStore{blobs: map[digest.Digest][]byte{}}
+
+		_, err := newPuller(store).Inspect(context.TODO(), ref)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fetched).NotTo(BeEmpty())
+
+		fetched = nil
+		info, err := newPuller(store).Inspect(context.TODO(), ref)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Config.Config.RootIds).To(Equal([]string{"add_header"}))
+		Expect(fetched).To(BeEmpty())
+	})
+
+	It("describes images without a wasme config with the default config", func() {
+		cfgBytes := []byte("{}")
+		cfgDesc := ocispec.Descriptor{MediaType: "application/vnd.wasm.config.v0+json", Digest: digest.FromBytes(cfgBytes), Size: int64(len(cfgBytes))}
+		blobs[cfgDesc.Digest] = cfgBytes
+		layer := ocispec.Descriptor{MediaType: model.WasmContentMediaType, Digest: moduleDesc.Digest, Size: moduleDesc.Size}
+		serve(cfgDesc, layer)
+
+		info, err := newPuller(nil).Inspect(context.TODO(), ref)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Module).To(Equal(layer))
+		Expect(info.HasConfig).To(BeFalse())
+		Expect(info.Config).To(Equal(model.DefaultConfig()))
+	})
+})
+
+type memoryBlobStore struct {
+	lock  sync.Mutex
+	blobs map[digest.Digest][]byte
+}
+
+func (s *memoryBlobStore) Get(blobDigest digest.Digest) ([]byte, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	content, ok := s.blobs[blobDigest]
+	return content, ok, nil
+}
+
+func (s *memoryBlobStore) Put(blobDigest digest.Digest, content io.Reader) ([]byte, error) {
+	b, err := ioutil.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.blobs[blobDigest] = b
+	return b, nil
+}
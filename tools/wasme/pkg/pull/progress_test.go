@@ -0,0 +1,85 @@
+package pull_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/solo-io/wasm/tools/wasme/pkg/model"
+	"github.com/solo-io/wasm/tools/wasme/pkg/progress"
+	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
+	"github.com/solo-io/wasm/tools/wasme/pkg/resolver"
+)
+
+var _ = Describe("Progress", func() {
+	It("reports the progress of the fetches of every layer of the image", func() {
+		cfg := []byte(`{"type":"envoy_proxy","abi_versions":["v0-097b7f2e4cc1fb490cc1943d0d633655ac3c522f"]}`)
+		module := bytes.Repeat([]byte("\x00asm"), 200000)
+		cfgDesc := ocispec.Descriptor{MediaType: model.ConfigMediaType, Digest: digest.FromBytes(cfg), Size: int64(len(cfg))}
+		moduleDesc := ocispec.Descriptor{MediaType: model.ContentMediaType, Digest: digest.FromBytes(module), Size: int64(len(module))}
+		manifest, err := json.Marshal(ocispec.Manifest{Versioned: specs.Versioned{SchemaVersion: 2}, Config: cfgDesc, Layers: []ocispec.Descriptor{cfgDesc, moduleDesc}})
+		Expect(err).NotTo(HaveOccurred())
+		blobs := map[string][]byte{cfgDesc.Digest.String(): cfg, moduleDesc.Digest.String(): module}
+
+		registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			content, ok := blobs[strings.TrimPrefix(r.URL.Path, "/v2/user/filter/blobs/")]
+			if r.URL.Path == "/v2/user/filter/manifests/v1" || r.URL.Path == "/v2/user/filter/manifests/"+digest.FromBytes(manifest).String() {
+				w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+				w.Header().Set("Docker-Content-Digest", digest.FromBytes(manifest).String())
+				content, ok = manifest, true
+			}
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			if r.Method != http.MethodHead {
+				w.Write(content)
+			}
+		}))
+		defer registry.Close()
+		serverUrl, err := url.Parse(registry.URL)
+		Expect(err).NotTo(HaveOccurred())
+
+		var lock sync.Mutex
+		transferred := map[digest.Digest]int64{}
+		res, _, err := resolver.NewResolverWithOptions(
+			func(string) (string, string, error) { return "", "", nil },
+			resolver.RegistryOptions{PlainHTTPHosts: []string{resolver.AllHosts}},
+		)
+		Expect(err).NotTo(HaveOccurred())
+		puller := pull.NewPullerWithOptions(res, pull.Options{Progress: func(update progress.Update) {
+			lock.Lock()
+			defer lock.Unlock()
+			transferred[update.Descriptor.Digest] = update.Transferred
+		}})
+
+		image, err := puller.Pull(context.TODO(), serverUrl.Host+"/user/filter:v1")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = image.FetchConfig(context.TODO())
+		Expect(err).NotTo(HaveOccurred())
+		filter, err := image.FetchFilter(context.TODO())
+		Expect(err).NotTo(HaveOccurred())
+		_, err = ioutil.ReadAll(filter)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(transferred).To(Equal(map[digest.Digest]int64{cfgDesc.Digest: cfgDesc.Size, moduleDesc.Digest: moduleDesc.Size}))
+		var total int64
+		for _, bytes := range transferred {
+			total += bytes
+		}
+		Expect(total).To(Equal(int64(len(cfg) + len(module))))
+	})
+})
@@ -1,15 +1,24 @@
 package pull
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"time"
 
 	"github.com/solo-io/wasm/tools/wasme/pkg/util"
 
 	"github.com/solo-io/wasm/tools/wasme/pkg/model"
+	"github.com/solo-io/wasm/tools/wasme/pkg/progress"
 
 	"github.com/containerd/containerd/images"
 	"github.com/containerd/containerd/remotes"
 	"github.com/deislabs/oras/pkg/content"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -26,57 +35,245 @@ type ImagePuller interface {
 	Pull(ctx context.Context, ref string) (Image, error)
 }
 
+// ManifestImage is an image which knows the digest of its manifest, e.g. an image pulled from a registry.
+// the image can be pulled again by the digest, even if its tag is moved
+type ManifestImage interface {
+	Image
+	ManifestDigest() digest.Digest
+}
+
+// BlobImage is an image whose blobs can be fetched, e.g. to read images which are not wasm filters,
+// such as the signatures of an image
+type BlobImage interface {
+	ManifestImage
+	// the descriptors of the config and layers of the manifest of the image
+	Blobs() []ocispec.Descriptor
+	// fetches the content of a blob of the image
+	FetchBlob(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error)
+}
+
+// BlobStore stores the content of pulled images by digest, e.g. the blob store of the local image store.
+// the blobs of images may be fetched concurrently, so the store must be safe for concurrent use
+type BlobStore interface {
+	// returns the content of the blob, or false if it is not stored or its stored content does not match the digest
+	Get(blobDigest digest.Digest) ([]byte, bool, error)
+	// stores the content of the blob and returns it, if it matches the digest
+	Put(blobDigest digest.Digest, content io.Reader) ([]byte, error)
+}
+
 type puller struct {
 	resolver remotes.Resolver
+	// nil if every blob is fetched from the registry
+	blobs BlobStore
+	// zero if pulls do not time out
+	timeout time.Duration
+	// nil if the progress of fetches is not reported
+	progress progress.Func
+	// a token is held by each fetch of the blobs of the pulled images, bounding the concurrent fetches of all the pulls
+	fetches chan struct{}
+	// whether the blobs of images are fetched by the pull rather than when they are first read
+	prefetch bool
+}
+
+// the number of blobs fetched at once by a puller if Options.MaxConcurrentFetches is not set
+const DefaultMaxConcurrentFetches = 4
+
+// Options configure how a puller pulls images
+type Options struct {
+	// the store of the content of pulled images. if nil, every blob is fetched from the registry
+	BlobStore BlobStore
+	// if non-zero, the maximum length of time of each pull, and of each fetch of the content of a pulled image,
+	// including the retries of the requests to the registry
+	Timeout time.Duration
+	// if not nil, called with the progress of the fetches of the blobs of images from the registry
+	Progress progress.Func
+	// the maximum number of blobs fetched at once, across every image pulled by the puller.
+	// if not positive, DefaultMaxConcurrentFetches
+	MaxConcurrentFetches int
+	// if set, each pull fetches the config and layers of the image concurrently, rather than fetching each blob when
+	// it is first read, e.g. to cache every blob of the images. the prefetched blobs which are not written to the blob store
+	// are kept by the image until they are read once
+	Prefetch bool
 }
 
 func NewPuller(resolver remotes.Resolver) *puller {
+	return NewPullerWithOptions(resolver, Options{})
+}
+
+// NewPullerWithBlobStore returns a puller which only fetches the blobs of images which are missing from the blob store.
+// the registry is still used to resolve the refs of images to the digests of their manifests
+func NewPullerWithBlobStore(resolver remotes.Resolver, blobs BlobStore) *puller {
+	return NewPullerWithOptions(resolver, Options{BlobStore: blobs})
+}
+
+func NewPullerWithOptions(resolver remotes.Resolver, opts Options) *puller {
+	maxConcurrentFetches := opts.MaxConcurrentFetches
+	if maxConcurrentFetches <= 0 {
+		maxConcurrentFetches = DefaultMaxConcurrentFetches
+	}
 	return &puller{
 		resolver: resolver,
+		blobs:    opts.BlobStore,
+		timeout:  opts.Timeout,
+		progress: opts.Progress,
+		fetches:  make(chan struct{}, maxConcurrentFetches),
+		prefetch: opts.Prefetch,
 	}
 }
 
+// pulls the manifest of the image. its config and layers are fetched when they are first read,
+// or concurrently by the pull if the puller prefetches the blobs of images.
+// the failed requests to the registry are retried by the client of the resolver
 func (p *puller) Pull(ctx context.Context, ref string) (Image, error) {
-	var image Image
-	err := util.RetryOn500(func() error {
-		var err error
-		image, err = p.pull(ctx, ref)
-		return err
-	})
-	return image, err
+	ctx, cancel := withTimeout(ctx, p.timeout)
+	defer cancel()
+	image, err := p.pull(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if p.prefetch {
+		if err := p.fetchBlobs(ctx, image); err != nil {
+			return nil, err
+		}
+	}
+	return image, nil
 }
 
-func (p *puller) pull(ctx context.Context, ref string) (Image, error) {
-	ref, err := model.FullRef(ref)
+// pulls the manifest of the image, without fetching its config or layers.
+// if the ref references an index of variants, the manifest of the default variant is pulled
+func (p *puller) pull(ctx context.Context, ref string) (*pulledImage, error) {
+	ref, err := util.NormalizeImageRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	ref, err = model.FullRef(ref)
 	if err != nil {
 		return nil, err
 	}
 
-	store := content.NewMemoryStore()
-
-	name, manifest, err := p.resolver.Resolve(ctx, ref)
+	_, manifest, err := p.resolver.Resolve(ctx, ref)
 	if err != nil {
 		return nil, err
 	}
+	if !isIndex(manifest.MediaType) {
+		return p.pullManifest(ctx, ref, manifest)
+	}
 
-	fetcher, err := p.resolver.Fetcher(ctx, ref)
+	index, err := p.pullManifest(ctx, ref, manifest)
 	if err != nil {
 		return nil, err
 	}
-	_, err = remotes.FetchHandler(store, fetcher)(ctx, manifest)
+	variants, err := indexVariants(index)
 	if err != nil {
 		return nil, err
 	}
+	image, err := p.pullManifest(ctx, ref, variants[0].Manifest)
+	if err != nil {
+		return nil, errors.Wrapf(err, "pulling the default variant of %v", ref)
+	}
+	image.index = &manifest
+	image.variants = variants
+	return image, nil
+}
+
+// fetches the manifest, or index, with the descriptor from the blob store or the registry.
+// the children of an index are the descriptors of its manifests
+func (p *puller) pullManifest(ctx context.Context, ref string, manifest ocispec.Descriptor) (*pulledImage, error) {
+	store := content.NewMemoryStore()
+
+	if p.blobs == nil {
+		fetcher, err := p.resolver.Fetcher(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		_, err = remotes.FetchHandler(store, fetcher)(ctx, manifest)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		rc, err := fetchBlob(ctx, p.resolver, p.blobs, ref, manifest, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		manifestBytes, err := ioutil.ReadAll(rc)
+		if err != nil {
+			return nil, err
+		}
+		store.Set(manifest, manifestBytes)
+	}
 
 	children, err := images.ChildrenHandler(store)(ctx, manifest)
 	if err != nil {
 		return nil, err
 	}
-	logrus.Debugf("%+v %+v %+v %+v\n", name, children, manifest, err)
+	logrus.Debugf("%+v %+v %+v\n", ref, children, manifest)
+
+	annotations, err := manifestAnnotations(store, manifest)
+	if err != nil {
+		return nil, err
+	}
 
 	return &pulledImage{
-		children: children,
-		ref:      ref,
-		resolver: p.resolver,
+		children:    children,
+		manifest:    manifest,
+		annotations: annotations,
+		ref:         ref,
+		timeout:     p.timeout,
+		puller:      p,
 	}, nil
 }
+
+// returns the annotations of the manifest stored in the store
+func manifestAnnotations(store *content.Memorystore, desc ocispec.Descriptor) (map[string]string, error) {
+	_, manifestBytes, ok := store.Get(desc)
+	if !ok {
+		return nil, errors.Errorf("manifest %v was not fetched", desc.Digest)
+	}
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return nil, errors.Wrapf(err, "parsing manifest %v", desc.Digest)
+	}
+	return manifest.Annotations, nil
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// fetches the blob from the blob store, or from the registry if it is missing from the store or there is no store.
+// the progress of fetches from the registry is reported if report is not nil
+func fetchBlob(ctx context.Context, resolver remotes.Resolver, blobs BlobStore, ref string, desc ocispec.Descriptor, report progress.Func) (io.ReadCloser, error) {
+	if blobs != nil {
+		content, ok, err := blobs.Get(desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			logrus.Debugf("read blob %v of image %v from the blob store", desc.Digest, ref)
+			return ioutil.NopCloser(bytes.NewReader(content)), nil
+		}
+	}
+
+	fetcher, err := resolver.Fetcher(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := fetcher.Fetch(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	rc = progress.NewReader(rc, ref, desc, report)
+	if blobs == nil {
+		return rc, nil
+	}
+	defer rc.Close()
+	content, err := blobs.Put(desc.Digest, rc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "storing blob %v of image %v", desc.Digest, ref)
+	}
+	return ioutil.NopCloser(bytes.NewReader(content)), nil
+}
@@ -0,0 +1,13 @@
+package pull_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestPull(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Pull Suite")
+}
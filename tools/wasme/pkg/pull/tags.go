@@ -0,0 +1,200 @@
+package pull
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/docker/distribution/reference"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// the number of tags requested in each page of the tags of a repository.
+// registries may return fewer tags per page
+const DefaultTagsPageSize = 100
+
+// Lister lists the tags of the repositories of images
+type Lister interface {
+	// ListTags returns the tags of the repository, e.g. webassemblyhub.io/user/filter, in the order returned by the registry
+	ListTags(ctx context.Context, repository string) ([]string, error)
+}
+
+type lister struct {
+	hosts    docker.RegistryHosts
+	pageSize int
+}
+
+// NewLister returns a lister which lists tags with the tag listing API of the registry hosts,
+// e.g. the hosts of resolver.NewRegistryHostsWithOptions, requesting pages of pageSize tags.
+// uses DefaultTagsPageSize if pageSize is not positive
+func NewLister(hosts docker.RegistryHosts, pageSize int) *lister {
+	if pageSize <= 0 {
+		pageSize = DefaultTagsPageSize
+	}
+	return &lister{hosts: hosts, pageSize: pageSize}
+}
+
+type tagsPage struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
+
+// follows the Link header of each page to the next page.
+// registries which cap the size of pages without returning Link headers are asked for the tags after the last tag returned,
+// until they return no new tags
+func (l *lister) ListTags(ctx context.Context, repository string) ([]string, error) {
+	named, err := reference.ParseNormalizedNamed(repository)
+	if err != nil {
+		return nil, err
+	}
+	if !reference.IsNameOnly(named) {
+		return nil, errors.Errorf("%v is not a repository: it has a tag or digest", repository)
+	}
+	hosts, err := l.hosts(reference.Domain(named))
+	if err != nil {
+		return nil, err
+	}
+	if len(hosts) == 0 {
+		return nil, errors.Errorf("no hosts found for registry %v", reference.Domain(named))
+	}
+	host := hosts[0]
+
+	next := &url.URL{
+		Scheme:   host.Scheme,
+		Host:     host.Host,
+		Path:     host.Path + "/" + reference.Path(named) + "/tags/list",
+		RawQuery: url.Values{"n": []string{strconv.Itoa(l.pageSize)}}.Encode(),
+	}
+	var tags []string
+	seen := map[string]bool{}
+	// whether the registry returned a Link header, so the page without a Link header is the last page
+	var linked bool
+	for next != nil {
+		page, link, err := l.fetchPage(ctx, host, next)
+		if err != nil {
+			return nil, errors.Wrapf(err, "listing tags of %v", repository)
+		}
+		var added int
+		for _, tag := range page.Tags {
+			if seen[tag] {
+				continue
+			}
+			seen[tag] = true
+			tags = append(tags, tag)
+			added++
+		}
+		switch {
+		case added == 0:
+			next = nil
+		case link != nil:
+			linked = true
+			next = next.ResolveReference(link)
+		case linked:
+			next = nil
+		default:
+			next = withLastTag(next, page.Tags[len(page.Tags)-1])
+		}
+	}
+	return tags, nil
+}
+
+// returns the page, and the URL of the Link header of the next page if any
+func (l *lister) fetchPage(ctx context.Context, host docker.RegistryHost, pageUrl *url.URL) (*tagsPage, *url.URL, error) {
+	resp, err := l.do(ctx, host, pageUrl)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound && pageUrl.Query().Get("last") != "":
+		// registries which do not support the last parameter have no more tags
+		return &tagsPage{}, nil, nil
+	case resp.StatusCode != http.StatusOK:
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, nil, errors.Errorf("unexpected status %v: %v", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var page tagsPage
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, nil, errors.Wrap(err, "parsing tags")
+	}
+	link, err := nextLink(resp.Header.Get("Link"))
+	if err != nil {
+		return nil, nil, err
+	}
+	logrus.Debugf("listed %v tags of %v", len(page.Tags), page.Name)
+	return &page, link, nil
+}
+
+// sends the request, authorizing it again once the authorizer of the host has handled the auth challenge of the response
+func (l *lister) do(ctx context.Context, host docker.RegistryHost, pageUrl *url.URL) (*http.Response, error) {
+	client := host.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	var resp *http.Response
+	for attempt := 0; attempt < 2; attempt++ {
+		req, err := http.NewRequest(http.MethodGet, pageUrl.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Accept", "application/json")
+		if host.Authorizer != nil {
+			if err := host.Authorizer.Authorize(ctx, req); err != nil {
+				return nil, err
+			}
+		}
+		resp, err = client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || host.Authorizer == nil || attempt > 0 {
+			break
+		}
+		err = host.Authorizer.AddResponses(ctx, []*http.Response{resp})
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// parses the URL of the rel="next" link of a Link header, e.g. </v2/user/filter/tags/list?n=100&last=v1>; rel="next"
+func nextLink(header string) (*url.URL, error) {
+	for _, link := range strings.Split(header, ",") {
+		parts := strings.Split(link, ";")
+		target := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		for _, param := range parts[1:] {
+			if strings.ReplaceAll(strings.TrimSpace(param), " ", "") != `rel="next"` {
+				continue
+			}
+			next, err := url.Parse(strings.TrimSuffix(strings.TrimPrefix(target, "<"), ">"))
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid Link header %q", header)
+			}
+			return next, nil
+		}
+	}
+	return nil, nil
+}
+
+func withLastTag(pageUrl *url.URL, last string) *url.URL {
+	next := *pageUrl
+	query := next.Query()
+	query.Set("last", last)
+	next.RawQuery = query.Encode()
+	return &next
+}
@@ -0,0 +1,107 @@
+package pull_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
+	"github.com/solo-io/wasm/tools/wasme/pkg/resolver"
+)
+
+var _ = Describe("Lister", func() {
+	var (
+		registry *httptest.Server
+		tags     []string
+		// the maximum number of tags per page, regardless of the requested number
+		maxPageSize int
+		// whether the registry returns a Link header for the next page
+		links bool
+		// the queries of the requests for tags authorized by the registry
+		queries []string
+	)
+
+	BeforeEach(func() {
+		tags = nil
+		for i := 0; i < 25; i++ {
+			tags = append(tags, "v"+strconv.Itoa(i))
+		}
+		sort.Strings(tags)
+		maxPageSize = 1000
+		links = true
+		queries = nil
+
+		registry = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/v2/user/filter/tags/list" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "password" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			queries = append(queries, r.URL.RawQuery)
+
+			n := maxPageSize
+			if requested, err := strconv.Atoi(r.URL.Query().Get("n")); err == nil && requested < n {
+				n = requested
+			}
+			start := sort.SearchStrings(tags, r.URL.Query().Get("last"))
+			if last := r.URL.Query().Get("last"); start < len(tags) && tags[start] == last {
+				start++
+			}
+			end := start + n
+			if end > len(tags) {
+				end = len(tags)
+			}
+			if links && end < len(tags) {
+				w.Header().Set("Link", `</v2/user/filter/tags/list?last=`+tags[end-1]+`&n=`+strconv.Itoa(n)+`>; rel="next"`)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"name": "user/filter", "tags": tags[start:end]})
+		}))
+	})
+
+	AfterEach(func() {
+		registry.Close()
+	})
+
+	listTags := func(pageSize int) ([]string, error) {
+		hosts, err := resolver.NewRegistryHostsWithOptions(
+			func(string) (string, string, error) { return "user", "password", nil },
+			resolver.RegistryOptions{PlainHTTPHosts: []string{resolver.AllHosts}},
+		)
+		Expect(err).NotTo(HaveOccurred())
+		serverUrl, err := url.Parse(registry.URL)
+		Expect(err).NotTo(HaveOccurred())
+		return pull.NewLister(hosts, pageSize).ListTags(context.TODO(), serverUrl.Host+"/user/filter")
+	}
+
+	It("lists the tags of every page with the credentials of the registry", func() {
+		listed, err := listTags(10)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(listed).To(Equal(tags))
+		Expect(queries).To(Equal([]string{"n=10", "last=" + tags[9] + "&n=10", "last=" + tags[19] + "&n=10"}))
+	})
+
+	It("lists the tags of registries which cap the size of pages without a Link header", func() {
+		maxPageSize = 7
+		links = false
+		listed, err := listTags(10)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(listed).To(Equal(tags))
+	})
+
+	It("lists the tags of repositories only", func() {
+		_, err := listTags(10)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = pull.NewLister(nil, 0).ListTags(context.TODO(), "webassemblyhub.io/user/filter:v1")
+		Expect(err).To(MatchError(ContainSubstring("is not a repository")))
+	})
+})
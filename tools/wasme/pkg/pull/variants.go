@@ -0,0 +1,105 @@
+package pull
+
+import (
+	"context"
+	"strings"
+
+	"github.com/containerd/containerd/images"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/solo-io/wasm/tools/wasme/pkg/model"
+)
+
+// Variant is a manifest of the index of a multi-variant image, e.g. the build of a filter for some ABI versions
+type Variant struct {
+	// the descriptor of the manifest of the variant in the index
+	Manifest ocispec.Descriptor `json:"manifest"`
+	// the ABI versions of the variant, from the model.AbiVersionAnnotation of its descriptor
+	AbiVersions []string `json:"abiVersions,omitempty"`
+}
+
+// VariantImage is an image whose ref may reference an index of variants of the image,
+// e.g. the builds of the same filter for different ABI versions, pushed with push.Pusher.PushVariants.
+// the config and module of a multi-variant image are those of its default variant, the first variant of the index,
+// and its manifest digest is the digest of the index
+type VariantImage interface {
+	ManifestImage
+	// the variants of the index, in the order of the index. empty if the ref of the image references a single manifest
+	Variants() []Variant
+	// SelectVariant pulls the first variant whose ABI versions are supported, fetching its config and layers.
+	// the manifest digest of the returned image is the digest of the variant, so the variant can be pulled by its digest.
+	// returns the image itself if it has no variants, and fails if no variant is supported
+	SelectVariant(ctx context.Context, supported func(abiVersions []string) bool) (ManifestImage, error)
+}
+
+func isIndex(mediaType string) bool {
+	return mediaType == ocispec.MediaTypeImageIndex || mediaType == images.MediaTypeDockerSchema2ManifestList
+}
+
+// the children of the index are its manifests
+func indexVariants(index *pulledImage) ([]Variant, error) {
+	if len(index.children) == 0 {
+		return nil, errors.Errorf("the index of image %v has no manifests", index.ref)
+	}
+	var variants []Variant
+	for _, manifest := range index.children {
+		variants = append(variants, Variant{
+			Manifest:    manifest,
+			AbiVersions: splitAbiVersions(manifest.Annotations[model.AbiVersionAnnotation]),
+		})
+	}
+	return variants, nil
+}
+
+func splitAbiVersions(annotation string) []string {
+	var abiVersions []string
+	for _, abiVersion := range strings.Split(annotation, ",") {
+		if abiVersion = strings.TrimSpace(abiVersion); abiVersion != "" {
+			abiVersions = append(abiVersions, abiVersion)
+		}
+	}
+	return abiVersions
+}
+
+func (i *pulledImage) Variants() []Variant {
+	return i.variants
+}
+
+func (i *pulledImage) SelectVariant(ctx context.Context, supported func(abiVersions []string) bool) (ManifestImage, error) {
+	if i.index == nil {
+		return i, nil
+	}
+	for _, variant := range i.variants {
+		if !supported(variant.AbiVersions) {
+			continue
+		}
+		if variant.Manifest.Digest == i.manifest.Digest {
+			return &pulledImage{
+				children:    i.children,
+				manifest:    i.manifest,
+				annotations: i.annotations,
+				ref:         i.ref,
+				timeout:     i.timeout,
+				puller:      i.puller,
+				prefetched:  i.takeAllPrefetched(),
+			}, nil
+		}
+		ctx, cancel := withTimeout(ctx, i.timeout)
+		defer cancel()
+		image, err := i.puller.pullManifest(ctx, i.ref, variant.Manifest)
+		if err != nil {
+			return nil, errors.Wrapf(err, "pulling variant %v of %v", variant.Manifest.Digest, i.ref)
+		}
+		if i.puller.prefetch {
+			if err := i.puller.fetchBlobs(ctx, image); err != nil {
+				return nil, err
+			}
+		}
+		return image, nil
+	}
+	var abiVersions []string
+	for _, variant := range i.variants {
+		abiVersions = append(abiVersions, "["+strings.Join(variant.AbiVersions, ", ")+"]")
+	}
+	return nil, errors.Errorf("no variant of image %v is supported, the variants have the abi versions %v", i.ref, strings.Join(abiVersions, ", "))
+}
@@ -0,0 +1,208 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/remotes"
+	"github.com/docker/distribution/reference"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/solo-io/wasm/tools/wasme/pkg/progress"
+)
+
+// the label of descriptors which lists the repositories of a registry host the blob can be mounted from
+const distributionSourceLabel = "containerd.io/distribution.source."
+
+// Copier copies images between repositories and registries without writing their module to a local file.
+// the manifest of the image is pushed unchanged, so the copied image has the digest of the source image
+type Copier interface {
+	// Copy copies the manifest, config and layers of the image with the src ref to the dst ref, which may be in another registry.
+	// blobs which exist in the destination repository are not copied, and blobs in another repository of the same registry are mounted
+	Copy(ctx context.Context, src, dst string) (ocispec.Descriptor, error)
+	// Tag pushes the manifest of the image with the src ref to the dst ref, which must be in the repository of the src ref
+	Tag(ctx context.Context, src, dst string) (ocispec.Descriptor, error)
+}
+
+type copier struct {
+	resolver remotes.Resolver
+	// nil if the progress of copies is not reported
+	progress progress.Func
+}
+
+// NewCopier returns a copier which fetches and pushes images with the resolver,
+// reporting the progress of the copies of blobs if report is not nil
+func NewCopier(resolver remotes.Resolver, report progress.Func) *copier {
+	return &copier{resolver: resolver, progress: report}
+}
+
+func (c *copier) Copy(ctx context.Context, src, dst string) (ocispec.Descriptor, error) {
+	srcNamed, dstNamed, err := parseRefs(src, dst)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	fetcher, desc, manifestBytes, err := c.fetchManifest(ctx, src)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return ocispec.Descriptor{}, errors.Wrapf(err, "parsing the manifest of %v", src)
+	}
+	pusher, err := c.resolver.Pusher(ctx, dst)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	copied := map[digest.Digest]bool{}
+	for _, blob := range append([]ocispec.Descriptor{manifest.Config}, manifest.Layers...) {
+		if copied[blob.Digest] {
+			continue
+		}
+		copied[blob.Digest] = true
+		if reference.Domain(srcNamed) == reference.Domain(dstNamed) {
+			blob = withMountSource(blob, srcNamed)
+		}
+		if err := c.copyBlob(ctx, fetcher, pusher, dst, blob); err != nil {
+			return ocispec.Descriptor{}, errors.Wrapf(err, "copying blob %v of image %v", blob.Digest, src)
+		}
+	}
+
+	if err := pushContent(ctx, pusher, dst, desc, manifestBytes, nil); err != nil {
+		return ocispec.Descriptor{}, errors.Wrapf(err, "pushing the manifest of %v", dst)
+	}
+	logrus.Infof("Copied %v to %v", src, dst)
+	return desc, nil
+}
+
+func (c *copier) Tag(ctx context.Context, src, dst string) (ocispec.Descriptor, error) {
+	srcNamed, dstNamed, err := parseRefs(src, dst)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if srcNamed.Name() != dstNamed.Name() {
+		return ocispec.Descriptor{}, errors.Errorf("%v is not in the repository of %v, images can only be copied to other repositories", dst, src)
+	}
+	_, desc, manifestBytes, err := c.fetchManifest(ctx, src)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	pusher, err := c.resolver.Pusher(ctx, dst)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if err := pushContent(ctx, pusher, dst, desc, manifestBytes, nil); err != nil {
+		return ocispec.Descriptor{}, errors.Wrapf(err, "pushing the manifest of %v", dst)
+	}
+	logrus.Infof("Tagged %v as %v", src, dst)
+	return desc, nil
+}
+
+// the refs must be full refs with a tag or digest, see model.FullRef
+func parseRefs(src, dst string) (reference.Named, reference.Named, error) {
+	srcNamed, err := reference.ParseNormalizedNamed(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	dstNamed, err := reference.ParseNormalizedNamed(dst)
+	if err != nil {
+		return nil, nil, err
+	}
+	if reference.IsNameOnly(dstNamed) {
+		return nil, nil, errors.Errorf("%v has no tag or digest", dst)
+	}
+	return srcNamed, dstNamed, nil
+}
+
+// returns the fetcher of the source image, and the descriptor and bytes of its manifest.
+// the returned bytes are verified against the digest of the descriptor
+func (c *copier) fetchManifest(ctx context.Context, ref string) (remotes.Fetcher, ocispec.Descriptor, []byte, error) {
+	name, desc, err := c.resolver.Resolve(ctx, ref)
+	if err != nil {
+		return nil, ocispec.Descriptor{}, nil, errors.Wrapf(err, "resolving %v", ref)
+	}
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageManifest, images.MediaTypeDockerSchema2Manifest:
+	default:
+		return nil, ocispec.Descriptor{}, nil, errors.Errorf("%v has the unsupported media type %v, only image manifests can be copied", ref, desc.MediaType)
+	}
+	fetcher, err := c.resolver.Fetcher(ctx, name)
+	if err != nil {
+		return nil, ocispec.Descriptor{}, nil, err
+	}
+	rc, err := fetcher.Fetch(ctx, desc)
+	if err != nil {
+		return nil, ocispec.Descriptor{}, nil, errors.Wrapf(err, "fetching the manifest of %v", ref)
+	}
+	defer rc.Close()
+	manifestBytes, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, ocispec.Descriptor{}, nil, errors.Wrapf(err, "fetching the manifest of %v", ref)
+	}
+	if actual := digest.FromBytes(manifestBytes); actual != desc.Digest {
+		return nil, ocispec.Descriptor{}, nil, errors.Errorf("the manifest of %v has digest %v, expected %v", ref, actual, desc.Digest)
+	}
+	return fetcher, desc, manifestBytes, nil
+}
+
+// streams the blob from the fetcher to the pusher.
+// the pusher skips blobs which exist in the destination, or which it mounted from the mount source of the blob
+func (c *copier) copyBlob(ctx context.Context, fetcher remotes.Fetcher, pusher remotes.Pusher, dst string, blob ocispec.Descriptor) error {
+	w, err := pusher.Push(ctx, blob)
+	if errdefs.IsAlreadyExists(err) {
+		logrus.Debugf("blob %v exists in %v or was mounted", blob.Digest, dst)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	rc, err := fetcher.Fetch(ctx, blob)
+	if err != nil {
+		return err
+	}
+	rc = progress.NewReader(rc, dst, blob, c.progress)
+	defer rc.Close()
+	return content.Copy(ctx, w, rc, blob.Size, blob.Digest)
+}
+
+// pushes the content with the descriptor, e.g. a manifest pushed unchanged, so its digest is preserved.
+// the progress of the push is reported if report is not nil
+func pushContent(ctx context.Context, pusher remotes.Pusher, ref string, desc ocispec.Descriptor, b []byte, report progress.Func) error {
+	w, err := pusher.Push(ctx, desc)
+	if errdefs.IsAlreadyExists(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	rc := progress.NewReader(ioutil.NopCloser(bytes.NewReader(b)), ref, desc, report)
+	return content.Copy(ctx, w, rc, desc.Size, desc.Digest)
+}
+
+// labels the blob with the repository of the source image, so the pusher mounts it into the destination repository
+// rather than uploading it, if the registry supports cross-repository mounts
+func withMountSource(blob ocispec.Descriptor, src reference.Named) ocispec.Descriptor {
+	annotations := map[string]string{}
+	for key, value := range blob.Annotations {
+		annotations[key] = value
+	}
+	// the pusher looks up the label of the host name of the destination, without its port
+	host := reference.Domain(src)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	annotations[distributionSourceLabel+host] = reference.Path(src)
+	blob.Annotations = annotations
+	return blob
+}
@@ -0,0 +1,261 @@
+package push_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/solo-io/wasm/tools/wasme/pkg/model"
+	"github.com/solo-io/wasm/tools/wasme/pkg/push"
+	"github.com/solo-io/wasm/tools/wasme/pkg/resolver"
+)
+
+// a registry which stores the manifests and blobs pushed to its repositories, and mounts blobs between its repositories
+type testRegistry struct {
+	*httptest.Server
+
+	lock sync.Mutex
+	// the manifests and blobs of each repository, by tag or digest and by digest
+	manifests map[string]map[string][]byte
+	blobs     map[string]map[digest.Digest][]byte
+	// the media types of the pushed manifests, by digest. the other manifests are image manifests
+	mediaTypes map[digest.Digest]string
+	uploads    int
+	// the requests served, e.g. "GET blobs", "PUT manifests" or "POST mount"
+	requests map[string]int
+}
+
+func newTestRegistry() *testRegistry {
+	r := &testRegistry{manifests: map[string]map[string][]byte{}, blobs: map[string]map[digest.Digest][]byte{}, mediaTypes: map[digest.Digest]string{}, requests: map[string]int{}}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	return r
+}
+
+func (r *testRegistry) host() string {
+	serverUrl, err := url.Parse(r.URL)
+	if err != nil {
+		panic(err)
+	}
+	return serverUrl.Host
+}
+
+// adds an image with a config and module layer to the repository, returning the bytes of its manifest
+func (r *testRegistry) addImage(repository, tag string) []byte {
+	cfg := []byte(`{"type":"envoy_proxy","abiVersions":["v0-097b7f2e4cc1fb490cc1943d0d633655ac3c522f"],"config":{"rootIds":["filter"]}}`)
+	module := []byte("\x00asm module of " + repository)
+	cfgDesc := ocispec.Descriptor{MediaType: model.ConfigMediaType, Digest: digest.FromBytes(cfg), Size: int64(len(cfg))}
+	moduleDesc := ocispec.Descriptor{MediaType: model.ContentMediaType, Digest: digest.FromBytes(module), Size: int64(len(module))}
+	manifest, err := json.Marshal(ocispec.Manifest{
+		Versioned:   specs.Versioned{SchemaVersion: 2},
+		Config:      cfgDesc,
+		Layers:      []ocispec.Descriptor{cfgDesc, moduleDesc},
+		Annotations: map[string]string{push.ManifestAnnotation_AbiVersion: "v0-097b7f2e4cc1fb490cc1943d0d633655ac3c522f"},
+	})
+	if err != nil {
+		panic(err)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.putBlob(repository, cfg)
+	r.putBlob(repository, module)
+	r.putManifest(repository, tag, manifest)
+	return manifest
+}
+
+func (r *testRegistry) putBlob(repository string, blob []byte) {
+	if r.blobs[repository] == nil {
+		r.blobs[repository] = map[digest.Digest][]byte{}
+	}
+	r.blobs[repository][digest.FromBytes(blob)] = blob
+}
+
+func (r *testRegistry) putManifest(repository, tag string, manifest []byte) {
+	if r.manifests[repository] == nil {
+		r.manifests[repository] = map[string][]byte{}
+	}
+	r.manifests[repository][tag] = manifest
+	r.manifests[repository][digest.FromBytes(manifest).String()] = manifest
+}
+
+func (r *testRegistry) manifest(repository, tag string) []byte {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.manifests[repository][tag]
+}
+
+func (r *testRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	switch {
+	case strings.Contains(path, "/blobs/uploads/"):
+		i := strings.Index(path, "/blobs/uploads/")
+		repository := path[:i]
+		if req.Method == http.MethodPost {
+			if mount := req.URL.Query().Get("mount"); mount != "" {
+				r.requests["POST mount"]++
+				if blob, ok := r.blobs[req.URL.Query().Get("from")][digest.Digest(mount)]; ok {
+					r.putBlob(repository, blob)
+					w.WriteHeader(http.StatusCreated)
+					return
+				}
+			}
+			r.requests["POST uploads"]++
+			r.uploads++
+			w.Header().Set("Location", "/v2/"+repository+"/blobs/uploads/"+strconv.Itoa(r.uploads))
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		r.requests["PUT uploads"]++
+		blob, err := ioutil.ReadAll(req.Body)
+		if err != nil || digest.FromBytes(blob).String() != req.URL.Query().Get("digest") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.putBlob(repository, blob)
+		w.Header().Set("Docker-Content-Digest", digest.FromBytes(blob).String())
+		w.WriteHeader(http.StatusCreated)
+	case strings.Contains(path, "/manifests/"):
+		i := strings.Index(path, "/manifests/")
+		repository, tag := path[:i], path[i+len("/manifests/"):]
+		r.requests[req.Method+" manifests"]++
+		if req.Method == http.MethodPut {
+			manifest, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			r.putManifest(repository, tag, manifest)
+			r.mediaTypes[digest.FromBytes(manifest)] = req.Header.Get("Content-Type")
+			w.Header().Set("Docker-Content-Digest", digest.FromBytes(manifest).String())
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		manifest, ok := r.manifests[repository][tag]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		mediaType, ok := r.mediaTypes[digest.FromBytes(manifest)]
+		if !ok {
+			mediaType = ocispec.MediaTypeImageManifest
+		}
+		w.Header().Set("Content-Type", mediaType)
+		w.Header().Set("Docker-Content-Digest", digest.FromBytes(manifest).String())
+		w.Header().Set("Content-Length", strconv.Itoa(len(manifest)))
+		if req.Method != http.MethodHead {
+			w.Write(manifest)
+		}
+	case strings.Contains(path, "/blobs/"):
+		i := strings.Index(path, "/blobs/")
+		repository, dgst := path[:i], digest.Digest(path[i+len("/blobs/"):])
+		r.requests[req.Method+" blobs"]++
+		blob, ok := r.blobs[repository][dgst]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(blob)))
+		if req.Method != http.MethodHead {
+			w.Write(blob)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+var _ = Describe("Copier", func() {
+	var (
+		src, dst *testRegistry
+		copier   push.Copier
+	)
+
+	BeforeEach(func() {
+		src = newTestRegistry()
+		dst = newTestRegistry()
+		res, _, err := resolver.NewResolverWithOptions(
+			func(string) (string, string, error) { return "", "", nil },
+			resolver.RegistryOptions{PlainHTTPHosts: []string{resolver.AllHosts}},
+		)
+		Expect(err).NotTo(HaveOccurred())
+		copier = push.NewCopier(res, nil)
+	})
+
+	AfterEach(func() {
+		src.Close()
+		dst.Close()
+	})
+
+	It("copies the manifest and blobs of an image to another registry, preserving its digest", func() {
+		manifest := src.addImage("user/filter", "v1")
+
+		desc, err := copier.Copy(context.TODO(), src.host()+"/user/filter:v1", dst.host()+"/other/filter:v2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(desc.Digest).To(Equal(digest.FromBytes(manifest)))
+
+		Expect(dst.manifest("other/filter", "v2")).To(Equal(manifest))
+		Expect(dst.blobs["other/filter"]).To(Equal(src.blobs["user/filter"]))
+		// the config layer is the config of the manifest, and is uploaded once
+		Expect(dst.requests["PUT uploads"]).To(Equal(2))
+		Expect(src.requests["GET blobs"]).To(Equal(2))
+	})
+
+	It("does not copy the blobs which exist in the destination repository", func() {
+		src.addImage("user/filter", "v1")
+		dst.addImage("user/filter", "v0")
+
+		_, err := copier.Copy(context.TODO(), src.host()+"/user/filter:v1", dst.host()+"/user/filter:v1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dst.manifest("user/filter", "v1")).To(Equal(src.manifest("user/filter", "v1")))
+		Expect(dst.requests["PUT uploads"]).To(BeZero())
+		Expect(src.requests["GET blobs"]).To(BeZero())
+	})
+
+	It("mounts the blobs of repositories of the same registry", func() {
+		manifest := src.addImage("user/filter", "v1")
+
+		_, err := copier.Copy(context.TODO(), src.host()+"/user/filter:v1", src.host()+"/other/filter:v1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(src.manifest("other/filter", "v1")).To(Equal(manifest))
+		Expect(src.blobs["other/filter"]).To(Equal(src.blobs["user/filter"]))
+		Expect(src.requests["POST mount"]).To(Equal(2))
+		Expect(src.requests["GET blobs"]).To(BeZero())
+		Expect(src.requests["PUT uploads"]).To(BeZero())
+	})
+
+	It("tags an image by pushing only its manifest", func() {
+		manifest := src.addImage("user/filter", "v1")
+
+		desc, err := copier.Tag(context.TODO(), src.host()+"/user/filter:v1", src.host()+"/user/filter:latest")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(desc.Digest).To(Equal(digest.FromBytes(manifest)))
+		Expect(src.manifest("user/filter", "latest")).To(Equal(manifest))
+		Expect(src.requests["PUT manifests"]).To(Equal(1))
+		Expect(src.requests["GET blobs"] + src.requests["HEAD blobs"] + src.requests["POST uploads"]).To(BeZero())
+	})
+
+	It("does not tag images in other repositories", func() {
+		src.addImage("user/filter", "v1")
+
+		_, err := copier.Tag(context.TODO(), src.host()+"/user/filter:v1", src.host()+"/other/filter:v1")
+		Expect(err).To(MatchError(ContainSubstring("is not in the repository of")))
+		Expect(src.requests["PUT manifests"]).To(BeZero())
+	})
+
+	It("fails to copy images which do not exist", func() {
+		_, err := copier.Copy(context.TODO(), src.host()+"/user/missing:v1", dst.host()+"/user/missing:v1")
+		Expect(err).To(MatchError(ContainSubstring("resolving")))
+	})
+})
@@ -3,8 +3,6 @@ package push
 import (
 	"context"
 	"io/ioutil"
-	"net/http"
-	"net/url"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -14,13 +12,13 @@ import (
 
 	"github.com/sirupsen/logrus"
 
-	"github.com/containerd/containerd/reference"
 	"github.com/containerd/containerd/remotes"
 	"github.com/containerd/containerd/remotes/docker"
 	"github.com/deislabs/oras/pkg/content"
 	"github.com/deislabs/oras/pkg/oras"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/solo-io/wasm/tools/wasme/pkg/model"
+	"github.com/solo-io/wasm/tools/wasme/pkg/progress"
 )
 
 type Image = model.Image
@@ -32,12 +30,29 @@ type Pusher interface {
 type pusher struct {
 	resolver   remotes.Resolver
 	authorizer docker.Authorizer
+	// empty if images are pushed in the format they record
+	format model.Format
+	// nil if the progress of pushes is not reported
+	progress progress.Func
+}
+
+// Options configure how a pusher pushes images
+type Options struct {
+	// the format the images are pushed in.
+	// if empty, images are pushed in the format they record, see model.ImageFormat
+	Format model.Format
+	// if not nil, called with the progress of the pushes of the config and module of images
+	Progress progress.Func
 }
 
 func NewPusher(resolver remotes.Resolver, authorizer docker.Authorizer) *pusher {
 	return &pusher{resolver: resolver, authorizer: authorizer}
 }
 
+func NewPusherWithOptions(resolver remotes.Resolver, authorizer docker.Authorizer, opts Options) *pusher {
+	return &pusher{resolver: resolver, authorizer: authorizer, format: opts.Format, progress: opts.Progress}
+}
+
 func (p *pusher) Push(ctx context.Context, image Image) error {
 	return util.RetryOn500(func() error {
 		return p.push(ctx, image)
@@ -73,14 +88,18 @@ func (p *pusher) push(ctx context.Context, image Image) error {
 
 	filterDescriptor := store.Add(model.CodeFilename, model.ContentMediaType, filterBytes)
 
-	files := []ocispec.Descriptor{
-		cfgDescriptor,
-		filterDescriptor,
+	format := p.format
+	if format == "" {
+		format = model.ImageFormat(image)
+	}
+	files, err := ManifestLayers(format, cfgDescriptor, filterDescriptor)
+	if err != nil {
+		return err
 	}
 
 	annotations := ManifestAnnotations(cfg)
 
-	imageDesciptor, err := oras.Push(ctx, p.resolver, image.Ref(), store, files,
+	imageDesciptor, err := oras.Push(ctx, p.resolver, image.Ref(), progress.NewProvider(store, image.Ref(), p.progress), files,
 		oras.WithConfig(cfgDescriptor),
 		oras.WithManifestAnnotations(annotations),
 	)
@@ -88,36 +107,37 @@ func (p *pusher) push(ctx context.Context, image Image) error {
 		return errors.Wrap(err, "oras push failed")
 	}
 
-	logrus.Infof("Pushed %v", image.Ref())
+	logrus.Infof("Pushed %v in the %v format", image.Ref(), format)
 	logrus.Infof("Digest: %v", imageDesciptor.Digest)
 
 	return err
 }
 
+// ManifestLayers returns the layers of the manifest of an image pushed in the format
+func ManifestLayers(format model.Format, cfgDescriptor, filterDescriptor ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+	switch format {
+	case model.FormatWasme:
+		return []ocispec.Descriptor{cfgDescriptor, filterDescriptor}, nil
+	case model.FormatCompat:
+		return []ocispec.Descriptor{filterDescriptor}, nil
+	}
+	return nil, errors.Errorf("unknown image format %v", format)
+}
+
+// resolving the ref adds the auth challenge of the registry to the authorizer, so the requests of the push are authorized.
+// the ref is resolved with the connection settings of the resolver, e.g. plain HTTP or a custom CA.
+// fails to resolve if the ref has not been pushed yet
 func (p *pusher) checkAuth(ctx context.Context, ref string) {
 	if p.authorizer == nil {
 		return
 	}
-	refspec, err := reference.Parse(ref)
-	if err != nil {
-		return
-	}
-	url := url.URL{
-		Host:   refspec.Hostname(),
-		Path:   "/v2/",
-		Scheme: "https",
-	}
-	if strings.HasPrefix(url.Host, "localhost:") || url.Host == "localhost" {
-		url.Scheme = "http"
-	}
-	resp, err := http.Get(url.String())
-	if resp != nil && resp.StatusCode == http.StatusUnauthorized {
-		p.authorizer.AddResponses(ctx, []*http.Response{resp})
+	if _, _, err := p.resolver.Resolve(ctx, ref); err != nil {
+		logrus.Debugf("resolving %v before the push: %v", ref, err)
 	}
 }
 
 const (
-	ManifestAnnotation_AbiVersion = "module.wasm.runtime/abi_version"
+	ManifestAnnotation_AbiVersion = model.AbiVersionAnnotation
 	ManifestAnnotation_Type       = "module.wasm.runtime/type"
 )
 
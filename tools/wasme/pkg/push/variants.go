@@ -0,0 +1,159 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	"github.com/deislabs/oras/pkg/content"
+	"github.com/docker/distribution/reference"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/solo-io/wasm/tools/wasme/pkg/model"
+	"github.com/solo-io/wasm/tools/wasme/pkg/util"
+)
+
+// VariantPusher pushes multi-variant images, whose tag references the builds of the same filter for different ABI versions
+type VariantPusher interface {
+	// PushVariants pushes each image by the digest of its manifest, then pushes an index of the manifests with the ref.
+	// the descriptor of each manifest in the index is annotated with the ABI versions of the config of the image.
+	// the first image is the default variant, pulled by the clients which do not select a variant.
+	// returns the descriptor of the index
+	PushVariants(ctx context.Context, ref string, variants []Image) (ocispec.Descriptor, error)
+}
+
+func (p *pusher) PushVariants(ctx context.Context, ref string, variants []Image) (ocispec.Descriptor, error) {
+	if len(variants) == 0 {
+		return ocispec.Descriptor{}, errors.Errorf("no variants of %v to push", ref)
+	}
+	var index ocispec.Descriptor
+	err := util.RetryOn500(func() error {
+		var err error
+		index, err = p.pushVariants(ctx, ref, variants)
+		return err
+	})
+	return index, err
+}
+
+func (p *pusher) pushVariants(ctx context.Context, ref string, variants []Image) (ocispec.Descriptor, error) {
+	p.checkAuth(ctx, ref)
+
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	var manifests []ocispec.Descriptor
+	for i, image := range variants {
+		manifest, err := p.pushVariant(ctx, named, image)
+		if err != nil {
+			return ocispec.Descriptor{}, errors.Wrapf(err, "pushing variant %v of %v", i, ref)
+		}
+		manifests = append(manifests, manifest)
+	}
+
+	indexBytes, err := json.Marshal(ocispec.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Manifests: manifests,
+	})
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	index := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageIndex,
+		Digest:    digest.FromBytes(indexBytes),
+		Size:      int64(len(indexBytes)),
+	}
+	pusher, err := p.resolver.Pusher(ctx, ref)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if err := pushContent(ctx, pusher, ref, index, indexBytes, nil); err != nil {
+		return ocispec.Descriptor{}, errors.Wrapf(err, "pushing the index of %v", ref)
+	}
+
+	logrus.Infof("Pushed %v with %v variants", ref, len(manifests))
+	logrus.Infof("Digest: %v", index.Digest)
+	return index, nil
+}
+
+// pushes the config and module of the image, then its manifest by its digest.
+// returns the descriptor of the manifest, annotated with the ABI versions of the image
+func (p *pusher) pushVariant(ctx context.Context, named reference.Named, image Image) (ocispec.Descriptor, error) {
+	store := content.NewMemoryStore()
+
+	cfg, err := image.FetchConfig(ctx)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	cfgBytes, err := cfg.ToBytes()
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	cfgDescriptor := store.Add(model.ConfigFilename, model.ConfigMediaType, cfgBytes)
+
+	filter, err := image.FetchFilter(ctx)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	filterBytes, err := ioutil.ReadAll(filter)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	filterDescriptor := store.Add(model.CodeFilename, model.ContentMediaType, filterBytes)
+
+	format := p.format
+	if format == "" {
+		format = model.ImageFormat(image)
+	}
+	layers, err := ManifestLayers(format, cfgDescriptor, filterDescriptor)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	manifestBytes, err := json.Marshal(ocispec.Manifest{
+		Versioned:   specs.Versioned{SchemaVersion: 2},
+		Config:      cfgDescriptor,
+		Layers:      layers,
+		Annotations: ManifestAnnotations(cfg),
+	})
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	manifest := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Digest:    digest.FromBytes(manifestBytes),
+		Size:      int64(len(manifestBytes)),
+	}
+
+	pinned, err := reference.WithDigest(reference.TrimNamed(named), manifest.Digest)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	pusher, err := p.resolver.Pusher(ctx, pinned.String())
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	pushed := map[digest.Digest]bool{}
+	for _, blob := range append([]ocispec.Descriptor{cfgDescriptor}, layers...) {
+		if pushed[blob.Digest] {
+			continue
+		}
+		pushed[blob.Digest] = true
+		_, blobBytes, _ := store.Get(blob)
+		if err := pushContent(ctx, pusher, named.String(), blob, blobBytes, p.progress); err != nil {
+			return ocispec.Descriptor{}, errors.Wrapf(err, "pushing blob %v", blob.Digest)
+		}
+	}
+	if err := pushContent(ctx, pusher, pinned.String(), manifest, manifestBytes, nil); err != nil {
+		return ocispec.Descriptor{}, errors.Wrap(err, "pushing the manifest")
+	}
+	logrus.Infof("Pushed variant %v with abi versions %v", pinned, cfg.AbiVersions)
+
+	manifest.Annotations = map[string]string{
+		model.AbiVersionAnnotation: strings.Join(cfg.AbiVersions, ","),
+	}
+	return manifest, nil
+}
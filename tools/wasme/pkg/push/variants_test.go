@@ -0,0 +1,117 @@
+package push_test
+
+import (
+	"bytes"
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/solo-io/wasm/tools/wasme/pkg/config"
+	"github.com/solo-io/wasm/tools/wasme/pkg/model"
+	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
+	"github.com/solo-io/wasm/tools/wasme/pkg/push"
+	"github.com/solo-io/wasm/tools/wasme/pkg/resolver"
+)
+
+type testImage struct {
+	ref    string
+	cfg    *config.Runtime
+	module []byte
+}
+
+func (i *testImage) Ref() string {
+	return i.ref
+}
+
+func (i *testImage) Descriptor() (ocispec.Descriptor, error) {
+	return model.GetDescriptor(bytes.NewReader(i.module))
+}
+
+func (i *testImage) FetchFilter(ctx context.Context) (model.Filter, error) {
+	return bytes.NewReader(i.module), nil
+}
+
+func (i *testImage) FetchConfig(ctx context.Context) (*config.Runtime, error) {
+	return i.cfg, nil
+}
+
+var _ = Describe("PushVariants", func() {
+	var (
+		registry *testRegistry
+		ref      string
+		variants []push.Image
+		puller   pull.ImagePuller
+	)
+
+	BeforeEach(func() {
+		registry = newTestRegistry()
+		ref = registry.host() + "/user/filter:v1"
+		variants = []push.Image{
+			&testImage{ref: ref, module: []byte("\x00asm istio 1.5"), cfg: &config.Runtime{Type: "envoy_proxy", AbiVersions: []string{"v0-541b2c1155fffb15ccde92b8324f3e38f7339ba6"}}},
+			&testImage{ref: ref, module: []byte("\x00asm istio 1.8"), cfg: &config.Runtime{Type: "envoy_proxy", AbiVersions: []string{"v0-4d76c1d8af324c5f7ec2fbe9ec1dc033d4e5e1f0", "v0.2.1"}}},
+		}
+
+		res, authorizer, err := resolver.NewResolverWithOptions(
+			func(string) (string, string, error) { return "", "", nil },
+			resolver.RegistryOptions{PlainHTTPHosts: []string{resolver.AllHosts}},
+		)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = push.NewPusher(res, authorizer).PushVariants(context.TODO(), ref, variants)
+		Expect(err).NotTo(HaveOccurred())
+		puller = pull.NewPuller(res)
+	})
+
+	AfterEach(func() {
+		registry.Close()
+	})
+
+	moduleDigest := func(image push.Image) digest.Digest {
+		desc, err := image.Descriptor()
+		Expect(err).NotTo(HaveOccurred())
+		return desc.Digest
+	}
+
+	It("pushes an index of the variants annotated with their ABI versions, pulled as the default variant", func() {
+		image, err := puller.Pull(context.TODO(), ref)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(moduleDigest(image)).To(Equal(moduleDigest(variants[0])))
+
+		variantImage, ok := image.(pull.VariantImage)
+		Expect(ok).To(BeTrue())
+		Expect(variantImage.Variants()).To(HaveLen(2))
+		Expect(variantImage.Variants()[0].AbiVersions).To(Equal([]string{"v0-541b2c1155fffb15ccde92b8324f3e38f7339ba6"}))
+		Expect(variantImage.Variants()[1].AbiVersions).To(Equal([]string{"v0-4d76c1d8af324c5f7ec2fbe9ec1dc033d4e5e1f0", "v0.2.1"}))
+	})
+
+	It("selects the variant supporting the ABI versions, which can be pulled by its digest", func() {
+		image, err := puller.Pull(context.TODO(), ref)
+		Expect(err).NotTo(HaveOccurred())
+		selected, err := image.(pull.VariantImage).SelectVariant(context.TODO(), func(abiVersions []string) bool {
+			for _, abiVersion := range abiVersions {
+				if abiVersion == "v0.2.1" {
+					return true
+				}
+			}
+			return false
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(moduleDigest(selected)).To(Equal(moduleDigest(variants[1])))
+		cfg, err := selected.FetchConfig(context.TODO())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.AbiVersions).To(Equal(variants[1].(*testImage).cfg.AbiVersions))
+
+		pinned, err := puller.Pull(context.TODO(), registry.host()+"/user/filter@"+selected.ManifestDigest().String())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(moduleDigest(pinned)).To(Equal(moduleDigest(variants[1])))
+		Expect(pinned.(pull.VariantImage).Variants()).To(BeEmpty())
+	})
+
+	It("fails to select a variant if no variant is supported", func() {
+		image, err := puller.Pull(context.TODO(), ref)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = image.(pull.VariantImage).SelectVariant(context.TODO(), func([]string) bool { return false })
+		Expect(err).To(MatchError(ContainSubstring("no variant of image")))
+	})
+})
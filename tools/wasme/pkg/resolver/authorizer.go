@@ -0,0 +1,58 @@
+package resolver
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/pkg/errors"
+)
+
+// the docker authorizer caches bearer tokens for as long as it is used,
+// so long-running pullers replace it before the tokens issued by most registries expire
+const tokenRefreshInterval = time.Minute
+
+// an authorizer which replaces the docker authorizer every refreshInterval, or as soon as
+// a token it cached is rejected, so that a new token is fetched for the following requests
+type refreshingAuthorizer struct {
+	newAuthorizer   func() docker.Authorizer
+	refreshInterval time.Duration
+
+	lock       sync.Mutex
+	authorizer docker.Authorizer
+	created    time.Time
+}
+
+func (a *refreshingAuthorizer) current() docker.Authorizer {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.authorizer == nil || time.Since(a.created) >= a.refreshInterval {
+		a.authorizer = a.newAuthorizer()
+		a.created = time.Now()
+	}
+	return a.authorizer
+}
+
+// replaces the authorizer, unless it was already replaced
+func (a *refreshingAuthorizer) reset(authorizer docker.Authorizer) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.authorizer == authorizer {
+		a.authorizer = nil
+	}
+}
+
+func (a *refreshingAuthorizer) Authorize(ctx context.Context, req *http.Request) error {
+	return a.current().Authorize(ctx, req)
+}
+
+func (a *refreshingAuthorizer) AddResponses(ctx context.Context, responses []*http.Response) error {
+	authorizer := a.current()
+	err := authorizer.AddResponses(ctx, responses)
+	if errors.Cause(err) == docker.ErrInvalidAuthorization {
+		a.reset(authorizer)
+	}
+	return err
+}
@@ -0,0 +1,102 @@
+package resolver
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	auth "github.com/deislabs/oras/pkg/auth/docker"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// DockerConfigCredentials returns the credentials for each registry host from the docker config file at path,
+// such as the .dockerconfigjson key of a mounted kubernetes.io/dockerconfigjson secret.
+// the file is read again when it changes, so rotated credentials are used without a restart.
+// images are pulled anonymously while the file does not exist, e.g. until an optional secret is created.
+// returns an error if the file cannot be parsed
+func DockerConfigCredentials(path string) (func(hostName string) (string, string, error), error) {
+	creds := &dockerConfigCredentials{path: path}
+	if _, err := creds.load(); err != nil {
+		return nil, err
+	}
+	return creds.credential, nil
+}
+
+// ConfigCredentials returns the username and password for every registry host if either is set. otherwise it returns
+// the credentials of each registry host from the first of the docker config files which has credentials for the host,
+// or from $HOME/.docker/config.json if no files are given. credentials in the credsStore or credHelpers of a config
+// are read by executing the docker-credential-<helper> binary.
+// images are pulled anonymously from a host if its credentials cannot be read, e.g. if the helper is not installed
+func ConfigCredentials(username, password string, configs ...string) func(hostName string) (string, string, error) {
+	if username != "" || password != "" {
+		return func(hostName string) (string, string, error) {
+			return username, password, nil
+		}
+	}
+	client, err := auth.NewClient(configs...)
+	if err != nil {
+		logrus.Warnf("reading docker config: %v", err)
+	}
+	authClient, _ := client.(*auth.Client)
+	return func(hostName string) (string, string, error) {
+		if authClient == nil {
+			return "", "", nil
+		}
+		username, password, err := authClient.Credential(hostName)
+		if err != nil {
+			logrus.Warnf("reading the credentials of %v, continuing anonymously: %v", hostName, err)
+			return "", "", nil
+		}
+		return username, password, nil
+	}
+}
+
+type dockerConfigCredentials struct {
+	path string
+
+	lock    sync.Mutex
+	client  *auth.Client
+	modTime time.Time
+	size    int64
+}
+
+func (c *dockerConfigCredentials) credential(hostName string) (string, string, error) {
+	client, err := c.load()
+	if err != nil || client == nil {
+		return "", "", err
+	}
+	return client.Credential(hostName)
+}
+
+// returns the client for the current contents of the file, or nil if the file does not exist.
+// errors never include the contents of the file, as they may be logged
+func (c *dockerConfigCredentials) load() (*auth.Client, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	info, err := os.Stat(c.path)
+	if os.IsNotExist(err) {
+		c.client = nil
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "reading docker config")
+	}
+	if c.client != nil && info.ModTime().Equal(c.modTime) && info.Size() == c.size {
+		return c.client, nil
+	}
+
+	client, err := auth.NewClient(c.path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading docker config")
+	}
+	authClient, ok := client.(*auth.Client)
+	if !ok {
+		return nil, errors.Errorf("unexpected docker config client %T", client)
+	}
+	c.client = authClient
+	c.modTime = info.ModTime()
+	c.size = info.Size()
+	return authClient, nil
+}
@@ -0,0 +1,92 @@
+package resolver_test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/wasm/tools/wasme/pkg/resolver"
+)
+
+var _ = Describe("DockerConfigCredentials", func() {
+	var (
+		directory  string
+		configPath string
+	)
+
+	// writes a docker config in the format of the .dockerconfigjson key of a kubernetes.io/dockerconfigjson secret
+	writeConfig := func(host, username, password string) {
+		auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+		config := fmt.Sprintf(`{"auths":{%q:{"username":%q,"password":%q,"auth":%q}}}`, host, username, password, auth)
+		Expect(ioutil.WriteFile(configPath, []byte(config), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		directory, err = ioutil.TempDir("", "docker-config")
+		Expect(err).NotTo(HaveOccurred())
+		configPath = filepath.Join(directory, ".dockerconfigjson")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(directory)
+	})
+
+	It("returns the credentials of each registry host", func() {
+		writeConfig("registry.example.com", "user", "secret")
+		credentials, err := resolver.DockerConfigCredentials(configPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		username, password, err := credentials("registry.example.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(username).To(Equal("user"))
+		Expect(password).To(Equal("secret"))
+
+		username, password, err = credentials("other.example.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(username).To(BeEmpty())
+		Expect(password).To(BeEmpty())
+	})
+
+	It("reads the config again when it changes", func() {
+		writeConfig("registry.example.com", "user", "secret")
+		credentials, err := resolver.DockerConfigCredentials(configPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		writeConfig("registry.example.com", "user", "rotated-secret")
+		// the modification time may not change within the resolution of the filesystem
+		later := time.Now().Add(time.Minute)
+		Expect(os.Chtimes(configPath, later, later)).To(Succeed())
+
+		_, password, err := credentials("registry.example.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(password).To(Equal("rotated-secret"))
+	})
+
+	It("returns no credentials until the config is created", func() {
+		credentials, err := resolver.DockerConfigCredentials(configPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		username, password, err := credentials("registry.example.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(username).To(BeEmpty())
+		Expect(password).To(BeEmpty())
+
+		writeConfig("registry.example.com", "user", "secret")
+		username, _, err = credentials("registry.example.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(username).To(Equal("user"))
+	})
+
+	It("returns an error if the config cannot be parsed", func() {
+		Expect(ioutil.WriteFile(configPath, []byte("not json"), 0644)).To(Succeed())
+		_, err := resolver.DockerConfigCredentials(configPath)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).NotTo(ContainSubstring("not json"))
+	})
+})
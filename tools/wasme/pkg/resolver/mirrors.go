@@ -0,0 +1,197 @@
+package resolver
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/containerd/containerd/remotes"
+	"github.com/docker/distribution/reference"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// Mirrors maps registry hosts to the locations of their mirrors, e.g. webassemblyhub.io: [registry.corp/wasm-mirror].
+// a location is the host of the mirror registry, followed by an optional prefix of the mirrored repositories.
+// the mirrors of a host are tried in order before the host itself
+type Mirrors map[string][]string
+
+// the format of the mirrors file, e.g.
+//
+//	mirrors:
+//	  webassemblyhub.io:
+//	  - registry.corp/wasm-mirror
+type mirrorsFile struct {
+	Mirrors Mirrors `yaml:"mirrors"`
+}
+
+// ParseMirrors parses mirrors in the format <host>=<location>. the mirrors of a host are kept in order
+func ParseMirrors(values []string) (Mirrors, error) {
+	mirrors := Mirrors{}
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.Errorf("invalid registry mirror %q: must be in the format <host>=<mirror>", value)
+		}
+		mirrors[parts[0]] = append(mirrors[parts[0]], parts[1])
+	}
+	if err := mirrors.validate(); err != nil {
+		return nil, err
+	}
+	return mirrors, nil
+}
+
+// LoadMirrorsFile reads the mirrors from a YAML file with a mirrors key, mapping each host to its mirrors
+func LoadMirrorsFile(path string) (Mirrors, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file mirrorsFile
+	if err := yaml.UnmarshalStrict(raw, &file); err != nil {
+		return nil, errors.Wrapf(err, "parsing registry mirrors file %v", path)
+	}
+	if err := file.Mirrors.validate(); err != nil {
+		return nil, errors.Wrapf(err, "registry mirrors file %v", path)
+	}
+	return file.Mirrors, nil
+}
+
+// Merge returns the mirrors of both, with the mirrors of m tried first
+func (m Mirrors) Merge(other Mirrors) Mirrors {
+	merged := Mirrors{}
+	for host, locations := range m {
+		merged[host] = append(merged[host], locations...)
+	}
+	for host, locations := range other {
+		merged[host] = append(merged[host], locations...)
+	}
+	return merged
+}
+
+func (m Mirrors) validate() error {
+	for host, locations := range m {
+		for _, location := range locations {
+			if _, err := reference.ParseNormalizedNamed(location); err != nil {
+				return errors.Wrapf(err, "invalid mirror %v of registry %v", location, host)
+			}
+		}
+	}
+	return nil
+}
+
+// MirrorRefs returns the refs of the image in the mirrors of its registry, in order
+func (m Mirrors) MirrorRefs(ref string) ([]string, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return nil, err
+	}
+	var refs []string
+	for _, location := range m[reference.Domain(named)] {
+		mirrored, err := reference.ParseNormalizedNamed(location + "/" + reference.Path(named))
+		if err != nil {
+			return nil, err
+		}
+		if tagged, ok := named.(reference.Tagged); ok {
+			if mirrored, err = reference.WithTag(mirrored, tagged.Tag()); err != nil {
+				return nil, err
+			}
+		}
+		if digested, ok := named.(reference.Digested); ok {
+			if mirrored, err = reference.WithDigest(mirrored, digested.Digest()); err != nil {
+				return nil, err
+			}
+		}
+		refs = append(refs, mirrored.String())
+	}
+	return refs, nil
+}
+
+// NewMirroredResolver returns a resolver which resolves and fetches images from the mirrors of their registry,
+// falling back to the registry if no mirror has the image. the resolved names are the refs of the registry,
+// so the refs of pulled images do not depend on the mirrors. images are only pushed to the registry
+func NewMirroredResolver(resolver remotes.Resolver, mirrors Mirrors) remotes.Resolver {
+	return &mirroredResolver{Resolver: resolver, mirrors: mirrors}
+}
+
+type mirroredResolver struct {
+	remotes.Resolver
+	mirrors Mirrors
+}
+
+func (r *mirroredResolver) Resolve(ctx context.Context, ref string) (string, ocispec.Descriptor, error) {
+	mirrorRefs, err := r.mirrors.MirrorRefs(ref)
+	if err != nil {
+		return "", ocispec.Descriptor{}, err
+	}
+	for _, mirrorRef := range mirrorRefs {
+		_, desc, err := r.Resolver.Resolve(ctx, mirrorRef)
+		if err == nil {
+			logrus.Debugf("resolved %v from mirror %v", ref, mirrorRef)
+			return ref, desc, nil
+		}
+		if ctx.Err() != nil {
+			return "", ocispec.Descriptor{}, ctx.Err()
+		}
+		logrus.Debugf("resolving %v from mirror %v: %v", ref, mirrorRef, err)
+	}
+	return r.Resolver.Resolve(ctx, ref)
+}
+
+// the content of the blobs is verified by their digest, so it can be fetched from any mirror
+func (r *mirroredResolver) Fetcher(ctx context.Context, ref string) (remotes.Fetcher, error) {
+	mirrorRefs, err := r.mirrors.MirrorRefs(ref)
+	if err != nil {
+		return nil, err
+	}
+	var fetchers []remotes.Fetcher
+	for _, mirrorRef := range append(mirrorRefs, ref) {
+		fetcher, err := r.Resolver.Fetcher(ctx, mirrorRef)
+		if err != nil {
+			return nil, err
+		}
+		fetchers = append(fetchers, fetcher)
+	}
+	return mirroredFetcher(fetchers), nil
+}
+
+// tries each fetcher in order, returning the error of the last
+type mirroredFetcher []remotes.Fetcher
+
+func (f mirroredFetcher) Fetch(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+	var err error
+	for _, fetcher := range f {
+		var rc io.ReadCloser
+		rc, err = fetch(ctx, fetcher, desc)
+		if err == nil {
+			return rc, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		logrus.Debugf("fetching %v: %v", desc.Digest, err)
+	}
+	return nil, err
+}
+
+// the docker fetcher only requests the blob once it is read, so the first byte is read
+// to find out whether the registry has the blob
+func fetch(ctx context.Context, fetcher remotes.Fetcher, desc ocispec.Descriptor) (io.ReadCloser, error) {
+	rc, err := fetcher.Fetch(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(rc)
+	if _, err := reader.Peek(1); err != nil && err != io.EOF {
+		rc.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{Reader: reader, Closer: rc}, nil
+}
@@ -0,0 +1,155 @@
+package resolver_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/solo-io/wasm/tools/wasme/pkg/resolver"
+)
+
+var _ = Describe("Mirrors", func() {
+	It("maps the refs of images to the refs of the mirrors of their registry", func() {
+		mirrors, err := resolver.ParseMirrors([]string{
+			"webassemblyhub.io=registry.corp/wasm-mirror",
+			"webassemblyhub.io=backup.corp:5000",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		refs, err := mirrors.MirrorRefs("webassemblyhub.io/user/filter:v1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(refs).To(Equal([]string{"registry.corp/wasm-mirror/user/filter:v1", "backup.corp:5000/user/filter:v1"}))
+
+		imageDigest := digest.FromString("manifest")
+		refs, err = mirrors.MirrorRefs("webassemblyhub.io/user/filter@" + imageDigest.String())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(refs).To(ContainElement("registry.corp/wasm-mirror/user/filter@" + imageDigest.String()))
+
+		refs, err = mirrors.MirrorRefs("registry.corp/user/filter:v1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(refs).To(BeEmpty())
+
+		_, err = resolver.ParseMirrors([]string{"webassemblyhub.io"})
+		Expect(err).To(MatchError(ContainSubstring("<host>=<mirror>")))
+	})
+
+	It("reads the mirrors from a file", func() {
+		directory, err := ioutil.TempDir("", "mirrors")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(directory)
+		path := filepath.Join(directory, "mirrors.yaml")
+
+		Expect(ioutil.WriteFile(path, []byte("mirrors:\n  webassemblyhub.io:\n  - registry.corp/wasm-mirror\n"), 0644)).To(Succeed())
+		mirrors, err := resolver.LoadMirrorsFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mirrors).To(Equal(resolver.Mirrors{"webassemblyhub.io": {"registry.corp/wasm-mirror"}}))
+
+		Expect(ioutil.WriteFile(path, []byte("webassemblyhub.io: registry.corp\n"), 0644)).To(Succeed())
+		_, err = resolver.LoadMirrorsFile(path)
+		Expect(err).To(MatchError(ContainSubstring("parsing registry mirrors file")))
+	})
+
+	Context("resolving images", func() {
+		manifestDigest := digest.FromString("manifest")
+		blob := []byte("filter")
+		blobDigest := digest.FromBytes(blob)
+
+		var (
+			registry, mirror *httptest.Server
+			// the paths of the requests served by the mirror
+			mirrored []string
+			// whether the mirror has the image
+			mirrorHasImage bool
+		)
+
+		// serves the image at the repository
+		serveImage := func(repository string, hasImage func() bool, served *[]string) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case !hasImage():
+					w.WriteHeader(http.StatusNotFound)
+					return
+				case r.URL.Path == "/v2/"+repository+"/manifests/v1":
+					w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+					w.Header().Set("Docker-Content-Digest", manifestDigest.String())
+					w.Header().Set("Content-Length", "8")
+				case r.URL.Path == "/v2/"+repository+"/blobs/"+blobDigest.String():
+					w.Write(blob)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				if served != nil {
+					*served = append(*served, r.URL.Path)
+				}
+			}
+		}
+
+		host := func(server *httptest.Server) string {
+			serverUrl, err := url.Parse(server.URL)
+			Expect(err).NotTo(HaveOccurred())
+			return serverUrl.Host
+		}
+
+		BeforeEach(func() {
+			mirrored = nil
+			mirrorHasImage = true
+			registry = httptest.NewServer(serveImage("user/filter", func() bool { return true }, nil))
+			mirror = httptest.NewServer(serveImage("wasm-mirror/user/filter", func() bool { return mirrorHasImage }, &mirrored))
+		})
+
+		AfterEach(func() {
+			registry.Close()
+			mirror.Close()
+		})
+
+		resolveAndFetch := func() string {
+			res, _, err := resolver.NewResolverWithOptions(
+				func(string) (string, string, error) { return "", "", nil },
+				resolver.RegistryOptions{
+					PlainHTTPHosts: []string{resolver.AllHosts},
+					Mirrors:        []string{host(registry) + "=" + host(mirror) + "/wasm-mirror"},
+				},
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			ref := host(registry) + "/user/filter:v1"
+			name, desc, err := res.Resolve(context.TODO(), ref)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(desc.Digest).To(Equal(manifestDigest))
+			// the name does not depend on the mirrors
+			Expect(name).To(Equal(ref))
+
+			fetcher, err := res.Fetcher(context.TODO(), ref)
+			Expect(err).NotTo(HaveOccurred())
+			rc, err := fetcher.Fetch(context.TODO(), ocispec.Descriptor{Digest: blobDigest, Size: int64(len(blob)), MediaType: "application/octet-stream"})
+			Expect(err).NotTo(HaveOccurred())
+			defer rc.Close()
+			content, err := ioutil.ReadAll(rc)
+			Expect(err).NotTo(HaveOccurred())
+			return string(content)
+		}
+
+		It("resolves and fetches images from the mirrors of their registry", func() {
+			Expect(resolveAndFetch()).To(Equal(string(blob)))
+			Expect(mirrored).To(Equal([]string{
+				"/v2/wasm-mirror/user/filter/manifests/v1",
+				"/v2/wasm-mirror/user/filter/blobs/" + blobDigest.String(),
+			}))
+		})
+
+		It("falls back to the registry if the mirrors do not have the image", func() {
+			mirrorHasImage = false
+			Expect(resolveAndFetch()).To(Equal(string(blob)))
+			Expect(mirrored).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,139 @@
+package resolver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// matches every registry host in the hosts of RegistryOptions
+const AllHosts = "*"
+
+// RegistryOptions configures the connections of a resolver to registry hosts, so that the settings
+// for an insecure registry do not apply to the connections to other registries.
+// a host without a port matches the host on every port
+type RegistryOptions struct {
+	// the hosts which are connected to over plain HTTP
+	PlainHTTPHosts []string
+	// the hosts whose TLS certificates are not verified, including the hosts of their token servers
+	InsecureHosts []string
+	// PEM files of CA certificates which are trusted in addition to the system roots
+	CAFiles []string
+	// the URL of the proxy every registry is connected through. if not set, the proxy of the
+	// HTTPS_PROXY and HTTP_PROXY environment variables is used for the hosts which are not excluded by NO_PROXY
+	Proxy string
+	// if non-zero, the maximum length of time of each request to a registry, including reading the response
+	RequestTimeout time.Duration
+	// the retries of the requests which fail with a retryable status or a connection error
+	Retry RetryOptions
+	// the mirrors of registry hosts, in the format <host>=<mirror>, e.g. webassemblyhub.io=registry.corp/wasm-mirror.
+	// the mirrors are tried in order before the mirrors of the mirrors file
+	Mirrors []string
+	// path to a YAML file mapping registry hosts to their mirrors (see LoadMirrorsFile)
+	MirrorsFile string
+}
+
+func (o RegistryOptions) IsPlainHTTP(host string) bool {
+	return matchHost(o.PlainHTTPHosts, host)
+}
+
+func (o RegistryOptions) IsInsecure(host string) bool {
+	return matchHost(o.InsecureHosts, host)
+}
+
+func matchHost(hosts []string, host string) bool {
+	hostname, _, err := net.SplitHostPort(host)
+	if err != nil {
+		hostname = host
+	}
+	for _, h := range hosts {
+		if h == AllHosts || h == host || h == hostname {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the mirrors of the options, or an error if the mirrors file cannot be read
+func (o RegistryOptions) mirrors() (Mirrors, error) {
+	mirrors, err := ParseMirrors(o.Mirrors)
+	if err != nil {
+		return nil, err
+	}
+	if o.MirrorsFile == "" {
+		return mirrors, nil
+	}
+	fileMirrors, err := LoadMirrorsFile(o.MirrorsFile)
+	if err != nil {
+		return nil, err
+	}
+	return mirrors.Merge(fileMirrors), nil
+}
+
+// returns a client which only skips the verification of the certificates of the insecure hosts,
+// and retries the failed requests
+func (o RegistryOptions) client() (*http.Client, error) {
+	proxy := http.ProxyFromEnvironment
+	if o.Proxy != "" {
+		proxyUrl, err := url.Parse(o.Proxy)
+		if err != nil || proxyUrl.Host == "" {
+			return nil, errors.Errorf("invalid registry proxy %q", o.Proxy)
+		}
+		proxy = http.ProxyURL(proxyUrl)
+	}
+
+	secure := http.DefaultTransport.(*http.Transport).Clone()
+	secure.Proxy = proxy
+	if len(o.CAFiles) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, caFile := range o.CAFiles {
+			pem, err := ioutil.ReadFile(caFile)
+			if err != nil {
+				return nil, errors.Wrap(err, "reading registry CA")
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, errors.Errorf("no certificates found in registry CA %v", caFile)
+			}
+		}
+		secure.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	var transport http.RoundTripper = secure
+	if len(o.InsecureHosts) > 0 {
+		insecure := http.DefaultTransport.(*http.Transport).Clone()
+		insecure.Proxy = proxy
+		insecure.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		transport = &hostTransport{
+			opts:     o,
+			secure:   secure,
+			insecure: insecure,
+		}
+	}
+	return &http.Client{Transport: &retryTransport{
+		next:           transport,
+		retry:          o.Retry.withDefaults(),
+		requestTimeout: o.RequestTimeout,
+	}}, nil
+}
+
+// selects the transport of each request by its host
+type hostTransport struct {
+	opts     RegistryOptions
+	secure   http.RoundTripper
+	insecure http.RoundTripper
+}
+
+func (t *hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.opts.IsInsecure(req.URL.Host) {
+		return t.insecure.RoundTrip(req)
+	}
+	return t.secure.RoundTrip(req)
+}
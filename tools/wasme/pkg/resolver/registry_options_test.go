@@ -0,0 +1,94 @@
+package resolver_test
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/solo-io/wasm/tools/wasme/pkg/resolver"
+)
+
+var _ = Describe("RegistryOptions", func() {
+	manifestDigest := digest.FromString("manifest")
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+		w.Header().Set("Docker-Content-Digest", manifestDigest.String())
+		w.Header().Set("Content-Length", "8")
+	})
+
+	noCredentials := func(string) (string, string, error) {
+		return "", "", nil
+	}
+
+	resolve := func(registry *httptest.Server, opts resolver.RegistryOptions) error {
+		res, _, err := resolver.NewResolverWithOptions(noCredentials, opts)
+		Expect(err).NotTo(HaveOccurred())
+		registryUrl, err := url.Parse(registry.URL)
+		Expect(err).NotTo(HaveOccurred())
+		_, desc, err := res.Resolve(context.TODO(), registryUrl.Host+"/filter:v1")
+		if err == nil {
+			Expect(desc.Digest).To(Equal(manifestDigest))
+		}
+		return err
+	}
+
+	It("matches hosts with and without their port", func() {
+		opts := resolver.RegistryOptions{
+			PlainHTTPHosts: []string{"registry.corp:5000"},
+			InsecureHosts:  []string{"registry.corp"},
+		}
+		Expect(opts.IsPlainHTTP("registry.corp:5000")).To(BeTrue())
+		Expect(opts.IsPlainHTTP("registry.corp")).To(BeFalse())
+		Expect(opts.IsInsecure("registry.corp:5000")).To(BeTrue())
+		Expect(opts.IsInsecure("webassemblyhub.io")).To(BeFalse())
+		Expect(resolver.RegistryOptions{PlainHTTPHosts: []string{resolver.AllHosts}}.IsPlainHTTP("webassemblyhub.io")).To(BeTrue())
+	})
+
+	It("connects to the plain HTTP hosts over plain HTTP", func() {
+		registry := httptest.NewServer(handler)
+		defer registry.Close()
+		registryUrl, err := url.Parse(registry.URL)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(resolve(registry, resolver.RegistryOptions{PlainHTTPHosts: []string{registryUrl.Host}})).To(Succeed())
+		Expect(resolve(registry, resolver.RegistryOptions{PlainHTTPHosts: []string{"registry.corp:5000"}})).NotTo(Succeed())
+	})
+
+	It("only skips the verification of the certificates of the insecure hosts", func() {
+		registry := httptest.NewTLSServer(handler)
+		defer registry.Close()
+		registryUrl, err := url.Parse(registry.URL)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(resolve(registry, resolver.RegistryOptions{})).NotTo(Succeed())
+		Expect(resolve(registry, resolver.RegistryOptions{InsecureHosts: []string{"registry.corp"}})).NotTo(Succeed())
+		Expect(resolve(registry, resolver.RegistryOptions{InsecureHosts: []string{registryUrl.Hostname()}})).To(Succeed())
+	})
+
+	It("trusts the certificates of the CA files", func() {
+		registry := httptest.NewTLSServer(handler)
+		defer registry.Close()
+
+		directory, err := ioutil.TempDir("", "registry-ca")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(directory)
+		caFile := filepath.Join(directory, "ca.pem")
+		ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: registry.Certificate().Raw})
+		Expect(ioutil.WriteFile(caFile, ca, 0644)).To(Succeed())
+
+		Expect(resolve(registry, resolver.RegistryOptions{CAFiles: []string{caFile}})).To(Succeed())
+
+		Expect(ioutil.WriteFile(caFile, []byte("not a certificate"), 0644)).To(Succeed())
+		_, _, err = resolver.NewResolverWithOptions(noCredentials, resolver.RegistryOptions{CAFiles: []string{caFile}})
+		Expect(err).To(MatchError(ContainSubstring("no certificates found")))
+	})
+})
@@ -1,56 +1,88 @@
 package resolver
 
 import (
-	"crypto/tls"
-	"net/http"
-
-	auth "github.com/deislabs/oras/pkg/auth/docker"
-
 	"github.com/containerd/containerd/remotes"
 	"github.com/containerd/containerd/remotes/docker"
 )
 
+// NewResolver returns a resolver which authenticates to each registry host with the username and password if either is set,
+// or else with the credentials of the host from the docker config files (see ConfigCredentials).
+// the returned authorizer is the authorizer of the resolver, which refreshes its bearer tokens periodically
 func NewResolver(username, password string, insecure bool, plainHTTP bool, configs ...string) (remotes.Resolver, docker.Authorizer) {
+	return newResolver(ConfigCredentials(username, password, configs...), insecure, plainHTTP)
+}
 
-	opts := docker.ResolverOptions{
-		PlainHTTP: plainHTTP,
-	}
+// NewResolverWithCredentials returns a resolver which authenticates to each registry host
+// with the credentials returned for the host, e.g. by DockerConfigCredentials.
+// bearer tokens are refreshed periodically, so the resolver can be used by long-running pullers
+func NewResolverWithCredentials(credentials func(hostName string) (string, string, error), insecure bool, plainHTTP bool) remotes.Resolver {
+	res, _ := newResolver(credentials, insecure, plainHTTP)
+	return res
+}
 
-	client := http.DefaultClient
-	if insecure {
-		client.Transport = &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
-			},
-		}
+// NewResolverWithOptions returns a resolver which authenticates to each registry host with the credentials returned for the host,
+// and connects to each host, or its mirrors, as configured by the registry options.
+// returns an error if the CA files or the mirrors file of the options cannot be read
+func NewResolverWithOptions(credentials func(hostName string) (string, string, error), opts RegistryOptions) (remotes.Resolver, docker.Authorizer, error) {
+	hosts, authorizer, err := registryHosts(credentials, opts)
+	if err != nil {
+		return nil, nil, err
 	}
-	opts.Client = client
-
-	if username != "" || password != "" {
-		opts.Credentials = func(hostName string) (string, string, error) {
-			return username, password, nil
-		}
-		return docker.NewResolver(opts), nil
+	mirrors, err := opts.mirrors()
+	if err != nil {
+		return nil, nil, err
 	}
-	var dockerCreds func(hostname string) (string, string, error)
-	if cli, err := auth.NewClient(configs...); err == nil {
-		if authcli, ok := cli.(*auth.Client); ok {
-			dockerCreds = authcli.Credential
-		}
+
+	res := docker.NewResolver(docker.ResolverOptions{Hosts: hosts})
+	if len(mirrors) > 0 {
+		res = NewMirroredResolver(res, mirrors)
 	}
+	return res, authorizer, nil
+}
+
+// NewRegistryHostsWithOptions returns the hosts which the resolvers returned by NewResolverWithOptions connect to,
+// to send requests to registries which are not supported by resolvers, such as listing the tags of a repository.
+// the mirrors of the options are ignored
+func NewRegistryHostsWithOptions(credentials func(hostName string) (string, string, error), opts RegistryOptions) (docker.RegistryHosts, error) {
+	hosts, _, err := registryHosts(credentials, opts)
+	return hosts, err
+}
 
-	credentials := func(hostName string) (string, string, error) {
-		if dockerCreds != nil {
-			return dockerCreds(hostName)
-		}
-		return "", "", nil
+func registryHosts(credentials func(hostName string) (string, string, error), opts RegistryOptions) (docker.RegistryHosts, docker.Authorizer, error) {
+	client, err := opts.client()
+	if err != nil {
+		return nil, nil, err
 	}
 
-	opts.Authorizer = docker.NewDockerAuthorizer(
-		docker.WithAuthClient(opts.Client),
-		docker.WithAuthHeader(opts.Headers),
-		docker.WithAuthCreds(credentials),
+	authorizer := &refreshingAuthorizer{
+		newAuthorizer: func() docker.Authorizer {
+			return docker.NewDockerAuthorizer(
+				docker.WithAuthClient(client),
+				docker.WithAuthCreds(credentials),
+			)
+		},
+		refreshInterval: tokenRefreshInterval,
+	}
+	hosts := docker.ConfigureDefaultRegistries(
+		docker.WithClient(client),
+		docker.WithAuthorizer(authorizer),
+		docker.WithPlainHTTP(func(host string) (bool, error) {
+			return opts.IsPlainHTTP(host), nil
+		}),
 	)
+	return hosts, authorizer, nil
+}
 
-	return docker.NewResolver(opts), opts.Authorizer
+// the insecure and plain HTTP settings apply to every host
+func newResolver(credentials func(hostName string) (string, string, error), insecure bool, plainHTTP bool) (remotes.Resolver, docker.Authorizer) {
+	var opts RegistryOptions
+	if insecure {
+		opts.InsecureHosts = []string{AllHosts}
+	}
+	if plainHTTP {
+		opts.PlainHTTPHosts = []string{AllHosts}
+	}
+	// the client cannot fail to be created without CA files
+	res, authorizer, _ := NewResolverWithOptions(credentials, opts)
+	return res, authorizer
 }
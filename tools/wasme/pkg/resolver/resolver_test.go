@@ -0,0 +1,117 @@
+package resolver_test
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/solo-io/wasm/tools/wasme/pkg/resolver"
+)
+
+var _ = Describe("NewResolver", func() {
+	const (
+		username = "user"
+		password = "secret"
+	)
+	var (
+		directory      string
+		registry       *httptest.Server
+		registryHost   string
+		manifestDigest = digest.FromString("manifest")
+	)
+
+	writeConfig := func(config string) string {
+		configPath := filepath.Join(directory, fmt.Sprintf("config-%v.json", len(config)))
+		Expect(ioutil.WriteFile(configPath, []byte(config), 0644)).To(Succeed())
+		return configPath
+	}
+
+	BeforeEach(func() {
+		var err error
+		directory, err = ioutil.TempDir("", "resolver")
+		Expect(err).NotTo(HaveOccurred())
+
+		// a registry which requires basic auth
+		registry = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, pass, ok := r.BasicAuth()
+			if !ok || user != username || pass != password {
+				w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+			w.Header().Set("Docker-Content-Digest", manifestDigest.String())
+			w.Header().Set("Content-Length", "8")
+		}))
+		registryUrl, err := url.Parse(registry.URL)
+		Expect(err).NotTo(HaveOccurred())
+		registryHost = registryUrl.Host
+	})
+
+	AfterEach(func() {
+		registry.Close()
+		os.RemoveAll(directory)
+	})
+
+	resolve := func(username, password string, configs ...string) (ocispec.Descriptor, error) {
+		res, _ := resolver.NewResolver(username, password, false, true, configs...)
+		_, desc, err := res.Resolve(context.TODO(), registryHost+"/filter:v1")
+		return desc, err
+	}
+
+	It("authenticates with the credentials of the registry host in the docker config", func() {
+		auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+		otherConfig := writeConfig(`{"auths":{"other.example.com":{"auth":"b3RoZXI6b3RoZXI="}}}`)
+		config := writeConfig(fmt.Sprintf(`{"auths":{%q:{"auth":%q}}}`, registryHost, auth))
+
+		desc, err := resolve("", "", otherConfig, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(desc.Digest).To(Equal(manifestDigest))
+
+		_, err = resolve("", "", otherConfig)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("authenticates with the username and password instead of the docker config", func() {
+		auth := base64.StdEncoding.EncodeToString([]byte("wrong:wrong"))
+		config := writeConfig(fmt.Sprintf(`{"auths":{%q:{"auth":%q}}}`, registryHost, auth))
+
+		desc, err := resolve(username, password, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(desc.Digest).To(Equal(manifestDigest))
+	})
+
+	It("authenticates with the credentials of the credential helper of the registry host", func() {
+		// docker-credential-<helper> get reads the server url from stdin, and writes the credentials to stdout
+		helper := filepath.Join(directory, "docker-credential-wasme-test")
+		script := fmt.Sprintf("#!/bin/sh\necho '{\"Username\":%q,\"Secret\":%q}'\n", username, password)
+		Expect(ioutil.WriteFile(helper, []byte(script), 0755)).To(Succeed())
+		path := os.Getenv("PATH")
+		Expect(os.Setenv("PATH", directory+string(os.PathListSeparator)+path)).To(Succeed())
+		defer os.Setenv("PATH", path)
+
+		config := writeConfig(fmt.Sprintf(`{"credHelpers":{%q:"wasme-test"}}`, registryHost))
+		desc, err := resolve("", "", config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(desc.Digest).To(Equal(manifestDigest))
+	})
+
+	It("resolves anonymously if the credential helper fails", func() {
+		config := writeConfig(fmt.Sprintf(`{"credHelpers":{%q:"not-installed"}}`, registryHost))
+		credentials := resolver.ConfigCredentials("", "", config)
+		user, pass, err := credentials(registryHost)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(user).To(BeEmpty())
+		Expect(pass).To(BeEmpty())
+	})
+})
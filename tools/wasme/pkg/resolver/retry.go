@@ -0,0 +1,145 @@
+package resolver
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// the defaults of the zero fields of RetryOptions
+const (
+	DefaultMaxAttempts    = 4
+	DefaultInitialBackoff = 250 * time.Millisecond
+	DefaultMaxBackoff     = 5 * time.Second
+)
+
+// the statuses of the responses which are retried, if RetryOptions sets none
+var DefaultRetryableStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryOptions configures the retries of the GET and HEAD requests to registries which fail with a retryable status
+// or a connection error. the delay before the second attempt is the initial backoff, and is doubled after each attempt
+// up to the max backoff. zero fields are set to their defaults, so retries are disabled by setting MaxAttempts to 1
+type RetryOptions struct {
+	// the number of attempts of each request, including the first
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// the statuses of the responses which are retried
+	StatusCodes []int
+}
+
+func (o RetryOptions) withDefaults() RetryOptions {
+	if o.MaxAttempts == 0 {
+		o.MaxAttempts = DefaultMaxAttempts
+	}
+	if o.InitialBackoff == 0 {
+		o.InitialBackoff = DefaultInitialBackoff
+	}
+	if o.MaxBackoff == 0 {
+		o.MaxBackoff = DefaultMaxBackoff
+	}
+	if len(o.StatusCodes) == 0 {
+		o.StatusCodes = DefaultRetryableStatusCodes
+	}
+	return o
+}
+
+func (o RetryOptions) isRetryable(statusCode int) bool {
+	for _, code := range o.StatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// the certificates of a registry do not change between attempts
+func isCertificateError(err error) bool {
+	var unknownAuthority x509.UnknownAuthorityError
+	var invalid x509.CertificateInvalidError
+	var hostname x509.HostnameError
+	return errors.As(err, &unknownAuthority) || errors.As(err, &invalid) || errors.As(err, &hostname)
+}
+
+// retries the failed requests, and aborts each attempt after the request timeout.
+// the retries stop once the context of the request is done
+type retryTransport struct {
+	next           http.RoundTripper
+	retry          RetryOptions
+	requestTimeout time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// requests with bodies, e.g. blob uploads, cannot be repeated safely
+	idempotent := req.Method == http.MethodGet || req.Method == http.MethodHead
+	ctx := req.Context()
+	backoff := t.retry.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		res, err := t.roundTrip(req)
+		if !idempotent || attempt >= t.retry.MaxAttempts || ctx.Err() != nil {
+			return res, err
+		}
+		if err == nil && !t.retry.isRetryable(res.StatusCode) || err != nil && isCertificateError(err) {
+			return res, err
+		}
+
+		logger := logrus.WithFields(logrus.Fields{
+			"url":     req.URL.String(),
+			"attempt": attempt,
+		})
+		if err != nil {
+			logger.Debugf("retrying request in %v: %v", backoff, err)
+		} else {
+			logger.Debugf("retrying request in %v: %v", backoff, res.Status)
+			io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > t.retry.MaxBackoff {
+			backoff = t.retry.MaxBackoff
+		}
+	}
+}
+
+// the timeout of the attempt is cancelled once its response body is closed
+func (t *retryTransport) roundTrip(req *http.Request) (*http.Response, error) {
+	if t.requestTimeout == 0 {
+		return t.next.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), t.requestTimeout)
+	res, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	res.Body = &cancelOnClose{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
@@ -0,0 +1,145 @@
+package resolver_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/solo-io/wasm/tools/wasme/pkg/resolver"
+)
+
+var _ = Describe("Retries", func() {
+	manifestDigest := digest.FromString("manifest")
+	writeManifest := func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+		w.Header().Set("Docker-Content-Digest", manifestDigest.String())
+		w.Header().Set("Content-Length", "8")
+	}
+
+	noCredentials := func(string) (string, string, error) {
+		return "", "", nil
+	}
+
+	var (
+		registry *httptest.Server
+		// the number of requests received by the registry
+		requests int32
+		// the first failures requests fail with the failure status
+		failures      int32
+		failureStatus int
+	)
+
+	BeforeEach(func() {
+		atomic.StoreInt32(&requests, 0)
+		failures = 0
+		failureStatus = http.StatusBadGateway
+		registry = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&requests, 1) <= failures {
+				w.WriteHeader(failureStatus)
+				return
+			}
+			writeManifest(w)
+		}))
+	})
+
+	AfterEach(func() {
+		registry.Close()
+	})
+
+	resolve := func(ctx context.Context, opts resolver.RegistryOptions) error {
+		opts.PlainHTTPHosts = []string{resolver.AllHosts}
+		res, _, err := resolver.NewResolverWithOptions(noCredentials, opts)
+		Expect(err).NotTo(HaveOccurred())
+		registryUrl, err := url.Parse(registry.URL)
+		Expect(err).NotTo(HaveOccurred())
+		_, _, err = res.Resolve(ctx, registryUrl.Host+"/filter:v1")
+		return err
+	}
+
+	It("retries the requests which fail with a retryable status", func() {
+		failures = 2
+		err := resolve(context.TODO(), resolver.RegistryOptions{Retry: resolver.RetryOptions{InitialBackoff: time.Millisecond}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(atomic.LoadInt32(&requests)).To(BeEquivalentTo(3))
+	})
+
+	It("gives up after the max attempts", func() {
+		failures = 2
+		err := resolve(context.TODO(), resolver.RegistryOptions{Retry: resolver.RetryOptions{MaxAttempts: 2, InitialBackoff: time.Millisecond}})
+		Expect(err).To(HaveOccurred())
+		Expect(atomic.LoadInt32(&requests)).To(BeEquivalentTo(2))
+	})
+
+	It("only retries the configured statuses", func() {
+		failures = 1
+		failureStatus = http.StatusForbidden
+		err := resolve(context.TODO(), resolver.RegistryOptions{Retry: resolver.RetryOptions{InitialBackoff: time.Millisecond}})
+		Expect(err).To(HaveOccurred())
+		Expect(atomic.LoadInt32(&requests)).To(BeEquivalentTo(1))
+
+		atomic.StoreInt32(&requests, 0)
+		err = resolve(context.TODO(), resolver.RegistryOptions{Retry: resolver.RetryOptions{
+			InitialBackoff: time.Millisecond,
+			StatusCodes:    []int{http.StatusForbidden},
+		}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(atomic.LoadInt32(&requests)).To(BeEquivalentTo(2))
+	})
+
+	It("aborts and retries the requests which exceed the request timeout", func() {
+		registry.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&requests, 1) == 1 {
+				// hangs until the request is aborted
+				<-r.Context().Done()
+				return
+			}
+			writeManifest(w)
+		})
+		err := resolve(context.TODO(), resolver.RegistryOptions{
+			RequestTimeout: 50 * time.Millisecond,
+			Retry:          resolver.RetryOptions{InitialBackoff: time.Millisecond},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(atomic.LoadInt32(&requests)).To(BeEquivalentTo(2))
+	})
+
+	It("stops retrying once the context is done", func() {
+		failures = 100
+		ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		err := resolve(ctx, resolver.RegistryOptions{Retry: resolver.RetryOptions{InitialBackoff: time.Hour}})
+		Expect(err).To(MatchError(ContainSubstring("context deadline exceeded")))
+		Expect(time.Since(start)).To(BeNumerically("<", 10*time.Second))
+		Expect(atomic.LoadInt32(&requests)).To(BeEquivalentTo(1))
+	})
+
+	It("connects to the registries through the registry proxy", func() {
+		var proxiedHost string
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			proxiedHost = r.URL.Host
+			writeManifest(w)
+		}))
+		defer proxy.Close()
+
+		res, _, err := resolver.NewResolverWithOptions(noCredentials, resolver.RegistryOptions{
+			PlainHTTPHosts: []string{resolver.AllHosts},
+			Proxy:          proxy.URL,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		_, desc, err := res.Resolve(context.TODO(), "registry.invalid/filter:v1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(desc.Digest).To(Equal(manifestDigest))
+		Expect(proxiedHost).To(Equal("registry.invalid"))
+
+		_, _, err = resolver.NewResolverWithOptions(noCredentials, resolver.RegistryOptions{Proxy: "registry.invalid"})
+		Expect(err).To(MatchError(ContainSubstring("invalid registry proxy")))
+	})
+})
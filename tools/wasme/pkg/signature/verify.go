@@ -0,0 +1,316 @@
+package signature
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
+)
+
+const (
+	// the media type of the layers of cosign signature images, holding the signed payload
+	SimpleSigningMediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+	// the annotation of a signature layer holding the base64 encoded signature of the payload
+	SignatureAnnotation = "dev.cosignproject.cosign/signature"
+	// the annotation of a keyless signature layer holding the PEM encoded certificate of the signer
+	CertificateAnnotation = "dev.sigstore.cosign/certificate"
+	// the annotation of a keyless signature layer holding the PEM encoded intermediate certificates
+	ChainAnnotation = "dev.sigstore.cosign/chain"
+
+	signatureTagSuffix = ".sig"
+)
+
+// VerifyOptions configure the verification of the cosign signatures of images.
+// at least one of PublicKey or Roots must be set; an image is verified if any of its signatures
+// is valid for the digest of its manifest and has the required annotations
+type VerifyOptions struct {
+	// the PEM encoded public key of the signer, e.g. cosign.pub of cosign generate-key-pair.
+	// verifies the signatures made with the private key (cosign sign --key)
+	PublicKey []byte
+
+	// the PEM encoded root certificates of a Fulcio instance.
+	// verifies keyless signatures whose certificate chains to one of the roots.
+	// the certificate is verified at the time it was issued; entries of the transparency log are not verified
+	Roots []byte
+
+	// annotations which must be set to these values on the signed payload, e.g. with cosign sign -a
+	Annotations map[string]string
+}
+
+// Verifier verifies the cosign signatures attached to images, which are pulled with its puller
+type Verifier struct {
+	puller      pull.ImagePuller
+	publicKey   crypto.PublicKey
+	roots       *x509.CertPool
+	annotations map[string]string
+}
+
+func NewVerifier(puller pull.ImagePuller, opts VerifyOptions) (*Verifier, error) {
+	if len(opts.PublicKey) == 0 && len(opts.Roots) == 0 {
+		return nil, errors.Errorf("a public key or root certificates are required to verify signatures")
+	}
+	v := &Verifier{
+		puller:      puller,
+		annotations: opts.Annotations,
+	}
+	if len(opts.PublicKey) > 0 {
+		publicKey, err := ParsePublicKey(opts.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		v.publicKey = publicKey
+	}
+	if len(opts.Roots) > 0 {
+		v.roots = x509.NewCertPool()
+		if !v.roots.AppendCertsFromPEM(opts.Roots) {
+			return nil, errors.Errorf("no root certificates found")
+		}
+	}
+	return v, nil
+}
+
+// ParsePublicKey parses a PEM encoded ECDSA, RSA or Ed25519 public key
+func ParsePublicKey(pemBytes []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.Errorf("no PEM encoded public key found")
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing public key")
+	}
+	switch publicKey.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		return publicKey, nil
+	}
+	return nil, errors.Errorf("unsupported public key type %T", publicKey)
+}
+
+// SignatureRef returns the ref of the cosign signatures of the manifest of an image,
+// tagged sha256-<hex>.sig in the repository of the image
+func SignatureRef(ref string, manifestDigest digest.Digest) (string, error) {
+	if err := manifestDigest.Validate(); err != nil {
+		return "", err
+	}
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", err
+	}
+	tag := manifestDigest.Algorithm().String() + "-" + manifestDigest.Encoded() + signatureTagSuffix
+	tagged, err := reference.WithTag(reference.TrimNamed(named), tag)
+	if err != nil {
+		return "", err
+	}
+	return tagged.String(), nil
+}
+
+// Verify checks that a signature attached to the image is valid for the digest of its manifest.
+// returns an error if the image has no signatures, or none of them is valid
+func (v *Verifier) Verify(ctx context.Context, ref string, manifestDigest digest.Digest) error {
+	signatureRef, err := SignatureRef(ref, manifestDigest)
+	if err != nil {
+		return err
+	}
+	pulled, err := v.puller.Pull(ctx, signatureRef)
+	if err != nil {
+		return errors.Wrapf(err, "pulling signatures %v of image %v", signatureRef, ref)
+	}
+	signatures, ok := pulled.(pull.BlobImage)
+	if !ok {
+		return errors.Errorf("cannot read signatures %v of image %v", signatureRef, ref)
+	}
+
+	var failures []string
+	for _, layer := range signatures.Blobs() {
+		if layer.MediaType != SimpleSigningMediaType {
+			continue
+		}
+		if err := v.verifyLayer(ctx, signatures, layer, manifestDigest); err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+		return nil
+	}
+	if len(failures) == 0 {
+		return errors.Errorf("no signatures found for image %v", ref)
+	}
+	return errors.Errorf("no valid signature found for image %v: %v", ref, strings.Join(failures, "; "))
+}
+
+// the simple signing payload signed by cosign
+type payload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+	Optional map[string]interface{} `json:"optional"`
+}
+
+func (v *Verifier) verifyLayer(ctx context.Context, image pull.BlobImage, layer ocispec.Descriptor, manifestDigest digest.Digest) error {
+	signature, err := base64.StdEncoding.DecodeString(layer.Annotations[SignatureAnnotation])
+	if err != nil || len(signature) == 0 {
+		return errors.Errorf("signature %v has no valid %v annotation", layer.Digest, SignatureAnnotation)
+	}
+
+	rc, err := image.FetchBlob(ctx, layer)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	payloadBytes, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return err
+	}
+
+	if err := v.verifySignature(layer, payloadBytes, signature); err != nil {
+		return errors.Wrapf(err, "signature %v", layer.Digest)
+	}
+
+	// the payload is only trusted once its signature is verified
+	var signed payload
+	if err := json.Unmarshal(payloadBytes, &signed); err != nil {
+		return errors.Wrapf(err, "parsing payload of signature %v", layer.Digest)
+	}
+	if signed.Critical.Image.DockerManifestDigest != manifestDigest.String() {
+		return errors.Errorf("signature %v is for digest %v, not %v", layer.Digest, signed.Critical.Image.DockerManifestDigest, manifestDigest)
+	}
+	for key, expected := range v.annotations {
+		value, ok := signed.Optional[key]
+		if !ok {
+			return errors.Errorf("signature %v is missing the annotation %v", layer.Digest, key)
+		}
+		if actual := fmt.Sprint(value); actual != expected {
+			return errors.Errorf("signature %v has the annotation %v=%v, expected %v", layer.Digest, key, actual, expected)
+		}
+	}
+	return nil
+}
+
+// verifies the signature with the public key, or with the certificate of keyless signatures
+func (v *Verifier) verifySignature(layer ocispec.Descriptor, payload, signature []byte) error {
+	var err error
+	if v.publicKey != nil {
+		if err = verifyWithKey(v.publicKey, payload, signature); err == nil {
+			return nil
+		}
+	}
+	if v.roots != nil && layer.Annotations[CertificateAnnotation] != "" {
+		publicKey, certErr := v.verifyCertificate(layer)
+		if certErr != nil {
+			return certErr
+		}
+		return verifyWithKey(publicKey, payload, signature)
+	}
+	if err == nil {
+		err = errors.Errorf("keyless signature has no certificate")
+	}
+	return err
+}
+
+// verifies the certificate of a keyless signature against the roots, returning its public key
+func (v *Verifier) verifyCertificate(layer ocispec.Descriptor) (crypto.PublicKey, error) {
+	certs, err := parseCertificates([]byte(layer.Annotations[CertificateAnnotation]))
+	if err != nil || len(certs) == 0 {
+		return nil, errors.Errorf("invalid %v annotation", CertificateAnnotation)
+	}
+	cert := certs[0]
+	intermediates := x509.NewCertPool()
+	if chain := layer.Annotations[ChainAnnotation]; chain != "" {
+		chainCerts, err := parseCertificates([]byte(chain))
+		if err != nil {
+			return nil, errors.Errorf("invalid %v annotation", ChainAnnotation)
+		}
+		for _, chainCert := range chainCerts {
+			intermediates.AddCert(chainCert)
+		}
+	}
+	// fulcio certificates are short-lived, so they are verified at the time they were issued
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         v.roots,
+		Intermediates: intermediates,
+		CurrentTime:   cert.NotBefore,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}); err != nil {
+		return nil, errors.Wrap(err, "verifying certificate")
+	}
+	return cert.PublicKey, nil
+}
+
+func parseCertificates(pemBytes []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, pemBytes = pem.Decode(pemBytes)
+		if block == nil {
+			return certs, nil
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+}
+
+// cosign signs the sha256 digest of the payload, except with Ed25519 keys which sign the payload
+func verifyWithKey(publicKey crypto.PublicKey, payload, signature []byte) error {
+	hash := sha256.Sum256(payload)
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, hash[:], signature) {
+			return errors.Errorf("invalid signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		return errors.Wrap(rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature), "invalid signature")
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, payload, signature) {
+			return errors.Errorf("invalid signature")
+		}
+		return nil
+	}
+	return errors.Errorf("unsupported public key type %T", publicKey)
+}
+
+// NewVerifyingPuller returns a puller which verifies the signatures of the pulled images.
+// images whose digest is unknown, or which have no valid signature, are not returned
+func NewVerifyingPuller(puller pull.ImagePuller, verifier *Verifier) pull.ImagePuller {
+	return &verifyingPuller{puller: puller, verifier: verifier}
+}
+
+type verifyingPuller struct {
+	puller   pull.ImagePuller
+	verifier *Verifier
+}
+
+func (p *verifyingPuller) Pull(ctx context.Context, ref string) (pull.Image, error) {
+	image, err := p.puller.Pull(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	manifestImage, ok := image.(pull.ManifestImage)
+	if !ok {
+		return nil, errors.Errorf("cannot verify the signature of image %v: the digest of its manifest is unknown", ref)
+	}
+	if err := p.verifier.Verify(ctx, ref, manifestImage.ManifestDigest()); err != nil {
+		return nil, err
+	}
+	return image, nil
+}
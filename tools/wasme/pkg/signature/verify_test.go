@@ -0,0 +1,255 @@
+package signature_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/solo-io/wasm/tools/wasme/pkg/config"
+	"github.com/solo-io/wasm/tools/wasme/pkg/model"
+	"github.com/solo-io/wasm/tools/wasme/pkg/pull"
+	"github.com/solo-io/wasm/tools/wasme/pkg/signature"
+)
+
+var _ = Describe("Verifier", func() {
+	const ref = "webassemblyhub.io/user/filter:v1"
+	manifestDigest := digest.FromString("manifest")
+
+	var (
+		key    *ecdsa.PrivateKey
+		puller *fakePuller
+	)
+
+	BeforeEach(func() {
+		var err error
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		puller = &fakePuller{images: map[string]pull.Image{}}
+	})
+
+	publicKeyPem := func(key *ecdsa.PrivateKey) []byte {
+		der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		Expect(err).NotTo(HaveOccurred())
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	}
+
+	// returns a signature layer of the payload for the digest, signed with the key
+	sign := func(key *ecdsa.PrivateKey, signedDigest digest.Digest, annotations map[string]interface{}) signatureLayer {
+		payload := map[string]interface{}{
+			"critical": map[string]interface{}{
+				"identity": map[string]string{"docker-reference": "webassemblyhub.io/user/filter"},
+				"image":    map[string]string{"docker-manifest-digest": signedDigest.String()},
+				"type":     "cosign container image signature",
+			},
+			"optional": annotations,
+		}
+		payloadBytes, err := json.Marshal(payload)
+		Expect(err).NotTo(HaveOccurred())
+		hash := sha256.Sum256(payloadBytes)
+		sig, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+		Expect(err).NotTo(HaveOccurred())
+		return signatureLayer{
+			desc: ocispec.Descriptor{
+				MediaType:   signature.SimpleSigningMediaType,
+				Digest:      digest.FromBytes(payloadBytes),
+				Size:        int64(len(payloadBytes)),
+				Annotations: map[string]string{signature.SignatureAnnotation: base64.StdEncoding.EncodeToString(sig)},
+			},
+			payload: payloadBytes,
+		}
+	}
+
+	attach := func(layers ...signatureLayer) {
+		signatureRef, err := signature.SignatureRef(ref, manifestDigest)
+		Expect(err).NotTo(HaveOccurred())
+		puller.images[signatureRef] = &signatureImage{ref: signatureRef, layers: layers}
+	}
+
+	verify := func(opts signature.VerifyOptions) error {
+		verifier, err := signature.NewVerifier(puller, opts)
+		Expect(err).NotTo(HaveOccurred())
+		return verifier.Verify(context.TODO(), ref, manifestDigest)
+	}
+
+	It("refers to the signatures by the digest of the manifest", func() {
+		signatureRef, err := signature.SignatureRef(ref, manifestDigest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(signatureRef).To(Equal("webassemblyhub.io/user/filter:sha256-" + manifestDigest.Encoded() + ".sig"))
+	})
+
+	It("verifies the signatures made with the key", func() {
+		attach(sign(key, manifestDigest, nil))
+		Expect(verify(signature.VerifyOptions{PublicKey: publicKeyPem(key)})).To(Succeed())
+	})
+
+	It("accepts an image if any of its signatures is valid", func() {
+		otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		attach(sign(otherKey, manifestDigest, nil), sign(key, manifestDigest, nil))
+		Expect(verify(signature.VerifyOptions{PublicKey: publicKeyPem(key)})).To(Succeed())
+	})
+
+	It("rejects the signatures made with another key", func() {
+		otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		attach(sign(otherKey, manifestDigest, nil))
+		Expect(verify(signature.VerifyOptions{PublicKey: publicKeyPem(key)})).To(MatchError(ContainSubstring("invalid signature")))
+	})
+
+	It("rejects the signatures of another digest", func() {
+		attach(sign(key, digest.FromString("other"), nil))
+		Expect(verify(signature.VerifyOptions{PublicKey: publicKeyPem(key)})).To(MatchError(ContainSubstring("not " + manifestDigest.String())))
+	})
+
+	It("rejects images without signatures", func() {
+		Expect(verify(signature.VerifyOptions{PublicKey: publicKeyPem(key)})).To(MatchError(ContainSubstring("pulling signatures")))
+		attach()
+		Expect(verify(signature.VerifyOptions{PublicKey: publicKeyPem(key)})).To(MatchError(ContainSubstring("no signatures found")))
+	})
+
+	It("requires the annotations on the signed payload", func() {
+		attach(sign(key, manifestDigest, map[string]interface{}{"env": "prod"}))
+		Expect(verify(signature.VerifyOptions{PublicKey: publicKeyPem(key), Annotations: map[string]string{"env": "prod"}})).To(Succeed())
+		Expect(verify(signature.VerifyOptions{PublicKey: publicKeyPem(key), Annotations: map[string]string{"env": "dev"}})).To(MatchError(ContainSubstring("env=prod, expected dev")))
+		Expect(verify(signature.VerifyOptions{PublicKey: publicKeyPem(key), Annotations: map[string]string{"team": "mesh"}})).To(MatchError(ContainSubstring("missing the annotation team")))
+	})
+
+	It("verifies keyless signatures whose certificate chains to the roots", func() {
+		rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		rootTemplate := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: "fulcio"},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		}
+		rootDer, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+		Expect(err).NotTo(HaveOccurred())
+		root, err := x509.ParseCertificate(rootDer)
+		Expect(err).NotTo(HaveOccurred())
+
+		// the certificate of the signer expired right after the image was signed
+		leafDer, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			NotBefore:    time.Now().Add(-30 * time.Minute),
+			NotAfter:     time.Now().Add(-20 * time.Minute),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		}, root, &key.PublicKey, rootKey)
+		Expect(err).NotTo(HaveOccurred())
+
+		layer := sign(key, manifestDigest, nil)
+		layer.desc.Annotations[signature.CertificateAnnotation] = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDer}))
+		attach(layer)
+
+		rootPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: rootDer})
+		Expect(verify(signature.VerifyOptions{Roots: rootPem})).To(Succeed())
+
+		otherRootDer, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &key.PublicKey, key)
+		Expect(err).NotTo(HaveOccurred())
+		otherRootPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: otherRootDer})
+		Expect(verify(signature.VerifyOptions{Roots: otherRootPem})).To(MatchError(ContainSubstring("verifying certificate")))
+	})
+
+	It("only pulls the verified images", func() {
+		puller.images[ref] = &signatureImage{ref: ref, manifestDigest: manifestDigest}
+		verifier, err := signature.NewVerifier(puller, signature.VerifyOptions{PublicKey: publicKeyPem(key)})
+		Expect(err).NotTo(HaveOccurred())
+		verifying := signature.NewVerifyingPuller(puller, verifier)
+
+		_, err = verifying.Pull(context.TODO(), ref)
+		Expect(err).To(HaveOccurred())
+
+		attach(sign(key, manifestDigest, nil))
+		image, err := verifying.Pull(context.TODO(), ref)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(image.Ref()).To(Equal(ref))
+	})
+
+	It("requires a public key or roots", func() {
+		_, err := signature.NewVerifier(puller, signature.VerifyOptions{})
+		Expect(err).To(HaveOccurred())
+		_, err = signature.NewVerifier(puller, signature.VerifyOptions{PublicKey: []byte("not a key")})
+		Expect(err).To(MatchError(ContainSubstring("no PEM encoded public key found")))
+	})
+})
+
+type fakePuller struct {
+	images map[string]pull.Image
+}
+
+func (p *fakePuller) Pull(ctx context.Context, ref string) (pull.Image, error) {
+	image, ok := p.images[ref]
+	if !ok {
+		return nil, errors.Errorf("%v: not found", ref)
+	}
+	return image, nil
+}
+
+type signatureLayer struct {
+	desc    ocispec.Descriptor
+	payload []byte
+}
+
+type signatureImage struct {
+	ref            string
+	manifestDigest digest.Digest
+	layers         []signatureLayer
+}
+
+func (i *signatureImage) Ref() string {
+	return i.ref
+}
+
+func (i *signatureImage) Descriptor() (ocispec.Descriptor, error) {
+	return ocispec.Descriptor{}, errors.Errorf("media type %v not found on image", model.ContentMediaType)
+}
+
+func (i *signatureImage) FetchFilter(ctx context.Context) (model.Filter, error) {
+	return nil, errors.Errorf("media type %v not found on image", model.ContentMediaType)
+}
+
+func (i *signatureImage) FetchConfig(ctx context.Context) (*config.Runtime, error) {
+	return nil, errors.Errorf("media type %v not found on image", model.ConfigMediaType)
+}
+
+func (i *signatureImage) ManifestDigest() digest.Digest {
+	return i.manifestDigest
+}
+
+func (i *signatureImage) Blobs() []ocispec.Descriptor {
+	var blobs []ocispec.Descriptor
+	for _, layer := range i.layers {
+		blobs = append(blobs, layer.desc)
+	}
+	return blobs
+}
+
+func (i *signatureImage) FetchBlob(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+	for _, layer := range i.layers {
+		if layer.desc.Digest == desc.Digest {
+			return ioutil.NopCloser(bytes.NewReader(layer.payload)), nil
+		}
+	}
+	return nil, errors.Errorf("blob %v not found", desc.Digest)
+}
@@ -0,0 +1,162 @@
+package store
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/solo-io/wasm/tools/wasme/cli/pkg/defaults"
+)
+
+// the directory of the store containing the blob store
+const blobsDirname = "blobs"
+
+// Blob is a blob of the BlobStore
+type Blob struct {
+	Digest digest.Digest
+	Size   int64
+	// the time the blob was stored
+	Stored time.Time
+}
+
+// stores the content of pulled images (manifests, configs and filters) by digest,
+// so content which did not change is not downloaded again
+type BlobStore interface {
+	// returns the content of the blob with the digest, or false if the blob is not stored.
+	// a stored blob whose content does not match its digest is removed, and reported as not stored
+	Get(blobDigest digest.Digest) ([]byte, bool, error)
+	// stores the content of the blob with the digest, and returns it.
+	// nothing is stored if the content does not match the digest
+	Put(blobDigest digest.Digest, content io.Reader) ([]byte, error)
+	// returns the stored blobs, sorted by digest
+	List() ([]Blob, error)
+	// removes the blob with the digest. it is not an error if the blob is not stored
+	Delete(blobDigest digest.Digest) error
+}
+
+// blobs are written to a temporary file and renamed into place once their digest is verified,
+// so concurrent readers and writers never see partial content
+type blobStore struct {
+	dir string
+}
+
+// the blobs are stored under the blobs directory of the storage dir, which defaults to $HOME/.wasme/store
+func NewBlobStore(storageDir string) *blobStore {
+	if storageDir == "" {
+		storageDir = defaults.WasmeImageDir
+	}
+	return &blobStore{dir: filepath.Join(storageDir, blobsDirname)}
+}
+
+func (s *blobStore) Get(blobDigest digest.Digest) ([]byte, bool, error) {
+	filename, err := s.filename(blobDigest)
+	if err != nil {
+		return nil, false, err
+	}
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	if actual := blobDigest.Algorithm().FromBytes(content); actual != blobDigest {
+		logrus.Warnf("removing corrupted blob %v from the local store, its content has digest %v", blobDigest, actual)
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			return nil, false, err
+		}
+		return nil, false, nil
+	}
+	return content, true, nil
+}
+
+func (s *blobStore) Put(blobDigest digest.Digest, content io.Reader) ([]byte, error) {
+	filename, err := s.filename(blobDigest)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+	if actual := blobDigest.Algorithm().FromBytes(data); actual != blobDigest {
+		return nil, errors.Errorf("downloaded content has digest %v, expected %v", actual, blobDigest)
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// another invocation may have stored the same blob, which has the same content
+		err = os.Rename(file.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return data, nil
+}
+
+func (s *blobStore) List() ([]Blob, error) {
+	algorithms, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var blobs []Blob
+	for _, algorithm := range algorithms {
+		if !algorithm.IsDir() {
+			continue
+		}
+		files, err := ioutil.ReadDir(filepath.Join(s.dir, algorithm.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			blobDigest := digest.NewDigestFromEncoded(digest.Algorithm(algorithm.Name()), file.Name())
+			if !file.Mode().IsRegular() || blobDigest.Validate() != nil {
+				// e.g. a temporary file
+				continue
+			}
+			blobs = append(blobs, Blob{Digest: blobDigest, Size: file.Size(), Stored: file.ModTime()})
+		}
+	}
+	sort.Slice(blobs, func(i, j int) bool {
+		return blobs[i].Digest < blobs[j].Digest
+	})
+	return blobs, nil
+}
+
+func (s *blobStore) Delete(blobDigest digest.Digest) error {
+	filename, err := s.filename(blobDigest)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *blobStore) filename(blobDigest digest.Digest) (string, error) {
+	if err := blobDigest.Validate(); err != nil {
+		return "", errors.Wrapf(err, "invalid digest %q", blobDigest)
+	}
+	return filepath.Join(s.dir, blobDigest.Algorithm().String(), blobDigest.Encoded()), nil
+}
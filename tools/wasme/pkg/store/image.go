@@ -20,9 +20,16 @@ type storedImage struct {
 	descriptor  ocispec.Descriptor
 	filterBytes []byte
 	config      *config.Runtime
+	// empty if the image is pushed in the default format
+	format model.Format
 }
 
 func NewStorableImage(ref string, descriptor ocispec.Descriptor, filterBytes []byte, runtime *config.Runtime) (*storedImage, error) {
+	return NewStorableImageWithFormat(ref, descriptor, filterBytes, runtime, "")
+}
+
+// NewStorableImageWithFormat returns an image which records the format it is pushed in, e.g. by wasme push
+func NewStorableImageWithFormat(ref string, descriptor ocispec.Descriptor, filterBytes []byte, runtime *config.Runtime, format model.Format) (*storedImage, error) {
 	ref, err := model.FullRef(ref)
 	if err != nil {
 		return nil, err
@@ -32,6 +39,7 @@ func NewStorableImage(ref string, descriptor ocispec.Descriptor, filterBytes []b
 		descriptor:  descriptor,
 		filterBytes: filterBytes,
 		config:      runtime,
+		format:      format,
 	}, nil
 }
 
@@ -51,3 +59,7 @@ func (i *storedImage) FetchFilter(ctx context.Context) (model.Filter, error) {
 func (i *storedImage) FetchConfig(ctx context.Context) (*config.Runtime, error) {
 	return i.config, nil
 }
+
+func (i *storedImage) Format() model.Format {
+	return i.format
+}
@@ -49,7 +49,7 @@ func (s *store) List() ([]Image, error) {
 	var images []Image
 	var readErrors error
 	for _, file := range files {
-		if !file.IsDir() {
+		if !file.IsDir() || file.Name() == blobsDirname {
 			continue
 		}
 
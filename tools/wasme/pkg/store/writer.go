@@ -21,6 +21,8 @@ const (
 	descriptorFilename = "descriptor.json"
 	configFilename     = model.ConfigFilename
 	filterFilename     = model.CodeFilename
+	// only written for images which are not pushed in the default format
+	formatFilename = "format"
 )
 
 // writes an image into and reads an image out of a directory
@@ -80,6 +82,19 @@ func (w imageReadWriter) writeFilter(ctx context.Context, image Image) error {
 	return destFile.Close()
 }
 
+func (w imageReadWriter) writeFormat(image Image) error {
+	formatFile := filepath.Join(w.dir, formatFilename)
+	format := model.ImageFormat(image)
+	if format == model.FormatWasme {
+		// the image may be overwritten by an image in the default format
+		if err := os.Remove(formatFile); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return ioutil.WriteFile(formatFile, []byte(format), 0644)
+}
+
 func (w imageReadWriter) writeImage(ctx context.Context, image Image) error {
 	if err := os.MkdirAll(w.dir, 0777); err != nil {
 		return err
@@ -97,6 +112,9 @@ func (w imageReadWriter) writeImage(ctx context.Context, image Image) error {
 	if err := w.writeFilter(ctx, image); err != nil {
 		return err
 	}
+	if err := w.writeFormat(image); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -141,6 +159,19 @@ func (w imageReadWriter) readFilter() ([]byte, error) {
 	return ioutil.ReadFile(filterFile)
 }
 
+// returns an empty format if the image is pushed in the default format
+func (w imageReadWriter) readFormat() (model.Format, error) {
+	formatFile := filepath.Join(w.dir, formatFilename)
+	raw, err := ioutil.ReadFile(formatFile)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return model.ParseFormat(string(raw))
+}
+
 // will skip loading the filter
 func (w imageReadWriter) readImage() (*storedImage, error) {
 	ref, err := w.readRef()
@@ -159,6 +190,10 @@ func (w imageReadWriter) readImage() (*storedImage, error) {
 	if err != nil {
 		return nil, err
 	}
+	format, err := w.readFormat()
+	if err != nil {
+		return nil, err
+	}
 
-	return NewStorableImage(ref, desc, filterBytes, cfg)
+	return NewStorableImageWithFormat(ref, desc, filterBytes, cfg, format)
 }
@@ -0,0 +1,85 @@
+package util
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// the digest algorithms accepted by wasme
+var SupportedDigestAlgorithms = []digest.Algorithm{
+	digest.SHA256,
+	digest.SHA384,
+	digest.SHA512,
+}
+
+// returned for a digest which cannot be normalized
+type InvalidDigestError struct {
+	// the offending value
+	Digest string
+	Reason string
+}
+
+func (e *InvalidDigestError) Error() string {
+	return fmt.Sprintf("invalid digest %q: %v", e.Digest, e.Reason)
+}
+
+// NormalizeDigest validates a digest and returns it in canonical form:
+// a supported algorithm followed by the full-length, lowercase hex encoding.
+// uppercase hex is accepted, as is the short form omitting the algorithm, which is read as sha256.
+// truncated digests are rejected, as they cannot identify the file written by the cache
+func NormalizeDigest(value string) (digest.Digest, error) {
+	algorithm, encoded := digest.Canonical, value
+	if i := strings.Index(value, ":"); i >= 0 {
+		algorithm, encoded = digest.Algorithm(strings.ToLower(value[:i])), value[i+1:]
+	}
+
+	if !isSupportedAlgorithm(algorithm) {
+		return "", &InvalidDigestError{
+			Digest: value,
+			Reason: fmt.Sprintf("unsupported algorithm %q, must be one of %v", algorithm, SupportedDigestAlgorithms),
+		}
+	}
+
+	if expected := hex.EncodedLen(algorithm.Size()); len(encoded) != expected {
+		return "", &InvalidDigestError{
+			Digest: value,
+			Reason: fmt.Sprintf("expected %v hex characters for %v, got %v", expected, algorithm, len(encoded)),
+		}
+	}
+
+	encoded = strings.ToLower(encoded)
+	if _, err := hex.DecodeString(encoded); err != nil {
+		return "", &InvalidDigestError{
+			Digest: value,
+			Reason: "encoded value is not hex",
+		}
+	}
+
+	return digest.NewDigestFromEncoded(algorithm, encoded), nil
+}
+
+// NormalizeImageRef normalizes the digest of a ref of the form name@digest.
+// refs without a digest are returned unchanged
+func NormalizeImageRef(ref string) (string, error) {
+	i := strings.LastIndex(ref, "@")
+	if i < 0 {
+		return ref, nil
+	}
+	normalized, err := NormalizeDigest(ref[i+1:])
+	if err != nil {
+		return "", err
+	}
+	return ref[:i+1] + normalized.String(), nil
+}
+
+func isSupportedAlgorithm(algorithm digest.Algorithm) bool {
+	for _, supported := range SupportedDigestAlgorithms {
+		if algorithm == supported {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+//go:build go1.18
+// +build go1.18
+
+package util_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/solo-io/wasm/tools/wasme/pkg/util"
+)
+
+func FuzzNormalizeDigest(f *testing.F) {
+	f.Add("sha256:e454cab754cf9234e8b41d7c5e30f53a4c125d7d9443cb3ef2b2eb1c4bd1ec14")
+	f.Add("SHA256:E454CAB754CF9234E8B41D7C5E30F53A4C125D7D9443CB3EF2B2EB1C4BD1EC14")
+	f.Add("e454cab754cf9234e8b41d7c5e30f53a4c125d7d9443cb3ef2b2eb1c4bd1ec14")
+	f.Add("sha256:e454cab754cf")
+	f.Add("sha512:")
+	f.Add(":")
+	f.Fuzz(func(t *testing.T, value string) {
+		normalized, err := util.NormalizeDigest(value)
+		if err != nil {
+			if _, ok := err.(*util.InvalidDigestError); !ok {
+				t.Fatalf("expected an InvalidDigestError for %q, got %T", value, err)
+			}
+			return
+		}
+		if err := normalized.Validate(); err != nil {
+			t.Fatalf("normalized %q to invalid digest %q: %v", value, normalized, err)
+		}
+		if strings.ToLower(normalized.String()) != normalized.String() {
+			t.Fatalf("normalized %q to %q which is not lowercase", value, normalized)
+		}
+		again, err := util.NormalizeDigest(normalized.String())
+		if err != nil || again != normalized {
+			t.Fatalf("normalizing %q is not idempotent: got %q, %v", normalized, again, err)
+		}
+	})
+}
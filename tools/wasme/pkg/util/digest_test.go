@@ -0,0 +1,76 @@
+package util_test
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+
+	. "github.com/solo-io/wasm/tools/wasme/pkg/util"
+)
+
+var _ = Describe("NormalizeDigest", func() {
+	const sha = "e454cab754cf9234e8b41d7c5e30f53a4c125d7d9443cb3ef2b2eb1c4bd1ec14"
+
+	expectInvalid := func(value, reason string) {
+		_, err := NormalizeDigest(value)
+		Expect(err).To(HaveOccurred())
+		invalid, ok := err.(*InvalidDigestError)
+		Expect(ok).To(BeTrue())
+		Expect(invalid.Digest).To(Equal(value))
+		Expect(invalid.Reason).To(ContainSubstring(reason))
+	}
+
+	It("returns canonical digests unchanged", func() {
+		d, err := NormalizeDigest("sha256:" + sha)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(d).To(Equal(digest.Digest("sha256:" + sha)))
+	})
+	It("lowercases the algorithm and hex", func() {
+		d, err := NormalizeDigest("SHA256:" + strings.ToUpper(sha))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(d).To(Equal(digest.Digest("sha256:" + sha)))
+	})
+	It("reads digests without an algorithm as sha256", func() {
+		d, err := NormalizeDigest(sha)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(d).To(Equal(digest.Digest("sha256:" + sha)))
+	})
+	It("accepts sha512 digests", func() {
+		d, err := NormalizeDigest("sha512:" + strings.Repeat("a", 128))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(d.Algorithm()).To(Equal(digest.SHA512))
+	})
+	It("rejects unsupported algorithms", func() {
+		expectInvalid("md5:"+sha[:32], `unsupported algorithm "md5"`)
+	})
+	It("rejects truncated digests", func() {
+		expectInvalid("sha256:"+sha[:12], "expected 64 hex characters for sha256, got 12")
+	})
+	It("rejects digests which are not hex", func() {
+		expectInvalid("sha256:"+strings.Repeat("z", 64), "not hex")
+	})
+	It("rejects empty digests", func() {
+		expectInvalid("", "expected 64 hex characters")
+	})
+})
+
+var _ = Describe("NormalizeImageRef", func() {
+	const sha = "e454cab754cf9234e8b41d7c5e30f53a4c125d7d9443cb3ef2b2eb1c4bd1ec14"
+
+	It("normalizes the digest of the ref", func() {
+		ref, err := NormalizeImageRef("webassemblyhub.io/example/filter@sha256:" + strings.ToUpper(sha))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ref).To(Equal("webassemblyhub.io/example/filter@sha256:" + sha))
+	})
+	It("returns refs without a digest unchanged", func() {
+		ref, err := NormalizeImageRef("localhost:8080/example/filter:v1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ref).To(Equal("localhost:8080/example/filter:v1"))
+	})
+	It("rejects refs with an invalid digest", func() {
+		_, err := NormalizeImageRef("webassemblyhub.io/example/filter@sha256:" + sha[:12])
+		Expect(err).To(BeAssignableToTypeOf(&InvalidDigestError{}))
+	})
+})
@@ -1,6 +1,9 @@
 package util
 
-import "github.com/docker/distribution/reference"
+import (
+	"github.com/docker/distribution/reference"
+	"github.com/opencontainers/go-digest"
+)
 
 // splits a ref into the repo and tag
 // if tag is empty, returns "latest"
@@ -17,3 +20,40 @@ func SplitImageRef(ref string) (string, string, error) {
 
 	return named.Name(), tag, nil
 }
+
+// splits a ref into the repo, tag and digest.
+// if the ref has a digest, the tag is empty unless the ref has both, e.g. repo:v1@sha256:...
+// if the ref has neither, the tag is "latest"
+func SplitImageRefDigest(ref string) (string, string, digest.Digest, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	var tag string
+	if tagged, isTagged := named.(reference.Tagged); isTagged {
+		tag = tagged.Tag()
+	}
+	var imageDigest digest.Digest
+	if digested, isDigested := named.(reference.Digested); isDigested {
+		imageDigest = digested.Digest()
+	} else if tag == "" {
+		tag = "latest"
+	}
+
+	return named.Name(), tag, imageDigest, nil
+}
+
+// returns the ref pinned to the digest, e.g. repo@sha256:... for repo:v1,
+// so the same image is pulled even if the tag is moved
+func PinImageRef(ref string, imageDigest digest.Digest) (string, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", err
+	}
+	pinned, err := reference.WithDigest(reference.TrimNamed(named), imageDigest)
+	if err != nil {
+		return "", err
+	}
+	return pinned.String(), nil
+}
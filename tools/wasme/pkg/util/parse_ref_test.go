@@ -23,3 +23,31 @@ var _ = Describe("ParseRef", func() {
 		Expect(tag).To(Equal("latest"))
 	})
 })
+
+var _ = Describe("SplitImageRefDigest", func() {
+	const imageDigest = "sha256:e454cab754cf9234e8b41d7c5e30f53a4c125d7d9443cb3ef2b2eb1c4bd1ec14"
+
+	It("splits a ref with a digest", func() {
+		name, tag, dgst, err := SplitImageRefDigest("localhost:8080/taco/tuesdays@" + imageDigest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(name).To(Equal("localhost:8080/taco/tuesdays"))
+		Expect(tag).To(BeEmpty())
+		Expect(dgst.String()).To(Equal(imageDigest))
+
+		_, tag, dgst, err = SplitImageRefDigest("localhost:8080/taco/tuesdays:v1@" + imageDigest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tag).To(Equal("v1"))
+		Expect(dgst.String()).To(Equal(imageDigest))
+	})
+	It("defaults the tag of a ref without a digest", func() {
+		_, tag, dgst, err := SplitImageRefDigest("localhost:8080/taco/tuesdays")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tag).To(Equal("latest"))
+		Expect(dgst).To(BeEmpty())
+	})
+	It("pins a ref to a digest", func() {
+		pinned, err := PinImageRef("localhost:8080/taco/tuesdays:v1", imageDigest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pinned).To(Equal("localhost:8080/taco/tuesdays@" + imageDigest))
+	})
+})